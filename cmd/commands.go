@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/migrate"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// version is the version of the build, set with -ldflags "-X main.version=..."
+var version = "dev"
+
+// usage prints the commands
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: otp-auth <command> [flags]
+
+Commands:
+  serve          run the server (the default)
+  migrate        apply the database migrations not applied yet
+  version        print the version
+  admin create   grant the admin role to a phone number's user, creating the user if needed
+  dev-token      print an access token for any user, when service.env is development
+
+Run otp-auth <command> -h for the flags of a command.
+`)
+}
+
+// migrateCommand applies the database migrations not applied yet
+func migrateCommand(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := flags.String("dir", "migrations", "directory of the migrations")
+	flags.Parse(args)
+
+	cfg, logger, _ := setUp()
+	// Migrations may rewrite whole tables, which takes longer than queries are allowed to
+	cfg.Postgres.StatementTimeout = 0
+
+	migrations, err := migrate.Load(*dir)
+	if err != nil {
+		fatal(logger, "Failed to load migrations", err)
+	}
+
+	db, err := utils.SetupDatabase(cfg)
+	if err != nil {
+		fatal(logger, "Failed to setup database", err)
+	}
+	defer db.Close()
+
+	applied, err := migrate.Up(context.Background(), db, migrations)
+	for _, id := range applied {
+		logger.Info("Applied migration", "migration", id)
+	}
+	if err != nil {
+		db.Close()
+		fatal(logger, "Failed to apply migrations", err)
+	}
+	logger.Info("Database is up to date", "applied", len(applied), "migrations", len(migrations))
+}
+
+// versionCommand prints the version, with the commit it was built from if known
+func versionCommand(args []string) {
+	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	flags.Parse(args)
+
+	revision := "unknown"
+	goVersion := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		goVersion = info.GoVersion
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+	}
+	fmt.Printf("otp-auth %s (commit %s, %s)\n", version, revision, goVersion)
+}
+
+// adminCommand runs the admin subcommands
+func adminCommand(args []string) {
+	if len(args) == 0 || args[0] != "create" {
+		usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("admin create", flag.ExitOnError)
+	phone := flags.String("phone", "", "phone number of the user")
+	role := flags.String("role", models.RoleAdmin, "role to grant: admin, operator or user")
+	flags.Parse(args[1:])
+	if *phone == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, logger, _ := setUp()
+
+	db, err := utils.SetupDatabase(cfg)
+	if err != nil {
+		fatal(logger, "Failed to setup database", err)
+	}
+	defer db.Close()
+
+	// Role changes are recorded in the domain event log and audit trail like changes made by the server
+	roleService := service.NewRoleService(repository.NewPostgresUnitOfWork(db, cfg.GetQueryTimeout()))
+
+	// Grants from the command line have no actor user; the user agent tells them apart
+	actor := models.AuditActor{UserAgent: "otp-auth admin create"}
+
+	user, created, err := roleService.GrantRole(context.Background(), actor, *phone, *role)
+	if err != nil {
+		db.Close()
+		fatal(logger, "Failed to grant role", err)
+	}
+	logger.Info("Granted role", "user_id", user.ID, "phone_number", user.PhoneNumber, "role", user.Role, "created", created)
+}
+
+// devTokenCommand prints an access token for any user, so frontends can be developed against
+// protected routes without signing in by OTP. The token has a session in Redis like any other,
+// so it can be revoked. It only runs when service.env is development.
+func devTokenCommand(args []string) {
+	flags := flag.NewFlagSet("dev-token", flag.ExitOnError)
+	userID := flags.String("user", "", "ID of the user, random if empty")
+	phone := flags.String("phone", "+989120000000", "phone number of the user")
+	role := flags.String("role", models.RoleUser, "role of the user, granting its permissions: user, operator or admin")
+	scope := flags.String("scope", "", "space-separated scopes of the token")
+	expiresIn := flags.Duration("expires", 24*time.Hour, "how long the token is valid for")
+	flags.Parse(args)
+
+	cfg, logger, _ := setUp()
+
+	id := uuid.New()
+	if *userID != "" {
+		var err error
+		if id, err = uuid.Parse(*userID); err != nil {
+			fatal(logger, "Invalid user ID", err)
+		}
+	}
+
+	redisClient, err := utils.SetupRedis(cfg)
+	if err != nil {
+		fatal(logger, "Failed to setup Redis", err)
+	}
+	defer redisClient.Close()
+
+	// Minting only starts a session, needing neither the users nor the event log
+	tokens := service.NewTokenSigner(cfg, newKMSSigner(logger, cfg))
+	sessions := service.NewSessionService(repository.NewRedisSessionRepository(redisClient), nil, nil, tokens, cfg)
+	token, err := sessions.MintDevToken(context.Background(), service.DevToken{
+		UserID:      id,
+		PhoneNumber: *phone,
+		Role:        *role,
+		Scopes:      strings.Fields(*scope),
+		ExpiresIn:   *expiresIn,
+	})
+	if err != nil {
+		redisClient.Close()
+		fatal(logger, "Failed to mint dev token", err)
+	}
+	fmt.Println(token)
+}
@@ -0,0 +1,164 @@
+// Command import-users imports users from a CSV file, keeping phone verification
+// done by another system. It is the command line counterpart of
+// POST /v1/admin/users/import and reads the same configuration as the server.
+//
+// The CSV file has a header row with the columns phone_number, phone_verified
+// and verified_source:
+//
+//	phone_number,phone_verified,verified_source
+//	09121234567,true,legacy_crm
+//	09351234567,false,
+//
+// Usage:
+//
+//	import-users -file users.csv
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+func main() {
+	file := flag.String("file", "", "CSV file with the users to import")
+	batchSize := flag.Int("batch", service.MaxImportBatchSize, "number of users imported per batch")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *batchSize <= 0 || *batchSize > service.MaxImportBatchSize {
+		log.Fatalf("Batch size must be between 1 and %d", service.MaxImportBatchSize)
+	}
+
+	users, err := readUsers(*file)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *file, err)
+	}
+
+	cfg := config.LoadConfig()
+
+	// Log through the structured logger so phone numbers are masked as configured
+	logger := logging.New(cfg.Logging, os.Stderr)
+	slog.SetDefault(logger)
+
+	// Setup database
+	db, err := utils.SetupDatabase(cfg)
+	if err != nil {
+		log.Fatalf("Failed to setup database: %v", err)
+	}
+	defer db.Close()
+
+	// Imported users are recorded in the domain event log like users created by the server
+	userRepo := repository.NewEventRecordingUserRepository(
+		repository.NewPostgresUserRepository(db, cfg.GetQueryTimeout()),
+		repository.NewPostgresEventRepository(db, cfg.GetQueryTimeout()),
+	)
+	auditService := service.NewAuditService(repository.NewPostgresAuditRepository(db, cfg.GetQueryTimeout()))
+	importService := service.NewImportService(userRepo, auditService)
+
+	// Imports from the command line have no actor user; the user agent tells them apart
+	actor := models.AuditActor{UserAgent: "import-users"}
+
+	ctx := context.Background()
+	imported, skipped, failed := 0, 0, 0
+	for start := 0; start < len(users); start += *batchSize {
+		end := start + *batchSize
+		if end > len(users) {
+			end = len(users)
+		}
+
+		response, err := importService.ImportUsers(ctx, actor, users[start:end])
+		if err != nil {
+			log.Fatalf("Failed to import users %d-%d: %v", start+1, end, err)
+		}
+		for _, result := range response.Results {
+			if result.Error != "" {
+				logger.Error("Failed to import user", "phone_number", result.PhoneNumber, "error", result.Error)
+			}
+		}
+		log.Printf("Batch %s: imported %d, skipped %d, failed %d",
+			response.BatchID, response.Imported, response.Skipped, response.Failed)
+
+		imported += response.Imported
+		skipped += response.Skipped
+		failed += response.Failed
+	}
+
+	fmt.Printf("Imported %d, skipped %d, failed %d of %d users\n", imported, skipped, failed, len(users))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readUsers reads the users to import from a CSV file with a header row
+func readUsers(path string) ([]models.ImportUser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["phone_number"]; !ok {
+		return nil, errors.New("missing phone_number column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var users []models.ImportUser
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading line %d: %w", line, err)
+		}
+
+		user := models.ImportUser{
+			PhoneNumber:    field(record, "phone_number"),
+			VerifiedSource: field(record, "verified_source"),
+		}
+		if verified := field(record, "phone_verified"); verified != "" {
+			user.PhoneVerified, err = strconv.ParseBool(verified)
+			if err != nil {
+				return nil, fmt.Errorf("invalid phone_verified on line %d: %q", line, verified)
+			}
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,17 @@
+//go:build lambda
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/lilokie/otp-auth/internal/lambda"
+)
+
+// lambdaBuild reports whether the binary is built to run on AWS Lambda (-tags lambda)
+const lambdaBuild = true
+
+// serveLambda serves the function's invocations with handler until the function is shut down
+func serveLambda(handler http.Handler) error {
+	return lambda.Start(handler)
+}
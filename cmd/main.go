@@ -3,26 +3,57 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
 	"github.com/lilokie/otp-auth/config"
 	_ "github.com/lilokie/otp-auth/docs" // Import swagger docs
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/canary"
+	"github.com/lilokie/otp-auth/internal/captcha"
+	"github.com/lilokie/otp-auth/internal/components"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/dynamodb"
+	"github.com/lilokie/otp-auth/internal/email"
+	"github.com/lilokie/otp-auth/internal/flashcall"
 	"github.com/lilokie/otp-auth/internal/handlers"
+	"github.com/lilokie/otp-auth/internal/health"
+	"github.com/lilokie/otp-auth/internal/kms"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
 	"github.com/lilokie/otp-auth/internal/middleware"
+	"github.com/lilokie/otp-auth/internal/migrate"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/policy"
+	"github.com/lilokie/otp-auth/internal/pubsub"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
 	"github.com/lilokie/otp-auth/internal/repository"
 	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/sharding"
+	"github.com/lilokie/otp-auth/internal/silentauth"
+	"github.com/lilokie/otp-auth/internal/sms"
 	"github.com/lilokie/otp-auth/internal/utils"
+	"github.com/lilokie/otp-auth/internal/validation"
+	"github.com/lilokie/otp-auth/internal/webhook"
 )
 
 // @title OTP Authentication API
@@ -36,143 +67,1216 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and the JWT token.
 func main() {
-	cfg := config.LoadConfig()
+	// Without a command, or with only flags, the server is started as before commands existed
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	// Setup database
-	db, err := utils.SetupDatabase(cfg)
+	switch command {
+	case "serve":
+		serve(args)
+	case "migrate":
+		migrateCommand(args)
+	case "version":
+		versionCommand(args)
+	case "admin":
+		adminCommand(args)
+	case "dev-token":
+		devTokenCommand(args)
+	case "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+// serve runs the server until it is interrupted
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	componentsFlag := flags.String("components", components.All, "comma-separated components to run: api, worker and scheduler")
+	flags.Parse(args)
+
+	cfg, logger, logLevel := setUp()
+	run, err := components.Parse(*componentsFlag)
 	if err != nil {
-		log.Fatalf("Failed to setup database: %v", err)
+		fatal(logger, "Invalid components", err)
 	}
+	logger.Info("Running components", "components", run.String())
 
-	// Setup Redis
-	redisClient, err := utils.SetupRedis(cfg)
+	// Setup database and Redis, unless all state is kept in process memory. On Lambda they are
+	// dialed by the first invocation needing them rather than at startup, keeping round trips
+	// out of cold starts.
+	memoryStore := cfg.MemoryStore()
+	var db *sqlx.DB
+	var redisClient *redis.Client
+	switch {
+	case memoryStore:
+		logger.Warn("Keeping all state in process memory; it is lost on restart and not shared with other instances")
+	case lambdaBuild:
+		db, err = utils.OpenDatabase(cfg)
+		if err == nil {
+			redisClient, err = utils.NewRedisClient(cfg)
+		}
+	default:
+		db, err = utils.SetupDatabase(cfg)
+		if err == nil {
+			redisClient, err = utils.SetupRedis(cfg)
+		}
+	}
 	if err != nil {
-		log.Fatalf("Failed to setup Redis: %v", err)
+		fatal(logger, "Failed to setup database and Redis", err)
+	}
+
+	// Setup the Redis shards OTP and rate limit keys are spread across; without shards they live in the main instance
+	shardClients := []*redis.Client{redisClient}
+	var shardRouter *sharding.Router
+	if len(cfg.Redis.Shards) > 0 {
+		names := make([]string, len(cfg.Redis.Shards))
+		for i, shard := range cfg.Redis.Shards {
+			names[i] = shard.Name
+		}
+		if shardRouter, err = sharding.NewRouter(names); err != nil {
+			fatal(logger, "Invalid Redis shard configuration", err)
+		}
+		if shardClients, err = utils.SetupRedisShards(cfg); err != nil {
+			fatal(logger, "Failed to setup Redis shards", err)
+		}
+	}
+
+	// Setup the Redis instances of the other regions OTPs are replicated to
+	var regionClients []*redis.Client
+	if len(cfg.Redis.Regions) > 0 {
+		if cfg.Redis.Region == "" {
+			fatal(logger, "Invalid Redis region configuration", fmt.Errorf("redis.region must name this instance's region"))
+		}
+		if shardRouter != nil {
+			fatal(logger, "Invalid Redis region configuration", fmt.Errorf("OTPs cannot be replicated across regions when sharded"))
+		}
+		if regionClients, err = utils.SetupRedisRegions(cfg); err != nil {
+			fatal(logger, "Failed to setup Redis regions", err)
+		}
+	}
+
+	// Setup DynamoDB, if OTPs and rate limits are kept there instead of Redis
+	var dynamoClient *dynamodb.Client
+	if cfg.DynamoDB.Enabled {
+		if shardRouter != nil || len(regionClients) > 0 {
+			fatal(logger, "Invalid DynamoDB configuration", fmt.Errorf("OTPs kept in DynamoDB cannot be sharded or replicated across Redis regions"))
+		}
+		dynamoClient, err = dynamodb.NewClient(context.Background(), cfg.DynamoDB.Region, cfg.DynamoDB.Endpoint, cfg.DynamoDB.GetTimeout())
+		if err != nil {
+			fatal(logger, "Failed to setup DynamoDB", err)
+		}
+	}
+	if cfg.GetOTPStore() == "postgres" && (shardRouter != nil || len(regionClients) > 0 || dynamoClient != nil) {
+		fatal(logger, "Invalid OTP store configuration", fmt.Errorf("OTPs kept in Postgres cannot be sharded, replicated across Redis regions or kept in DynamoDB"))
+	}
+	if (cfg.GetOTPStore() == "memory" || cfg.GetRateLimitStore() == "memory") && (shardRouter != nil || len(regionClients) > 0 || dynamoClient != nil) {
+		fatal(logger, "Invalid memory store configuration", fmt.Errorf("OTPs and rate limits kept in memory cannot be sharded, replicated across Redis regions or kept in DynamoDB"))
+	}
+
+	// Create metrics registry and start sampling Redis keyspace statistics
+	registry := metrics.NewRegistry()
+	// Background loops stop taking on new work once collectorCtx is done; shutdown waits for them
+	collectorCtx, stopCollector := context.WithCancel(context.Background())
+	defer stopCollector()
+	var background sync.WaitGroup
+	if redisClient != nil {
+		runInBackground(&background, func() {
+			metrics.NewRedisCollector(redisClient, registry, cfg.GetRedisStatsInterval(), logger).Run(collectorCtx)
+		})
+	}
+
+	// Estimate the instance's load for load balancers from in-flight requests and dependency latency,
+	// and check the same dependencies for readiness; the instance isn't ready while any is down
+	loadMonitor := health.NewLoadMonitor(cfg, registry, logger)
+	checker := health.NewChecker(cfg.GetHealthTimeout())
+	addDependency := func(name string, probe health.Probe) {
+		loadMonitor.AddDependency(name, probe)
+		checker.Add(name, probe, true)
+	}
+	if !memoryStore {
+		addDependency("postgres", db.PingContext)
+		addDependency("redis", func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		})
+	}
+	if shardRouter != nil {
+		for i, client := range shardClients {
+			addDependency("redis:"+cfg.Redis.Shards[i].Name, func(ctx context.Context) error {
+				return client.Ping(ctx).Err()
+			})
+		}
 	}
+	if dynamoClient != nil {
+		addDependency("dynamodb", func(ctx context.Context) error {
+			_, err := dynamoClient.GetItem(ctx, &awsdynamodb.GetItemInput{TableName: aws.String(cfg.DynamoDB.GetTable()), Key: dynamodb.Key("ping", "ping")})
+			return err
+		})
+	}
+	runInBackground(&background, func() { loadMonitor.Run(collectorCtx) })
 
-	// Create repositories
-	userRepo := repository.NewPostgresUserRepository(db)
-	otpRepo := repository.NewRedisOTPRepository(redisClient)
+	// Compare the database schema with the migrations, so columns missing after a deployment
+	// show up on startup rather than as errors of the requests using them
+	if !memoryStore && cfg.Postgres.SchemaCheck != "off" {
+		checkSchema(logger, cfg, db, checker)
+	}
+
+	// Relay changes such as verified challenges and phone list updates between instances
+	var broker pubsub.Broker = pubsub.NewInMemoryBroker()
+	if redisClient != nil {
+		broker = pubsub.NewRedisBroker(redisClient)
+	}
+	bus := pubsub.NewBus(broker, registry, logger)
+	runInBackground(&background, func() { bus.Run(collectorCtx) })
+
+	// Create rate limit policies for the OTP service and rate limited routes
+	otpRateLimit := newRateLimitPolicy(logger, cfg, registry, dynamoClient, shardRouter, shardClients, cfg.OTP.RateLimit)
+	requestOTPRateLimit := newRateLimitPolicy(logger, cfg, registry, dynamoClient, shardRouter, shardClients, cfg.GetRouteRateLimit("request-otp"))
+	abuseReportRateLimit := newRateLimitPolicy(logger, cfg, registry, dynamoClient, shardRouter, shardClients, cfg.GetRouteRateLimit("abuse-reports"))
+	captchaThreshold := newRateLimitPolicy(logger, cfg, registry, dynamoClient, shardRouter, shardClients, cfg.Captcha.Threshold)
+	policyLimiters := newPolicyLimiters(logger, cfg, registry, dynamoClient, shardRouter, shardClients)
+
+	// Services read reloadable settings from the reloader; apply reloads to what was set up from them
+	reloader := config.NewReloader(cfg)
+	reloader.OnReload(func(cfg *config.Config) {
+		logLevel.Set(logging.ParseLevel(cfg.Logging.Level))
+		updateRateLimitPolicy(otpRateLimit, cfg.OTP.RateLimit)
+		updateRateLimitPolicy(requestOTPRateLimit, cfg.GetRouteRateLimit("request-otp"))
+		updateRateLimitPolicy(abuseReportRateLimit, cfg.GetRouteRateLimit("abuse-reports"))
+		updateRateLimitPolicy(captchaThreshold, cfg.Captcha.Threshold)
+	})
+
+	// Shed load with adaptive concurrency limits when Redis slows down
+	if cfg.Concurrency.Redis.Enabled && redisClient != nil {
+		redisLimiter := concurrency.NewAdaptiveLimiter("redis", cfg.Concurrency.Redis, registry)
+		redisClient.AddHook(concurrency.NewRedisHook(redisLimiter))
+		if shardRouter != nil {
+			for _, client := range shardClients {
+				client.AddHook(concurrency.NewRedisHook(redisLimiter))
+			}
+		}
+	}
+
+	// Create repositories; Postgres calls give up after the query timeout
+	queryTimeout := cfg.GetQueryTimeout()
+	var (
+		postgresUserRepo  *repository.PostgresUserRepository
+		userRepo          repository.UserRepository
+		auditRepo         repository.AuditRepository
+		backupCodeRepo    repository.BackupCodeRepository
+		eventRepo         repository.EventRepository
+		abuseReportRepo   repository.AbuseReportRepository
+		suppressionRepo   repository.SuppressionRepository
+		phoneListRepo     repository.PhoneListRepository
+		loginHistoryRepo  repository.LoginHistoryRepository
+		trustedDeviceRepo repository.TrustedDeviceRepository
+		webhookRepo       repository.WebhookRepository
+		apiKeyRepo        repository.APIKeyRepository
+		unitOfWork        repository.UnitOfWork
+		providerStateRepo repository.ProviderStateRepository
+		maintenanceRepo   repository.MaintenanceNoticeRepository
+		activeUserRepo    repository.ActiveUserRepository
+		uniqueIPRepo      repository.UniqueIPRepository
+		sessionRepo       repository.SessionRepository
+		otpDeliveryRepo   repository.OTPDeliveryRepository
+		otpSendQueueRepo  repository.OTPSendQueueRepository
+		loginStatusRepo   repository.LoginStatusRepository
+		lockRepo          repository.LockRepository
+	)
+	if memoryStore {
+		users := repository.NewInMemoryUserRepository()
+		audit := repository.NewInMemoryAuditRepository()
+		events := repository.NewInMemoryEventRepository()
+		logins := repository.NewInMemoryLoginHistoryRepository()
+		userRepo, auditRepo, eventRepo, loginHistoryRepo = users, audit, events, logins
+		unitOfWork = repository.NewInMemoryUnitOfWork(users, audit, events, logins)
+		backupCodeRepo = repository.NewInMemoryBackupCodeRepository()
+		abuseReportRepo = repository.NewInMemoryAbuseReportRepository()
+		suppressionRepo = repository.NewInMemorySuppressionRepository()
+		phoneListRepo = repository.NewInMemoryPhoneListRepository()
+		trustedDeviceRepo = repository.NewInMemoryTrustedDeviceRepository()
+		webhookRepo = repository.NewInMemoryWebhookRepository()
+		apiKeyRepo = repository.NewInMemoryAPIKeyRepository()
+		providerStateRepo = repository.NewInMemoryProviderStateRepository()
+		maintenanceRepo = repository.NewInMemoryMaintenanceNoticeRepository()
+		activeUserRepo = repository.NewInMemoryActiveUserRepository()
+		uniqueIPRepo = repository.NewInMemoryUniqueIPRepository()
+		sessionRepo = repository.NewInMemorySessionRepository()
+		otpDeliveryRepo = repository.NewInMemoryOTPDeliveryRepository()
+		otpSendQueueRepo = repository.NewInMemoryOTPSendQueueRepository()
+		loginStatusRepo = repository.NewInMemoryLoginStatusRepository()
+		lockRepo = repository.NewInMemoryLockRepository()
+	} else {
+		postgresUserRepo = repository.NewPostgresUserRepository(db, queryTimeout)
+		userRepo = postgresUserRepo
+		auditRepo = repository.NewPostgresAuditRepository(db, queryTimeout)
+		backupCodeRepo = repository.NewPostgresBackupCodeRepository(db, queryTimeout)
+		eventRepo = repository.NewPostgresEventRepository(db, queryTimeout)
+		abuseReportRepo = repository.NewPostgresAbuseReportRepository(db, queryTimeout)
+		suppressionRepo = repository.NewPostgresSuppressionRepository(db, queryTimeout)
+		phoneListRepo = repository.NewPostgresPhoneListRepository(db, queryTimeout)
+		loginHistoryRepo = repository.NewPostgresLoginHistoryRepository(db, queryTimeout)
+		trustedDeviceRepo = repository.NewPostgresTrustedDeviceRepository(db, queryTimeout)
+		webhookRepo = repository.NewPostgresWebhookRepository(db, queryTimeout)
+		apiKeyRepo = repository.NewPostgresAPIKeyRepository(db, queryTimeout)
+		if cfg.Concurrency.Postgres.Enabled {
+			// Shed load with adaptive concurrency limits when Postgres slows down
+			postgresLimiter := concurrency.NewAdaptiveLimiter("postgres", cfg.Concurrency.Postgres, registry)
+			userRepo = repository.NewLimitedUserRepository(userRepo, postgresLimiter)
+			auditRepo = repository.NewLimitedAuditRepository(auditRepo, postgresLimiter)
+			backupCodeRepo = repository.NewLimitedBackupCodeRepository(backupCodeRepo, postgresLimiter)
+			eventRepo = repository.NewLimitedEventRepository(eventRepo, postgresLimiter)
+			abuseReportRepo = repository.NewLimitedAbuseReportRepository(abuseReportRepo, postgresLimiter)
+			suppressionRepo = repository.NewLimitedSuppressionRepository(suppressionRepo, postgresLimiter)
+			phoneListRepo = repository.NewLimitedPhoneListRepository(phoneListRepo, postgresLimiter)
+			loginHistoryRepo = repository.NewLimitedLoginHistoryRepository(loginHistoryRepo, postgresLimiter)
+			trustedDeviceRepo = repository.NewLimitedTrustedDeviceRepository(trustedDeviceRepo, postgresLimiter)
+			webhookRepo = repository.NewLimitedWebhookRepository(webhookRepo, postgresLimiter)
+			apiKeyRepo = repository.NewLimitedAPIKeyRepository(apiKeyRepo, postgresLimiter)
+		}
+		unitOfWork = repository.NewPostgresUnitOfWork(db, queryTimeout)
+		providerStateRepo = repository.NewRedisProviderStateRepository(redisClient)
+		maintenanceRepo = repository.NewRedisMaintenanceNoticeRepository(redisClient)
+		activeUserRepo = repository.NewRedisActiveUserRepository(redisClient)
+		uniqueIPRepo = repository.NewRedisUniqueIPRepository(redisClient, cfg.GetUniqueIPRetention())
+		sessionRepo = repository.NewRedisSessionRepository(redisClient)
+		otpDeliveryRepo = repository.NewRedisOTPDeliveryRepository(redisClient)
+		otpSendQueueRepo = repository.NewRedisOTPSendQueueRepository(redisClient)
+		loginStatusRepo = repository.NewRedisLoginStatusRepository(redisClient, bus)
+		lockRepo = repository.NewRedisLockRepository(redisClient)
+	}
+
+	// Postgres doesn't expire rows, so expired OTPs kept there are deleted on a schedule. Nor
+	// does process memory, which only this instance can clean up.
+	var otpRepo repository.OTPRepository
+	var otpCleanupRepo repository.OTPCleanupRepository
+	var memoryOTPRepo *repository.InMemoryOTPRepository
+	switch {
+	case cfg.GetOTPStore() == "memory":
+		memoryOTPRepo = repository.NewInMemoryOTPRepository()
+		otpRepo = memoryOTPRepo
+	case cfg.GetOTPStore() == "postgres":
+		postgresOTPRepo := repository.NewPostgresOTPRepository(db, queryTimeout)
+		otpRepo, otpCleanupRepo = postgresOTPRepo, postgresOTPRepo
+	case dynamoClient != nil:
+		otpRepo = repository.NewDynamoDBOTPRepository(dynamoClient, cfg.DynamoDB.GetTable())
+	case len(regionClients) > 0:
+		regions := []repository.OTPRegion{{Name: cfg.Redis.Region, Repository: repository.NewRedisOTPRepository(redisClient)}}
+		for i, client := range regionClients {
+			regions = append(regions, repository.OTPRegion{Name: cfg.Redis.Regions[i].Name, Repository: repository.NewRedisOTPRepository(client)})
+		}
+		// Tombstones outlive the challenges they delete and any store of them still in flight
+		tombstoneTTL := cfg.GetOTPExpiration() + cfg.GetOTPExpirationJitter() + cfg.GetRequestTimeout()
+		otpRepo = repository.NewReplicatedOTPRepository(regions, tombstoneTTL, logger)
+	case shardRouter != nil:
+		otpRepo = repository.NewShardedOTPRepository(shardRouter, shardClients)
+	default:
+		otpRepo = repository.NewRedisOTPRepository(redisClient)
+	}
+	// Fail fast while the OTP or user store is down rather than waiting for each operation to time out
+	if breakerCfg := cfg.Concurrency.CircuitBreaker; breakerCfg.Enabled {
+		breakers := make(map[string]*concurrency.CircuitBreaker)
+		breaker := func(dependency string) *concurrency.CircuitBreaker {
+			if breakers[dependency] == nil {
+				breakers[dependency] = concurrency.NewCircuitBreaker(dependency, breakerCfg.Failures, breakerCfg.GetOpenTimeout(), registry)
+			}
+			return breakers[dependency]
+		}
+		if !memoryStore {
+			userRepo = repository.NewBreakerUserRepository(userRepo, breaker("postgres"))
+		}
+		switch {
+		case memoryOTPRepo != nil:
+			// Process memory cannot be down
+		case cfg.GetOTPStore() == "postgres":
+			otpRepo = repository.NewBreakerOTPRepository(otpRepo, breaker("postgres"))
+		case dynamoClient != nil:
+			otpRepo = repository.NewBreakerOTPRepository(otpRepo, breaker("dynamodb"))
+		default:
+			otpRepo = repository.NewBreakerOTPRepository(otpRepo, breaker("redis"))
+		}
+	}
+	// Match phone numbers against an in-memory copy of the phone lists, kept up to date through
+	// the bus. On Lambda the bus only receives changes during invocations, so the lists are
+	// queried on each request instead.
+	if !lambdaBuild {
+		phoneListRepo = repository.NewCachedPhoneListRepository(phoneListRepo, bus)
+	}
+	// Record every change to users in the domain event log
+	userRepo = repository.NewEventRecordingUserRepository(userRepo, eventRepo)
+
+	// Create SMS sender
+	providers, err := sms.NewProviders(cfg.SMS.Providers, logger)
+	if err != nil {
+		fatal(logger, "Failed to setup SMS providers", err)
+	}
+	// Keep each provider under its rate cap
+	providers = sms.NewThrottledProviders(providers, cfg.SMS.Providers, registry)
+	// Send from the sender IDs configured per destination, each attempt under the rate cap
+	providers = sms.NewSenderIDProviders(providers, cfg.SMS.Providers, registry, logger)
+	sender := sms.NewSender(providers, providerStateRepo, suppressionRepo, cfg.SMS.Failover, logger)
+	// Report whether an SMS provider is available, without taking the instance out of rotation,
+	// as the providers' state is shared by all instances
+	if cfg.Service.Health.CheckSMSProviders {
+		checker.Add("sms", sender.CheckAvailable, false)
+	}
+	if err := webhook.ValidateEndpoints(cfg.Webhooks.Endpoints); err != nil {
+		fatal(logger, "Invalid webhook configuration", err)
+	}
+
+	// Create CAPTCHA verifier, if CAPTCHA is enabled
+	var captchaVerifier captcha.Verifier
+	if cfg.Captcha.Provider != "" {
+		client, err := captcha.NewClient(cfg.Captcha.Provider, cfg.Captcha.Secret, cfg.Captcha.VerifyURL, cfg.GetCaptchaTimeout())
+		if err != nil {
+			fatal(logger, "Invalid CAPTCHA configuration", err)
+		}
+		captchaVerifier = client
+	}
+
+	// Ask OPA for authorization decisions, if policies are enabled
+	var authorizer *policy.Authorizer
+	if cfg.Policy.OPAURL != "" {
+		client, err := policy.NewOPAClient(cfg.Policy.OPAURL, cfg.Policy.Path, cfg.GetPolicyTimeout())
+		if err != nil {
+			fatal(logger, "Invalid policy configuration", err)
+		}
+		if len(cfg.Policy.Files) > 0 {
+			loadCtx, cancel := context.WithTimeout(context.Background(), cfg.GetPolicyTimeout()*time.Duration(len(cfg.Policy.Files)))
+			err := client.LoadPolicies(loadCtx, cfg.Policy.Files)
+			cancel()
+			if err != nil {
+				fatal(logger, "Failed to load policies", err)
+			}
+		}
+		authorizer = policy.NewAuthorizer(client, cfg.Policy.FailOpen, registry, logger)
+	}
+
+	// Sign access tokens with a KMS key, if configured, instead of the JWT secret
+	kmsSigner := newKMSSigner(logger, cfg)
+	// Fail fast on keys that can't be used; on Lambda they are fetched by the first invocation instead
+	if kmsSigner != nil && !lambdaBuild {
+		kmsCfg := cfg.JWT.KMS
+		loadCtx, cancel := context.WithTimeout(context.Background(), kmsCfg.GetTimeout()*time.Duration(len(kmsCfg.PreviousKeyIDs)+1))
+		err := kmsSigner.Load(loadCtx)
+		cancel()
+		if err != nil {
+			fatal(logger, "Failed to load JWT KMS public keys", err)
+		}
+	}
+	tokenSigner := service.NewTokenSigner(cfg, kmsSigner)
 
 	// Create services
-	authService := service.NewAuthService(userRepo, otpRepo, cfg)
-	userService := service.NewUserService(userRepo)
+	eventService := service.NewEventService(eventRepo)
+	auditService := service.NewAuditService(auditRepo)
+	backupCodeService := service.NewBackupCodeService(backupCodeRepo, userRepo, eventService, cfg)
+	trustedDeviceService := service.NewTrustedDeviceService(trustedDeviceRepo, eventService, cfg)
+	sessionService := service.NewSessionService(sessionRepo, userRepo, eventService, tokenSigner, cfg)
+	phoneListService := service.NewPhoneListService(phoneListRepo, auditService, cfg)
+	deliveryService := service.NewDeliveryService(otpDeliveryRepo, otpSendQueueRepo, otpRepo, sender, registry, reloader, logger)
+	// Deployments embedding the service register their own hooks on this registry
+	hooks := service.NewHooks(logger)
+	if cfg.Hooks.URL != "" {
+		service.NewWebhookHooks(webhook.NewClient(cfg.GetHookTimeout()), cfg.Hooks, logger).Register(hooks)
+	}
+	authService := service.NewAuthService(userRepo, otpRepo, loginHistoryRepo, unitOfWork, backupCodeService, trustedDeviceService, sessionService, phoneListService, eventService, otpRateLimit, deliveryService, email.NewSender(cfg.Email, logger), flashcall.NewCaller(cfg.FlashCall, logger), silentauth.NewVerifier(cfg.SilentAuth), loginStatusRepo, lockRepo, hooks, reloader)
+	activeUserService := service.NewActiveUserService(activeUserRepo, eventService, logger)
+	userService := service.NewUserService(userRepo, loginHistoryRepo, activeUserService, cfg)
+	uniqueIPService := service.NewUniqueIPService(uniqueIPRepo, registry, logger)
+	adminService := service.NewAdminService(userRepo, unitOfWork, otpRepo, otpRateLimit, requestOTPRateLimit, sender, deliveryService, sessionService, auditService, cfg)
+	migrationService := service.NewMigrationService(userRepo, authService, auditService, cfg)
+	importService := service.NewImportService(userRepo, auditService)
+	userExportService := service.NewUserExportService(userRepo, auditService, logger)
+	tokenExchangeService := service.NewTokenExchangeService(userRepo, sessionService, eventService, tokenSigner, registry, cfg)
+	suppressionService := service.NewSuppressionService(suppressionRepo, auditService, eventService, reloader)
+	abuseReportService := service.NewAbuseReportService(abuseReportRepo, suppressionService, auditService, eventService)
+	accountService := service.NewAccountService(userRepo, auditRepo, eventRepo, loginHistoryRepo, sessionService, trustedDeviceService, cfg, logger)
+	timelineService := service.NewTimelineService(userRepo, auditRepo, eventRepo, loginHistoryRepo, sessionRepo, cfg)
+	maintenanceService := service.NewMaintenanceService(maintenanceRepo, auditService, reloader)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, auditService)
+	webhookService := service.NewWebhookService(webhookRepo, eventService, service.NewAnalyticsConsent(userRepo), webhook.NewClient(cfg.GetWebhookTimeout()), cfg, logger)
+
+	// Keep the active user counts up to date with sign-ins recorded in the event log
+	if run[components.Scheduler] {
+		runInBackground(&background, func() { activeUserService.Run(collectorCtx, cfg.GetActiveUsersSyncInterval()) })
+		// Erase deleted users once they can no longer be restored
+		runInBackground(&background, func() { accountService.Run(collectorCtx, cfg.GetPurgeInterval()) })
+		if otpCleanupRepo != nil {
+			otpCleanupService := service.NewOTPCleanupService(otpCleanupRepo, logger)
+			runInBackground(&background, func() { otpCleanupService.Run(collectorCtx, cfg.GetOTPCleanupInterval()) })
+		}
+	}
+	if memoryOTPRepo != nil {
+		otpCleanupService := service.NewOTPCleanupService(memoryOTPRepo, logger)
+		runInBackground(&background, func() { otpCleanupService.Run(collectorCtx, cfg.GetOTPCleanupInterval()) })
+	}
+	// Count the distinct IPs requesting each endpoint
+	if run[components.API] {
+		runInBackground(&background, func() { uniqueIPService.Run(collectorCtx, cfg.GetUniqueIPFlushInterval()) })
+	}
+	if run[components.Worker] {
+		// Send queued OTPs, including those queued while sending SMS was saturated, in the background
+		if cfg.SMS.Queue.Enabled || cfg.SMS.Overflow.AnyEnabled() {
+			runInBackground(&background, func() { deliveryService.Run(collectorCtx) })
+		}
+		// Notify the configured webhook endpoints of domain events
+		if len(cfg.Webhooks.Endpoints) > 0 {
+			runInBackground(&background, func() { webhookService.Run(collectorCtx, cfg.GetWebhookPollInterval()) })
+		}
+	}
 
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	userHandler := handlers.NewUserHandler(userService)
+	userHandler := handlers.NewUserHandler(userService, auditService)
+	adminHandler := handlers.NewAdminHandler(adminService)
+	migrationHandler := handlers.NewMigrationHandler(migrationService)
+	importHandler := handlers.NewImportHandler(importService)
+	userExportHandler := handlers.NewUserExportHandler(userExportService, cfg.GetExportTimeout())
+	tokenExchangeHandler := handlers.NewTokenExchangeHandler(tokenExchangeService)
+	backupCodeHandler := handlers.NewBackupCodeHandler(backupCodeService)
+	trustedDeviceHandler := handlers.NewTrustedDeviceHandler(trustedDeviceService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	uniqueIPHandler := handlers.NewUniqueIPHandler(uniqueIPService)
+	timelineHandler := handlers.NewTimelineHandler(timelineService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+	abuseReportHandler := handlers.NewAbuseReportHandler(abuseReportService)
+	suppressionHandler := handlers.NewSuppressionHandler(suppressionService)
+	phoneListHandler := handlers.NewPhoneListHandler(phoneListService)
+	deliveryHandler := handlers.NewDeliveryHandler(deliveryService)
+	jwksHandler := handlers.NewJWKSHandler(tokenSigner)
+	maintenanceHandler := handlers.NewMaintenanceHandler(maintenanceService)
+	metaHandler := handlers.NewMetaHandler(maintenanceService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
 
 	// Create middleware
-	jwtMiddleware := middleware.NewJWTAuthMiddleware(cfg)
-	rateLimitMiddleware := middleware.NewRateLimitMiddleware(redisClient)
+	jwtMiddleware := middleware.NewJWTAuthMiddleware(cfg, tokenSigner, sessionService)
+	apiKeyMiddleware := middleware.NewAPIKeyMiddleware(apiKeyService)
+	rateLimitMiddleware := middleware.NewRateLimitMiddleware(eventService, reloader, logger)
+	captchaMiddleware := middleware.NewCaptchaMiddleware(captchaVerifier, captchaThreshold)
+	policyMiddleware := middleware.NewPolicyMiddleware(authorizer)
+	deadlineMiddleware := middleware.NewDeadlineMiddleware(cfg.GetRequestTimeout())
+	requestIDMiddleware := middleware.NewRequestIDMiddleware()
+	errorFormatMiddleware := middleware.NewErrorFormatMiddleware(cfg.Service.HTTP.LegacyErrors)
+	requestLoggerMiddleware := middleware.NewRequestLoggerMiddleware(logger)
+	uniqueIPMiddleware := middleware.NewUniqueIPMiddleware(uniqueIPService)
+	inFlightMiddleware := middleware.NewInFlightMiddleware(loadMonitor)
+	bodyLimitMiddleware := middleware.NewBodyLimitMiddleware(cfg.GetMaxBodyBytes())
+	canaryMiddleware := middleware.NewCanaryMiddleware(canary.NewRouter(reloader), registry)
+	maintenanceMiddleware := middleware.NewMaintenanceMiddleware(maintenanceService, reloader)
+	deprecationMiddleware := middleware.NewDeprecationMiddleware(registry, reloader)
 
-	// Setup Gin router
-	router := gin.Default()
+	// Register the validators of binding tags, e.g. iranianMobile, before any request is bound
+	if err := validation.Register(reloader); err != nil {
+		fatal(logger, "Failed to register validators", err)
+	}
+
+	// Setup Gin router; gin's own request logger is left out as it logs raw paths
+	router := gin.New()
+	if err := middleware.ConfigureClientIP(router, cfg.Service.HTTP.TrustedProxies, cfg.GetRealIPHeader()); err != nil {
+		fatal(logger, "Failed to configure trusted proxies", err)
+	}
 	// Add middleware
 	router.Use(gin.Recovery())
-	router.Use(gin.Logger())
+	router.Use(inFlightMiddleware.TrackInFlight())
+	router.Use(requestIDMiddleware.RequestID())
+	if cfg.Service.HTTP.CountryHeader != "" {
+		countryMiddleware, err := middleware.NewCountryMiddleware(cfg.Service.HTTP.TrustedProxies, cfg.Service.HTTP.CountryHeader)
+		if err != nil {
+			fatal(logger, "Failed to configure the country header", err)
+		}
+		router.Use(countryMiddleware.Country())
+	}
+	if cfg.Service.HTTP.TenantHeader != "" {
+		tenantMiddleware, err := middleware.NewTenantMiddleware(cfg.Service.HTTP.TrustedProxies, cfg.Service.HTTP.TenantHeader)
+		if err != nil {
+			fatal(logger, "Failed to configure the tenant header", err)
+		}
+		router.Use(tenantMiddleware.Tenant())
+	}
+	if cfg.SilentAuth.Provider == silentauth.ProviderHeader {
+		msisdnMiddleware, err := middleware.NewMSISDNMiddleware(cfg.SilentAuth.TrustedProxies, cfg.SilentAuth.Header)
+		if err != nil {
+			fatal(logger, "Failed to configure the MSISDN header", err)
+		}
+		router.Use(msisdnMiddleware.MSISDN())
+	}
+	router.Use(canaryMiddleware.Route())
+	router.Use(errorFormatMiddleware.ErrorFormat())
+	router.Use(requestLoggerMiddleware.RequestLogger())
+	router.Use(uniqueIPMiddleware.TrackUniqueIPs())
+	router.Use(deadlineMiddleware.Deadline())
+	router.Use(bodyLimitMiddleware.LimitBody())
+	router.Use(maintenanceMiddleware.Announce())
+	router.Use(deprecationMiddleware.Deprecations())
+	router.Use(rateLimitMiddleware.ConfiguredRateLimit(policyLimiters))
+	router.NoRoute(func(c *gin.Context) {
+		apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "Route not found")
+	})
+
+	// API routes; instances not running the API only serve the health and metrics routes below
+	if run[components.API] {
+		v1 := router.Group("/v1")
 
-	// Routes
-	v1 := router.Group("/v1")
-	{
 		// Auth routes
 		auth := v1.Group("/auth")
 		{
 			auth.POST("/request-otp",
-				rateLimitMiddleware.OTPRateLimit(cfg.OTP.RateLimit.Count, cfg.GetRateLimitDuration()),
+				captchaMiddleware.RequireCaptcha(),
+				rateLimitMiddleware.OTPRateLimit(requestOTPRateLimit),
+				policyMiddleware.AuthorizeAuthFlow(policy.ActionRequestOTP),
 				authHandler.RequestOTP)
-			auth.POST("/verify-otp", authHandler.VerifyOTP)
+			auth.POST("/resend-otp",
+				policyMiddleware.AuthorizeAuthFlow(policy.ActionResendOTP),
+				authHandler.ResendOTP)
+			auth.GET("/otp-status/:challenge_id", authHandler.OTPStatus)
+			auth.GET("/login-status/:challenge_id", authHandler.LoginStatus)
+			auth.GET("/status/:challenge_id", authHandler.PollLoginStatus)
+			auth.POST("/verify-otp",
+				policyMiddleware.AuthorizeAuthFlow(policy.ActionVerifyOTP),
+				authHandler.VerifyOTP)
+			auth.POST("/refresh", sessionHandler.RefreshToken)
+			auth.POST("/token-exchange", tokenExchangeHandler.Exchange)
 		}
 
+		// Abuse reports from owners and carriers of phone numbers receiving unsolicited OTPs
+		v1.POST("/abuse-reports",
+			rateLimitMiddleware.RateLimit(abuseReportRateLimit),
+			abuseReportHandler.Report)
+
+		// Delivery status callbacks from SMS providers, authenticated by the provider's callback token
+		v1.POST("/sms/callbacks/:provider", suppressionHandler.ProviderCallback)
+		// Delivery receipts from SMS providers, authenticated the same way
+		v1.POST("/providers/:name/dlr", deliveryHandler.DeliveryReceipt)
+
+		// Error codes returned in error responses, the server time for clients' countdowns, and
+		// planned downtime for clients' banners
+		v1.GET("/meta/errors", metaHandler.ErrorCatalog)
+		v1.GET("/meta/time", metaHandler.ServerTime)
+		v1.GET("/meta/status", metaHandler.Status)
+
 		// User routes (protected)
 		users := v1.Group("/users")
-		users.Use(jwtMiddleware.AuthRequired())
+		userRateLimit := rateLimitMiddleware.ConfiguredUserRateLimit(policyLimiters)
 		{
-			users.GET("/:id", userHandler.GetUser)
-			users.GET("", userHandler.ListUsers)
+			// The authenticated user's own account
+			me := users.Group("/me")
+			me.Use(jwtMiddleware.AuthRequired(), userRateLimit)
+			me.POST("/backup-codes", backupCodeHandler.GenerateBackupCodes)
+			me.GET("/logins", userHandler.ListMyLogins)
+			me.PUT("", userHandler.UpdateMe)
+			me.DELETE("", accountHandler.DeleteMe)
+			me.GET("/export", accountHandler.ExportMe)
+			me.PUT("/analytics-consent", userHandler.SetMyAnalyticsConsent)
+			me.GET("/devices", trustedDeviceHandler.ListDevices)
+			me.DELETE("/devices/:id", trustedDeviceHandler.RevokeDevice)
+			me.GET("/sessions", sessionHandler.ListSessions)
+			me.DELETE("/sessions", sessionHandler.RevokeSessions)
+
+			// Also open to services with an API key granted the route's scope
+			users.GET("/:id",
+				apiKeyMiddleware.AuthRequired(models.APIKeyScopeUsersRead, jwtMiddleware.AuthRequired()),
+				userRateLimit,
+				userHandler.GetUser)
+			users.PATCH("/:id/metadata",
+				apiKeyMiddleware.AuthRequired(models.APIKeyScopeUsersMetadata, jwtMiddleware.AuthRequired()),
+				userRateLimit,
+				apiKeyMiddleware.UnlessAPIKey(policyMiddleware.Authorize(policy.ActionAdmin)),
+				apiKeyMiddleware.UnlessAPIKey(jwtMiddleware.PermissionRequired(models.PermissionUserMetadata)),
+				adminHandler.UpdateUserMetadata)
+			users.GET("",
+				apiKeyMiddleware.AuthRequired(models.APIKeyScopeUsersRead, jwtMiddleware.AuthRequired()),
+				userRateLimit,
+				userHandler.ListUsers)
+		}
+
+		// Admin routes (protected, each gated by a permission and the policies)
+		admin := v1.Group("/admin")
+		admin.Use(jwtMiddleware.AuthRequired(), rateLimitMiddleware.ConfiguredUserRateLimit(policyLimiters), policyMiddleware.Authorize(policy.ActionAdmin))
+		{
+			admin.POST("/users/:id/restore",
+				jwtMiddleware.PermissionRequired(models.PermissionUserRestore),
+				adminHandler.RestoreUser)
+			admin.GET("/users/stats",
+				jwtMiddleware.PermissionRequired(models.PermissionUserStats),
+				userHandler.GetUserStats)
+			admin.DELETE("/users/:id/sessions",
+				jwtMiddleware.PermissionRequired(models.PermissionSessionRevoke),
+				adminHandler.RevokeSessions)
+			admin.GET("/users/:id/timeline",
+				jwtMiddleware.PermissionRequired(models.PermissionUserTimeline),
+				timelineHandler.GetUserTimeline)
+			admin.GET("/stats/unique-ips",
+				jwtMiddleware.PermissionRequired(models.PermissionTrafficStats),
+				uniqueIPHandler.GetUniqueIPs)
+			admin.POST("/users/import",
+				jwtMiddleware.PermissionRequired(models.PermissionUserImport),
+				importHandler.ImportUsers)
+			admin.GET("/users/export",
+				jwtMiddleware.PermissionRequired(models.PermissionUserExport),
+				userExportHandler.ExportUsers)
+
+			// Runbook actions
+			admin.DELETE("/rate-limits/:phone",
+				jwtMiddleware.PermissionRequired(models.PermissionRateLimitFlush),
+				adminHandler.FlushRateLimits)
+			admin.POST("/otps/:phone/resend",
+				jwtMiddleware.PermissionRequired(models.PermissionOTPResend),
+				adminHandler.ResendOTP)
+			admin.POST("/otps/expire",
+				jwtMiddleware.PermissionRequired(models.PermissionOTPExpire),
+				adminHandler.ExpireOTPs)
+			admin.GET("/providers",
+				jwtMiddleware.PermissionRequired(models.PermissionProviderToggle),
+				adminHandler.ListProviders)
+			admin.PUT("/providers/:name",
+				jwtMiddleware.PermissionRequired(models.PermissionProviderToggle),
+				adminHandler.SetProviderState)
+
+			// Abuse report review queue
+			admin.GET("/abuse-reports",
+				jwtMiddleware.PermissionRequired(models.PermissionAbuseReview),
+				abuseReportHandler.ListReports)
+			admin.PUT("/abuse-reports/:id",
+				jwtMiddleware.PermissionRequired(models.PermissionAbuseReview),
+				abuseReportHandler.ReviewReport)
+
+			// Suppression list
+			admin.POST("/suppressions/import",
+				jwtMiddleware.PermissionRequired(models.PermissionSuppression),
+				suppressionHandler.ImportSuppressions)
+			admin.GET("/suppressions/export",
+				jwtMiddleware.PermissionRequired(models.PermissionSuppression),
+				suppressionHandler.ExportSuppressions)
+			admin.DELETE("/suppressions/:phone",
+				jwtMiddleware.PermissionRequired(models.PermissionSuppression),
+				suppressionHandler.RemoveSuppression)
+
+			// Phone number blocklist and allowlist
+			admin.GET("/blocklist",
+				jwtMiddleware.PermissionRequired(models.PermissionPhoneList),
+				phoneListHandler.ListEntries)
+			admin.POST("/blocklist",
+				jwtMiddleware.PermissionRequired(models.PermissionPhoneList),
+				phoneListHandler.AddEntry)
+			admin.DELETE("/blocklist",
+				jwtMiddleware.PermissionRequired(models.PermissionPhoneList),
+				phoneListHandler.RemoveEntry)
+
+			// Announcements of planned downtime
+			admin.GET("/maintenance-notices",
+				jwtMiddleware.PermissionRequired(models.PermissionMaintenance),
+				maintenanceHandler.ListNotices)
+			admin.POST("/maintenance-notices",
+				jwtMiddleware.PermissionRequired(models.PermissionMaintenance),
+				maintenanceHandler.CreateNotice)
+			admin.DELETE("/maintenance-notices/:id",
+				jwtMiddleware.PermissionRequired(models.PermissionMaintenance),
+				maintenanceHandler.DeleteNotice)
+
+			// API keys of services calling the /v1/users routes
+			admin.GET("/api-keys",
+				jwtMiddleware.PermissionRequired(models.PermissionAPIKey),
+				apiKeyHandler.ListKeys)
+			admin.POST("/api-keys",
+				jwtMiddleware.PermissionRequired(models.PermissionAPIKey),
+				apiKeyHandler.CreateKey)
+			admin.DELETE("/api-keys/:id",
+				jwtMiddleware.PermissionRequired(models.PermissionAPIKey),
+				apiKeyHandler.RevokeKey)
+
+			// One-time migration of legacy users
+			admin.POST("/migrations/legacy-users",
+				jwtMiddleware.PermissionRequired(models.PermissionUserMigrate),
+				migrationHandler.MigrateLegacyUsers)
+		}
+
+		// Load HTML template
+		tmpl, err := template.ParseFiles(filepath.Join("internal", "templates", "index.html"))
+		if err != nil {
+			fatal(logger, "Failed to parse template", err)
 		}
+
+		// Root route - HTML welcome page with link to Swagger UI
+		rootHandler := func(c *gin.Context) {
+			baseURL := fmt.Sprintf("http://%s:%s", c.Request.Host, cfg.Service.HTTP.Port)
+			if err := tmpl.Execute(c.Writer, gin.H{"BaseURL": baseURL}); err != nil {
+				apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Failed to render template")
+				return
+			}
+		}
+		router.GET("/", rootHandler)
+		router.HEAD("/", rootHandler)
+
+		// API info route
+		router.GET("/api", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"name":        "OTP Authentication API",
+				"version":     "1.0.0",
+				"description": "A RESTful API for OTP-based authentication",
+				"endpoints": []gin.H{
+					{"path": "/v1/auth/request-otp", "method": "POST", "description": "Request OTP for a phone number"},
+					{"path": "/v1/auth/resend-otp", "method": "POST", "description": "Resend the pending OTP for a phone number"},
+					{"path": "/v1/auth/otp-status/:challenge_id", "method": "GET", "description": "Get the delivery status of a challenge's OTP"},
+					{"path": "/v1/auth/login-status/:challenge_id", "method": "GET", "description": "Stream the login status of a challenge (Server-Sent Events)"},
+					{"path": "/v1/auth/status/:challenge_id", "method": "GET", "description": "Long-poll the login status of a challenge"},
+					{"path": "/v1/auth/verify-otp", "method": "POST", "description": "Verify OTP for a phone number"},
+					{"path": "/v1/auth/refresh", "method": "POST", "description": "Exchange a refresh token for new tokens"},
+					{"path": "/v1/auth/token-exchange", "method": "POST", "description": "Exchange a user token for a downstream service token (API key)"},
+					{"path": "/.well-known/jwks.json", "method": "GET", "description": "Public keys access tokens are signed with"},
+					{"path": "/v1/abuse-reports", "method": "POST", "description": "Report unsolicited OTP SMS to a phone number"},
+					{"path": "/v1/sms/callbacks/:provider", "method": "POST", "description": "SMS provider STOP and undeliverable callbacks (callback token)"},
+					{"path": "/v1/providers/:name/dlr", "method": "POST", "description": "SMS provider delivery receipts (callback token)"},
+					{"path": "/v1/meta/errors", "method": "GET", "description": "List the error codes returned in error responses"},
+					{"path": "/v1/meta/time", "method": "GET", "description": "Get the server time"},
+					{"path": "/v1/meta/status", "method": "GET", "description": "Get the service status and announced maintenance windows"},
+					{"path": "/v1/users/:id", "method": "GET", "description": "Get user by ID"},
+					{"path": "/v1/users", "method": "GET", "description": "List users with pagination, search and metadata filters"},
+					{"path": "/v1/users/:id/metadata", "method": "PATCH", "description": "Set or remove metadata keys of a user (admin)"},
+					{"path": "/v1/users/me/backup-codes", "method": "POST", "description": "Generate one-time backup codes for the authenticated user"},
+					{"path": "/v1/users/me/logins", "method": "GET", "description": "List the authenticated user's recent logins"},
+					{"path": "/v1/users/me/devices", "method": "GET", "description": "List the authenticated user's trusted devices"},
+					{"path": "/v1/users/me/devices/:id", "method": "DELETE", "description": "Revoke one of the authenticated user's trusted devices"},
+					{"path": "/v1/users/me/sessions", "method": "GET", "description": "List the authenticated user's active sessions"},
+					{"path": "/v1/users/me/sessions", "method": "DELETE", "description": "Revoke all of the authenticated user's sessions"},
+					{"path": "/v1/admin/users/:id/restore", "method": "POST", "description": "Restore a soft-deleted user (admin)"},
+					{"path": "/v1/admin/users/:id/sessions", "method": "DELETE", "description": "Revoke all of a user's sessions (admin)"},
+					{"path": "/v1/admin/users/stats", "method": "GET", "description": "Count users by phone verification status (admin)"},
+					{"path": "/v1/admin/stats/unique-ips", "method": "GET", "description": "Count distinct client IPs per endpoint for a day (admin)"},
+					{"path": "/v1/admin/users/import", "method": "POST", "description": "Import users, optionally with pre-verified phone numbers (admin)"},
+					{"path": "/v1/admin/users/export", "method": "GET", "description": "Export users as CSV or JSONL, streamed (admin)"},
+					{"path": "/v1/admin/rate-limits/:phone", "method": "DELETE", "description": "Flush rate limits for a phone number (admin)"},
+					{"path": "/v1/admin/otps/:phone/resend", "method": "POST", "description": "Resend the pending OTP (admin)"},
+					{"path": "/v1/admin/otps/expire", "method": "POST", "description": "Force-expire pending OTPs by phone prefix (admin)"},
+					{"path": "/v1/admin/providers", "method": "GET", "description": "List SMS providers (admin)"},
+					{"path": "/v1/admin/providers/:name", "method": "PUT", "description": "Take an SMS provider out of or back into rotation (admin)"},
+					{"path": "/v1/admin/abuse-reports", "method": "GET", "description": "List abuse reports awaiting review (admin)"},
+					{"path": "/v1/admin/abuse-reports/:id", "method": "PUT", "description": "Confirm or dismiss an abuse report (admin)"},
+					{"path": "/v1/admin/suppressions/import", "method": "POST", "description": "Import suppression list entries (admin)"},
+					{"path": "/v1/admin/suppressions/export", "method": "GET", "description": "Export the suppression list (admin)"},
+					{"path": "/v1/admin/suppressions/:phone", "method": "DELETE", "description": "Remove a phone number from the suppression list (admin)"},
+					{"path": "/v1/admin/blocklist", "method": "GET", "description": "List blocked and allowed phone numbers and prefixes (admin)"},
+					{"path": "/v1/admin/blocklist", "method": "POST", "description": "Block or allow a phone number or prefix (admin)"},
+					{"path": "/v1/admin/blocklist", "method": "DELETE", "description": "Unblock or disallow a phone number or prefix (admin)"},
+					{"path": "/v1/admin/maintenance-notices", "method": "GET", "description": "List maintenance notices (admin)"},
+					{"path": "/v1/admin/maintenance-notices", "method": "POST", "description": "Announce a maintenance window (admin)"},
+					{"path": "/v1/admin/maintenance-notices/:id", "method": "DELETE", "description": "Withdraw a maintenance notice (admin)"},
+					{"path": "/v1/admin/api-keys", "method": "GET", "description": "List API keys (admin)"},
+					{"path": "/v1/admin/api-keys", "method": "POST", "description": "Create an API key for service-to-service calls (admin)"},
+					{"path": "/v1/admin/api-keys/:id", "method": "DELETE", "description": "Revoke an API key (admin)"},
+					{"path": "/v1/admin/migrations/legacy-users", "method": "POST", "description": "Exchange a signed batch of legacy users for tokens (admin)"},
+				},
+				"docs_url": "/swagger/index.html",
+			})
+		})
+
+		// Public keys of the access token signing keys, for services verifying access tokens
+		router.GET("/.well-known/jwks.json", jwksHandler.GetJWKS)
+
+		// Swagger documentation
+		router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	}
 
-	// Load HTML template
-	tmpl, err := template.ParseFiles(filepath.Join("internal", "templates", "index.html"))
-	if err != nil {
-		log.Fatalf("Failed to parse template: %v", err)
+	// Health check routes; /health predates /health/live and is kept for existing probes
+	liveHandler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	}
+	router.GET("/health", liveHandler)
+	router.GET("/health/live", liveHandler)
+
+	// Load route for load balancers that weight instances by load
+	router.GET("/health/weight", func(c *gin.Context) {
+		c.JSON(http.StatusOK, loadMonitor.Load())
+	})
 
-	// Root route - HTML welcome page with link to Swagger UI
-	rootHandler := func(c *gin.Context) {
-		baseURL := fmt.Sprintf("http://%s:%s", c.Request.Host, cfg.Service.HTTP.Port)
-		if err := tmpl.Execute(c.Writer, gin.H{"BaseURL": baseURL}); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template"})
+	// Readiness route; reports unavailable until startup warm-up has finished
+	var ready atomic.Bool
+	router.GET("/ready", func(c *gin.Context) {
+		if !ready.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "warming up"})
 			return
 		}
-	}
-	router.GET("/", rootHandler)
-	router.HEAD("/", rootHandler)
-
-	// API info route
-	router.GET("/api", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"name":        "OTP Authentication API",
-			"version":     "1.0.0",
-			"description": "A RESTful API for OTP-based authentication",
-			"endpoints": []gin.H{
-				{"path": "/v1/auth/request-otp", "method": "POST", "description": "Request OTP for a phone number"},
-				{"path": "/v1/auth/verify-otp", "method": "POST", "description": "Verify OTP for a phone number"},
-				{"path": "/v1/users/:id", "method": "GET", "description": "Get user by ID"},
-				{"path": "/v1/users", "method": "GET", "description": "List users with pagination and search"},
-			},
-			"docs_url": "/swagger/index.html",
-		})
+		c.JSON(http.StatusOK, gin.H{"status": "ready"})
 	})
 
-	// Health check route
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	// Readiness route checking the dependencies; reports unavailable until startup warm-up has
+	// finished and while a critical dependency is down
+	router.GET("/health/ready", func(c *gin.Context) {
+		dependenciesUp, dependencies := checker.Check(c.Request.Context())
+		switch {
+		case !ready.Load():
+			c.JSON(http.StatusServiceUnavailable, models.ReadinessResponse{Status: "warming up", Dependencies: dependencies})
+		case !dependenciesUp:
+			c.JSON(http.StatusServiceUnavailable, models.ReadinessResponse{Status: "unavailable", Dependencies: dependencies})
+		default:
+			c.JSON(http.StatusOK, models.ReadinessResponse{Status: "ready", Dependencies: dependencies})
+		}
 	})
 
-	// Swagger documentation
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Metrics route (Prometheus text format)
+	router.GET("/metrics", gin.WrapH(registry.Handler()))
+
+	// Deprecating a route that is not registered is most likely a typo, which would leave its
+	// callers unwarned
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for _, deprecation := range cfg.Service.HTTP.Deprecations {
+		if !registered[deprecation.Route] {
+			logger.Warn("Deprecated route is not registered", "route", deprecation.Route)
+		}
+	}
+
+	// On Lambda, API Gateway invokes the function with each request instead. Background
+	// loops keep running, but only make progress while the function is serving an invocation.
+	if lambdaBuild {
+		ready.Store(true)
+		logger.Info("Serving AWS Lambda invocations")
+		if err := serveLambda(router); err != nil {
+			fatal(logger, "Failed to serve Lambda invocations", err)
+		}
+		return
+	}
 
 	// Start server
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", cfg.Service.HTTP.Port),
-		Handler: router,
+		Addr:              fmt.Sprintf(":%s", cfg.Service.HTTP.Port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.GetReadHeaderTimeout(),
+		ReadTimeout:       cfg.GetReadTimeout(),
+		WriteTimeout:      cfg.GetWriteTimeout(),
+		IdleTimeout:       cfg.GetIdleTimeout(),
 	}
+	challengeSrv := setUpTLS(srv, cfg)
 
 	// Run server in a goroutine so it doesn't block
 	go func() {
-		log.Printf("Server starting on port %s", cfg.Service.HTTP.Port)
-		if err = srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Failed to start server: %v", err)
+		logger.Info("Server starting", "port", cfg.Service.HTTP.Port, "tls", srv.TLSConfig != nil)
+		if err := listenAndServe(srv, cfg); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal(logger, "Failed to start server", err)
 		}
 	}()
+	if challengeSrv != nil {
+		go func() {
+			logger.Info("ACME challenge server starting", "port", cfg.Service.HTTP.TLS.Autocert.HTTPPort)
+			if err := challengeSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal(logger, "Failed to start ACME challenge server", err)
+			}
+		}()
+	}
+
+	// Warm up connections, statements and scripts, then start reporting ready. Until warm-up
+	// succeeds the instance stays not ready, retrying after each timeout.
+	runInBackground(&background, func() {
+		// Process memory needs no warm-up
+		if cfg.Service.Warmup.Enabled && !memoryStore {
+			for {
+				err := warmUp(logger, cfg, db, postgresUserRepo, redisClient, shardClients)
+				if err == nil {
+					break
+				}
+				logger.Error("Warm-up failed; not reporting ready until it succeeds", "error", err)
+				select {
+				case <-collectorCtx.Done():
+					return
+				case <-time.After(cfg.GetWarmupTimeout()):
+				}
+			}
+		}
+		ready.Store(true)
+	})
+
+	// Reload the configuration when the config file changes, if enabled
+	if interval := cfg.GetConfigWatchInterval(); interval > 0 {
+		runInBackground(&background, func() { reloader.Watch(collectorCtx, interval) })
+	}
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal, reloading the configuration on SIGHUP
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down server...")
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := <-quit; sig == syscall.SIGHUP; sig = <-quit {
+		if err := reloader.Reload(); err != nil {
+			logger.Error("Failed to reload configuration", "error", err)
+		} else {
+			logger.Info("Configuration reloaded")
+		}
+	}
+	logger.Info("Shutting down server...")
 
 	// Create a deadline for shutdown using config
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.GetGracefulShutdownDuration())
 	defer cancel()
 
 	// Shutdown server
+	if challengeSrv != nil {
+		challengeSrv.Shutdown(ctx)
+	}
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal(logger, "Server forced to shutdown", err)
+	}
+
+	// Stop background loops from taking on new work and drain the work in flight, such as
+	// queued OTPs and webhooks being sent and unique IPs not yet written, before closing their
+	// connections. Draining gets the same deadline as the server.
+	stopCollector()
+	drained := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		logger.Warn("Background workers did not finish before the shutdown deadline")
 	}
 
 	// Close database and Redis connections
-	log.Println("Closing database connection...")
-	if err := db.Close(); err != nil {
-		log.Printf("Error closing database connection: %v", err)
+	if !memoryStore {
+		logger.Info("Closing database connection...")
+		if err := db.Close(); err != nil {
+			logger.Error("Error closing database connection", "error", err)
+		}
+
+		logger.Info("Closing Redis connection...")
+		if err := redisClient.Close(); err != nil {
+			logger.Error("Error closing Redis connection", "error", err)
+		}
+	}
+	if shardRouter != nil {
+		for i, client := range shardClients {
+			if err := client.Close(); err != nil {
+				logger.Error("Error closing Redis shard connection", "shard", shardRouter.Name(i), "error", err)
+			}
+		}
+	}
+	for i, client := range regionClients {
+		if err := client.Close(); err != nil {
+			logger.Error("Error closing Redis region connection", "region", cfg.Redis.Regions[i].Name, "error", err)
+		}
+	}
+
+	logger.Info("Server exited properly")
+}
+
+// setUp loads and validates the configuration and sets up structured logging; output of the
+// standard log package goes through it too, so phone numbers and OTP codes are masked everywhere
+func setUp() (*config.Config, *slog.Logger, *slog.LevelVar) {
+	cfg := config.LoadConfig()
+
+	logger, logLevel := logging.NewWithLevel(cfg.Logging, os.Stdout)
+	slog.SetDefault(logger)
+
+	if err := cfg.Validate(); err != nil {
+		fatal(logger, "Invalid configuration", err)
+	}
+	return cfg, logger, logLevel
+}
+
+// newKMSSigner creates the signer of access tokens with the configured KMS key, or returns nil
+// if they are signed with the JWT secret
+func newKMSSigner(logger *slog.Logger, cfg *config.Config) *kms.Signer {
+	if cfg.JWT.KMS.Provider == "" {
+		return nil
+	}
+	kmsCfg := cfg.JWT.KMS
+	key, err := kms.NewKey(context.Background(), kmsCfg.Provider, kmsCfg.KeyID, kmsCfg.Region, kmsCfg.Endpoint, kmsCfg.GetTimeout())
+	if err != nil {
+		fatal(logger, "Invalid JWT KMS configuration", err)
 	}
+	var previous []kms.Key
+	for _, keyID := range kmsCfg.PreviousKeyIDs {
+		previousKey, err := kms.NewKey(context.Background(), kmsCfg.Provider, keyID, kmsCfg.Region, kmsCfg.Endpoint, kmsCfg.GetTimeout())
+		if err != nil {
+			fatal(logger, "Invalid JWT KMS configuration", err)
+		}
+		previous = append(previous, previousKey)
+	}
+	return kms.NewSigner(key, previous...)
+}
+
+// fatal logs err and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// newRateLimitPolicy creates a rate limit policy from configuration, backed by process memory if
+// rateLimits.store or service.store is memory, by DynamoDB if dynamoClient is set and otherwise by Redis,
+// spreading its keys across the shard clients if router is set.
+// With canary.rateLimit.algorithm set, requests routed to the canary variant are checked with that algorithm.
+// While the limiter fails, hits are handled as rateLimits.failurePolicy says.
+func newRateLimitPolicy(logger *slog.Logger, cfg *config.Config, registry *metrics.Registry, dynamoClient *dynamodb.Client, router *sharding.Router, clients []*redis.Client, rl config.RateLimitConfig) *ratelimit.Policy {
+	return ratelimit.NewPolicy(newPolicyLimiter(logger, cfg, registry, dynamoClient, router, clients, rl.Algorithm), rl.Count, rl.GetWindow())
+}
 
-	log.Println("Closing Redis connection...")
-	if err := redisClient.Close(); err != nil {
-		log.Printf("Error closing Redis connection: %v", err)
+// newPolicyLimiters creates a limiter for each algorithm, as newRateLimitPolicy does, for the
+// limits of rateLimits.policies, which can switch algorithms when the configuration is reloaded
+func newPolicyLimiters(logger *slog.Logger, cfg *config.Config, registry *metrics.Registry, dynamoClient *dynamodb.Client, router *sharding.Router, clients []*redis.Client) map[string]ratelimit.Limiter {
+	limiters := make(map[string]ratelimit.Limiter)
+	for _, algorithm := range []string{ratelimit.AlgorithmFixedWindow, ratelimit.AlgorithmSlidingWindow, ratelimit.AlgorithmTokenBucket} {
+		limiters[algorithm] = newPolicyLimiter(logger, cfg, registry, dynamoClient, router, clients, algorithm)
 	}
+	return limiters
+}
 
-	log.Println("Server exited properly")
+// newPolicyLimiter creates the limiter of a rate limit policy running algorithm, as described for newRateLimitPolicy
+func newPolicyLimiter(logger *slog.Logger, cfg *config.Config, registry *metrics.Registry, dynamoClient *dynamodb.Client, router *sharding.Router, clients []*redis.Client, algorithm string) ratelimit.Limiter {
+	limiter := newRateLimiter(logger, cfg, dynamoClient, router, clients, algorithm)
+	if canaryAlgorithm := cfg.Canary.RateLimit.Algorithm; canaryAlgorithm != "" {
+		limiter = ratelimit.NewCanaryLimiter(limiter, newRateLimiter(logger, cfg, dynamoClient, router, clients, canaryAlgorithm), registry)
+	}
+	if cfg.GetRateLimitStore() != "memory" {
+		switch cfg.RateLimits.FailurePolicy {
+		case ratelimit.FailOpen:
+			limiter = ratelimit.NewFallbackLimiter(limiter, nil, registry, logger)
+		case ratelimit.FailLocal:
+			local, err := ratelimit.NewMemoryLimiter(algorithm)
+			if err != nil {
+				fatal(logger, "Failed to setup rate limiter", err)
+			}
+			limiter = ratelimit.NewFallbackLimiter(limiter, local, registry, logger)
+		}
+	}
+	return limiter
+}
+
+// newRateLimiter creates a limiter running algorithm, backed as described for newRateLimitPolicy
+func newRateLimiter(logger *slog.Logger, cfg *config.Config, dynamoClient *dynamodb.Client, router *sharding.Router, clients []*redis.Client, algorithm string) ratelimit.Limiter {
+	if cfg.GetRateLimitStore() == "memory" {
+		limiter, err := ratelimit.NewMemoryLimiter(algorithm)
+		if err != nil {
+			fatal(logger, "Failed to setup rate limiter", err)
+		}
+		return limiter
+	}
+	if dynamoClient != nil {
+		limiter, err := ratelimit.NewDynamoDBLimiter(dynamoClient, cfg.DynamoDB.GetTable(), algorithm)
+		if err != nil {
+			fatal(logger, "Failed to setup rate limiter", err)
+		}
+		return limiter
+	}
+
+	limiters := make([]ratelimit.Limiter, len(clients))
+	for i, client := range clients {
+		limiter, err := ratelimit.NewRedisLimiter(client, algorithm)
+		if err != nil {
+			fatal(logger, "Failed to setup rate limiter", err)
+		}
+		limiters[i] = limiter
+	}
+	if router == nil {
+		return limiters[0]
+	}
+	return ratelimit.NewShardedLimiter(router, limiters)
+}
+
+// updateRateLimitPolicy applies the limit and window of reloaded configuration to a policy
+func updateRateLimitPolicy(policy *ratelimit.Policy, rl config.RateLimitConfig) {
+	policy.Update(rl.Count, rl.GetWindow())
+}
+
+// runInBackground runs run in a goroutine tracked by wg
+func runInBackground(wg *sync.WaitGroup, run func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		run()
+	}()
+}
+
+// checkSchema logs how the database schema differs from the migrations, once in the background.
+// It is not logged on Lambda, where the database is dialed by the first invocation needing it.
+// With postgres.schemaCheck set to fail, the schema is also a critical dependency of the
+// readiness check, which is down while the schema lacks anything the migrations create.
+func checkSchema(logger *slog.Logger, cfg *config.Config, db *sqlx.DB, checker *health.Checker) {
+	migrations, err := migrate.Load(cfg.Postgres.MigrationsDir)
+	if err == nil && len(migrations) == 0 {
+		err = fmt.Errorf("no migrations in %s", cfg.Postgres.MigrationsDir)
+	}
+	if err != nil {
+		logger.Warn("Cannot check the database schema", "error", err)
+		return
+	}
+
+	if cfg.Postgres.SchemaCheck == "fail" {
+		checker.Add("schema", func(ctx context.Context) error {
+			drift, err := migrate.Check(ctx, db, migrations)
+			if err != nil {
+				return err
+			}
+			if drift.Missing() {
+				return fmt.Errorf("schema drift: %s", drift)
+			}
+			return nil
+		}, true)
+	}
+	if lambdaBuild {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.GetWarmupTimeout())
+		defer cancel()
+		drift, err := migrate.Check(ctx, db, migrations)
+		switch {
+		case err != nil:
+			logger.Warn("Cannot check the database schema", "error", err)
+		case drift.Missing():
+			logger.Error("Database schema differs from the migrations; run the migrate command",
+				"drift", drift.String(),
+				"pending_migrations", drift.PendingMigrations,
+				"missing_tables", drift.MissingTables,
+				"missing_columns", drift.MissingColumns,
+				"missing_indexes", drift.MissingIndexes,
+			)
+		case len(drift.UnknownMigrations) > 0:
+			logger.Info("Database has migrations newer than this version", "unknown_migrations", drift.UnknownMigrations)
+		default:
+			logger.Info("Database schema matches the migrations", "migrations", len(migrations))
+		}
+	}()
+}
+
+// warmUp pre-dials Postgres and Redis connections, prepares the hot user lookups on the
+// Postgres connections and loads Lua scripts, so the first requests after startup don't pay
+// cold-start latency. It returns the errors of the steps that failed.
+func warmUp(logger *slog.Logger, cfg *config.Config, db *sqlx.DB, users *repository.PostgresUserRepository, redisClient *redis.Client, shardClients []*redis.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.GetWarmupTimeout())
+	defer cancel()
+
+	start := time.Now()
+	var errs []error
+	statements, err := users.Prepare(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err := utils.WarmUpDatabase(ctx, db, cfg.Service.Warmup.PostgresConnections, statements); err != nil {
+		errs = append(errs, err)
+	}
+	if err := utils.WarmUpRedis(ctx, redisClient, cfg.Service.Warmup.RedisConnections); err != nil {
+		errs = append(errs, err)
+	}
+	for _, client := range shardClients {
+		if client == redisClient {
+			continue
+		}
+		if err := utils.WarmUpRedis(ctx, client, cfg.Service.Warmup.RedisConnections); err != nil {
+			errs = append(errs, fmt.Errorf("shard: %w", err))
+		}
+	}
+	for _, client := range shardClients {
+		if err := ratelimit.LoadScripts(ctx, client); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	logger.Info("Warm-up finished", "duration", time.Since(start).String())
+	return nil
 }
@@ -0,0 +1,106 @@
+// Command replay-events rebuilds the user read models from the domain event log,
+// for debugging and for checking the log against the users table. It reads the
+// same configuration as the server.
+//
+// The rebuilt user statistics are printed as JSON. With -users the rebuilt user
+// cache is written to a file as one JSON user per line, and with -verify the
+// statistics are compared with the live users table, exiting with status 1 when
+// they differ.
+//
+// Usage:
+//
+//	replay-events [-batch 1000] [-users users.jsonl] [-verify]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"reflect"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 1000, "number of events read per batch")
+	usersFile := flag.String("users", "", "file to write the rebuilt user cache to, one JSON user per line")
+	verify := flag.Bool("verify", false, "compare the rebuilt statistics with the users table")
+	flag.Parse()
+
+	if *batchSize <= 0 {
+		log.Fatalf("Batch size must be positive")
+	}
+
+	cfg := config.LoadConfig()
+
+	// Log through the structured logger so phone numbers are masked as configured
+	slog.SetDefault(logging.New(cfg.Logging, os.Stderr))
+
+	// Setup database
+	db, err := utils.SetupDatabase(cfg)
+	if err != nil {
+		log.Fatalf("Failed to setup database: %v", err)
+	}
+	defer db.Close()
+
+	eventService := service.NewEventService(repository.NewPostgresEventRepository(db, cfg.GetQueryTimeout()))
+	projection := service.NewUserProjection()
+
+	ctx := context.Background()
+	lastSequence, err := eventService.Replay(ctx, 0, *batchSize, projection.Apply)
+	if err != nil {
+		log.Fatalf("Failed to replay events: %v", err)
+	}
+	log.Printf("Replayed events up to sequence %d", lastSequence)
+
+	stats := projection.Stats()
+	encoded, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode statistics: %v", err)
+	}
+	fmt.Println(string(encoded))
+
+	if *usersFile != "" {
+		if err := writeUsers(*usersFile, projection); err != nil {
+			log.Fatalf("Failed to write %s: %v", *usersFile, err)
+		}
+		log.Printf("Wrote %d users to %s", stats.TotalUsers, *usersFile)
+	}
+
+	if *verify {
+		live, err := repository.NewPostgresUserRepository(db, cfg.GetQueryTimeout()).Stats(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read user statistics: %v", err)
+		}
+		if !reflect.DeepEqual(live, stats) {
+			log.Printf("Statistics differ from the users table: %+v", *live)
+			os.Exit(1)
+		}
+		log.Println("Statistics match the users table")
+	}
+}
+
+// writeUsers writes the active users of the projection to path, one JSON user per line
+func writeUsers(path string, projection *service.UserProjection) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	for _, user := range projection.Users() {
+		if err := encoder.Encode(user); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
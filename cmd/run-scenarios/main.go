@@ -0,0 +1,54 @@
+// Command run-scenarios runs the declarative auth flow scenarios in a directory against a
+// live instance, e.g. a local server in CI or staging, and reports each as passed or failed.
+// It exits with status 1 when any scenario fails. Scenarios only use the public API, so they
+// need no access to the instance's configuration, database or Redis.
+//
+// Usage:
+//
+//	run-scenarios [-url http://localhost:8080] [-dir scenarios] [-run lockout]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/scenario"
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the instance to run the scenarios against")
+	dir := flag.String("dir", "scenarios", "directory of the scenario files")
+	run := flag.String("run", "", "only run scenarios whose name contains this")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	flag.Parse()
+
+	scenarios, err := scenario.LoadDir(*dir)
+	if err != nil {
+		log.Fatalf("Failed to load scenarios: %v", err)
+	}
+
+	runner := scenario.NewRunner(*baseURL, &http.Client{Timeout: *timeout})
+	failed := 0
+	for _, s := range scenarios {
+		if !strings.Contains(s.Name, *run) {
+			continue
+		}
+		start := time.Now()
+		if err := runner.Run(context.Background(), s); err != nil {
+			failed++
+			fmt.Printf("FAIL %s (%s): %v\n", s.Name, time.Since(start).Round(time.Millisecond), err)
+			continue
+		}
+		fmt.Printf("PASS %s (%s)\n", s.Name, time.Since(start).Round(time.Millisecond))
+	}
+	if failed > 0 {
+		fmt.Printf("%d scenario(s) failed\n", failed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !lambda
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// lambdaBuild reports whether the binary is built to run on AWS Lambda (-tags lambda)
+const lambdaBuild = false
+
+// serveLambda is only available in Lambda builds
+func serveLambda(handler http.Handler) error {
+	return fmt.Errorf("not built for AWS Lambda, build with -tags lambda")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/lilokie/otp-auth/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// setUpTLS configures srv for HTTPS as configured. With Let's Encrypt, it returns the server
+// answering HTTP-01 challenges and redirecting to HTTPS, if one is configured.
+func setUpTLS(srv *http.Server, cfg *config.Config) *http.Server {
+	tlsCfg := cfg.Service.HTTP.TLS
+	switch {
+	case tlsCfg.Autocert.Enabled:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsCfg.Autocert.Domains...),
+			Cache:      autocert.DirCache(tlsCfg.Autocert.CacheDir),
+			Email:      tlsCfg.Autocert.Email,
+		}
+		// The TLS config answers TLS-ALPN-01 challenges on the HTTPS port itself
+		srv.TLSConfig = manager.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+		if tlsCfg.Autocert.HTTPPort == "" {
+			return nil
+		}
+		return &http.Server{
+			Addr:              ":" + tlsCfg.Autocert.HTTPPort,
+			Handler:           manager.HTTPHandler(nil),
+			ReadHeaderTimeout: cfg.GetReadHeaderTimeout(),
+			ReadTimeout:       cfg.GetReadTimeout(),
+			WriteTimeout:      cfg.GetWriteTimeout(),
+			IdleTimeout:       cfg.GetIdleTimeout(),
+		}
+	case tlsCfg.CertFile != "":
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return nil
+}
+
+// listenAndServe serves srv over HTTPS if it has a TLS config, or plain HTTP otherwise
+func listenAndServe(srv *http.Server, cfg *config.Config) error {
+	if srv.TLSConfig == nil {
+		return srv.ListenAndServe()
+	}
+	// Certificates come from the TLS config with autocert, so no files are given then
+	return srv.ListenAndServeTLS(cfg.Service.HTTP.TLS.CertFile, cfg.Service.HTTP.TLS.KeyFile)
+}
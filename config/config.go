@@ -1,26 +1,116 @@
 package config
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/lilokie/otp-auth/internal/sops"
 	"github.com/spf13/viper"
 )
 
+// sopsTimeout bounds decrypting the data key of an encrypted config file with a cloud KMS
+const sopsTimeout = 10 * time.Second
+
+// EnvDevelopment is the service.env of development deployments, where dev tokens can be minted
+const EnvDevelopment = "development"
+
 // ServiceConfig holds service-specific configuration
 type ServiceConfig struct {
-	Name                   string     `mapstructure:"name"`
-	Env                    string     `mapstructure:"env"`
-	GracefulShutdownSecond int        `mapstructure:"gracefulShutdownSecond"`
-	HTTP                   HTTPConfig `mapstructure:"http"`
+	Name                   string          `mapstructure:"name"`
+	Env                    string          `mapstructure:"env"`
+	GracefulShutdownSecond int             `mapstructure:"gracefulShutdownSecond"`
+	ConfigWatchInterval    int             `mapstructure:"configWatchInterval"` // seconds between checks of the config file for changes to reload, 0 disables
+	Store                  string          `mapstructure:"store"`               // external, keeping state in Postgres and Redis, or memory, keeping all of it in process memory
+	HTTP                   HTTPConfig      `mapstructure:"http"`
+	Warmup                 WarmupConfig    `mapstructure:"warmup"`
+	LoadScore              LoadScoreConfig `mapstructure:"loadScore"`
+	Health                 HealthConfig    `mapstructure:"health"`
 }
 
 // HTTPConfig holds HTTP server configuration
 type HTTPConfig struct {
-	Port string `mapstructure:"port"`
+	Port              string              `mapstructure:"port"`
+	RequestTimeout    int                 `mapstructure:"requestTimeout"`    // in seconds, upper bound for deadlines propagated by callers
+	ReadHeaderTimeout int                 `mapstructure:"readHeaderTimeout"` // in seconds, for reading request headers
+	ReadTimeout       int                 `mapstructure:"readTimeout"`       // in seconds, for reading whole requests including the body
+	WriteTimeout      int                 `mapstructure:"writeTimeout"`      // in seconds, from reading the request headers to writing the response; 0 derives it from the request timeout
+	IdleTimeout       int                 `mapstructure:"idleTimeout"`       // in seconds, keep-alive connections are kept open between requests
+	MaxBodyBytes      int                 `mapstructure:"maxBodyBytes"`      // largest request body accepted
+	TrustedProxies    []string            `mapstructure:"trustedProxies"`    // IPs and CIDRs of the proxies whose client IP header is honored; empty trusts none
+	RealIPHeader      string              `mapstructure:"realIPHeader"`      // header trusted proxies pass the client IP in
+	CountryHeader     string              `mapstructure:"countryHeader"`     // header trusted proxies pass the client's country in, e.g. CF-IPCountry; empty for none
+	TenantHeader      string              `mapstructure:"tenantHeader"`      // header trusted proxies pass the tenant requests are made for in; empty for none
+	LegacyErrors      bool                `mapstructure:"legacyErrors"`      // serve {"error", "code"} error objects instead of problem details
+	TLS               TLSConfig           `mapstructure:"tls"`
+	Deprecations      []DeprecationConfig `mapstructure:"deprecations"` // routes marked deprecated in their responses
+}
+
+// DeprecationDateLayout is the layout of the dates of deprecated routes
+const DeprecationDateLayout = "2006-01-02"
+
+// DeprecationConfig marks a route deprecated ahead of its removal
+type DeprecationConfig struct {
+	Route     string `mapstructure:"route"`     // "METHOD /path" as registered, e.g. "GET /v1/auth/otp-status/:challenge_id"
+	Since     string `mapstructure:"since"`     // date the route was deprecated, e.g. 2026-10-16
+	Sunset    string `mapstructure:"sunset"`    // date the route is going to be removed, empty if not decided yet
+	Successor string `mapstructure:"successor"` // URL of the route replacing it, if any
+}
+
+// GetSince returns the time the route was deprecated, the start of its since date in UTC
+func (d DeprecationConfig) GetSince() time.Time {
+	since, _ := time.Parse(DeprecationDateLayout, d.Since)
+	return since
+}
+
+// GetSunset returns the time the route is going to be removed, zero if not decided yet
+func (d DeprecationConfig) GetSunset() time.Time {
+	sunset, _ := time.Parse(DeprecationDateLayout, d.Sunset)
+	return sunset
+}
+
+// TLSConfig holds HTTPS configuration. Without a certificate or autocert, the server serves plain HTTP.
+type TLSConfig struct {
+	CertFile string         `mapstructure:"certFile"` // PEM certificate chain
+	KeyFile  string         `mapstructure:"keyFile"`  // PEM private key
+	Autocert AutocertConfig `mapstructure:"autocert"`
+}
+
+// AutocertConfig holds configuration for obtaining certificates from Let's Encrypt
+type AutocertConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Domains  []string `mapstructure:"domains"`  // host names certificates are requested for
+	Email    string   `mapstructure:"email"`    // contact for expiry and problem notices, optional
+	CacheDir string   `mapstructure:"cacheDir"` // directory certificates are kept in across restarts
+	HTTPPort string   `mapstructure:"httpPort"` // port answering HTTP-01 challenges and redirecting to HTTPS, empty disables
+}
+
+// WarmupConfig holds startup warm-up configuration
+type WarmupConfig struct {
+	Enabled             bool `mapstructure:"enabled"`
+	PostgresConnections int  `mapstructure:"postgresConnections"` // connections pre-dialed before readiness
+	RedisConnections    int  `mapstructure:"redisConnections"`    // connections pre-dialed before readiness
+	Timeout             int  `mapstructure:"timeout"`             // in seconds
+}
+
+// LoadScoreConfig holds configuration for the load score reported to load balancers
+type LoadScoreConfig struct {
+	MaxInFlight   int `mapstructure:"maxInFlight"`   // in-flight requests at which the instance counts as fully loaded
+	MaxLatency    int `mapstructure:"maxLatency"`    // in milliseconds, dependency latency at which the instance counts as fully loaded
+	ProbeInterval int `mapstructure:"probeInterval"` // in seconds, between dependency latency probes
+}
+
+// HealthConfig holds configuration for the dependency checks of the readiness check
+type HealthConfig struct {
+	Timeout           int  `mapstructure:"timeout"`           // in milliseconds, for each dependency check
+	CheckSMSProviders bool `mapstructure:"checkSMSProviders"` // also report whether an SMS provider is available
 }
 
 // DatabaseConfig holds database-specific configuration
@@ -32,48 +122,689 @@ type DatabaseConfig struct {
 	DatabaseName string `mapstructure:"databaseName"`
 	SSLMode      string `mapstructure:"sslMode"`
 	TimeZone     string `mapstructure:"timeZone"`
+
+	SchemaCheck   string `mapstructure:"schemaCheck"`   // warn logs how the schema differs from the migrations on startup, fail also keeps the instance unready, off skips the check
+	MigrationsDir string `mapstructure:"migrationsDir"` // migrations the schema is compared with
+
+	MaxOpenConns     int `mapstructure:"maxOpenConns"`     // connections open at once at most, 0 for no limit
+	MaxIdleConns     int `mapstructure:"maxIdleConns"`     // idle connections kept for reuse at most
+	ConnMaxLifetime  int `mapstructure:"connMaxLifetime"`  // in seconds, how long a connection is reused before it is replaced, 0 for no limit
+	StatementTimeout int `mapstructure:"statementTimeout"` // in milliseconds, Postgres cancels statements running longer, 0 disables
+	QueryTimeout     int `mapstructure:"queryTimeout"`     // in seconds, how long a repository call may take, 0 disables
 }
 
 // RedisConfig holds redis-specific configuration
 type RedisConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     string `mapstructure:"port"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
+	Host     string             `mapstructure:"host"`
+	Port     string             `mapstructure:"port"`
+	Username string             `mapstructure:"username"` // ACL user, the default user if empty
+	Password string             `mapstructure:"password"`
+	DB       int                `mapstructure:"db"`
+	TLS      RedisTLSConfig     `mapstructure:"tls"`
+	Shards   []RedisShardConfig `mapstructure:"shards"`  // OTP and rate limit keys are spread across these if set
+	Region   string             `mapstructure:"region"`  // this instance's region, if OTPs are replicated across regions
+	Regions  []RedisShardConfig `mapstructure:"regions"` // the Redis instances of the other regions OTPs are replicated to
+}
+
+// RedisShardConfig holds configuration for a single Redis shard or region
+type RedisShardConfig struct {
+	Name     string         `mapstructure:"name"` // keys are routed by shard name, so renaming a shard moves its keys
+	Host     string         `mapstructure:"host"`
+	Port     string         `mapstructure:"port"`
+	Username string         `mapstructure:"username"` // ACL user, the default user if empty
+	Password string         `mapstructure:"password"`
+	DB       int            `mapstructure:"db"`
+	TLS      RedisTLSConfig `mapstructure:"tls"`
+}
+
+// RedisTLSConfig holds configuration for connecting to Redis over TLS, as managed Redis offerings require
+type RedisTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"caFile"`             // PEM CA certificates verifying the server instead of the system's
+	CertFile           string `mapstructure:"certFile"`           // PEM client certificate, if the server requires one
+	KeyFile            string `mapstructure:"keyFile"`            // PEM private key of the client certificate
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"` // doesn't verify the server's certificate; for development only
+}
+
+// GetAddr returns the full address of the shard
+func (s RedisShardConfig) GetAddr() string {
+	return fmt.Sprintf("%s:%s", s.Host, s.Port)
+}
+
+// DynamoDBConfig holds configuration for keeping OTPs and rate limits in DynamoDB instead of Redis.
+// AWS credentials are looked up by the AWS SDK's default chain.
+type DynamoDBConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Region   string `mapstructure:"region"`
+	Endpoint string `mapstructure:"endpoint"` // overrides the region's endpoint if set, e.g. for DynamoDB Local
+	Table    string `mapstructure:"table"`
+	Timeout  int    `mapstructure:"timeout"` // in seconds
+}
+
+// GetTable returns the name of the table OTPs and rate limits are kept in
+func (d DynamoDBConfig) GetTable() string {
+	if d.Table == "" {
+		return "otp-auth"
+	}
+	return d.Table
+}
+
+// GetTimeout returns the timeout of DynamoDB requests
+func (d DynamoDBConfig) GetTimeout() time.Duration {
+	if d.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(d.Timeout) * time.Second
 }
 
 // JWTConfig holds JWT-specific configuration
 type JWTConfig struct {
-	Secret          string `mapstructure:"secret"`
-	ExpirationHours int    `mapstructure:"expirationHours"`
+	Secret          string       `mapstructure:"secret"`
+	ExpirationHours int          `mapstructure:"expirationHours"`
+	KMS             JWTKMSConfig `mapstructure:"kms"`
+}
+
+// JWTKMSConfig configures signing access tokens with an asymmetric cloud KMS key instead of the secret
+type JWTKMSConfig struct {
+	Provider       string   `mapstructure:"provider"`       // aws or gcp; empty signs with the secret
+	KeyID          string   `mapstructure:"keyId"`          // AWS key ID, ARN or alias, or GCP key version name
+	PreviousKeyIDs []string `mapstructure:"previousKeyIds"` // rotated-out keys whose tokens are still accepted
+	Region         string   `mapstructure:"region"`         // AWS region
+	Endpoint       string   `mapstructure:"endpoint"`       // defaults to the provider's endpoint
+	Timeout        int      `mapstructure:"timeout"`        // seconds
+}
+
+// GetTimeout returns the timeout of KMS requests
+func (k JWTKMSConfig) GetTimeout() time.Duration {
+	if k.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(k.Timeout) * time.Second
 }
 
-// RateLimitConfig holds rate limit configuration for OTP
+// SessionConfig holds session configuration
+type SessionConfig struct {
+	MaxConcurrent    int    `mapstructure:"maxConcurrent"`    // sessions per user, the oldest are revoked beyond it; 0 for no limit
+	Expiration       int    `mapstructure:"expiration"`       // days a session can be refreshed for
+	CountryConflicts string `mapstructure:"countryConflicts"` // sign-ins from another country than a user's active sessions: allow (default), notify or deny
+}
+
+// RateLimitConfig holds rate limit configuration
 type RateLimitConfig struct {
-	Count int `mapstructure:"count"`
-	Time  int `mapstructure:"time"` // in minutes
+	Algorithm string `mapstructure:"algorithm"` // fixed_window (default), sliding_window or token_bucket
+	Count     int    `mapstructure:"count"`
+	Time      int    `mapstructure:"time"` // in minutes
+}
+
+// GetWindow returns the rate limit window as time.Duration
+func (r RateLimitConfig) GetWindow() time.Duration {
+	return time.Duration(r.Time) * time.Minute
+}
+
+// RateLimitsConfig holds per-route rate limit configuration
+type RateLimitsConfig struct {
+	Routes           map[string]RateLimitConfig `mapstructure:"routes"`           // route name -> rate limit
+	WarningThreshold int                        `mapstructure:"warningThreshold"` // percent of a middleware limit used from which responses carry a warning, 0 disables warnings
+	Store            string                     `mapstructure:"store"`            // redis or memory, where the hits counted by rate limits are kept
+	FailurePolicy    string                     `mapstructure:"failurePolicy"`    // closed, open or local, what happens to hits while the store fails
+	Policies         []RateLimitPolicyConfig    `mapstructure:"policies"`         // limits declared per route and client, on top of routes
+}
+
+// RateLimitPolicyConfig holds a rate limit declared in configuration for the routes matching
+// a pattern, counting hits per client IP address, phone number, user or API key
+type RateLimitPolicyConfig struct {
+	Name      string `mapstructure:"name"`      // keeps the policy's hits apart from other policies'
+	Route     string `mapstructure:"route"`     // "METHOD /path" or "/path" as registered, e.g. "POST /v1/auth/verify-otp"; a trailing * matches by prefix
+	Key       string `mapstructure:"key"`       // ip, phone, user or api-key
+	Algorithm string `mapstructure:"algorithm"` // fixed_window (default), sliding_window or token_bucket
+	Count     int    `mapstructure:"count"`
+	Time      int    `mapstructure:"time"` // in minutes
+}
+
+// Limit returns the limit of the policy
+func (p RateLimitPolicyConfig) Limit() RateLimitConfig {
+	return RateLimitConfig{Algorithm: p.Algorithm, Count: p.Count, Time: p.Time}
+}
+
+// LockoutConfig holds OTP verification lockout configuration
+type LockoutConfig struct {
+	MaxAttempts int `mapstructure:"maxAttempts"` // failed verifications before locking out, 0 disables lockout
+	Window      int `mapstructure:"window"`      // in minutes, period in which failures are counted
+	Cooldown    int `mapstructure:"cooldown"`    // in minutes, how long verification stays blocked
+}
+
+// GetWindow returns the failure counting window as time.Duration
+func (l LockoutConfig) GetWindow() time.Duration {
+	return time.Duration(l.Window) * time.Minute
+}
+
+// GetCooldown returns the lockout cooldown as time.Duration
+func (l LockoutConfig) GetCooldown() time.Duration {
+	return time.Duration(l.Cooldown) * time.Minute
+}
+
+// VerifyLockConfig holds configuration for the lock serializing verifications for a phone number
+type VerifyLockConfig struct {
+	TTL  int `mapstructure:"ttl"`  // in seconds, longest a verification holds the lock if it isn't released
+	Wait int `mapstructure:"wait"` // in milliseconds, how long a verification waits for a concurrent one
+}
+
+// GetTTL returns how long a verification may hold the lock before it expires
+func (l VerifyLockConfig) GetTTL() time.Duration {
+	if l.TTL <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(l.TTL) * time.Second
+}
+
+// GetWait returns how long a verification waits for the lock before giving up
+func (l VerifyLockConfig) GetWait() time.Duration {
+	if l.Wait <= 0 {
+		return 3 * time.Second
+	}
+	return time.Duration(l.Wait) * time.Millisecond
+}
+
+// BackupCodeConfig holds configuration for one-time backup codes
+type BackupCodeConfig struct {
+	Count  int `mapstructure:"count"`  // codes per generated set
+	Length int `mapstructure:"length"` // characters per code, excluding the separator
+}
+
+// TrustedDeviceConfig holds configuration for devices that sign in without an OTP
+type TrustedDeviceConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	Expiration int  `mapstructure:"expiration"` // in days
+}
+
+// OTPChannelsConfig holds configuration of the channels OTPs are sent over
+type OTPChannelsConfig struct {
+	Email      bool   `mapstructure:"email"`      // let OTPs be requested by email, sent to the address on the user's profile
+	FlashCall  bool   `mapstructure:"flashCall"`  // let OTPs be requested by flash call, a missed call from a number ending in the OTP
+	Duplicates string `mapstructure:"duplicates"` // reuse (default) or invalidate pending OTPs sent over another channel
+
+	// VoiceLandlines accepts landlines, which can't receive SMS, as numbers to call OTPs to
+	VoiceLandlines bool `mapstructure:"voiceLandlines"`
 }
 
 // OTPConfig holds OTP-specific configuration
 type OTPConfig struct {
-	Expiration int             `mapstructure:"expiration"` // in seconds
-	Length     int             `mapstructure:"length"`
-	RateLimit  RateLimitConfig `mapstructure:"rateLimit"`
+	Expiration       int                 `mapstructure:"expiration"`       // in seconds
+	ExpirationJitter int                 `mapstructure:"expirationJitter"` // in seconds, added on top of expiration
+	Length           int                 `mapstructure:"length"`
+	ResendCooldown   int                 `mapstructure:"resendCooldown"` // in seconds, minimum time between sends of an OTP
+	RateLimit        RateLimitConfig     `mapstructure:"rateLimit"`
+	Lockout          LockoutConfig       `mapstructure:"lockout"`
+	VerifyLock       VerifyLockConfig    `mapstructure:"verifyLock"`
+	BackupCodes      BackupCodeConfig    `mapstructure:"backupCodes"`
+	TrustedDevices   TrustedDeviceConfig `mapstructure:"trustedDevices"`
+	Channels         OTPChannelsConfig   `mapstructure:"channels"`
+	AllowlistOnly    bool                `mapstructure:"allowlistOnly"`   // only send OTPs to phone numbers on the allowlist, e.g. in staging
+	Store            string              `mapstructure:"store"`           // redis, postgres or memory, where challenges, resend cooldowns and failed verifications are kept
+	CleanupInterval  int                 `mapstructure:"cleanupInterval"` // in seconds, how often expired OTPs are deleted from postgres or memory
+}
+
+// AdaptiveLimitConfig holds adaptive concurrency limit configuration for a dependency
+type AdaptiveLimitConfig struct {
+	Enabled          bool    `mapstructure:"enabled"`
+	InitialLimit     int     `mapstructure:"initialLimit"`
+	MinLimit         int     `mapstructure:"minLimit"`
+	MaxLimit         int     `mapstructure:"maxLimit"`
+	LatencyThreshold int     `mapstructure:"latencyThreshold"` // in milliseconds, slower operations shrink the limit
+	BackoffRatio     float64 `mapstructure:"backoffRatio"`     // limit multiplier applied on slow or timed out operations
+}
+
+// GetLatencyThreshold returns the latency threshold as time.Duration
+func (a AdaptiveLimitConfig) GetLatencyThreshold() time.Duration {
+	return time.Duration(a.LatencyThreshold) * time.Millisecond
+}
+
+// ConcurrencyConfig holds adaptive concurrency limits per dependency
+type ConcurrencyConfig struct {
+	Redis          AdaptiveLimitConfig  `mapstructure:"redis"`
+	Postgres       AdaptiveLimitConfig  `mapstructure:"postgres"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuitBreaker"` // applies to the OTP and user stores, one breaker per dependency
+}
+
+// CircuitBreakerConfig holds configuration for failing fast while a dependency is down
+type CircuitBreakerConfig struct {
+	Enabled     bool `mapstructure:"enabled"`
+	Failures    int  `mapstructure:"failures"`    // consecutive unreachable or timed out operations that open the breaker
+	OpenTimeout int  `mapstructure:"openTimeout"` // in seconds, how long operations are rejected before one is tried again
+}
+
+// GetOpenTimeout returns how long an open circuit breaker rejects operations
+func (b CircuitBreakerConfig) GetOpenTimeout() time.Duration {
+	return time.Duration(b.OpenTimeout) * time.Second
+}
+
+// MetricsConfig holds metrics configuration
+type MetricsConfig struct {
+	RedisStatsInterval      int `mapstructure:"redisStatsInterval"`      // in seconds
+	ActiveUsersSyncInterval int `mapstructure:"activeUsersSyncInterval"` // in seconds, how often login events are fed to the active user counts
+	UniqueIPFlushInterval   int `mapstructure:"uniqueIPFlushInterval"`   // in seconds, how often requesting IPs are written to Redis
+	UniqueIPRetention       int `mapstructure:"uniqueIPRetention"`       // in days, how long unique IP counts are kept
+}
+
+// SMSProviderConfig holds configuration for a single SMS provider
+type SMSProviderConfig struct {
+	Name          string  `mapstructure:"name"`
+	Type          string  `mapstructure:"type"`
+	CallbackToken string  `mapstructure:"callbackToken"` // authenticates delivery status callbacks and receipts, empty disables them
+	RateLimit     float64 `mapstructure:"rateLimit"`     // messages per second the provider accepts, 0 disables throttling
+	Burst         int     `mapstructure:"burst"`         // messages sent at once before throttling starts, defaults to one second's worth
+	MaxQueue      int     `mapstructure:"maxQueue"`      // sends waiting for the rate cap before further sends are rejected
+
+	SenderIDs []SMSSenderIDConfig `mapstructure:"senderIds"` // sender IDs by destination, the provider's default for others
+}
+
+// SMSSenderIDConfig holds the sender IDs or short codes a provider sends from to a destination
+type SMSSenderIDConfig struct {
+	Prefix string   `mapstructure:"prefix"` // country calling code or longer prefix of destinations, e.g. +98; empty matches all
+	IDs    []string `mapstructure:"ids"`    // tried in order, each when the provider rejected the ones before
+}
+
+// SMSConfig holds SMS delivery configuration
+type SMSConfig struct {
+	Providers []SMSProviderConfig `mapstructure:"providers"` // in rotation order
+	Failover  SMSFailoverConfig   `mapstructure:"failover"`
+	Queue     SMSQueueConfig      `mapstructure:"queue"`
+	Overflow  SMSOverflowConfig   `mapstructure:"overflow"`
+}
+
+// SMSFailoverConfig holds configuration for failing over between SMS providers
+// and quarantining providers with high error rates
+type SMSFailoverConfig struct {
+	Timeout     int     `mapstructure:"timeout"`     // in seconds, per provider attempt
+	Window      int     `mapstructure:"window"`      // in seconds, error rates are counted over
+	MinFailures int     `mapstructure:"minFailures"` // failures in a window before a provider can be quarantined
+	ErrorRate   float64 `mapstructure:"errorRate"`   // share of failed sends in a window that quarantines a provider
+	Quarantine  int     `mapstructure:"quarantine"`  // in seconds
+}
+
+// GetTimeout returns how long a provider gets to send an OTP before the next one is tried
+func (f SMSFailoverConfig) GetTimeout() time.Duration {
+	if f.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(f.Timeout) * time.Second
+}
+
+// GetWindow returns the window provider error rates are counted over
+func (f SMSFailoverConfig) GetWindow() time.Duration {
+	if f.Window <= 0 {
+		return time.Minute
+	}
+	return time.Duration(f.Window) * time.Second
+}
+
+// GetMinFailures returns the number of failures in a window before a provider can be quarantined
+func (f SMSFailoverConfig) GetMinFailures() int64 {
+	if f.MinFailures <= 0 {
+		return 5
+	}
+	return int64(f.MinFailures)
+}
+
+// GetErrorRate returns the share of failed sends in a window that quarantines a provider
+func (f SMSFailoverConfig) GetErrorRate() float64 {
+	if f.ErrorRate <= 0 || f.ErrorRate > 1 {
+		return 0.5
+	}
+	return f.ErrorRate
+}
+
+// GetQuarantine returns how long a provider with a high error rate is taken out of rotation
+func (f SMSFailoverConfig) GetQuarantine() time.Duration {
+	if f.Quarantine <= 0 {
+		return time.Minute
+	}
+	return time.Duration(f.Quarantine) * time.Second
+}
+
+// SMSQueueConfig holds configuration for sending OTPs in the background
+type SMSQueueConfig struct {
+	Enabled        bool `mapstructure:"enabled"`        // queue OTPs and return before they are sent
+	Workers        int  `mapstructure:"workers"`        // OTPs sent at once per instance
+	MaxLength      int  `mapstructure:"maxLength"`      // queued OTPs before further OTPs are rejected
+	MaxAttempts    int  `mapstructure:"maxAttempts"`    // attempts before an OTP is moved to the dead-letter list
+	InitialBackoff int  `mapstructure:"initialBackoff"` // in seconds, before the first retry
+	MaxBackoff     int  `mapstructure:"maxBackoff"`     // in seconds, between retries
+	PollInterval   int  `mapstructure:"pollInterval"`   // in seconds, how often idle workers check for due retries
+	DeadLetterSize int  `mapstructure:"deadLetterSize"` // dead letters kept, the oldest are dropped beyond it
+}
+
+// GetWorkers returns how many OTPs an instance sends at once
+func (q SMSQueueConfig) GetWorkers() int {
+	if q.Workers <= 0 {
+		return 4
+	}
+	return q.Workers
+}
+
+// GetMaxLength returns how many OTPs can be queued before further OTPs are rejected
+func (q SMSQueueConfig) GetMaxLength() int {
+	if q.MaxLength <= 0 {
+		return 10000
+	}
+	return q.MaxLength
+}
+
+// GetMaxAttempts returns how often sending an OTP is attempted before it is moved to the dead-letter list
+func (q SMSQueueConfig) GetMaxAttempts() int {
+	if q.MaxAttempts <= 0 {
+		return 3
+	}
+	return q.MaxAttempts
+}
+
+// GetInitialBackoff returns the delay before the first retry of a failed OTP send
+func (q SMSQueueConfig) GetInitialBackoff() time.Duration {
+	if q.InitialBackoff <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(q.InitialBackoff) * time.Second
+}
+
+// GetMaxBackoff returns the longest delay between retries of a failed OTP send
+func (q SMSQueueConfig) GetMaxBackoff() time.Duration {
+	if q.MaxBackoff <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(q.MaxBackoff) * time.Second
+}
+
+// GetPollInterval returns how often idle workers check for due retries
+func (q SMSQueueConfig) GetPollInterval() time.Duration {
+	if q.PollInterval <= 0 {
+		return time.Second
+	}
+	return time.Duration(q.PollInterval) * time.Second
+}
+
+// GetDeadLetterSize returns how many dead letters are kept
+func (q SMSQueueConfig) GetDeadLetterSize() int {
+	if q.DeadLetterSize <= 0 {
+		return 1000
+	}
+	return q.DeadLetterSize
+}
+
+// SMSOverflowConfig holds configuration for accepting OTP requests while sending SMS is saturated
+type SMSOverflowConfig struct {
+	Enabled   bool    `mapstructure:"enabled"`   // queue OTP requests with 202 Accepted while every provider is throttled or the send queue is full
+	MaxLength int     `mapstructure:"maxLength"` // OTPs queued beyond the send queue's maxLength, or in all without the send queue
+	DrainRate float64 `mapstructure:"drainRate"` // messages per second queued OTPs are sent at, for estimated delays; 0 derives it from the providers' rateLimit
+
+	// Tenants overrides the policy for the tenants passed in service.http.tenantHeader, by
+	// tenant in lower case; requests of other tenants or none get the policy above
+	Tenants map[string]SMSOverflowTenantConfig `mapstructure:"tenants"`
+}
+
+// SMSOverflowTenantConfig holds a tenant's policy for accepting OTP requests while sending SMS
+// is saturated
+type SMSOverflowTenantConfig struct {
+	Enabled   bool `mapstructure:"enabled"`   // queue the tenant's OTP requests with 202 Accepted
+	MaxLength int  `mapstructure:"maxLength"` // the tenant's OTPs queued at once, send queue included, beyond which its requests are rejected; 0 for no limit of its own
+}
+
+// GetMaxLength returns how many OTPs can be queued while sending SMS is saturated
+func (o SMSOverflowConfig) GetMaxLength() int {
+	if o.MaxLength <= 0 {
+		return 1000
+	}
+	return o.MaxLength
+}
+
+// ForTenant returns whether the overflow is enabled for a tenant's requests and how many of
+// its OTPs may be queued at once, 0 for no limit of its own
+func (o SMSOverflowConfig) ForTenant(tenant string) (bool, int) {
+	if policy, ok := o.Tenants[tenant]; ok && tenant != "" {
+		return policy.Enabled, policy.MaxLength
+	}
+	return o.Enabled, 0
+}
+
+// AnyEnabled reports whether the overflow is enabled for requests of any tenant, or none
+func (o SMSOverflowConfig) AnyEnabled() bool {
+	if o.Enabled {
+		return true
+	}
+	for _, policy := range o.Tenants {
+		if policy.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminConfig holds admin-specific configuration
+type AdminConfig struct {
+	RestoreWindow int                 `mapstructure:"restoreWindow"` // in hours
+	PurgeInterval int                 `mapstructure:"purgeInterval"` // in minutes, how often users deleted longer ago than restoreWindow are erased
+	ExportTimeout int                 `mapstructure:"exportTimeout"` // in seconds, how long a user export may stream, beyond service.http.requestTimeout
+	Permissions   map[string][]string `mapstructure:"permissions"`   // role -> granted permissions
+}
+
+// MigrationConfig holds legacy user migration configuration
+type MigrationConfig struct {
+	LegacySecret    string `mapstructure:"legacySecret"`    // HMAC secret shared with the legacy system, empty disables migration
+	MaxBatchSize    int    `mapstructure:"maxBatchSize"`    // users per migration request
+	SignatureMaxAge int    `mapstructure:"signatureMaxAge"` // in minutes, how old a signed batch may be
+}
+
+// TokenExchangeConfig holds configuration for exchanging user tokens for downstream service tokens
+type TokenExchangeConfig struct {
+	Secret     string                `mapstructure:"secret"`     // signs exchanged tokens, empty disables token exchange
+	Expiration int                   `mapstructure:"expiration"` // in minutes, lifetime of exchanged tokens
+	Clients    []TokenExchangeClient `mapstructure:"clients"`
+}
+
+// TokenExchangeClient is a trusted service allowed to exchange user tokens
+type TokenExchangeClient struct {
+	Name      string   `mapstructure:"name"`
+	APIKey    string   `mapstructure:"apiKey"`
+	Audiences []string `mapstructure:"audiences"` // downstream services the client may request tokens for
+	Scopes    []string `mapstructure:"scopes"`    // scopes the client may request
+
+	// A key being rotated out stays valid alongside APIKey until its expiry, so the client can
+	// switch to the new key without downtime
+	PreviousAPIKey       string `mapstructure:"previousApiKey"`
+	PreviousAPIKeyExpiry string `mapstructure:"previousApiKeyExpiry"` // RFC 3339 time the previous key stops working
+}
+
+// PreviousAPIKeyValid reports whether the client's previous API key is still accepted at now
+func (c TokenExchangeClient) PreviousAPIKeyValid(now time.Time) bool {
+	if c.PreviousAPIKey == "" {
+		return false
+	}
+	expiry, err := time.Parse(time.RFC3339, c.PreviousAPIKeyExpiry)
+	return err == nil && now.Before(expiry)
+}
+
+// PaginationConfig holds limits on list requests, which keep them from scanning whole tables
+type PaginationConfig struct {
+	MaxPageSize     int `mapstructure:"maxPageSize"`     // larger page sizes are rejected
+	MaxSearchLength int `mapstructure:"maxSearchLength"` // in characters, longer search terms are rejected
+}
+
+// CaptchaConfig holds configuration for requiring a CAPTCHA on OTP requests
+type CaptchaConfig struct {
+	Provider  string          `mapstructure:"provider"` // recaptcha, hcaptcha or turnstile; empty disables CAPTCHA
+	Secret    string          `mapstructure:"secret"`
+	VerifyURL string          `mapstructure:"verifyURL"` // overrides the provider's siteverify endpoint
+	Timeout   int             `mapstructure:"timeout"`   // in seconds, per verification
+	Threshold RateLimitConfig `mapstructure:"threshold"` // OTP requests per IP allowed without a CAPTCHA; a count of 0 always requires one
+}
+
+// WebhooksConfig holds configuration for notifying external endpoints of domain events
+type WebhooksConfig struct {
+	PollInterval   int                     `mapstructure:"pollInterval"`   // in seconds, how often new events are queued and due deliveries sent
+	Timeout        int                     `mapstructure:"timeout"`        // in seconds, per delivery attempt
+	MaxAttempts    int                     `mapstructure:"maxAttempts"`    // attempts before a delivery is given up
+	InitialBackoff int                     `mapstructure:"initialBackoff"` // in seconds, delay before the first retry, doubled on every further retry
+	MaxBackoff     int                     `mapstructure:"maxBackoff"`     // in seconds, longest delay between retries
+	MaxEventAge    int                     `mapstructure:"maxEventAge"`    // in minutes, older events are not delivered
+	Endpoints      []WebhookEndpointConfig `mapstructure:"endpoints"`
+}
+
+// WebhookEndpointConfig is an external endpoint notified of domain events
+type WebhookEndpointConfig struct {
+	Name      string   `mapstructure:"name"`
+	URL       string   `mapstructure:"url"`
+	Secret    string   `mapstructure:"secret"`    // signs delivered events
+	Events    []string `mapstructure:"events"`    // event types delivered, empty delivers every event
+	Analytics string   `mapstructure:"analytics"` // anonymize or drop events about users without analytics consent; empty delivers them unchanged
+}
+
+// HooksConfig holds configuration for the endpoint called synchronously on sign-ups, sign-ins
+// and wrong OTPs, which can refuse sign-ins
+type HooksConfig struct {
+	URL        string   `mapstructure:"url"`        // empty disables webhook hooks
+	Secret     string   `mapstructure:"secret"`     // signs hook requests like webhook deliveries
+	Timeout    int      `mapstructure:"timeout"`    // in milliseconds, per hook call
+	Events     []string `mapstructure:"events"`     // hooks called: user.created, user.login, otp.failed; empty calls all
+	FailClosed bool     `mapstructure:"failClosed"` // refuse sign-ins while the endpoint fails, rather than allowing them
+}
+
+// PolicyConfig holds configuration for authorization decisions by Open Policy Agent on admin
+// routes and OTP requests and verifications
+type PolicyConfig struct {
+	OPAURL   string   `mapstructure:"opaURL"`   // OPA server, usually a sidecar; empty disables policies
+	Path     string   `mapstructure:"path"`     // data path of the decision, e.g. otpauth/authz
+	Files    []string `mapstructure:"files"`    // Rego files uploaded to OPA at startup, next to any bundles OPA loads itself
+	Timeout  int      `mapstructure:"timeout"`  // in milliseconds, per decision
+	FailOpen bool     `mapstructure:"failOpen"` // allow requests while OPA can't decide, rather than failing them
+}
+
+// EmailConfig holds configuration for sending OTPs by email over SMTP
+type EmailConfig struct {
+	Host     string `mapstructure:"host"` // SMTP server; empty writes the emails to the logs instead
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"` // empty sends without authenticating
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	Subject  string `mapstructure:"subject"`
+	Timeout  int    `mapstructure:"timeout"` // in seconds, per email
+}
+
+// GetTimeout returns how long sending an email may take
+func (e EmailConfig) GetTimeout() time.Duration {
+	if e.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(e.Timeout) * time.Second
+}
+
+// FlashCallConfig holds configuration for sending OTPs by flash call
+type FlashCallConfig struct {
+	Provider     string `mapstructure:"provider"`     // log (default) writes the calls to the logs, http asks a telephony gateway to place them
+	CallerPrefix string `mapstructure:"callerPrefix"` // calls are placed from this prefix followed by the OTP, e.g. +98215550
+	URL          string `mapstructure:"url"`          // of the http provider's gateway
+	Token        string `mapstructure:"token"`        // bearer token for the gateway; empty sends none
+	Timeout      int    `mapstructure:"timeout"`      // in seconds, per call
+}
+
+// GetTimeout returns how long placing a flash call may take
+func (f FlashCallConfig) GetTimeout() time.Duration {
+	if f.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(f.Timeout) * time.Second
+}
+
+// SilentAuthConfig holds configuration for verifying phone numbers silently with their carrier,
+// without an OTP, for clients on mobile data
+type SilentAuthConfig struct {
+	Provider string `mapstructure:"provider"` // none (default), header or http
+
+	// Header and TrustedProxies configure the header provider: the carrier's enrichment proxies,
+	// at the addresses or CIDRs of TrustedProxies, pass the subscriber's number in Header
+	Header         string   `mapstructure:"header"`
+	TrustedProxies []string `mapstructure:"trustedProxies"`
+
+	URL     string `mapstructure:"url"`     // of the http provider's number verification API
+	Token   string `mapstructure:"token"`   // bearer token for the API; empty sends none
+	Timeout int    `mapstructure:"timeout"` // in seconds, per verification
+}
+
+// GetTimeout returns how long verifying a phone number with the number verification API may take
+func (s SilentAuthConfig) GetTimeout() time.Duration {
+	if s.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(s.Timeout) * time.Second
+}
+
+// CanaryConfig holds configuration for routing requests through alternative implementations of
+// auth logic, registered side by side with the stable ones, to try algorithm changes on a share
+// of traffic first
+type CanaryConfig struct {
+	Percentage int                   `mapstructure:"percentage"` // share of clients routed to the canary variant, 0-100
+	Header     bool                  `mapstructure:"header"`     // let requests pick their variant with the X-Canary header
+	RateLimit  CanaryRateLimitConfig `mapstructure:"rateLimit"`
+}
+
+// CanaryRateLimitConfig holds the canary variant of the rate limiters
+type CanaryRateLimitConfig struct {
+	Algorithm string `mapstructure:"algorithm"` // fixed_window, sliding_window or token_bucket; empty registers no canary limiter
+}
+
+// MaintenanceConfig holds configuration for announcing planned downtime to clients
+type MaintenanceConfig struct {
+	Header   bool `mapstructure:"header"`   // announce the next maintenance window in the X-Maintenance-Notice header of every response
+	CacheTTL int  `mapstructure:"cacheTtl"` // in seconds, how long each instance caches the notices
+}
+
+// GetCacheTTL returns how long each instance caches the maintenance notices
+func (m MaintenanceConfig) GetCacheTTL() time.Duration {
+	if m.CacheTTL <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(m.CacheTTL) * time.Second
+}
+
+// LoggingConfig holds structured logging configuration
+type LoggingConfig struct {
+	Level           string `mapstructure:"level"`           // debug, info, warn or error
+	Format          string `mapstructure:"format"`          // json or text
+	RevealSensitive bool   `mapstructure:"revealSensitive"` // log phone numbers and OTP codes unmasked, for local development only
 }
 
 // Config holds all configuration for the application
 type Config struct {
-	Service  ServiceConfig  `mapstructure:"service"`
-	Postgres DatabaseConfig `mapstructure:"postgres"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	OTP      OTPConfig      `mapstructure:"otp"`
+	Service       ServiceConfig       `mapstructure:"service"`
+	Postgres      DatabaseConfig      `mapstructure:"postgres"`
+	Redis         RedisConfig         `mapstructure:"redis"`
+	DynamoDB      DynamoDBConfig      `mapstructure:"dynamodb"`
+	JWT           JWTConfig           `mapstructure:"jwt"`
+	OTP           OTPConfig           `mapstructure:"otp"`
+	SMS           SMSConfig           `mapstructure:"sms"`
+	Email         EmailConfig         `mapstructure:"email"`
+	FlashCall     FlashCallConfig     `mapstructure:"flashCall"`
+	SilentAuth    SilentAuthConfig    `mapstructure:"silentAuth"`
+	Admin         AdminConfig         `mapstructure:"admin"`
+	Metrics       MetricsConfig       `mapstructure:"metrics"`
+	RateLimits    RateLimitsConfig    `mapstructure:"rateLimits"`
+	Concurrency   ConcurrencyConfig   `mapstructure:"concurrency"`
+	Migration     MigrationConfig     `mapstructure:"migration"`
+	TokenExchange TokenExchangeConfig `mapstructure:"tokenExchange"`
+	Webhooks      WebhooksConfig      `mapstructure:"webhooks"`
+	Hooks         HooksConfig         `mapstructure:"hooks"`
+	Policy        PolicyConfig        `mapstructure:"policy"`
+	Canary        CanaryConfig        `mapstructure:"canary"`
+	Maintenance   MaintenanceConfig   `mapstructure:"maintenance"`
+	Sessions      SessionConfig       `mapstructure:"sessions"`
+	Captcha       CaptchaConfig       `mapstructure:"captcha"`
+	Pagination    PaginationConfig    `mapstructure:"pagination"`
+	Logging       LoggingConfig       `mapstructure:"logging"`
 }
 
 // ConfigSetup holds the configuration setup
 type ConfigSetup struct {
-	path   string
-	config Config
+	path     string
+	optional bool // whether a missing config file is fine
+	config   Config
 }
 
 // NewConfigSetup creates a new config setup
@@ -83,62 +814,354 @@ func NewConfigSetup(path string) *ConfigSetup {
 	}
 }
 
-// SetUp reads and sets up the configuration
+// SetUp reads and sets up the configuration. Environment variables override the config file,
+// which overrides the defaults.
 func (cs *ConfigSetup) SetUp() *Config {
-	viper.SetConfigFile(cs.path)
+	cfg, err := cs.load()
+	if err != nil {
+		log.Panic(err)
+	}
+	cs.config = *cfg
+	return &cs.config
+}
+
+// load reads the configuration from the defaults, the config file and environment variables
+func (cs *ConfigSetup) load() (*Config, error) {
+	setDefaultsAndEnv()
+
+	if _, err := os.Stat(cs.path); cs.optional && errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Config file %s not found, using defaults and environment variables", cs.path)
+	} else if err := cs.readConfigFile(); err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
 
-	if err := viper.ReadInConfig(); err != nil {
-		log.Panic("Error reading config file: ", err)
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("error unmarshalling config: %w", err)
 	}
+	return &cfg, nil
+}
 
-	if err := viper.Unmarshal(&cs.config); err != nil {
-		log.Panic("Error unmarshalling config: ", err)
+// readConfigFile reads the config file into viper, decrypting it first if it is encrypted with SOPS.
+// Its data key is decrypted with the age keys or the cloud credentials of the environment.
+func (cs *ConfigSetup) readConfigFile() error {
+	data, err := os.ReadFile(cs.path)
+	if err != nil {
+		return err
+	}
+	if !sops.IsEncrypted(data) {
+		viper.SetConfigFile(cs.path)
+		return viper.ReadInConfig()
 	}
 
-	return &cs.config
+	keys, err := sops.KeysFromEnv(sopsTimeout)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sopsTimeout)
+	defer cancel()
+	plaintext, err := sops.DecryptYAML(ctx, data, keys)
+	if err != nil {
+		return err
+	}
+	log.Printf("Decrypted config file %s", cs.path)
+
+	viper.SetConfigType("yaml")
+	return viper.ReadConfig(bytes.NewReader(plaintext))
 }
 
-// LoadConfig loads configuration from the YAML file
+// LoadConfig loads configuration from the YAML file and environment variables
 func LoadConfig() *Config {
+	return defaultConfigSetup().SetUp()
+}
+
+// defaultConfigSetup returns the setup of the config file named by CONFIG_PATH, or of the optional
+// config.local.yaml of the current directory
+func defaultConfigSetup() *ConfigSetup {
+	// Check if config path provided as environment variable
+	if envPath := os.Getenv("CONFIG_PATH"); envPath != "" {
+		return NewConfigSetup(envPath)
+	}
+
 	// Get the current working directory
 	dir, err := os.Getwd()
 	if err != nil {
 		log.Panic("Failed to get current directory: ", err)
 	}
 
-	// Fall back to environment variables if config file not found
-	viper.AutomaticEnv()
+	// Set up default config path; without it, the service runs on defaults and environment variables
+	cs := NewConfigSetup(filepath.Join(dir, "config.local.yaml"))
+	cs.optional = true
+	return cs
+}
 
-	// Set up default config path
-	configPath := filepath.Join(dir, "config.local.yaml")
+// GetOTPExpiration GetExpiration returns the OTP expiration as time.Duration
+func (c *Config) GetOTPExpiration() time.Duration {
+	return time.Duration(c.OTP.Expiration) * time.Second
+}
 
-	// Check if config path provided as environment variable
-	if envPath := os.Getenv("CONFIG_PATH"); envPath != "" {
-		configPath = envPath
+// GetOTPExpirationJitter returns the maximum random extension of the OTP expiration
+func (c *Config) GetOTPExpirationJitter() time.Duration {
+	return time.Duration(c.OTP.ExpirationJitter) * time.Second
+}
+
+// GetTokenExchangeExpiration returns the lifetime of exchanged tokens
+func (c *Config) GetTokenExchangeExpiration() time.Duration {
+	if c.TokenExchange.Expiration <= 0 {
+		return 5 * time.Minute
 	}
+	return time.Duration(c.TokenExchange.Expiration) * time.Minute
+}
 
-	// Try to load the config
-	cs := NewConfigSetup(configPath)
-	config := cs.SetUp()
+// GetOTPResendCooldown returns the minimum time between sends of an OTP to a phone number
+func (c *Config) GetOTPResendCooldown() time.Duration {
+	return time.Duration(c.OTP.ResendCooldown) * time.Second
+}
 
-	// Convert config values to the expected format
-	return &Config{
-		Service:  config.Service,
-		Postgres: config.Postgres,
-		Redis:    config.Redis,
-		JWT:      config.JWT,
-		OTP:      config.OTP,
+// GetBackupCodeCount returns how many backup codes are generated per set
+func (c *Config) GetBackupCodeCount() int {
+	if c.OTP.BackupCodes.Count <= 0 {
+		return 10
 	}
+	return c.OTP.BackupCodes.Count
 }
 
-// GetOTPExpiration GetExpiration returns the OTP expiration as time.Duration
-func (c *Config) GetOTPExpiration() time.Duration {
-	return time.Duration(c.OTP.Expiration) * time.Second
+// GetBackupCodeLength returns the number of characters in a backup code
+func (c *Config) GetBackupCodeLength() int {
+	if c.OTP.BackupCodes.Length <= 0 {
+		return 10
+	}
+	return c.OTP.BackupCodes.Length
+}
+
+// GetTrustedDeviceExpiration returns how long a trusted device can sign in without an OTP
+func (c *Config) GetTrustedDeviceExpiration() time.Duration {
+	if c.OTP.TrustedDevices.Expiration <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(c.OTP.TrustedDevices.Expiration) * 24 * time.Hour
+}
+
+// GetSessionExpiration returns how long a session lasts, refreshes included
+func (c *Config) GetSessionExpiration() time.Duration {
+	if c.Sessions.Expiration <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(c.Sessions.Expiration) * 24 * time.Hour
+}
+
+// Policies for sign-ins from another country than a user's active sessions
+const (
+	CountryConflictsAllow  = "allow"
+	CountryConflictsNotify = "notify"
+	CountryConflictsDeny   = "deny"
+)
+
+// GetCountryConflicts returns the policy for sign-ins from another country than a user's active sessions
+func (c *Config) GetCountryConflicts() string {
+	if c.Sessions.CountryConflicts == "" {
+		return CountryConflictsAllow
+	}
+	return c.Sessions.CountryConflicts
+}
+
+// GetRedisStatsInterval returns how often Redis statistics are sampled for metrics
+func (c *Config) GetRedisStatsInterval() time.Duration {
+	if c.Metrics.RedisStatsInterval <= 0 {
+		return 15 * time.Second
+	}
+	return time.Duration(c.Metrics.RedisStatsInterval) * time.Second
+}
+
+// GetActiveUsersSyncInterval returns how often new login events are fed to the active user counts
+func (c *Config) GetActiveUsersSyncInterval() time.Duration {
+	if c.Metrics.ActiveUsersSyncInterval <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.Metrics.ActiveUsersSyncInterval) * time.Second
+}
+
+// GetUniqueIPFlushInterval returns how often the IPs requesting each endpoint are written to Redis
+func (c *Config) GetUniqueIPFlushInterval() time.Duration {
+	if c.Metrics.UniqueIPFlushInterval <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.Metrics.UniqueIPFlushInterval) * time.Second
+}
+
+// GetUniqueIPRetention returns how long the unique IP counts of a day are kept
+func (c *Config) GetUniqueIPRetention() time.Duration {
+	if c.Metrics.UniqueIPRetention <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(c.Metrics.UniqueIPRetention) * 24 * time.Hour
+}
+
+// GetWebhookPollInterval returns how often new domain events are queued for webhooks and due deliveries sent
+func (c *Config) GetWebhookPollInterval() time.Duration {
+	if c.Webhooks.PollInterval <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.Webhooks.PollInterval) * time.Second
+}
+
+// GetWebhookTimeout returns how long a webhook delivery attempt may take
+func (c *Config) GetWebhookTimeout() time.Duration {
+	if c.Webhooks.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.Webhooks.Timeout) * time.Second
+}
+
+// GetMaxPageSize returns the largest page size list requests may ask for
+func (c *Config) GetMaxPageSize() int {
+	if c.Pagination.MaxPageSize <= 0 {
+		return 100
+	}
+	return c.Pagination.MaxPageSize
+}
+
+// GetMaxSearchLength returns the longest search term list requests may give, in characters
+func (c *Config) GetMaxSearchLength() int {
+	if c.Pagination.MaxSearchLength <= 0 {
+		return 50
+	}
+	return c.Pagination.MaxSearchLength
+}
+
+// GetCaptchaTimeout returns how long a CAPTCHA verification may take
+func (c *Config) GetCaptchaTimeout() time.Duration {
+	if c.Captcha.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.Captcha.Timeout) * time.Second
+}
+
+// GetHookTimeout returns how long a call of the hook endpoint may take
+func (c *Config) GetHookTimeout() time.Duration {
+	if c.Hooks.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(c.Hooks.Timeout) * time.Millisecond
+}
+
+// GetPolicyTimeout returns how long an authorization decision may take
+func (c *Config) GetPolicyTimeout() time.Duration {
+	if c.Policy.Timeout <= 0 {
+		return 500 * time.Millisecond
+	}
+	return time.Duration(c.Policy.Timeout) * time.Millisecond
+}
+
+// GetWebhookMaxAttempts returns how often a webhook delivery is attempted before it is given up
+func (c *Config) GetWebhookMaxAttempts() int {
+	if c.Webhooks.MaxAttempts <= 0 {
+		return 8
+	}
+	return c.Webhooks.MaxAttempts
+}
+
+// GetWebhookInitialBackoff returns the delay before the first retry of a failed webhook delivery
+func (c *Config) GetWebhookInitialBackoff() time.Duration {
+	if c.Webhooks.InitialBackoff <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.Webhooks.InitialBackoff) * time.Second
+}
+
+// GetWebhookMaxBackoff returns the longest delay between retries of a webhook delivery
+func (c *Config) GetWebhookMaxBackoff() time.Duration {
+	if c.Webhooks.MaxBackoff <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.Webhooks.MaxBackoff) * time.Second
+}
+
+// GetWebhookMaxEventAge returns how old a domain event may be to still be delivered to webhooks
+func (c *Config) GetWebhookMaxEventAge() time.Duration {
+	if c.Webhooks.MaxEventAge <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.Webhooks.MaxEventAge) * time.Minute
 }
 
 // GetRateLimitDuration returns the rate limit duration as time.Duration
 func (c *Config) GetRateLimitDuration() time.Duration {
-	return time.Duration(c.OTP.RateLimit.Time) * time.Minute
+	return c.OTP.RateLimit.GetWindow()
+}
+
+// GetRouteRateLimit returns the rate limit configured for a route,
+// falling back to the OTP rate limit when the route has none
+func (c *Config) GetRouteRateLimit(route string) RateLimitConfig {
+	if rl, ok := c.RateLimits.Routes[route]; ok {
+		return rl
+	}
+	return c.OTP.RateLimit
+}
+
+// GetSMSProvider returns the configuration of the SMS provider with the given name
+func (c *Config) GetSMSProvider(name string) (SMSProviderConfig, bool) {
+	for _, provider := range c.SMS.Providers {
+		if provider.Name == name {
+			return provider, true
+		}
+	}
+	return SMSProviderConfig{}, false
+}
+
+// GetRestoreWindow returns how long a soft-deleted user can still be restored
+func (c *Config) GetRestoreWindow() time.Duration {
+	return time.Duration(c.Admin.RestoreWindow) * time.Hour
+}
+
+// GetPurgeInterval returns how often users deleted longer ago than the restore window are erased
+func (c *Config) GetPurgeInterval() time.Duration {
+	if c.Admin.PurgeInterval <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.Admin.PurgeInterval) * time.Minute
+}
+
+// MemoryStore reports whether all state is kept in process memory, needing neither Postgres nor Redis
+func (c *Config) MemoryStore() bool {
+	return c.Service.Store == "memory"
+}
+
+// GetOTPStore returns where OTPs are kept: otp.store, or memory if all state is
+func (c *Config) GetOTPStore() string {
+	if c.MemoryStore() {
+		return "memory"
+	}
+	return c.OTP.Store
+}
+
+// GetRateLimitStore returns where rate limit hits are kept: rateLimits.store, or memory if all state is
+func (c *Config) GetRateLimitStore() string {
+	if c.MemoryStore() {
+		return "memory"
+	}
+	return c.RateLimits.Store
+}
+
+// GetOTPCleanupInterval returns how often expired OTPs kept in Postgres or memory are deleted
+func (c *Config) GetOTPCleanupInterval() time.Duration {
+	if c.OTP.CleanupInterval <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.OTP.CleanupInterval) * time.Second
+}
+
+// GetExportTimeout returns how long a user export may take to stream
+func (c *Config) GetExportTimeout() time.Duration {
+	if c.Admin.ExportTimeout <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(c.Admin.ExportTimeout) * time.Second
+}
+
+// GetMigrationSignatureMaxAge returns how old a signed legacy migration batch may be
+func (c *Config) GetMigrationSignatureMaxAge() time.Duration {
+	return time.Duration(c.Migration.SignatureMaxAge) * time.Minute
 }
 
 // GetGracefulShutdownDuration returns the graceful shutdown duration
@@ -146,9 +1169,116 @@ func (c *Config) GetGracefulShutdownDuration() time.Duration {
 	return time.Duration(c.Service.GracefulShutdownSecond) * time.Second
 }
 
-// GetDSN returns the PostgreSQL DSN
+// GetConfigWatchInterval returns how often the config file is checked for changes, or 0 if it isn't
+func (c *Config) GetConfigWatchInterval() time.Duration {
+	if c.Service.ConfigWatchInterval <= 0 {
+		return 0
+	}
+	return time.Duration(c.Service.ConfigWatchInterval) * time.Second
+}
+
+// GetRequestTimeout returns the longest time a request may run, whatever deadline its caller asks for
+func (c *Config) GetRequestTimeout() time.Duration {
+	if c.Service.HTTP.RequestTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(c.Service.HTTP.RequestTimeout) * time.Second
+}
+
+// GetReadHeaderTimeout returns how long the server waits for the headers of a request
+func (c *Config) GetReadHeaderTimeout() time.Duration {
+	if c.Service.HTTP.ReadHeaderTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.Service.HTTP.ReadHeaderTimeout) * time.Second
+}
+
+// GetReadTimeout returns how long the server waits for a whole request, including its body
+func (c *Config) GetReadTimeout() time.Duration {
+	if c.Service.HTTP.ReadTimeout <= 0 {
+		return 15 * time.Second
+	}
+	return time.Duration(c.Service.HTTP.ReadTimeout) * time.Second
+}
+
+// GetWriteTimeout returns how long the server gives a request from reading its headers to writing
+// its response. It defaults to a little over the request timeout, so streams and long-polls
+// ending at the request timeout still get to finish their response.
+func (c *Config) GetWriteTimeout() time.Duration {
+	if c.Service.HTTP.WriteTimeout <= 0 {
+		return c.GetRequestTimeout() + 10*time.Second
+	}
+	return time.Duration(c.Service.HTTP.WriteTimeout) * time.Second
+}
+
+// GetIdleTimeout returns how long keep-alive connections are kept open between requests
+func (c *Config) GetIdleTimeout() time.Duration {
+	if c.Service.HTTP.IdleTimeout <= 0 {
+		return 120 * time.Second
+	}
+	return time.Duration(c.Service.HTTP.IdleTimeout) * time.Second
+}
+
+// GetMaxBodyBytes returns the size of the largest request body accepted
+func (c *Config) GetMaxBodyBytes() int64 {
+	if c.Service.HTTP.MaxBodyBytes <= 0 {
+		return 1 << 20
+	}
+	return int64(c.Service.HTTP.MaxBodyBytes)
+}
+
+// GetRealIPHeader returns the header trusted proxies pass the client IP in
+func (c *Config) GetRealIPHeader() string {
+	if c.Service.HTTP.RealIPHeader == "" {
+		return "X-Forwarded-For"
+	}
+	return c.Service.HTTP.RealIPHeader
+}
+
+// GetWarmupTimeout returns how long a startup warm-up attempt may take, and how long to wait before retrying a failed one
+func (c *Config) GetWarmupTimeout() time.Duration {
+	if c.Service.Warmup.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.Service.Warmup.Timeout) * time.Second
+}
+
+// GetLoadScoreMaxInFlight returns the number of in-flight requests at which the instance counts as fully loaded
+func (c *Config) GetLoadScoreMaxInFlight() int {
+	if c.Service.LoadScore.MaxInFlight <= 0 {
+		return 100
+	}
+	return c.Service.LoadScore.MaxInFlight
+}
+
+// GetLoadScoreMaxLatency returns the dependency latency at which the instance counts as fully loaded
+func (c *Config) GetLoadScoreMaxLatency() time.Duration {
+	if c.Service.LoadScore.MaxLatency <= 0 {
+		return 250 * time.Millisecond
+	}
+	return time.Duration(c.Service.LoadScore.MaxLatency) * time.Millisecond
+}
+
+// GetLoadScoreProbeInterval returns how often dependency latencies are probed for the load score
+func (c *Config) GetLoadScoreProbeInterval() time.Duration {
+	if c.Service.LoadScore.ProbeInterval <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.Service.LoadScore.ProbeInterval) * time.Second
+}
+
+// GetHealthTimeout returns how long each dependency check of the readiness check may take
+func (c *Config) GetHealthTimeout() time.Duration {
+	if c.Service.Health.Timeout <= 0 {
+		return time.Second
+	}
+	return time.Duration(c.Service.Health.Timeout) * time.Millisecond
+}
+
+// GetDSN returns the PostgreSQL DSN. Connections are named after the service,
+// so they can be told apart in pg_stat_activity.
 func (c *Config) GetDSN() string {
-	return fmt.Sprintf(
+	dsn := fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=%s",
 		c.Postgres.Host,
 		c.Postgres.Port,
@@ -158,6 +1288,23 @@ func (c *Config) GetDSN() string {
 		c.Postgres.SSLMode,
 		c.Postgres.TimeZone,
 	)
+	if c.Service.Name != "" {
+		dsn += fmt.Sprintf(" application_name='%s'", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(c.Service.Name))
+	}
+	if c.Postgres.StatementTimeout > 0 {
+		dsn += fmt.Sprintf(" statement_timeout=%d", c.Postgres.StatementTimeout)
+	}
+	return dsn
+}
+
+// GetConnMaxLifetime returns how long a database connection is reused, 0 for as long as it works
+func (c *Config) GetConnMaxLifetime() time.Duration {
+	return time.Duration(c.Postgres.ConnMaxLifetime) * time.Second
+}
+
+// GetQueryTimeout returns how long a repository call may take, 0 for no limit beyond the caller's
+func (c *Config) GetQueryTimeout() time.Duration {
+	return time.Duration(c.Postgres.QueryTimeout) * time.Second
 }
 
 // GetRedisAddr returns the full Redis address
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// envPrefix prefixes the environment variables configuration keys are bound to
+const envPrefix = "OTP"
+
+// Defaults returns the configuration used for keys neither the config file nor the environment
+// set. It runs a single instance against local PostgreSQL and Redis; only jwt.secret must be set.
+func Defaults() *Config {
+	return &Config{
+		Service: ServiceConfig{
+			Name:                   "otp-auth-service",
+			Env:                    "production",
+			GracefulShutdownSecond: 5,
+			Store:                  "external",
+			HTTP: HTTPConfig{
+				Port:              "8080",
+				RequestTimeout:    30,
+				ReadHeaderTimeout: 5,
+				ReadTimeout:       15,
+				IdleTimeout:       120,
+				MaxBodyBytes:      1 << 20,
+				RealIPHeader:      "X-Forwarded-For",
+			},
+			Warmup:    WarmupConfig{Enabled: true, PostgresConnections: 5, RedisConnections: 5, Timeout: 10},
+			LoadScore: LoadScoreConfig{MaxInFlight: 100, MaxLatency: 250, ProbeInterval: 5},
+			Health:    HealthConfig{Timeout: 1000},
+		},
+		Postgres: DatabaseConfig{
+			Host:          "localhost",
+			Port:          "5432",
+			User:          "postgres",
+			DatabaseName:  "otpauth",
+			SSLMode:       "disable",
+			TimeZone:      "UTC",
+			SchemaCheck:   "warn",
+			MigrationsDir: "migrations",
+			MaxIdleConns:  2,
+			QueryTimeout:  30,
+		},
+		Redis:    RedisConfig{Host: "localhost", Port: "6379"},
+		DynamoDB: DynamoDBConfig{Table: "otp-auth", Timeout: 2},
+		JWT:      JWTConfig{ExpirationHours: 24, KMS: JWTKMSConfig{Timeout: 2}},
+		Sessions: SessionConfig{MaxConcurrent: 5, Expiration: 30},
+		OTP: OTPConfig{
+			Expiration:       120,
+			ExpirationJitter: 15,
+			Length:           6,
+			ResendCooldown:   60,
+			RateLimit:        RateLimitConfig{Algorithm: "sliding_window", Count: 3, Time: 10},
+			Lockout:          LockoutConfig{MaxAttempts: 5, Window: 15, Cooldown: 30},
+			VerifyLock:       VerifyLockConfig{TTL: 10, Wait: 3000},
+			BackupCodes:      BackupCodeConfig{Count: 10, Length: 10},
+			TrustedDevices:   TrustedDeviceConfig{Expiration: 30},
+			Channels:         OTPChannelsConfig{Duplicates: "reuse"},
+			Store:            "redis",
+			CleanupInterval:  300,
+		},
+		Email:      EmailConfig{Port: 587, From: "no-reply@localhost", Subject: "Your verification code", Timeout: 10},
+		FlashCall:  FlashCallConfig{Provider: "log", Timeout: 10},
+		SilentAuth: SilentAuthConfig{Provider: "none", Header: "X-MSISDN", Timeout: 5},
+		SMS: SMSConfig{
+			Failover: SMSFailoverConfig{Timeout: 10, Window: 60, MinFailures: 5, ErrorRate: 0.5, Quarantine: 60},
+			Queue: SMSQueueConfig{
+				Workers:        4,
+				MaxLength:      10000,
+				MaxAttempts:    3,
+				InitialBackoff: 2,
+				MaxBackoff:     30,
+				PollInterval:   1,
+				DeadLetterSize: 1000,
+			},
+			Overflow: SMSOverflowConfig{MaxLength: 1000},
+		},
+		Concurrency: ConcurrencyConfig{
+			Redis:          AdaptiveLimitConfig{Enabled: true, InitialLimit: 50, MinLimit: 10, MaxLimit: 500, LatencyThreshold: 20, BackoffRatio: 0.9},
+			Postgres:       AdaptiveLimitConfig{Enabled: true, InitialLimit: 20, MinLimit: 5, MaxLimit: 100, LatencyThreshold: 100, BackoffRatio: 0.9},
+			CircuitBreaker: CircuitBreakerConfig{Enabled: true, Failures: 5, OpenTimeout: 10},
+		},
+		RateLimits:    RateLimitsConfig{WarningThreshold: 80, Store: "redis", FailurePolicy: "closed"},
+		Metrics:       MetricsConfig{RedisStatsInterval: 15, ActiveUsersSyncInterval: 5, UniqueIPFlushInterval: 5, UniqueIPRetention: 7},
+		Admin:         AdminConfig{RestoreWindow: 720, PurgeInterval: 60, ExportTimeout: 600},
+		Migration:     MigrationConfig{MaxBatchSize: 500, SignatureMaxAge: 10},
+		TokenExchange: TokenExchangeConfig{Expiration: 5},
+		Captcha:       CaptchaConfig{Timeout: 5, Threshold: RateLimitConfig{Count: 3, Time: 60}},
+		Pagination:    PaginationConfig{MaxPageSize: 100, MaxSearchLength: 50},
+		Webhooks: WebhooksConfig{
+			PollInterval:   5,
+			Timeout:        10,
+			MaxAttempts:    8,
+			InitialBackoff: 10,
+			MaxBackoff:     3600,
+			MaxEventAge:    60,
+		},
+		Hooks:       HooksConfig{Timeout: 2000},
+		Policy:      PolicyConfig{Path: "otpauth/authz", Timeout: 500},
+		Maintenance: MaintenanceConfig{CacheTTL: 5},
+		Logging:     LoggingConfig{Level: "info", Format: "json"},
+	}
+}
+
+// EnvVar returns the environment variable a configuration key is bound to,
+// e.g. OTP_POSTGRES_DATABASE_NAME for postgres.databaseName
+func EnvVar(key string) string {
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for _, part := range strings.Split(key, ".") {
+		b.WriteByte('_')
+		runes := []rune(part)
+		for i, r := range runes {
+			// Words start at an upper-case letter following a lower-case letter or digit,
+			// or at the last upper-case letter of an acronym followed by a lower-case letter
+			if i > 0 && unicode.IsUpper(r) && (!unicode.IsUpper(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// setDefaultsAndEnv registers the defaults of every configuration key with viper and binds
+// each key to its environment variable. Lists of objects and maps, such as sms.providers,
+// are read from their environment variable as JSON.
+func setDefaultsAndEnv() {
+	walkKeys("", reflect.ValueOf(Defaults()).Elem(), func(key string, value reflect.Value) {
+		kind := value.Kind()
+		if kind == reflect.Map || (kind == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct) {
+			raw := os.Getenv(EnvVar(key))
+			if raw == "" {
+				return
+			}
+			var parsed any
+			if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+				log.Panicf("Error parsing %s as JSON: %v", EnvVar(key), err)
+			}
+			viper.Set(key, parsed)
+			return
+		}
+
+		// Lists of strings are read as comma-separated values
+		viper.SetDefault(key, value.Interface())
+		if err := viper.BindEnv(key, EnvVar(key)); err != nil {
+			log.Panicf("Error binding %s: %v", EnvVar(key), err)
+		}
+	})
+}
+
+// walkKeys calls visit with the key and value of every field of v that isn't a struct itself
+func walkKeys(prefix string, v reflect.Value, visit func(key string, value reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag.Get("mapstructure")
+		if tag == "" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		if field := v.Field(i); field.Kind() == reflect.Struct {
+			walkKeys(key, field, visit)
+		} else {
+			visit(key, field)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Provider provides the current configuration. Services read reloadable settings from it on
+// each use, rather than once at startup, so they pick up reloads.
+type Provider interface {
+	Current() *Config
+}
+
+// Current returns c itself, so a fixed configuration is a Provider
+func (c *Config) Current() *Config {
+	return c
+}
+
+// Reloader is a Provider whose configuration is reloaded from the config file and environment
+// variables on demand. Reloads only apply settings that don't shape the service's structure:
+// OTP length, expiration and lockout, the limits of rate limits, the log level, deprecated routes
+// and SMS provider callback tokens. Changes to other settings are logged and apply on the next restart.
+type Reloader struct {
+	setup   *ConfigSetup
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex // serializes reloads, as viper isn't safe for concurrent use
+	listeners []func(*Config)
+}
+
+// NewReloader creates a reloader starting from cfg, as loaded by LoadConfig
+func NewReloader(cfg *Config) *Reloader {
+	r := &Reloader{setup: defaultConfigSetup()}
+	r.current.Store(cfg)
+	return r
+}
+
+// Current returns the current configuration. It must not be modified.
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// OnReload registers fn to be called with the new configuration after each reload, e.g. to
+// apply settings read once into longer-lived objects
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Reload reloads the configuration, keeping the current one if the new one is invalid
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loaded, err := r.setup.load()
+	if err != nil {
+		return err
+	}
+
+	// Copy the current configuration, replacing slices and maps rather than modifying
+	// them, as readers of the current configuration share them
+	next := *r.current.Load()
+	next.applyReloadable(loaded)
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if sections := changedSections(&next, loaded); len(sections) > 0 {
+		log.Printf("Config changes to %s need a restart to apply", strings.Join(sections, ", "))
+	}
+
+	r.current.Store(&next)
+	for _, fn := range r.listeners {
+		fn(&next)
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever the config file changes, checking every interval
+// until ctx is done. Reload errors are logged, keeping the current configuration.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := r.fileVersion()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Stat follows symlinks, so ConfigMaps swapped in by Kubernetes are picked up too
+		if version := r.fileVersion(); version != last {
+			last = version
+			if err := r.Reload(); err != nil {
+				log.Printf("Error reloading config: %v", err)
+			} else {
+				log.Printf("Reloaded config file %s", r.setup.path)
+			}
+		}
+	}
+}
+
+// fileVersion identifies the current version of the config file by its size and modification time
+func (r *Reloader) fileVersion() string {
+	info, err := os.Stat(r.setup.path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// applyReloadable copies the settings that can change at runtime from loaded
+func (c *Config) applyReloadable(loaded *Config) {
+	c.OTP.Length = loaded.OTP.Length
+	c.OTP.Expiration = loaded.OTP.Expiration
+	c.OTP.ExpirationJitter = loaded.OTP.ExpirationJitter
+	c.OTP.ResendCooldown = loaded.OTP.ResendCooldown
+	c.OTP.Lockout = loaded.OTP.Lockout
+	c.Logging.Level = loaded.Logging.Level
+	c.Service.HTTP.Deprecations = loaded.Service.HTTP.Deprecations
+
+	// Rate limits keep their algorithm, as each has its own limiter
+	c.OTP.RateLimit = reloadRateLimit(c.OTP.RateLimit, loaded.OTP.RateLimit)
+	c.Captcha.Threshold = reloadRateLimit(c.Captcha.Threshold, loaded.Captcha.Threshold)
+	if c.RateLimits.Routes != nil {
+		routes := make(map[string]RateLimitConfig, len(c.RateLimits.Routes))
+		for route, rl := range c.RateLimits.Routes {
+			routes[route] = rl
+			if reloaded, ok := loaded.RateLimits.Routes[route]; ok {
+				routes[route] = reloadRateLimit(rl, reloaded)
+			}
+		}
+		c.RateLimits.Routes = routes
+	}
+
+	// Providers can't be added or removed, but their callback tokens can be rotated
+	if c.SMS.Providers != nil {
+		providers := make([]SMSProviderConfig, len(c.SMS.Providers))
+		for i, provider := range c.SMS.Providers {
+			providers[i] = provider
+			if reloaded, ok := loaded.GetSMSProvider(provider.Name); ok {
+				providers[i].CallbackToken = reloaded.CallbackToken
+			}
+		}
+		c.SMS.Providers = providers
+	}
+}
+
+// reloadRateLimit returns rl with the count and time of loaded
+func reloadRateLimit(rl, loaded RateLimitConfig) RateLimitConfig {
+	rl.Count = loaded.Count
+	rl.Time = loaded.Time
+	return rl
+}
+
+// changedSections returns the top-level keys of the sections whose settings differ
+func changedSections(c, other *Config) []string {
+	var sections []string
+	a, b := reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			sections = append(sections, a.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return sections
+}
@@ -0,0 +1,317 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+)
+
+func TestEnvVar(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"postgres.host", "OTP_POSTGRES_HOST"},
+		{"postgres.databaseName", "OTP_POSTGRES_DATABASE_NAME"},
+		{"otp.rateLimit.count", "OTP_OTP_RATE_LIMIT_COUNT"},
+		{"sms.providers", "OTP_SMS_PROVIDERS"},
+		{"captcha.verifyURL", "OTP_CAPTCHA_VERIFY_URL"},
+		{"jwt.kms.keyId", "OTP_JWT_KMS_KEY_ID"},
+		{"service.http.port", "OTP_SERVICE_HTTP_PORT"},
+	}
+	for _, tt := range tests {
+		if got := config.EnvVar(tt.key); got != tt.want {
+			t.Errorf("EnvVar(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultsNeedOnlyASecret(t *testing.T) {
+	cfg := config.Defaults()
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "OTP_JWT_SECRET") {
+		t.Fatalf("expected the missing JWT secret to be reported, got %v", err)
+	}
+
+	cfg.JWT.Secret = "secret"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected the defaults to be valid, got %v", err)
+	}
+}
+
+func TestValidateKMSReplacesSecret(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.KMS.Provider = "gcp"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "jwt.kms.keyId") {
+		t.Fatalf("expected the missing key to be reported, got %v", err)
+	}
+
+	cfg.JWT.KMS.KeyID = "projects/p/locations/global/keyRings/r/cryptoKeys/jwt/cryptoKeyVersions/1"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected a KMS key to stand in for the secret, got %v", err)
+	}
+}
+
+func TestValidateRedisTLS(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.Redis.TLS.CertFile = "client.pem"
+	cfg.Redis.Shards = []config.RedisShardConfig{{Name: "eu-1", Host: "redis-eu-1", Port: "6379", TLS: config.RedisTLSConfig{Enabled: true, CertFile: "client.pem"}}}
+
+	err := cfg.Validate()
+	for _, key := range []string{"redis.tls.keyFile", "redis.tls.enabled", "redis.shards[0].tls.keyFile"} {
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Fatalf("expected %s to be reported, got %v", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "redis.shards[0].tls.enabled") {
+		t.Fatalf("expected the enabled shard TLS not to be reported, got %v", err)
+	}
+
+	cfg.Redis.TLS = config.RedisTLSConfig{Enabled: true, CertFile: "client.pem", KeyFile: "client-key.pem"}
+	cfg.Redis.Shards[0].TLS.KeyFile = "client-key.pem"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected a valid TLS configuration, got %v", err)
+	}
+}
+
+func TestValidateRateLimitPolicies(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.RateLimits.Policies = []config.RateLimitPolicyConfig{
+		{Name: "verify", Route: "POST /v1/auth/verify-otp", Key: "ip", Count: 5, Time: 1},
+		{Name: "verify", Route: "v1/auth/request-otp", Key: "device", Count: 5, Time: 1},
+	}
+
+	err := cfg.Validate()
+	for _, key := range []string{"rateLimits.policies[1].name", "rateLimits.policies[1].route", "rateLimits.policies[1].key"} {
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Fatalf("expected %s to be reported, got %v", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "rateLimits.policies[0]") {
+		t.Fatalf("expected the first policy to be valid, got %v", err)
+	}
+}
+
+func TestValidateOverflowTenants(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.SMS.Overflow.Tenants = map[string]config.SMSOverflowTenantConfig{
+		"shop":     {Enabled: true, MaxLength: 10},
+		"shop/eu":  {Enabled: true},
+		"bank-eu1": {MaxLength: -1},
+	}
+
+	err := cfg.Validate()
+	for _, key := range []string{"sms.overflow.tenants (", "sms.overflow.tenants.shop/eu", "sms.overflow.tenants.bank-eu1.maxLength"} {
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Fatalf("expected %s to be reported, got %v", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "sms.overflow.tenants.shop (") {
+		t.Fatalf("expected shop's policy to be valid, got %v", err)
+	}
+
+	cfg.Service.HTTP.TenantHeader = "X-Tenant"
+	delete(cfg.SMS.Overflow.Tenants, "shop/eu")
+	delete(cfg.SMS.Overflow.Tenants, "bank-eu1")
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected the tenants to be valid, got %v", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.Postgres.Host = ""
+	cfg.Redis.Port = "redis"
+	cfg.OTP.Length = 0
+	cfg.OTP.RateLimit.Algorithm = "leaky_bucket"
+	cfg.RateLimits.Routes = map[string]config.RateLimitConfig{"/api/auth/verify-otp": {Count: 5}}
+	cfg.Captcha.Provider = "recaptcha"
+	cfg.Logging.Level = "verbose"
+
+	err := cfg.Validate()
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	want := []string{
+		"postgres.host (OTP_POSTGRES_HOST) is required",
+		`redis.port (OTP_REDIS_PORT) must be a port number, got "redis"`,
+		"otp.length (OTP_OTP_LENGTH) must be between 4 and 10, got 0",
+		"otp.rateLimit.algorithm (OTP_OTP_RATE_LIMIT_ALGORITHM) must be one of",
+		"rateLimits.routes./api/auth/verify-otp.time",
+		"captcha.secret (OTP_CAPTCHA_SECRET) is required",
+		"logging.level (OTP_LOGGING_LEVEL) must be one of",
+	}
+	if len(validationErr.Problems) != len(want) {
+		t.Fatalf("expected %d problems, got %q", len(want), validationErr.Problems)
+	}
+	for i, problem := range validationErr.Problems {
+		if !strings.HasPrefix(problem, want[i]) {
+			t.Errorf("problem %d = %q, want prefix %q", i, problem, want[i])
+		}
+	}
+}
+
+func TestValidateRejectsDuplicateNames(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.SMS.Providers = []config.SMSProviderConfig{
+		{Name: "twilio", Type: "twilio"},
+		{Name: "twilio", Type: "mock"},
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "sms.providers[1].name") {
+		t.Fatalf("expected the duplicate provider to be reported, got %v", err)
+	}
+}
+
+func TestValidateHTTPServer(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.Service.HTTP.WriteTimeout = 20
+	cfg.Service.HTTP.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1", "proxy.internal"}
+	cfg.Service.HTTP.RealIPHeader = "X-Real-IP: "
+	cfg.Service.HTTP.TLS.CertFile = "/etc/otp-auth/tls.crt"
+	cfg.Service.HTTP.TLS.Autocert = config.AutocertConfig{Enabled: true, HTTPPort: "http"}
+
+	err := cfg.Validate()
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	want := []string{
+		"service.http.writeTimeout (OTP_SERVICE_HTTP_WRITE_TIMEOUT) must be longer than service.http.requestTimeout",
+		`service.http.trustedProxies (OTP_SERVICE_HTTP_TRUSTED_PROXIES) must list IP addresses or CIDRs, got "proxy.internal"`,
+		`service.http.realIPHeader (OTP_SERVICE_HTTP_REAL_IP_HEADER) must be a header name, got "X-Real-IP: "`,
+		"service.http.tls.keyFile (OTP_SERVICE_HTTP_TLS_KEY_FILE) must be set together with certFile",
+		"service.http.tls.autocert.enabled (OTP_SERVICE_HTTP_TLS_AUTOCERT_ENABLED) cannot be combined with certFile",
+		"service.http.tls.autocert.domains (OTP_SERVICE_HTTP_TLS_AUTOCERT_DOMAINS) is required",
+		"service.http.tls.autocert.cacheDir (OTP_SERVICE_HTTP_TLS_AUTOCERT_CACHE_DIR) is required",
+		`service.http.tls.autocert.httpPort (OTP_SERVICE_HTTP_TLS_AUTOCERT_HTTP_PORT) must be a port number, got "http"`,
+	}
+	if len(validationErr.Problems) != len(want) {
+		t.Fatalf("expected %d problems, got %q", len(want), validationErr.Problems)
+	}
+	for i, problem := range validationErr.Problems {
+		if !strings.HasPrefix(problem, want[i]) {
+			t.Errorf("problem %d = %q, want prefix %q", i, problem, want[i])
+		}
+	}
+
+	// The write timeout defaults to outlasting the request timeout
+	cfg = config.Defaults()
+	if cfg.GetWriteTimeout() <= cfg.GetRequestTimeout() {
+		t.Fatalf("expected the default write timeout %v to be longer than the request timeout %v", cfg.GetWriteTimeout(), cfg.GetRequestTimeout())
+	}
+}
+
+func TestValidateDeprecations(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.Service.HTTP.Deprecations = []config.DeprecationConfig{
+		{Route: "GET /v1/auth/otp-status/:challenge_id", Since: "2026-10-16", Sunset: "2027-05-01"},
+		{Route: "/v1/auth/otp-status", Since: "16/10/2026", Sunset: "2026-10-16"},
+		{Route: "GET /v1/auth/otp-status/:challenge_id", Since: "2026-10-16", Sunset: "2026-10-16"},
+	}
+
+	err := cfg.Validate()
+	for _, key := range []string{
+		"service.http.deprecations[1].route", "service.http.deprecations[1].since",
+		"service.http.deprecations[2].route", "service.http.deprecations[2].sunset",
+	} {
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Fatalf("expected %s to be reported, got %v", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "service.http.deprecations[0]") {
+		t.Fatalf("expected the first deprecation to be valid, got %v", err)
+	}
+
+	since := cfg.Service.HTTP.Deprecations[0].GetSince()
+	if want := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC); !since.Equal(want) {
+		t.Fatalf("GetSince() = %v, want %v", since, want)
+	}
+	if sunset := (config.DeprecationConfig{Since: "2026-10-16"}).GetSunset(); !sunset.IsZero() {
+		t.Fatalf("expected no sunset, got %v", sunset)
+	}
+}
+
+func TestValidateMemoryStore(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.Service.Store = "memory"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected the defaults to run in memory, got %v", err)
+	}
+	// Keeping all state in memory overrides the stores of OTPs and rate limits
+	if cfg.GetOTPStore() != "memory" || cfg.GetRateLimitStore() != "memory" {
+		t.Fatalf("expected OTPs and rate limits kept in memory, got %q and %q", cfg.GetOTPStore(), cfg.GetRateLimitStore())
+	}
+
+	cfg.Redis.Shards = []config.RedisShardConfig{{Name: "a", Host: "redis-a", Port: "6379"}}
+	cfg.Redis.Regions = []config.RedisShardConfig{{Name: "eu", Host: "redis-eu", Port: "6379"}}
+	cfg.Redis.Region = "us"
+	cfg.DynamoDB = config.DynamoDBConfig{Enabled: true, Region: "eu-west-1"}
+	cfg.OTP.Store = "postgres"
+	err := cfg.Validate()
+	for _, key := range []string{"redis.shards", "redis.regions", "dynamodb.enabled", "otp.store"} {
+		if err == nil || !strings.Contains(err.Error(), key+" (") {
+			t.Fatalf("expected %s to be reported, got %v", key, err)
+		}
+	}
+
+	cfg = config.Defaults()
+	if cfg.MemoryStore() || cfg.GetOTPStore() != "redis" || cfg.GetRateLimitStore() != "redis" {
+		t.Fatalf("expected state kept in Postgres and Redis by default")
+	}
+}
+
+func TestValidateSenderIDs(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.Secret = "secret"
+	cfg.SMS.Providers = []config.SMSProviderConfig{{
+		Name: "kavenegar",
+		Type: "log",
+		SenderIDs: []config.SMSSenderIDConfig{
+			{Prefix: "+98", IDs: []string{"3000123"}},
+			{Prefix: "98", IDs: []string{"OTPAuth"}},
+			{Prefix: "+98"},
+		},
+	}}
+
+	err := cfg.Validate()
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	want := []string{
+		`sms.providers[0].senderIds[1].prefix (OTP_SMS_PROVIDERS[0]_SENDER_IDS[1]_PREFIX) must be + followed by digits, got "98"`,
+		`sms.providers[0].senderIds[2].prefix (OTP_SMS_PROVIDERS[0]_SENDER_IDS[2]_PREFIX) must be unique, "+98" is used twice`,
+		"sms.providers[0].senderIds[2].ids (OTP_SMS_PROVIDERS[0]_SENDER_IDS[2]_IDS) is required",
+	}
+	if len(validationErr.Problems) != len(want) {
+		t.Fatalf("expected %d problems, got %q", len(want), validationErr.Problems)
+	}
+	for i, problem := range validationErr.Problems {
+		if problem != want[i] {
+			t.Errorf("problem %d = %q, want %q", i, problem, want[i])
+		}
+	}
+}
+
+func TestDSNStatementTimeout(t *testing.T) {
+	cfg := config.Defaults()
+	if dsn := cfg.GetDSN(); strings.Contains(dsn, "statement_timeout") {
+		t.Fatalf("expected no statement timeout by default, got %q", dsn)
+	}
+	cfg.Postgres.StatementTimeout = 5000
+	if dsn := cfg.GetDSN(); !strings.HasSuffix(dsn, " statement_timeout=5000") {
+		t.Fatalf("expected a 5s statement timeout, got %q", dsn)
+	}
+}
@@ -0,0 +1,466 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/tenant"
+)
+
+// callerPrefixPattern matches the numbers flash calls are placed from, before the OTP
+var callerPrefixPattern = regexp.MustCompile(`^\+?[0-9]+$`)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// validator collects the problems of a configuration
+type validator struct {
+	problems []string
+}
+
+// fail records a problem with key, naming its environment variable
+func (v *validator) fail(key, format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf("%s (%s) %s", key, EnvVar(key), fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) required(key, value string) {
+	if value == "" {
+		v.fail(key, "is required")
+	}
+}
+
+func (v *validator) port(key, value string) {
+	if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+		v.fail(key, "must be a port number, got %q", value)
+	}
+}
+
+func (v *validator) positive(key string, value int) {
+	if value <= 0 {
+		v.fail(key, "must be positive, got %d", value)
+	}
+}
+
+func (v *validator) notNegative(key string, value int) {
+	if value < 0 {
+		v.fail(key, "cannot be negative, got %d", value)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) rateLimit(key string, rl RateLimitConfig) {
+	v.oneOf(key+".algorithm", rl.Algorithm, "", "fixed_window", "sliding_window", "token_bucket")
+	v.positive(key+".count", rl.Count)
+	v.positive(key+".time", rl.Time)
+}
+
+func (v *validator) redisInstances(key string, instances []RedisShardConfig) {
+	names := make(map[string]bool)
+	for i, instance := range instances {
+		instanceKey := fmt.Sprintf("%s[%d]", key, i)
+		v.required(instanceKey+".name", instance.Name)
+		v.required(instanceKey+".host", instance.Host)
+		v.port(instanceKey+".port", instance.Port)
+		v.redisTLS(instanceKey+".tls", instance.TLS)
+		if names[instance.Name] {
+			v.fail(instanceKey+".name", "must be unique, %q is used twice", instance.Name)
+		}
+		names[instance.Name] = true
+	}
+}
+
+func (v *validator) redisTLS(key string, tls RedisTLSConfig) {
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		v.fail(key+".keyFile", "must be set together with certFile")
+	}
+	if !tls.Enabled && (tls.CAFile != "" || tls.CertFile != "" || tls.InsecureSkipVerify) {
+		v.fail(key+".enabled", "must be set to use the other TLS settings")
+	}
+}
+
+func (v *validator) adaptiveLimit(key string, limit AdaptiveLimitConfig) {
+	if !limit.Enabled {
+		return
+	}
+	v.positive(key+".minLimit", limit.MinLimit)
+	if limit.InitialLimit < limit.MinLimit || limit.InitialLimit > limit.MaxLimit {
+		v.fail(key+".initialLimit", "must be between minLimit and maxLimit, got %d", limit.InitialLimit)
+	}
+	if limit.BackoffRatio <= 0 || limit.BackoffRatio >= 1 {
+		v.fail(key+".backoffRatio", "must be between 0 and 1, got %g", limit.BackoffRatio)
+	}
+}
+
+func (v *validator) networks(key string, values []string) {
+	for _, value := range values {
+		if _, _, err := net.ParseCIDR(value); err != nil && net.ParseIP(value) == nil {
+			v.fail(key, "must list IP addresses or CIDRs, got %q", value)
+		}
+	}
+}
+
+func (v *validator) headerName(key, value string) {
+	if strings.ContainsAny(value, " \t:,") {
+		v.fail(key, "must be a header name, got %q", value)
+	}
+}
+
+func (v *validator) senderIDs(key string, senderIDs []SMSSenderIDConfig) {
+	prefixes := make(map[string]bool)
+	for i, senderID := range senderIDs {
+		entryKey := fmt.Sprintf("%s[%d]", key, i)
+		if senderID.Prefix != "" && !validPrefix(senderID.Prefix) {
+			v.fail(entryKey+".prefix", "must be + followed by digits, got %q", senderID.Prefix)
+		}
+		if prefixes[senderID.Prefix] {
+			v.fail(entryKey+".prefix", "must be unique, %q is used twice", senderID.Prefix)
+		}
+		prefixes[senderID.Prefix] = true
+		if len(senderID.IDs) == 0 {
+			v.fail(entryKey+".ids", "is required")
+		}
+		for _, id := range senderID.IDs {
+			if id == "" {
+				v.fail(entryKey+".ids", "cannot contain empty sender IDs")
+			}
+		}
+	}
+}
+
+// validPrefix reports whether prefix is + followed by at least one digit, like phone numbers in E.164 format
+func validPrefix(prefix string) bool {
+	if len(prefix) < 2 || prefix[0] != '+' {
+		return false
+	}
+	for _, r := range prefix[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *validator) tls(key string, tls TLSConfig) {
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		v.fail(key+".keyFile", "must be set together with certFile")
+	}
+	if !tls.Autocert.Enabled {
+		return
+	}
+	if tls.CertFile != "" {
+		v.fail(key+".autocert.enabled", "cannot be combined with certFile")
+	}
+	if len(tls.Autocert.Domains) == 0 {
+		v.fail(key+".autocert.domains", "is required")
+	}
+	// Without a cache, certificates are requested again on every restart and run into Let's Encrypt's rate limits
+	v.required(key+".autocert.cacheDir", tls.Autocert.CacheDir)
+	if tls.Autocert.HTTPPort != "" {
+		v.port(key+".autocert.httpPort", tls.Autocert.HTTPPort)
+	}
+}
+
+func (v *validator) deprecations(key string, deprecations []DeprecationConfig) {
+	routes := make(map[string]bool)
+	for i, deprecation := range deprecations {
+		key := fmt.Sprintf("%s[%d]", key, i)
+		if method, path, _ := strings.Cut(deprecation.Route, " "); method == "" || !strings.HasPrefix(path, "/") {
+			v.fail(key+".route", `must be "METHOD /path", got %q`, deprecation.Route)
+		}
+		if routes[deprecation.Route] {
+			v.fail(key+".route", "must be unique, %q is used twice", deprecation.Route)
+		}
+		routes[deprecation.Route] = true
+
+		since, err := time.Parse(DeprecationDateLayout, deprecation.Since)
+		if err != nil {
+			v.fail(key+".since", "must be a date like 2026-10-16, got %q", deprecation.Since)
+		}
+		if deprecation.Sunset == "" {
+			continue
+		}
+		sunset, err := time.Parse(DeprecationDateLayout, deprecation.Sunset)
+		switch {
+		case err != nil:
+			v.fail(key+".sunset", "must be a date like 2027-05-01, got %q", deprecation.Sunset)
+		case !sunset.After(since):
+			v.fail(key+".sunset", "must be after since, got %q", deprecation.Sunset)
+		}
+	}
+}
+
+// Validate reports every missing or invalid setting at once, so misconfigurations
+// are caught at startup rather than when a request first depends on them
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.port("service.http.port", c.Service.HTTP.Port)
+	v.notNegative("service.http.requestTimeout", c.Service.HTTP.RequestTimeout)
+	v.notNegative("service.http.readHeaderTimeout", c.Service.HTTP.ReadHeaderTimeout)
+	v.notNegative("service.http.readTimeout", c.Service.HTTP.ReadTimeout)
+	v.notNegative("service.http.writeTimeout", c.Service.HTTP.WriteTimeout)
+	v.notNegative("service.http.idleTimeout", c.Service.HTTP.IdleTimeout)
+	v.notNegative("service.http.maxBodyBytes", c.Service.HTTP.MaxBodyBytes)
+	// Responses of requests running up to the request timeout would be cut off
+	if c.Service.HTTP.WriteTimeout > 0 && float64(c.Service.HTTP.WriteTimeout) <= c.GetRequestTimeout().Seconds() {
+		v.fail("service.http.writeTimeout", "must be longer than service.http.requestTimeout, got %d", c.Service.HTTP.WriteTimeout)
+	}
+	v.networks("service.http.trustedProxies", c.Service.HTTP.TrustedProxies)
+	v.headerName("service.http.realIPHeader", c.GetRealIPHeader())
+	v.headerName("service.http.countryHeader", c.Service.HTTP.CountryHeader)
+	v.headerName("service.http.tenantHeader", c.Service.HTTP.TenantHeader)
+	v.tls("service.http.tls", c.Service.HTTP.TLS)
+	v.deprecations("service.http.deprecations", c.Service.HTTP.Deprecations)
+	v.notNegative("service.gracefulShutdownSecond", c.Service.GracefulShutdownSecond)
+	v.notNegative("service.configWatchInterval", c.Service.ConfigWatchInterval)
+	v.oneOf("service.store", c.Service.Store, "", "external", "memory")
+	if c.MemoryStore() {
+		// Process memory is neither shared between instances nor another store
+		if len(c.Redis.Shards) > 0 {
+			v.fail("redis.shards", "cannot be combined with service.store memory")
+		}
+		if len(c.Redis.Regions) > 0 {
+			v.fail("redis.regions", "cannot be combined with service.store memory")
+		}
+		if c.DynamoDB.Enabled {
+			v.fail("dynamodb.enabled", "cannot be combined with service.store memory")
+		}
+		if c.OTP.Store == "postgres" {
+			v.fail("otp.store", "cannot be postgres with service.store memory")
+		}
+	}
+	v.notNegative("service.health.timeout", c.Service.Health.Timeout)
+
+	v.required("postgres.host", c.Postgres.Host)
+	v.port("postgres.port", c.Postgres.Port)
+	v.required("postgres.user", c.Postgres.User)
+	v.required("postgres.databaseName", c.Postgres.DatabaseName)
+	v.oneOf("postgres.sslMode", c.Postgres.SSLMode, "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	v.oneOf("postgres.schemaCheck", c.Postgres.SchemaCheck, "", "off", "warn", "fail")
+	v.notNegative("postgres.maxOpenConns", c.Postgres.MaxOpenConns)
+	v.notNegative("postgres.maxIdleConns", c.Postgres.MaxIdleConns)
+	v.notNegative("postgres.connMaxLifetime", c.Postgres.ConnMaxLifetime)
+	v.notNegative("postgres.statementTimeout", c.Postgres.StatementTimeout)
+	v.notNegative("postgres.queryTimeout", c.Postgres.QueryTimeout)
+
+	v.required("redis.host", c.Redis.Host)
+	v.port("redis.port", c.Redis.Port)
+	v.notNegative("redis.db", c.Redis.DB)
+	v.redisTLS("redis.tls", c.Redis.TLS)
+	v.redisInstances("redis.shards", c.Redis.Shards)
+	v.redisInstances("redis.regions", c.Redis.Regions)
+	if len(c.Redis.Regions) > 0 {
+		v.required("redis.region", c.Redis.Region)
+	}
+
+	if c.DynamoDB.Enabled {
+		v.required("dynamodb.region", c.DynamoDB.Region)
+	}
+	v.oneOf("otp.store", c.OTP.Store, "", "redis", "postgres", "memory")
+	v.notNegative("otp.cleanupInterval", c.OTP.CleanupInterval)
+
+	v.positive("jwt.expirationHours", c.JWT.ExpirationHours)
+	v.oneOf("jwt.kms.provider", c.JWT.KMS.Provider, "", "aws", "gcp")
+	if c.JWT.KMS.Provider == "" {
+		v.required("jwt.secret", c.JWT.Secret)
+	} else {
+		v.required("jwt.kms.keyId", c.JWT.KMS.KeyID)
+	}
+	if c.JWT.KMS.Provider == "aws" {
+		v.required("jwt.kms.region", c.JWT.KMS.Region)
+	}
+
+	v.notNegative("sessions.maxConcurrent", c.Sessions.MaxConcurrent)
+	v.oneOf("sessions.countryConflicts", c.Sessions.CountryConflicts, "", CountryConflictsAllow, CountryConflictsNotify, CountryConflictsDeny)
+
+	v.positive("otp.expiration", c.OTP.Expiration)
+	v.notNegative("otp.expirationJitter", c.OTP.ExpirationJitter)
+	if c.OTP.Length < 4 || c.OTP.Length > 10 {
+		v.fail("otp.length", "must be between 4 and 10, got %d", c.OTP.Length)
+	}
+	v.notNegative("otp.resendCooldown", c.OTP.ResendCooldown)
+	v.rateLimit("otp.rateLimit", c.OTP.RateLimit)
+	v.notNegative("otp.lockout.maxAttempts", c.OTP.Lockout.MaxAttempts)
+	if c.OTP.Lockout.MaxAttempts > 0 {
+		v.positive("otp.lockout.window", c.OTP.Lockout.Window)
+		v.positive("otp.lockout.cooldown", c.OTP.Lockout.Cooldown)
+	}
+	v.notNegative("otp.verifyLock.ttl", c.OTP.VerifyLock.TTL)
+	v.notNegative("otp.verifyLock.wait", c.OTP.VerifyLock.Wait)
+	for route, rl := range c.RateLimits.Routes {
+		v.rateLimit("rateLimits.routes."+route, rl)
+	}
+	v.oneOf("rateLimits.store", c.RateLimits.Store, "", "redis", "memory")
+	v.oneOf("rateLimits.failurePolicy", c.RateLimits.FailurePolicy, "", "closed", "open", "local")
+	policyNames := make(map[string]bool)
+	for i, policy := range c.RateLimits.Policies {
+		key := fmt.Sprintf("rateLimits.policies[%d]", i)
+		v.required(key+".name", policy.Name)
+		if policyNames[policy.Name] {
+			v.fail(key+".name", "must be unique, %q is used twice", policy.Name)
+		}
+		policyNames[policy.Name] = true
+		if _, path, _ := strings.Cut(policy.Route, " "); !strings.HasPrefix(policy.Route, "/") && !strings.HasPrefix(path, "/") {
+			v.fail(key+".route", `must be "METHOD /path" or "/path", got %q`, policy.Route)
+		}
+		v.oneOf(key+".key", policy.Key, "ip", "phone", "user", "api-key")
+		v.rateLimit(key, policy.Limit())
+	}
+	if c.RateLimits.WarningThreshold < 0 || c.RateLimits.WarningThreshold > 100 {
+		v.fail("rateLimits.warningThreshold", "must be between 0 and 100, got %d", c.RateLimits.WarningThreshold)
+	}
+
+	names := make(map[string]bool)
+	for i, provider := range c.SMS.Providers {
+		key := fmt.Sprintf("sms.providers[%d]", i)
+		v.required(key+".name", provider.Name)
+		v.required(key+".type", provider.Type)
+		if names[provider.Name] {
+			v.fail(key+".name", "must be unique, %q is used twice", provider.Name)
+		}
+		names[provider.Name] = true
+		v.senderIDs(key+".senderIds", provider.SenderIDs)
+	}
+	if c.SMS.Failover.ErrorRate < 0 || c.SMS.Failover.ErrorRate > 1 {
+		v.fail("sms.failover.errorRate", "must be between 0 and 1, got %g", c.SMS.Failover.ErrorRate)
+	}
+	v.notNegative("sms.overflow.maxLength", c.SMS.Overflow.MaxLength)
+	if c.SMS.Overflow.DrainRate < 0 {
+		v.fail("sms.overflow.drainRate", "cannot be negative, got %g", c.SMS.Overflow.DrainRate)
+	}
+	if len(c.SMS.Overflow.Tenants) > 0 && c.Service.HTTP.TenantHeader == "" {
+		v.fail("sms.overflow.tenants", "need service.http.tenantHeader to tell tenants apart")
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.SMS.Overflow.Tenants)) {
+		key := "sms.overflow.tenants." + name
+		if tenant.Normalize(name) != name || name == "" {
+			v.fail(key, "must be at most 64 letters, digits, dots, dashes and underscores")
+		}
+		v.notNegative(key+".maxLength", c.SMS.Overflow.Tenants[name].MaxLength)
+	}
+
+	v.adaptiveLimit("concurrency.redis", c.Concurrency.Redis)
+	v.adaptiveLimit("concurrency.postgres", c.Concurrency.Postgres)
+	if c.Concurrency.CircuitBreaker.Enabled {
+		v.positive("concurrency.circuitBreaker.failures", c.Concurrency.CircuitBreaker.Failures)
+		v.positive("concurrency.circuitBreaker.openTimeout", c.Concurrency.CircuitBreaker.OpenTimeout)
+	}
+
+	for i, client := range c.TokenExchange.Clients {
+		key := fmt.Sprintf("tokenExchange.clients[%d]", i)
+		v.required(key+".name", client.Name)
+		v.required(key+".apiKey", client.APIKey)
+		if client.PreviousAPIKey != "" {
+			if _, err := time.Parse(time.RFC3339, client.PreviousAPIKeyExpiry); err != nil {
+				v.fail(key+".previousApiKeyExpiry", "must be an RFC 3339 time, got %q", client.PreviousAPIKeyExpiry)
+			}
+			if client.PreviousAPIKey == client.APIKey {
+				v.fail(key+".previousApiKey", "must differ from the client's apiKey")
+			}
+		}
+	}
+
+	v.oneOf("captcha.provider", c.Captcha.Provider, "", "recaptcha", "hcaptcha", "turnstile")
+	if c.Captcha.Provider != "" {
+		v.required("captcha.secret", c.Captcha.Secret)
+		v.notNegative("captcha.threshold.count", c.Captcha.Threshold.Count)
+		v.positive("captcha.threshold.time", c.Captcha.Threshold.Time)
+	}
+
+	for i, endpoint := range c.Webhooks.Endpoints {
+		v.oneOf(fmt.Sprintf("webhooks.endpoints[%d].analytics", i), endpoint.Analytics, "", "anonymize", "drop")
+	}
+
+	if c.Hooks.URL != "" {
+		if u, err := url.Parse(c.Hooks.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.fail("hooks.url", "must be an http or https URL, got %q", c.Hooks.URL)
+		}
+		v.required("hooks.secret", c.Hooks.Secret)
+		v.notNegative("hooks.timeout", c.Hooks.Timeout)
+		for i, event := range c.Hooks.Events {
+			v.oneOf(fmt.Sprintf("hooks.events[%d]", i), event, "user.created", "user.login", "otp.failed")
+		}
+	}
+
+	if c.Policy.OPAURL != "" {
+		if u, err := url.Parse(c.Policy.OPAURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.fail("policy.opaURL", "must be an http or https URL, got %q", c.Policy.OPAURL)
+		}
+		v.required("policy.path", strings.Trim(c.Policy.Path, "/"))
+		v.notNegative("policy.timeout", c.Policy.Timeout)
+	}
+
+	v.oneOf("otp.channels.duplicates", c.OTP.Channels.Duplicates, "", "reuse", "invalidate")
+	if c.OTP.Channels.Email && c.Email.Host != "" {
+		v.port("email.port", strconv.Itoa(c.Email.Port))
+		v.required("email.from", c.Email.From)
+	}
+	if c.OTP.Channels.FlashCall {
+		v.oneOf("flashCall.provider", c.FlashCall.Provider, "", "log", "http")
+		if !callerPrefixPattern.MatchString(c.FlashCall.CallerPrefix) {
+			v.fail("flashCall.callerPrefix", "must be digits with an optional leading +, got %q", c.FlashCall.CallerPrefix)
+		}
+		if c.FlashCall.Provider == "http" {
+			if u, err := url.Parse(c.FlashCall.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.fail("flashCall.url", "must be an http or https URL, got %q", c.FlashCall.URL)
+			}
+		}
+		v.notNegative("flashCall.timeout", c.FlashCall.Timeout)
+	}
+
+	v.oneOf("silentAuth.provider", c.SilentAuth.Provider, "", "none", "header", "http")
+	switch c.SilentAuth.Provider {
+	case "header":
+		v.required("silentAuth.header", c.SilentAuth.Header)
+		v.headerName("silentAuth.header", c.SilentAuth.Header)
+		if len(c.SilentAuth.TrustedProxies) == 0 {
+			v.fail("silentAuth.trustedProxies", "must list the carrier's enrichment proxies")
+		}
+		v.networks("silentAuth.trustedProxies", c.SilentAuth.TrustedProxies)
+	case "http":
+		if u, err := url.Parse(c.SilentAuth.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.fail("silentAuth.url", "must be an http or https URL, got %q", c.SilentAuth.URL)
+		}
+	}
+	v.notNegative("silentAuth.timeout", c.SilentAuth.Timeout)
+
+	if c.Canary.Percentage < 0 || c.Canary.Percentage > 100 {
+		v.fail("canary.percentage", "must be between 0 and 100, got %d", c.Canary.Percentage)
+	}
+	v.oneOf("canary.rateLimit.algorithm", c.Canary.RateLimit.Algorithm, "", "fixed_window", "sliding_window", "token_bucket")
+
+	v.notNegative("maintenance.cacheTtl", c.Maintenance.CacheTTL)
+
+	v.notNegative("pagination.maxPageSize", c.Pagination.MaxPageSize)
+	v.notNegative("pagination.maxSearchLength", c.Pagination.MaxSearchLength)
+	v.notNegative("admin.exportTimeout", c.Admin.ExportTimeout)
+
+	v.oneOf("logging.level", strings.ToLower(c.Logging.Level), "", "debug", "info", "warn", "error")
+	v.oneOf("logging.format", strings.ToLower(c.Logging.Format), "", "json", "text")
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Package apierror writes error responses as RFC 7807 problem details, and defines the
+// machine-readable codes returned in them as "error_code", so clients can branch on them
+// rather than on error messages, which may change.
+//
+// Codes are part of the API: once published, a code keeps its meaning and is never renamed
+// or reused. Errors without a more specific code get the generic code of their HTTP status.
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// Generic codes, one per HTTP status
+const (
+	InvalidRequest     = "INVALID_REQUEST"
+	Unauthorized       = "UNAUTHORIZED"
+	Forbidden          = "FORBIDDEN"
+	NotFound           = "NOT_FOUND"
+	Gone               = "GONE"
+	PayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	RateLimited        = "RATE_LIMITED"
+	InternalError      = "INTERNAL_ERROR"
+	NotImplemented     = "NOT_IMPLEMENTED"
+	ServiceUnavailable = "SERVICE_UNAVAILABLE"
+	DeadlineExceeded   = "DEADLINE_EXCEEDED"
+)
+
+// Specific codes
+const (
+	InvalidPhoneNumber     = "INVALID_PHONE_NUMBER"
+	PhoneBlocked           = "PHONE_BLOCKED"
+	PhoneSuppressed        = "PHONE_SUPPRESSED"
+	CaptchaRequired        = "CAPTCHA_REQUIRED"
+	CaptchaInvalid         = "CAPTCHA_INVALID"
+	ChallengeNotFound      = "CHALLENGE_NOT_FOUND"
+	OTPInvalid             = "OTP_INVALID"
+	OTPExpired             = "OTP_EXPIRED"
+	OTPLocked              = "OTP_LOCKED"
+	ResendCooldown         = "RESEND_COOLDOWN"
+	ProviderBusy           = "PROVIDER_BUSY"
+	SendBacklogged         = "SEND_BACKLOGGED"
+	AccountDeleted         = "ACCOUNT_DELETED"
+	SignInDenied           = "SIGN_IN_DENIED"
+	PolicyDenied           = "POLICY_DENIED"
+	TokenInvalid           = "TOKEN_INVALID"
+	SessionRevoked         = "SESSION_REVOKED"
+	RefreshTokenInvalid    = "REFRESH_TOKEN_INVALID"
+	VerificationInProgress = "VERIFICATION_IN_PROGRESS"
+	SessionInOtherCountry  = "SESSION_IN_OTHER_COUNTRY"
+)
+
+// catalog documents every code, in the order they are listed by GET /v1/meta/errors
+var catalog = []models.ErrorCode{
+	{Code: InvalidRequest, Status: http.StatusBadRequest, Title: "Invalid request", Description: "The request is malformed or has an invalid parameter."},
+	{Code: InvalidPhoneNumber, Status: http.StatusBadRequest, Title: "Invalid phone number", Description: "The phone number is missing or not a valid Iranian mobile number."},
+	{Code: Unauthorized, Status: http.StatusUnauthorized, Title: "Unauthorized", Description: "The request needs an access token, or a valid API key or callback token."},
+	{Code: TokenInvalid, Status: http.StatusUnauthorized, Title: "Invalid access token", Description: "The access token is invalid or has expired; refresh it or sign in again."},
+	{Code: SessionRevoked, Status: http.StatusUnauthorized, Title: "Session revoked", Description: "The session of the access token has been revoked; sign in again."},
+	{Code: RefreshTokenInvalid, Status: http.StatusUnauthorized, Title: "Invalid refresh token", Description: "The refresh token is invalid, expired or already used; sign in again."},
+	{Code: OTPInvalid, Status: http.StatusUnauthorized, Title: "Invalid OTP", Description: "The OTP or backup code is wrong."},
+	{Code: OTPExpired, Status: http.StatusUnauthorized, Title: "Expired OTP", Description: "The challenge has expired, was already verified, or was issued to another client; request a new OTP."},
+	{Code: Forbidden, Status: http.StatusForbidden, Title: "Forbidden", Description: "The user lacks the permission the request needs."},
+	{Code: PhoneBlocked, Status: http.StatusForbidden, Title: "Phone number blocked", Description: "OTPs cannot be sent to the phone number, as it is blocked or not allowed."},
+	{Code: PhoneSuppressed, Status: http.StatusForbidden, Title: "Phone number suppressed", Description: "SMS delivery to the phone number is suppressed, e.g. after it opted out."},
+	{Code: CaptchaRequired, Status: http.StatusForbidden, Title: "CAPTCHA required", Description: "The request needs a solved CAPTCHA in captcha_token."},
+	{Code: CaptchaInvalid, Status: http.StatusForbidden, Title: "Invalid CAPTCHA", Description: "The CAPTCHA token is invalid or expired; solve a new CAPTCHA."},
+	{Code: AccountDeleted, Status: http.StatusForbidden, Title: "Account deleted", Description: "The account has been deleted."},
+	{Code: SignInDenied, Status: http.StatusForbidden, Title: "Sign-in denied", Description: "The deployment's sign-in policy refused the sign-in."},
+	{Code: PolicyDenied, Status: http.StatusForbidden, Title: "Denied by policy", Description: "An authorization policy denied the request."},
+	{Code: NotFound, Status: http.StatusNotFound, Title: "Not found", Description: "The resource doesn't exist."},
+	{Code: ChallengeNotFound, Status: http.StatusNotFound, Title: "Challenge not found", Description: "The challenge has no pending OTP, or was issued to another client; request a new OTP."},
+	{Code: VerificationInProgress, Status: http.StatusConflict, Title: "Verification in progress", Description: "Another verification for the phone number is in progress; retry shortly."},
+	{Code: SessionInOtherCountry, Status: http.StatusConflict, Title: "Session in another country", Description: "The user has an active session from another country; sign out of it, or have an admin revoke it, before signing in."},
+	{Code: Gone, Status: http.StatusGone, Title: "Gone", Description: "The resource can no longer be restored."},
+	{Code: PayloadTooLarge, Status: http.StatusRequestEntityTooLarge, Title: "Payload too large", Description: "The request body is too large."},
+	{Code: RateLimited, Status: http.StatusTooManyRequests, Title: "Rate limited", Description: "Too many requests; try again later."},
+	{Code: OTPLocked, Status: http.StatusTooManyRequests, Title: "OTP verification locked", Description: "Too many wrong OTPs for the phone number; retry after retry_after seconds."},
+	{Code: ResendCooldown, Status: http.StatusTooManyRequests, Title: "Resend cooldown", Description: "The OTP was sent too recently to be resent; retry after retry_after seconds."},
+	{Code: SendBacklogged, Status: http.StatusTooManyRequests, Title: "SMS send backlog", Description: "So many OTPs are waiting to be sent that the OTP would expire first; retry after retry_after seconds."},
+	{Code: InternalError, Status: http.StatusInternalServerError, Title: "Internal error", Description: "The request failed on the server."},
+	{Code: NotImplemented, Status: http.StatusNotImplemented, Title: "Not implemented", Description: "The feature isn't configured on this server."},
+	{Code: ServiceUnavailable, Status: http.StatusServiceUnavailable, Title: "Service unavailable", Description: "The service is overloaded or a dependency is unavailable; try again later."},
+	{Code: ProviderBusy, Status: http.StatusServiceUnavailable, Title: "SMS provider busy", Description: "The SMS provider or the OTP send queue is full; try again later."},
+	{Code: DeadlineExceeded, Status: http.StatusGatewayTimeout, Title: "Deadline exceeded", Description: "The request deadline passed before the request was handled."},
+}
+
+// Catalog returns every error code with the HTTP status it comes with and its meaning
+func Catalog() []models.ErrorCode {
+	return append([]models.ErrorCode(nil), catalog...)
+}
+
+// ForStatus returns the generic code of an HTTP error status
+func ForStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusGone:
+		return Gone
+	case http.StatusRequestEntityTooLarge:
+		return PayloadTooLarge
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusNotImplemented:
+		return NotImplemented
+	case http.StatusServiceUnavailable:
+		return ServiceUnavailable
+	case http.StatusGatewayTimeout:
+		return DeadlineExceeded
+	}
+	if status >= http.StatusInternalServerError {
+		return InternalError
+	}
+	return InvalidRequest
+}
@@ -0,0 +1,88 @@
+package apierror
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of error responses, RFC 7807 problem details
+const ContentType = "application/problem+json"
+
+// catalogPath is the path of the error catalog, which the type of every problem refers to
+const catalogPath = "/v1/meta/errors"
+
+// legacyFormatKey is the Gin context key set on requests whose errors use the legacy format
+const legacyFormatKey = "apierror_legacy_format"
+
+// titles holds the title of every code in the catalog
+var titles = func() map[string]string {
+	titles := make(map[string]string, len(catalog))
+	for _, entry := range catalog {
+		titles[entry.Code] = entry.Title
+	}
+	return titles
+}()
+
+// UseLegacyFormat makes the errors of a request use the format that predates problem details,
+// {"error": <detail>, "code": <code>}, for clients not yet migrated
+func UseLegacyFormat(c *gin.Context) {
+	c.Set(legacyFormatKey, true)
+}
+
+// Respond writes an error response with the status and code, detail explaining this occurrence
+func Respond(c *gin.Context, status int, code, detail string) {
+	RespondWith(c, status, code, detail, nil)
+}
+
+// RespondUnavailable writes a 503 Service Unavailable response to a request shed because a
+// dependency is overloaded or down, telling the client when to retry if retryAfter is set
+func RespondUnavailable(c *gin.Context, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	Respond(c, http.StatusServiceUnavailable, ServiceUnavailable, "Service overloaded, try again later")
+}
+
+// RespondWith writes an error response as Respond does, adding the extension members to it
+func RespondWith(c *gin.Context, status int, code, detail string, extensions gin.H) {
+	body := make(gin.H, len(extensions)+6)
+	for key, value := range extensions {
+		body[key] = value
+	}
+
+	if c.GetBool(legacyFormatKey) {
+		body["error"] = detail
+		body["code"] = code
+		c.JSON(status, body)
+		return
+	}
+
+	body["type"] = TypeURI(code)
+	body["title"] = Title(code, status)
+	body["status"] = status
+	body["detail"] = detail
+	body["instance"] = c.Request.URL.Path
+	body["error_code"] = code
+	// Set before rendering, which only sets a content type when there is none
+	c.Header("Content-Type", ContentType)
+	c.JSON(status, body)
+}
+
+// TypeURI returns the problem type of a code, a URI reference to its entry in the error catalog
+// that clients resolve against the URL of the request
+func TypeURI(code string) string {
+	return catalogPath + "#" + code
+}
+
+// Title returns the title of a code, falling back to the text of the status for codes missing
+// from the catalog
+func Title(code string, status int) string {
+	if title, ok := titles[code]; ok {
+		return title
+	}
+	return http.StatusText(status)
+}
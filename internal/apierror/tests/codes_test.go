@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/apierror"
+)
+
+func TestCatalog(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, entry := range apierror.Catalog() {
+		if seen[entry.Code] {
+			t.Errorf("code %s listed twice", entry.Code)
+		}
+		seen[entry.Code] = true
+		if entry.Status < http.StatusBadRequest || entry.Title == "" || entry.Description == "" {
+			t.Errorf("code %s has status %d, title %q and description %q", entry.Code, entry.Status, entry.Title, entry.Description)
+		}
+	}
+
+	// Every generic code must be documented with its status
+	for _, status := range []int{400, 401, 403, 404, 405, 409, 410, 413, 422, 429, 500, 501, 502, 503, 504} {
+		code := apierror.ForStatus(status)
+		if !seen[code] {
+			t.Errorf("ForStatus(%d) = %s, which isn't in the catalog", status, code)
+		}
+	}
+}
+
+func TestForStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusBadRequest, apierror.InvalidRequest},
+		{http.StatusConflict, apierror.InvalidRequest},
+		{http.StatusUnauthorized, apierror.Unauthorized},
+		{http.StatusTooManyRequests, apierror.RateLimited},
+		{http.StatusInternalServerError, apierror.InternalError},
+		{http.StatusBadGateway, apierror.InternalError},
+		{http.StatusServiceUnavailable, apierror.ServiceUnavailable},
+		{http.StatusGatewayTimeout, apierror.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		if got := apierror.ForStatus(tt.status); got != tt.want {
+			t.Errorf("ForStatus(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+)
+
+func respond(t *testing.T, legacy bool) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/auth/verify-otp", nil)
+	if legacy {
+		apierror.UseLegacyFormat(c)
+	}
+
+	apierror.RespondWith(c, http.StatusTooManyRequests, apierror.OTPLocked, "Too many failed attempts", gin.H{"retry_after": 30})
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %s isn't a JSON object: %v", w.Body.String(), err)
+	}
+	return w, body
+}
+
+func TestRespond(t *testing.T) {
+	w, body := respond(t, false)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Content-Type"); got != apierror.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, apierror.ContentType)
+	}
+	want := map[string]any{
+		"type":        "/v1/meta/errors#OTP_LOCKED",
+		"title":       "OTP verification locked",
+		"status":      float64(http.StatusTooManyRequests),
+		"detail":      "Too many failed attempts",
+		"instance":    "/v1/auth/verify-otp",
+		"error_code":  apierror.OTPLocked,
+		"retry_after": float64(30),
+	}
+	if len(body) != len(want) {
+		t.Errorf("body = %v, want %v", body, want)
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %v", key, body[key], value)
+		}
+	}
+}
+
+func TestRespondLegacyFormat(t *testing.T) {
+	w, body := respond(t, true)
+
+	if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	want := map[string]any{
+		"error":       "Too many failed attempts",
+		"code":        apierror.OTPLocked,
+		"retry_after": float64(30),
+	}
+	if len(body) != len(want) {
+		t.Errorf("body = %v, want %v", body, want)
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %v", key, body[key], value)
+		}
+	}
+}
+
+func TestRespondUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+
+	apierror.RespondUnavailable(c, 1500*time.Millisecond)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("status = %d, Retry-After = %q, want 503 retrying after 2 seconds", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+	apierror.RespondUnavailable(c, 0)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("status = %d, Retry-After = %q, want 503 without Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestTitle(t *testing.T) {
+	if got := apierror.Title(apierror.PhoneBlocked, http.StatusForbidden); got != "Phone number blocked" {
+		t.Errorf("Title(PHONE_BLOCKED) = %q", got)
+	}
+	// Codes missing from the catalog fall back to the text of the status
+	if got := apierror.Title("UNKNOWN", http.StatusTeapot); got != "I'm a teapot" {
+		t.Errorf("Title(UNKNOWN) = %q", got)
+	}
+}
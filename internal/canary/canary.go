@@ -0,0 +1,114 @@
+// Package canary routes requests through alternative implementations of auth logic, such as a
+// new rate limiting algorithm, registered side by side with the stable ones, so algorithm
+// changes can be tried on a share of traffic and compared before they replace the stable ones.
+package canary
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+
+	"github.com/lilokie/otp-auth/config"
+)
+
+// Header is the header requests can pick their variant with, when canary.header is set
+const Header = "X-Canary"
+
+// Variants a request can be routed to
+const (
+	Stable = "stable"
+	Canary = "canary"
+)
+
+// contextKey is the type of the context key variants are stored under
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the variant a request was routed to
+func NewContext(ctx context.Context, variant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, variant)
+}
+
+// FromContext returns the variant carried by ctx, Stable if it carries none
+func FromContext(ctx context.Context) string {
+	if variant, ok := ctx.Value(contextKey{}).(string); ok {
+		return variant
+	}
+	return Stable
+}
+
+// Router picks the variant of each request
+type Router struct {
+	cfg config.Provider
+}
+
+// NewRouter creates a new router. Its settings are read from cfg on each request, so the
+// rollout follows configuration reloads.
+func NewRouter(cfg config.Provider) *Router {
+	return &Router{cfg: cfg}
+}
+
+// Variant returns the variant of a request from client, e.g. its IP address, carrying header
+// in X-Canary. With canary.header set, "canary", "true" and "1" pick the canary variant and
+// "stable", "false" and "0" the stable one. Other requests are routed to the canary variant for
+// canary.percentage percent of clients, hashed so each client keeps its variant.
+func (r *Router) Variant(header, client string) string {
+	cfg := r.cfg.Current().Canary
+	if cfg.Header {
+		switch strings.ToLower(strings.TrimSpace(header)) {
+		case Canary, "true", "1":
+			return Canary
+		case Stable, "false", "0":
+			return Stable
+		}
+	}
+
+	if cfg.Percentage <= 0 {
+		return Stable
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(client))
+	if int(hash.Sum32()%100) < cfg.Percentage {
+		return Canary
+	}
+	return Stable
+}
+
+// Variants holds the stable implementation of a component and, if one is registered, its
+// canary implementation
+type Variants[T any] struct {
+	stable    T
+	canary    T
+	hasCanary bool
+}
+
+// NewVariants creates variants of a component with only its stable implementation
+func NewVariants[T any](stable T) *Variants[T] {
+	return &Variants[T]{stable: stable}
+}
+
+// WithCanary registers the canary implementation of the component and returns v
+func (v *Variants[T]) WithCanary(canary T) *Variants[T] {
+	v.canary = canary
+	v.hasCanary = true
+	return v
+}
+
+// Pick returns the implementation for the variant of the request ctx belongs to, and that
+// variant. Requests routed to the canary variant get the stable implementation, and count as
+// stable, while no canary implementation is registered.
+func (v *Variants[T]) Pick(ctx context.Context) (T, string) {
+	if v.hasCanary && FromContext(ctx) == Canary {
+		return v.canary, Canary
+	}
+	return v.stable, Stable
+}
+
+// Stable returns the stable implementation
+func (v *Variants[T]) Stable() T {
+	return v.stable
+}
+
+// Canary returns the canary implementation and whether one is registered
+func (v *Variants[T]) Canary() (T, bool) {
+	return v.canary, v.hasCanary
+}
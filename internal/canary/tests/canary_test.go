@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/canary"
+)
+
+func TestRouterHonorsHeaderOnlyWhenEnabled(t *testing.T) {
+	cfg := &config.Config{}
+	router := canary.NewRouter(cfg)
+
+	if got := router.Variant("canary", "203.0.113.1"); got != canary.Stable {
+		t.Fatalf("expected the header ignored by default, got %s", got)
+	}
+
+	cfg.Canary.Header = true
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"canary", canary.Canary},
+		{" TRUE ", canary.Canary},
+		{"1", canary.Canary},
+		{"stable", canary.Stable},
+		{"0", canary.Stable},
+		{"", canary.Stable},
+		{"maybe", canary.Stable},
+	}
+	for _, tt := range tests {
+		if got := router.Variant(tt.header, "203.0.113.1"); got != tt.want {
+			t.Errorf("Variant(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+
+	// The header wins over the rollout
+	cfg.Canary.Percentage = 100
+	if got := router.Variant("stable", "203.0.113.1"); got != canary.Stable {
+		t.Fatalf("expected the header to opt out of the rollout, got %s", got)
+	}
+}
+
+func TestRouterRollsOutToPercentageOfClients(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Canary.Percentage = 20
+	router := canary.NewRouter(cfg)
+
+	routed := 0
+	for i := 0; i < 1000; i++ {
+		client := fmt.Sprintf("198.51.%d.%d", i/256, i%256)
+		variant := router.Variant("", client)
+		if variant == canary.Canary {
+			routed++
+		}
+		// Each client keeps its variant
+		if again := router.Variant("", client); again != variant {
+			t.Fatalf("expected %s to stay on %s, got %s", client, variant, again)
+		}
+	}
+	if routed < 150 || routed > 250 {
+		t.Fatalf("expected about 200 of 1000 clients on the canary variant, got %d", routed)
+	}
+
+	cfg.Canary.Percentage = 0
+	if got := router.Variant("", "198.51.0.1"); got != canary.Stable {
+		t.Fatalf("expected no clients on the canary variant at 0%%, got %s", got)
+	}
+}
+
+func TestVariantsPick(t *testing.T) {
+	canaryCtx := canary.NewContext(context.Background(), canary.Canary)
+
+	variants := canary.NewVariants("old")
+	if impl, variant := variants.Pick(canaryCtx); impl != "old" || variant != canary.Stable {
+		t.Fatalf("expected the stable implementation without a canary one, got %s (%s)", impl, variant)
+	}
+
+	variants.WithCanary("new")
+	if impl, variant := variants.Pick(canaryCtx); impl != "new" || variant != canary.Canary {
+		t.Fatalf("expected the canary implementation, got %s (%s)", impl, variant)
+	}
+	if impl, variant := variants.Pick(context.Background()); impl != "old" || variant != canary.Stable {
+		t.Fatalf("expected requests without a variant to be stable, got %s (%s)", impl, variant)
+	}
+}
@@ -0,0 +1,105 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported CAPTCHA providers
+const (
+	ProviderRecaptcha = "recaptcha"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+)
+
+// verifyURLs are the siteverify endpoints of the supported providers, which share one API
+var verifyURLs = map[string]string{
+	ProviderRecaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// Verifier verifies the tokens clients get from solving a CAPTCHA
+type Verifier interface {
+	// Verify reports whether token is a valid, unused CAPTCHA solution of a client at remoteIP.
+	// An error means the provider could not be asked, not that the token is invalid.
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// Client verifies CAPTCHA tokens with a provider's siteverify endpoint
+type Client struct {
+	httpClient *http.Client
+	verifyURL  string
+	secret     string
+}
+
+// NewClient creates a client for provider authenticating with secret, whose requests time out
+// after timeout. verifyURL overrides the provider's endpoint if not empty.
+func NewClient(provider, secret, verifyURL string, timeout time.Duration) (*Client, error) {
+	if verifyURL == "" {
+		verifyURL = verifyURLs[provider]
+	}
+	if verifyURL == "" {
+		return nil, fmt.Errorf("unknown CAPTCHA provider: %s", provider)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("CAPTCHA provider %s has no secret", provider)
+	}
+
+	return &Client{
+		httpClient: &http.Client{Timeout: timeout},
+		verifyURL:  verifyURL,
+		secret:     secret,
+	}, nil
+}
+
+// verifyResponse is the part of a siteverify response the client reads
+type verifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify reports whether token is a valid, unused CAPTCHA solution of a client at remoteIP
+func (c *Client) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{
+		"secret":   {c.secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("error creating CAPTCHA verification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("error verifying CAPTCHA: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("error verifying CAPTCHA: provider responded with status %d", resp.StatusCode)
+	}
+
+	var result verifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("error decoding CAPTCHA verification response: %w", err)
+	}
+
+	// A misconfigured secret is our problem, not the client's
+	for _, code := range result.ErrorCodes {
+		if code == "missing-input-secret" || code == "invalid-input-secret" {
+			return false, fmt.Errorf("error verifying CAPTCHA: provider rejected secret (%s)", code)
+		}
+	}
+	return result.Success, nil
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/captcha"
+)
+
+// newSiteverify starts a fake siteverify endpoint accepting the token "solved" for secret "secret"
+func newSiteverify(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("remoteip") != "203.0.113.1" {
+			http.Error(w, "missing remote IP", http.StatusBadRequest)
+			return
+		}
+
+		response := map[string]interface{}{"success": false}
+		switch {
+		case r.PostForm.Get("secret") != "secret":
+			response["error-codes"] = []string{"invalid-input-secret"}
+		case r.PostForm.Get("response") == "solved":
+			response["success"] = true
+		default:
+			response["error-codes"] = []string{"invalid-input-response"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientVerify(t *testing.T) {
+	server := newSiteverify(t)
+	client, err := captcha.NewClient(captcha.ProviderTurnstile, "secret", server.URL, time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	ctx := context.Background()
+	if valid, err := client.Verify(ctx, "solved", "203.0.113.1"); err != nil || !valid {
+		t.Fatalf("expected solved token to be valid, got %v, %v", valid, err)
+	}
+	if valid, err := client.Verify(ctx, "guessed", "203.0.113.1"); err != nil || valid {
+		t.Fatalf("expected other token to be invalid, got %v, %v", valid, err)
+	}
+}
+
+func TestClientVerifyProviderErrors(t *testing.T) {
+	server := newSiteverify(t)
+	ctx := context.Background()
+
+	// A wrong secret is reported as an error rather than blaming the client's token
+	client, err := captcha.NewClient(captcha.ProviderHCaptcha, "wrong", server.URL, time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.Verify(ctx, "solved", "203.0.113.1"); err == nil {
+		t.Fatal("expected an error for a rejected secret")
+	}
+
+	client, err = captcha.NewClient(captcha.ProviderHCaptcha, "secret", server.URL+"/missing", time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.Verify(ctx, "solved", ""); err == nil {
+		t.Fatal("expected an error for a failed request")
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	for _, provider := range []string{captcha.ProviderRecaptcha, captcha.ProviderHCaptcha, captcha.ProviderTurnstile} {
+		if _, err := captcha.NewClient(provider, "secret", "", time.Second); err != nil {
+			t.Fatalf("NewClient(%s): %v", provider, err)
+		}
+	}
+	if _, err := captcha.NewClient("friendlycaptcha", "secret", "", time.Second); err == nil {
+		t.Fatal("expected an error for an unknown provider")
+	}
+	if _, err := captcha.NewClient(captcha.ProviderRecaptcha, "", "", time.Second); err == nil {
+		t.Fatal("expected an error without a secret")
+	}
+}
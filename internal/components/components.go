@@ -0,0 +1,51 @@
+// Package components parses the components an instance runs, so the same binary can be
+// deployed as dedicated API instances and dedicated worker instances
+package components
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Components an instance can run
+const (
+	API       = "api"       // the HTTP API
+	Worker    = "worker"    // sending queued OTPs and delivering webhooks
+	Scheduler = "scheduler" // periodic jobs, such as syncing active user counts
+)
+
+// All lists every component, the default of the -components flag
+const All = API + "," + Worker + "," + Scheduler
+
+// Set is the set of components an instance runs
+type Set map[string]bool
+
+// Parse parses a comma-separated list of components
+func Parse(s string) (Set, error) {
+	run := make(Set)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case API, Worker, Scheduler:
+			run[name] = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown component %q, expected %s", name, All)
+		}
+	}
+	if len(run) == 0 {
+		return nil, fmt.Errorf("no components to run, expected some of %s", All)
+	}
+	return run, nil
+}
+
+// String lists the components in their canonical order
+func (c Set) String() string {
+	var names []string
+	for _, name := range strings.Split(All, ",") {
+		if c[name] {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/components"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string // the parsed components in canonical order
+		err   string // part of the expected error, if any
+	}{
+		{"all", components.All, "api,worker,scheduler", ""},
+		{"single", "worker", "worker", ""},
+		{"canonical order", "scheduler,api", "api,scheduler", ""},
+		{"duplicates", "api,api,worker,api", "api,worker", ""},
+		{"whitespace", "  api , worker\t", "api,worker", ""},
+		{"empty entries", "api,,worker,", "api,worker", ""},
+		{"empty", "", "", "no components to run"},
+		{"only separators", " , ,", "", "no components to run"},
+		{"unknown", "api,cron", "", `unknown component "cron"`},
+		{"case sensitive", "API", "", `unknown component "API"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run, err := components.Parse(tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse(%q) error = %v, want %q", tt.input, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if got := run.String(); got != tt.want {
+				t.Fatalf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
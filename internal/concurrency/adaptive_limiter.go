@@ -0,0 +1,160 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// ErrLimitExceeded is returned when a dependency already has as many operations
+// in flight as its current concurrency limit allows
+var ErrLimitExceeded = errors.New("dependency concurrency limit exceeded")
+
+// Default adaptive limit settings, used for unset configuration values
+const (
+	defaultInitialLimit     = 20
+	defaultMinLimit         = 5
+	defaultMaxLimit         = 200
+	defaultLatencyThreshold = 50 * time.Millisecond
+	defaultBackoffRatio     = 0.9
+)
+
+// AdaptiveLimiter caps the number of concurrent operations against a dependency
+// and adapts the cap with AIMD: every fast, successful operation raises it by
+// 1/limit (about +1 per limit operations), every slow or timed out operation
+// multiplies it by the backoff ratio. When a dependency slows down the service
+// sheds load with ErrLimitExceeded instead of piling more work onto it.
+type AdaptiveLimiter struct {
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+
+	minLimit         float64
+	maxLimit         float64
+	latencyThreshold time.Duration
+	backoffRatio     float64
+
+	limitGauge    metrics.Gauge
+	inflightGauge metrics.Gauge
+	rejected      metrics.Counter
+}
+
+// NewAdaptiveLimiter creates an adaptive limiter for the named dependency,
+// exporting its limit, in-flight operations and rejections to registry
+func NewAdaptiveLimiter(dependency string, cfg config.AdaptiveLimitConfig, registry *metrics.Registry) *AdaptiveLimiter {
+	minLimit := float64(cfg.MinLimit)
+	if minLimit < 1 {
+		minLimit = defaultMinLimit
+	}
+	maxLimit := float64(cfg.MaxLimit)
+	if maxLimit <= 0 {
+		maxLimit = defaultMaxLimit
+	}
+	maxLimit = math.Max(maxLimit, minLimit)
+
+	limit := float64(cfg.InitialLimit)
+	if limit <= 0 {
+		limit = defaultInitialLimit
+	}
+	limit = math.Min(math.Max(limit, minLimit), maxLimit)
+
+	latencyThreshold := cfg.GetLatencyThreshold()
+	if latencyThreshold <= 0 {
+		latencyThreshold = defaultLatencyThreshold
+	}
+	backoffRatio := cfg.BackoffRatio
+	if backoffRatio <= 0 || backoffRatio >= 1 {
+		backoffRatio = defaultBackoffRatio
+	}
+
+	l := &AdaptiveLimiter{
+		limit:            limit,
+		minLimit:         minLimit,
+		maxLimit:         maxLimit,
+		latencyThreshold: latencyThreshold,
+		backoffRatio:     backoffRatio,
+		limitGauge: registry.GaugeVec("dependency_concurrency_limit",
+			"Current adaptive concurrency limit per dependency.", "dependency").With(dependency),
+		inflightGauge: registry.GaugeVec("dependency_inflight_operations",
+			"Operations currently in flight per dependency.", "dependency").With(dependency),
+		rejected: registry.CounterVec("dependency_rejected_operations_total",
+			"Operations rejected because the dependency concurrency limit was reached.", "dependency").With(dependency),
+	}
+	l.limitGauge.Set(math.Floor(limit))
+	return l
+}
+
+// Acquire reserves a slot for one operation, returning ErrLimitExceeded if none is free.
+// Every successful Acquire must be followed by exactly one Release.
+func (l *AdaptiveLimiter) Acquire() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inflight) >= math.Floor(l.limit) {
+		l.rejected.Inc()
+		return ErrLimitExceeded
+	}
+
+	l.inflight++
+	l.inflightGauge.Set(float64(l.inflight))
+	return nil
+}
+
+// Release frees the slot of an operation that took latency and finished with err,
+// adjusting the limit accordingly
+func (l *AdaptiveLimiter) Release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	l.inflightGauge.Set(float64(l.inflight))
+
+	switch {
+	case isOverload(err) || latency > l.latencyThreshold:
+		// Multiplicative decrease
+		l.limit = math.Max(l.minLimit, l.limit*l.backoffRatio)
+	case float64(l.inflight)*2 >= l.limit:
+		// Additive increase, only while the limit is actually being used,
+		// so an idle dependency doesn't accumulate an unbounded limit
+		l.limit = math.Min(l.maxLimit, l.limit+1/l.limit)
+	}
+	l.limitGauge.Set(math.Floor(l.limit))
+}
+
+// Do runs fn if a slot is free, releasing it with fn's latency and error afterwards
+func (l *AdaptiveLimiter) Do(fn func() error) error {
+	if err := l.Acquire(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err := fn()
+	l.Release(time.Since(start), err)
+	return err
+}
+
+// Limit returns the current concurrency limit
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+// isOverload reports whether err indicates the dependency could not keep up
+func isOverload(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,192 @@
+package concurrency
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// Default circuit breaker settings, used for unset configuration values
+const (
+	defaultBreakerFailures    = 5
+	defaultBreakerOpenTimeout = 30 * time.Second
+)
+
+// Circuit breaker states, exported as the value of the dependency_circuit_state gauge
+const (
+	circuitClosed   = 0
+	circuitHalfOpen = 1
+	circuitOpen     = 2
+)
+
+// CircuitOpenError is returned instead of running an operation against a dependency whose
+// circuit breaker is open. It wraps ErrLimitExceeded, so callers shedding load when a
+// dependency is saturated do the same when it is down.
+type CircuitOpenError struct {
+	Dependency string
+	RetryAfter time.Duration // until the breaker lets an operation through again
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s circuit breaker open", e.Dependency)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// RetryAfter returns how long a client should wait before retrying an operation rejected
+// with err, or zero if err doesn't say
+func RetryAfter(err error) time.Duration {
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		return openErr.RetryAfter
+	}
+	return 0
+}
+
+// CircuitBreaker stops running operations against a dependency once failures consecutive
+// operations failed because it is unreachable or timed out, rejecting them with
+// *CircuitOpenError for openTimeout instead of piling up timeouts. It then lets a single
+// trial operation through, closing again if it succeeds and staying open for another
+// openTimeout if it fails.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     int
+	failures  int
+	openUntil time.Time
+	probing   bool
+
+	dependency  string
+	threshold   int
+	openTimeout time.Duration
+
+	stateGauge metrics.Gauge
+	opened     metrics.Counter
+	rejected   metrics.Counter
+}
+
+// NewCircuitBreaker creates a circuit breaker for the named dependency opening after failures
+// consecutive failures for openTimeout, exporting its state, openings and rejections to registry
+func NewCircuitBreaker(dependency string, failures int, openTimeout time.Duration, registry *metrics.Registry) *CircuitBreaker {
+	if failures <= 0 {
+		failures = defaultBreakerFailures
+	}
+	if openTimeout <= 0 {
+		openTimeout = defaultBreakerOpenTimeout
+	}
+	b := &CircuitBreaker{
+		dependency:  dependency,
+		threshold:   failures,
+		openTimeout: openTimeout,
+		stateGauge: registry.GaugeVec("dependency_circuit_state",
+			"Circuit breaker state per dependency: 0 closed, 1 half-open, 2 open.", "dependency").With(dependency),
+		opened: registry.CounterVec("dependency_circuit_opened_total",
+			"Times the circuit breaker of a dependency opened.", "dependency").With(dependency),
+		rejected: registry.CounterVec("dependency_circuit_rejected_operations_total",
+			"Operations rejected because the circuit breaker of a dependency was open.", "dependency").With(dependency),
+	}
+	b.stateGauge.Set(circuitClosed)
+	return b
+}
+
+// Do runs fn unless the breaker is open, recording whether it failed
+func (b *CircuitBreaker) Do(fn func() error) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	b.record(probe, err)
+	return err
+}
+
+// Open reports whether the breaker is rejecting operations
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state != circuitClosed
+}
+
+// allow admits an operation or rejects it with *CircuitOpenError, reporting whether the
+// admitted operation is the trial of a half-open breaker
+func (b *CircuitBreaker) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitClosed {
+		return false, nil
+	}
+
+	now := time.Now()
+	if b.state == circuitOpen && !now.Before(b.openUntil) {
+		b.setState(circuitHalfOpen)
+	}
+	if b.state == circuitHalfOpen && !b.probing {
+		b.probing = true
+		return true, nil
+	}
+
+	b.rejected.Inc()
+	// The trial operation in flight decides when the breaker closes; retrying after about as
+	// long as an operation takes finds out
+	retryAfter := time.Second
+	if b.state == circuitOpen {
+		retryAfter = b.openUntil.Sub(now)
+	}
+	return false, &CircuitOpenError{Dependency: b.dependency, RetryAfter: retryAfter}
+}
+
+// record counts the outcome of an admitted operation, opening or closing the breaker
+func (b *CircuitBreaker) record(probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	if !isUnavailable(err) {
+		b.failures = 0
+		if probe {
+			b.setState(circuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	// Operations admitted before the breaker opened don't extend it; only a failed trial does
+	if probe || (b.state == circuitClosed && b.failures >= b.threshold) {
+		b.openUntil = time.Now().Add(b.openTimeout)
+		b.setState(circuitOpen)
+		b.opened.Inc()
+	}
+}
+
+// setState moves the breaker to state; callers must hold b.mu
+func (b *CircuitBreaker) setState(state int) {
+	b.state = state
+	b.stateGauge.Set(float64(state))
+}
+
+// isUnavailable reports whether err indicates the dependency is down or not responding,
+// as opposed to rejecting or not finding what an operation asked for
+func isUnavailable(err error) bool {
+	if err == nil || errors.Is(err, ErrLimitExceeded) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,67 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// startKey is the context key under which RedisHook stores when an admitted command started
+type startKey struct{}
+
+// RedisHook is a go-redis hook that runs every command and pipeline through an AdaptiveLimiter
+type RedisHook struct {
+	limiter *AdaptiveLimiter
+}
+
+// NewRedisHook creates a new Redis hook for limiter
+func NewRedisHook(limiter *AdaptiveLimiter) *RedisHook {
+	return &RedisHook{limiter: limiter}
+}
+
+// BeforeProcess admits a command or rejects it with ErrLimitExceeded
+func (h *RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.before(ctx)
+}
+
+// AfterProcess releases the slot of an admitted command
+func (h *RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.after(ctx, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline admits a pipeline as a single operation or rejects it with ErrLimitExceeded
+func (h *RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return h.before(ctx)
+}
+
+// AfterProcessPipeline releases the slot of an admitted pipeline
+func (h *RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && !errors.Is(cmdErr, redis.Nil) {
+			err = cmdErr
+			break
+		}
+	}
+	h.after(ctx, err)
+	return nil
+}
+
+func (h *RedisHook) before(ctx context.Context) (context.Context, error) {
+	if err := h.limiter.Acquire(); err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h *RedisHook) after(ctx context.Context, err error) {
+	// go-redis calls AfterProcess for rejected commands too; those hold no slot
+	start, ok := ctx.Value(startKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	h.limiter.Release(time.Since(start), err)
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+func testConfig() config.AdaptiveLimitConfig {
+	return config.AdaptiveLimitConfig{
+		InitialLimit:     4,
+		MinLimit:         2,
+		MaxLimit:         6,
+		LatencyThreshold: 50,
+		BackoffRatio:     0.5,
+	}
+}
+
+func TestAdaptiveLimiterRejectsOverLimit(t *testing.T) {
+	limiter := concurrency.NewAdaptiveLimiter("test", testConfig(), metrics.NewRegistry())
+
+	for i := 0; i < 4; i++ {
+		if err := limiter.Acquire(); err != nil {
+			t.Fatalf("acquire %d: %v", i+1, err)
+		}
+	}
+	if err := limiter.Acquire(); !errors.Is(err, concurrency.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	limiter.Release(time.Millisecond, nil)
+	if err := limiter.Acquire(); err != nil {
+		t.Fatalf("expected a released slot to be reusable: %v", err)
+	}
+}
+
+func TestAdaptiveLimiterBacksOffOnSlowOperations(t *testing.T) {
+	limiter := concurrency.NewAdaptiveLimiter("test", testConfig(), metrics.NewRegistry())
+
+	if err := limiter.Acquire(); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	limiter.Release(100*time.Millisecond, nil)
+	if got := limiter.Limit(); got != 2 {
+		t.Fatalf("expected limit to halve to 2, got %d", got)
+	}
+
+	// Never below the minimum
+	if err := limiter.Acquire(); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	limiter.Release(time.Millisecond, fmt.Errorf("query failed: %w", context.DeadlineExceeded))
+	if got := limiter.Limit(); got != 2 {
+		t.Fatalf("expected limit to stay at minimum 2, got %d", got)
+	}
+}
+
+func TestAdaptiveLimiterGrowsUnderLoad(t *testing.T) {
+	limiter := concurrency.NewAdaptiveLimiter("test", testConfig(), metrics.NewRegistry())
+
+	// Keep the limiter saturated with fast operations
+	for i := 0; i < 100; i++ {
+		limit := limiter.Limit()
+		for j := 0; j < limit; j++ {
+			if err := limiter.Acquire(); err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+		}
+		for j := 0; j < limit; j++ {
+			limiter.Release(time.Millisecond, nil)
+		}
+	}
+
+	if got := limiter.Limit(); got != 6 {
+		t.Fatalf("expected limit to grow to the maximum 6, got %d", got)
+	}
+}
+
+func TestAdaptiveLimiterIgnoresNonOverloadErrors(t *testing.T) {
+	limiter := concurrency.NewAdaptiveLimiter("test", testConfig(), metrics.NewRegistry())
+
+	err := limiter.Do(func() error { return errors.New("not found") })
+	if err == nil || err.Error() != "not found" {
+		t.Fatalf("expected the operation's error, got %v", err)
+	}
+	if got := limiter.Limit(); got != 4 {
+		t.Fatalf("expected limit to stay at 4, got %d", got)
+	}
+}
+
+func TestAdaptiveLimiterExportsMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	limiter := concurrency.NewAdaptiveLimiter("postgres", testConfig(), registry)
+
+	for i := 0; i < 5; i++ {
+		limiter.Acquire()
+	}
+
+	var sb strings.Builder
+	if _, err := registry.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	out := sb.String()
+
+	for _, want := range []string{
+		`dependency_concurrency_limit{dependency="postgres"} 4`,
+		`dependency_inflight_operations{dependency="postgres"} 4`,
+		`dependency_rejected_operations_total{dependency="postgres"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	registry := metrics.NewRegistry()
+	breaker := concurrency.NewCircuitBreaker("test", 3, time.Minute, registry)
+	down := func() error { return fmt.Errorf("query: %w", context.DeadlineExceeded) }
+
+	// A success resets the count, and errors that don't mean the dependency is down never count
+	for _, fn := range []func() error{down, down, func() error { return nil }, down, down, func() error { return errors.New("OTP not found or expired") }, down, down} {
+		breaker.Do(fn)
+	}
+	if breaker.Open() {
+		t.Fatal("expected the breaker to stay closed without 3 consecutive failures")
+	}
+
+	breaker.Do(down)
+	if !breaker.Open() {
+		t.Fatal("expected the breaker to open after 3 consecutive failures")
+	}
+	called := false
+	err := breaker.Do(func() error { called = true; return nil })
+	if called {
+		t.Fatal("expected an open breaker not to run the operation")
+	}
+	var openErr *concurrency.CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.Dependency != "test" || !errors.Is(err, concurrency.ErrLimitExceeded) {
+		t.Fatalf("expected a CircuitOpenError wrapping ErrLimitExceeded, got %v", err)
+	}
+	if retryAfter := concurrency.RetryAfter(err); retryAfter <= 50*time.Second || retryAfter > time.Minute {
+		t.Fatalf("expected to retry once the breaker is due to close, got %v", retryAfter)
+	}
+
+	var sb strings.Builder
+	if _, err := registry.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	for _, want := range []string{
+		`dependency_circuit_state{dependency="test"} 2`,
+		`dependency_circuit_opened_total{dependency="test"} 1`,
+		`dependency_circuit_rejected_operations_total{dependency="test"} 1`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestCircuitBreakerTrialOperation(t *testing.T) {
+	breaker := concurrency.NewCircuitBreaker("test", 1, 20*time.Millisecond, metrics.NewRegistry())
+	down := func() error { return context.DeadlineExceeded }
+
+	breaker.Do(down)
+	time.Sleep(30 * time.Millisecond)
+
+	// A failed trial opens the breaker again
+	if err := breaker.Do(down); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the trial operation to run, got %v", err)
+	}
+	if err := breaker.Do(func() error { return nil }); concurrency.RetryAfter(err) <= 0 {
+		t.Fatalf("expected the breaker to open again, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// Only one trial runs at a time, and its success closes the breaker
+	trial := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- breaker.Do(func() error { <-trial; return nil })
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := breaker.Do(func() error { return nil }); concurrency.RetryAfter(err) <= 0 {
+		t.Fatalf("expected operations during the trial to be rejected, got %v", err)
+	}
+	close(trial)
+	if err := <-done; err != nil {
+		t.Fatalf("trial: %v", err)
+	}
+	if breaker.Open() {
+		t.Fatal("expected a successful trial to close the breaker")
+	}
+}
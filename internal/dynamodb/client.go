@@ -0,0 +1,159 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Attributes of the table's items. The table has a string partition key pk and sort key sk,
+// and expires items through DynamoDB TTL on ttl (Unix seconds).
+const (
+	PartitionKey = "pk"
+	SortKey      = "sk"
+	TTLAttribute = "ttl"
+)
+
+// versionAttribute is the attribute Modify tracks changes to an item with
+const versionAttribute = "version"
+
+// MaxAttempts bounds the attempts of conditional writes retried under contention, as by Modify
+const MaxAttempts = 10
+
+// ErrContention is returned when an item kept changing under a conditional write for MaxAttempts attempts
+var ErrContention = errors.New("too many concurrent DynamoDB updates")
+
+// String returns a string attribute value
+func String(s string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: s}
+}
+
+// Number returns an integer number attribute value
+func Number(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
+
+// Float returns a number attribute value
+func Float(f float64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatFloat(f, 'f', -1, 64)}
+}
+
+// TTL returns the ttl attribute value expiring an item at expiresAt.
+// DynamoDB removes expired items lazily, so readers must still check the expiry themselves.
+func TTL(expiresAt time.Time) types.AttributeValue {
+	return Number(expiresAt.Unix() + 1)
+}
+
+// Key returns the key of the item with partition key pk and sort key sk
+func Key(pk, sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{PartitionKey: String(pk), SortKey: String(sk)}
+}
+
+// StringOf returns the string attribute name of item, or "" if it is not set
+func StringOf(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+// IntOf returns the number attribute name of item as an integer, or 0 if it is not set
+func IntOf(item map[string]types.AttributeValue, name string) int64 {
+	if v, ok := item[name].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// FloatOf returns the number attribute name of item, or 0 if it is not set
+func FloatOf(item map[string]types.AttributeValue, name string) float64 {
+	if v, ok := item[name].(*types.AttributeValueMemberN); ok {
+		f, _ := strconv.ParseFloat(v.Value, 64)
+		return f
+	}
+	return 0
+}
+
+// Client is the AWS SDK's DynamoDB client, extended with the read-modify-write the
+// repositories and limiters use for items updated by more than a single expression
+type Client struct {
+	*dynamodb.Client
+}
+
+// NewClient creates a client for the DynamoDB API of region whose requests time out after
+// timeout. endpoint overrides the region's endpoint if not empty, e.g. for DynamoDB Local.
+// Credentials are looked up by the SDK's default chain: the environment, shared config files,
+// then the container or instance role.
+func NewClient(ctx context.Context, region, endpoint string, timeout time.Duration) (*Client, error) {
+	if region == "" {
+		return nil, fmt.Errorf("DynamoDB region cannot be empty")
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(region),
+		config.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(timeout)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS configuration for DynamoDB: %w", err)
+	}
+
+	return &Client{
+		Client: dynamodb.NewFromConfig(awsConfig, func(o *dynamodb.Options) {
+			if endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+	}, nil
+}
+
+// Modify updates the item with the given key by read-modify-write: modify gets the current
+// item, or an empty item if there is none, and returns the attributes to store besides the key, or nil
+// to leave the item as it is. The write only succeeds if the item hasn't changed since it was
+// read, tracked by a version attribute; otherwise modify runs again on the new item.
+func (c *Client) Modify(ctx context.Context, table string, key map[string]types.AttributeValue, modify func(current map[string]types.AttributeValue) (map[string]types.AttributeValue, error)) error {
+	for attempt := 0; attempt < MaxAttempts; attempt++ {
+		output, err := c.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(table), Key: key, ConsistentRead: aws.Bool(true)})
+		if err != nil {
+			return err
+		}
+		current := output.Item
+		next, err := modify(current)
+		if err != nil || next == nil {
+			return err
+		}
+
+		version := IntOf(current, versionAttribute)
+		put := &dynamodb.PutItemInput{
+			TableName: aws.String(table),
+			Item:      map[string]types.AttributeValue{versionAttribute: Number(version + 1)},
+		}
+		for name, value := range next {
+			put.Item[name] = value
+		}
+		for name, value := range key {
+			put.Item[name] = value
+		}
+		if len(current) == 0 {
+			put.ConditionExpression = aws.String("attribute_not_exists(" + PartitionKey + ")")
+		} else {
+			put.ConditionExpression = aws.String("#version = :version")
+			put.ExpressionAttributeNames = map[string]string{"#version": versionAttribute}
+			put.ExpressionAttributeValues = map[string]types.AttributeValue{":version": Number(version)}
+		}
+
+		_, err = c.PutItem(ctx, put)
+		var conditionErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &conditionErr) {
+			return err
+		}
+	}
+	return ErrContention
+}
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/lilokie/otp-auth/internal/dynamodb"
+)
+
+// newClient returns a client for server, with credentials set in the environment as in production
+func newClient(t *testing.T, server *httptest.Server) *dynamodb.Client {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	client, err := dynamodb.NewClient(context.Background(), "us-east-1", server.URL, time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+// wireItem is an item as the DynamoDB API encodes it, e.g. {"count": {"N": "1"}}
+type wireItem map[string]map[string]string
+
+// number returns the number attribute name of the item
+func (i wireItem) number(name string) int64 {
+	n, _ := strconv.ParseInt(i[name]["N"], 10, 64)
+	return n
+}
+
+// fakeTable is a fake DynamoDB endpoint holding a single item, whose first conditional put
+// fails as if a concurrent writer had changed the item
+type fakeTable struct {
+	item      wireItem
+	conflicts int
+	puts      int
+}
+
+func (f *fakeTable) serve(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			http.Error(w, "unsigned request", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.GetItem":
+			json.NewEncoder(w).Encode(map[string]interface{}{"Item": f.item})
+		case "DynamoDB_20120810.PutItem":
+			var input struct{ Item wireItem }
+			json.NewDecoder(r.Body).Decode(&input)
+			if f.conflicts > 0 {
+				f.conflicts--
+				f.item["version"] = map[string]string{"N": strconv.FormatInt(f.item.number("version")+1, 10)}
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"__type":  "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException",
+					"message": "The conditional request failed",
+				})
+				return
+			}
+			f.puts++
+			f.item = input.Item
+			w.Write([]byte("{}"))
+		default:
+			http.Error(w, "unsupported operation", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestModifyRetriesOnConflict(t *testing.T) {
+	table := &fakeTable{
+		item:      wireItem{"pk": {"S": "counter"}, "sk": {"S": "-"}, "count": {"N": "1"}, "version": {"N": "1"}},
+		conflicts: 1,
+	}
+	server := table.serve(t)
+	client := newClient(t, server)
+
+	var calls int
+	err := client.Modify(context.Background(), "table", dynamodb.Key("counter", "-"), func(current map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		calls++
+		return map[string]types.AttributeValue{"count": dynamodb.Number(dynamodb.IntOf(current, "count") + 1)}, nil
+	})
+	if err != nil {
+		t.Fatalf("Modify: %v", err)
+	}
+	if calls != 2 || table.puts != 1 {
+		t.Fatalf("expected the conflicting write to be retried once, got %d calls and %d puts", calls, table.puts)
+	}
+	if table.item.number("count") != 2 || table.item.number("version") != 3 || table.item["pk"]["S"] != "counter" {
+		t.Fatalf("expected the item to be updated on its new version, got %+v", table.item)
+	}
+}
+
+func TestModifyGivesUpUnderContention(t *testing.T) {
+	table := &fakeTable{item: wireItem{"version": {"N": "1"}}, conflicts: dynamodb.MaxAttempts}
+	server := table.serve(t)
+	client := newClient(t, server)
+
+	err := client.Modify(context.Background(), "table", dynamodb.Key("counter", "-"), func(current map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		return map[string]types.AttributeValue{}, nil
+	})
+	if err != dynamodb.ErrContention {
+		t.Fatalf("expected ErrContention, got %v", err)
+	}
+}
+
+func TestConditionalCheckFailedReturnsItem(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"__type":  "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException",
+			"message": "The conditional request failed",
+			"Item":    wireItem{"expires_at": {"N": "42"}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	client := newClient(t, server)
+
+	_, err := client.PutItem(context.Background(), &awsdynamodb.PutItemInput{TableName: aws.String("table"), Item: dynamodb.Key("a", "b")})
+	var conditionErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionErr) {
+		t.Fatalf("expected a failed condition, got %v", err)
+	}
+	if dynamodb.IntOf(conditionErr.Item, "expires_at") != 42 {
+		t.Fatalf("expected the existing item, got %+v", conditionErr.Item)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"name":   dynamodb.String("alice"),
+		"count":  dynamodb.Number(7),
+		"tokens": dynamodb.Float(2.5),
+		"ttl":    dynamodb.TTL(time.Unix(100, 0)),
+	}
+	if got := dynamodb.StringOf(item, "name"); got != "alice" {
+		t.Errorf("StringOf = %q, want alice", got)
+	}
+	if got := dynamodb.IntOf(item, "count"); got != 7 {
+		t.Errorf("IntOf = %d, want 7", got)
+	}
+	if got := dynamodb.FloatOf(item, "tokens"); got != 2.5 {
+		t.Errorf("FloatOf = %v, want 2.5", got)
+	}
+	// TTL rounds up, so items don't expire before expiresAt
+	if got := dynamodb.IntOf(item, "ttl"); got != 101 {
+		t.Errorf("TTL = %d, want 101", got)
+	}
+
+	// Missing attributes and attributes of another type read as zero values
+	if dynamodb.StringOf(item, "count") != "" || dynamodb.IntOf(item, "name") != 0 || dynamodb.FloatOf(nil, "tokens") != 0 {
+		t.Error("expected zero values for missing or mistyped attributes")
+	}
+}
@@ -0,0 +1,141 @@
+// Package email sends OTPs by email over SMTP, for users who request them by email rather than SMS.
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+)
+
+// Sender sends emails
+type Sender interface {
+	// Send sends an email with a plain text body to an address
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// NewSender creates the configured sender: an SMTP sender, or a log sender when no SMTP
+// server is configured
+func NewSender(cfg config.EmailConfig, logger *slog.Logger) Sender {
+	if cfg.Host == "" {
+		return NewLogSender(logger)
+	}
+	return NewSMTPSender(cfg)
+}
+
+// LogSender is a Sender that writes emails to the server logs instead of sending them. Their
+// bodies hold OTPs, so they are masked unless the logging configuration reveals sensitive values.
+type LogSender struct {
+	logger *slog.Logger
+}
+
+// NewLogSender creates a new log sender
+func NewLogSender(logger *slog.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+// Send writes the email to the server logs
+func (s *LogSender) Send(ctx context.Context, to, subject, body string) error {
+	logging.FromContext(ctx, s.logger).InfoContext(ctx, "Email sent",
+		"email", to,
+		"subject", subject,
+		"email_body", body,
+	)
+	return nil
+}
+
+// SMTPSender sends emails through an SMTP server, upgrading the connection with STARTTLS when
+// the server offers it
+type SMTPSender struct {
+	host     string
+	addr     string
+	username string
+	password string
+	from     string
+	timeout  time.Duration
+}
+
+// NewSMTPSender creates a new SMTP sender
+func NewSMTPSender(cfg config.EmailConfig) *SMTPSender {
+	return &SMTPSender{
+		host:     cfg.Host,
+		addr:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		username: cfg.Username,
+		password: cfg.Password,
+		from:     cfg.From,
+		timeout:  cfg.GetTimeout(),
+	}
+}
+
+// Send sends an email, giving up after the configured timeout or once ctx is done
+func (s *SMTPSender) Send(ctx context.Context, to, subject, body string) error {
+	// Addresses and subjects end up in headers, where line breaks would inject further headers
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email address or subject")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return fmt.Errorf("error connecting to SMTP server: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error connecting to SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("error starting TLS: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("error authenticating to SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	message := "From: " + s.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+	if _, err := w.Write([]byte(message)); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return client.Quit()
+}
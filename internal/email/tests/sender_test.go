@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/email"
+)
+
+// fakeSMTPServer accepts one SMTP session without STARTTLS or authentication and sends the
+// message data it receives on the returned channel
+func fakeSMTPServer(t *testing.T) (config.EmailConfig, <-chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250 localhost")
+			case command == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				messages <- data.String()
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return config.EmailConfig{Host: host, Port: portNumber, From: "no-reply@example.com", Timeout: 5}, messages
+}
+
+func TestSMTPSenderSendsMessage(t *testing.T) {
+	cfg, messages := fakeSMTPServer(t)
+
+	err := email.NewSMTPSender(cfg).Send(context.Background(), "user@example.com", "Your verification code", "Your verification code is 123456.")
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	message := <-messages
+	for _, want := range []string{"From: no-reply@example.com", "To: user@example.com", "Subject: Your verification code", "Your verification code is 123456."} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message = %q, want it to contain %q", message, want)
+		}
+	}
+}
+
+func TestSMTPSenderRejectsHeaderInjection(t *testing.T) {
+	sender := email.NewSMTPSender(config.EmailConfig{Host: "127.0.0.1", Port: 1, From: "no-reply@example.com"})
+
+	err := sender.Send(context.Background(), "user@example.com\r\nBcc: victim@example.com", "Your verification code", "123456")
+	if err == nil {
+		t.Fatal("Send accepted an address with a line break")
+	}
+}
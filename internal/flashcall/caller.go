@@ -0,0 +1,118 @@
+// Package flashcall verifies phone numbers by flash call: a missed call placed from a number
+// ending in the OTP, whose last digits the client reads from its call log and submits as the code.
+package flashcall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/requestid"
+)
+
+// Provider types
+const (
+	ProviderLog  = "log"
+	ProviderHTTP = "http"
+)
+
+// Caller places flash calls
+type Caller interface {
+	// Call places a missed call to phoneNumber from callerID, a number ending in the OTP, and
+	// hangs up before it can be answered
+	Call(ctx context.Context, phoneNumber, callerID string) error
+}
+
+// CallerID returns the number the flash call of code is placed from: prefix followed by the code
+func CallerID(prefix, code string) string {
+	return prefix + code
+}
+
+// NewCaller creates the configured caller: an HTTP caller for the http provider, or a log
+// caller otherwise
+func NewCaller(cfg config.FlashCallConfig, logger *slog.Logger) Caller {
+	if cfg.Provider == ProviderHTTP {
+		return NewHTTPCaller(cfg.URL, cfg.Token, cfg.GetTimeout())
+	}
+	return NewLogCaller(logger)
+}
+
+// LogCaller is a Caller that writes calls to the server logs instead of placing them. The
+// caller ID ends in the OTP, so it is logged as the OTP, masked unless the logging
+// configuration reveals sensitive values.
+type LogCaller struct {
+	logger *slog.Logger
+}
+
+// NewLogCaller creates a new log caller
+func NewLogCaller(logger *slog.Logger) *LogCaller {
+	return &LogCaller{logger: logger}
+}
+
+// Call writes the call to the server logs
+func (c *LogCaller) Call(ctx context.Context, phoneNumber, callerID string) error {
+	logging.FromContext(ctx, c.logger).InfoContext(ctx, "Flash call placed",
+		"phone_number", phoneNumber,
+		"otp", callerID,
+	)
+	return nil
+}
+
+// HTTPCaller asks a telephony gateway to place flash calls, posting the phone number to call
+// and the caller ID to call from as JSON
+type HTTPCaller struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+// NewHTTPCaller creates a caller posting to the gateway at url, authenticating with token as a
+// bearer token if it isn't empty, whose requests time out after timeout
+func NewHTTPCaller(url, token string, timeout time.Duration) *HTTPCaller {
+	return &HTTPCaller{httpClient: &http.Client{Timeout: timeout}, url: url, token: token}
+}
+
+// callRequest is the body of the requests to the gateway
+type callRequest struct {
+	PhoneNumber string `json:"phone_number"`
+	CallerID    string `json:"caller_id"`
+}
+
+// Call asks the gateway to place the call. Any response other than 2xx is an error.
+func (c *HTTPCaller) Call(ctx context.Context, phoneNumber, callerID string) error {
+	body, err := json.Marshal(callRequest{PhoneNumber: phoneNumber, CallerID: callerID})
+	if err != nil {
+		return fmt.Errorf("error encoding flash call request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating flash call request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error placing flash call: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error placing flash call: gateway responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/flashcall"
+	"github.com/lilokie/otp-auth/internal/requestid"
+)
+
+func TestHTTPCaller(t *testing.T) {
+	var got struct {
+		PhoneNumber string `json:"phone_number"`
+		CallerID    string `json:"caller_id"`
+	}
+	var authorization, requestID string
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		requestID = r.Header.Get(requestid.Header)
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Decode: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	caller := flashcall.NewHTTPCaller(server.URL, "gateway-token", time.Second)
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	callerID := flashcall.CallerID("+98215550", "123456")
+	if err := caller.Call(ctx, "+989121234567", callerID); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got.PhoneNumber != "+989121234567" || got.CallerID != "+98215550123456" {
+		t.Fatalf("unexpected request %+v", got)
+	}
+	if authorization != "Bearer gateway-token" || requestID != "req-1" {
+		t.Fatalf("unexpected headers: Authorization %q, request ID %q", authorization, requestID)
+	}
+
+	status = http.StatusBadGateway
+	if err := caller.Call(ctx, "+989121234567", callerID); err == nil {
+		t.Fatal("expected an error for a failed call")
+	}
+}
@@ -0,0 +1,40 @@
+// Package geo carries the country a request comes from, as passed by the proxies in front of
+// the service, e.g. in Cloudflare's CF-IPCountry header
+package geo
+
+import (
+	"context"
+	"strings"
+)
+
+// unknownCountry is the code proxies pass for clients whose country they couldn't tell
+const unknownCountry = "XX"
+
+// contextKey is the type of the context key countries are stored under
+type contextKey struct{}
+
+// NormalizeCountry returns a country passed by a proxy as an upper case ISO 3166-1 alpha-2
+// code, or "" if it isn't one, such as XX for unknown and T1 for Tor
+func NormalizeCountry(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if len(country) != 2 || country == unknownCountry {
+		return ""
+	}
+	for i := 0; i < len(country); i++ {
+		if country[i] < 'A' || country[i] > 'Z' {
+			return ""
+		}
+	}
+	return country
+}
+
+// NewContext returns a copy of ctx carrying the country of a request
+func NewContext(ctx context.Context, country string) context.Context {
+	return context.WithValue(ctx, contextKey{}, country)
+}
+
+// CountryFromContext returns the country carried by ctx, or "" if it is unknown
+func CountryFromContext(ctx context.Context) string {
+	country, _ := ctx.Value(contextKey{}).(string)
+	return country
+}
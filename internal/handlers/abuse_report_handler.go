@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// AbuseReportHandler handles abuse report HTTP requests
+type AbuseReportHandler struct {
+	abuseReportService *service.AbuseReportService
+}
+
+// NewAbuseReportHandler creates a new abuse report handler
+func NewAbuseReportHandler(abuseReportService *service.AbuseReportService) *AbuseReportHandler {
+	return &AbuseReportHandler{abuseReportService: abuseReportService}
+}
+
+// Report handles reports of unsolicited OTP SMS
+// @Summary Report unsolicited OTP SMS
+// @Description Report OTP SMS a phone number received without asking for them, as its owner or carrier. No OTPs are sent to the phone number until an admin has reviewed the report
+// @Tags abuse
+// @Accept json
+// @Produce json
+// @Param request body models.AbuseReportRequest true "Phone number receiving unsolicited OTPs"
+// @Success 202 {object} models.AbuseReportResponse "Report received"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 429 {object} models.Problem "Rate limit exceeded"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Header 202,429 {integer} X-RateLimit-Limit "Requests allowed per window"
+// @Header 202,429 {integer} X-RateLimit-Remaining "Requests left in the current window"
+// @Header 202,429 {integer} X-RateLimit-Reset "Seconds until the rate limit resets"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Router /abuse-reports [post]
+func (h *AbuseReportHandler) Report(c *gin.Context) {
+	var req models.AbuseReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	report, err := h.abuseReportService.Report(c.Request.Context(), req, c.ClientIP())
+	if err != nil {
+		if err.Error() == "invalid phone number" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidPhoneNumber, "Invalid Iranian phone number format. Use +989XXXXXXXXX, 989XXXXXXXXX, or 09XXXXXXXXX")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error recording abuse report")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.AbuseReportResponse{
+		Message:  "Report received. No OTPs will be sent to this phone number until it has been reviewed",
+		ReportID: report.ID,
+	})
+}
+
+// ListReports handles listing abuse reports for review
+// @Summary List abuse reports
+// @Description List abuse reports oldest first, by default the pending ones awaiting review
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "pending (default), confirmed, dismissed or all"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 10)"
+// @Success 200 {object} models.AbuseReportsListResponse "Abuse reports"
+// @Failure 400 {object} models.Problem "Invalid status"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/abuse-reports [get]
+func (h *AbuseReportHandler) ListReports(c *gin.Context) {
+	var params models.AbuseReportListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		params = models.AbuseReportListParams{}
+	}
+
+	// Set defaults if not provided
+	switch params.Status {
+	case "":
+		params.Status = models.AbuseReportPending
+	case "all":
+		params.Status = ""
+	case models.AbuseReportPending, models.AbuseReportConfirmed, models.AbuseReportDismissed:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid status")
+		return
+	}
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 10
+	}
+
+	reports, totalCount, err := h.abuseReportService.ListReports(c.Request.Context(), params)
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing abuse reports")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AbuseReportsListResponse{
+		Reports:    reports,
+		TotalCount: totalCount,
+		Page:       params.Page,
+		PageSize:   params.PageSize,
+	})
+}
+
+// ReviewReport handles confirming or dismissing an abuse report
+// @Summary Review an abuse report
+// @Description Confirm a report to keep OTPs to the phone number suppressed, or dismiss it to send OTPs again. The other pending reports of the phone number are resolved the same way
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Abuse report ID"
+// @Param request body models.ReviewAbuseReportRequest true "Review decision"
+// @Success 200 {object} models.ReviewAbuseReportResponse "Report reviewed"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 404 {object} models.Problem "Abuse report not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/abuse-reports/{id} [put]
+func (h *AbuseReportHandler) ReviewReport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid abuse report ID")
+		return
+	}
+
+	var req models.ReviewAbuseReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	reviewed, err := h.abuseReportService.ReviewReport(c.Request.Context(), auditActor(c), id, req.Status)
+	if err != nil {
+		switch {
+		case err.Error() == "abuse report not found":
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "Abuse report not found")
+		case err.Error() == "invalid status":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid status")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error reviewing abuse report")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ReviewAbuseReportResponse{
+		Message:  "Abuse report " + req.Status,
+		Reviewed: reviewed,
+	})
+}
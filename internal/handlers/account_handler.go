@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// AccountHandler handles requests to delete accounts and export their data
+type AccountHandler struct {
+	accountService *service.AccountService
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+// DeleteMe handles deleting the authenticated user's account
+// @Summary Delete my account
+// @Description Delete the authenticated user's account, signing them out everywhere and revoking their trusted devices. An admin can restore the account within admin.restoreWindow hours; after that it is erased with its login history, backup codes and trusted devices.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MessageResponse "Account deleted"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me [delete]
+func (h *AccountHandler) DeleteMe(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.accountService.DeleteAccount(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error deleting account")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Account deleted"})
+}
+
+// ExportMe handles exporting the authenticated user's personal data
+// @Summary Export my data
+// @Description Download all personal data stored about the authenticated user as JSON: their profile, sign-in attempts, active sessions and trusted devices, and the domain events and admin actions about them or their phone number.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.AccountExport "Personal data"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me/export [get]
+func (h *AccountHandler) ExportMe(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	export, err := h.accountService.Export(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error exporting account data")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="account-export.json"`)
+	c.JSON(http.StatusOK, export)
+}
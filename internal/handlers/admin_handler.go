@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
+
+// AdminHandler handles admin-related HTTP requests
+type AdminHandler struct {
+	adminService *service.AdminService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+	return &AdminHandler{adminService: adminService}
+}
+
+// RestoreUser handles restoring a soft-deleted user
+// @Summary Restore a deleted user
+// @Description Un-delete a soft-deleted user if it is still within the configured restore window
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.RestoreUserResponse "User restored"
+// @Failure 400 {object} models.Problem "Invalid user ID"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 404 {object} models.Problem "Deleted user not found"
+// @Failure 410 {object} models.Problem "Restore window expired"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /admin/users/{id}/restore [post]
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	// Parse user ID from URL
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := h.adminService.RestoreUser(c.Request.Context(), auditActor(c), id)
+	if err != nil {
+		switch err.Error() {
+		case "deleted user not found":
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "Deleted user not found")
+		case "restore window expired":
+			apierror.Respond(c, http.StatusGone, apierror.Gone, "Restore window has expired")
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error restoring user")
+		}
+		return
+	}
+
+	response := models.RestoreUserResponse{
+		Message: "User restored successfully",
+		User:    userResponse(user),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSessions handles revoking all of a user's sessions
+// @Summary Revoke a user's sessions
+// @Description Revoke all of a user's sessions, signing the user out everywhere. This ends the sessions that keep a user from signing in from another country when sessions.countryConflicts is deny.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.RevokeSessionsResponse "Number of sessions revoked"
+// @Failure 400 {object} models.Problem "Invalid user ID"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/users/{id}/sessions [delete]
+func (h *AdminHandler) RevokeSessions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid user ID")
+		return
+	}
+
+	revoked, err := h.adminService.RevokeSessions(c.Request.Context(), auditActor(c), id)
+	if err != nil {
+		switch {
+		case err.Error() == "user not found":
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error revoking sessions")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RevokeSessionsResponse{Revoked: revoked})
+}
+
+// UpdateUserMetadata handles setting and removing metadata keys of a user
+// @Summary Update a user's metadata
+// @Description Set metadata keys of a user to string values and remove keys given as null; keys left out keep their value. Keys are 1 to 64 letters, digits, '_', '.' or '-', values at most 500 characters, and users have at most 50 keys. Users can be listed by metadata with metadata[key]=value. The change is recorded in the audit trail, without the values.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.UpdateMetadataRequest true "Metadata keys to set or remove"
+// @Success 200 {object} models.UserResponse "Updated user"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/{id}/metadata [patch]
+func (h *AdminHandler) UpdateUserMetadata(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid user ID")
+		return
+	}
+
+	var req models.UpdateMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	user, err := h.adminService.UpdateUserMetadata(c.Request.Context(), auditActor(c), id, req.Metadata)
+	if err != nil {
+		var validationErr *service.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+		case err.Error() == "user not found":
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error updating user metadata")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, userResponse(user))
+}
+
+// FlushRateLimits handles clearing the rate limit counters of a phone number
+// @Summary Flush rate limits for a phone number
+// @Description Clear every OTP rate limit counter kept for a phone number
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param phone path string true "Phone number"
+// @Success 200 {object} models.MessageResponse "Rate limits flushed"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /admin/rate-limits/{phone} [delete]
+func (h *AdminHandler) FlushRateLimits(c *gin.Context) {
+	phoneNumber := c.Param("phone")
+
+	if err := h.adminService.FlushRateLimits(c.Request.Context(), auditActor(c), phoneNumber); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error flushing rate limits")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Rate limits flushed"})
+}
+
+// ResendOTP handles re-sending the pending OTP of a phone number
+// @Summary Resend the pending OTP
+// @Description Re-deliver the pending OTP for a phone number without generating a new one
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param phone path string true "Phone number"
+// @Success 200 {object} models.MessageResponse "OTP resent"
+// @Failure 403 {object} models.Problem "Permission denied or phone number on the suppression list"
+// @Failure 404 {object} models.Problem "No pending OTP"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "SMS provider busy"
+// @Router /admin/otps/{phone}/resend [post]
+func (h *AdminHandler) ResendOTP(c *gin.Context) {
+	phoneNumber := c.Param("phone")
+
+	if err := h.adminService.ResendOTP(c.Request.Context(), auditActor(c), phoneNumber); err != nil {
+		if err.Error() == "no pending OTP" {
+			apierror.Respond(c, http.StatusNotFound, apierror.ChallengeNotFound, "No pending OTP for this phone number")
+			return
+		}
+		if errors.Is(err, sms.ErrPhoneSuppressed) {
+			apierror.Respond(c, http.StatusForbidden, apierror.PhoneSuppressed, phoneSuppressedMessage)
+			return
+		}
+		if errors.Is(err, sms.ErrProviderThrottled) || errors.Is(err, service.ErrSendQueueFull) {
+			apierror.Respond(c, http.StatusServiceUnavailable, apierror.ProviderBusy, providerBusyMessage)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error resending OTP")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "OTP resent"})
+}
+
+// ExpireOTPs handles force-expiring pending OTPs by phone prefix
+// @Summary Force-expire pending OTPs
+// @Description Delete all pending OTPs for phone numbers starting with the given prefix
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ExpireOTPsRequest true "Phone number prefix"
+// @Success 200 {object} models.ExpireOTPsResponse "OTPs expired"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /admin/otps/expire [post]
+func (h *AdminHandler) ExpireOTPs(c *gin.Context) {
+	var req models.ExpireOTPsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	expired, err := h.adminService.ExpireOTPs(c.Request.Context(), auditActor(c), req.Prefix)
+	if err != nil {
+		if err.Error() == "invalid phone prefix" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Prefix must contain only digits and an optional leading +")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error expiring OTPs")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ExpireOTPsResponse{Expired: expired})
+}
+
+// ListProviders handles listing SMS providers
+// @Summary List SMS providers
+// @Description List configured SMS providers, whether they are in rotation, and their recent error counts and quarantine
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.ProvidersResponse "SMS providers"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /admin/providers [get]
+func (h *AdminHandler) ListProviders(c *gin.Context) {
+	providers, err := h.adminService.ListProviders(c.Request.Context())
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing providers")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ProvidersResponse{Providers: providers})
+}
+
+// SetProviderState handles taking an SMS provider out of or back into rotation
+// @Summary Toggle an SMS provider
+// @Description Take an SMS provider out of rotation or put it back, ending any quarantine
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Provider name"
+// @Param request body models.SetProviderStateRequest true "Provider state"
+// @Success 200 {object} models.MessageResponse "Provider updated"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 404 {object} models.Problem "Provider not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /admin/providers/{name} [put]
+func (h *AdminHandler) SetProviderState(c *gin.Context) {
+	var req models.SetProviderStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	err := h.adminService.SetProviderEnabled(c.Request.Context(), auditActor(c), c.Param("name"), *req.Enabled)
+	if err != nil {
+		if err.Error() == "provider not found" {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "Provider not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error updating provider")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Provider updated"})
+}
+
+// auditActor builds the audit actor for the authenticated caller, a user or, for requests
+// authenticated with an API key, the key
+func auditActor(c *gin.Context) models.AuditActor {
+	actor := models.AuditActor{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if keyID, ok := c.Get("api_key_id"); ok {
+		if id, ok := keyID.(uuid.UUID); ok {
+			actor.ID = id
+			actor.Type = models.AuditActorAPIKey
+		}
+		return actor
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		if id, ok := userID.(uuid.UUID); ok {
+			actor.ID = id
+		}
+	}
+	return actor
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// APIKeyHandler handles API key HTTP requests
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+// CreateKey handles creating an API key
+// @Summary Create an API key
+// @Description Create an API key for a service to call /v1/users endpoints with in the X-API-Key header instead of a user's token. scopes are users:read, to get and list users, and users:metadata, to update their metadata. The key is only returned in this response. The creation is recorded in the audit trail.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateAPIKeyRequest true "Name and scopes of the key"
+// @Success 201 {object} models.CreateAPIKeyResponse "API key"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/api-keys [post]
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	key, err := h.apiKeyService.Create(c.Request.Context(), auditActor(c), req)
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error creating API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListKeys handles listing the API keys
+// @Summary List API keys
+// @Description List every API key, revoked ones included, newest first. The keys themselves are never returned, only their first characters.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIKeysResponse "API keys"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/api-keys [get]
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	keys, err := h.apiKeyService.List(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIKeysResponse{APIKeys: keys})
+}
+
+// RevokeKey handles revoking an API key
+// @Summary Revoke an API key
+// @Description Revoke an API key; requests with it are rejected from then on. The revocation is recorded in the audit trail.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Success 200 {object} models.MessageResponse "API key revoked"
+// @Failure 400 {object} models.Problem "Invalid API key ID"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 404 {object} models.Problem "API key not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid API key ID")
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(c.Request.Context(), auditActor(c), id); err != nil {
+		switch {
+		case err.Error() == "API key not found":
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "API key not found")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error revoking API key")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "API key revoked"})
+}
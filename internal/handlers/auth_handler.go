@@ -1,15 +1,33 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
 	"github.com/lilokie/otp-auth/internal/models"
 	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/silentauth"
+	"github.com/lilokie/otp-auth/internal/sms"
+	"github.com/lilokie/otp-auth/internal/validation"
 )
 
+// phoneSuppressedMessage explains why no OTP is sent to a suppressed phone number
+const phoneSuppressedMessage = "SMS delivery to this phone number is suppressed"
+
+// maxLoginStatusWait caps how long a long-poll for the login status waits for it to change
+const maxLoginStatusWait = 30 * time.Second
+
+// providerBusyMessage explains an OTP not sent because the SMS provider's or the OTP send queue is full
+const providerBusyMessage = "SMS provider busy, try again later"
+
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
 	authService *service.AuthService
@@ -22,118 +40,495 @@ func NewAuthHandler(authService *service.AuthService) *AuthHandler {
 
 // RequestOTP handles OTP request
 // @Summary Request OTP for a phone number
-// @Description Generate and send a one-time password to the provided phone number (OTP is printed to server logs)
+// @Description Generate and send a one-time password to the provided phone number (OTP is printed to server logs). The returned challenge ID identifies the OTP when verifying it and only works from the same IP address and user agent.
+// @Description If a valid device_token of one of the user's trusted devices is given, no OTP is sent and a JWT token and refresh token are returned right away; invalid device tokens fall back to sending an OTP.
+// @Description With silent set, the phone number is first verified with its carrier, by the number the carrier's enrichment proxy adds to requests over mobile data or by carrier_token, from the carrier's number verification flow, depending on silentAuth.provider. If the carrier confirms the number, the user signs in without an OTP as with a device token; if it can't tell or reports another number, the OTP is sent as usual.
+// @Description When CAPTCHA is enabled, IP addresses that made more requests than the configured threshold must send a solved CAPTCHA in captcha_token; requests without a valid one get 403 with captcha_required set.
+// @Description With channel set to email, and email enabled in otp.channels, the OTP is sent to the email address on the user's profile instead. With channel set to flash_call, and flashCall enabled in otp.channels, the phone number gets a missed call from a number ending in the OTP; the client submits the last digits of the calling number as the code. If an OTP is still pending on another channel, the configured duplicates policy either sends the same code, returning the same challenge, or invalidates it.
+// @Description With sms.overflow enabled, requests made while every SMS provider is throttled or the send queue is full get 202 with the OTP queued and estimated_delay, in seconds until it is sent, instead of 503.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body models.RequestOTPRequest true "Phone number to send OTP to"
-// @Success 200 {object} models.RequestOTPResponse "OTP sent successfully"
-// @Failure 400 {object} models.ErrorResponse "Invalid request"
-// @Failure 429 {object} models.ErrorResponse "Rate limit exceeded"
-// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Success 200 {object} models.RequestOTPResponse "OTP sent successfully, or signed in with a trusted device or by carrier verification"
+// @Success 202 {object} models.RequestOTPResponse "OTP queued while sending SMS is saturated"
+// @Failure 400 {object} models.Problem "Invalid request, channel not enabled, or no email address for the phone number"
+// @Failure 403 {object} models.CaptchaProblem "Phone number blocked or on the suppression list, or CAPTCHA required or invalid, or sign-in with a trusted device or by carrier verification denied or to a deleted account"
+// @Failure 409 {object} models.Problem "Sign-in with a trusted device or by carrier verification refused for a session active in another country, or another verification for the phone number in progress"
+// @Failure 429 {object} models.Problem "Rate limit exceeded, or too many OTPs waiting to be sent"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded, SMS provider busy or CAPTCHA verification unavailable"
+// @Header 200,429 {integer} X-RateLimit-Limit "Requests allowed per window"
+// @Header 200,429 {integer} X-RateLimit-Remaining "Requests left in the current window"
+// @Header 200,429 {integer} X-RateLimit-Reset "Seconds until the rate limit resets"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
 // @Router /auth/request-otp [post]
 func (h *AuthHandler) RequestOTP(c *gin.Context) {
 	var req models.RequestOTPRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request format")})
+		switch tag, _ := validation.FailedTag(err, "PhoneNumber"); tag {
+		case "required":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidPhoneNumber, "Phone number cannot be empty")
+		case validation.TagIranianMobile:
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidPhoneNumber, "Invalid Iranian phone number format. Use +989XXXXXXXXX, 989XXXXXXXXX, or 09XXXXXXXXX")
+		default:
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		}
 		return
 	}
 
 	phoneNumber := req.PhoneNumber
-	// Allow any non-empty phone number for testing purposes
-	if phoneNumber == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Phone number cannot be empty"})
-		return
+
+	// A trusted device signs in without an OTP
+	if req.DeviceToken != "" {
+		tokens, user, err := h.authService.SignInWithDevice(c.Request.Context(), phoneNumber, req.DeviceToken, c.ClientIP(), c.Request.UserAgent())
+		if err == nil {
+			c.Header("Cache-Control", "no-store")
+			c.JSON(http.StatusOK, models.RequestOTPResponse{
+				Message:      "Signed in with trusted device",
+				ServerTime:   time.Now().UTC(),
+				Token:        tokens.AccessToken,
+				RefreshToken: tokens.RefreshToken,
+				User:         user,
+			})
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		var deniedErr *service.HookDeniedError
+		if errors.As(err, &deniedErr) {
+			signInDenied(c, deniedErr)
+			return
+		}
+		if errors.Is(err, service.ErrCountryConflict) {
+			countryConflict(c)
+			return
+		}
+		if errors.Is(err, service.ErrVerificationInProgress) {
+			apierror.Respond(c, http.StatusConflict, apierror.VerificationInProgress, "Another verification for this phone number is in progress, try again")
+			return
+		}
+		// Send an OTP instead; sending it reports blocked phone numbers, verifying it lockouts
+		var lockoutErr *service.LockoutError
+		if err.Error() != "invalid device token" && err.Error() != "phone number blocked" && !errors.As(err, &lockoutErr) {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error signing in with trusted device")
+			return
+		}
 	}
 
-	// Validate Iranian phone number format: must start with +98, 98, or 09 and be 13, 12, or 11 digits respectively
-	if !(strings.HasPrefix(phoneNumber, "+98") && len(phoneNumber) == 13) &&
-		!(strings.HasPrefix(phoneNumber, "98") && len(phoneNumber) == 12) &&
-		!(strings.HasPrefix(phoneNumber, "09") && len(phoneNumber) == 11) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Iranian phone number format. Use +989XXXXXXXXX, 989XXXXXXXXX, or 09XXXXXXXXX"})
-		return
+	// A phone number the carrier verifies signs in without an OTP; clients the carrier can't
+	// verify, e.g. on Wi-Fi, are sent one instead
+	if req.Silent {
+		tokens, user, err := h.authService.SignInSilently(c.Request.Context(), phoneNumber, req.CarrierToken, c.ClientIP(), c.Request.UserAgent())
+		if err == nil {
+			c.Header("Cache-Control", "no-store")
+			c.JSON(http.StatusOK, models.RequestOTPResponse{
+				Message:      "Signed in with the phone number verified by the carrier",
+				ServerTime:   time.Now().UTC(),
+				Token:        tokens.AccessToken,
+				RefreshToken: tokens.RefreshToken,
+				User:         user,
+			})
+			return
+		}
+		var deniedErr *service.HookDeniedError
+		var lockoutErr *service.LockoutError
+		switch {
+		case errors.Is(err, silentauth.ErrUnavailable), errors.Is(err, service.ErrNotVerified), errors.As(err, &lockoutErr),
+			err.Error() == "phone number blocked":
+			// Send an OTP instead; sending it reports blocked phone numbers, verifying it lockouts
+		case err.Error() == "account deleted":
+			apierror.Respond(c, http.StatusForbidden, apierror.AccountDeleted, "Account has been deleted")
+			return
+		case errors.As(err, &deniedErr):
+			signInDenied(c, deniedErr)
+			return
+		case errors.Is(err, service.ErrVerificationInProgress):
+			apierror.Respond(c, http.StatusConflict, apierror.VerificationInProgress, "Another verification for this phone number is in progress, try again")
+			return
+		case errors.Is(err, service.ErrCountryConflict):
+			countryConflict(c)
+			return
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error signing in with carrier verification")
+			return
+		}
 	}
 
-	// Generate OTP
-	otp, err := h.authService.GenerateOTP(c.Request.Context(), phoneNumber)
+	// Generate and send OTP
+	channel := req.Channel
+	if channel == "" {
+		channel = models.ChannelSMS
+	}
+	challenge, err := h.authService.GenerateOTPVia(c.Request.Context(), phoneNumber, channel, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
+		if errors.Is(err, service.ErrChannelDisabled) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "OTPs cannot be sent over this channel")
+			return
+		}
+		if errors.Is(err, service.ErrNoEmailAddress) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "No email address for this phone number")
+			return
+		}
 		if err.Error() == "rate limit exceeded" {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.RateLimited, "Rate limit exceeded")
+			return
+		}
+		if err.Error() == "phone number blocked" {
+			apierror.Respond(c, http.StatusForbidden, apierror.PhoneBlocked, "OTPs cannot be sent to this phone number")
+			return
+		}
+		if errors.Is(err, sms.ErrPhoneSuppressed) {
+			apierror.Respond(c, http.StatusForbidden, apierror.PhoneSuppressed, phoneSuppressedMessage)
+			return
+		}
+		if errors.Is(err, sms.ErrProviderThrottled) || errors.Is(err, service.ErrSendQueueFull) {
+			apierror.Respond(c, http.StatusServiceUnavailable, apierror.ProviderBusy, providerBusyMessage)
+			return
+		}
+		var backlogErr *service.SendBacklogError
+		if errors.As(err, &backlogErr) {
+			retryLater(c, apierror.SendBacklogged, "Too many OTPs are waiting to be sent, try again later", backlogErr.RetryAfter)
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error generating OTP: %v", err)})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, fmt.Sprintf("Error generating OTP: %v", err))
 		return
 	}
 
-	// Print OTP to console log instead of returning it in the response
-	fmt.Printf("[OTP] Phone: %s, Code: %s\n", phoneNumber, otp)
-
 	// Return response without OTP
 	response := models.RequestOTPResponse{
-		Message: "OTP sent successfully. Check server logs for the code.",
+		Message:      "OTP sent successfully. Check server logs for the code.",
+		ChallengeID:  challenge.ID,
+		OTPExpiresAt: &challenge.ExpiresAt,
+		ServerTime:   time.Now().UTC(),
+	}
+	if challenge.SendDelay > 0 {
+		response.Message = "OTP queued, sending SMS is saturated"
+		response.EstimatedDelay = int(challenge.SendDelay / time.Second)
+		c.JSON(http.StatusAccepted, response)
+		return
 	}
 	c.JSON(http.StatusOK, response)
 }
 
+// ResendOTP handles re-sending the OTP of a pending challenge
+// @Summary Resend the OTP of a challenge
+// @Description Re-send the existing unexpired OTP of a challenge, at most once per resend cooldown
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResendOTPRequest true "Challenge to resend the OTP of"
+// @Success 200 {object} models.MessageResponse "OTP resent successfully"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 403 {object} models.Problem "Phone number on the suppression list"
+// @Failure 404 {object} models.Problem "No pending OTP"
+// @Failure 429 {object} models.RetryAfterProblem "Resend cooldown active"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded or SMS provider busy"
+// @Router /auth/resend-otp [post]
+func (h *AuthHandler) ResendOTP(c *gin.Context) {
+	var req models.ResendOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	err := h.authService.ResendOTP(c.Request.Context(), req.ChallengeID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if err.Error() == "no pending OTP" {
+			apierror.Respond(c, http.StatusNotFound, apierror.ChallengeNotFound, "No pending OTP, request a new one")
+			return
+		}
+		var cooldownErr *service.ResendCooldownError
+		if errors.As(err, &cooldownErr) {
+			retryLater(c, apierror.ResendCooldown, "OTP was sent recently, try again later", cooldownErr.RetryAfter)
+			return
+		}
+		if errors.Is(err, sms.ErrPhoneSuppressed) {
+			apierror.Respond(c, http.StatusForbidden, apierror.PhoneSuppressed, phoneSuppressedMessage)
+			return
+		}
+		if errors.Is(err, sms.ErrProviderThrottled) || errors.Is(err, service.ErrSendQueueFull) {
+			apierror.Respond(c, http.StatusServiceUnavailable, apierror.ProviderBusy, providerBusyMessage)
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error resending OTP")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "OTP resent successfully"})
+}
+
+// OTPStatus handles looking up the delivery status of a challenge's OTP
+// @Summary Get the delivery status of an OTP
+// @Description Report whether the latest send of a challenge's OTP was delivered to the phone, according to the SMS provider's delivery receipt: "sent" until a receipt arrives, then "delivered" or "failed". Clients can offer to resend the OTP once it failed. Only the IP address and user agent the challenge was issued to can look it up.
+// @Tags auth
+// @Produce json
+// @Param challenge_id path string true "Challenge ID"
+// @Success 200 {object} models.OTPStatusResponse "Delivery status"
+// @Failure 404 {object} models.Problem "No pending OTP"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /auth/otp-status/{challenge_id} [get]
+func (h *AuthHandler) OTPStatus(c *gin.Context) {
+	delivery, err := h.authService.OTPStatus(c.Request.Context(), c.Param("challenge_id"), c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if err.Error() == "invalid challenge" {
+			apierror.Respond(c, http.StatusNotFound, apierror.ChallengeNotFound, "No pending OTP, request a new one")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting OTP status")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OTPStatusResponse{
+		ChallengeID: delivery.ChallengeID,
+		Status:      delivery.Status,
+		UpdatedAt:   delivery.UpdatedAt,
+	})
+}
+
+// LoginStatus handles streaming the login status of a challenge
+// @Summary Stream the login status of a challenge
+// @Description Stream Server-Sent Events with the login status of a challenge, so clients waiting for it to be verified, e.g. in another tab, are notified without polling. A "status" event with the current status is sent at once, followed by one on each change; the stream ends once the challenge is verified, or at the server's request timeout, after which EventSource clients reconnect. Only the IP address and user agent the challenge was issued to can follow it.
+// @Tags auth
+// @Produce text/event-stream
+// @Param challenge_id path string true "Challenge ID"
+// @Success 200 {object} models.LoginStatusResponse "Stream of status events"
+// @Failure 404 {object} models.Problem "No pending OTP"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /auth/login-status/{challenge_id} [get]
+func (h *AuthHandler) LoginStatus(c *gin.Context) {
+	statuses, err := h.authService.WatchLoginStatus(c.Request.Context(), c.Param("challenge_id"), c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if err.Error() == "invalid challenge" {
+			apierror.Respond(c, http.StatusNotFound, apierror.ChallengeNotFound, "No pending OTP, request a new one")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting login status")
+		return
+	}
+
+	// Keep proxies from buffering the stream
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		status, ok := <-statuses
+		if !ok {
+			return false
+		}
+		c.SSEvent("status", models.LoginStatusResponse{
+			ChallengeID: status.ChallengeID,
+			Status:      status.Status,
+			UpdatedAt:   status.UpdatedAt,
+		})
+		return true
+	})
+}
+
+// PollLoginStatus handles long-polling the login status of a challenge
+// @Summary Long-poll the login status of a challenge
+// @Description Get the login status of a challenge, for clients that can't use the login-status event stream. With wait, a pending challenge is held for up to wait seconds (at most 30) and the response is sent as soon as it is verified, or with the pending status once the wait is over. Only the IP address and user agent the challenge was issued to can look it up.
+// @Tags auth
+// @Produce json
+// @Param challenge_id path string true "Challenge ID"
+// @Param wait query int false "Seconds to wait for a pending challenge to be verified"
+// @Success 200 {object} models.LoginStatusResponse "Login status"
+// @Failure 400 {object} models.Problem "Invalid wait"
+// @Failure 404 {object} models.Problem "No pending OTP"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /auth/status/{challenge_id} [get]
+func (h *AuthHandler) PollLoginStatus(c *gin.Context) {
+	var wait time.Duration
+	if value := c.Query("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid wait, expected a number of seconds")
+			return
+		}
+		wait = min(time.Duration(seconds)*time.Second, maxLoginStatusWait)
+	}
+
+	status, err := h.authService.PollLoginStatus(c.Request.Context(), c.Param("challenge_id"), c.ClientIP(), c.Request.UserAgent(), wait)
+	if err != nil {
+		if err.Error() == "invalid challenge" {
+			apierror.Respond(c, http.StatusNotFound, apierror.ChallengeNotFound, "No pending OTP, request a new one")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting login status")
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, models.LoginStatusResponse{
+		ChallengeID: status.ChallengeID,
+		Status:      status.Status,
+		UpdatedAt:   status.UpdatedAt,
+	})
+}
+
 // VerifyOTP handles OTP verification
-// @Summary Verify OTP for a phone number
-// @Description Verify the OTP provided for a phone number and return a JWT token
+// @Summary Verify the OTP of a challenge
+// @Description Verify the OTP of a challenge issued to the same IP address and user agent and start a session, returning its JWT token and refresh token.
+// @Description Users who cannot receive SMS can give one of their backup codes instead of the OTP.
+// @Description With trust_device, a device token is returned as well; giving it to request-otp later signs in from this device without an OTP.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param request body models.VerifyOTPRequest true "Phone number and OTP to verify"
+// @Param request body models.VerifyOTPRequest true "Challenge ID and OTP or backup code to verify"
 // @Success 200 {object} models.VerifyOTPResponse "OTP verified successfully"
-// @Failure 400 {object} models.ErrorResponse "Invalid request"
-// @Failure 401 {object} models.ErrorResponse "Invalid or expired OTP"
-// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 401 {object} models.OTPProblem "Invalid or expired OTP"
+// @Failure 403 {object} models.Problem "Account deleted or sign-in denied"
+// @Failure 409 {object} models.Problem "Another verification for the phone number in progress, or a session active in another country"
+// @Failure 429 {object} models.RetryAfterProblem "Too many failed attempts"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
 // @Router /auth/verify-otp [post]
 func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 	var req models.VerifyOTPRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		errorMessage := "Invalid request format"
-		// Provide more specific error message based on validation failure
-		if err.Error() == "Key: 'VerifyOTPRequest.PhoneNumber' Error:Field validation for 'PhoneNumber' failed on the 'iranianMobile' tag" {
-			errorMessage = "Invalid phone number format. Use Iranian mobile format: +989XXXXXXXXX, 09XXXXXXXXX, or 9XXXXXXXXX"
-		} else if err.Error() == "Key: 'VerifyOTPRequest.OTP' Error:Field validation for 'OTP' failed on the 'len' tag" {
-			errorMessage = "OTP must be exactly 6 digits"
-		} else if err.Error() == "Key: 'VerifyOTPRequest.OTP' Error:Field validation for 'OTP' failed on the 'numeric' tag" {
-			errorMessage = "OTP must contain only numbers"
-		}
-		c.JSON(http.StatusBadRequest, gin.H{"error": errorMessage})
+		if tag, _ := validation.FailedTag(err, "OTP"); tag == validation.TagOTPCode {
+			errorMessage = "OTP must be the digits of the code sent by SMS"
+		}
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, errorMessage)
 		return
 	}
 
-	phoneNumber := req.PhoneNumber
-	// Allow any non-empty phone number for testing purposes
-	if phoneNumber == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Phone number cannot be empty"})
-		return
-	}
-	// Validate Iranian phone number format: must start with +98, 98, or 09 and be 13, 12, or 11 digits respectively
-	if !(strings.HasPrefix(phoneNumber, "+98") && len(phoneNumber) == 13) &&
-		!(strings.HasPrefix(phoneNumber, "98") && len(phoneNumber) == 12) &&
-		!(strings.HasPrefix(phoneNumber, "09") && len(phoneNumber) == 11) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Iranian phone number format. Use +989XXXXXXXXX, 989XXXXXXXXX, or 09XXXXXXXXX"})
-		return
+	// Verify OTP, falling back to a backup code when no OTP was given
+	var tokens *models.SessionTokens
+	var user *models.User
+	var err error
+	if req.OTP != "" {
+		tokens, user, err = h.authService.VerifyOTP(c.Request.Context(), req.ChallengeID, req.OTP, c.ClientIP(), c.Request.UserAgent())
+	} else {
+		tokens, user, err = h.authService.VerifyBackupCode(c.Request.Context(), req.ChallengeID, req.BackupCode, c.ClientIP(), c.Request.UserAgent())
 	}
-
-	// Verify OTP
-	token, user, err := h.authService.VerifyOTP(c.Request.Context(), phoneNumber, req.OTP)
 	if err != nil {
-		if err.Error() == "invalid OTP" || err.Error() == "error retrieving OTP: OTP not found or expired" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired OTP"})
+		var invalidErr *service.InvalidOTPError
+		if errors.As(err, &invalidErr) {
+			extensions := gin.H{"server_time": time.Now().UTC()}
+			if !invalidErr.ExpiresAt.IsZero() {
+				extensions["otp_expires_at"] = invalidErr.ExpiresAt
+			}
+			apierror.RespondWith(c, http.StatusUnauthorized, apierror.OTPInvalid, "Invalid or expired OTP", extensions)
+			return
+		}
+		if err.Error() == "invalid challenge" {
+			apierror.RespondWith(c, http.StatusUnauthorized, apierror.OTPExpired, "Invalid or expired OTP", gin.H{"server_time": time.Now().UTC()})
+			return
+		}
+		if err.Error() == "account deleted" {
+			apierror.Respond(c, http.StatusForbidden, apierror.AccountDeleted, "Account has been deleted")
+			return
+		}
+		var deniedErr *service.HookDeniedError
+		if errors.As(err, &deniedErr) {
+			signInDenied(c, deniedErr)
+			return
+		}
+		var lockoutErr *service.LockoutError
+		if errors.As(err, &lockoutErr) {
+			retryLater(c, apierror.OTPLocked, "Too many failed attempts, try again later", lockoutErr.RetryAfter)
+			return
+		}
+		if errors.Is(err, service.ErrVerificationInProgress) {
+			apierror.Respond(c, http.StatusConflict, apierror.VerificationInProgress, "Another verification for this phone number is in progress, try again")
+			return
+		}
+		if errors.Is(err, service.ErrCountryConflict) {
+			countryConflict(c)
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error verifying OTP: %v", err)})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, fmt.Sprintf("Error verifying OTP: %v", err))
 		return
 	}
 
 	// Return response
 	response := models.VerifyOTPResponse{
-		Token: token,
-		User:  *user,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		User:         *user,
+	}
+
+	if req.TrustDevice {
+		deviceToken, err := h.authService.TrustDevice(c.Request.Context(), user, req.DeviceName, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			if err.Error() == "trusted devices disabled" {
+				apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Trusted devices are disabled")
+				return
+			}
+			if errors.Is(err, concurrency.ErrLimitExceeded) {
+				apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+				return
+			}
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error trusting device")
+			return
+		}
+		response.DeviceToken = deviceToken
 	}
+
+	// The refresh and device tokens are only returned here, they must not end up in caches
+	c.Header("Cache-Control", "no-store")
 	c.JSON(http.StatusOK, response)
 }
+
+// signInDenied responds with 403 Forbidden to a sign-in refused by a hook, with its reason if it gave one
+func signInDenied(c *gin.Context, err *service.HookDeniedError) {
+	message := "Sign-in denied"
+	if err.Reason != "" {
+		message = err.Reason
+	}
+	apierror.Respond(c, http.StatusForbidden, apierror.SignInDenied, message)
+}
+
+// countryConflict responds with 409 Conflict to a sign-in refused for a session active in another country
+func countryConflict(c *gin.Context) {
+	apierror.Respond(c, http.StatusConflict, apierror.SessionInOtherCountry, "Signed in from another country; sign out there first")
+}
+
+// retryLater responds with 429 Too Many Requests, telling the client when to retry
+// both in the Retry-After header and in the body
+func retryLater(c *gin.Context, code, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	apierror.RespondWith(c, http.StatusTooManyRequests, code, message, gin.H{"retry_after": seconds})
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// BackupCodeHandler handles backup code HTTP requests
+type BackupCodeHandler struct {
+	backupCodeService *service.BackupCodeService
+}
+
+// NewBackupCodeHandler creates a new backup code handler
+func NewBackupCodeHandler(backupCodeService *service.BackupCodeService) *BackupCodeHandler {
+	return &BackupCodeHandler{backupCodeService: backupCodeService}
+}
+
+// GenerateBackupCodes handles generating backup codes for the authenticated user
+// @Summary Generate backup codes
+// @Description Generate a new set of one-time backup codes for the authenticated user, invalidating any earlier set. Each code can be used once instead of an OTP when verifying a challenge.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.BackupCodesResponse "Backup codes, shown only once"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me/backup-codes [post]
+func (h *BackupCodeHandler) GenerateBackupCodes(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	codes, err := h.backupCodeService.GenerateBackupCodes(c.Request.Context(), userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error generating backup codes")
+		return
+	}
+
+	// Codes must not end up in caches, they are only ever shown here
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.BackupCodesResponse{Codes: codes})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// DeliveryHandler handles OTP delivery receipt HTTP requests
+type DeliveryHandler struct {
+	deliveryService *service.DeliveryService
+}
+
+// NewDeliveryHandler creates a new delivery handler
+func NewDeliveryHandler(deliveryService *service.DeliveryService) *DeliveryHandler {
+	return &DeliveryHandler{deliveryService: deliveryService}
+}
+
+// DeliveryReceipt handles delivery receipts (DLRs) from SMS providers
+// @Summary SMS provider delivery receipt
+// @Description Updates the delivery status of the OTP sent as the given message to "delivered" or "failed". Other statuses, and receipts for unknown, expired or superseded messages, are acknowledged and ignored
+// @Tags sms
+// @Accept json
+// @Produce json
+// @Param name path string true "SMS provider name"
+// @Param X-Callback-Token header string true "The provider's callback token"
+// @Param request body models.DeliveryReceiptRequest true "Delivery receipt"
+// @Success 204 "Receipt processed"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 401 {object} models.Problem "Invalid callback token"
+// @Failure 404 {object} models.Problem "Unknown provider"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /providers/{name}/dlr [post]
+func (h *DeliveryHandler) DeliveryReceipt(c *gin.Context) {
+	var req models.DeliveryReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	err := h.deliveryService.HandleDeliveryReceipt(c.Request.Context(), c.Param("name"), c.GetHeader(callbackTokenHeader), req)
+	if err != nil {
+		switch {
+		case err.Error() == "unknown provider":
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "Unknown provider")
+		case err.Error() == "invalid callback token":
+			apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid callback token")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error processing delivery receipt")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// ImportHandler handles user import HTTP requests
+type ImportHandler struct {
+	importService *service.ImportService
+}
+
+// NewImportHandler creates a new import handler
+func NewImportHandler(importService *service.ImportService) *ImportHandler {
+	return &ImportHandler{importService: importService}
+}
+
+// ImportUsers handles importing a batch of users
+// @Summary Import users
+// @Description Create users for phone numbers that are not taken yet, optionally marked as verified by another system
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ImportUsersRequest true "Users to import"
+// @Success 200 {object} models.ImportUsersResponse "Per-user import results"
+// @Failure 400 {object} models.Problem "Invalid request or batch too large"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/users/import [post]
+func (h *ImportHandler) ImportUsers(c *gin.Context) {
+	var req models.ImportUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	response, err := h.importService.ImportUsers(c.Request.Context(), auditActor(c), req.Users)
+	if err != nil {
+		if err.Error() == "batch too large" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Too many users in batch")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error importing users")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
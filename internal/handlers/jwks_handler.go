@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// JWKSHandler publishes the public keys access tokens are signed with
+type JWKSHandler struct {
+	tokenSigner *service.TokenSigner
+}
+
+// NewJWKSHandler creates a new JWKS handler
+func NewJWKSHandler(tokenSigner *service.TokenSigner) *JWKSHandler {
+	return &JWKSHandler{tokenSigner: tokenSigner}
+}
+
+// GetJWKS handles getting the JSON Web Key Set access tokens verify with
+// @Summary Get the access token signing keys
+// @Description Get the public keys of the KMS keys access tokens are signed with, as a JSON Web Key Set; empty if tokens are signed with a shared secret
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{} "JSON Web Key Set"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	keys, err := h.tokenSigner.PublicKeys(c.Request.Context())
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting signing keys")
+		return
+	}
+
+	// Keys only change with configuration, so verifiers can cache them for a while
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// MaintenanceHandler handles maintenance notice HTTP requests
+type MaintenanceHandler struct {
+	maintenanceService *service.MaintenanceService
+}
+
+// NewMaintenanceHandler creates a new maintenance handler
+func NewMaintenanceHandler(maintenanceService *service.MaintenanceService) *MaintenanceHandler {
+	return &MaintenanceHandler{maintenanceService: maintenanceService}
+}
+
+// ListNotices handles listing the maintenance notices
+// @Summary List maintenance notices
+// @Description Return the maintenance notices that have not ended, by start time
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MaintenanceNoticesResponse "Maintenance notices"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /admin/maintenance-notices [get]
+func (h *MaintenanceHandler) ListNotices(c *gin.Context) {
+	notices, err := h.maintenanceService.List(c.Request.Context())
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing maintenance notices")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MaintenanceNoticesResponse{Notices: notices})
+}
+
+// CreateNotice handles announcing a maintenance window
+// @Summary Announce a maintenance window
+// @Description Announce planned downtime between starts_at and ends_at to clients, through GET /meta/status and, if enabled, the X-Maintenance-Notice response header. severity is info (default), warning or critical
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateMaintenanceNoticeRequest true "Maintenance window to announce"
+// @Success 201 {object} models.MaintenanceNotice "Maintenance notice"
+// @Failure 400 {object} models.Problem "Invalid request or window"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /admin/maintenance-notices [post]
+func (h *MaintenanceHandler) CreateNotice(c *gin.Context) {
+	var req models.CreateMaintenanceNoticeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	notice, err := h.maintenanceService.Create(c.Request.Context(), auditActor(c), req)
+	if err != nil {
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error creating maintenance notice")
+		return
+	}
+
+	c.JSON(http.StatusCreated, notice)
+}
+
+// DeleteNotice handles withdrawing a maintenance notice
+// @Summary Withdraw a maintenance notice
+// @Description Withdraw a maintenance notice, e.g. when the maintenance is called off or finished early
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Maintenance notice ID"
+// @Success 200 {object} models.MessageResponse "Maintenance notice withdrawn"
+// @Failure 400 {object} models.Problem "Invalid maintenance notice ID"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 404 {object} models.Problem "Maintenance notice not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /admin/maintenance-notices/{id} [delete]
+func (h *MaintenanceHandler) DeleteNotice(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid maintenance notice ID")
+		return
+	}
+
+	deleted, err := h.maintenanceService.Delete(c.Request.Context(), auditActor(c), id)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error deleting maintenance notice")
+		return
+	}
+	if !deleted {
+		apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "Maintenance notice not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Maintenance notice withdrawn"})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// MetaHandler describes the API itself
+type MetaHandler struct {
+	maintenanceService *service.MaintenanceService
+}
+
+// NewMetaHandler creates a new meta handler
+func NewMetaHandler(maintenanceService *service.MaintenanceService) *MetaHandler {
+	return &MetaHandler{maintenanceService: maintenanceService}
+}
+
+// ErrorCatalog handles listing the error codes
+// @Summary List error codes
+// @Description List every machine-readable code returned as code in error responses, with the HTTP status it comes with and its meaning. Clients should branch on codes rather than on error messages, which may change.
+// @Tags meta
+// @Produce json
+// @Success 200 {object} models.ErrorCatalogResponse "Error codes"
+// @Router /meta/errors [get]
+func (h *MetaHandler) ErrorCatalog(c *gin.Context) {
+	// The catalog only changes with deployments
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, models.ErrorCatalogResponse{Errors: apierror.Catalog()})
+}
+
+// ServerTime handles getting the server's time
+// @Summary Get the server time
+// @Description Get the server's current time, so clients with skewed clocks can correct countdowns to otp_expires_at
+// @Tags meta
+// @Produce json
+// @Success 200 {object} models.ServerTimeResponse "Server time"
+// @Router /meta/time [get]
+func (h *MetaHandler) ServerTime(c *gin.Context) {
+	now := time.Now().UTC()
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.ServerTimeResponse{ServerTime: now, UnixMillis: now.UnixMilli()})
+}
+
+// Status handles getting the status of the service
+// @Summary Get the service status
+// @Description Get the maintenance windows that are in progress or upcoming, by start time, so clients can show banners before planned downtime. status is maintenance while a window is in progress and ok otherwise
+// @Tags meta
+// @Produce json
+// @Success 200 {object} models.ServiceStatusResponse "Service status"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Router /meta/status [get]
+func (h *MetaHandler) Status(c *gin.Context) {
+	notices, err := h.maintenanceService.Current(c.Request.Context())
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting maintenance notices")
+		return
+	}
+
+	now := time.Now().UTC()
+	status := models.ServiceStatusOK
+	for i := range notices {
+		if notices[i].Active(now) {
+			status = models.ServiceStatusMaintenance
+			break
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.ServiceStatusResponse{Status: status, ServerTime: now, Notices: notices})
+}
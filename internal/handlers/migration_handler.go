@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// MigrationHandler handles legacy user migration HTTP requests
+type MigrationHandler struct {
+	migrationService *service.MigrationService
+}
+
+// NewMigrationHandler creates a new migration handler
+func NewMigrationHandler(migrationService *service.MigrationService) *MigrationHandler {
+	return &MigrationHandler{migrationService: migrationService}
+}
+
+// MigrateLegacyUsers handles exchanging a signed batch of legacy users for tokens
+// @Summary Migrate legacy users
+// @Description Exchange a batch of legacy users signed by the legacy system for users and tokens in this system
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.MigrateLegacyUsersRequest true "Signed batch of legacy users"
+// @Success 200 {object} models.MigrateLegacyUsersResponse "Per-user migration results"
+// @Failure 400 {object} models.Problem "Invalid request or batch too large"
+// @Failure 401 {object} models.Problem "Invalid or expired signature"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 501 {object} models.Problem "Legacy migration not configured"
+// @Router /admin/migrations/legacy-users [post]
+func (h *MigrationHandler) MigrateLegacyUsers(c *gin.Context) {
+	var req models.MigrateLegacyUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	response, err := h.migrationService.MigrateLegacyUsers(c.Request.Context(), auditActor(c), &req)
+	if err != nil {
+		switch err.Error() {
+		case "legacy migration disabled":
+			apierror.Respond(c, http.StatusNotImplemented, apierror.NotImplemented, "Legacy migration is not configured")
+		case "batch too large":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Too many users in batch")
+		case "invalid signature":
+			apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid batch signature")
+		case "signature expired":
+			apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Batch signature has expired")
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error migrating users")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// PhoneListHandler handles phone number blocklist and allowlist HTTP requests
+type PhoneListHandler struct {
+	phoneListService *service.PhoneListService
+}
+
+// NewPhoneListHandler creates a new phone list handler
+func NewPhoneListHandler(phoneListService *service.PhoneListService) *PhoneListHandler {
+	return &PhoneListHandler{phoneListService: phoneListService}
+}
+
+// ListEntries handles listing the blocklist and allowlist
+// @Summary List blocked and allowed phone numbers
+// @Description Return every blocklist and allowlist entry, ordered by list and prefix
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.PhoneListResponse "Blocklist and allowlist entries"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/blocklist [get]
+func (h *PhoneListHandler) ListEntries(c *gin.Context) {
+	entries, err := h.phoneListService.List(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing phone lists")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PhoneListResponse{Entries: entries})
+}
+
+// AddEntry handles putting a phone number or prefix on the blocklist or allowlist
+// @Summary Block or allow a phone number or prefix
+// @Description Put a phone number, or a prefix matching every phone number starting with it, on the blocklist (default) or the allowlist. No OTPs are sent to blocked phone numbers; in allowlist-only mode they are only sent to allowed ones
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.AddPhoneListEntryRequest true "Entry to add"
+// @Success 200 {object} models.AddPhoneListEntryResponse "Whether the entry was added"
+// @Failure 400 {object} models.Problem "Invalid request, list or prefix"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/blocklist [post]
+func (h *PhoneListHandler) AddEntry(c *gin.Context) {
+	var req models.AddPhoneListEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	added, err := h.phoneListService.Add(c.Request.Context(), auditActor(c), req.List, req.Prefix, req.Reason)
+	if err != nil {
+		switch {
+		case err.Error() == "invalid list":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid list, use block or allow")
+		case err.Error() == "invalid phone prefix":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid phone prefix")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error adding phone list entry")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AddPhoneListEntryResponse{Added: added})
+}
+
+// RemoveEntry handles taking a phone number or prefix off the blocklist or allowlist
+// @Summary Unblock or disallow a phone number or prefix
+// @Description Take a phone number or prefix off the blocklist (default) or the allowlist
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.RemovePhoneListEntryRequest true "Entry to remove"
+// @Success 200 {object} models.RemovePhoneListEntryResponse "Whether the entry was removed"
+// @Failure 400 {object} models.Problem "Invalid request, list or prefix"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/blocklist [delete]
+func (h *PhoneListHandler) RemoveEntry(c *gin.Context) {
+	var req models.RemovePhoneListEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	removed, err := h.phoneListService.Remove(c.Request.Context(), auditActor(c), req.List, req.Prefix)
+	if err != nil {
+		switch {
+		case err.Error() == "invalid list":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid list, use block or allow")
+		case err.Error() == "invalid phone prefix":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid phone prefix")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error removing phone list entry")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RemovePhoneListEntryResponse{Removed: removed})
+}
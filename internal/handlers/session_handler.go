@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// SessionHandler handles session HTTP requests
+type SessionHandler struct {
+	sessionService *service.SessionService
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sessionService *service.SessionService) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService}
+}
+
+// RefreshToken handles refreshing the tokens of a session
+// @Summary Refresh tokens
+// @Description Exchange a session's refresh token for a new JWT token and a new refresh token. Each refresh token can be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.RefreshTokenResponse "Tokens refreshed"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 401 {object} models.Problem "Invalid refresh token"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /auth/refresh [post]
+func (h *SessionHandler) RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	tokens, err := h.sessionService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if err.Error() == "invalid refresh token" {
+			apierror.Respond(c, http.StatusUnauthorized, apierror.RefreshTokenInvalid, "Invalid or expired refresh token")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error refreshing tokens")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.RefreshTokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	})
+}
+
+// ListSessions handles listing the authenticated user's sessions
+// @Summary List sessions
+// @Description List the authenticated user's active sessions, newest first, marking the session the request was made with as current
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SessionsResponse "Active sessions"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me/sessions [get]
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+	// Tokens issued before sessions existed belong to no session
+	value, _ = c.Get("session_id")
+	sessionID, _ := value.(uuid.UUID)
+
+	sessions, err := h.sessionService.ListSessions(c.Request.Context(), userID, sessionID)
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SessionsResponse{Sessions: sessions})
+}
+
+// RevokeSessions handles revoking all of the authenticated user's sessions
+// @Summary Revoke all sessions
+// @Description Revoke all of the authenticated user's sessions, the current one included, signing the user out everywhere. Their JWT and refresh tokens stop being accepted.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.RevokeSessionsResponse "Number of sessions revoked"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me/sessions [delete]
+func (h *SessionHandler) RevokeSessions(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error revoking sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RevokeSessionsResponse{Revoked: revoked})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// callbackTokenHeader carries the callback token SMS providers authenticate their callbacks with
+const callbackTokenHeader = "X-Callback-Token"
+
+// SuppressionHandler handles suppression list HTTP requests
+type SuppressionHandler struct {
+	suppressionService *service.SuppressionService
+}
+
+// NewSuppressionHandler creates a new suppression handler
+func NewSuppressionHandler(suppressionService *service.SuppressionService) *SuppressionHandler {
+	return &SuppressionHandler{suppressionService: suppressionService}
+}
+
+// ProviderCallback handles delivery status callbacks from SMS providers
+// @Summary SMS provider delivery status callback
+// @Description Puts the phone number on the suppression list when the user replied STOP (status "stop") or the carrier could not deliver to it (status "undeliverable"). Other statuses are acknowledged and ignored
+// @Tags sms
+// @Accept json
+// @Produce json
+// @Param provider path string true "SMS provider name"
+// @Param X-Callback-Token header string true "The provider's callback token"
+// @Param request body models.ProviderCallbackRequest true "Delivery status"
+// @Success 204 "Callback processed"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 401 {object} models.Problem "Invalid callback token"
+// @Failure 404 {object} models.Problem "Unknown provider"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /sms/callbacks/{provider} [post]
+func (h *SuppressionHandler) ProviderCallback(c *gin.Context) {
+	var req models.ProviderCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	err := h.suppressionService.HandleProviderCallback(c.Request.Context(), c.Param("provider"), c.GetHeader(callbackTokenHeader), req)
+	if err != nil {
+		switch {
+		case err.Error() == "unknown provider":
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "Unknown provider")
+		case err.Error() == "invalid callback token":
+			apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid callback token")
+		case err.Error() == "invalid phone number":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidPhoneNumber, "Invalid phone number")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error processing callback")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ImportSuppressions handles importing entries into the suppression list
+// @Summary Import suppression list entries
+// @Description Add phone numbers to the suppression list, e.g. opt-outs collected by another system
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ImportSuppressionsRequest true "Entries to import"
+// @Success 200 {object} models.ImportSuppressionsResponse "Per-entry import results"
+// @Failure 400 {object} models.Problem "Invalid request or batch too large"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/suppressions/import [post]
+func (h *SuppressionHandler) ImportSuppressions(c *gin.Context) {
+	var req models.ImportSuppressionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	response, err := h.suppressionService.Import(c.Request.Context(), auditActor(c), req.Suppressions)
+	if err != nil {
+		if err.Error() == "batch too large" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Too many entries in batch")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error importing suppressions")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportSuppressions handles exporting the suppression list
+// @Summary Export the suppression list
+// @Description Return every suppression list entry, oldest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuppressionsResponse "Suppression list"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/suppressions/export [get]
+func (h *SuppressionHandler) ExportSuppressions(c *gin.Context) {
+	suppressions, err := h.suppressionService.Export(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error exporting suppressions")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuppressionsResponse{Suppressions: suppressions})
+}
+
+// RemoveSuppression handles taking a phone number off the suppression list
+// @Summary Remove a phone number from the suppression list
+// @Description Remove a phone number's suppression list entry for one reason, or all of its entries if no reason is given
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param phone path string true "Phone number"
+// @Param reason query string false "opted_out, carrier_bounce or abuse_report"
+// @Success 200 {object} models.RemoveSuppressionResponse "Entries removed"
+// @Failure 400 {object} models.Problem "Invalid phone number or reason"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/suppressions/{phone} [delete]
+func (h *SuppressionHandler) RemoveSuppression(c *gin.Context) {
+	removed, err := h.suppressionService.Remove(c.Request.Context(), auditActor(c), c.Param("phone"), c.Query("reason"))
+	if err != nil {
+		switch {
+		case err.Error() == "invalid phone number":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidPhoneNumber, "Invalid phone number")
+		case err.Error() == "invalid reason":
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid reason")
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error removing suppression")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RemoveSuppressionResponse{Removed: removed})
+}
@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/handlers"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/middleware"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
+
+// newRestoreRouter routes POST /admin/users/:id/restore to an admin handler restoring users
+// deleted up to restoreWindow hours ago, as the admin adminID
+func newRestoreRouter(userRepo *repository.InMemoryUserRepository, auditRepo *repository.InMemoryAuditRepository, restoreWindow int, adminID uuid.UUID) *gin.Engine {
+	unitOfWork := repository.NewInMemoryUnitOfWork(userRepo, auditRepo, repository.NewInMemoryEventRepository(), repository.NewInMemoryLoginHistoryRepository())
+	cfg := &config.Config{Admin: config.AdminConfig{RestoreWindow: restoreWindow}}
+	adminService := service.NewAdminService(userRepo, unitOfWork, nil, nil, nil, nil, nil, nil, service.NewAuditService(auditRepo), cfg)
+	adminHandler := handlers.NewAdminHandler(adminService)
+
+	router := gin.New()
+	router.POST("/admin/users/:id/restore", func(c *gin.Context) {
+		c.Set("user_id", adminID)
+		c.Next()
+	}, adminHandler.RestoreUser)
+	return router
+}
+
+func TestRestoreUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	auditRepo := repository.NewInMemoryAuditRepository()
+	adminID := uuid.New()
+	router := newRestoreRouter(userRepo, auditRepo, 24, adminID)
+
+	user, _ := userRepo.Create(ctx, "+15550001")
+	if err := userRepo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/"+user.ID.String()+"/restore", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var response models.RestoreUserResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.User.ID != user.ID {
+		t.Fatalf("expected the restored user, got %s", w.Body.String())
+	}
+	if _, err := userRepo.FindByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected the user restored: %v", err)
+	}
+
+	// The restore is audited as done by the admin
+	entries, _, _ := auditRepo.ListByTarget(ctx, service.AuditTargetUser, user.ID.String(), 10)
+	if len(entries) != 1 || entries[0].Action != service.AuditActionUserRestore || entries[0].ActorID == nil || *entries[0].ActorID != adminID {
+		t.Fatalf("expected a user.restore entry by the admin, got %+v", entries)
+	}
+}
+
+func TestRestoreUserErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+
+	active, _ := userRepo.Create(ctx, "+15550001")
+	deleted, _ := userRepo.Create(ctx, "+15550002")
+	if err := userRepo.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		id            string
+		restoreWindow int
+		status        int
+	}{
+		{"invalid ID", "not-a-uuid", 24, http.StatusBadRequest},
+		{"active user", active.ID.String(), 24, http.StatusNotFound},
+		{"unknown user", uuid.NewString(), 24, http.StatusNotFound},
+		{"window expired", deleted.ID.String(), 0, http.StatusGone},
+	}
+	for _, tt := range tests {
+		router := newRestoreRouter(userRepo, repository.NewInMemoryAuditRepository(), tt.restoreWindow, uuid.New())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/"+tt.id+"/restore", nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.status, w.Body.String())
+		}
+	}
+	if _, err := userRepo.FindDeletedByID(ctx, deleted.ID); err != nil {
+		t.Fatalf("expected the user deleted past the window to stay deleted: %v", err)
+	}
+}
+
+// newRunbookRouter routes the runbook endpoints as the server does, behind JWT authentication
+// and their permissions, granting roles the given permissions. It returns the router and a
+// function issuing an access token to a new user with a role.
+func newRunbookRouter(t *testing.T, permissions map[string][]string) (*gin.Engine, func(role string) string) {
+	t.Helper()
+	ctx := context.Background()
+
+	cfg := &config.Config{
+		JWT:   config.JWTConfig{Secret: "test-secret", ExpirationHours: 1},
+		Admin: config.AdminConfig{Permissions: permissions},
+	}
+	userRepo := repository.NewInMemoryUserRepository()
+	otpRepo := repository.NewInMemoryOTPRepository()
+	eventService := service.NewEventService(repository.NewInMemoryEventRepository())
+	sessions := service.NewSessionService(repository.NewInMemorySessionRepository(), userRepo, eventService, service.NewTokenSigner(cfg, nil), cfg)
+
+	limiter, err := ratelimit.NewMemoryLimiter("")
+	if err != nil {
+		t.Fatalf("NewMemoryLimiter: %v", err)
+	}
+	providers, err := sms.NewProviders(nil, logging.Discard())
+	if err != nil {
+		t.Fatalf("NewProviders: %v", err)
+	}
+	sender := sms.NewSender(providers, repository.NewInMemoryProviderStateRepository(), repository.NewInMemorySuppressionRepository(), cfg.SMS.Failover, logging.Discard())
+	deliveries := service.NewDeliveryService(repository.NewInMemoryOTPDeliveryRepository(), repository.NewInMemoryOTPSendQueueRepository(), otpRepo, sender, metrics.NewRegistry(), cfg, logging.Discard())
+	adminService := service.NewAdminService(userRepo, nil, otpRepo,
+		ratelimit.NewPolicy(limiter, 3, time.Minute), ratelimit.NewPolicy(limiter, 3, time.Minute),
+		sender, deliveries, sessions, service.NewAuditService(repository.NewInMemoryAuditRepository()), cfg)
+	adminHandler := handlers.NewAdminHandler(adminService)
+	jwtMiddleware := middleware.NewJWTAuthMiddleware(cfg, service.NewTokenSigner(cfg, nil), sessions)
+
+	router := gin.New()
+	admin := router.Group("/admin")
+	admin.Use(jwtMiddleware.AuthRequired())
+	admin.DELETE("/rate-limits/:phone", jwtMiddleware.PermissionRequired(models.PermissionRateLimitFlush), adminHandler.FlushRateLimits)
+	admin.POST("/otps/:phone/resend", jwtMiddleware.PermissionRequired(models.PermissionOTPResend), adminHandler.ResendOTP)
+	admin.POST("/otps/expire", jwtMiddleware.PermissionRequired(models.PermissionOTPExpire), adminHandler.ExpireOTPs)
+	admin.GET("/providers", jwtMiddleware.PermissionRequired(models.PermissionProviderToggle), adminHandler.ListProviders)
+	admin.PUT("/providers/:name", jwtMiddleware.PermissionRequired(models.PermissionProviderToggle), adminHandler.SetProviderState)
+
+	phoneNumber := 0
+	issue := func(role string) string {
+		phoneNumber++
+		user, err := userRepo.Create(ctx, fmt.Sprintf("+1555000%04d", phoneNumber))
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		user.Role = role
+		tokens, err := sessions.Start(ctx, user, "203.0.113.1", "otp-test")
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		return tokens.AccessToken
+	}
+	return router, issue
+}
+
+func TestRunbookPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, issue := newRunbookRouter(t, map[string][]string{
+		models.RoleOperator: {models.PermissionRateLimitFlush, models.PermissionOTPResend, models.PermissionOTPExpire},
+	})
+	tokens := map[string]string{
+		models.RoleAdmin:    issue(models.RoleAdmin),
+		models.RoleOperator: issue(models.RoleOperator),
+		models.RoleUser:     issue(models.RoleUser),
+	}
+
+	routes := []struct {
+		method, path, body string
+		permission         string
+		status             int // answered once the permission is granted
+	}{
+		{http.MethodDelete, "/admin/rate-limits/+15550001", "", models.PermissionRateLimitFlush, http.StatusOK},
+		// No OTP is pending, which callers are only told once allowed
+		{http.MethodPost, "/admin/otps/+15550001/resend", "", models.PermissionOTPResend, http.StatusNotFound},
+		{http.MethodPost, "/admin/otps/expire", `{"prefix":"+1555"}`, models.PermissionOTPExpire, http.StatusOK},
+		{http.MethodGet, "/admin/providers", "", models.PermissionProviderToggle, http.StatusOK},
+		{http.MethodPut, "/admin/providers/log", `{"enabled":true}`, models.PermissionProviderToggle, http.StatusOK},
+	}
+	for _, route := range routes {
+		// Operators are granted every runbook permission but toggling providers
+		operator := route.status
+		if route.permission == models.PermissionProviderToggle {
+			operator = http.StatusForbidden
+		}
+		callers := []struct {
+			name, token string
+			status      int
+		}{
+			{"admin", tokens[models.RoleAdmin], route.status},
+			{"operator", tokens[models.RoleOperator], operator},
+			{"user", tokens[models.RoleUser], http.StatusForbidden},
+			{"unauthenticated", "", http.StatusUnauthorized},
+		}
+
+		for _, caller := range callers {
+			req := httptest.NewRequest(route.method, route.path, strings.NewReader(route.body))
+			req.Header.Set("Content-Type", "application/json")
+			if caller.token != "" {
+				req.Header.Set("Authorization", "Bearer "+caller.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != caller.status {
+				t.Errorf("%s %s as %s: status = %d, want %d: %s", route.method, route.path, caller.name, w.Code, caller.status, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/handlers"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestListMyLoginsIgnoresUserCursors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	loginRepo := repository.NewInMemoryLoginHistoryRepository()
+
+	me, _ := userRepo.Create(ctx, "+15550001")
+	other, _ := userRepo.Create(ctx, "+15550002")
+	if err := loginRepo.Record(ctx, &models.LoginAttempt{
+		ID:          uuid.New(),
+		UserID:      &me.ID,
+		PhoneNumber: me.PhoneNumber,
+		Method:      "otp",
+		Success:     true,
+		CreatedAt:   time.Now(),
+	}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	userHandler := handlers.NewUserHandler(service.NewUserService(userRepo, loginRepo, nil, &config.Config{}), service.NewAuditService(repository.NewInMemoryAuditRepository()))
+	router := gin.New()
+	router.GET("/users/me/logins", func(c *gin.Context) {
+		c.Set("user_id", me.ID)
+		c.Next()
+	}, userHandler.ListMyLogins)
+
+	// A cursor of the user listing must not turn the login history into the user directory
+	cursor := repository.UserCursor(other)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/me/logins?limit=10&cursor="+cursor, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, ok := body["users"]; ok {
+		t.Fatalf("expected no users in the login history, got %s", w.Body.String())
+	}
+	var logins []models.LoginAttempt
+	if err := json.Unmarshal(body["logins"], &logins); err != nil || len(logins) != 1 {
+		t.Fatalf("expected the user's one login, got %s", w.Body.String())
+	}
+}
+
+func TestAPIKeyReadsAudited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	auditRepo := repository.NewInMemoryAuditRepository()
+	user, _ := userRepo.Create(ctx, "+15550001")
+	keyID := uuid.New()
+
+	cfg := &config.Config{Pagination: config.PaginationConfig{MaxPageSize: 100}}
+	userHandler := handlers.NewUserHandler(service.NewUserService(userRepo, repository.NewInMemoryLoginHistoryRepository(), nil, cfg), service.NewAuditService(auditRepo))
+	// Stands in for the API key middleware, authenticating requests with a key as the key
+	// and the others as the user
+	authenticate := func(c *gin.Context) {
+		if c.GetHeader("X-API-Key") != "" {
+			c.Set("api_key_id", keyID)
+		} else {
+			c.Set("user_id", user.ID)
+		}
+		c.Next()
+	}
+	router := gin.New()
+	router.GET("/users/:id", authenticate, userHandler.GetUser)
+	router.GET("/users", authenticate, userHandler.ListUsers)
+
+	read := func(path, apiKey string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want 200: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	// Reads by users aren't recorded
+	read("/users/"+user.ID.String(), "")
+	read("/users", "")
+	if entries, total, _ := auditRepo.ListByTarget(ctx, service.AuditTargetUser, user.ID.String(), 10); total != 0 {
+		t.Fatalf("expected no audit entries for reads by users, got %+v", entries)
+	}
+
+	read("/users/"+user.ID.String(), "otpk_billing")
+	entries, _, _ := auditRepo.ListByTarget(ctx, service.AuditTargetUser, user.ID.String(), 10)
+	if len(entries) != 1 || entries[0].Action != service.AuditActionUserRead ||
+		entries[0].ActorType != models.AuditActorAPIKey || entries[0].ActorID == nil || *entries[0].ActorID != keyID {
+		t.Fatalf("expected a user.read entry by the API key, got %+v", entries)
+	}
+
+	// Listings by each kind of pagination are recorded with the users returned
+	for _, query := range []string{"?page=1", "?include_total=false", "?limit=10"} {
+		read("/users"+query, "otpk_billing")
+	}
+	entries, _, _ = auditRepo.ListByTarget(ctx, service.AuditTargetUserList, "", 10)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 user.list entries, got %+v", entries)
+	}
+	for _, entry := range entries {
+		var metadata struct {
+			UserIDs []string `json:"user_ids"`
+		}
+		if err := json.Unmarshal(entry.Metadata, &metadata); err != nil {
+			t.Fatalf("decode metadata: %v", err)
+		}
+		if entry.Action != service.AuditActionUserList || entry.ActorType != models.AuditActorAPIKey ||
+			len(metadata.UserIDs) != 1 || metadata.UserIDs[0] != user.ID.String() {
+			t.Fatalf("expected a user.list entry by the API key naming the user, got %+v (%s)", entry, entry.Metadata)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// TimelineHandler handles requests for users' auth timelines
+type TimelineHandler struct {
+	timelineService *service.TimelineService
+}
+
+// NewTimelineHandler creates a new timeline handler
+func NewTimelineHandler(timelineService *service.TimelineService) *TimelineHandler {
+	return &TimelineHandler{timelineService: timelineService}
+}
+
+// GetUserTimeline handles getting a user's auth timeline
+// @Summary Get a user's auth timeline
+// @Description List what happened to a user, deleted or not, newest first: admin actions from the audit log, domain events, sign-in attempts with why they failed, and active sessions. Entries about the user's phone number are included from before the user signed up.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 20, at most pagination.maxPageSize)"
+// @Success 200 {object} models.UserTimelineResponse "User timeline"
+// @Failure 400 {object} models.Problem "Invalid user ID or pagination parameters"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/users/{id}/timeline [get]
+func (h *TimelineHandler) GetUserTimeline(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid user ID")
+		return
+	}
+
+	var params models.PaginationParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid pagination parameters")
+		return
+	}
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 20
+	}
+
+	entries, totalCount, err := h.timelineService.GetTimeline(c.Request.Context(), id, params)
+	if err != nil {
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting user timeline")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserTimelineResponse{
+		UserID:     id,
+		Entries:    entries,
+		TotalCount: totalCount,
+		Page:       params.Page,
+		PageSize:   params.PageSize,
+	})
+}
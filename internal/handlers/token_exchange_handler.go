@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// TokenExchangeHandler handles token exchange HTTP requests
+type TokenExchangeHandler struct {
+	tokenExchangeService *service.TokenExchangeService
+}
+
+// NewTokenExchangeHandler creates a new token exchange handler
+func NewTokenExchangeHandler(tokenExchangeService *service.TokenExchangeService) *TokenExchangeHandler {
+	return &TokenExchangeHandler{tokenExchangeService: tokenExchangeService}
+}
+
+// Exchange handles exchanging a user's token for an audience-restricted downstream token
+// @Summary Exchange a user token (RFC 8693)
+// @Description Exchange a user's token for a short-lived token restricted to one downstream service. Only trusted services identified by an API key may call it, and only for their configured audiences and scopes
+// @Tags auth
+// @Accept x-www-form-urlencoded,json
+// @Produce json
+// @Param X-API-Key header string true "API key of the calling service"
+// @Param request body models.TokenExchangeRequest true "Token exchange request"
+// @Success 200 {object} models.TokenExchangeResponse "Exchanged token"
+// @Failure 400 {object} models.OAuthErrorResponse "Invalid request, grant, target or scope"
+// @Failure 401 {object} models.OAuthErrorResponse "Invalid API key"
+// @Failure 500 {object} models.OAuthErrorResponse "Internal server error"
+// @Failure 501 {object} models.OAuthErrorResponse "Token exchange not configured"
+// @Failure 503 {object} models.OAuthErrorResponse "Service overloaded"
+// @Router /auth/token-exchange [post]
+func (h *TokenExchangeHandler) Exchange(c *gin.Context) {
+	// Token responses must not be cached (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req models.TokenExchangeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.OAuthErrorResponse{
+			Error:            "invalid_request",
+			ErrorDescription: "grant_type, subject_token, subject_token_type and audience are required",
+		})
+		return
+	}
+
+	response, err := h.tokenExchangeService.Exchange(c.Request.Context(), c.GetHeader("X-API-Key"), &req)
+	if err != nil {
+		var exchangeErr *service.TokenExchangeError
+		switch {
+		case errors.As(err, &exchangeErr):
+			status := http.StatusBadRequest
+			if exchangeErr.Code == "invalid_client" {
+				status = http.StatusUnauthorized
+			}
+			c.JSON(status, models.OAuthErrorResponse{Error: exchangeErr.Code, ErrorDescription: exchangeErr.Description})
+		case err.Error() == "token exchange disabled":
+			c.JSON(http.StatusNotImplemented, models.OAuthErrorResponse{Error: "server_error", ErrorDescription: "Token exchange is not configured"})
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			if retryAfter := concurrency.RetryAfter(err); retryAfter > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			}
+			c.JSON(http.StatusServiceUnavailable, models.OAuthErrorResponse{Error: "temporarily_unavailable", ErrorDescription: "Service overloaded, try again later"})
+		default:
+			c.JSON(http.StatusInternalServerError, models.OAuthErrorResponse{Error: "server_error", ErrorDescription: "Error exchanging token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
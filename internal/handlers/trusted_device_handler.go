@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// TrustedDeviceHandler handles trusted device HTTP requests
+type TrustedDeviceHandler struct {
+	trustedDeviceService *service.TrustedDeviceService
+}
+
+// NewTrustedDeviceHandler creates a new trusted device handler
+func NewTrustedDeviceHandler(trustedDeviceService *service.TrustedDeviceService) *TrustedDeviceHandler {
+	return &TrustedDeviceHandler{trustedDeviceService: trustedDeviceService}
+}
+
+// ListDevices handles listing the authenticated user's trusted devices
+// @Summary List trusted devices
+// @Description List the authenticated user's active trusted devices, newest first. Their device tokens are never returned.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TrustedDevicesResponse "Trusted devices"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me/devices [get]
+func (h *TrustedDeviceHandler) ListDevices(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	devices, err := h.trustedDeviceService.ListDevices(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing trusted devices")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TrustedDevicesResponse{Devices: devices})
+}
+
+// RevokeDevice handles revoking one of the authenticated user's trusted devices
+// @Summary Revoke a trusted device
+// @Description Revoke one of the authenticated user's trusted devices; signing in from it needs an OTP again.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Trusted device ID"
+// @Success 200 {object} models.MessageResponse "Trusted device revoked"
+// @Failure 400 {object} models.Problem "Invalid device ID"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 404 {object} models.Problem "Trusted device not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me/devices/{id} [delete]
+func (h *TrustedDeviceHandler) RevokeDevice(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	deviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid device ID")
+		return
+	}
+
+	if err := h.trustedDeviceService.RevokeDevice(c.Request.Context(), userID, deviceID); err != nil {
+		if err.Error() == "trusted device not found" {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "Trusted device not found")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error revoking trusted device")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Trusted device revoked"})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// UniqueIPHandler handles requests for unique client IP statistics
+type UniqueIPHandler struct {
+	uniqueIPService *service.UniqueIPService
+}
+
+// NewUniqueIPHandler creates a new unique IP handler
+func NewUniqueIPHandler(uniqueIPService *service.UniqueIPService) *UniqueIPHandler {
+	return &UniqueIPHandler{uniqueIPService: uniqueIPService}
+}
+
+// GetUniqueIPs handles counting the distinct client IPs per endpoint on a day
+// @Summary Get unique client IPs per endpoint
+// @Description Estimate how many distinct client IPs requested each endpoint on a UTC day, to spot distributed abuse campaigns
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param date query string false "UTC day as YYYY-MM-DD (default: today)"
+// @Success 200 {object} models.UniqueIPStats "Unique IPs per endpoint"
+// @Failure 400 {object} models.Problem "Invalid date"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/stats/unique-ips [get]
+func (h *UniqueIPHandler) GetUniqueIPs(c *gin.Context) {
+	day := time.Now().UTC()
+	if date := c.Query("date"); date != "" {
+		parsed, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid date, expected YYYY-MM-DD")
+			return
+		}
+		day = parsed
+	}
+
+	stats, err := h.uniqueIPService.GetUniqueIPStats(c.Request.Context(), day)
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting unique IP stats")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
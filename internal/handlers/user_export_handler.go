@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// exportColumns are the columns of CSV exports, in the order of the JSONL fields
+var exportColumns = []string{
+	"id", "phone_number", "role", "phone_verified", "verified_source", "analytics_consent",
+	"first_name", "last_name", "email", "avatar_url", "metadata", "created_at",
+}
+
+// UserExportHandler handles user export HTTP requests
+type UserExportHandler struct {
+	exportService *service.UserExportService
+	timeout       time.Duration
+}
+
+// NewUserExportHandler creates a new user export handler whose exports may stream for up to
+// timeout, rather than the request timeout
+func NewUserExportHandler(exportService *service.UserExportService, timeout time.Duration) *UserExportHandler {
+	return &UserExportHandler{exportService: exportService, timeout: timeout}
+}
+
+// ExportUsers handles exporting users
+// @Summary Export users
+// @Description Stream every user matching the filters, newest first unless order is asc, as CSV with a header row or as JSONL, a JSON object per line. The response is sent in chunks as users are read, so exports of any size can be downloaded; if an export fails partway, the connection is closed before the response is complete. Exports are recorded in the audit trail.
+// @Tags admin
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Param format query string false "csv (default) or jsonl"
+// @Param search query string false "Search term for phone number"
+// @Param order query string false "Order by creation time: desc (default) or asc"
+// @Param created_after query string false "Only users created at or after this RFC 3339 time"
+// @Param created_before query string false "Only users created before this RFC 3339 time"
+// @Param metadata[key] query string false "Only users with the metadata key set to this value; repeat for other keys"
+// @Success 200 {array} models.ExportedUser "Users"
+// @Failure 400 {object} models.Problem "Invalid export parameters"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/users/export [get]
+func (h *UserExportHandler) ExportUsers(c *gin.Context) {
+	var params models.PaginationParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid export parameters")
+		return
+	}
+	params.Metadata = c.QueryMap("metadata")
+	format := c.DefaultQuery("format", models.UserExportFormatCSV)
+
+	// Exports outlast the request timeout, and keep going until the client stops reading
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), h.timeout)
+	defer cancel()
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(h.timeout))
+
+	var encoder userEncoder
+	write := func(users []models.User) error {
+		if encoder == nil {
+			encoder = startUserExport(c, format)
+		}
+		for i := range users {
+			if err := encoder.encode(exportedUser(&users[i])); err != nil {
+				return err
+			}
+		}
+		if err := encoder.flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	_, err := h.exportService.Export(ctx, auditActor(c), format, params, write)
+	switch {
+	case err != nil && encoder != nil:
+		abortStream(c)
+	case err != nil:
+		var validationErr *service.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+		case errors.Is(err, concurrency.ErrLimitExceeded):
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error exporting users")
+		}
+	case encoder == nil:
+		// No users matched; the export is empty but for the CSV header
+		encoder = startUserExport(c, format)
+		_ = encoder.flush()
+	}
+}
+
+// startUserExport writes the headers of an export in format, and returns the encoder of its users
+func startUserExport(c *gin.Context, format string) userEncoder {
+	filename := "users-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	// Keep proxies from buffering the export
+	c.Header("X-Accel-Buffering", "no")
+
+	if format == models.UserExportFormatJSONL {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		return &jsonlEncoder{encoder: json.NewEncoder(c.Writer)}
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	encoder := &csvEncoder{writer: csv.NewWriter(c.Writer)}
+	_ = encoder.writer.Write(exportColumns)
+	return encoder
+}
+
+// abortStream closes the connection of a response that was already partly sent, so clients see
+// it end prematurely rather than take what was sent for the whole response
+func abortStream(c *gin.Context) {
+	conn, _, err := http.NewResponseController(c.Writer).Hijack()
+	if err == nil {
+		_ = conn.Close()
+	}
+}
+
+// exportedUser returns user as exported
+func exportedUser(user *models.User) models.ExportedUser {
+	exported := models.ExportedUser{
+		ID:               user.ID,
+		PhoneNumber:      user.PhoneNumber,
+		Role:             user.Role,
+		PhoneVerified:    user.PhoneVerified,
+		AnalyticsConsent: user.AnalyticsConsent,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Email:            user.Email,
+		AvatarURL:        user.AvatarURL,
+		Metadata:         user.Metadata,
+		CreatedAt:        user.CreatedAt.UTC(),
+	}
+	if exported.Metadata == nil {
+		exported.Metadata = map[string]string{}
+	}
+	if user.VerifiedSource != nil {
+		exported.VerifiedSource = *user.VerifiedSource
+	}
+	return exported
+}
+
+// userEncoder writes exported users in an export format
+type userEncoder interface {
+	encode(user models.ExportedUser) error
+	flush() error
+}
+
+// jsonlEncoder writes users as JSON objects, one per line
+type jsonlEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *jsonlEncoder) encode(user models.ExportedUser) error {
+	return e.encoder.Encode(user)
+}
+
+func (e *jsonlEncoder) flush() error {
+	return nil
+}
+
+// csvEncoder writes users as CSV rows of exportColumns, with the metadata as a JSON object
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvEncoder) encode(user models.ExportedUser) error {
+	metadata, err := json.Marshal(user.Metadata)
+	if err != nil {
+		return err
+	}
+	return e.writer.Write([]string{
+		user.ID.String(),
+		user.PhoneNumber,
+		user.Role,
+		strconv.FormatBool(user.PhoneVerified),
+		csvText(user.VerifiedSource),
+		strconv.FormatBool(user.AnalyticsConsent),
+		csvText(user.FirstName),
+		csvText(user.LastName),
+		csvText(user.Email),
+		csvText(user.AvatarURL),
+		string(metadata),
+		user.CreatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvEncoder) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// csvText returns a value users entered for a CSV cell, with values spreadsheets would run as
+// formulas prefixed by a quote, so exports opened in them can't run anything users put there
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
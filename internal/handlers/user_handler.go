@@ -1,22 +1,27 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
 	"github.com/lilokie/otp-auth/internal/models"
 	"github.com/lilokie/otp-auth/internal/service"
 )
 
 // UserHandler handles user-related HTTP requests
 type UserHandler struct {
-	userService *service.UserService
+	userService  *service.UserService
+	auditService *service.AuditService
 }
 
-// NewUserHandler creates a new user handler
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+// NewUserHandler creates a new user handler, recording reads of users with an API key to auditService
+func NewUserHandler(userService *service.UserService, auditService *service.AuditService) *UserHandler {
+	return &UserHandler{userService: userService, auditService: auditService}
 }
 
 // GetUser handles getting a user by ID
@@ -27,53 +32,76 @@ func NewUserHandler(userService *service.UserService) *UserHandler {
 // @Produce json
 // @Param id path string true "User ID"
 // @Success 200 {object} models.UserResponse "User details"
-// @Failure 400 {object} models.ErrorResponse "Invalid user ID"
-// @Failure 404 {object} models.ErrorResponse "User not found"
-// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Failure 400 {object} models.Problem "Invalid user ID"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
 // @Router /users/{id} [get]
 func (h *UserHandler) GetUser(c *gin.Context) {
 	// Parse user ID from URL
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid user ID")
 		return
 	}
 
 	// Get user by ID
 	user, err := h.userService.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting user")
 		return
 	}
 
-	// Return user
-	response := models.UserResponse{
-		ID:          user.ID,
-		PhoneNumber: user.PhoneNumber,
-		CreatedAt:   user.CreatedAt,
+	if !h.auditAPIKeyRead(c, service.AuditActionUserRead, service.AuditTargetUser, user.ID.String(), nil) {
+		return
 	}
-	c.JSON(http.StatusOK, response)
+
+	// Return user
+	c.JSON(http.StatusOK, userResponse(user))
 }
 
 // ListUsers handles listing users with pagination and search
 // @Summary List users
-// @Description List users with pagination and optional search
+// @Description List users with pagination and optional search, newest first unless sort_by and order say otherwise. Pages are selected with page and page_size; for large tables, pass limit and then each response's next_cursor as cursor instead, which skips counting total_count and sorts by created_at only.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number (default: 1)"
-// @Param page_size query int false "Page size (default: 10)"
-// @Param search query string false "Search term for phone number"
+// @Param page_size query int false "Page size (default: 10, at most pagination.maxPageSize)"
+// @Param cursor query string false "next_cursor of the previous page, for keyset pagination"
+// @Param limit query int false "Page size for keyset pagination (default: 10, at most pagination.maxPageSize)"
+// @Param search query string false "Search term for phone number (at most pagination.maxSearchLength characters)"
+// @Param sort_by query string false "Field to sort by: created_at (default) or phone_number"
+// @Param order query string false "Sort order: asc or desc (default)"
+// @Param created_after query string false "Only users created at or after this RFC 3339 time"
+// @Param created_before query string false "Only users created before this RFC 3339 time"
+// @Param metadata[key] query string false "Only users with the metadata key set to this value; repeat for other keys"
+// @Param include_total query string false "How total_count is counted: true (default), exactly; estimate, from the table statistics; or false, not at all. Without exact counts, has_more tells whether more pages follow"
 // @Success 200 {object} models.UsersListResponse "List of users"
-// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Failure 400 {object} models.Problem "Invalid pagination parameters"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
 // @Router /users [get]
 func (h *UserHandler) ListUsers(c *gin.Context) {
 	// Parse pagination parameters
 	var params models.PaginationParams
 	if err := c.ShouldBindQuery(&params); err != nil {
-		params.Page = 1
-		params.PageSize = 10
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid pagination parameters")
+		return
+	}
+	params.Metadata = c.QueryMap("metadata")
+	if params.Keyset() {
+		h.listUsersAfter(c, params)
+		return
 	}
 
 	// Set defaults if not provided
@@ -83,30 +111,341 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	if params.PageSize <= 0 {
 		params.PageSize = 10
 	}
+	if !params.Counted() {
+		h.listUsersUncounted(c, params)
+		return
+	}
 
 	// Get users
 	users, totalCount, err := h.userService.ListUsers(c.Request.Context(), params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing users"})
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing users")
+		return
+	}
+
+	if !h.auditAPIKeyList(c, users) {
 		return
 	}
 
 	// Map to response type
 	userResponses := make([]models.UserResponse, len(users))
 	for i, user := range users {
-		userResponses[i] = models.UserResponse{
-			ID:          user.ID,
-			PhoneNumber: user.PhoneNumber,
-			CreatedAt:   user.CreatedAt,
-		}
+		userResponses[i] = userResponse(&user)
 	}
 
 	// Return response
 	response := models.UsersListResponse{
 		Users:      userResponses,
+		TotalCount: &totalCount,
+		Page:       params.Page,
+		PageSize:   params.PageSize,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// listUsersUncounted handles listing a page of users without counting them exactly
+func (h *UserHandler) listUsersUncounted(c *gin.Context, params models.PaginationParams) {
+	users, estimate, hasMore, err := h.userService.ListUsersUncounted(c.Request.Context(), params)
+	if err != nil {
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing users")
+		return
+	}
+	if !h.auditAPIKeyList(c, users) {
+		return
+	}
+
+	userResponses := make([]models.UserResponse, len(users))
+	for i, user := range users {
+		userResponses[i] = userResponse(&user)
+	}
+	response := models.UsersListResponse{
+		Users:    userResponses,
+		Page:     params.Page,
+		PageSize: params.PageSize,
+		HasMore:  &hasMore,
+	}
+	if params.IncludeTotal == models.IncludeTotalEstimate {
+		response.TotalCount = &estimate
+		response.TotalEstimated = true
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// listUsersAfter handles listing users by keyset, after the cursor in params
+func (h *UserHandler) listUsersAfter(c *gin.Context, params models.PaginationParams) {
+	if params.Limit <= 0 {
+		params.Limit = 10
+	}
+
+	users, nextCursor, err := h.userService.ListUsersAfter(c.Request.Context(), params)
+	if err != nil {
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing users")
+		return
+	}
+	if !h.auditAPIKeyList(c, users) {
+		return
+	}
+
+	userResponses := make([]models.UserResponse, len(users))
+	for i, user := range users {
+		userResponses[i] = userResponse(&user)
+	}
+	c.JSON(http.StatusOK, models.UsersListResponse{
+		Users:      userResponses,
+		NextCursor: nextCursor,
+		Limit:      params.Limit,
+	})
+}
+
+// ListMyLogins handles listing the authenticated user's login history
+// @Summary List my logins
+// @Description List the authenticated user's successful and failed OTP and backup code verifications with the client's IP address and user agent, newest first
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 10, at most pagination.maxPageSize)"
+// @Success 200 {object} models.LoginHistoryResponse "Login history"
+// @Failure 400 {object} models.Problem "Invalid pagination parameters"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me/logins [get]
+func (h *UserHandler) ListMyLogins(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse pagination parameters
+	var params models.PaginationParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid pagination parameters")
+		return
+	}
+	// Set defaults if not provided
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 10
+	}
+
+	logins, totalCount, err := h.userService.ListLoginHistory(c.Request.Context(), userID, params)
+	if err != nil {
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error listing logins")
+		return
+	}
+
+	response := models.LoginHistoryResponse{
+		Logins:     logins,
 		TotalCount: totalCount,
 		Page:       params.Page,
 		PageSize:   params.PageSize,
 	}
 	c.JSON(http.StatusOK, response)
 }
+
+// UpdateMe handles updating the current user's profile
+// @Summary Update my profile
+// @Description Update the authenticated user's first name, last name, email and avatar URL. Only the fields given change; an empty string clears a field. The email is not verified.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UpdateProfileRequest true "Profile fields to change"
+// @Success 200 {object} models.UserResponse "Updated user"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me [put]
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(c.Request.Context(), userID, req)
+	if err != nil {
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, validationErr.Message)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error updating profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, userResponse(user))
+}
+
+// SetMyAnalyticsConsent handles giving or withdrawing the current user's consent to analytics
+// @Summary Set analytics consent
+// @Description Give or withdraw consent to analytics. Without consent, domain events about the user reach webhook endpoints feeding analytics anonymized or not at all.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.AnalyticsConsentRequest true "Whether the user consents to analytics"
+// @Success 200 {object} models.AnalyticsConsentResponse "Analytics consent set"
+// @Failure 400 {object} models.Problem "Invalid request"
+// @Failure 401 {object} models.Problem "Unauthorized"
+// @Failure 404 {object} models.Problem "User not found"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /users/me/analytics-consent [put]
+func (h *UserHandler) SetMyAnalyticsConsent(c *gin.Context) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.AnalyticsConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid request format")
+		return
+	}
+
+	if err := h.userService.SetAnalyticsConsent(c.Request.Context(), userID, *req.AnalyticsConsent); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Respond(c, http.StatusNotFound, apierror.NotFound, "User not found")
+			return
+		}
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error setting analytics consent")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AnalyticsConsentResponse{AnalyticsConsent: *req.AnalyticsConsent})
+}
+
+// GetUserStats handles counting users by phone verification status
+// @Summary Get user statistics
+// @Description Count active users, split by whether and by which source their phone number was verified, and estimate how many signed in today and during the last 7 and 30 days
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.UserStats "User statistics"
+// @Failure 403 {object} models.Problem "Permission denied"
+// @Failure 500 {object} models.Problem "Internal server error"
+// @Failure 503 {object} models.Problem "Service overloaded"
+// @Router /admin/users/stats [get]
+func (h *UserHandler) GetUserStats(c *gin.Context) {
+	stats, err := h.userService.GetUserStats(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, concurrency.ErrLimitExceeded) {
+			apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error getting user stats")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// auditAPIKeyList records a listing of users by a service with an API key, naming the users
+// returned and the query they were listed by
+func (h *UserHandler) auditAPIKeyList(c *gin.Context, users []models.User) bool {
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID.String()
+	}
+	return h.auditAPIKeyRead(c, service.AuditActionUserList, service.AuditTargetUserList, "", map[string]interface{}{
+		"user_ids": ids,
+		"query":    c.Request.URL.Query(),
+	})
+}
+
+// auditAPIKeyRead records a read of users by a service with an API key, so what services
+// read is traced like what they change; reads by users aren't recorded. If the entry can't be
+// recorded, it responds with an error and returns false, so no user is returned unrecorded.
+func (h *UserHandler) auditAPIKeyRead(c *gin.Context, action, targetType, targetID string, metadata map[string]interface{}) bool {
+	actor := auditActor(c)
+	if actor.Type != models.AuditActorAPIKey {
+		return true
+	}
+	if err := h.auditService.Record(c.Request.Context(), actor, action, targetType, targetID, metadata); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error recording audit log")
+		return false
+	}
+	return true
+}
+
+// userResponse returns the fields of user shown to API clients
+func userResponse(user *models.User) models.UserResponse {
+	return models.UserResponse{
+		ID:               user.ID,
+		PhoneNumber:      user.PhoneNumber,
+		PhoneVerified:    user.PhoneVerified,
+		VerifiedSource:   user.VerifiedSource,
+		AnalyticsConsent: user.AnalyticsConsent,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Email:            user.Email,
+		AvatarURL:        user.AvatarURL,
+		Metadata:         user.Metadata,
+		CreatedAt:        user.CreatedAt,
+	}
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// Dependency statuses reported by the readiness check
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// check is a dependency checked by a Checker
+type check struct {
+	name     string
+	probe    Probe
+	critical bool
+}
+
+// Checker checks the instance's dependencies for its readiness check. Unlike the load monitor's
+// background probes, the checks run when asked for, concurrently, each bounded by a timeout.
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+}
+
+// NewChecker creates a new checker giving each check at most timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a dependency check. The instance isn't ready while a critical dependency is down;
+// other dependencies are only reported. Checks must be added before Check is first called.
+func (c *Checker) Add(name string, probe Probe, critical bool) {
+	c.checks = append(c.checks, check{name: name, probe: probe, critical: critical})
+}
+
+// Check runs every check, reporting each dependency's status in the order they were added and
+// whether all critical dependencies are up
+func (c *Checker) Check(ctx context.Context) (bool, []models.DependencyStatus) {
+	statuses := make([]models.DependencyStatus, len(c.checks))
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := chk.probe(checkCtx)
+			status := StatusUp
+			if err == nil {
+				// A probe ignoring its context still counts as down once it overruns the timeout
+				err = checkCtx.Err()
+			}
+			if err != nil {
+				status = StatusDown
+			}
+			statuses[i] = models.DependencyStatus{
+				Name:      chk.name,
+				Status:    status,
+				Critical:  chk.critical,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	for _, status := range statuses {
+		if status.Critical && status.Status != StatusUp {
+			ready = false
+		}
+	}
+	return ready, statuses
+}
@@ -0,0 +1,148 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// latencySmoothing is the weight of a new latency sample in a dependency's moving average
+const latencySmoothing = 0.3
+
+// Probe checks a dependency, e.g. by pinging it; how long it takes is the dependency's latency
+type Probe func(ctx context.Context) error
+
+// dependency is a probed dependency with its latest state
+type dependency struct {
+	name    string
+	probe   Probe
+	latency time.Duration // moving average of successful probes
+	err     error         // of the latest probe
+}
+
+// LoadMonitor estimates how loaded the instance is from its in-flight requests and the
+// latency of its dependencies, so load balancers can route traffic away from it before
+// it falls over. Dependencies are probed in the background; a dependency whose probe
+// fails or takes longer than the maximum latency counts as full load.
+type LoadMonitor struct {
+	inflight    atomic.Int64
+	maxInFlight int
+	maxLatency  time.Duration
+	interval    time.Duration
+	logger      *slog.Logger
+
+	mu           sync.Mutex // guards the dependencies' state
+	dependencies []*dependency
+
+	inflightGauge metrics.Gauge
+}
+
+// NewLoadMonitor creates a new load monitor, exporting the number of in-flight requests to registry
+func NewLoadMonitor(cfg *config.Config, registry *metrics.Registry, logger *slog.Logger) *LoadMonitor {
+	return &LoadMonitor{
+		maxInFlight:   cfg.GetLoadScoreMaxInFlight(),
+		maxLatency:    cfg.GetLoadScoreMaxLatency(),
+		interval:      cfg.GetLoadScoreProbeInterval(),
+		logger:        logger,
+		inflightGauge: registry.Gauge("http_inflight_requests", "HTTP requests currently being served."),
+	}
+}
+
+// AddDependency registers a dependency whose latency counts towards the load score.
+// Dependencies must be added before Run is started.
+func (m *LoadMonitor) AddDependency(name string, probe Probe) {
+	m.dependencies = append(m.dependencies, &dependency{name: name, probe: probe})
+}
+
+// RequestStarted counts a request as in flight
+func (m *LoadMonitor) RequestStarted() {
+	m.inflightGauge.Set(float64(m.inflight.Add(1)))
+}
+
+// RequestFinished counts a request as no longer in flight
+func (m *LoadMonitor) RequestFinished() {
+	m.inflightGauge.Set(float64(m.inflight.Add(-1)))
+}
+
+// Run probes the dependencies every probe interval until ctx is cancelled
+func (m *LoadMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.ProbeDependencies(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeDependencies probes every dependency once, giving each at most the maximum latency
+func (m *LoadMonitor) ProbeDependencies(ctx context.Context) {
+	for _, dep := range m.dependencies {
+		probeCtx, cancel := context.WithTimeout(ctx, m.maxLatency)
+		start := time.Now()
+		err := dep.probe(probeCtx)
+		latency := time.Since(start)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.mu.Lock()
+		if err != nil {
+			if dep.err == nil {
+				m.logger.Warn("Dependency probe failed", "dependency", dep.name, "error", err)
+			}
+		} else if dep.latency == 0 || dep.err != nil {
+			dep.latency = latency
+		} else {
+			dep.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(dep.latency))
+		}
+		dep.err = err
+		m.mu.Unlock()
+	}
+}
+
+// Load returns the current load. The score is the larger of the in-flight requests'
+// share of the maximum and the slowest dependency's share of the maximum latency,
+// capped at 1; the weight is the remaining capacity in percent, at least 1 so a loaded
+// instance still gets some traffic while its readiness check passes.
+func (m *LoadMonitor) Load() models.LoadResponse {
+	inflight := m.inflight.Load()
+	score := float64(inflight) / float64(m.maxInFlight)
+
+	m.mu.Lock()
+	dependencies := make([]models.DependencyLoad, len(m.dependencies))
+	for i, dep := range m.dependencies {
+		dependencies[i] = models.DependencyLoad{
+			Name:      dep.name,
+			Healthy:   dep.err == nil,
+			LatencyMS: float64(dep.latency.Microseconds()) / 1000,
+		}
+		if dep.err != nil {
+			score = 1
+		} else {
+			score = math.Max(score, float64(dep.latency)/float64(m.maxLatency))
+		}
+	}
+	m.mu.Unlock()
+
+	score = math.Min(score, 1)
+	return models.LoadResponse{
+		Score:            math.Round(score*100) / 100,
+		Weight:           int(math.Max(1, math.Round(100*(1-score)))),
+		InFlightRequests: inflight,
+		Dependencies:     dependencies,
+	}
+}
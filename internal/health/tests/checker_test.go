@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/health"
+)
+
+func TestCheckerReportsDependencies(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("postgres", func(ctx context.Context) error { return nil }, true)
+	checker.Add("sms", func(ctx context.Context) error { return errors.New("no SMS provider available") }, false)
+
+	// A non-critical dependency being down doesn't make the instance unavailable
+	ready, statuses := checker.Check(context.Background())
+	if !ready {
+		t.Fatal("expected the instance to be ready")
+	}
+	if len(statuses) != 2 || statuses[0].Name != "postgres" || statuses[0].Status != health.StatusUp || !statuses[0].Critical ||
+		statuses[1].Name != "sms" || statuses[1].Status != health.StatusDown || statuses[1].Critical {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+}
+
+func TestCheckerCriticalDependencyDown(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("postgres", func(ctx context.Context) error { return errors.New("connection refused") }, true)
+	checker.Add("redis", func(ctx context.Context) error { return nil }, true)
+
+	ready, statuses := checker.Check(context.Background())
+	if ready {
+		t.Fatal("expected the instance to be unavailable")
+	}
+	if statuses[0].Status != health.StatusDown || statuses[1].Status != health.StatusUp {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+}
+
+func TestCheckerTimesOutChecks(t *testing.T) {
+	checker := health.NewChecker(20 * time.Millisecond)
+	checker.Add("redis", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, true)
+	checker.Add("postgres", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil // ignores the deadline
+	}, true)
+
+	start := time.Now()
+	ready, statuses := checker.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected checks to run concurrently within the timeout, took %v", elapsed)
+	}
+	if ready || statuses[0].Status != health.StatusDown || statuses[1].Status != health.StatusDown {
+		t.Fatalf("expected hung dependencies to be down, got ready %v, %+v", ready, statuses)
+	}
+}
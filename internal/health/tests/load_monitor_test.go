@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/health"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+func newLoadMonitor() *health.LoadMonitor {
+	cfg := &config.Config{}
+	cfg.Service.LoadScore = config.LoadScoreConfig{MaxInFlight: 10, MaxLatency: 100}
+	return health.NewLoadMonitor(cfg, metrics.NewRegistry(), logging.Discard())
+}
+
+func TestLoadFromInFlightRequests(t *testing.T) {
+	monitor := newLoadMonitor()
+
+	if load := monitor.Load(); load.Score != 0 || load.Weight != 100 || load.InFlightRequests != 0 {
+		t.Fatalf("expected an idle instance, got %+v", load)
+	}
+
+	for i := 0; i < 4; i++ {
+		monitor.RequestStarted()
+	}
+	if load := monitor.Load(); load.Score != 0.4 || load.Weight != 60 || load.InFlightRequests != 4 {
+		t.Fatalf("expected 4 of 10 requests in flight to be 40%% load, got %+v", load)
+	}
+
+	// Beyond the maximum the instance stays at full load but keeps a minimal weight
+	for i := 0; i < 20; i++ {
+		monitor.RequestStarted()
+	}
+	if load := monitor.Load(); load.Score != 1 || load.Weight != 1 {
+		t.Fatalf("expected full load with weight 1, got %+v", load)
+	}
+
+	for i := 0; i < 24; i++ {
+		monitor.RequestFinished()
+	}
+	if load := monitor.Load(); load.Score != 0 || load.InFlightRequests != 0 {
+		t.Fatalf("expected an idle instance again, got %+v", load)
+	}
+}
+
+func TestLoadFromDependencyLatency(t *testing.T) {
+	ctx := context.Background()
+	monitor := newLoadMonitor()
+
+	var slow, failing bool
+	monitor.AddDependency("fast", func(ctx context.Context) error {
+		return nil
+	})
+	monitor.AddDependency("flaky", func(ctx context.Context) error {
+		if failing {
+			return errors.New("connection refused")
+		}
+		if slow {
+			// Probes are cut off at the maximum latency
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+
+	monitor.ProbeDependencies(ctx)
+	load := monitor.Load()
+	if load.Score < 0.4 || load.Score > 0.9 || len(load.Dependencies) != 2 {
+		t.Fatalf("expected about half load from a 50ms probe against 100ms, got %+v", load)
+	}
+	if flaky := load.Dependencies[1]; flaky.Name != "flaky" || !flaky.Healthy || flaky.LatencyMS < 50 {
+		t.Fatalf("expected the flaky dependency's latency, got %+v", flaky)
+	}
+
+	slow = true
+	monitor.ProbeDependencies(ctx)
+	if load := monitor.Load(); load.Score != 1 || load.Weight != 1 || load.Dependencies[1].Healthy {
+		t.Fatalf("expected a timed out probe to count as full load, got %+v", load)
+	}
+
+	slow, failing = false, true
+	monitor.ProbeDependencies(ctx)
+	if load := monitor.Load(); load.Score != 1 || load.Dependencies[1].Healthy || !load.Dependencies[0].Healthy {
+		t.Fatalf("expected a failed probe to count as full load, got %+v", load)
+	}
+
+	failing = false
+	monitor.ProbeDependencies(ctx)
+	if load := monitor.Load(); load.Score == 1 || !load.Dependencies[1].Healthy {
+		t.Fatalf("expected the dependency to recover, got %+v", load)
+	}
+}
@@ -0,0 +1,91 @@
+package kms
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// awsSigningAlgorithms are the AWS KMS signing algorithms of the JWS algorithms
+var awsSigningAlgorithms = map[string]types.SigningAlgorithmSpec{
+	"ES256": types.SigningAlgorithmSpecEcdsaSha256,
+	"RS256": types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+}
+
+// AWSKey is an AWS KMS key, asymmetric to sign or symmetric to decrypt with, called through the AWS SDK
+type AWSKey struct {
+	api   *kms.Client
+	keyID string
+}
+
+// NewAWSKey creates the AWS KMS key keyID of region, whose requests time out after timeout.
+// endpoint overrides the region's endpoint if not empty. Credentials are looked up by the
+// SDK's default chain.
+func NewAWSKey(ctx context.Context, region, endpoint, keyID string, timeout time.Duration) (*AWSKey, error) {
+	if region == "" {
+		return nil, fmt.Errorf("AWS KMS region cannot be empty")
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(region),
+		config.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(timeout)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS configuration for KMS: %w", err)
+	}
+
+	return &AWSKey{
+		api: kms.NewFromConfig(awsConfig, func(o *kms.Options) {
+			if endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		keyID: keyID,
+	}, nil
+}
+
+// SignDigest signs digest with the key
+func (k *AWSKey) SignDigest(ctx context.Context, alg string, digest []byte) ([]byte, error) {
+	algorithm, ok := awsSigningAlgorithms[alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+
+	output, err := k.api.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(k.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: algorithm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling AWS KMS Sign: %w", err)
+	}
+	return output.Signature, nil
+}
+
+// PublicKey returns the key's public key
+func (k *AWSKey) PublicKey(ctx context.Context) ([]byte, error) {
+	output, err := k.api.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(k.keyID)})
+	if err != nil {
+		return nil, fmt.Errorf("error calling AWS KMS GetPublicKey: %w", err)
+	}
+	return output.PublicKey, nil
+}
+
+// Decrypt decrypts ciphertext encrypted with the key, a symmetric key, under encryptionContext
+func (k *AWSKey) Decrypt(ctx context.Context, ciphertext []byte, encryptionContext map[string]string) ([]byte, error) {
+	output, err := k.api.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(k.keyID),
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling AWS KMS Decrypt: %w", err)
+	}
+	return output.Plaintext, nil
+}
@@ -0,0 +1,135 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gcpScope is the OAuth 2.0 scope of the Cloud KMS API
+const gcpScope = "https://www.googleapis.com/auth/cloudkms"
+
+// DefaultGCPTokens returns the access tokens of Google Application Default Credentials: the
+// service account file in GOOGLE_APPLICATION_CREDENTIALS, gcloud's credentials, then the
+// service account of the workload from the metadata server of GCE and GKE (Workload Identity)
+func DefaultGCPTokens(ctx context.Context) (oauth2.TokenSource, error) {
+	tokens, err := google.DefaultTokenSource(ctx, gcpScope)
+	if err != nil {
+		return nil, fmt.Errorf("error finding GCP credentials: %w", err)
+	}
+	return tokens, nil
+}
+
+// GCPKey is a version of an asymmetric Google Cloud KMS key to sign with, or a symmetric key to decrypt with
+type GCPKey struct {
+	httpClient *http.Client
+	endpoint   string
+	name       string
+}
+
+// NewGCPKey creates the key version name (projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*)
+// whose requests are authorized with tokens and time out after timeout. endpoint overrides the
+// Cloud KMS endpoint if not empty.
+func NewGCPKey(endpoint, name string, tokens oauth2.TokenSource, timeout time.Duration) *GCPKey {
+	if endpoint == "" {
+		endpoint = "https://cloudkms.googleapis.com"
+	}
+	return &GCPKey{
+		httpClient: &http.Client{Timeout: timeout, Transport: &oauth2.Transport{Source: tokens}},
+		endpoint:   strings.TrimSuffix(endpoint, "/") + "/v1/",
+		name:       name,
+	}
+}
+
+// SignDigest signs digest with the key version; its algorithm is fixed by the key, so alg is not sent
+func (k *GCPKey) SignDigest(ctx context.Context, alg string, digest []byte) ([]byte, error) {
+	input := map[string]any{"digest": map[string][]byte{"sha256": digest}}
+	var output struct {
+		Signature []byte `json:"signature"`
+	}
+	if err := k.do(ctx, http.MethodPost, k.name+":asymmetricSign", input, &output); err != nil {
+		return nil, err
+	}
+	return output.Signature, nil
+}
+
+// PublicKey returns the key version's public key
+func (k *GCPKey) PublicKey(ctx context.Context) ([]byte, error) {
+	var output struct {
+		PEM string `json:"pem"`
+	}
+	if err := k.do(ctx, http.MethodGet, k.name+"/publicKey", nil, &output); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(output.PEM))
+	if block == nil {
+		return nil, fmt.Errorf("error decoding GCP KMS public key: no PEM data")
+	}
+	return block.Bytes, nil
+}
+
+// Decrypt decrypts ciphertext encrypted with a symmetric key; the key is then named
+// projects/*/locations/*/keyRings/*/cryptoKeys/* rather than a key version
+func (k *GCPKey) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	var output struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := k.do(ctx, http.MethodPost, k.name+":decrypt", map[string][]byte{"ciphertext": ciphertext}, &output); err != nil {
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
+
+// do calls the API method at path with input, decoding the response into output
+func (k *GCPKey) do(ctx context.Context, method, path string, input, output any) error {
+	var body io.Reader
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return fmt.Errorf("error encoding GCP KMS request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, k.endpoint+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating GCP KMS request: %w", err)
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling GCP KMS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading GCP KMS response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(data, &errResp)
+		return fmt.Errorf("GCP KMS request failed with status %d: %s: %s", resp.StatusCode, errResp.Error.Status, errResp.Error.Message)
+	}
+
+	if err := json.Unmarshal(data, output); err != nil {
+		return fmt.Errorf("error decoding GCP KMS response: %w", err)
+	}
+	return nil
+}
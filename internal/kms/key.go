@@ -0,0 +1,43 @@
+package kms
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Supported KMS providers
+const (
+	ProviderAWS = "aws"
+	ProviderGCP = "gcp"
+)
+
+// Key is an asymmetric signing key held by a cloud KMS; its private key never leaves the KMS
+type Key interface {
+	// SignDigest signs the SHA-256 digest of a message for the JWS algorithm alg (ES256 or RS256),
+	// returning an ASN.1 DER signature for ECDSA keys and a PKCS #1 v1.5 signature for RSA keys
+	SignDigest(ctx context.Context, alg string, digest []byte) ([]byte, error)
+	// PublicKey returns the key's public key as a DER-encoded SubjectPublicKeyInfo
+	PublicKey(ctx context.Context) ([]byte, error)
+}
+
+// NewKey returns the key keyID of provider, whose requests time out after timeout: an AWS KMS
+// key ID, ARN or alias in region, or a GCP Cloud KMS key version resource name. endpoint
+// overrides the provider's endpoint if not empty.
+func NewKey(ctx context.Context, provider, keyID, region, endpoint string, timeout time.Duration) (Key, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("KMS key ID cannot be empty")
+	}
+	switch provider {
+	case ProviderAWS:
+		return NewAWSKey(ctx, region, endpoint, keyID, timeout)
+	case ProviderGCP:
+		tokens, err := DefaultGCPTokens(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewGCPKey(endpoint, keyID, tokens, timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown KMS provider: %s", provider)
+	}
+}
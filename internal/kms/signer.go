@@ -0,0 +1,212 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK is a public key in JSON Web Key format, as published in a JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// publicKey is the cached public key of a KMS key
+type publicKey struct {
+	key    crypto.PublicKey
+	method jwt.SigningMethod
+	jwk    JWK
+}
+
+// Signer signs JWTs with a KMS key, and verifies them with the public keys of that key and
+// of keys rotated out. Public keys are fetched from the KMS once and cached, as they never change.
+// Keys are identified in tokens (kid) by their RFC 7638 thumbprint.
+type Signer struct {
+	keys []Key // the first key signs
+
+	mu     sync.Mutex
+	public []*publicKey // by index of keys, nil until fetched
+}
+
+// NewSigner creates a signer signing with key whose tokens verify with key or previous keys
+func NewSigner(key Key, previous ...Key) *Signer {
+	keys := append([]Key{key}, previous...)
+	return &Signer{keys: keys, public: make([]*publicKey, len(keys))}
+}
+
+// Load fetches the public keys not cached yet, e.g. to fail at startup if a key is misconfigured
+func (s *Signer) Load(ctx context.Context) error {
+	for i := range s.keys {
+		if _, err := s.publicKey(ctx, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publicKey returns the public key of the i-th key, fetching it if it isn't cached
+func (s *Signer) publicKey(ctx context.Context, i int) (*publicKey, error) {
+	s.mu.Lock()
+	cached := s.public[i]
+	s.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	der, err := s.keys[i].PublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting KMS public key: %w", err)
+	}
+	pub, err := parsePublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.public[i] = pub
+	s.mu.Unlock()
+	return pub, nil
+}
+
+// Sign returns the JWT with claims, signed with the signing key
+func (s *Signer) Sign(ctx context.Context, claims jwt.Claims) (string, error) {
+	pub, err := s.publicKey(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(pub.method, claims)
+	token.Header["kid"] = pub.jwk.Kid
+	signingString, err := token.SigningString()
+	if err != nil {
+		return "", fmt.Errorf("error encoding JWT: %w", err)
+	}
+
+	digest := sha256.Sum256([]byte(signingString))
+	signature, err := s.keys[0].SignDigest(ctx, pub.method.Alg(), digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing JWT with KMS: %w", err)
+	}
+	if pub.method == jwt.SigningMethodES256 {
+		// JWS takes the ECDSA signature as the concatenated r and s rather than DER
+		if signature, err = rawECDSASignature(signature, 32); err != nil {
+			return "", err
+		}
+	}
+	return signingString + "." + token.EncodeSegment(signature), nil
+}
+
+// Keyfunc returns the public key to verify token with, for jwt.Parse. Keys that aren't cached yet
+// are fetched with ctx.
+func (s *Signer) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for i := range s.keys {
+			pub, err := s.publicKey(ctx, i)
+			if err != nil {
+				return nil, err
+			}
+			if pub.jwk.Kid == kid {
+				if token.Method.Alg() != pub.method.Alg() {
+					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+				}
+				return pub.key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+}
+
+// JWKS returns the public keys tokens verify with, the signing key first
+func (s *Signer) JWKS(ctx context.Context) ([]JWK, error) {
+	keys := make([]JWK, len(s.keys))
+	for i := range s.keys {
+		pub, err := s.publicKey(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = pub.jwk
+	}
+	return keys, nil
+}
+
+// parsePublicKey parses a DER-encoded SubjectPublicKeyInfo of a P-256 ECDSA or RSA key
+func parsePublicKey(der []byte) (*publicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing KMS public key: %w", err)
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	pub := &publicKey{key: key}
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported KMS key curve: %s", key.Curve.Params().Name)
+		}
+		pub.method = jwt.SigningMethodES256
+		pub.jwk = JWK{Kty: "EC", Crv: "P-256", X: encode(key.X.FillBytes(make([]byte, 32))), Y: encode(key.Y.FillBytes(make([]byte, 32)))}
+	case *rsa.PublicKey:
+		pub.method = jwt.SigningMethodRS256
+		pub.jwk = JWK{Kty: "RSA", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}
+	default:
+		return nil, fmt.Errorf("unsupported KMS key type: %T", key)
+	}
+	pub.jwk.Use = "sig"
+	pub.jwk.Alg = pub.method.Alg()
+	pub.jwk.Kid = thumbprint(pub.jwk)
+	return pub, nil
+}
+
+// thumbprint returns the RFC 7638 thumbprint of a key: the hash of its required members, sorted
+func thumbprint(jwk JWK) string {
+	var members []byte
+	if jwk.Kty == "EC" {
+		members, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y})
+	} else {
+		members, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	}
+	sum := sha256.Sum256(members)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// rawECDSASignature converts a DER-encoded ECDSA signature to r and s of size bytes each
+func rawECDSASignature(der []byte, size int) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("error decoding KMS signature: %w", err)
+	}
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lilokie/otp-auth/internal/kms"
+	"golang.org/x/oauth2"
+)
+
+// localKey is a KMS key backed by a local private key, counting its public key fetches
+type localKey struct {
+	private crypto.Signer
+	fetches int
+}
+
+func (k *localKey) SignDigest(ctx context.Context, alg string, digest []byte) ([]byte, error) {
+	if key, ok := k.private.(*ecdsa.PrivateKey); ok {
+		return ecdsa.SignASN1(rand.Reader, key, digest)
+	}
+	return rsa.SignPKCS1v15(rand.Reader, k.private.(*rsa.PrivateKey), crypto.SHA256, digest)
+}
+
+func (k *localKey) PublicKey(ctx context.Context) ([]byte, error) {
+	k.fetches++
+	return x509.MarshalPKIXPublicKey(k.private.Public())
+}
+
+func newECKey(t *testing.T) *localKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return &localKey{private: key}
+}
+
+func newRSAKey(t *testing.T) *localKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return &localKey{private: key}
+}
+
+func TestSignerSignsVerifiableTokens(t *testing.T) {
+	ctx := context.Background()
+	for name, key := range map[string]*localKey{"ES256": newECKey(t), "RS256": newRSAKey(t)} {
+		t.Run(name, func(t *testing.T) {
+			signer := kms.NewSigner(key)
+			tokenString, err := signer.Sign(ctx, jwt.MapClaims{"user_id": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+
+			token, err := jwt.Parse(tokenString, signer.Keyfunc(ctx))
+			if err != nil || !token.Valid {
+				t.Fatalf("expected a valid token, got %v", err)
+			}
+			if token.Method.Alg() != name {
+				t.Fatalf("expected %s, got %s", name, token.Method.Alg())
+			}
+
+			keys, err := signer.JWKS(ctx)
+			if err != nil || len(keys) != 1 || keys[0].Kid != token.Header["kid"] || keys[0].Alg != name || keys[0].Use != "sig" {
+				t.Fatalf("expected the signing key in the JWKS, got %+v (%v)", keys, err)
+			}
+			if key.fetches != 1 {
+				t.Fatalf("expected the public key to be fetched once, got %d", key.fetches)
+			}
+		})
+	}
+}
+
+func TestSignerRotation(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := newECKey(t), newRSAKey(t)
+	claims := jwt.MapClaims{"user_id": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+
+	oldToken, err := kms.NewSigner(oldKey).Sign(ctx, claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// Tokens of the key rotated out still verify
+	rotated := kms.NewSigner(newKey, oldKey)
+	if token, err := jwt.Parse(oldToken, rotated.Keyfunc(ctx)); err != nil || !token.Valid {
+		t.Fatalf("expected the old token to verify, got %v", err)
+	}
+	if keys, _ := rotated.JWKS(ctx); len(keys) != 2 || keys[0].Kty != "RSA" || keys[1].Kty != "EC" {
+		t.Fatalf("expected both keys, the signing key first, got %+v", keys)
+	}
+
+	// Once the old key is dropped they don't
+	if _, err := jwt.Parse(oldToken, kms.NewSigner(newKey).Keyfunc(ctx)); err == nil {
+		t.Fatal("expected the token of an unknown key to be rejected")
+	}
+}
+
+func TestSignerRejectsAlgorithmMismatch(t *testing.T) {
+	ctx := context.Background()
+	key := newRSAKey(t)
+	signer := kms.NewSigner(key)
+	keys, _ := signer.JWKS(ctx)
+
+	// An HS256 token "signed" with the public key under the key's kid
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": "user-1"})
+	token.Header["kid"] = keys[0].Kid
+	der, _ := x509.MarshalPKIXPublicKey(key.private.Public())
+	forged, _ := token.SignedString(der)
+
+	if _, err := jwt.Parse(forged, signer.Keyfunc(ctx)); err == nil {
+		t.Fatal("expected a token with another algorithm to be rejected")
+	}
+}
+
+func TestKeyIDIsThumbprint(t *testing.T) {
+	// The example key of RFC 7638, section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	der, _ := x509.MarshalPKIXPublicKey(public)
+
+	keys, err := kms.NewSigner(fixedPublicKey(der)).JWKS(context.Background())
+	if err != nil {
+		t.Fatalf("JWKS: %v", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; keys[0].Kid != want {
+		t.Fatalf("expected kid %q, got %q", want, keys[0].Kid)
+	}
+}
+
+// fixedPublicKey is a key that only has a public key
+type fixedPublicKey []byte
+
+func (k fixedPublicKey) SignDigest(ctx context.Context, alg string, digest []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (k fixedPublicKey) PublicKey(ctx context.Context) ([]byte, error) {
+	return k, nil
+}
+
+func TestAWSKey(t *testing.T) {
+	key := newECKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			t.Errorf("expected a signed request")
+		}
+		var input struct {
+			KeyId            string
+			Message          []byte
+			MessageType      string
+			SigningAlgorithm string
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		if input.KeyId != "alias/jwt" {
+			t.Errorf("unexpected key %q", input.KeyId)
+		}
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			public, _ := key.PublicKey(r.Context())
+			json.NewEncoder(w).Encode(map[string][]byte{"PublicKey": public})
+		case "TrentService.Sign":
+			if input.MessageType != "DIGEST" || input.SigningAlgorithm != "ECDSA_SHA_256" {
+				t.Errorf("unexpected sign request %+v", input)
+			}
+			signature, _ := key.SignDigest(r.Context(), "ES256", input.Message)
+			json.NewEncoder(w).Encode(map[string][]byte{"Signature": signature})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazon.coral.service#UnknownOperationException","message":"unknown"}`))
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	awsKey, err := kms.NewAWSKey(context.Background(), "us-east-1", server.URL, "alias/jwt", time.Second)
+	if err != nil {
+		t.Fatalf("NewAWSKey: %v", err)
+	}
+	assertSignsVerifiableTokens(t, awsKey)
+}
+
+func TestGCPKey(t *testing.T) {
+	const name = "projects/p/locations/global/keyRings/r/cryptoKeys/jwt/cryptoKeyVersions/1"
+	key := newECKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/"+name+"/publicKey":
+			public, _ := key.PublicKey(r.Context())
+			json.NewEncoder(w).Encode(map[string]string{
+				"pem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})),
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/"+name+":asymmetricSign":
+			var input struct {
+				Digest struct{ SHA256 []byte } `json:"digest"`
+			}
+			json.NewDecoder(r.Body).Decode(&input)
+			signature, _ := key.SignDigest(r.Context(), "ES256", input.Digest.SHA256)
+			json.NewEncoder(w).Encode(map[string][]byte{"signature": signature})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"status":"NOT_FOUND","message":"not found"}}`))
+		}
+	}))
+	defer server.Close()
+
+	assertSignsVerifiableTokens(t, kms.NewGCPKey(server.URL, name, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token-1"}), time.Second))
+}
+
+func assertSignsVerifiableTokens(t *testing.T, key kms.Key) {
+	t.Helper()
+	ctx := context.Background()
+	signer := kms.NewSigner(key)
+	if err := signer.Load(ctx); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	tokenString, err := signer.Sign(ctx, jwt.MapClaims{"user_id": "user-1"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if token, err := jwt.Parse(tokenString, signer.Keyfunc(ctx)); err != nil || !token.Valid {
+		t.Fatalf("expected a valid token, got %v", err)
+	}
+}
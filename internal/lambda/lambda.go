@@ -0,0 +1,73 @@
+// Package lambda serves AWS Lambda invocations by API Gateway with an HTTP handler, running the
+// function with aws-lambda-go and translating events with aws-lambda-go-api-proxy
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/awslabs/aws-lambda-go-api-proxy/httpadapter"
+)
+
+// Handler serves API Gateway proxy integration events from REST APIs (payload format 1.0)
+// and HTTP APIs (payload format 2.0) with an HTTP handler
+type Handler struct {
+	v1 *httpadapter.HandlerAdapter
+	v2 *httpadapter.HandlerAdapterV2
+}
+
+// NewHandler creates a handler serving API Gateway events with handler
+func NewHandler(handler http.Handler) *Handler {
+	handler = withRemotePort(handler)
+	return &Handler{v1: httpadapter.New(handler), v2: httpadapter.NewV2(handler)}
+}
+
+// Invoke serves the API Gateway event payload, returning the proxy integration response to it
+func (h *Handler) Invoke(ctx context.Context, payload json.RawMessage) (any, error) {
+	var format struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(payload, &format); err != nil {
+		return nil, fmt.Errorf("error decoding API Gateway event: %w", err)
+	}
+
+	if format.Version == "2.0" {
+		var event events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("error decoding API Gateway event: %w", err)
+		}
+		return h.v2.ProxyWithContext(ctx, event)
+	}
+	var event events.APIGatewayProxyRequest
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("error decoding API Gateway event: %w", err)
+	}
+	return h.v1.ProxyWithContext(ctx, event)
+}
+
+// Start serves the function's invocations with handler until the function is shut down.
+// It returns an error if not running on Lambda, and otherwise never returns.
+func Start(handler http.Handler) error {
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") == "" {
+		return fmt.Errorf("AWS_LAMBDA_RUNTIME_API not set, not running on Lambda")
+	}
+	lambda.Start(NewHandler(handler).Invoke)
+	return nil
+}
+
+// withRemotePort gives the remote address of requests, the source IP of the event, a port,
+// as gin and net/http expect one
+func withRemotePort(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := net.SplitHostPort(r.RemoteAddr); err != nil && r.RemoteAddr != "" {
+			r.RemoteAddr = net.JoinHostPort(r.RemoteAddr, "0")
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
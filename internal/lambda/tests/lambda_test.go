@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/lambda"
+)
+
+// echoHandler responds with what it got, setting a cookie and a header with two values
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	cookie, _ := r.Cookie("session")
+	w.Header().Add("Vary", "Origin")
+	w.Header().Add("Vary", "Accept")
+	http.SetCookie(w, &http.Cookie{Name: "seen", Value: "1"})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"phone":   r.URL.Query().Get("phone"),
+		"body":    string(body),
+		"cookie":  cookie.Value,
+		"remote":  r.RemoteAddr,
+		"agent":   r.Header.Get("User-Agent"),
+		"forward": strings.Join(r.Header.Values("X-Forwarded-For"), ","),
+	})
+})
+
+type response struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders"`
+	Cookies           []string            `json:"cookies"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+func handle(t *testing.T, handler http.Handler, event string) (response, map[string]string) {
+	t.Helper()
+	result, err := lambda.NewHandler(handler).Invoke(context.Background(), []byte(event))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("error encoding response: %v", err)
+	}
+	var resp response
+	if err := json.Unmarshal(output, &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	var echoed map[string]string
+	json.Unmarshal([]byte(resp.Body), &echoed)
+	return resp, echoed
+}
+
+func TestHandleRESTAPIEvent(t *testing.T) {
+	body := base64.StdEncoding.EncodeToString([]byte(`{"phone":"+1"}`))
+	resp, echoed := handle(t, echoHandler, `{
+		"httpMethod": "POST",
+		"path": "/otp/request",
+		"multiValueQueryStringParameters": {"phone": ["+15550100"]},
+		"headers": {"User-Agent": "test", "X-Forwarded-For": "10.0.0.1"},
+		"multiValueHeaders": {"User-Agent": ["test"], "X-Forwarded-For": ["10.0.0.1", "10.0.0.2"], "Cookie": ["session=abc"]},
+		"body": "`+body+`",
+		"isBase64Encoded": true,
+		"requestContext": {"identity": {"sourceIp": "203.0.113.7"}}
+	}`)
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+	want := map[string]string{
+		"method":  "POST",
+		"path":    "/otp/request",
+		"phone":   "+15550100",
+		"body":    `{"phone":"+1"}`,
+		"cookie":  "abc",
+		"remote":  "203.0.113.7:0",
+		"agent":   "test",
+		"forward": "10.0.0.1,10.0.0.2",
+	}
+	for name, value := range want {
+		if echoed[name] != value {
+			t.Errorf("expected %s %q, got %q", name, value, echoed[name])
+		}
+	}
+	if got := resp.MultiValueHeaders["Vary"]; len(got) != 2 {
+		t.Errorf("expected both Vary values, got %v", got)
+	}
+	if got := resp.MultiValueHeaders["Set-Cookie"]; len(got) != 1 || got[0] != "seen=1" {
+		t.Errorf("expected the cookie in the headers, got %v", got)
+	}
+}
+
+func TestHandleHTTPAPIEvent(t *testing.T) {
+	resp, echoed := handle(t, echoHandler, `{
+		"version": "2.0",
+		"rawPath": "/otp/verify",
+		"rawQueryString": "phone=%2B15550100",
+		"cookies": ["session=abc", "other=x"],
+		"headers": {"user-agent": "test"},
+		"body": "code",
+		"requestContext": {"http": {"method": "PUT", "sourceIp": "2001:db8::1"}}
+	}`)
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+	want := map[string]string{
+		"method": "PUT",
+		"path":   "/otp/verify",
+		"phone":  "+15550100",
+		"body":   "code",
+		"cookie": "abc",
+		"remote": "[2001:db8::1]:0",
+		"agent":  "test",
+	}
+	for name, value := range want {
+		if echoed[name] != value {
+			t.Errorf("expected %s %q, got %q", name, value, echoed[name])
+		}
+	}
+	if got := resp.Headers["Vary"]; got != "Origin,Accept" {
+		t.Errorf("expected joined Vary values, got %q", got)
+	}
+	if len(resp.Cookies) != 1 || resp.Cookies[0] != "seen=1" {
+		t.Errorf("expected the cookie apart, got %v", resp.Cookies)
+	}
+	if _, ok := resp.Headers["Set-Cookie"]; ok {
+		t.Error("expected no Set-Cookie header")
+	}
+}
+
+func TestHandleBinaryResponse(t *testing.T) {
+	binary := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte{0xff, 0xfe, 0x00})
+	})
+	resp, _ := handle(t, binary, `{"version": "2.0", "rawPath": "/", "requestContext": {"http": {"method": "GET"}}}`)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if !resp.IsBase64Encoded || resp.Body != base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe, 0x00}) {
+		t.Errorf("expected a base64-encoded body, got %q", resp.Body)
+	}
+}
+
+func TestHandleInvalidEvent(t *testing.T) {
+	if _, err := lambda.NewHandler(echoHandler).Invoke(context.Background(), []byte(`not json`)); err == nil {
+		t.Fatal("expected an error for an invalid event")
+	}
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/lilokie/otp-auth/config"
+)
+
+// contextKey is the type of the context key request-scoped loggers are stored under
+type contextKey struct{}
+
+// New creates the application logger writing to w as configured. Unless sensitive
+// values are to be revealed, phone numbers and OTP codes are masked in all output.
+func New(cfg config.LoggingConfig, w io.Writer) *slog.Logger {
+	logger, _ := NewWithLevel(cfg, w)
+	return logger
+}
+
+// NewWithLevel creates the application logger like New, also returning the level it logs at,
+// which can be changed while the logger is in use
+func NewWithLevel(cfg config.LoggingConfig, w io.Writer) (*slog.Logger, *slog.LevelVar) {
+	level := new(slog.LevelVar)
+	level.Set(ParseLevel(cfg.Level))
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, "text") {
+		handler = slog.NewTextHandler(w, options)
+	} else {
+		handler = slog.NewJSONHandler(w, options)
+	}
+
+	if !cfg.RevealSensitive {
+		handler = NewRedactingHandler(handler)
+	}
+	return slog.New(handler), level
+}
+
+// Discard returns a logger that drops everything, for tests and tools that log nothing
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// WithLogger returns a copy of ctx carrying logger, typically one with request-scoped fields
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if it carries none
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// ParseLevel converts a configured level name to a slog level, defaulting to info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive attributes
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are never logged
+var sensitiveKeys = map[string]bool{
+	"otp":           true,
+	"code":          true,
+	"backup_code":   true,
+	"email":         true,
+	"email_body":    true,
+	"device_token":  true,
+	"refresh_token": true,
+	"captcha_token": true,
+	"carrier_token": true,
+	"token":         true,
+	"secret":        true,
+	"password":      true,
+	"api_key":       true,
+	"authorization": true,
+}
+
+// phoneNumberPattern matches phone numbers in free text: 10 to 15 digits, optionally prefixed by +
+var phoneNumberPattern = regexp.MustCompile(`\+?\d{10,15}`)
+
+// MaskPhoneNumbers replaces all but the last four digits of every phone number in s with asterisks
+func MaskPhoneNumbers(s string) string {
+	return phoneNumberPattern.ReplaceAllStringFunc(s, func(phone string) string {
+		digits := strings.TrimPrefix(phone, "+")
+		return phone[:len(phone)-len(digits)] + strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+	})
+}
+
+// RedactingHandler is a slog.Handler that masks phone numbers in messages and attribute values
+// and drops the values of sensitive attributes such as OTP codes before passing records on
+type RedactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps next with redaction
+func NewRedactingHandler(next slog.Handler) *RedactingHandler {
+	return &RedactingHandler{next: next}
+}
+
+// Enabled reports whether the wrapped handler handles records at level
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle redacts a record and passes it to the wrapped handler
+func (h *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, MaskPhoneNumbers(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs returns a handler with redacted attrs added to every record
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redactAttr(attr)
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+// WithGroup returns a handler that nests the attributes of every record in group name
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr drops the value of a sensitive attribute and masks phone numbers in any other.
+// Values that are neither strings nor groups are formatted first, since errors and
+// structs may contain phone numbers as well.
+func redactAttr(attr slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, MaskPhoneNumbers(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, MaskPhoneNumbers(err.Error()))
+		}
+		return slog.String(attr.Key, MaskPhoneNumbers(fmt.Sprint(value.Any())))
+	default:
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+}
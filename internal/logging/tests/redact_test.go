@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+)
+
+func TestMaskPhoneNumbers(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"+15551234567", "+*******4567"},
+		{"15551234567", "*******4567"},
+		{"sent to +15551234567 and +447700900123", "sent to +*******4567 and +********0123"},
+		{"123456", "123456"},
+		{"no phone here", "no phone here"},
+	}
+	for _, tt := range tests {
+		if got := logging.MaskPhoneNumbers(tt.value); got != tt.want {
+			t.Errorf("MaskPhoneNumbers(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLoggerRedactsSensitiveValues(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(config.LoggingConfig{Format: "text"}, &buf)
+
+	logger.With("phone_number", "+15551234567").Info("OTP sent to +15551234567",
+		"otp", "123456",
+		"error", errors.New("user +15551234567 not found"),
+	)
+
+	out := buf.String()
+	if strings.Contains(out, "+15551234567") {
+		t.Fatalf("expected phone number to be masked, got %s", out)
+	}
+	if strings.Contains(out, "123456") {
+		t.Fatalf("expected OTP to be redacted, got %s", out)
+	}
+	if !strings.Contains(out, "otp="+logging.Redacted) {
+		t.Fatalf("expected redacted otp attribute, got %s", out)
+	}
+}
+
+func TestLoggerRevealsSensitiveValues(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(config.LoggingConfig{Format: "text", RevealSensitive: true}, &buf)
+
+	logger.Info("OTP sent", "phone_number", "+15551234567", "otp", "123456")
+
+	out := buf.String()
+	if !strings.Contains(out, "+15551234567") || !strings.Contains(out, "otp=123456") {
+		t.Fatalf("expected sensitive values to be logged, got %s", out)
+	}
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Registry registers metrics with a Prometheus registry and serves them in the Prometheus
+// text exposition format
+type Registry struct {
+	registry *prometheus.Registry
+}
+
+// NewRegistry creates a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{registry: prometheus.NewRegistry()}
+}
+
+// Counter is a metric that only goes up
+type Counter = prometheus.Counter
+
+// Gauge is a metric that can go up and down
+type Gauge = prometheus.Gauge
+
+// CounterVec is a set of counters partitioned by label values
+type CounterVec struct {
+	vec *prometheus.CounterVec
+}
+
+// With returns the counter for the given label values
+func (cv *CounterVec) With(labelValues ...string) Counter {
+	return cv.vec.WithLabelValues(labelValues...)
+}
+
+// GaugeVec is a set of gauges partitioned by label values
+type GaugeVec struct {
+	vec *prometheus.GaugeVec
+}
+
+// With returns the gauge for the given label values
+func (gv *GaugeVec) With(labelValues ...string) Gauge {
+	return gv.vec.WithLabelValues(labelValues...)
+}
+
+// Counter registers (or returns the already registered) counter with the given name
+func (r *Registry) Counter(name, help string) Counter {
+	return register(r, prometheus.NewCounter(prometheus.CounterOpts{Name: name, Help: help}))
+}
+
+// Gauge registers (or returns the already registered) gauge with the given name
+func (r *Registry) Gauge(name, help string) Gauge {
+	return register(r, prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help}))
+}
+
+// CounterVec registers (or returns the already registered) labelled counter with the given name
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{vec: register(r, prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels))}
+}
+
+// GaugeVec registers (or returns the already registered) labelled gauge with the given name
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{vec: register(r, prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels))}
+}
+
+// Register registers a collector reporting its own metrics, such as the RedisCollector.
+// It panics if the collector's metrics clash with registered ones.
+func (r *Registry) Register(collector prometheus.Collector) {
+	r.registry.MustRegister(collector)
+}
+
+// register registers metric, returning the metric already registered under its name instead
+// if there is one. It panics if the name is reused with a different type, help or label set.
+func register[M prometheus.Collector](r *Registry, metric M) M {
+	if err := r.registry.Register(metric); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(M); ok {
+				return existing
+			}
+		}
+		panic(fmt.Sprintf("metrics: %v", err))
+	}
+	return metric
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	families, err := r.registry.Gather()
+	if err != nil {
+		return 0, fmt.Errorf("error gathering metrics: %w", err)
+	}
+
+	var written int64
+	for _, family := range families {
+		n, err := expfmt.MetricFamilyToText(w, family)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Handler returns an HTTP handler that serves the registry
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
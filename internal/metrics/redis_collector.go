@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RedisCollector periodically samples Redis keyspace statistics. Redis's own running totals
+// are reported as counters as of the latest sample.
+type RedisCollector struct {
+	client   *redis.Client
+	interval time.Duration
+	logger   *slog.Logger
+
+	expiredKeys    *prometheus.Desc
+	evictedKeys    *prometheus.Desc
+	expiredKeyRate Gauge
+
+	mu    sync.Mutex
+	stats map[string]float64 // latest sample of INFO stats, nil until the first
+}
+
+// NewRedisCollector creates a new Redis statistics collector and registers it with registry
+func NewRedisCollector(client *redis.Client, registry *Registry, interval time.Duration, logger *slog.Logger) *RedisCollector {
+	c := &RedisCollector{
+		client:         client,
+		interval:       interval,
+		logger:         logger,
+		expiredKeys:    prometheus.NewDesc("redis_expired_keys_total", "Total number of keys expired by Redis.", nil, nil),
+		evictedKeys:    prometheus.NewDesc("redis_evicted_keys_total", "Total number of keys evicted by Redis due to maxmemory.", nil, nil),
+		expiredKeyRate: registry.Gauge("redis_expired_keys_per_second", "Rate at which Redis expired keys over the last sampling interval."),
+	}
+	registry.Register(c)
+	return c
+}
+
+// Describe implements prometheus.Collector
+func (c *RedisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.expiredKeys
+	ch <- c.evictedKeys
+}
+
+// Collect implements prometheus.Collector, reporting nothing until Redis was first sampled
+func (c *RedisCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	stats := c.stats
+	c.mu.Unlock()
+	if stats == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.expiredKeys, prometheus.CounterValue, stats["expired_keys"])
+	ch <- prometheus.MustNewConstMetric(c.evictedKeys, prometheus.CounterValue, stats["evicted_keys"])
+}
+
+// Run samples Redis statistics until ctx is cancelled
+func (c *RedisCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	var (
+		lastExpired float64
+		lastSample  time.Time
+	)
+	for {
+		stats, err := c.sample(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Error("Error sampling Redis stats", "error", err)
+		} else {
+			now := time.Now()
+			expired := stats["expired_keys"]
+			if !lastSample.IsZero() && expired >= lastExpired {
+				c.expiredKeyRate.Set((expired - lastExpired) / now.Sub(lastSample).Seconds())
+			}
+			lastExpired, lastSample = expired, now
+
+			c.mu.Lock()
+			c.stats = stats
+			c.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample reads the numeric fields of INFO stats
+func (c *RedisCollector) sample(ctx context.Context) (map[string]float64, error) {
+	info, err := c.client.Info(ctx, "stats").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		name, raw, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok {
+			continue
+		}
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			stats[name] = f
+		}
+	}
+	return stats, scanner.Err()
+}
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+func TestRegistryWritesPrometheusText(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	registry.Counter("requests_total", "Total requests.").Add(3)
+	registry.Gauge("in_flight", "In-flight requests.").Set(2)
+	sends := registry.CounterVec("sms_sent_total", "SMS sent by provider.", "provider")
+	sends.With("a").Inc()
+	sends.With("b").Add(2)
+
+	var sb strings.Builder
+	if _, err := registry.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	out := sb.String()
+
+	for _, want := range []string{
+		"# TYPE requests_total counter\nrequests_total 3\n",
+		"# TYPE in_flight gauge\nin_flight 2\n",
+		`sms_sent_total{provider="a"} 1`,
+		`sms_sent_total{provider="b"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRegistryReturnsExistingMetric(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	registry.Counter("hits_total", "Hits.").Inc()
+	registry.Counter("hits_total", "Hits.").Inc()
+
+	var sb strings.Builder
+	if _, err := registry.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if !strings.Contains(sb.String(), "hits_total 2\n") {
+		t.Fatalf("expected shared counter, got:\n%s", sb.String())
+	}
+}
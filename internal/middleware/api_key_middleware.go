@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// APIKeyHeader is the header services send their API key in
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyMiddleware is a middleware authenticating services calling the API with an API key
+// on their own behalf rather than a user's
+type APIKeyMiddleware struct {
+	apiKeys *service.APIKeyService
+}
+
+// NewAPIKeyMiddleware creates a new API key middleware
+func NewAPIKeyMiddleware(apiKeys *service.APIKeyService) *APIKeyMiddleware {
+	return &APIKeyMiddleware{apiKeys: apiKeys}
+}
+
+// AuthRequired authenticates requests with an X-API-Key header by the key, which must be
+// granted scope, setting api_key_id in the context. Requests without one are handed to
+// userAuth, such as JWTAuthMiddleware.AuthRequired, so the route still serves users.
+func (m *APIKeyMiddleware) AuthRequired(scope string, userAuth gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader(APIKeyHeader)
+		if rawKey == "" {
+			userAuth(c)
+			return
+		}
+
+		key, err := m.apiKeys.Authenticate(c.Request.Context(), rawKey)
+		if err != nil {
+			if err.Error() == "invalid API key" {
+				apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid API key")
+			} else if errors.Is(err, concurrency.ErrLimitExceeded) {
+				apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+			} else {
+				apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error checking API key")
+			}
+			c.Abort()
+			return
+		}
+		if !key.HasScope(scope) {
+			apierror.Respond(c, http.StatusForbidden, apierror.Forbidden, fmt.Sprintf("API key lacks the %s scope", scope))
+			c.Abort()
+			return
+		}
+
+		c.Set("api_key_id", key.ID)
+		c.Next()
+	}
+}
+
+// UnlessAPIKey runs handler for requests authenticated as a user and skips it for those
+// authenticated with an API key, whose scope stands in for checks of the user's role such
+// as JWTAuthMiddleware.PermissionRequired. It must be used after AuthRequired.
+func (m *APIKeyMiddleware) UnlessAPIKey(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.Next()
+			return
+		}
+		handler(c)
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,16 +10,22 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
 )
 
 // JWTAuthMiddleware is a middleware for JWT authentication
 type JWTAuthMiddleware struct {
-	config *config.Config
+	config   *config.Config
+	tokens   *service.TokenSigner
+	sessions *service.SessionService
 }
 
-// NewJWTAuthMiddleware creates a new JWT authentication middleware
-func NewJWTAuthMiddleware(config *config.Config) *JWTAuthMiddleware {
-	return &JWTAuthMiddleware{config: config}
+// NewJWTAuthMiddleware creates a new JWT authentication middleware that rejects the tokens of revoked sessions
+func NewJWTAuthMiddleware(config *config.Config, tokens *service.TokenSigner, sessions *service.SessionService) *JWTAuthMiddleware {
+	return &JWTAuthMiddleware{config: config, tokens: tokens, sessions: sessions}
 }
 
 // AuthRequired checks if the request has a valid JWT token
@@ -27,7 +34,7 @@ func (m *JWTAuthMiddleware) AuthRequired() gin.HandlerFunc {
 		// Get authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Authorization header is required")
 			c.Abort()
 			return
 		}
@@ -35,7 +42,7 @@ func (m *JWTAuthMiddleware) AuthRequired() gin.HandlerFunc {
 		// Check if the header has the Bearer prefix
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header must be 'Bearer <token>'"})
+			apierror.Respond(c, http.StatusUnauthorized, apierror.Unauthorized, "Authorization header must be 'Bearer <token>'")
 			c.Abort()
 			return
 		}
@@ -44,17 +51,9 @@ func (m *JWTAuthMiddleware) AuthRequired() gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing algorithm
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			// Return the secret key
-			return []byte(m.config.JWT.Secret), nil
-		})
+		token, err := m.tokens.Parse(c.Request.Context(), tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Invalid token: %v", err)})
+			apierror.Respond(c, http.StatusUnauthorized, apierror.TokenInvalid, fmt.Sprintf("Invalid token: %v", err))
 			c.Abort()
 			return
 		}
@@ -64,7 +63,7 @@ func (m *JWTAuthMiddleware) AuthRequired() gin.HandlerFunc {
 			// Extract user ID from claims
 			userIDStr, ok := claims["user_id"].(string)
 			if !ok {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+				apierror.Respond(c, http.StatusUnauthorized, apierror.TokenInvalid, "Invalid token claims")
 				c.Abort()
 				return
 			}
@@ -72,7 +71,7 @@ func (m *JWTAuthMiddleware) AuthRequired() gin.HandlerFunc {
 			// Parse user ID as UUID
 			userID, err := uuid.Parse(userIDStr)
 			if err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+				apierror.Respond(c, http.StatusUnauthorized, apierror.TokenInvalid, "Invalid user ID in token")
 				c.Abort()
 				return
 			}
@@ -80,21 +79,79 @@ func (m *JWTAuthMiddleware) AuthRequired() gin.HandlerFunc {
 			// Extract phone number from claims
 			phoneNumber, ok := claims["phone_number"].(string)
 			if !ok {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+				apierror.Respond(c, http.StatusUnauthorized, apierror.TokenInvalid, "Invalid token claims")
 				c.Abort()
 				return
 			}
 
-			// Set user ID and phone number in context
+			// Tokens issued before roles existed carry no role claim
+			role, ok := claims["role"].(string)
+			if !ok || role == "" {
+				role = models.RoleUser
+			}
+
+			// Tokens issued before sessions existed carry no jti and cannot be revoked;
+			// they are accepted until they expire
+			if jti, ok := claims["jti"].(string); ok {
+				sessionID, err := uuid.Parse(jti)
+				if err != nil {
+					apierror.Respond(c, http.StatusUnauthorized, apierror.TokenInvalid, "Invalid token claims")
+					c.Abort()
+					return
+				}
+				if err := m.sessions.CheckSession(c.Request.Context(), userID, sessionID); err != nil {
+					if err.Error() == "session revoked" {
+						apierror.Respond(c, http.StatusUnauthorized, apierror.SessionRevoked, "Session has been revoked")
+					} else if errors.Is(err, concurrency.ErrLimitExceeded) {
+						apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+					} else {
+						apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error checking session")
+					}
+					c.Abort()
+					return
+				}
+				c.Set("session_id", sessionID)
+			}
+
+			// Set user ID, phone number and role in context
 			c.Set("user_id", userID)
 			c.Set("phone_number", phoneNumber)
+			c.Set("role", role)
 
 			// Continue with request
 			c.Next()
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			apierror.Respond(c, http.StatusUnauthorized, apierror.TokenInvalid, "Invalid token")
 			c.Abort()
 			return
 		}
 	}
 }
+
+// PermissionRequired checks that the authenticated user's role grants the permission.
+// Admins hold every permission; other roles are granted permissions in config.
+// It must be used after AuthRequired.
+func (m *JWTAuthMiddleware) PermissionRequired(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.hasPermission(c.GetString("role"), permission) {
+			apierror.Respond(c, http.StatusForbidden, apierror.Forbidden, "Permission denied")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// hasPermission reports whether role is granted permission
+func (m *JWTAuthMiddleware) hasPermission(role, permission string) bool {
+	if role == models.RoleAdmin {
+		return true
+	}
+	for _, granted := range m.config.Admin.Permissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
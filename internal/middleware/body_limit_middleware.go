@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+)
+
+// BodyLimitMiddleware is a middleware limiting the size of request bodies
+type BodyLimitMiddleware struct {
+	maxBytes int64
+}
+
+// NewBodyLimitMiddleware creates a new body limit middleware accepting bodies of up to maxBytes
+func NewBodyLimitMiddleware(maxBytes int64) *BodyLimitMiddleware {
+	return &BodyLimitMiddleware{maxBytes: maxBytes}
+}
+
+// LimitBody rejects requests declaring a larger body with 413 before it is read. Bodies sent
+// without a length are cut off at the limit, so reading past it fails and handlers reject
+// them as invalid, rather than the whole body being buffered in memory.
+func (m *BodyLimitMiddleware) LimitBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > m.maxBytes {
+			apierror.Respond(c, http.StatusRequestEntityTooLarge, apierror.PayloadTooLarge, "Request body too large")
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, m.maxBytes)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/canary"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// CanaryMiddleware is a middleware routing requests to the stable or canary variant of auth
+// logic and counting the responses of each variant
+type CanaryMiddleware struct {
+	router   *canary.Router
+	requests *metrics.CounterVec
+	seconds  *metrics.CounterVec
+}
+
+// NewCanaryMiddleware creates a new canary middleware, exporting the responses of each variant to registry
+func NewCanaryMiddleware(router *canary.Router, registry *metrics.Registry) *CanaryMiddleware {
+	return &CanaryMiddleware{
+		router:   router,
+		requests: registry.CounterVec("http_canary_requests_total", "Requests, by variant, route and status class.", "variant", "route", "status"),
+		seconds:  registry.CounterVec("http_canary_request_duration_seconds_total", "Time spent serving requests, by variant and route.", "variant", "route"),
+	}
+}
+
+// Route picks the variant of each request from its X-Canary header and client IP, stores it in
+// the request context, where components with a canary implementation pick theirs, and returns
+// it in the X-Canary response header
+func (m *CanaryMiddleware) Route() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		variant := m.router.Variant(c.GetHeader(canary.Header), c.ClientIP())
+		c.Request = c.Request.WithContext(canary.NewContext(c.Request.Context(), variant))
+		c.Header(canary.Header, variant)
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requests.With(variant, route, fmt.Sprintf("%dxx", c.Writer.Status()/100)).Inc()
+		m.seconds.With(variant, route).Add(time.Since(start).Seconds())
+	}
+}
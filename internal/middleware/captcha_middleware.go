@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/captcha"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
+)
+
+// CaptchaMiddleware requires a solved CAPTCHA from IP addresses that made too many requests
+type CaptchaMiddleware struct {
+	verifier  captcha.Verifier
+	threshold *ratelimit.Policy
+}
+
+// NewCaptchaMiddleware creates a new CAPTCHA middleware. Requests from an IP beyond threshold
+// need a captcha_token accepted by verifier; a nil verifier disables CAPTCHA.
+func NewCaptchaMiddleware(verifier captcha.Verifier, threshold *ratelimit.Policy) *CaptchaMiddleware {
+	return &CaptchaMiddleware{verifier: verifier, threshold: threshold}
+}
+
+// RequireCaptcha counts the requests from each IP address and, once there are more than the
+// threshold allows, rejects those without a valid captcha_token in their JSON body
+func (m *CaptchaMiddleware) RequireCaptcha() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.verifier == nil {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		ctx := c.Request.Context()
+
+		// A count of 0 requires a CAPTCHA on every request
+		if limit, _ := m.threshold.Limits(); limit > 0 {
+			result, err := m.threshold.Allow(ctx, ratelimit.CaptchaIPKey(ip))
+			if err != nil {
+				if errors.Is(err, concurrency.ErrLimitExceeded) {
+					apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+				} else {
+					apierror.Respond(c, http.StatusInternalServerError, apierror.InternalError, "Error checking CAPTCHA threshold")
+				}
+				c.Abort()
+				return
+			}
+			if result.Allowed {
+				c.Next()
+				return
+			}
+		}
+
+		// Read and preserve the request body
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Cannot read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+		var requestBody struct {
+			CaptchaToken string `json:"captcha_token"`
+		}
+		if err := json.Unmarshal(bodyBytes, &requestBody); err != nil || requestBody.CaptchaToken == "" {
+			apierror.RespondWith(c, http.StatusForbidden, apierror.CaptchaRequired, "CAPTCHA required", gin.H{"captcha_required": true})
+			c.Abort()
+			return
+		}
+
+		valid, err := m.verifier.Verify(ctx, requestBody.CaptchaToken, ip)
+		if err != nil {
+			// Without the provider there is no telling bots apart, so the request is refused
+			apierror.Respond(c, http.StatusServiceUnavailable, apierror.ServiceUnavailable, "CAPTCHA verification unavailable, try again later")
+			c.Abort()
+			return
+		}
+		if !valid {
+			apierror.RespondWith(c, http.StatusForbidden, apierror.CaptchaInvalid, "Invalid CAPTCHA", gin.H{"captcha_required": true})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
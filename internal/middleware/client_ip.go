@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigureClientIP makes c.ClientIP() return the client IP that trustedProxies (IPs and CIDRs)
+// pass in realIPHeader, and the connection's remote address for requests from anywhere else,
+// so clients cannot dodge rate limits by sending the header themselves. Without trusted
+// proxies, the header is ignored altogether. For X-Forwarded-For, the client IP is the last
+// address appended before the trusted proxies in front of the service.
+func ConfigureClientIP(router *gin.Engine, trustedProxies []string, realIPHeader string) error {
+	// Gin trusts every proxy unless told otherwise; nil trusts none
+	if len(trustedProxies) == 0 {
+		trustedProxies = nil
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return fmt.Errorf("error setting trusted proxies: %w", err)
+	}
+	router.ForwardedByClientIP = true
+	router.RemoteIPHeaders = []string{realIPHeader}
+	return nil
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/geo"
+)
+
+// CountryMiddleware is a middleware taking the country of requests from the header the
+// trusted proxies pass it in
+type CountryMiddleware struct {
+	header  string
+	proxies []*net.IPNet
+}
+
+// NewCountryMiddleware creates a new country middleware honoring header in requests from
+// trustedProxies (IPs and CIDRs)
+func NewCountryMiddleware(trustedProxies []string, header string) (*CountryMiddleware, error) {
+	proxies, err := parseNetworks(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &CountryMiddleware{header: header, proxies: proxies}, nil
+}
+
+// Country stores the country of requests from trusted proxies in the request context, from
+// where sessions record it. The header is ignored in requests from anywhere else, so clients
+// cannot claim a country themselves.
+func (m *CountryMiddleware) Country() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if country := geo.NormalizeCountry(c.GetHeader(m.header)); country != "" && inNetworks(m.proxies, c.RemoteIP()) {
+			c.Request = c.Request.WithContext(geo.NewContext(c.Request.Context(), country))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+)
+
+// RequestDeadlineHeader is the header upstream gateways propagate their deadline in
+const RequestDeadlineHeader = "X-Request-Deadline"
+
+// grpcTimeoutUnits maps the unit suffixes of grpc-timeout values to durations
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// DeadlineMiddleware is a middleware bounding how long requests may run
+type DeadlineMiddleware struct {
+	maxTimeout time.Duration
+}
+
+// NewDeadlineMiddleware creates a new deadline middleware that never lets a request run longer than maxTimeout
+func NewDeadlineMiddleware(maxTimeout time.Duration) *DeadlineMiddleware {
+	return &DeadlineMiddleware{maxTimeout: maxTimeout}
+}
+
+// Deadline sets a deadline on the request context, so Postgres and Redis calls give up
+// once the caller stops waiting. The deadline comes from the X-Request-Deadline header
+// when one is sent, capped at the server's maximum request timeout.
+func (m *DeadlineMiddleware) Deadline() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := m.maxTimeout
+
+		if value := c.GetHeader(RequestDeadlineHeader); value != "" {
+			requested, err := ParseRequestDeadline(value, time.Now())
+			if err != nil {
+				apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Invalid "+RequestDeadlineHeader+" header")
+				c.Abort()
+				return
+			}
+			if requested <= 0 {
+				apierror.Respond(c, http.StatusGatewayTimeout, apierror.DeadlineExceeded, "Request deadline exceeded")
+				c.Abort()
+				return
+			}
+			if requested < timeout {
+				timeout = requested
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// ParseRequestDeadline returns the time left until the deadline in an X-Request-Deadline value,
+// which is either an RFC 3339 timestamp or a grpc-timeout style duration such as "250m"
+func ParseRequestDeadline(value string, now time.Time) (time.Duration, error) {
+	if deadline, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return deadline.Sub(now), nil
+	}
+
+	// grpc-timeout: at most 8 digits followed by a unit
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("invalid request deadline %q", value)
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid request deadline unit in %q", value)
+	}
+	amount, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid request deadline %q: %w", value, err)
+	}
+
+	// Long timeouts in coarse units overflow time.Duration, they are capped by the server anyway
+	if amount > uint64(math.MaxInt64/unit) {
+		return time.Duration(math.MaxInt64), nil
+	}
+	return time.Duration(amount) * unit, nil
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// maxDeprecatedRouteClients caps the clients told apart per deprecated route; calls of further
+// clients are counted as "other", keeping the metric's label values bounded
+const maxDeprecatedRouteClients = 50
+
+// maxClientNameLength caps the length of client names taken from user agents
+const maxClientNameLength = 32
+
+// DeprecationMiddleware is a middleware marking the routes deprecated in the configuration and
+// counting who still calls them
+type DeprecationMiddleware struct {
+	config config.Provider
+	calls  *metrics.CounterVec
+
+	mu      sync.Mutex
+	clients map[string]map[string]bool // route -> clients told apart
+}
+
+// NewDeprecationMiddleware creates a new deprecation middleware marking the routes deprecated in
+// cfg's service.http.deprecations, exporting their calls to registry
+func NewDeprecationMiddleware(registry *metrics.Registry, cfg config.Provider) *DeprecationMiddleware {
+	return &DeprecationMiddleware{
+		config:  cfg,
+		calls:   registry.CounterVec("http_deprecated_requests_total", "Requests to deprecated routes, by client.", "route", "client"),
+		clients: make(map[string]map[string]bool),
+	}
+}
+
+// Deprecations marks the responses of deprecated routes with the Deprecation (RFC 9745),
+// Sunset (RFC 8594) and successor Link headers, and counts their calls by client, so a route
+// can be removed once no client calls it anymore. Routes are looked up in the current
+// configuration on each request, so deprecating a route takes a reload, not a release.
+func (m *DeprecationMiddleware) Deprecations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		for _, deprecation := range m.config.Current().Service.HTTP.Deprecations {
+			if deprecation.Route == route {
+				m.deprecated(c, route, deprecation)
+				break
+			}
+		}
+		c.Next()
+	}
+}
+
+// deprecated sets the deprecation headers of route's response and counts the call
+func (m *DeprecationMiddleware) deprecated(c *gin.Context, route string, deprecation config.DeprecationConfig) {
+	header := c.Writer.Header()
+	header.Set("Deprecation", fmt.Sprintf("@%d", deprecation.GetSince().Unix()))
+	if sunset := deprecation.GetSunset(); !sunset.IsZero() {
+		header.Set("Sunset", sunset.Format(http.TimeFormat))
+	}
+	if deprecation.Successor != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, deprecation.Successor))
+	}
+
+	m.calls.With(route, m.client(route, ClientName(c.Request.UserAgent()))).Inc()
+}
+
+// client returns the label of client's calls of route, "other" once the route's cap is reached
+func (m *DeprecationMiddleware) client(route, client string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clients := m.clients[route]
+	if clients == nil {
+		clients = make(map[string]bool)
+		m.clients[route] = clients
+	}
+	if !clients[client] {
+		if len(clients) >= maxDeprecatedRouteClients {
+			return "other"
+		}
+		clients[client] = true
+	}
+	return client
+}
+
+// ClientName names the client sending userAgent by its first product token, e.g. okhttp for
+// "okhttp/4.12.0" or kube-probe for "kube-probe/1.30", lowercased and stripped of characters
+// other than letters, digits, dots, dashes and underscores. Clients without a user agent are "unknown".
+func ClientName(userAgent string) string {
+	product, _, _ := strings.Cut(strings.TrimSpace(userAgent), " ")
+	product, _, _ = strings.Cut(product, "/")
+
+	var name strings.Builder
+	for _, r := range strings.ToLower(product) {
+		if name.Len() >= maxClientNameLength {
+			break
+		}
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '_' {
+			name.WriteRune(r)
+		}
+	}
+	if name.Len() == 0 {
+		return "unknown"
+	}
+	return name.String()
+}
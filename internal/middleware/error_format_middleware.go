@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+)
+
+// ErrorFormatMiddleware is a middleware choosing the format of error responses
+type ErrorFormatMiddleware struct {
+	legacy bool
+}
+
+// NewErrorFormatMiddleware creates a new error format middleware. With legacy set, errors use
+// the format that predates problem details.
+func NewErrorFormatMiddleware(legacy bool) *ErrorFormatMiddleware {
+	return &ErrorFormatMiddleware{legacy: legacy}
+}
+
+// ErrorFormat makes the errors of requests use the legacy format when configured, and RFC 7807
+// problem details otherwise. It must run ahead of any middleware that may respond with an error.
+func (m *ErrorFormatMiddleware) ErrorFormat() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.legacy {
+			apierror.UseLegacyFormat(c)
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// InFlightTracker keeps count of the requests being served
+type InFlightTracker interface {
+	// RequestStarted counts a request as in flight
+	RequestStarted()
+	// RequestFinished counts a request as no longer in flight
+	RequestFinished()
+}
+
+// InFlightMiddleware is a middleware counting the requests being served
+type InFlightMiddleware struct {
+	tracker InFlightTracker
+}
+
+// NewInFlightMiddleware creates a new in-flight middleware
+func NewInFlightMiddleware(tracker InFlightTracker) *InFlightMiddleware {
+	return &InFlightMiddleware{tracker: tracker}
+}
+
+// TrackInFlight counts every request as in flight until its handlers have returned
+func (m *InFlightMiddleware) TrackInFlight() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.tracker.RequestStarted()
+		defer m.tracker.RequestFinished()
+
+		c.Next()
+	}
+}
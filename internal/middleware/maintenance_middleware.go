@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// MaintenanceHeader is the response header announcing the next maintenance window
+const MaintenanceHeader = "X-Maintenance-Notice"
+
+// MaintenanceMiddleware is a middleware announcing planned downtime on every response
+type MaintenanceMiddleware struct {
+	maintenanceService *service.MaintenanceService
+	config             config.Provider
+}
+
+// NewMaintenanceMiddleware creates a new maintenance middleware
+func NewMaintenanceMiddleware(maintenanceService *service.MaintenanceService, cfg config.Provider) *MaintenanceMiddleware {
+	return &MaintenanceMiddleware{maintenanceService: maintenanceService, config: cfg}
+}
+
+// Announce sets the X-Maintenance-Notice header to the severity, start and end of the maintenance
+// window in progress or, if none is, the next one, e.g.
+// "severity=warning; starts_at=2026-10-20T02:00:00Z; ends_at=2026-10-20T04:00:00Z", while
+// maintenance.header is set. Clients get the message from GET /v1/meta/status. Responses go out
+// without the header if the notices cannot be read.
+func (m *MaintenanceMiddleware) Announce() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.config.Current().Maintenance.Header {
+			notices, err := m.maintenanceService.Current(c.Request.Context())
+			if err == nil && len(notices) > 0 {
+				next := notices[0]
+				c.Header(MaintenanceHeader, fmt.Sprintf("severity=%s; starts_at=%s; ends_at=%s",
+					next.Severity, next.StartsAt.UTC().Format(time.RFC3339), next.EndsAt.UTC().Format(time.RFC3339)))
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/silentauth"
+)
+
+// MSISDNMiddleware is a middleware taking the phone number of requests made over mobile data
+// from the header a carrier's enrichment proxies add to them
+type MSISDNMiddleware struct {
+	header  string
+	proxies []*net.IPNet
+}
+
+// NewMSISDNMiddleware creates a new MSISDN middleware honoring header in requests from the
+// carrier's enrichmentProxies (IPs and CIDRs)
+func NewMSISDNMiddleware(enrichmentProxies []string, header string) (*MSISDNMiddleware, error) {
+	proxies, err := parseNetworks(enrichmentProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &MSISDNMiddleware{header: header, proxies: proxies}, nil
+}
+
+// MSISDN stores the phone number of requests from the enrichment proxies in the request
+// context, from where silent verification reads it. Requests are from a proxy if their client
+// IP, as resolved through service.http.trustedProxies, is one of its addresses; the header is
+// ignored in requests from anywhere else, so clients cannot claim a number themselves.
+func (m *MSISDNMiddleware) MSISDN() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if msisdn := strings.TrimSpace(c.GetHeader(m.header)); msisdn != "" && inNetworks(m.proxies, c.ClientIP()) {
+			c.Request = c.Request.WithContext(silentauth.NewContext(c.Request.Context(), msisdn))
+		}
+		c.Next()
+	}
+}
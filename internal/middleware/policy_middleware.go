@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/policy"
+)
+
+// PolicyMiddleware is a middleware authorizing requests with the policy engine
+type PolicyMiddleware struct {
+	authorizer *policy.Authorizer
+}
+
+// NewPolicyMiddleware creates a new policy middleware; a nil authorizer allows every request
+func NewPolicyMiddleware(authorizer *policy.Authorizer) *PolicyMiddleware {
+	return &PolicyMiddleware{authorizer: authorizer}
+}
+
+// Authorize rejects requests the policies deny for action with 403. Used after AuthRequired,
+// the authenticated user is part of the input.
+func (m *PolicyMiddleware) Authorize(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.authorizer == nil {
+			c.Next()
+			return
+		}
+
+		m.authorize(c, policyInput(c, action))
+	}
+}
+
+// AuthorizeAuthFlow rejects requests the policies deny for action as Authorize does, adding
+// the phone_number of the JSON body to the input, for sign-in steps before there is a user
+func (m *PolicyMiddleware) AuthorizeAuthFlow(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.authorizer == nil {
+			c.Next()
+			return
+		}
+
+		// Read and preserve the request body
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Cannot read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+		input := policyInput(c, action)
+		var requestBody struct {
+			PhoneNumber string `json:"phone_number"`
+		}
+		if err := json.Unmarshal(bodyBytes, &requestBody); err == nil {
+			input.PhoneNumber = requestBody.PhoneNumber
+		}
+
+		m.authorize(c, input)
+	}
+}
+
+// authorize continues with the request if the policies allow input, and rejects it otherwise
+func (m *PolicyMiddleware) authorize(c *gin.Context, input *policy.Input) {
+	decision, err := m.authorizer.Authorize(c.Request.Context(), input)
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.ServiceUnavailable, "Authorization unavailable, try again later")
+		c.Abort()
+		return
+	}
+	if !decision.Allow {
+		message := "Denied by policy"
+		if decision.Reason != "" {
+			message = decision.Reason
+		}
+		apierror.Respond(c, http.StatusForbidden, apierror.PolicyDenied, message)
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// policyInput describes a request to the policies
+func policyInput(c *gin.Context, action string) *policy.Input {
+	input := &policy.Input{
+		Action:    action,
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if len(c.Params) > 0 {
+		input.Params = make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			input.Params[param.Key] = param.Value
+		}
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		if id, ok := userID.(uuid.UUID); ok {
+			input.User = &policy.User{
+				ID:          id.String(),
+				Role:        c.GetString("role"),
+				PhoneNumber: c.GetString("phone_number"),
+			}
+		}
+	}
+	return input
+}
@@ -3,58 +3,62 @@ package middleware
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
+	"github.com/lilokie/otp-auth/internal/service"
 )
 
+// RateLimitWarningHeader is the response header telling clients how much of a rate limit they
+// have used, once they near it
+const RateLimitWarningHeader = "X-RateLimit-Warning"
+
 // RateLimitMiddleware is a middleware for rate limiting
 type RateLimitMiddleware struct {
-	redisClient *redis.Client
+	events *service.EventService
+	config config.Provider
+	logger *slog.Logger
 }
 
 // NewRateLimitMiddleware creates a new rate limit middleware
-func NewRateLimitMiddleware(redisClient *redis.Client) *RateLimitMiddleware {
-	return &RateLimitMiddleware{redisClient: redisClient}
+func NewRateLimitMiddleware(events *service.EventService, cfg config.Provider, logger *slog.Logger) *RateLimitMiddleware {
+	return &RateLimitMiddleware{events: events, config: cfg, logger: logger}
 }
 
-// RateLimit limits the number of requests based on IP address
-func (m *RateLimitMiddleware) RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+// RateLimit limits the number of requests based on IP address. Responses carry the state of
+// the limit in X-RateLimit-* headers, and rejections a Retry-After header.
+// Near the limit, responses also carry a warning; see warnNearLimit.
+func (m *RateLimitMiddleware) RateLimit(policy *ratelimit.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get IP address
 		ip := c.ClientIP()
-		key := "rate_limit:ip:" + ip
-
-		// Check if key exists
-		ctx := c.Request.Context()
-		val, err := m.redisClient.Get(ctx, key).Int()
-		if err != nil && !errors.Is(err, redis.Nil) {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking rate limit"})
-			c.Abort()
-			return
-		}
+		key := ratelimit.IPKey(ip)
 
-		// If key doesn't exist, set it
-		if errors.Is(err, redis.Nil) {
-			m.redisClient.Set(ctx, key, 1, window)
-			c.Next()
+		// Record the hit and check if limit is exceeded
+		result, err := policy.Allow(c.Request.Context(), key)
+		if err != nil {
+			m.rateLimitFailed(c, err)
 			return
 		}
-
-		// Check if limit is exceeded
-		if val >= limit {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
-			c.Abort()
+		setRateLimitHeaders(c, result)
+		if !result.Allowed {
+			rejectRateLimited(c, result, "Rate limit exceeded")
 			return
 		}
-
-		// Increment counter
-		m.redisClient.Incr(ctx, key)
+		m.warnNearLimit(c, result, models.AggregateIP, ip)
+		m.setWarningHeader(c, result)
 
 		// Continue with request
 		c.Next()
@@ -62,88 +66,260 @@ func (m *RateLimitMiddleware) RateLimit(limit int, window time.Duration) gin.Han
 }
 
 // OTPRateLimit specifically limits OTP request rate by phone number and IP address
-// This provides stronger protection against OTP abuse by limiting both per-IP and per-phone number
-// OTPRateLimit specifically limits OTP request rate by phone number and IP address
-func (m *RateLimitMiddleware) OTPRateLimit(limit int, window time.Duration) gin.HandlerFunc {
+// This provides stronger protection against OTP abuse by limiting both per-IP and per-phone number.
+// The X-RateLimit-* headers describe whichever of the two limits is closer to being exceeded.
+func (m *RateLimitMiddleware) OTPRateLimit(policy *ratelimit.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// First check IP-based rate limit (basic protection)
 		ip := c.ClientIP()
-		ipKey := fmt.Sprintf("rate_limit:otp:ip:%s", ip)
+		ipKey := ratelimit.OTPIPKey(ip)
 
-		// Read and preserve the request body
-		bodyBytes, err := io.ReadAll(c.Request.Body)
+		// Try to extract phone number from request body
+		phoneNumber, err := bodyPhoneNumber(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot read request body"})
+			apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Cannot read request body")
 			c.Abort()
 			return
 		}
-
-		// Restore the body so it can be read again
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-		// Try to extract phone number from request body
-		var requestBody struct {
-			PhoneNumber string `json:"phone_number"`
-		}
-
-		phoneBasedLimiting := false
-		phoneKey := ""
-
-		if err := json.Unmarshal(bodyBytes, &requestBody); err == nil && requestBody.PhoneNumber != "" {
-			phoneBasedLimiting = true
-			phoneKey = fmt.Sprintf("rate_limit:otp:phone:%s", requestBody.PhoneNumber)
-		}
+		phoneBasedLimiting := phoneNumber != ""
+		phoneKey := ratelimit.OTPPhoneKey(phoneNumber)
 
 		ctx := c.Request.Context()
 
-		// Check IP-based rate limit
-		ipCount, err := m.redisClient.Get(ctx, ipKey).Int()
-		if err != nil && err != redis.Nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking rate limit"})
-			c.Abort()
+		// Check IP-based rate limit; the IP limit is higher than the phone number limit
+		limit, window := policy.Limits()
+		ipResult, err := policy.Limiter.Allow(ctx, ipKey, limit*2, window)
+		if err != nil {
+			m.rateLimitFailed(c, err)
+			return
+		}
+		if !ipResult.Allowed {
+			setRateLimitHeaders(c, ipResult)
+			rejectRateLimited(c, ipResult, "Rate limit exceeded")
 			return
 		}
+		m.warnNearLimit(c, ipResult, models.AggregateIP, ip)
+		result := ipResult
 
-		// If IP key doesn't exist, set it
-		if err == redis.Nil {
-			m.redisClient.Set(ctx, ipKey, 1, window)
-		} else {
-			// If IP limit is exceeded
-			if ipCount >= limit*2 { // IP limit is higher than phone number limit
-				c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
-				c.Abort()
+		// If we can do phone-based limiting
+		if phoneBasedLimiting {
+			phoneResult, err := policy.Allow(ctx, phoneKey)
+			if err != nil {
+				m.rateLimitFailed(c, err)
+				return
+			}
+			if !phoneResult.Allowed {
+				setRateLimitHeaders(c, phoneResult)
+				rejectRateLimited(c, phoneResult, "Too many OTP requests for this phone number")
 				return
 			}
-			// Increment IP counter
-			m.redisClient.Incr(ctx, ipKey)
+			m.warnNearLimit(c, phoneResult, models.AggregatePhone, phoneNumber)
+			if phoneResult.Remaining <= result.Remaining {
+				result = phoneResult
+			}
 		}
+		setRateLimitHeaders(c, result)
+		m.setWarningHeader(c, result)
 
-		// If we can do phone-based limiting
-		if phoneBasedLimiting {
-			// Check phone-based rate limit
-			phoneCount, err := m.redisClient.Get(ctx, phoneKey).Int()
-			if err != nil && err != redis.Nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking rate limit"})
+		// Continue with request
+		c.Next()
+	}
+}
+
+// ConfiguredRateLimit applies the limits of rateLimits.policies matching the request's route
+// that count hits per IP address or phone number, read from the configuration on every
+// request so reloading it changes them. Limits per user or API key are applied by
+// ConfiguredUserRateLimit, once the request is authenticated. The X-RateLimit-* headers
+// describe whichever limit is closest to being exceeded.
+func (m *RateLimitMiddleware) ConfiguredRateLimit(limiters map[string]ratelimit.Limiter) gin.HandlerFunc {
+	return m.configuredRateLimit(limiters, false)
+}
+
+// ConfiguredUserRateLimit applies the limits of rateLimits.policies matching the request's
+// route that count hits per user or API key; it must follow the authentication middleware,
+// so only authenticated callers are counted, rather than whatever they claim to be
+func (m *RateLimitMiddleware) ConfiguredUserRateLimit(limiters map[string]ratelimit.Limiter) gin.HandlerFunc {
+	return m.configuredRateLimit(limiters, true)
+}
+
+func (m *RateLimitMiddleware) configuredRateLimit(limiters map[string]ratelimit.Limiter, authenticated bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var result *ratelimit.Result
+		for _, policy := range m.config.Current().RateLimits.Policies {
+			if (policy.Key == "user" || policy.Key == "api-key") != authenticated || !matchesRoute(c, policy.Route) {
+				continue
+			}
+			id, err := clientID(c, policy.Key)
+			if err != nil {
+				apierror.Respond(c, http.StatusBadRequest, apierror.InvalidRequest, "Cannot read request body")
 				c.Abort()
 				return
 			}
+			// Requests without the client identifier, e.g. without a phone number, aren't counted
+			if id == "" {
+				continue
+			}
 
-			// If phone key doesn't exist, set it
-			if err == redis.Nil {
-				m.redisClient.Set(ctx, phoneKey, 1, window)
-			} else {
-				// If phone limit is exceeded
-				if phoneCount >= limit {
-					c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many OTP requests for this phone number"})
-					c.Abort()
-					return
-				}
-				// Increment phone counter
-				m.redisClient.Incr(ctx, phoneKey)
+			limiter := limiters[policy.Algorithm]
+			if limiter == nil {
+				limiter = limiters[ratelimit.AlgorithmFixedWindow]
 			}
+			policyResult, err := limiter.Allow(c.Request.Context(), ratelimit.PolicyKey(policy.Name, id), policy.Count, policy.Limit().GetWindow())
+			if err != nil {
+				m.rateLimitFailed(c, err)
+				return
+			}
+			if !policyResult.Allowed {
+				setRateLimitHeaders(c, policyResult)
+				rejectRateLimited(c, policyResult, "Rate limit exceeded")
+				return
+			}
+			if result == nil || policyResult.Remaining <= result.Remaining {
+				result = policyResult
+			}
+		}
+		if result != nil {
+			setRateLimitHeaders(c, result)
+			m.setWarningHeader(c, result)
 		}
 
-		// Continue with request
 		c.Next()
 	}
 }
+
+// matchesRoute reports whether the request's method and registered route match pattern,
+// "METHOD /path" or "/path", where a trailing * matches any route starting with the rest
+func matchesRoute(c *gin.Context, pattern string) bool {
+	path := pattern
+	if method, rest, ok := strings.Cut(pattern, " "); ok {
+		if method != c.Request.Method {
+			return false
+		}
+		path = rest
+	}
+	route := c.FullPath()
+	if route == "" {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(path, "*"); ok {
+		return strings.HasPrefix(route, prefix)
+	}
+	return route == path
+}
+
+// clientID returns what identifies the client of a request for a policy counting hits per key,
+// or "" if the request doesn't carry it. API keys are identified by the ID of the key the
+// APIKeyMiddleware authenticated, as callers could otherwise send a new made-up key with each
+// request to get a new count.
+func clientID(c *gin.Context, key string) (string, error) {
+	switch key {
+	case "ip":
+		return c.ClientIP(), nil
+	case "phone":
+		return bodyPhoneNumber(c)
+	case "user":
+		if userID, ok := c.Get("user_id"); ok {
+			return fmt.Sprint(userID), nil
+		}
+	case "api-key":
+		if apiKeyID, ok := c.Get("api_key_id"); ok {
+			return fmt.Sprint(apiKeyID), nil
+		}
+	}
+	return "", nil
+}
+
+// bodyPhoneNumber returns the phone_number of a JSON request body, or "" if it has none,
+// leaving the body to be read again
+func bodyPhoneNumber(c *gin.Context) (string, error) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+	var requestBody struct {
+		PhoneNumber string `json:"phone_number"`
+	}
+	if err := json.Unmarshal(bodyBytes, &requestBody); err != nil {
+		return "", nil
+	}
+	return requestBody.PhoneNumber, nil
+}
+
+// setRateLimitHeaders tells clients the limit of the rate limit key checked, how many requests
+// they have left and in how many seconds the key resets, so they can pace themselves
+func setRateLimitHeaders(c *gin.Context, result *ratelimit.Result) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetIn)))
+}
+
+// warnNearLimit records a ratelimit.warning event about the IP address or phone number
+// aggregateID when the request is the one that reaches rateLimits.warningThreshold percent of
+// its limit, so integrators can react before their requests get rejected. Failing to record the
+// event doesn't fail the request.
+func (m *RateLimitMiddleware) warnNearLimit(c *gin.Context, result *ratelimit.Result, aggregateType, aggregateID string) {
+	threshold := m.config.Current().RateLimits.WarningThreshold
+	if threshold <= 0 || result.Limit <= 0 {
+		return
+	}
+	// The smallest number of requests that is at least threshold percent of the limit
+	warnAt := (result.Limit*threshold + 99) / 100
+	if result.Limit-result.Remaining != warnAt {
+		return
+	}
+
+	err := m.events.Publish(c.Request.Context(), models.EventRateLimitWarning, aggregateType, aggregateID, map[string]interface{}{
+		"route":     c.FullPath(),
+		"limit":     result.Limit,
+		"remaining": result.Remaining,
+		"reset_in":  ceilSeconds(result.ResetIn),
+	})
+	if err != nil {
+		m.logger.Warn("Error recording rate limit warning", "error", err)
+	}
+}
+
+// setWarningHeader sets the X-RateLimit-Warning header to the percentage of the limit used, e.g.
+// "80", once it is at least rateLimits.warningThreshold
+func (m *RateLimitMiddleware) setWarningHeader(c *gin.Context, result *ratelimit.Result) {
+	threshold := m.config.Current().RateLimits.WarningThreshold
+	if threshold <= 0 || result.Limit <= 0 {
+		return
+	}
+	used := (result.Limit - result.Remaining) * 100 / result.Limit
+	if used >= threshold {
+		c.Header(RateLimitWarningHeader, strconv.Itoa(used))
+	}
+}
+
+// rejectRateLimited responds with 429 Too Many Requests, telling the client when to retry
+// both in the Retry-After header and in the body
+func rejectRateLimited(c *gin.Context, result *ratelimit.Result, message string) {
+	retryAfter := result.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = result.ResetIn
+	}
+	// Retry-After must be a positive number of seconds, or clients retry right away
+	seconds := ceilSeconds(retryAfter)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	apierror.RespondWith(c, http.StatusTooManyRequests, apierror.RateLimited, message, gin.H{"retry_after": seconds})
+	c.Abort()
+}
+
+// rateLimitFailed responds with 503 Service Unavailable to a request whose rate limit couldn't
+// be checked, which only happens with rateLimits.failurePolicy closed
+func (m *RateLimitMiddleware) rateLimitFailed(c *gin.Context, err error) {
+	m.logger.Error("Error checking rate limit", "error", err)
+	apierror.RespondUnavailable(c, concurrency.RetryAfter(err))
+	c.Abort()
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
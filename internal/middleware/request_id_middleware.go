@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/apierror"
+	"github.com/lilokie/otp-auth/internal/requestid"
+)
+
+// RequestIDKey is the Gin context key the request ID is stored under
+const RequestIDKey = "request_id"
+
+// errorCodeField is the field of JSON error responses holding their error code
+const errorCodeField = "code"
+
+// RequestIDMiddleware is a middleware assigning every request an ID
+type RequestIDMiddleware struct{}
+
+// NewRequestIDMiddleware creates a new request ID middleware
+func NewRequestIDMiddleware() *RequestIDMiddleware {
+	return &RequestIDMiddleware{}
+}
+
+// RequestID keeps the X-Request-ID of a caller that already assigned one, so requests can be
+// correlated across services, and generates one otherwise. The ID is returned in the response
+// header and in JSON error responses, and stored in the Gin context and the request context,
+// from where it reaches the logs, Postgres queries and SMS providers.
+func (m *RequestIDMiddleware) RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(requestid.Header, id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Writer = &errorResponseWriter{ResponseWriter: c.Writer, requestID: id}
+
+		c.Next()
+	}
+}
+
+// errorResponseWriter adds the request ID to JSON and problem details error responses, and the
+// generic code of their status to JSON ones without a code, such as errors written
+// without apierror, so every handler's errors carry both without each handler having to set them
+type errorResponseWriter struct {
+	gin.ResponseWriter
+	requestID string
+	written   bool
+}
+
+// Write writes the response body, adding the request ID and error code to the first write of an error
+func (w *errorResponseWriter) Write(data []byte) (int, error) {
+	contentType := w.Header().Get("Content-Type")
+	problem := strings.HasPrefix(contentType, apierror.ContentType)
+	if w.written || w.Status() < http.StatusBadRequest ||
+		!problem && !strings.HasPrefix(contentType, "application/json") {
+		w.written = true
+		return w.ResponseWriter.Write(data)
+	}
+	w.written = true
+
+	// Problem details always carry their error code
+	body := data
+	if !problem {
+		body = WithErrorCodeField(body, apierror.ForStatus(w.Status()))
+	}
+	if _, err := w.ResponseWriter.Write(WithRequestIDField(body, w.requestID)); err != nil {
+		return 0, err
+	}
+	// Callers only know about the bytes they passed in
+	return len(data), nil
+}
+
+// WriteString writes the response body as Write does
+func (w *errorResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WithRequestIDField adds a request_id field to a JSON object. Bodies that are not
+// JSON objects or already have the field are returned unchanged.
+func WithRequestIDField(body []byte, requestID string) []byte {
+	return withField(body, RequestIDKey, requestID)
+}
+
+// WithErrorCodeField adds a code field to a JSON object. Bodies that are not JSON objects
+// or already have the field, i.e. errors with a more specific code, are returned unchanged.
+func WithErrorCodeField(body []byte, code string) []byte {
+	return withField(body, errorCodeField, code)
+}
+
+// withField adds a string field to a JSON object, unless it already has it
+func withField(body []byte, key, value string) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' {
+		return body
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return body
+	}
+	if _, ok := fields[key]; ok {
+		return body
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+
+	// Splice the field in rather than re-encoding, so the order of the other fields is kept
+	result := append([]byte(`{"`+key+`":`), encoded...)
+	if rest := bytes.TrimSpace(trimmed[1:]); rest[0] != '}' {
+		result = append(result, ',')
+	}
+	return append(result, trimmed[1:]...)
+}
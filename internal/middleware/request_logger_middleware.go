@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/requestid"
+)
+
+// RequestLoggerMiddleware is a middleware for request-scoped structured logging
+type RequestLoggerMiddleware struct {
+	logger *slog.Logger
+}
+
+// NewRequestLoggerMiddleware creates a new request logger middleware
+func NewRequestLoggerMiddleware(logger *slog.Logger) *RequestLoggerMiddleware {
+	return &RequestLoggerMiddleware{logger: logger}
+}
+
+// RequestLogger puts a logger carrying the request ID assigned by the request ID middleware
+// in the request context for everything logged while handling the request, and logs each
+// completed request
+func (m *RequestLoggerMiddleware) RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		logger := m.logger.With("request_id", requestid.FromContext(c.Request.Context()))
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), logger))
+
+		c.Next()
+
+		// Routes are logged by pattern so path parameters such as phone numbers stay out of the logs
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request completed",
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/tenant"
+)
+
+// TenantMiddleware is a middleware taking the tenant requests are made for from the header
+// the trusted proxies pass it in
+type TenantMiddleware struct {
+	header  string
+	proxies []*net.IPNet
+}
+
+// NewTenantMiddleware creates a new tenant middleware honoring header in requests from
+// trustedProxies (IPs and CIDRs)
+func NewTenantMiddleware(trustedProxies []string, header string) (*TenantMiddleware, error) {
+	proxies, err := parseNetworks(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &TenantMiddleware{header: header, proxies: proxies}, nil
+}
+
+// Tenant stores the tenant of requests from trusted proxies in the request context, from where
+// per-tenant policies such as sms.overflow.tenants are applied. The header is ignored in
+// requests from anywhere else, so clients cannot pick another tenant's policy themselves.
+func (m *TenantMiddleware) Tenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if name := tenant.Normalize(c.GetHeader(m.header)); name != "" && inNetworks(m.proxies, c.RemoteIP()) {
+			c.Request = c.Request.WithContext(tenant.NewContext(c.Request.Context(), name))
+		}
+		c.Next()
+	}
+}
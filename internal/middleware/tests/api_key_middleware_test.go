@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/middleware"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestAPIKeyMiddlewareAuthRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	apiKeys := service.NewAPIKeyService(repository.NewInMemoryAPIKeyRepository(), service.NewAuditService(nopAuditRepository{}))
+	created, err := apiKeys.Create(context.Background(), models.AuditActor{}, models.CreateAPIKeyRequest{
+		Name:   "billing",
+		Scopes: []string{models.APIKeyScopeUsersRead},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	apiKeyMiddleware := middleware.NewAPIKeyMiddleware(apiKeys)
+	// Stands in for the JWT middleware, authenticating every request without a key as a user
+	userAuth := func(c *gin.Context) {
+		c.Set("user_id", "user")
+		c.Next()
+	}
+	// Stands in for a permission check users without the right role fail
+	userOnly := apiKeyMiddleware.UnlessAPIKey(func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusForbidden)
+	})
+	caller := func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.String(http.StatusOK, "api_key")
+			return
+		}
+		c.String(http.StatusOK, c.GetString("user_id"))
+	}
+	router := gin.New()
+	router.GET("/read", apiKeyMiddleware.AuthRequired(models.APIKeyScopeUsersRead, userAuth), caller)
+	router.GET("/write", apiKeyMiddleware.AuthRequired(models.APIKeyScopeUsersMetadata, userAuth), caller)
+	router.GET("/admin", apiKeyMiddleware.AuthRequired(models.APIKeyScopeUsersRead, userAuth), userOnly, caller)
+
+	tests := []struct {
+		path, key  string
+		wantStatus int
+		wantCaller string
+	}{
+		{"/read", created.Key, http.StatusOK, "api_key"},
+		{"/read", "", http.StatusOK, "user"},
+		{"/read", "otpk_unknown", http.StatusUnauthorized, ""},
+		{"/write", created.Key, http.StatusForbidden, ""},
+		{"/admin", created.Key, http.StatusOK, "api_key"},
+		{"/admin", "", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.key != "" {
+			req.Header.Set(middleware.APIKeyHeader, tt.key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%s with key %q: status = %d, want %d", tt.path, tt.key, w.Code, tt.wantStatus)
+		}
+		if tt.wantCaller != "" && w.Body.String() != tt.wantCaller {
+			t.Fatalf("%s with key %q: caller = %q, want %q", tt.path, tt.key, w.Body.String(), tt.wantCaller)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/middleware"
+)
+
+func clientIP(t *testing.T, trustedProxies []string, realIPHeader, remoteAddr string, headers map[string]string) string {
+	t.Helper()
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	if err := middleware.ConfigureClientIP(router, trustedProxies, realIPHeader); err != nil {
+		t.Fatalf("ConfigureClientIP failed: %v", err)
+	}
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		c.Request.Header.Set(name, value)
+	}
+	return c.ClientIP()
+}
+
+func TestConfigureClientIP(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "192.0.2.1"}
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		realIPHeader   string
+		remoteAddr     string
+		headers        map[string]string
+		want           string
+	}{
+		{"no trusted proxies ignore the header", nil, "X-Forwarded-For", "10.0.0.5:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "10.0.0.5"},
+		{"header from trusted proxy CIDR", proxies, "X-Forwarded-For", "10.0.0.5:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"header from trusted proxy IP", proxies, "X-Forwarded-For", "192.0.2.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"header from untrusted client", proxies, "X-Forwarded-For", "198.51.100.9:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "198.51.100.9"},
+		{"spoofed entries before the proxy's are skipped", proxies, "X-Forwarded-For", "10.0.0.5:1234",
+			map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.7, 10.0.0.6"}, "203.0.113.7"},
+		{"other headers are ignored", proxies, "X-Forwarded-For", "10.0.0.5:1234",
+			map[string]string{"X-Real-IP": "203.0.113.7"}, "10.0.0.5"},
+		{"custom header", proxies, "CF-Connecting-IP", "10.0.0.5:1234",
+			map[string]string{"CF-Connecting-IP": "203.0.113.7", "X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		{"invalid header value", proxies, "X-Forwarded-For", "10.0.0.5:1234",
+			map[string]string{"X-Forwarded-For": "unknown"}, "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientIP(t, tt.trustedProxies, tt.realIPHeader, tt.remoteAddr, tt.headers); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigureClientIPInvalidProxy(t *testing.T) {
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	if err := middleware.ConfigureClientIP(router, []string{"not-an-ip"}, "X-Forwarded-For"); err == nil {
+		t.Error("expected an error for an invalid trusted proxy")
+	}
+}
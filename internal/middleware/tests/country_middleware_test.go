@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/geo"
+	"github.com/lilokie/otp-auth/internal/middleware"
+)
+
+func TestCountryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, err := middleware.NewCountryMiddleware([]string{"10.0.0.0/8", "192.0.2.1"}, "CF-IPCountry")
+	if err != nil {
+		t.Fatalf("NewCountryMiddleware: %v", err)
+	}
+	router := gin.New()
+	router.Use(m.Country())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, geo.CountryFromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		country    string
+		want       string
+	}{
+		{"trusted proxy CIDR", "10.0.0.5:1234", "IR", "IR"},
+		{"trusted proxy IP", "192.0.2.1:1234", "de", "DE"},
+		{"untrusted client", "198.51.100.9:1234", "IR", ""},
+		{"unknown country", "10.0.0.5:1234", "XX", ""},
+		{"Tor", "10.0.0.5:1234", "T1", ""},
+		{"no header", "10.0.0.5:1234", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.country != "" {
+				req.Header.Set("CF-IPCountry", tt.country)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("country = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := middleware.NewCountryMiddleware([]string{"not-an-ip"}, "CF-IPCountry"); err == nil {
+		t.Error("expected an error for an invalid trusted proxy")
+	}
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/middleware"
+)
+
+func TestParseRequestDeadline(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"2024-01-01T12:00:02Z", 2 * time.Second},
+		{"2024-01-01T12:00:00.250Z", 250 * time.Millisecond},
+		{"2024-01-01T11:59:59Z", -time.Second},
+		{"250m", 250 * time.Millisecond},
+		{"3S", 3 * time.Second},
+		{"1M", time.Minute},
+		{"1H", time.Hour},
+		{"500u", 500 * time.Microsecond},
+		{"99999999H", time.Duration(math.MaxInt64)},
+	}
+	for _, tt := range tests {
+		got, err := middleware.ParseRequestDeadline(tt.value, now)
+		if err != nil {
+			t.Fatalf("ParseRequestDeadline(%q): %v", tt.value, err)
+		}
+		if got != tt.want {
+			t.Fatalf("ParseRequestDeadline(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseRequestDeadlineInvalid(t *testing.T) {
+	now := time.Now()
+
+	for _, value := range []string{"", "S", "10", "10s", "-5S", "123456789S", "soon"} {
+		if _, err := middleware.ParseRequestDeadline(value, now); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
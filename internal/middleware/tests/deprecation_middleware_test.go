@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/middleware"
+)
+
+func TestDeprecations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{Service: config.ServiceConfig{HTTP: config.HTTPConfig{Deprecations: []config.DeprecationConfig{
+		{Route: "GET /v1/old/:id", Since: "2026-10-16", Sunset: "2027-05-01", Successor: "/v2/new/{id}"},
+		{Route: "POST /v1/old", Since: "2026-10-16"},
+	}}}}
+	registry := metrics.NewRegistry()
+	m := middleware.NewDeprecationMiddleware(registry, cfg)
+
+	router := gin.New()
+	router.Use(m.Deprecations())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/v1/old/:id", ok)
+	router.POST("/v1/old", ok)
+	router.GET("/v1/old", ok)
+
+	request := func(method, path, userAgent string) http.Header {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("User-Agent", userAgent)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s %s: status = %d, want 204", method, path, w.Code)
+		}
+		return w.Header()
+	}
+
+	header := request(http.MethodGet, "/v1/old/1", "okhttp/4.12.0")
+	if got := header.Get("Deprecation"); got != "@1792108800" {
+		t.Errorf("Deprecation = %q, want @1792108800", got)
+	}
+	if got := header.Get("Sunset"); got != "Sat, 01 May 2027 00:00:00 GMT" {
+		t.Errorf("Sunset = %q, want Sat, 01 May 2027 00:00:00 GMT", got)
+	}
+	if got := header.Get("Link"); got != `</v2/new/{id}>; rel="successor-version"` {
+		t.Errorf("Link = %q, want the successor", got)
+	}
+	request(http.MethodGet, "/v1/old/2", "okhttp/4.12.0")
+
+	// Routes without a sunset or successor only get the Deprecation header
+	header = request(http.MethodPost, "/v1/old", "curl/8.5.0")
+	if header.Get("Deprecation") == "" || header.Get("Sunset") != "" || header.Get("Link") != "" {
+		t.Errorf("expected only the Deprecation header, got %v", header)
+	}
+
+	// Other methods of the same path are not deprecated
+	if header := request(http.MethodGet, "/v1/old", "curl/8.5.0"); header.Get("Deprecation") != "" {
+		t.Errorf("expected GET /v1/old not to be deprecated, got %v", header)
+	}
+
+	var out bytes.Buffer
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	for _, want := range []string{
+		`http_deprecated_requests_total{client="okhttp",route="GET /v1/old/:id"} 2`,
+		`http_deprecated_requests_total{client="curl",route="POST /v1/old"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %s in:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), `route="GET /v1/old"`) {
+		t.Errorf("expected no calls of GET /v1/old counted:\n%s", out.String())
+	}
+}
+
+func TestClientName(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"okhttp/4.12.0", "okhttp"},
+		{"kube-probe/1.30", "kube-probe"},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36", "mozilla"},
+		{"  curl/8.5.0", "curl"},
+		{"MyApp", "myapp"},
+		{"my app/1.0", "my"},
+		{"<script>/1", "script"},
+		{"", "unknown"},
+		{"/1.0", "unknown"},
+		{"ééé", "unknown"},
+		{strings.Repeat("a", 100), strings.Repeat("a", 32)},
+	}
+	for _, tt := range tests {
+		if got := middleware.ClientName(tt.userAgent); got != tt.want {
+			t.Errorf("ClientName(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
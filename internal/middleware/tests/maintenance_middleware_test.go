@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/middleware"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// nopAuditRepository discards audit entries
+type nopAuditRepository struct{}
+
+func (nopAuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	return nil
+}
+
+func (nopAuditRepository) ListByTarget(ctx context.Context, targetType, targetID string, limit int) ([]models.AuditLog, int64, error) {
+	return nil, 0, nil
+}
+
+func TestMaintenanceMiddlewareAnnounce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	maintenance := service.NewMaintenanceService(repository.NewInMemoryMaintenanceNoticeRepository(), service.NewAuditService(nopAuditRepository{}), cfg)
+	router := gin.New()
+	router.GET("/", middleware.NewMaintenanceMiddleware(maintenance, cfg).Announce(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	announced := func() string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Header().Get(middleware.MaintenanceHeader)
+	}
+
+	start := time.Date(2030, 1, 1, 2, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{24 * time.Hour, 0} {
+		_, err := maintenance.Create(context.Background(), models.AuditActor{}, models.CreateMaintenanceNoticeRequest{
+			Message:  "Upgrade",
+			Severity: models.MaintenanceSeverityWarning,
+			StartsAt: start.Add(offset),
+			EndsAt:   start.Add(offset + 2*time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	if got := announced(); got != "" {
+		t.Fatalf("header = %q with maintenance.header unset, want none", got)
+	}
+
+	cfg.Maintenance.Header = true
+	want := "severity=warning; starts_at=2030-01-01T02:00:00Z; ends_at=2030-01-01T04:00:00Z"
+	if got := announced(); got != want {
+		t.Fatalf("header = %q, want the next window %q", got, want)
+	}
+}
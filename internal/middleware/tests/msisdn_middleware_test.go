@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/middleware"
+	"github.com/lilokie/otp-auth/internal/silentauth"
+)
+
+func TestMSISDNMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, err := middleware.NewMSISDNMiddleware([]string{"10.0.0.0/8"}, "X-MSISDN")
+	if err != nil {
+		t.Fatalf("NewMSISDNMiddleware: %v", err)
+	}
+	router := gin.New()
+	router.Use(m.MSISDN())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, silentauth.MSISDNFromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		msisdn     string
+		want       string
+	}{
+		{"enrichment proxy", "10.0.0.5:1234", "989121234567", "989121234567"},
+		{"other client", "198.51.100.9:1234", "989121234567", ""},
+		{"no header", "10.0.0.5:1234", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.msisdn != "" {
+				req.Header.Set("X-MSISDN", tt.msisdn)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("msisdn = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := middleware.NewMSISDNMiddleware([]string{"not-an-ip"}, "X-MSISDN"); err == nil {
+		t.Error("expected an error for an invalid enrichment proxy")
+	}
+}
@@ -0,0 +1,289 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/middleware"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// newRateLimitMiddleware creates a rate limit middleware warning at warningThreshold percent,
+// recording its events in eventRepo
+func newRateLimitMiddleware(warningThreshold int, eventRepo repository.EventRepository) *middleware.RateLimitMiddleware {
+	cfg := &config.Config{RateLimits: config.RateLimitsConfig{WarningThreshold: warningThreshold}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return middleware.NewRateLimitMiddleware(service.NewEventService(eventRepo), cfg, logger)
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := ratelimit.NewPolicy(ratelimit.NewMemoryFixedWindowLimiter(), 2, time.Minute)
+	router := gin.New()
+	router.GET("/", newRateLimitMiddleware(0, repository.NewInMemoryEventRepository()).RateLimit(policy), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: X-RateLimit-Limit = %q, want 2", i+1, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %s", i+1, got, wantRemaining)
+		}
+		if reset, _ := strconv.Atoi(w.Header().Get("X-RateLimit-Reset")); reset < 1 || reset > 60 {
+			t.Errorf("request %d: X-RateLimit-Reset = %q, want 1 to 60 seconds", i+1, w.Header().Get("X-RateLimit-Reset"))
+		}
+		if got := w.Header().Get("Retry-After"); got != "" {
+			t.Errorf("request %d: Retry-After = %q on an allowed request", i+1, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("Retry-After = %q, want 1 to 60 seconds", w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(w.Body.String(), `"retry_after":`+strconv.Itoa(retryAfter)) {
+		t.Errorf("body %s lacks retry_after %d", w.Body.String(), retryAfter)
+	}
+}
+
+func TestOTPRateLimitHeadersReportTheTighterLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := ratelimit.NewPolicy(ratelimit.NewMemoryFixedWindowLimiter(), 3, time.Minute)
+	router := gin.New()
+	router.POST("/", newRateLimitMiddleware(0, repository.NewInMemoryEventRepository()).OTPRateLimit(policy), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"phone_number":"+989123456789"}`)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	// The IP allows twice the phone number limit, so the phone number limit is the tighter one
+	if got := w.Header().Get("X-RateLimit-Limit"); got != "3" {
+		t.Errorf("X-RateLimit-Limit = %q, want 3", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "2" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 2", got)
+	}
+}
+
+func TestRateLimitWarnsNearTheLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	eventRepo := repository.NewInMemoryEventRepository()
+	policy := ratelimit.NewPolicy(ratelimit.NewMemoryFixedWindowLimiter(), 5, time.Minute)
+	router := gin.New()
+	router.GET("/", newRateLimitMiddleware(80, eventRepo).RateLimit(policy), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for i, wantWarning := range []string{"", "", "", "80", "100"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get(middleware.RateLimitWarningHeader); got != wantWarning {
+			t.Errorf("request %d: %s = %q, want %q", i+1, middleware.RateLimitWarningHeader, got, wantWarning)
+		}
+	}
+
+	// Only the request reaching the threshold records an event
+	events, err := eventRepo.ListAfter(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("ListAfter: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(events))
+	}
+	if events[0].Type != models.EventRateLimitWarning || events[0].AggregateType != models.AggregateIP {
+		t.Errorf("event = %s about %s, want %s about %s", events[0].Type, events[0].AggregateType, models.EventRateLimitWarning, models.AggregateIP)
+	}
+	if !strings.Contains(string(events[0].Payload), `"remaining":1`) {
+		t.Errorf("payload %s lacks remaining 1", events[0].Payload)
+	}
+}
+
+func TestOTPRateLimitWarnsPerPhoneNumber(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	eventRepo := repository.NewInMemoryEventRepository()
+	policy := ratelimit.NewPolicy(ratelimit.NewMemoryFixedWindowLimiter(), 2, time.Minute)
+	router := gin.New()
+	router.POST("/", newRateLimitMiddleware(50, eventRepo).OTPRateLimit(policy), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"phone_number":"+989123456789"}`)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got := w.Header().Get(middleware.RateLimitWarningHeader); got != "50" {
+		t.Errorf("%s = %q, want 50", middleware.RateLimitWarningHeader, got)
+	}
+
+	events, err := eventRepo.ListAfter(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("ListAfter: %v", err)
+	}
+	// The IP address has used one of its four requests, short of the threshold
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(events))
+	}
+	if events[0].AggregateType != models.AggregatePhone || events[0].AggregateID != "+989123456789" {
+		t.Errorf("event about %s %s, want phone +989123456789", events[0].AggregateType, events[0].AggregateID)
+	}
+}
+
+func TestConfiguredRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{RateLimits: config.RateLimitsConfig{Policies: []config.RateLimitPolicyConfig{
+		{Name: "verify-ip", Route: "POST /verify", Key: "ip", Count: 3, Time: 1},
+		{Name: "verify-phone", Route: "/verify", Key: "phone", Count: 1, Time: 1},
+		{Name: "users", Route: "/users/*", Key: "user", Count: 1, Time: 1},
+	}}}
+	m := middleware.NewRateLimitMiddleware(service.NewEventService(repository.NewInMemoryEventRepository()), cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	limiters := map[string]ratelimit.Limiter{ratelimit.AlgorithmFixedWindow: ratelimit.NewMemoryFixedWindowLimiter()}
+
+	router := gin.New()
+	router.Use(m.ConfiguredRateLimit(limiters))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.POST("/verify", ok)
+	router.GET("/verify", ok)
+	users := router.Group("/users")
+	users.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-User")) }, m.ConfiguredUserRateLimit(limiters))
+	users.GET("/:id", ok)
+
+	request := func(method, path, body, user string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("X-User", user)
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// The phone number limit counts each number apart, and only applies to requests carrying one
+	if code := request(http.MethodPost, "/verify", `{"phone_number":"+15550001"}`, ""); code != http.StatusNoContent {
+		t.Fatalf("first request for a number: status = %d", code)
+	}
+	if code := request(http.MethodPost, "/verify", `{"phone_number":"+15550001"}`, ""); code != http.StatusTooManyRequests {
+		t.Fatalf("second request for a number: status = %d, want 429", code)
+	}
+	if code := request(http.MethodPost, "/verify", `{}`, ""); code != http.StatusNoContent {
+		t.Fatalf("request without a number: status = %d", code)
+	}
+	// The IP limit only applies to its method, and three POSTs used it up
+	if code := request(http.MethodGet, "/verify", "", ""); code != http.StatusNoContent {
+		t.Fatalf("GET: status = %d", code)
+	}
+	if code := request(http.MethodPost, "/verify", `{"phone_number":"+15550002"}`, ""); code != http.StatusTooManyRequests {
+		t.Fatalf("fourth POST from an IP: status = %d, want 429", code)
+	}
+
+	// User limits apply by prefix to each authenticated user
+	for _, user := range []string{"alice", "bob"} {
+		if code := request(http.MethodGet, "/users/1", "", user); code != http.StatusNoContent {
+			t.Fatalf("first request of %s: status = %d", user, code)
+		}
+	}
+	if code := request(http.MethodGet, "/users/2", "", "alice"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request of alice: status = %d, want 429", code)
+	}
+}
+
+func TestConfiguredAPIKeyRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{RateLimits: config.RateLimitsConfig{Policies: []config.RateLimitPolicyConfig{
+		{Name: "users-api-key", Route: "/users/*", Key: "api-key", Count: 1, Time: 1},
+	}}}
+	m := middleware.NewRateLimitMiddleware(service.NewEventService(repository.NewInMemoryEventRepository()), cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	limiters := map[string]ratelimit.Limiter{ratelimit.AlgorithmFixedWindow: ratelimit.NewMemoryFixedWindowLimiter()}
+
+	// Keys are authenticated as the API key middleware does, accepting the keys of two services,
+	// with service a's key sent in two spellings
+	keyIDs := map[string]string{"otp_service-a": "a", "otp_service-a ": "a", "otp_service-b": "b"}
+	authenticate := func(c *gin.Context) {
+		rawKey := c.GetHeader(middleware.APIKeyHeader)
+		if rawKey == "" {
+			c.Set("user_id", "alice")
+			return
+		}
+		id, ok := keyIDs[rawKey]
+		if !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("api_key_id", id)
+	}
+
+	router := gin.New()
+	router.Use(m.ConfiguredRateLimit(limiters))
+	users := router.Group("/users")
+	users.Use(authenticate, m.ConfiguredUserRateLimit(limiters))
+	users.GET("/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	request := func(apiKey string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		if apiKey != "" {
+			r.Header.Set(middleware.APIKeyHeader, apiKey)
+		}
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := request("otp_service-a"); code != http.StatusNoContent {
+		t.Fatalf("first request of service a: status = %d", code)
+	}
+	if code := request("otp_service-a"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request of service a: status = %d, want 429", code)
+	}
+	// The key authenticated is counted, not the header sent
+	if code := request("otp_service-a "); code != http.StatusTooManyRequests {
+		t.Fatalf("request of service a with its key respelled: status = %d, want 429", code)
+	}
+	// Each key is counted apart
+	if code := request("otp_service-b"); code != http.StatusNoContent {
+		t.Fatalf("first request of service b: status = %d", code)
+	}
+	// Made-up keys are rejected rather than counted in a new count each
+	for i := 0; i < 3; i++ {
+		if code := request(fmt.Sprintf("otp_made-up-%d", i)); code != http.StatusUnauthorized {
+			t.Fatalf("request with a made-up key: status = %d, want 401", code)
+		}
+	}
+	// Users aren't counted by limits per API key
+	for i := 0; i < 2; i++ {
+		if code := request(""); code != http.StatusNoContent {
+			t.Fatalf("request %d of a user: status = %d", i+1, code)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/middleware"
+)
+
+func TestWithRequestIDField(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"error":"Invalid request"}`, `{"request_id":"req-1","error":"Invalid request"}`},
+		{`{"error":"Too many requests","retry_after":60}`, `{"request_id":"req-1","error":"Too many requests","retry_after":60}`},
+		{`{}`, `{"request_id":"req-1"}`},
+		{`{"error":"x","request_id":"other"}`, `{"error":"x","request_id":"other"}`},
+		{`["error"]`, `["error"]`},
+		{`not json`, `not json`},
+		{`{"error":`, `{"error":`},
+	}
+	for _, tt := range tests {
+		if got := string(middleware.WithRequestIDField([]byte(tt.body), "req-1")); got != tt.want {
+			t.Errorf("WithRequestIDField(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestWithErrorCodeField(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"error":"Invalid request"}`, `{"code":"INVALID_REQUEST","error":"Invalid request"}`},
+		{`{"error":"Invalid or expired OTP","code":"OTP_INVALID"}`, `{"error":"Invalid or expired OTP","code":"OTP_INVALID"}`},
+		{`["error"]`, `["error"]`},
+	}
+	for _, tt := range tests {
+		if got := string(middleware.WithErrorCodeField([]byte(tt.body), "INVALID_REQUEST")); got != tt.want {
+			t.Errorf("WithErrorCodeField(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
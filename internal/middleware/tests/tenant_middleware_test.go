@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lilokie/otp-auth/internal/middleware"
+	"github.com/lilokie/otp-auth/internal/tenant"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, err := middleware.NewTenantMiddleware([]string{"10.0.0.0/8"}, "X-Tenant")
+	if err != nil {
+		t.Fatalf("NewTenantMiddleware: %v", err)
+	}
+	router := gin.New()
+	router.Use(m.Tenant())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, tenant.FromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tenant     string
+		want       string
+	}{
+		{"trusted proxy", "10.0.0.5:1234", "shop", "shop"},
+		{"lower cased", "10.0.0.5:1234", "Shop-EU", "shop-eu"},
+		{"untrusted client", "198.51.100.9:1234", "shop", ""},
+		{"invalid characters", "10.0.0.5:1234", "shop/eu", ""},
+		{"too long", "10.0.0.5:1234", strings.Repeat("a", 65), ""},
+		{"no header", "10.0.0.5:1234", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tenant != "" {
+				req.Header.Set("X-Tenant", tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("tenant = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
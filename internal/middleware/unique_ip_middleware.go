@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// IPRecorder records which client IPs request which endpoints
+type IPRecorder interface {
+	// RecordIP notes that ip requested endpoint
+	RecordIP(endpoint, ip string)
+}
+
+// UniqueIPMiddleware is a middleware counting the distinct client IPs per endpoint
+type UniqueIPMiddleware struct {
+	recorder IPRecorder
+}
+
+// NewUniqueIPMiddleware creates a new unique IP middleware
+func NewUniqueIPMiddleware(recorder IPRecorder) *UniqueIPMiddleware {
+	return &UniqueIPMiddleware{recorder: recorder}
+}
+
+// TrackUniqueIPs records the client IP of every request to a known route, including requests
+// rejected later on, so distributed abuse campaigns show up as spikes in distinct IPs
+func (m *UniqueIPMiddleware) TrackUniqueIPs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Unknown paths are skipped to keep the number of counted endpoints bounded
+		if route := c.FullPath(); route != "" {
+			m.recorder.RecordIP(c.Request.Method+" "+route, c.ClientIP())
+		}
+		c.Next()
+	}
+}
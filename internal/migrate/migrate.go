@@ -0,0 +1,135 @@
+// Package migrate applies the SQL migrations of the migrations directory to Postgres.
+//
+// Migrations are in the sql-migrate format: the statements following a "-- +migrate Up"
+// line are applied, up to a "-- +migrate Down" line if any. Applied migrations are
+// recorded in sql-migrate's gorp_migrations table, so either tool can be used on a database.
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Table records the applied migrations by ID
+const Table = "gorp_migrations"
+
+// lockID is the key of the advisory lock held while applying a migration, so instances
+// migrating at the same time apply each migration once
+const lockID = 7318420195
+
+// Migration is a SQL migration, identified by its file name
+type Migration struct {
+	ID string
+	Up string
+}
+
+// Load reads the migrations in dir, ordered by file name
+func Load(dir string) ([]Migration, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing migrations: %w", err)
+	}
+	sort.Strings(paths)
+
+	migrations := make([]Migration, 0, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration: %w", err)
+		}
+		migration, err := Parse(filepath.Base(path), string(content))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration)
+	}
+	return migrations, nil
+}
+
+// Parse parses the content of the migration file named id
+func Parse(id, content string) (Migration, error) {
+	var up strings.Builder
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if directive, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +migrate "); ok {
+			fields := strings.Fields(directive)
+			if len(fields) > 0 && (fields[0] == "Up" || fields[0] == "Down") {
+				section = fields[0]
+			}
+			continue
+		}
+		if section == "Up" {
+			up.WriteString(line)
+			up.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Migration{}, fmt.Errorf("error reading migration %s: %w", id, err)
+	}
+	if strings.TrimSpace(up.String()) == "" {
+		return Migration{}, fmt.Errorf("migration %s has no Up statements", id)
+	}
+	return Migration{ID: id, Up: up.String()}, nil
+}
+
+// Up applies the migrations not applied yet, in order, each in its own transaction.
+// It returns the IDs of the migrations it applied.
+func Up(ctx context.Context, db *sqlx.DB, migrations []Migration) ([]string, error) {
+	createTable := `CREATE TABLE IF NOT EXISTS ` + Table + ` (id TEXT NOT NULL PRIMARY KEY, applied_at TIMESTAMP WITH TIME ZONE)`
+	if _, err := db.ExecContext(ctx, createTable); err != nil {
+		return nil, fmt.Errorf("error creating migrations table: %w", err)
+	}
+
+	var applied []string
+	for _, migration := range migrations {
+		ok, err := apply(ctx, db, migration)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, migration.ID)
+		}
+	}
+	return applied, nil
+}
+
+// apply applies a migration unless it was applied already, reporting whether it applied it
+func apply(ctx context.Context, db *sqlx.DB, migration Migration) (bool, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return false, fmt.Errorf("error locking migrations: %w", err)
+	}
+	var count int
+	if err := tx.GetContext(ctx, &count, `SELECT COUNT(*) FROM `+Table+` WHERE id = $1`, migration.ID); err != nil {
+		return false, fmt.Errorf("error checking migration %s: %w", migration.ID, err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+		return false, fmt.Errorf("error applying migration %s: %w", migration.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+Table+` (id, applied_at) VALUES ($1, $2)`, migration.ID, time.Now()); err != nil {
+		return false, fmt.Errorf("error recording migration %s: %w", migration.ID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing migration %s: %w", migration.ID, err)
+	}
+	return true, nil
+}
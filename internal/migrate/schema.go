@@ -0,0 +1,251 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Schema is the tables, with their columns, and the indexes of a database
+type Schema struct {
+	Tables  map[string]map[string]bool // table -> columns
+	Indexes map[string]bool
+}
+
+// Statements the expected schema is derived from. Statements are matched with their whitespace
+// collapsed to single spaces and in lower case.
+var (
+	createTablePattern = regexp.MustCompile(`^create table (?:if not exists )?([a-z_][a-z0-9_]*) \((.*)\)$`)
+	alterTablePattern  = regexp.MustCompile(`^alter table (?:if exists )?(?:only )?([a-z_][a-z0-9_]*) (.*)$`)
+	addColumnPattern   = regexp.MustCompile(`^add (?:column )?(?:if not exists )?([a-z_][a-z0-9_]*)`)
+	dropColumnPattern  = regexp.MustCompile(`^drop (?:column )?(?:if exists )?([a-z_][a-z0-9_]*)`)
+	createIndexPattern = regexp.MustCompile(`^create (?:unique )?index (?:concurrently )?(?:if not exists )?([a-z_][a-z0-9_]*) on `)
+	dropTablePattern   = regexp.MustCompile(`^drop table (?:if exists )?([a-z_][a-z0-9_]*)`)
+	dropIndexPattern   = regexp.MustCompile(`^drop index (?:concurrently )?(?:if exists )?([a-z_][a-z0-9_]*)`)
+)
+
+// tableConstraints are the first words of CREATE TABLE entries that aren't columns
+var tableConstraints = map[string]bool{
+	"constraint": true, "primary": true, "unique": true, "check": true, "foreign": true, "exclude": true, "like": true,
+}
+
+// ExpectedSchema returns the schema the migrations create when applied in order. It follows
+// CREATE TABLE, ALTER TABLE ADD and DROP COLUMN, CREATE INDEX and DROP TABLE and INDEX
+// statements; other statements, such as data changes, don't change the schema.
+func ExpectedSchema(migrations []Migration) Schema {
+	schema := Schema{Tables: map[string]map[string]bool{}, Indexes: map[string]bool{}}
+	for _, migration := range migrations {
+		for _, statement := range strings.Split(withoutComments(migration.Up), ";") {
+			schema.apply(strings.ToLower(strings.Join(strings.Fields(statement), " ")))
+		}
+	}
+	return schema
+}
+
+// withoutComments returns sql without its -- comments
+func withoutComments(sql string) string {
+	lines := strings.Split(sql, "\n")
+	for i, line := range lines {
+		if comment := strings.Index(line, "--"); comment >= 0 {
+			lines[i] = line[:comment]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// apply applies a normalized statement to the schema
+func (s Schema) apply(statement string) {
+	if m := createTablePattern.FindStringSubmatch(statement); m != nil {
+		columns := s.Tables[m[1]]
+		if columns == nil {
+			columns = map[string]bool{}
+			s.Tables[m[1]] = columns
+		}
+		for _, entry := range splitTopLevel(m[2]) {
+			name, _, _ := strings.Cut(strings.TrimSpace(entry), " ")
+			if name != "" && !tableConstraints[name] {
+				columns[strings.Trim(name, `"`)] = true
+			}
+		}
+		return
+	}
+	if m := alterTablePattern.FindStringSubmatch(statement); m != nil {
+		columns := s.Tables[m[1]]
+		if columns == nil {
+			return
+		}
+		for _, action := range splitTopLevel(m[2]) {
+			action = strings.TrimSpace(action)
+			if strings.HasPrefix(action, "add constraint") || strings.HasPrefix(action, "drop constraint") {
+				continue
+			}
+			if c := addColumnPattern.FindStringSubmatch(action); c != nil {
+				columns[c[1]] = true
+			} else if c := dropColumnPattern.FindStringSubmatch(action); c != nil {
+				delete(columns, c[1])
+			}
+		}
+		return
+	}
+	if m := createIndexPattern.FindStringSubmatch(statement); m != nil {
+		s.Indexes[m[1]] = true
+	} else if m := dropTablePattern.FindStringSubmatch(statement); m != nil {
+		delete(s.Tables, m[1])
+	} else if m := dropIndexPattern.FindStringSubmatch(statement); m != nil {
+		delete(s.Indexes, m[1])
+	}
+}
+
+// splitTopLevel splits s at the commas outside parentheses
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, ch := range s {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Inspect returns the schema of the database's current schema, usually public
+func Inspect(ctx context.Context, db *sqlx.DB) (Schema, error) {
+	var columns []struct {
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+	}
+	query := `SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = current_schema()`
+	if err := db.SelectContext(ctx, &columns, query); err != nil {
+		return Schema{}, fmt.Errorf("error reading columns: %w", err)
+	}
+	var indexes []string
+	query = `SELECT indexname FROM pg_indexes WHERE schemaname = current_schema()`
+	if err := db.SelectContext(ctx, &indexes, query); err != nil {
+		return Schema{}, fmt.Errorf("error reading indexes: %w", err)
+	}
+
+	schema := Schema{Tables: map[string]map[string]bool{}, Indexes: map[string]bool{}}
+	for _, column := range columns {
+		if schema.Tables[column.Table] == nil {
+			schema.Tables[column.Table] = map[string]bool{}
+		}
+		schema.Tables[column.Table][column.Column] = true
+	}
+	for _, index := range indexes {
+		schema.Indexes[index] = true
+	}
+	return schema, nil
+}
+
+// Drift is how a database differs from the migrations. Tables, columns and indexes the
+// migrations don't know of are not drift, as newer versions may have added them.
+type Drift struct {
+	PendingMigrations []string // migrations not recorded as applied
+	UnknownMigrations []string // applied migrations missing from the migrations, e.g. of a newer version
+	MissingTables     []string
+	MissingColumns    []string // as table.column
+	MissingIndexes    []string
+}
+
+// Missing reports whether the database lacks any part of the expected schema or migrations.
+// Unknown migrations alone don't count, as older versions run against migrated databases
+// during rolling deployments.
+func (d *Drift) Missing() bool {
+	return len(d.PendingMigrations) > 0 || len(d.MissingTables) > 0 || len(d.MissingColumns) > 0 || len(d.MissingIndexes) > 0
+}
+
+// String lists the differences, e.g. "missing columns: users.avatar_url, users.email"
+func (d *Drift) String() string {
+	var parts []string
+	for _, part := range []struct {
+		label string
+		items []string
+	}{
+		{"pending migrations", d.PendingMigrations},
+		{"missing tables", d.MissingTables},
+		{"missing columns", d.MissingColumns},
+		{"missing indexes", d.MissingIndexes},
+		{"unknown migrations", d.UnknownMigrations},
+	} {
+		if len(part.items) > 0 {
+			parts = append(parts, part.label+": "+strings.Join(part.items, ", "))
+		}
+	}
+	if len(parts) == 0 {
+		return "no drift"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Compare returns how the actual schema differs from the expected one
+func Compare(expected, actual Schema) *Drift {
+	drift := &Drift{}
+	for table, columns := range expected.Tables {
+		actualColumns, ok := actual.Tables[table]
+		if !ok {
+			drift.MissingTables = append(drift.MissingTables, table)
+			continue
+		}
+		for column := range columns {
+			if !actualColumns[column] {
+				drift.MissingColumns = append(drift.MissingColumns, table+"."+column)
+			}
+		}
+	}
+	for index := range expected.Indexes {
+		if !actual.Indexes[index] {
+			drift.MissingIndexes = append(drift.MissingIndexes, index)
+		}
+	}
+	sort.Strings(drift.MissingTables)
+	sort.Strings(drift.MissingColumns)
+	sort.Strings(drift.MissingIndexes)
+	return drift
+}
+
+// Check compares the database with the migrations. Applied migrations are compared only if
+// the database records them, as databases may have been set up by running the files directly.
+func Check(ctx context.Context, db *sqlx.DB, migrations []Migration) (*Drift, error) {
+	actual, err := Inspect(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	drift := Compare(ExpectedSchema(migrations), actual)
+	if _, ok := actual.Tables[Table]; !ok {
+		return drift, nil
+	}
+
+	var applied []string
+	if err := db.SelectContext(ctx, &applied, `SELECT id FROM `+Table+` ORDER BY id`); err != nil {
+		return nil, fmt.Errorf("error reading applied migrations: %w", err)
+	}
+	known := make(map[string]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.ID] = true
+	}
+	recorded := make(map[string]bool, len(applied))
+	for _, id := range applied {
+		recorded[id] = true
+		if !known[id] {
+			drift.UnknownMigrations = append(drift.UnknownMigrations, id)
+		}
+	}
+	for _, migration := range migrations {
+		if !recorded[migration.ID] {
+			drift.PendingMigrations = append(drift.PendingMigrations, migration.ID)
+		}
+	}
+	return drift, nil
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/migrate"
+)
+
+func TestParseKeepsUpSection(t *testing.T) {
+	content := `-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE IF NOT EXISTS things (id INT);
+
+-- +migrate Down
+DROP TABLE things;
+`
+	migration, err := migrate.Parse("001_things.sql", content)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if migration.ID != "001_things.sql" {
+		t.Fatalf("expected ID 001_things.sql, got %q", migration.ID)
+	}
+	if !strings.Contains(migration.Up, "CREATE TABLE") || strings.Contains(migration.Up, "DROP TABLE") {
+		t.Fatalf("expected only the Up statements, got %q", migration.Up)
+	}
+}
+
+func TestParseRequiresUpSection(t *testing.T) {
+	for _, content := range []string{"CREATE TABLE things (id INT);\n", "-- +migrate Down\nDROP TABLE things;\n"} {
+		if _, err := migrate.Parse("001_things.sql", content); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
+
+func TestLoadOrdersByFileName(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"002_b.sql", "001_a.sql", "README.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("-- +migrate Up\nSELECT 1;\n"), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	migrations, err := migrate.Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].ID != "001_a.sql" || migrations[1].ID != "002_b.sql" {
+		t.Fatalf("expected 001_a.sql and 002_b.sql, got %+v", migrations)
+	}
+}
+
+func TestLoadRepositoryMigrations(t *testing.T) {
+	migrations, err := migrate.Load(filepath.Join("..", "..", "..", "migrations"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected the repository's migrations")
+	}
+}
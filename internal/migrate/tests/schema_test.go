@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/migrate"
+)
+
+func TestExpectedSchemaFollowsMigrations(t *testing.T) {
+	var migrations []migrate.Migration
+	for i, content := range []string{
+		`-- +migrate Up
+-- Things
+CREATE TABLE IF NOT EXISTS things (
+    id UUID PRIMARY KEY,
+    name VARCHAR(20) NOT NULL, -- display name
+    price NUMERIC(10, 2),
+    CONSTRAINT things_name_unique UNIQUE (name)
+);
+CREATE INDEX IF NOT EXISTS idx_things_name ON things(name);
+`,
+		`-- +migrate Up
+ALTER TABLE things ADD COLUMN IF NOT EXISTS owner_id UUID, DROP COLUMN price;
+CREATE TABLE old_things (id INT);
+DROP TABLE old_things;
+`,
+	} {
+		migration, err := migrate.Parse(fmt.Sprintf("%03d_things.sql", i+1), content)
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		migrations = append(migrations, migration)
+	}
+
+	schema := migrate.ExpectedSchema(migrations)
+	columns := schema.Tables["things"]
+	for _, column := range []string{"id", "name", "owner_id"} {
+		if !columns[column] {
+			t.Errorf("expected column things.%s, got %v", column, columns)
+		}
+	}
+	if columns["price"] || columns["constraint"] {
+		t.Errorf("expected no price or constraint columns, got %v", columns)
+	}
+	if _, ok := schema.Tables["old_things"]; ok {
+		t.Error("expected dropped table old_things to be gone")
+	}
+	if !schema.Indexes["idx_things_name"] {
+		t.Errorf("expected index idx_things_name, got %v", schema.Indexes)
+	}
+}
+
+func TestExpectedSchemaOfRepositoryMigrations(t *testing.T) {
+	migrations, err := migrate.Load("../../../migrations")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	schema := migrate.ExpectedSchema(migrations)
+	for _, column := range []string{"id", "phone_number", "role", "created_at"} {
+		if !schema.Tables["users"][column] {
+			t.Errorf("expected column users.%s, got %v", column, schema.Tables["users"])
+		}
+	}
+	if !schema.Indexes["idx_users_created_id"] {
+		t.Errorf("expected index idx_users_created_id, got %v", schema.Indexes)
+	}
+}
+
+func TestCompareReportsMissingParts(t *testing.T) {
+	expected := migrate.Schema{
+		Tables: map[string]map[string]bool{
+			"users":  {"id": true, "email": true, "avatar_url": true},
+			"events": {"id": true},
+		},
+		Indexes: map[string]bool{"idx_users_email": true},
+	}
+	actual := migrate.Schema{
+		Tables: map[string]map[string]bool{
+			"users": {"id": true, "nickname": true},
+			"other": {"id": true},
+		},
+		Indexes: map[string]bool{"users_pkey": true},
+	}
+
+	drift := migrate.Compare(expected, actual)
+	if !drift.Missing() {
+		t.Fatal("expected drift")
+	}
+	want := "missing tables: events; missing columns: users.avatar_url, users.email; missing indexes: idx_users_email"
+	if got := drift.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if drift := migrate.Compare(expected, expected); drift.Missing() || drift.String() != "no drift" {
+		t.Fatalf("expected no drift, got %s", drift)
+	}
+}
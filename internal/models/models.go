@@ -1,61 +1,344 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// User roles
+const (
+	RoleUser     = "user"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Permissions for admin endpoints
+const (
+	PermissionUserRestore    = "user.restore"
+	PermissionRateLimitFlush = "ratelimit.flush"
+	PermissionOTPResend      = "otp.resend"
+	PermissionOTPExpire      = "otp.expire"
+	PermissionProviderToggle = "provider.toggle"
+	PermissionUserMigrate    = "user.migrate"
+	PermissionUserImport     = "user.import"
+	PermissionUserStats      = "user.stats"
+	PermissionTrafficStats   = "traffic.stats"
+	PermissionAbuseReview    = "abuse.review"
+	PermissionSuppression    = "suppression.manage"
+	PermissionPhoneList      = "phone_list.manage"
+	PermissionUserTimeline   = "user.timeline"
+	PermissionMaintenance    = "maintenance.manage"
+	PermissionUserExport     = "user.export"
+	PermissionSessionRevoke  = "session.revoke"
+	PermissionUserMetadata   = "user.metadata"
+	PermissionAPIKey         = "api_key.manage"
+)
+
+// Sources a user's phone number was verified by
+const (
+	VerifiedSourceOTP             = "otp"
+	VerifiedSourceCarrier         = "carrier"
+	VerifiedSourceLegacyMigration = "legacy_migration"
+)
+
 // User represents a user in the system
 type User struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	PhoneNumber string    `json:"phone_number" db:"phone_number"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID               uuid.UUID    `json:"id" db:"id"`
+	PhoneNumber      string       `json:"phone_number" db:"phone_number"`
+	Role             string       `json:"role" db:"role"`
+	PhoneVerified    bool         `json:"phone_verified" db:"phone_verified"`
+	VerifiedSource   *string      `json:"verified_source,omitempty" db:"verified_source"`
+	AnalyticsConsent bool         `json:"analytics_consent" db:"analytics_consent"` // events about users without consent are anonymized or dropped for analytics endpoints
+	FirstName        string       `json:"first_name,omitempty" db:"first_name"`
+	LastName         string       `json:"last_name,omitempty" db:"last_name"`
+	Email            string       `json:"email,omitempty" db:"email"` // as given by the user, not verified
+	AvatarURL        string       `json:"avatar_url,omitempty" db:"avatar_url"`
+	Metadata         UserMetadata `json:"metadata,omitempty" db:"metadata"` // set by admins, not by the user
+	CreatedAt        time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at" db:"updated_at"`
+	DeletedAt        *time.Time   `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// UserMetadata is the attributes admins set on a user, stored as a JSON object of strings
+type UserMetadata map[string]string
+
+// Value encodes the metadata as a JSON object, empty for nil metadata
+func (m UserMetadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan decodes metadata stored as a JSON object
+func (m *UserMetadata) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into user metadata", src)
+	}
+	*m = nil
+	return json.Unmarshal(data, m)
+}
+
+// AuditLog represents an entry in the audit trail
+type AuditLog struct {
+	ID         uuid.UUID       `json:"id" db:"id"`
+	ActorID    *uuid.UUID      `json:"actor_id,omitempty" db:"actor_id"`
+	ActorType  string          `json:"actor_type" db:"actor_type"` // user, or api_key when ActorID is an API key's
+	Action     string          `json:"action" db:"action"`
+	TargetType string          `json:"target_type" db:"target_type"`
+	TargetID   string          `json:"target_id" db:"target_id"`
+	IPAddress  string          `json:"ip_address" db:"ip_address"`
+	UserAgent  string          `json:"user_agent" db:"user_agent"`
+	Metadata   json.RawMessage `json:"metadata" db:"metadata" swaggertype:"object"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// Domain event types
+const (
+	EventUserCreated            = "user.created"
+	EventUserUpdated            = "user.updated"
+	EventUserPhoneVerified      = "user.phone_verified"
+	EventUserRoleChanged        = "user.role_changed"
+	EventUserConsentChanged     = "user.consent_changed"
+	EventUserProfileUpdated     = "user.profile_updated"
+	EventUserMetadataUpdated    = "user.metadata_updated"
+	EventUserDeleted            = "user.deleted"
+	EventUserRestored           = "user.restored"
+	EventUserPurged             = "user.purged"
+	EventOTPRequested           = "otp.requested"
+	EventOTPResent              = "otp.resent"
+	EventOTPVerified            = "otp.verified"
+	EventOTPVerificationFailed  = "otp.verification_failed"
+	EventOTPLockedOut           = "otp.locked_out"
+	EventBackupCodesGenerated   = "backup_codes.generated"
+	EventTokenExchanged         = "token.exchanged"
+	EventAbuseReported          = "abuse.reported"
+	EventPhoneSuppressed        = "phone.suppressed"
+	EventPhoneUnsuppressed      = "phone.unsuppressed"
+	EventDeviceTrusted          = "device.trusted"
+	EventDeviceRevoked          = "device.revoked"
+	EventSessionsRevoked        = "sessions.revoked"
+	EventSessionCountryConflict = "session.country_conflict"
+	EventRateLimitWarning       = "ratelimit.warning"
+)
+
+// Domain event aggregate types
+const (
+	AggregateUser  = "user"
+	AggregatePhone = "phone"
+	AggregateIP    = "ip"
+)
+
+// DomainEvent is an entry in the append-only domain event log.
+// Sequence is assigned when the event is stored and orders replays.
+type DomainEvent struct {
+	Sequence      int64           `json:"sequence" db:"sequence"`
+	ID            uuid.UUID       `json:"id" db:"id"`
+	Type          string          `json:"type" db:"type"`
+	AggregateType string          `json:"aggregate_type" db:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id" db:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload" db:"payload" swaggertype:"object"`
+	OccurredAt    time.Time       `json:"occurred_at" db:"occurred_at"`
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed" // given up after the last attempt
+)
+
+// WebhookEvent is the JSON body delivered to webhook endpoints for a domain event
+type WebhookEvent struct {
+	ID            uuid.UUID       `json:"id"`
+	Type          string          `json:"type"`
+	Sequence      int64           `json:"sequence"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// WebhookDelivery is a domain event queued for delivery to a webhook endpoint
+type WebhookDelivery struct {
+	ID            uuid.UUID       `json:"id" db:"id"`
+	Endpoint      string          `json:"endpoint" db:"endpoint"`
+	EventID       uuid.UUID       `json:"event_id" db:"event_id"`
+	EventType     string          `json:"event_type" db:"event_type"`
+	Body          json.RawMessage `json:"body" db:"body"`
+	Status        string          `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     *string         `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
 }
 
-// OTP represents a one-time password
-type OTP struct {
+// Kinds of actors recorded in the audit trail
+const (
+	AuditActorUser   = "user"
+	AuditActorAPIKey = "api_key"
+)
+
+// AuditActor identifies who performed an audited action
+type AuditActor struct {
+	ID        uuid.UUID
+	Type      string // AuditActorUser if empty
+	IPAddress string
+	UserAgent string
+}
+
+// OTPChallenge is a pending OTP, bound to the phone number and client it was requested for
+type OTPChallenge struct {
+	ID          string    `json:"id"`
 	PhoneNumber string    `json:"phone_number"`
 	Code        string    `json:"code"`
-	ExpiresAt   time.Time `json:"expires_at"`
+	Channel     string    `json:"channel,omitempty"` // sms, email or flash_call, what the challenge was issued over; empty for sms before channels
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	ExpiresAt   time.Time `json:"expires_at"` // zero for challenges stored before it was recorded
+
+	// SendDelay is the estimated delay before an OTP queued while sending SMS was saturated is
+	// sent. It is only set on the challenge returned by the request and never stored.
+	SendDelay time.Duration `json:"-"`
 }
 
+// Channels OTPs are sent over
+const (
+	ChannelSMS       = "sms"
+	ChannelEmail     = "email"
+	ChannelFlashCall = "flash_call" // a missed call from a number ending in the OTP
+)
+
 // RequestOTPRequest is the request to get an OTP
 type RequestOTPRequest struct {
-	PhoneNumber string `json:"phone_number" binding:"required"`
+	PhoneNumber  string `json:"phone_number" binding:"required,iranianMobile"`
+	Channel      string `json:"channel" binding:"omitempty,oneof=sms email flash_call"` // sms (default), email, sent to the address on the user's profile, or flash_call
+	DeviceToken  string `json:"device_token"`                                           // a trusted device's token, signing in without an OTP if valid
+	Silent       bool   `json:"silent"`                                                 // sign in without an OTP if the carrier verifies the phone number
+	CarrierToken string `json:"carrier_token"`                                          // issued to the device by the carrier's number verification flow, for silent sign-in
+	CaptchaToken string `json:"captcha_token"`                                          // a solved CAPTCHA, required once an IP made too many requests
 }
 
 // RequestOTPResponse is the response to an OTP request
 type RequestOTPResponse struct {
-	Message string `json:"message"` // OTP is now only printed to console logs
+	Message      string     `json:"message"` // OTP is now only printed to console logs
+	ChallengeID  string     `json:"challenge_id,omitempty"`
+	OTPExpiresAt *time.Time `json:"otp_expires_at,omitempty"` // when the challenge expires, to be compared with server_time
+	ServerTime   time.Time  `json:"server_time"`              // lets clients with skewed clocks count down to otp_expires_at
+	Token        string     `json:"token,omitempty"`          // set instead of the challenge ID when a trusted device signed in
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	User         *User      `json:"user,omitempty"`
+
+	EstimatedDelay int `json:"estimated_delay,omitempty"` // in seconds, until an OTP queued while sending SMS is saturated is sent
 }
 
-// VerifyOTPRequest is the request to verify an OTP
+// ResendOTPRequest is the request to resend the OTP of a challenge
+type ResendOTPRequest struct {
+	ChallengeID string `json:"challenge_id" binding:"required"`
+}
+
+// VerifyOTPRequest is the request to verify the OTP of a challenge.
+// A backup code can be given instead of the OTP when the user cannot receive SMS.
 type VerifyOTPRequest struct {
-	PhoneNumber string `json:"phone_number" binding:"required"`
-	OTP         string `json:"otp" binding:"required,len=6,numeric"`
+	ChallengeID string `json:"challenge_id" binding:"required"`
+	OTP         string `json:"otp" binding:"required_without=BackupCode,omitempty,otpcode"`
+	BackupCode  string `json:"backup_code" binding:"required_without=OTP"`
+	TrustDevice bool   `json:"trust_device"` // issue a device token to skip the OTP on this device next time
+	DeviceName  string `json:"device_name" binding:"max=100"`
 }
 
 // VerifyOTPResponse is the response to an OTP verification
 type VerifyOTPResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"` // shown only once, exchanged for new tokens at /auth/refresh
+	User         User   `json:"user"`
+	DeviceToken  string `json:"device_token,omitempty"` // shown only once, present if trust_device was requested
+}
+
+// RefreshTokenRequest is the request to refresh the tokens of a session
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshTokenResponse carries a session's new access token and the refresh token replacing the one used
+type RefreshTokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// BackupCodesResponse is the response containing a newly generated set of backup codes
+type BackupCodesResponse struct {
+	Codes []string `json:"codes"` // shown only once, earlier codes are no longer valid
 }
 
 // UserResponse is the response containing user information
 type UserResponse struct {
-	ID          uuid.UUID `json:"id"`
-	PhoneNumber string    `json:"phone_number"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID               uuid.UUID         `json:"id"`
+	PhoneNumber      string            `json:"phone_number"`
+	PhoneVerified    bool              `json:"phone_verified"`
+	VerifiedSource   *string           `json:"verified_source,omitempty"`
+	AnalyticsConsent bool              `json:"analytics_consent"`
+	FirstName        string            `json:"first_name,omitempty"`
+	LastName         string            `json:"last_name,omitempty"`
+	Email            string            `json:"email,omitempty"`
+	AvatarURL        string            `json:"avatar_url,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
 }
 
 // UsersListResponse is the response for listing users
 type UsersListResponse struct {
 	Users      []UserResponse `json:"users"`
-	TotalCount int64          `json:"total_count"`
-	Page       int            `json:"page"`
-	PageSize   int            `json:"page_size"`
+	TotalCount *int64         `json:"total_count,omitempty"` // not counted with keyset pagination
+	Page       int            `json:"page,omitempty"`
+	PageSize   int            `json:"page_size,omitempty"`
+	NextCursor string         `json:"next_cursor,omitempty"` // with keyset pagination, lists the next page; empty on the last page
+	Limit      int            `json:"limit,omitempty"`
+
+	// Without exact counts, HasMore tells whether pages follow, and TotalCount is the estimate
+	// with include_total=estimate
+	HasMore        *bool `json:"has_more,omitempty"`
+	TotalEstimated bool  `json:"total_estimated,omitempty"`
+}
+
+// Formats users are exported in
+const (
+	UserExportFormatCSV   = "csv"
+	UserExportFormatJSONL = "jsonl" // a JSON object per line
+)
+
+// ExportedUser is a user as exported for admins, a CSV row or JSONL line
+type ExportedUser struct {
+	ID               uuid.UUID         `json:"id"`
+	PhoneNumber      string            `json:"phone_number"`
+	Role             string            `json:"role"`
+	PhoneVerified    bool              `json:"phone_verified"`
+	VerifiedSource   string            `json:"verified_source"`
+	AnalyticsConsent bool              `json:"analytics_consent"`
+	FirstName        string            `json:"first_name"`
+	LastName         string            `json:"last_name"`
+	Email            string            `json:"email"`
+	AvatarURL        string            `json:"avatar_url"`
+	Metadata         map[string]string `json:"metadata"`
+	CreatedAt        time.Time         `json:"created_at"`
 }
 
 // PaginationParams defines pagination parameters for listing users
@@ -63,15 +346,825 @@ type PaginationParams struct {
 	Page     int    `form:"page" json:"page"`
 	PageSize int    `form:"page_size" json:"page_size"`
 	Search   string `form:"search" json:"search"`
+
+	// Cursor and Limit page through users by keyset instead, which stays fast deep into large
+	// tables; other lists ignore them
+	Cursor string `form:"cursor" json:"cursor,omitempty"` // next_cursor of the previous page, empty for the first
+	Limit  int    `form:"limit" json:"limit,omitempty"`
+
+	// SortBy, Order and the creation time range apply to users; other lists ignore them
+	SortBy        string     `form:"sort_by" json:"sort_by,omitempty"`               // UserSortCreatedAt or UserSortPhoneNumber, by creation time if empty
+	Order         string     `form:"order" json:"order,omitempty"`                   // SortAsc or SortDesc, descending if empty
+	CreatedAfter  *time.Time `form:"created_after" json:"created_after,omitempty"`   // inclusive
+	CreatedBefore *time.Time `form:"created_before" json:"created_before,omitempty"` // exclusive
+
+	// IncludeTotal is how users are counted: IncludeTotalTrue, exactly, if empty, IncludeTotalFalse
+	// or IncludeTotalEstimate; other lists ignore it
+	IncludeTotal string `form:"include_total" json:"include_total,omitempty"`
+
+	// Metadata only matches users with each of its keys set to its value, as given by
+	// metadata[key]=value query parameters; other lists ignore it
+	Metadata map[string]string `form:"-" json:"metadata,omitempty"`
+}
+
+// Keyset reports whether keyset pagination was asked for rather than pages
+func (p PaginationParams) Keyset() bool {
+	return p.Cursor != "" || p.Limit > 0
+}
+
+// Ascending reports whether ascending order was asked for
+func (p PaginationParams) Ascending() bool {
+	return p.Order == SortAsc
+}
+
+// Counted reports whether users are to be counted exactly
+func (p PaginationParams) Counted() bool {
+	return p.IncludeTotal == "" || p.IncludeTotal == IncludeTotalTrue
+}
+
+// How users are counted when listing them by page
+const (
+	IncludeTotalTrue     = "true"
+	IncludeTotalFalse    = "false"
+	IncludeTotalEstimate = "estimate" // from the table statistics, without scanning the table
+)
+
+// User sort fields
+const (
+	UserSortCreatedAt   = "created_at"
+	UserSortPhoneNumber = "phone_number"
+)
+
+// Sort orders
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// Problem is an error response in the RFC 7807 problem details format, served as
+// application/problem+json. With service.http.legacyErrors set, errors are instead
+// {"error": <detail>, "code": <error_code>} objects with the same extension members.
+type Problem struct {
+	Type      string `json:"type"`  // URI of the error code's entry in GET /v1/meta/errors
+	Title     string `json:"title"` // summary of the error code, the same for every occurrence
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`               // explanation of this occurrence
+	Instance  string `json:"instance"`             // path of the request that failed
+	ErrorCode string `json:"error_code"`           // see GET /v1/meta/errors, the generic code of the status unless more specific
+	RequestID string `json:"request_id,omitempty"` // added to every error response by the request ID middleware
+}
+
+// ErrorCode documents an error code returned in error responses
+type ErrorCode struct {
+	Code        string `json:"code"`
+	Status      int    `json:"status"` // HTTP status the code is returned with
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// ErrorCatalogResponse lists every error code the API returns
+type ErrorCatalogResponse struct {
+	Errors []ErrorCode `json:"errors"`
+}
+
+// LegacyUser identifies a user of the legacy system to migrate
+type LegacyUser struct {
+	LegacyID    string `json:"legacy_id" binding:"required"`
+	PhoneNumber string `json:"phone_number" binding:"required"`
+}
+
+// MigrateLegacyUsersRequest is a batch of legacy users signed by the legacy system
+type MigrateLegacyUsersRequest struct {
+	Users     []LegacyUser `json:"users" binding:"required,min=1,dive"`
+	IssuedAt  int64        `json:"issued_at" binding:"required"` // unix seconds
+	Signature string       `json:"signature" binding:"required"` // hex HMAC-SHA256 of the batch
+}
+
+// LegacyMigrationResult is the outcome of migrating a single legacy user
+type LegacyMigrationResult struct {
+	LegacyID string     `json:"legacy_id"`
+	UserID   *uuid.UUID `json:"user_id,omitempty"`
+	Token    string     `json:"token,omitempty"`
+	Created  bool       `json:"created"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// MigrateLegacyUsersResponse is the response to a legacy user migration
+type MigrateLegacyUsersResponse struct {
+	Results  []LegacyMigrationResult `json:"results"`
+	Migrated int                     `json:"migrated"`
+	Failed   int                     `json:"failed"`
+}
+
+// ImportUser is a user to import, optionally with a phone number verified elsewhere
+type ImportUser struct {
+	PhoneNumber    string `json:"phone_number" binding:"required"`
+	PhoneVerified  bool   `json:"phone_verified"`
+	VerifiedSource string `json:"verified_source,omitempty"` // required when phone_verified is set
+}
+
+// ImportUsersRequest is a batch of users to import
+type ImportUsersRequest struct {
+	Users []ImportUser `json:"users" binding:"required,min=1,dive"`
+}
+
+// UserImportResult is the outcome of importing a single user
+type UserImportResult struct {
+	PhoneNumber string     `json:"phone_number"`
+	UserID      *uuid.UUID `json:"user_id,omitempty"`
+	Created     bool       `json:"created"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// ImportUsersResponse is the response to a user import
+type ImportUsersResponse struct {
+	BatchID  uuid.UUID          `json:"batch_id"` // identifies the import in the audit trail
+	Results  []UserImportResult `json:"results"`
+	Imported int                `json:"imported"`
+	Skipped  int                `json:"skipped"` // phone numbers that already belong to a user
+	Failed   int                `json:"failed"`
+}
+
+// UserStats summarizes the active users
+type UserStats struct {
+	TotalUsers       int64            `json:"total_users"`
+	PhoneVerified    int64            `json:"phone_verified"`
+	Unverified       int64            `json:"unverified"`
+	VerifiedBySource map[string]int64 `json:"verified_by_source"`
+	ActiveUsers      *ActiveUserStats `json:"active_users,omitempty"`
+}
+
+// ActiveUserStats estimates how many distinct users signed in recently.
+// Days are UTC calendar days; the weekly and monthly counts include today.
+type ActiveUserStats struct {
+	Daily   int64 `json:"daily"`   // users who signed in today
+	Weekly  int64 `json:"weekly"`  // users who signed in during the last 7 days
+	Monthly int64 `json:"monthly"` // users who signed in during the last 30 days
+}
+
+// UniqueIPStats estimates how many distinct client IPs requested each endpoint on a UTC day
+type UniqueIPStats struct {
+	Date      string           `json:"date"`      // YYYY-MM-DD
+	Endpoints map[string]int64 `json:"endpoints"` // "METHOD /route" -> distinct client IPs
+}
+
+// Abuse report reporter types
+const (
+	AbuseReporterUser    = "user"
+	AbuseReporterCarrier = "carrier"
+)
+
+// Abuse report statuses
+const (
+	AbuseReportPending   = "pending"   // OTPs to the phone number are suppressed until the report is reviewed
+	AbuseReportConfirmed = "confirmed" // OTPs to the phone number stay suppressed
+	AbuseReportDismissed = "dismissed" // the report was unfounded, OTPs are sent again
+)
+
+// AbuseReport is a report of unsolicited OTP SMS received by a phone number
+type AbuseReport struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	PhoneNumber  string     `json:"phone_number" db:"phone_number"`
+	ReporterType string     `json:"reporter_type" db:"reporter_type"`
+	Details      *string    `json:"details,omitempty" db:"details"`
+	IPAddress    string     `json:"ip_address" db:"ip_address"`
+	Status       string     `json:"status" db:"status"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	ReviewedBy   *uuid.UUID `json:"reviewed_by,omitempty" db:"reviewed_by"`
+}
+
+// AbuseReportRequest is the request to report unsolicited OTP SMS to a phone number
+type AbuseReportRequest struct {
+	PhoneNumber  string `json:"phone_number" binding:"required"`
+	ReporterType string `json:"reporter_type" binding:"required,oneof=user carrier"`
+	Details      string `json:"details" binding:"max=1000"`
+}
+
+// AbuseReportResponse is the response to an abuse report
+type AbuseReportResponse struct {
+	Message  string    `json:"message"`
+	ReportID uuid.UUID `json:"report_id"`
+}
+
+// AbuseReportListParams selects a page of abuse reports
+type AbuseReportListParams struct {
+	Status   string `form:"status" json:"status"` // empty lists reports of every status
+	Page     int    `form:"page" json:"page"`
+	PageSize int    `form:"page_size" json:"page_size"`
+}
+
+// AbuseReportsListResponse is a page of abuse reports, oldest first
+type AbuseReportsListResponse struct {
+	Reports    []AbuseReport `json:"reports"`
+	TotalCount int64         `json:"total_count"`
+	Page       int           `json:"page"`
+	PageSize   int           `json:"page_size"`
+}
+
+// ReviewAbuseReportRequest is the request to resolve an abuse report
+type ReviewAbuseReportRequest struct {
+	Status string `json:"status" binding:"required,oneof=confirmed dismissed"`
+}
+
+// ReviewAbuseReportResponse is the response to resolving an abuse report
+type ReviewAbuseReportResponse struct {
+	Message  string `json:"message"`
+	Reviewed int64  `json:"reviewed"` // the report and the other pending reports of its phone number
+}
+
+// Reasons a phone number is on the suppression list
+const (
+	SuppressionOptedOut      = "opted_out"      // the user replied STOP or asked not to be texted
+	SuppressionCarrierBounce = "carrier_bounce" // the carrier reported the number undeliverable
+	SuppressionAbuseReport   = "abuse_report"   // the number has a pending or confirmed abuse report
+)
+
+// Suppression sources other than SMS provider callbacks, which are named after the provider
+const (
+	SuppressionSourceImport      = "import"
+	SuppressionSourceAbuseReport = "abuse_report"
+)
+
+// SMS provider callback statuses
+const (
+	ProviderCallbackStop          = "stop"
+	ProviderCallbackUndeliverable = "undeliverable"
+)
+
+// Suppression is an entry of the suppression list: no SMS are sent to the phone number.
+// A phone number can be suppressed for several reasons at once.
+type Suppression struct {
+	PhoneNumber string    `json:"phone_number" db:"phone_number"`
+	Reason      string    `json:"reason" db:"reason"`
+	Source      string    `json:"source" db:"source"` // what added the entry: a provider name, import or abuse_report
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// ImportSuppression is an entry of a suppression list import
+type ImportSuppression struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Reason      string `json:"reason" binding:"required,oneof=opted_out carrier_bounce abuse_report"`
+}
+
+// ImportSuppressionsRequest is a batch of suppression list entries to import
+type ImportSuppressionsRequest struct {
+	Suppressions []ImportSuppression `json:"suppressions" binding:"required,min=1,dive"`
+}
+
+// SuppressionImportResult is the outcome of importing a single suppression list entry
+type SuppressionImportResult struct {
+	PhoneNumber string `json:"phone_number"`
+	Reason      string `json:"reason"`
+	Added       bool   `json:"added"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ImportSuppressionsResponse is the response to a suppression list import
+type ImportSuppressionsResponse struct {
+	BatchID uuid.UUID                 `json:"batch_id"` // identifies the import in the audit trail
+	Results []SuppressionImportResult `json:"results"`
+	Added   int                       `json:"added"`
+	Skipped int                       `json:"skipped"` // entries on the list already
+	Failed  int                       `json:"failed"`
+}
+
+// SuppressionsResponse is the exported suppression list
+type SuppressionsResponse struct {
+	Suppressions []Suppression `json:"suppressions"`
+}
+
+// RemoveSuppressionResponse is the response to removing a phone number from the suppression list
+type RemoveSuppressionResponse struct {
+	Removed int64 `json:"removed"`
+}
+
+// ProviderCallbackRequest is a delivery status callback from an SMS provider
+type ProviderCallbackRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Status      string `json:"status" binding:"required"` // stop and undeliverable suppress the number, others are ignored
+}
+
+// OTP delivery statuses
+const (
+	DeliveryQueued    = "queued"    // waiting in the send queue, or for a retry
+	DeliverySent      = "sent"      // accepted by the SMS provider, no delivery receipt yet
+	DeliveryDelivered = "delivered" // the provider reported the SMS delivered to the phone
+	DeliveryFailed    = "failed"    // the provider reported the SMS could not be delivered
+)
+
+// OTPDelivery is the delivery status of the latest send of an OTP challenge
+type OTPDelivery struct {
+	ChallengeID string    `json:"challenge_id"`
+	Provider    string    `json:"provider"`
+	MessageID   string    `json:"message_id"` // the provider's ID for the message, referred to by its delivery receipts
+	Status      string    `json:"status"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Login statuses of a challenge
+const (
+	LoginStatusPending  = "pending"
+	LoginStatusVerified = "verified"
+)
+
+// LoginStatus is the sign-in status of a challenge, pushed to the client it was issued to
+type LoginStatus struct {
+	ChallengeID string    `json:"challenge_id"`
+	Status      string    `json:"status"`
+	IPAddress   string    `json:"ip_address"` // client the challenge was issued to
+	UserAgent   string    `json:"user_agent"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// LoginStatusResponse is an event of the login status stream of a challenge
+type LoginStatusResponse struct {
+	ChallengeID string    `json:"challenge_id"`
+	Status      string    `json:"status"` // pending, then verified
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DeliveryReceiptRequest is a delivery receipt (DLR) from an SMS provider
+type DeliveryReceiptRequest struct {
+	MessageID string `json:"message_id" binding:"required"`
+	Status    string `json:"status" binding:"required"` // delivered and failed update the OTP's status, others are ignored
+}
+
+// OTPStatusResponse is the response for the delivery status of an OTP challenge
+type OTPStatusResponse struct {
+	ChallengeID string    `json:"challenge_id"`
+	Status      string    `json:"status"` // queued, sent, delivered or failed
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// OTPSendJob is an OTP waiting in the send queue to be sent in the background
+type OTPSendJob struct {
+	ID          string    `json:"id"`
+	ChallengeID string    `json:"challenge_id"`
+	Tenant      string    `json:"tenant,omitempty"` // tenant the OTP was requested for, counted against its sms.overflow.tenants limit
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	EnqueuedAt  time.Time `json:"enqueued_at"`
+}
+
+// Phone lists consulted before sending an OTP
+const (
+	PhoneListBlock = "block" // no OTPs are sent to matching phone numbers
+	PhoneListAllow = "allow" // in allowlist-only mode, OTPs are only sent to matching phone numbers
+)
+
+// PhoneListEntry is a phone number, or the start of phone numbers, on the blocklist or allowlist
+type PhoneListEntry struct {
+	List      string     `json:"list" db:"list"`
+	Prefix    string     `json:"prefix" db:"prefix"` // matches every phone number starting with it
+	Reason    string     `json:"reason" db:"reason"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// AddPhoneListEntryRequest is the request to put a phone number or prefix on the blocklist or allowlist
+type AddPhoneListEntryRequest struct {
+	List   string `json:"list" binding:"omitempty,oneof=block allow"` // block if empty
+	Prefix string `json:"prefix" binding:"required"`
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// RemovePhoneListEntryRequest is the request to take a phone number or prefix off the blocklist or allowlist
+type RemovePhoneListEntryRequest struct {
+	List   string `json:"list" binding:"omitempty,oneof=block allow"` // block if empty
+	Prefix string `json:"prefix" binding:"required"`
+}
+
+// PhoneListResponse lists the blocklist and allowlist entries
+type PhoneListResponse struct {
+	Entries []PhoneListEntry `json:"entries"`
+}
+
+// AddPhoneListEntryResponse is the response to putting a phone number or prefix on a list
+type AddPhoneListEntryResponse struct {
+	Added bool `json:"added"` // false if it was on the list already
+}
+
+// RemovePhoneListEntryResponse is the response to taking a phone number or prefix off a list
+type RemovePhoneListEntryResponse struct {
+	Removed bool `json:"removed"`
+}
+
+// TrustedDevice is a device whose token lets its user sign in without an OTP.
+// Only a hash of the token is stored.
+type TrustedDevice struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"-" db:"user_id"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	Name       string     `json:"name" db:"name"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	IPAddress  string     `json:"ip_address" db:"ip_address"` // where the device was trusted from
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt  *time.Time `json:"-" db:"revoked_at"`
+}
+
+// TrustedDevicesResponse lists a user's trusted devices, newest first
+type TrustedDevicesResponse struct {
+	Devices []TrustedDevice `json:"devices"`
+}
+
+// Session is a signed-in session of a user. Its ID is the jti claim of the access tokens
+// issued for it, which stop being accepted once it is revoked. Only a hash of its
+// refresh token is stored.
+type Session struct {
+	ID               uuid.UUID  `json:"id"`
+	UserID           uuid.UUID  `json:"-"`
+	RefreshTokenHash string     `json:"-"`
+	UserAgent        string     `json:"user_agent"`
+	IPAddress        string     `json:"ip_address"`        // where the session was signed in from
+	Country          string     `json:"country,omitempty"` // ISO 3166 code of the country the session was signed in from, if known
+	CreatedAt        time.Time  `json:"created_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"` // when the session was last refreshed
+	ExpiresAt        time.Time  `json:"expires_at"`
+	Current          bool       `json:"current"` // whether the listing request was made with this session
+}
+
+// SessionTokens are the tokens issued for a session
+type SessionTokens struct {
+	SessionID    uuid.UUID
+	AccessToken  string
+	RefreshToken string
+}
+
+// SessionsResponse lists a user's active sessions, newest first
+type SessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+// RevokeSessionsResponse is the response to revoking all of a user's sessions
+type RevokeSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+// LoginMethodTrustedDevice is the login method of signing in with a trusted device's token instead of an OTP
+const LoginMethodTrustedDevice = "trusted_device"
+
+// LoginMethodSilentNetwork is the login method of signing in with the phone number verified by the carrier instead of an OTP
+const LoginMethodSilentNetwork = "silent_network"
+
+// Login attempt failure reasons
+const (
+	LoginFailureInvalidCode = "invalid_code" // the OTP or backup code was wrong
+	LoginFailureLockedOut   = "locked_out"   // the phone number was locked out after too many wrong codes
+	LoginFailureDenied      = "denied"       // a user created or login hook refused the sign-in
+	LoginFailureNotVerified = "not_verified" // the carrier reported another phone number for the device
+)
+
+// LoginAttempt is a verification of an OTP or backup code, successful or not.
+// Failed attempts for phone numbers without an account have no user ID.
+type LoginAttempt struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	UserID        *uuid.UUID `json:"-" db:"user_id"`
+	PhoneNumber   string     `json:"-" db:"phone_number"`
+	Method        string     `json:"method" db:"method"` // otp, backup_code or trusted_device
+	Success       bool       `json:"success" db:"success"`
+	FailureReason *string    `json:"failure_reason,omitempty" db:"failure_reason"`
+	IPAddress     string     `json:"ip_address" db:"ip_address"`
+	UserAgent     string     `json:"user_agent" db:"user_agent"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TimelineEntry is something that happened to a user, in a user's auth timeline
+type TimelineEntry struct {
+	At   time.Time   `json:"at"`
+	Kind string      `json:"kind"` // audit, event, login or session
+	Type string      `json:"type"` // the audit action, event type or login method; started for sessions
+	Data interface{} `json:"data"` // the audit log entry, domain event, login attempt or session
+}
+
+// UserTimelineResponse is a page of a user's auth timeline, newest first
+type UserTimelineResponse struct {
+	UserID     uuid.UUID       `json:"user_id"`
+	Entries    []TimelineEntry `json:"entries"`
+	TotalCount int64           `json:"total_count"`
+	Page       int             `json:"page"`
+	PageSize   int             `json:"page_size"`
+}
+
+// AccountExport is all the personal data stored about a user, for data subject access requests
+type AccountExport struct {
+	ExportedAt     time.Time       `json:"exported_at"`
+	User           User            `json:"user"`
+	Logins         []LoginAttempt  `json:"logins"`          // newest first
+	Sessions       []Session       `json:"sessions"`        // active sessions, newest first
+	TrustedDevices []TrustedDevice `json:"trusted_devices"` // active trusted devices, newest first
+	Events         []DomainEvent   `json:"events"`          // domain events about the user or their phone number, newest first
+	AuditLogs      []AuditLog      `json:"audit_logs"`      // admin actions on the user or their phone number, newest first
+}
+
+// UpdateProfileRequest is the request to update the current user's profile. Fields left out
+// keep their value, while empty strings clear them.
+type UpdateProfileRequest struct {
+	FirstName *string `json:"first_name,omitempty" binding:"omitempty,max=100"`
+	LastName  *string `json:"last_name,omitempty" binding:"omitempty,max=100"`
+	Email     *string `json:"email,omitempty" binding:"omitempty,max=255"`
+	AvatarURL *string `json:"avatar_url,omitempty" binding:"omitempty,max=2048"` // an http or https URL
+}
+
+// UpdateMetadataRequest is the request to change the metadata of a user. Keys given with a
+// string are set to it, keys given with null are removed, and keys left out keep their value.
+type UpdateMetadataRequest struct {
+	Metadata map[string]*string `json:"metadata" binding:"required"`
+}
+
+// AnalyticsConsentRequest is the request to give or withdraw consent to analytics
+type AnalyticsConsentRequest struct {
+	AnalyticsConsent *bool `json:"analytics_consent" binding:"required"`
+}
+
+// AnalyticsConsentResponse is the response to a change of analytics consent
+type AnalyticsConsentResponse struct {
+	AnalyticsConsent bool `json:"analytics_consent"`
+}
+
+// LoginHistoryResponse is a page of a user's login attempts, newest first
+type LoginHistoryResponse struct {
+	Logins     []LoginAttempt `json:"logins"`
+	TotalCount int64          `json:"total_count"`
+	Page       int            `json:"page"`
+	PageSize   int            `json:"page_size"`
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error string `json:"error"`
+// Token exchange grant and token types (RFC 8693)
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchangeRequest is the request to exchange a user's token for a downstream service token
+type TokenExchangeRequest struct {
+	GrantType          string `form:"grant_type" json:"grant_type" binding:"required"`
+	SubjectToken       string `form:"subject_token" json:"subject_token" binding:"required"`
+	SubjectTokenType   string `form:"subject_token_type" json:"subject_token_type" binding:"required"`
+	Audience           string `form:"audience" json:"audience" binding:"required"`
+	Scope              string `form:"scope" json:"scope"` // space-separated, defaults to every scope the client may request
+	RequestedTokenType string `form:"requested_token_type" json:"requested_token_type"`
+}
+
+// TokenExchangeResponse is the response to a token exchange
+type TokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"` // seconds
+	Scope           string `json:"scope,omitempty"`
+}
+
+// OAuthErrorResponse is an OAuth 2.0 style error response
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	Code             string `json:"code,omitempty"`
+	RequestID        string `json:"request_id,omitempty"`
+}
+
+// CaptchaProblem is an error response for requests that need a solved CAPTCHA
+type CaptchaProblem struct {
+	Problem
+	CaptchaRequired bool `json:"captcha_required"`
+}
+
+// OTPProblem is an error response for OTPs that failed to verify
+type OTPProblem struct {
+	Problem
+	OTPExpiresAt *time.Time `json:"otp_expires_at,omitempty"` // when the challenge expires, if it is still pending
+	ServerTime   time.Time  `json:"server_time"`
+}
+
+// ServerTimeResponse is the server's current time, for clients to correct their clock skew
+type ServerTimeResponse struct {
+	ServerTime time.Time `json:"server_time"`
+	UnixMillis int64     `json:"unix_ms"`
+}
+
+// Severities of maintenance notices, for clients to style their banners by
+const (
+	MaintenanceSeverityInfo     = "info"
+	MaintenanceSeverityWarning  = "warning"
+	MaintenanceSeverityCritical = "critical"
+)
+
+// Statuses of the service reported by the status endpoint
+const (
+	ServiceStatusOK          = "ok"
+	ServiceStatusMaintenance = "maintenance" // a maintenance window is in progress
+)
+
+// MaintenanceNotice announces a window of planned downtime
+type MaintenanceNotice struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	Severity  string    `json:"severity"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Active reports whether the maintenance window is in progress at now
+func (n *MaintenanceNotice) Active(now time.Time) bool {
+	return !now.Before(n.StartsAt) && now.Before(n.EndsAt)
+}
+
+// CreateMaintenanceNoticeRequest is the request to announce a maintenance window
+type CreateMaintenanceNoticeRequest struct {
+	Message  string    `json:"message" binding:"required,max=500"`
+	Severity string    `json:"severity" binding:"omitempty,oneof=info warning critical"` // info if empty
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+}
+
+// MaintenanceNoticesResponse lists maintenance notices
+type MaintenanceNoticesResponse struct {
+	Notices []MaintenanceNotice `json:"notices"`
+}
+
+// ServiceStatusResponse is the status of the service, with the maintenance windows that are in
+// progress or upcoming, for clients to show banners before planned downtime
+type ServiceStatusResponse struct {
+	Status     string              `json:"status"`
+	ServerTime time.Time           `json:"server_time"`
+	Notices    []MaintenanceNotice `json:"notices"`
+}
+
+// RetryAfterProblem is an error response for requests that may be retried later
+type RetryAfterProblem struct {
+	Problem
+	RetryAfter int `json:"retry_after"` // seconds until the request is allowed again
+}
+
+// LockoutState describes the OTP verification lockout state of a phone number
+type LockoutState struct {
+	FailedAttempts int           // failed verifications in the current window
+	Locked         bool          // whether verification is currently blocked
+	RetryAfter     time.Duration // time until the lockout ends, zero if not locked
+}
+
+// RestoreUserResponse is the response to restoring a soft-deleted user
+type RestoreUserResponse struct {
+	Message string       `json:"message"`
+	User    UserResponse `json:"user"`
+}
+
+// MessageResponse is a generic response carrying a status message
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// ExpireOTPsRequest is the request to force-expire pending OTPs
+type ExpireOTPsRequest struct {
+	Prefix string `json:"prefix" binding:"required"`
+}
+
+// ExpireOTPsResponse is the response to force-expiring pending OTPs
+type ExpireOTPsResponse struct {
+	Expired int64 `json:"expired"`
+}
+
+// ProviderStatus describes an SMS provider, whether it is in rotation and its health
+type ProviderStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	ProviderHealth
+}
+
+// ProviderHealth counts an SMS provider's sends in its current error rate window
+// and tells until when it is quarantined for failing too often
+type ProviderHealth struct {
+	Sent             int64      `json:"sent"`
+	Failed           int64      `json:"failed"`
+	QuarantinedUntil *time.Time `json:"quarantined_until,omitempty"`
+}
+
+// ProvidersResponse is the response for listing SMS providers
+type ProvidersResponse struct {
+	Providers []ProviderStatus `json:"providers"`
+}
+
+// SetProviderStateRequest is the request to toggle an SMS provider
+type SetProviderStateRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
 }
 
 // TokenClaims represents the custom JWT claims
 type TokenClaims struct {
 	UserID      string `json:"user_id"`
 	PhoneNumber string `json:"phone_number"`
+	Role        string `json:"role"`
+}
+
+// LoadResponse is the instance's load as reported to load balancers
+type LoadResponse struct {
+	Score            float64          `json:"score"`  // from 0 (idle) to 1 (fully loaded)
+	Weight           int              `json:"weight"` // from 1 to 100, for weighted load balancing
+	InFlightRequests int64            `json:"inflight_requests"`
+	Dependencies     []DependencyLoad `json:"dependencies"`
+}
+
+// ReadinessResponse is the result of the readiness check
+type ReadinessResponse struct {
+	Status       string             `json:"status"` // ready, warming up or unavailable
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// DependencyStatus is the result of checking a dependency for the readiness check
+type DependencyStatus struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`   // up or down
+	Critical  bool    `json:"critical"` // whether the instance is unavailable while it is down
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// DependencyLoad is the latest probe result of a dependency
+type DependencyLoad struct {
+	Name      string  `json:"name"`
+	Healthy   bool    `json:"healthy"`    // false if the latest probe failed or timed out
+	LatencyMS float64 `json:"latency_ms"` // moving average of successful probes
+}
+
+// Scopes granted to API keys, each allowing machine access to some /v1/users endpoints
+const (
+	APIKeyScopeUsersRead     = "users:read"     // get and list users
+	APIKeyScopeUsersMetadata = "users:metadata" // update the metadata of users
+)
+
+// APIKeyScopes is the scopes of an API key, stored as a JSON array
+type APIKeyScopes []string
+
+// Value encodes the scopes as a JSON array, empty for nil scopes
+func (s APIKeyScopes) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan decodes scopes stored as a JSON array
+func (s *APIKeyScopes) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into API key scopes", src)
+	}
+	*s = nil
+	return json.Unmarshal(data, s)
+}
+
+// APIKey authenticates a service calling the API on its own behalf rather than a user's.
+// Only a hash of the key is stored; its prefix is kept to tell keys apart.
+type APIKey struct {
+	ID         uuid.UUID    `json:"id" db:"id"`
+	Name       string       `json:"name" db:"name"`
+	KeyHash    string       `json:"-" db:"key_hash"`
+	KeyPrefix  string       `json:"key_prefix" db:"key_prefix"` // the first characters of the key
+	Scopes     APIKeyScopes `json:"scopes" db:"scopes"`
+	CreatedBy  *uuid.UUID   `json:"created_by,omitempty" db:"created_by"` // the admin who created the key
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time   `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest is the request to create an API key
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=users:read users:metadata"`
+}
+
+// CreateAPIKeyResponse is a newly created API key. Key is only ever returned here.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeysResponse lists API keys, newest first
+type APIKeysResponse struct {
+	APIKeys []APIKey `json:"api_keys"`
 }
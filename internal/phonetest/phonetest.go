@@ -0,0 +1,61 @@
+// Package phonetest holds real-world Iranian phone numbers for table-driven tests of phone number
+// validation: mobile numbers of every operator, including recently opened prefixes and MVNOs,
+// landlines, which can't receive SMS, and malformed numbers.
+package phonetest
+
+// Number is a phone number of a fixture and what it is, to name test cases by
+type Number struct {
+	Value string
+	Note  string
+}
+
+// Mobiles are valid mobile numbers, in every accepted format
+var Mobiles = []Number{
+	{"09121234567", "MCI 0912"},
+	{"09191234567", "MCI 0919"},
+	{"09901234567", "MCI 0990"},
+	{"09941234567", "MCI 0994"},
+	{"09301234567", "Irancell 0930"},
+	{"09391234567", "Irancell 0939"},
+	{"09011234567", "Irancell 0901"},
+	{"09051234567", "Irancell 0905"},
+	{"09411234567", "Irancell TD-LTE 0941"},
+	{"09201234567", "RighTel 0920"},
+	{"09221234567", "RighTel 0922"},
+	{"09321234567", "Taliya 0932"},
+	{"09341234567", "TeleKish 0934"},
+	{"09981234567", "Shatel Mobile MVNO 0998"},
+	{"09991234567", "MVNO 0999"},
+	{"+989121234567", "MCI with +98"},
+	{"989351234567", "Irancell with 98"},
+	{"+989991234567", "MVNO with +98"},
+}
+
+// Landlines are valid landline numbers, in every accepted format, which are not mobile numbers
+var Landlines = []Number{
+	{"02112345678", "Tehran"},
+	{"02632345678", "Karaj"},
+	{"03136789012", "Isfahan"},
+	{"04133456789", "Tabriz"},
+	{"05138765432", "Mashhad"},
+	{"07132345678", "Shiraz"},
+	{"08138765432", "Hamedan"},
+	{"+982112345678", "Tehran with +98"},
+	{"985138765432", "Mashhad with 98"},
+}
+
+// Malformed are neither mobile nor landline numbers
+var Malformed = []Number{
+	{"", "empty"},
+	{"0912123456", "one digit short"},
+	{"091212345678", "one digit long"},
+	{"+98912123456", "one digit short with +98"},
+	{"0912123456a", "letter"},
+	{"0912 123 4567", "spaces"},
+	{"0912-123-4567", "dashes"},
+	{"۰۹۱۲۱۲۳۴۵۶۷", "Persian digits"},
+	{"00989121234567", "international call prefix"},
+	{"+980912123456", "trunk prefix after +98"},
+	{"9121234567", "without trunk prefix"},
+	{"+14155550123", "foreign"},
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// Decision outcomes, as counted by policy_decisions_total
+const (
+	outcomeAllow = "allow"
+	outcomeDeny  = "deny"
+	outcomeError = "error"
+)
+
+// Authorizer asks an evaluator for decisions and logs every one of them, so denials can be
+// traced back to the policy and input that caused them
+type Authorizer struct {
+	evaluator Evaluator
+	failOpen  bool
+	decisions *metrics.CounterVec
+	logger    *slog.Logger
+}
+
+// NewAuthorizer creates a new authorizer. With failOpen set, requests are allowed while the
+// evaluator cannot make a decision; otherwise they fail.
+func NewAuthorizer(evaluator Evaluator, failOpen bool, registry *metrics.Registry, logger *slog.Logger) *Authorizer {
+	return &Authorizer{
+		evaluator: evaluator,
+		failOpen:  failOpen,
+		decisions: registry.CounterVec("policy_decisions_total", "Authorization decisions of the policy engine, by action and outcome.", "action", "outcome"),
+		logger:    logger,
+	}
+}
+
+// Authorize decides whether input is allowed. An error means no decision could be made while
+// failing closed; failing open, such requests are allowed instead.
+func (a *Authorizer) Authorize(ctx context.Context, input *Input) (*Decision, error) {
+	decision, err := a.evaluator.Evaluate(ctx, input)
+	if err != nil {
+		a.decisions.With(input.Action, outcomeError).Inc()
+		logging.FromContext(ctx, a.logger).ErrorContext(ctx, "Error evaluating policy", "action", input.Action, "route", input.Route, "fail_open", a.failOpen, "error", err)
+		if a.failOpen {
+			return &Decision{Allow: true}, nil
+		}
+		return nil, err
+	}
+
+	outcome := outcomeDeny
+	if decision.Allow {
+		outcome = outcomeAllow
+	}
+	a.decisions.With(input.Action, outcome).Inc()
+
+	attrs := []any{
+		"action", input.Action,
+		"method", input.Method,
+		"route", input.Route,
+		"allow", decision.Allow,
+		"ip_address", input.IPAddress,
+	}
+	if input.User != nil {
+		attrs = append(attrs, "user_id", input.User.ID, "role", input.User.Role)
+	}
+	if input.PhoneNumber != "" {
+		attrs = append(attrs, "phone_number", input.PhoneNumber)
+	}
+	if decision.Reason != "" {
+		attrs = append(attrs, "reason", decision.Reason)
+	}
+	if decision.DecisionID != "" {
+		attrs = append(attrs, "decision_id", decision.DecisionID)
+	}
+	logging.FromContext(ctx, a.logger).InfoContext(ctx, "Policy decision", attrs...)
+	return decision, nil
+}
@@ -0,0 +1,169 @@
+// Package policy asks an Open Policy Agent (OPA) for authorization decisions, so who may use
+// admin routes and risky auth flows can be changed in Rego policies rather than in code.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Actions authorized by the policies
+const (
+	ActionAdmin      = "admin"            // any admin route
+	ActionRequestOTP = "auth.request_otp" // requesting an OTP, or signing in with a trusted device
+	ActionResendOTP  = "auth.resend_otp"
+	ActionVerifyOTP  = "auth.verify_otp" // verifying an OTP or backup code
+)
+
+// Input describes a request to be authorized, passed to policies as input
+type Input struct {
+	Action      string            `json:"action"` // one of the actions above
+	Method      string            `json:"method"`
+	Route       string            `json:"route"` // route pattern, e.g. /v1/admin/users/:id/restore
+	Params      map[string]string `json:"params,omitempty"`
+	User        *User             `json:"user,omitempty"` // the authenticated user, if any
+	PhoneNumber string            `json:"phone_number,omitempty"`
+	IPAddress   string            `json:"ip_address"`
+	UserAgent   string            `json:"user_agent"`
+}
+
+// User is the authenticated user of a request
+type User struct {
+	ID          string `json:"id"`
+	Role        string `json:"role"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+// Decision is a policy's answer for an input
+type Decision struct {
+	Allow      bool
+	Reason     string // why the request was denied, if the policy says
+	DecisionID string // OPA's ID of the decision, for correlating with its decision logs
+}
+
+// Evaluator makes authorization decisions
+type Evaluator interface {
+	// Evaluate decides whether input is allowed. An error means no decision could be made,
+	// not that the request is denied.
+	Evaluate(ctx context.Context, input *Input) (*Decision, error)
+}
+
+// OPAClient asks an OPA server, usually a sidecar, for decisions through its data API
+type OPAClient struct {
+	httpClient *http.Client
+	baseURL    string
+	path       string
+}
+
+// NewOPAClient creates a client querying the rule at path (e.g. otpauth/authz) of the OPA
+// server at baseURL, whose requests time out after timeout
+func NewOPAClient(baseURL, path string, timeout time.Duration) (*OPAClient, error) {
+	if u, err := url.Parse(baseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OPA URL: %s", baseURL)
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("OPA decision path cannot be empty")
+	}
+
+	return &OPAClient{
+		httpClient: &http.Client{Timeout: timeout},
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		path:       path,
+	}, nil
+}
+
+// dataResponse is the response of the data API. The result is either a boolean or an object
+// with allow and reason, and missing if the rule is undefined for the input.
+type dataResponse struct {
+	Result     json.RawMessage `json:"result"`
+	DecisionID string          `json:"decision_id"`
+}
+
+// Evaluate queries the decision rule with input. An undefined rule denies the request.
+func (c *OPAClient) Evaluate(ctx context.Context, input *Input) (*Decision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding policy input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/data/"+c.path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating policy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying OPA: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error querying OPA: server responded with status %d", resp.StatusCode)
+	}
+
+	var result dataResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding OPA response: %w", err)
+	}
+
+	decision := &Decision{DecisionID: result.DecisionID}
+	if len(result.Result) == 0 {
+		return decision, nil
+	}
+	var allow bool
+	if err := json.Unmarshal(result.Result, &allow); err == nil {
+		decision.Allow = allow
+		return decision, nil
+	}
+	var object struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(result.Result, &object); err != nil {
+		return nil, fmt.Errorf("OPA decision at %s is neither a boolean nor an object with allow", c.path)
+	}
+	decision.Allow = object.Allow
+	decision.Reason = object.Reason
+	return decision, nil
+}
+
+// LoadPolicies uploads Rego policy files to the OPA server, each as a policy named after its
+// file name, replacing the policy uploaded before under the same name
+func (c *OPAClient) LoadPolicies(ctx context.Context, files []string) error {
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading policy %s: %w", file, err)
+		}
+
+		id := url.PathEscape(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+"/v1/policies/"+id, bytes.NewReader(source))
+		if err != nil {
+			return fmt.Errorf("error creating policy upload request: %w", err)
+		}
+		req.Header.Set("Content-Type", "text/plain")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("error uploading policy %s: %w", file, err)
+		}
+		// OPA explains compile errors in the body
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("error uploading policy %s: OPA responded with status %d: %s", file, resp.StatusCode, bytes.TrimSpace(message))
+		}
+	}
+	return nil
+}
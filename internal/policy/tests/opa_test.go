@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/policy"
+)
+
+// newOPA starts a fake OPA server answering decisions at otpauth/authz with the result for the
+// input's action, and recording uploaded policies
+func newOPA(t *testing.T, results map[string]string, policies map[string]string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/data/otpauth/authz":
+			var body struct {
+				Input policy.Input `json:"input"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result, ok := results[body.Input.Action]
+			if !ok {
+				// Undefined decisions have no result
+				w.Write([]byte(`{"decision_id": "d-undefined"}`))
+				return
+			}
+			w.Write([]byte(`{"decision_id": "d-1", "result": ` + result + `}`))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/policies/"):
+			source, _ := io.ReadAll(r.Body)
+			if !strings.HasPrefix(string(source), "package ") {
+				http.Error(w, `{"code": "invalid_parameter", "message": "error(s) occurred while compiling module(s)"}`, http.StatusBadRequest)
+				return
+			}
+			policies[strings.TrimPrefix(r.URL.Path, "/v1/policies/")] = string(source)
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOPAClientEvaluate(t *testing.T) {
+	server := newOPA(t, map[string]string{
+		policy.ActionAdmin:      `true`,
+		policy.ActionRequestOTP: `{"allow": false, "reason": "Country not served"}`,
+		policy.ActionVerifyOTP:  `"yes"`,
+	}, nil)
+	client, err := policy.NewOPAClient(server.URL, "/otpauth/authz/", time.Second)
+	if err != nil {
+		t.Fatalf("NewOPAClient: %v", err)
+	}
+	ctx := context.Background()
+
+	decision, err := client.Evaluate(ctx, &policy.Input{Action: policy.ActionAdmin})
+	if err != nil || !decision.Allow || decision.DecisionID != "d-1" {
+		t.Fatalf("Evaluate(admin) = %+v, %v, want allowed", decision, err)
+	}
+	decision, err = client.Evaluate(ctx, &policy.Input{Action: policy.ActionRequestOTP})
+	if err != nil || decision.Allow || decision.Reason != "Country not served" {
+		t.Fatalf("Evaluate(auth.request_otp) = %+v, %v, want denied with reason", decision, err)
+	}
+	// Undefined decisions deny
+	decision, err = client.Evaluate(ctx, &policy.Input{Action: policy.ActionResendOTP})
+	if err != nil || decision.Allow {
+		t.Fatalf("Evaluate(auth.resend_otp) = %+v, %v, want denied", decision, err)
+	}
+	// Results that are no decision are errors, not denials
+	if _, err := client.Evaluate(ctx, &policy.Input{Action: policy.ActionVerifyOTP}); err == nil {
+		t.Fatal("expected an error for a string result")
+	}
+}
+
+func TestOPAClientLoadPolicies(t *testing.T) {
+	policies := make(map[string]string)
+	server := newOPA(t, nil, policies)
+	client, err := policy.NewOPAClient(server.URL, "otpauth/authz", time.Second)
+	if err != nil {
+		t.Fatalf("NewOPAClient: %v", err)
+	}
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "authz.rego")
+	os.WriteFile(valid, []byte("package otpauth.authz\n\ndefault allow := false\n"), 0o600)
+	if err := client.LoadPolicies(context.Background(), []string{valid}); err != nil {
+		t.Fatalf("LoadPolicies: %v", err)
+	}
+	if !strings.HasPrefix(policies["authz"], "package otpauth.authz") {
+		t.Fatalf("expected the policy uploaded as authz, got %v", policies)
+	}
+
+	invalid := filepath.Join(dir, "broken.rego")
+	os.WriteFile(invalid, []byte("allow {"), 0o600)
+	if err := client.LoadPolicies(context.Background(), []string{invalid}); err == nil || !strings.Contains(err.Error(), "compiling") {
+		t.Fatalf("expected OPA's compile error, got %v", err)
+	}
+}
+
+func TestNewOPAClientInvalid(t *testing.T) {
+	if _, err := policy.NewOPAClient("localhost:8181", "otpauth/authz", time.Second); err == nil {
+		t.Fatal("expected an error for a URL without scheme")
+	}
+	if _, err := policy.NewOPAClient("http://localhost:8181", "/", time.Second); err == nil {
+		t.Fatal("expected an error for an empty path")
+	}
+}
+
+func TestAuthorizerFailure(t *testing.T) {
+	// Nothing listens here, so no decision can be made
+	client, err := policy.NewOPAClient("http://127.0.0.1:1", "otpauth/authz", time.Second)
+	if err != nil {
+		t.Fatalf("NewOPAClient: %v", err)
+	}
+	input := &policy.Input{Action: policy.ActionAdmin}
+
+	closed := policy.NewAuthorizer(client, false, metrics.NewRegistry(), logging.Discard())
+	if _, err := closed.Authorize(context.Background(), input); err == nil {
+		t.Fatal("expected failing closed to return an error")
+	}
+
+	open := policy.NewAuthorizer(client, true, metrics.NewRegistry(), logging.Discard())
+	decision, err := open.Authorize(context.Background(), input)
+	if err != nil || !decision.Allow {
+		t.Fatalf("Authorize failing open = %+v, %v, want allowed", decision, err)
+	}
+}
@@ -0,0 +1,193 @@
+// Package pubsub relays messages between the service's instances, so changes made on one
+// instance, such as a challenge being verified or a phone number being blocked, reach the
+// others at once.
+//
+// Each instance holds a single subscription to the broker for all topics and fans messages
+// out to its local subscribers. Messages published while an instance is disconnected are
+// lost; once it has reconnected, its subscribers are told to resync instead.
+package pubsub
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// Delays before resubscribing after the broker connection fails, doubling up to the maximum
+const (
+	initialReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay     = 10 * time.Second
+)
+
+// Message is a message published on a topic. Resync messages carry no payload; they tell
+// subscribers that messages may have been missed, e.g. while reconnecting to the broker,
+// and that they should reload whatever state they keep from the topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Resync  bool
+}
+
+// Handler handles the messages of a subscription. Handlers are called one at a time from
+// the bus's receive loop, so they must not block.
+type Handler func(Message)
+
+// Broker carries messages between instances
+type Broker interface {
+	// Publish publishes payload on topic to every instance
+	Publish(ctx context.Context, topic string, payload []byte) error
+
+	// Listen subscribes to every topic, calls subscribed once messages published from then
+	// on are received and passes them to handle, until ctx is done or the connection fails
+	Listen(ctx context.Context, subscribed func(), handle func(Message)) error
+}
+
+// subscription is a local subscriber to a topic
+type subscription struct {
+	handler Handler
+}
+
+// Bus publishes messages to every instance and dispatches the messages received to the
+// instance's subscribers
+type Bus struct {
+	broker Broker
+	logger *slog.Logger
+
+	mu            sync.Mutex
+	subscriptions map[string]map[*subscription]bool // topic -> subscriptions
+
+	published  *metrics.CounterVec
+	received   *metrics.CounterVec
+	reconnects metrics.Counter
+	connected  metrics.Gauge
+	subscribed metrics.Gauge
+}
+
+// NewBus creates a new bus over broker, exporting its metrics to registry. Messages are
+// only received while Run is running.
+func NewBus(broker Broker, registry *metrics.Registry, logger *slog.Logger) *Bus {
+	return &Bus{
+		broker:        broker,
+		logger:        logger,
+		subscriptions: make(map[string]map[*subscription]bool),
+		published:     registry.CounterVec("pubsub_messages_published_total", "Messages published on the pub/sub bus.", "topic"),
+		received:      registry.CounterVec("pubsub_messages_received_total", "Messages received from the pub/sub bus.", "topic"),
+		reconnects:    registry.Counter("pubsub_reconnects_total", "Reconnections to the pub/sub broker after its connection failed."),
+		connected:     registry.Gauge("pubsub_connected", "Whether the instance is subscribed to the pub/sub broker."),
+		subscribed:    registry.Gauge("pubsub_subscriptions", "Local subscriptions to pub/sub topics."),
+	}
+}
+
+// Publish publishes payload on topic to every instance, including this one
+func (b *Bus) Publish(ctx context.Context, topic string, payload []byte) error {
+	if err := b.broker.Publish(ctx, topic, payload); err != nil {
+		return err
+	}
+	b.published.With(topicFamily(topic)).Inc()
+	return nil
+}
+
+// Subscribe calls handler with the messages published on topic from now on, and with a
+// resync message whenever some may have been missed. The returned function unsubscribes.
+func (b *Bus) Subscribe(topic string, handler Handler) func() {
+	sub := &subscription{handler: handler}
+
+	b.mu.Lock()
+	subs := b.subscriptions[topic]
+	if subs == nil {
+		subs = make(map[*subscription]bool)
+		b.subscriptions[topic] = subs
+	}
+	subs[sub] = true
+	b.mu.Unlock()
+	b.subscribed.Inc()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscriptions[topic], sub)
+			if len(b.subscriptions[topic]) == 0 {
+				delete(b.subscriptions, topic)
+			}
+			b.mu.Unlock()
+			b.subscribed.Dec()
+		})
+	}
+}
+
+// Run receives messages from the broker until ctx is cancelled, resubscribing with
+// exponential backoff whenever the connection fails
+func (b *Bus) Run(ctx context.Context) {
+	delay := initialReconnectDelay
+	for {
+		err := b.broker.Listen(ctx, func() {
+			b.connected.Set(1)
+			delay = initialReconnectDelay
+			// Subscribers may have missed messages before the first subscription too, e.g. if
+			// they subscribed while the broker was unreachable at startup
+			b.resync()
+		}, b.dispatch)
+		b.connected.Set(0)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.logger.Warn("Pub/sub connection failed, reconnecting", "error", err, "retry_in", delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+		b.reconnects.Inc()
+	}
+}
+
+// dispatch passes a message received from the broker to the subscribers of its topic
+func (b *Bus) dispatch(message Message) {
+	b.received.With(topicFamily(message.Topic)).Inc()
+	for _, handler := range b.handlers(message.Topic) {
+		handler(message)
+	}
+}
+
+// resync tells every subscriber that messages may have been missed
+func (b *Bus) resync() {
+	b.mu.Lock()
+	topics := make([]string, 0, len(b.subscriptions))
+	for topic := range b.subscriptions {
+		topics = append(topics, topic)
+	}
+	b.mu.Unlock()
+
+	for _, topic := range topics {
+		for _, handler := range b.handlers(topic) {
+			handler(Message{Topic: topic, Resync: true})
+		}
+	}
+}
+
+// handlers returns the handlers of the subscribers to topic; they are called without
+// holding the lock, so handlers can unsubscribe
+func (b *Bus) handlers(topic string) []Handler {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	handlers := make([]Handler, 0, len(b.subscriptions[topic]))
+	for sub := range b.subscriptions[topic] {
+		handlers = append(handlers, sub.handler)
+	}
+	return handlers
+}
+
+// topicFamily returns the part of topic before the first colon, e.g. login_status for
+// login_status:<challenge ID>, keeping the metrics' label values bounded
+func topicFamily(topic string) string {
+	family, _, _ := strings.Cut(topic, ":")
+	return family
+}
@@ -0,0 +1,73 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// listener is a Listen call of an InMemoryBroker
+type listener struct {
+	handle func(Message)
+	failed chan struct{}
+}
+
+// InMemoryBroker implements Broker in process memory, delivering messages to the buses
+// listening on it at the time. It is intended for tests.
+type InMemoryBroker struct {
+	mu        sync.Mutex
+	listeners map[*listener]bool
+}
+
+// NewInMemoryBroker creates a new in-memory broker
+func NewInMemoryBroker() *InMemoryBroker {
+	return &InMemoryBroker{listeners: make(map[*listener]bool)}
+}
+
+// Publish delivers payload to the listening buses
+func (b *InMemoryBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	b.mu.Lock()
+	listeners := make([]*listener, 0, len(b.listeners))
+	for l := range b.listeners {
+		listeners = append(listeners, l)
+	}
+	b.mu.Unlock()
+
+	for _, l := range listeners {
+		l.handle(Message{Topic: topic, Payload: append([]byte(nil), payload...)})
+	}
+	return nil
+}
+
+// Listen passes the messages published to handle until ctx is done or Disconnect is called
+func (b *InMemoryBroker) Listen(ctx context.Context, subscribed func(), handle func(Message)) error {
+	l := &listener{handle: handle, failed: make(chan struct{})}
+	b.mu.Lock()
+	b.listeners[l] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.listeners, l)
+		b.mu.Unlock()
+	}()
+
+	subscribed()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.failed:
+		return errors.New("connection lost")
+	}
+}
+
+// Disconnect fails the current Listen calls, dropping messages until the buses resubscribe,
+// like a lost connection
+func (b *InMemoryBroker) Disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for l := range b.listeners {
+		delete(b.listeners, l)
+		close(l.failed)
+	}
+}
@@ -0,0 +1,56 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// channelPrefix prefixes the Redis channels of topics
+const channelPrefix = "pubsub:"
+
+// RedisBroker implements Broker with Redis Pub/Sub, publishing each topic on its own channel
+type RedisBroker struct {
+	client *redis.Client
+}
+
+// NewRedisBroker creates a new Redis broker
+func NewRedisBroker(client *redis.Client) *RedisBroker {
+	return &RedisBroker{client: client}
+}
+
+// Publish publishes payload on topic's channel
+func (b *RedisBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	if err := b.client.Publish(ctx, channelPrefix+topic, payload).Err(); err != nil {
+		return fmt.Errorf("error publishing message: %w", err)
+	}
+	return nil
+}
+
+// Listen subscribes to the channels of every topic and passes their messages to handle
+// until ctx is done or the connection fails
+func (b *RedisBroker) Listen(ctx context.Context, subscribed func(), handle func(Message)) error {
+	pubsub := b.client.PSubscribe(ctx, channelPrefix+"*")
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed, so messages published from then on are received
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("error subscribing: %w", err)
+	}
+	subscribed()
+
+	for {
+		// go-redis resubscribes on its own after a connection error, but messages published
+		// in between are lost, so the error is returned for the bus to resync subscribers
+		message, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("error receiving message: %w", err)
+		}
+		handle(Message{
+			Topic:   strings.TrimPrefix(message.Channel, channelPrefix),
+			Payload: []byte(message.Payload),
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/pubsub"
+)
+
+// startBus runs a bus over broker until the test ends
+func startBus(t *testing.T, broker pubsub.Broker) *pubsub.Bus {
+	t.Helper()
+
+	bus := pubsub.NewBus(broker, metrics.NewRegistry(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bus.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return bus
+}
+
+// subscribe subscribes to topic, returning the messages received
+func subscribe(bus *pubsub.Bus, topic string) (<-chan pubsub.Message, func()) {
+	messages := make(chan pubsub.Message, 16)
+	unsubscribe := bus.Subscribe(topic, func(message pubsub.Message) {
+		messages <- message
+	})
+	return messages, unsubscribe
+}
+
+// next receives the next message, failing the test if none arrives in time
+func next(t *testing.T, messages <-chan pubsub.Message) pubsub.Message {
+	t.Helper()
+
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+		return pubsub.Message{}
+	}
+}
+
+// skipResync receives the resync message sent once the bus has subscribed to the broker
+func skipResync(t *testing.T, messages <-chan pubsub.Message) {
+	t.Helper()
+
+	if message := next(t, messages); !message.Resync {
+		t.Fatalf("expected resync message, got %+v", message)
+	}
+}
+
+func TestBusDeliversToEveryInstance(t *testing.T) {
+	ctx := context.Background()
+	broker := pubsub.NewInMemoryBroker()
+	first := startBus(t, broker)
+	second := startBus(t, broker)
+
+	firstMessages, _ := subscribe(first, "phone_lists")
+	secondMessages, _ := subscribe(second, "phone_lists")
+	otherMessages, _ := subscribe(second, "login_status:challenge")
+	skipResync(t, firstMessages)
+	skipResync(t, secondMessages)
+	skipResync(t, otherMessages)
+
+	if err := first.Publish(ctx, "phone_lists", []byte("changed")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	for _, messages := range []<-chan pubsub.Message{firstMessages, secondMessages} {
+		if message := next(t, messages); message.Topic != "phone_lists" || string(message.Payload) != "changed" || message.Resync {
+			t.Fatalf("unexpected message %+v", message)
+		}
+	}
+	select {
+	case message := <-otherMessages:
+		t.Fatalf("expected no message on another topic, got %+v", message)
+	default:
+	}
+}
+
+func TestBusUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	bus := startBus(t, pubsub.NewInMemoryBroker())
+
+	messages, unsubscribe := subscribe(bus, "phone_lists")
+	skipResync(t, messages)
+	unsubscribe()
+	unsubscribe()
+
+	if err := bus.Publish(ctx, "phone_lists", nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case message := <-messages:
+		t.Fatalf("expected no message after unsubscribing, got %+v", message)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestBusResyncsAfterReconnecting(t *testing.T) {
+	ctx := context.Background()
+	broker := pubsub.NewInMemoryBroker()
+	bus := startBus(t, broker)
+
+	messages, _ := subscribe(bus, "phone_lists")
+	skipResync(t, messages)
+
+	// Messages published while disconnected are lost, so subscribers are told to resync
+	broker.Disconnect()
+	broker.Publish(ctx, "phone_lists", []byte("missed"))
+	if message := next(t, messages); !message.Resync || message.Topic != "phone_lists" {
+		t.Fatalf("expected resync message after reconnecting, got %+v", message)
+	}
+
+	if err := bus.Publish(ctx, "phone_lists", []byte("after")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if message := next(t, messages); string(message.Payload) != "after" {
+		t.Fatalf("expected messages after reconnecting, got %+v", message)
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/canary"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// canaryKeyPrefix keeps the keys of the canary limiter apart from the stable limiter's, as
+// algorithms store their state differently
+const canaryKeyPrefix = "canary:"
+
+// Outcomes of rate limit decisions, as counted per variant
+const (
+	outcomeAllowed = "allowed"
+	outcomeLimited = "limited"
+	outcomeError   = "error"
+)
+
+// CanaryLimiter checks the hits of requests routed to the canary variant with a canary limiter,
+// e.g. one running another algorithm, and all other hits with the stable limiter, counting the
+// decisions of each so the two can be compared
+type CanaryLimiter struct {
+	variants  *canary.Variants[Limiter]
+	decisions *metrics.CounterVec
+}
+
+// NewCanaryLimiter creates a canary limiter, exporting the decisions of each variant to registry
+func NewCanaryLimiter(stable, canaryLimiter Limiter, registry *metrics.Registry) *CanaryLimiter {
+	return &CanaryLimiter{
+		variants:  canary.NewVariants(stable).WithCanary(canaryLimiter),
+		decisions: registry.CounterVec("ratelimit_decisions_total", "Rate limit decisions, by variant and outcome.", "variant", "outcome"),
+	}
+}
+
+// Allow records a hit for key with the limiter of the request's variant and reports whether it is within limit
+func (l *CanaryLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	limiter, variant := l.variants.Pick(ctx)
+	result, err := limiter.Allow(ctx, variantKey(variant, key), limit, window)
+	switch {
+	case err != nil:
+		l.decisions.With(variant, outcomeError).Inc()
+	case result.Allowed:
+		l.decisions.With(variant, outcomeAllowed).Inc()
+	default:
+		l.decisions.With(variant, outcomeLimited).Inc()
+	}
+	return result, err
+}
+
+// Peek reports the current state of key with the limiter of the request's variant without recording a hit
+func (l *CanaryLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	limiter, variant := l.variants.Pick(ctx)
+	return limiter.Peek(ctx, variantKey(variant, key), limit, window)
+}
+
+// Reset clears all hits recorded for key by both limiters
+func (l *CanaryLimiter) Reset(ctx context.Context, key string) error {
+	if err := l.variants.Stable().Reset(ctx, key); err != nil {
+		return err
+	}
+	canaryLimiter, _ := l.variants.Canary()
+	return canaryLimiter.Reset(ctx, variantKey(canary.Canary, key))
+}
+
+// variantKey returns the key hits for key are recorded under by the limiter of variant
+func variantKey(variant, key string) string {
+	if variant == canary.Canary {
+		return canaryKeyPrefix + key
+	}
+	return key
+}
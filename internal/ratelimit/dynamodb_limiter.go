@@ -0,0 +1,294 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/lilokie/otp-auth/internal/dynamodb"
+)
+
+// rateLimitSortKey is the sort key of rate limit records in DynamoDB
+const rateLimitSortKey = "rate_limit"
+
+// NewDynamoDBLimiter creates a DynamoDB-backed limiter for the given algorithm, keeping its
+// records in table; an empty algorithm selects the fixed window
+func NewDynamoDBLimiter(client *dynamodb.Client, table, algorithm string) (Limiter, error) {
+	switch algorithm {
+	case "", AlgorithmFixedWindow:
+		return NewDynamoDBFixedWindowLimiter(client, table), nil
+	case AlgorithmSlidingWindow:
+		return NewDynamoDBSlidingWindowLimiter(client, table), nil
+	case AlgorithmTokenBucket:
+		return NewDynamoDBTokenBucketLimiter(client, table), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm: %s", algorithm)
+	}
+}
+
+// getDynamoDBRecord returns the rate limit record of key, or nil if there is none
+func getDynamoDBRecord(ctx context.Context, client *dynamodb.Client, table, key string) (map[string]types.AttributeValue, error) {
+	output, err := client.GetItem(ctx, &awsdynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            dynamodb.Key(key, rateLimitSortKey),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Item, nil
+}
+
+// resetDynamoDBRecord deletes the rate limit record of key
+func resetDynamoDBRecord(ctx context.Context, client *dynamodb.Client, table, key string) error {
+	_, err := client.DeleteItem(ctx, &awsdynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key:       dynamodb.Key(key, rateLimitSortKey),
+	})
+	if err != nil {
+		return fmt.Errorf("error resetting rate limit: %w", err)
+	}
+	return nil
+}
+
+// DynamoDBFixedWindowLimiter implements Limiter with fixed-window counters in DynamoDB
+type DynamoDBFixedWindowLimiter struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoDBFixedWindowLimiter creates a new DynamoDB fixed-window limiter
+func NewDynamoDBFixedWindowLimiter(client *dynamodb.Client, table string) *DynamoDBFixedWindowLimiter {
+	return &DynamoDBFixedWindowLimiter{client: client, table: table}
+}
+
+// Allow atomically records a hit for key and reports whether it is within limit
+func (l *DynamoDBFixedWindowLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	for attempt := 0; attempt < dynamodb.MaxAttempts; attempt++ {
+		now := time.Now()
+
+		// Count the hit in the running window...
+		output, err := l.client.UpdateItem(ctx, &awsdynamodb.UpdateItemInput{
+			TableName:                 aws.String(l.table),
+			Key:                       dynamodb.Key(key, rateLimitSortKey),
+			UpdateExpression:          aws.String("ADD #count :one"),
+			ConditionExpression:       aws.String("expires_at > :now"),
+			ExpressionAttributeNames:  map[string]string{"#count": "count"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":one": dynamodb.Number(1), ":now": dynamodb.Number(now.UnixMilli())},
+			ReturnValues:              types.ReturnValueAllNew,
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if err == nil {
+			counted := output.Attributes
+			resetIn := time.Duration(dynamodb.IntOf(counted, "expires_at")-now.UnixMilli()) * time.Millisecond
+			return l.result(dynamodb.IntOf(counted, "count"), limit, resetIn, true), nil
+		}
+		if !errors.As(err, &conditionErr) {
+			return nil, fmt.Errorf("error incrementing rate limit: %w", err)
+		}
+
+		// ...or start a window, unless a concurrent hit just did
+		expiresAt := now.Add(window)
+		item := dynamodb.Key(key, rateLimitSortKey)
+		item["count"] = dynamodb.Number(1)
+		item["expires_at"] = dynamodb.Number(expiresAt.UnixMilli())
+		item[dynamodb.TTLAttribute] = dynamodb.TTL(expiresAt)
+		_, err = l.client.PutItem(ctx, &awsdynamodb.PutItemInput{
+			TableName:                 aws.String(l.table),
+			Item:                      item,
+			ConditionExpression:       aws.String("attribute_not_exists(pk) OR expires_at <= :now"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":now": dynamodb.Number(now.UnixMilli())},
+		})
+		if err == nil {
+			return l.result(1, limit, window, true), nil
+		}
+		if !errors.As(err, &conditionErr) {
+			return nil, fmt.Errorf("error incrementing rate limit: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("error incrementing rate limit: %w", dynamodb.ErrContention)
+}
+
+// Peek reports the current state of key without recording a hit
+func (l *DynamoDBFixedWindowLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	item, err := getDynamoDBRecord(ctx, l.client, l.table, key)
+	if err != nil {
+		return nil, fmt.Errorf("error checking rate limit: %w", err)
+	}
+
+	now := time.Now()
+	if len(item) == 0 || dynamodb.IntOf(item, "expires_at") <= now.UnixMilli() {
+		return newResult(limit > 0, 0, limit, 0, 0), nil
+	}
+	resetIn := time.Duration(dynamodb.IntOf(item, "expires_at")-now.UnixMilli()) * time.Millisecond
+	return l.result(dynamodb.IntOf(item, "count"), limit, resetIn, false), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *DynamoDBFixedWindowLimiter) Reset(ctx context.Context, key string) error {
+	return resetDynamoDBRecord(ctx, l.client, l.table, key)
+}
+
+// result builds the result for a window counting count hits, including the current one if counted
+func (l *DynamoDBFixedWindowLimiter) result(count int64, limit int, resetIn time.Duration, counted bool) *Result {
+	allowed := count < int64(limit)
+	if counted {
+		allowed = count <= int64(limit)
+	}
+	var retryAfter time.Duration
+	if !allowed {
+		retryAfter = resetIn
+	}
+	return newResult(allowed, count, limit, resetIn, retryAfter)
+}
+
+// DynamoDBSlidingWindowLimiter implements Limiter with a sliding window log in DynamoDB.
+// The log is updated by read-modify-write, so it suits keys hit at moderate rates.
+type DynamoDBSlidingWindowLimiter struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoDBSlidingWindowLimiter creates a new DynamoDB sliding-window limiter
+func NewDynamoDBSlidingWindowLimiter(client *dynamodb.Client, table string) *DynamoDBSlidingWindowLimiter {
+	return &DynamoDBSlidingWindowLimiter{client: client, table: table}
+}
+
+// Allow atomically records a hit for key and reports whether it is within limit
+func (l *DynamoDBSlidingWindowLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	var result *Result
+	err := l.client.Modify(ctx, l.table, dynamodb.Key(key, rateLimitSortKey), func(current map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		now := time.Now()
+		hits := inWindow(decodeHits(dynamodb.StringOf(current, "hits")), now, window)
+
+		allowed := len(hits) < limit
+		if allowed {
+			hits = append(hits, now)
+		}
+		result = slidingResult(hits, limit, now, window, allowed)
+		if !allowed {
+			return nil, nil
+		}
+
+		expiresAt := now.Add(window)
+		return map[string]types.AttributeValue{
+			"hits":                dynamodb.String(encodeHits(hits)),
+			"expires_at":          dynamodb.Number(expiresAt.UnixMilli()),
+			dynamodb.TTLAttribute: dynamodb.TTL(expiresAt),
+		}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error recording rate limit hit: %w", err)
+	}
+	return result, nil
+}
+
+// Peek reports the current state of key without recording a hit
+func (l *DynamoDBSlidingWindowLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	item, err := getDynamoDBRecord(ctx, l.client, l.table, key)
+	if err != nil {
+		return nil, fmt.Errorf("error checking rate limit: %w", err)
+	}
+
+	now := time.Now()
+	hits := inWindow(decodeHits(dynamodb.StringOf(item, "hits")), now, window)
+	return slidingResult(hits, limit, now, window, len(hits) < limit), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *DynamoDBSlidingWindowLimiter) Reset(ctx context.Context, key string) error {
+	return resetDynamoDBRecord(ctx, l.client, l.table, key)
+}
+
+// encodeHits encodes a sliding window log as comma-separated Unix milliseconds
+func encodeHits(hits []time.Time) string {
+	values := make([]string, len(hits))
+	for i, hit := range hits {
+		values[i] = strconv.FormatInt(hit.UnixMilli(), 10)
+	}
+	return strings.Join(values, ",")
+}
+
+// decodeHits decodes a sliding window log encoded by encodeHits
+func decodeHits(s string) []time.Time {
+	if s == "" {
+		return nil
+	}
+	values := strings.Split(s, ",")
+	hits := make([]time.Time, 0, len(values))
+	for _, value := range values {
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			hits = append(hits, time.UnixMilli(ms))
+		}
+	}
+	return hits
+}
+
+// DynamoDBTokenBucketLimiter implements Limiter with token buckets in DynamoDB.
+// A bucket holds up to limit tokens and refills at limit tokens per window.
+type DynamoDBTokenBucketLimiter struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoDBTokenBucketLimiter creates a new DynamoDB token-bucket limiter
+func NewDynamoDBTokenBucketLimiter(client *dynamodb.Client, table string) *DynamoDBTokenBucketLimiter {
+	return &DynamoDBTokenBucketLimiter{client: client, table: table}
+}
+
+// Allow atomically takes a token for key and reports whether one was available
+func (l *DynamoDBTokenBucketLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	var result *Result
+	err := l.client.Modify(ctx, l.table, dynamodb.Key(key, rateLimitSortKey), func(current map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		now := time.Now()
+		bucket := decodeBucket(current, limit, now)
+		result = takeToken(bucket, limit, window, now, true)
+		if !result.Allowed {
+			// Refilling is derived from the stored state, so a denied hit changes nothing
+			return nil, nil
+		}
+
+		return map[string]types.AttributeValue{
+			"tokens":              dynamodb.Float(bucket.tokens),
+			"updated_at":          dynamodb.Number(bucket.updatedAt.UnixMilli()),
+			dynamodb.TTLAttribute: dynamodb.TTL(bucket.fullAt),
+		}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	return result, nil
+}
+
+// Peek reports the current state of key without taking a token
+func (l *DynamoDBTokenBucketLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	item, err := getDynamoDBRecord(ctx, l.client, l.table, key)
+	if err != nil {
+		return nil, fmt.Errorf("error checking rate limit: %w", err)
+	}
+
+	now := time.Now()
+	return takeToken(decodeBucket(item, limit, now), limit, window, now, false), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *DynamoDBTokenBucketLimiter) Reset(ctx context.Context, key string) error {
+	return resetDynamoDBRecord(ctx, l.client, l.table, key)
+}
+
+// decodeBucket reads a token bucket record, or returns a full bucket if there is none
+func decodeBucket(item map[string]types.AttributeValue, limit int, now time.Time) *tokenBucket {
+	if len(item) == 0 {
+		return &tokenBucket{tokens: float64(limit), updatedAt: now}
+	}
+	return &tokenBucket{
+		tokens:    dynamodb.FloatOf(item, "tokens"),
+		updatedAt: time.UnixMilli(dynamodb.IntOf(item, "updated_at")),
+	}
+}
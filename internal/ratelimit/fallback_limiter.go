@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// Failure policies, deciding what happens to hits while the limiter backing a policy fails
+const (
+	FailClosed = "closed" // the error is returned and the request rejected
+	FailOpen   = "open"   // hits are allowed without being counted
+	FailLocal  = "local"  // hits are counted by an in-process limiter, per instance
+)
+
+// FallbackLimiter checks hits with a limiter and, while it fails, with a local in-process
+// limiter or, without one, allows them. Falling back and recovering are logged once each.
+type FallbackLimiter struct {
+	limiter   Limiter
+	local     Limiter
+	policy    string
+	failing   atomic.Bool
+	fallbacks metrics.Counter
+	logger    *slog.Logger
+}
+
+// NewFallbackLimiter wraps limiter so its failures fall back to local, or fail open if local
+// is nil, exporting the hits that fell back to registry
+func NewFallbackLimiter(limiter, local Limiter, registry *metrics.Registry, logger *slog.Logger) *FallbackLimiter {
+	policy := FailLocal
+	if local == nil {
+		policy = FailOpen
+	}
+	return &FallbackLimiter{
+		limiter: limiter,
+		local:   local,
+		policy:  policy,
+		fallbacks: registry.CounterVec("ratelimit_fallbacks_total",
+			"Rate limit checks that fell back because the rate limiter failed, by failure policy.", "policy").With(policy),
+		logger: logger,
+	}
+}
+
+// Allow records a hit for key and reports whether it is within limit
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	result, err := l.limiter.Allow(ctx, key, limit, window)
+	if err == nil {
+		l.recovered()
+		return result, nil
+	}
+	l.fellBack(err)
+	if l.local == nil {
+		return openResult(limit, window), nil
+	}
+	return l.local.Allow(ctx, key, limit, window)
+}
+
+// Peek reports the current state of key without recording a hit
+func (l *FallbackLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	result, err := l.limiter.Peek(ctx, key, limit, window)
+	if err == nil {
+		l.recovered()
+		return result, nil
+	}
+	l.fellBack(err)
+	if l.local == nil {
+		return openResult(limit, window), nil
+	}
+	return l.local.Peek(ctx, key, limit, window)
+}
+
+// Reset clears all hits recorded for key by both limiters. It fails if the limiter does, as
+// the hits it keeps count again once it is back.
+func (l *FallbackLimiter) Reset(ctx context.Context, key string) error {
+	if l.local != nil {
+		if err := l.local.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return l.limiter.Reset(ctx, key)
+}
+
+// fellBack counts a check that fell back, logging the first one since the limiter last worked
+func (l *FallbackLimiter) fellBack(err error) {
+	l.fallbacks.Inc()
+	if l.failing.CompareAndSwap(false, true) {
+		l.logger.Warn("Rate limiter failing, falling back", "policy", l.policy, "error", err)
+	}
+}
+
+// recovered logs that the limiter works again after falling back
+func (l *FallbackLimiter) recovered() {
+	if l.failing.CompareAndSwap(true, false) {
+		l.logger.Info("Rate limiter recovered", "policy", l.policy)
+	}
+}
+
+// openResult is the result of a hit allowed without being counted
+func openResult(limit int, window time.Duration) *Result {
+	return &Result{Allowed: true, Limit: limit, Remaining: limit, ResetIn: window}
+}
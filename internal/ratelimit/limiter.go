@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Rate limiting algorithms
+const (
+	AlgorithmFixedWindow   = "fixed_window"
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmTokenBucket   = "token_bucket"
+)
+
+// Key prefixes shared by everything that reads or resets rate limit counters
+const (
+	ipKeyPrefix       = "rate_limit:ip:"
+	phoneKeyPrefix    = "rate_limit:"
+	otpIPKeyPrefix    = "rate_limit:otp:ip:"
+	otpPhoneKeyPrefix = "rate_limit:otp:phone:"
+	captchaKeyPrefix  = "rate_limit:captcha:ip:"
+	policyKeyPrefix   = "rate_limit:policy:"
+)
+
+// IPKey returns the key used to rate limit all requests from an IP address
+func IPKey(ip string) string {
+	return ipKeyPrefix + ip
+}
+
+// PhoneKey returns the key used by the OTP service to rate limit OTP generation for a phone number
+func PhoneKey(phoneNumber string) string {
+	return phoneKeyPrefix + phoneNumber
+}
+
+// OTPIPKey returns the key used to rate limit OTP requests from an IP address
+func OTPIPKey(ip string) string {
+	return otpIPKeyPrefix + ip
+}
+
+// OTPPhoneKey returns the key used to rate limit OTP requests for a phone number
+func OTPPhoneKey(phoneNumber string) string {
+	return otpPhoneKeyPrefix + phoneNumber
+}
+
+// CaptchaIPKey returns the key used to count the OTP requests from an IP address towards the CAPTCHA threshold
+func CaptchaIPKey(ip string) string {
+	return captchaKeyPrefix + ip
+}
+
+// PolicyKey returns the key used by the configured rate limit policy named policy to count
+// the hits of the client identified by id
+func PolicyKey(policy, id string) string {
+	return policyKeyPrefix + policy + ":" + id
+}
+
+// Result describes the state of a rate limit key after a check
+type Result struct {
+	Allowed    bool
+	Count      int64         // hits counted against the limit
+	Limit      int           // maximum hits allowed
+	Remaining  int           // hits left before being limited
+	ResetIn    time.Duration // time until the key is back to its initial state
+	RetryAfter time.Duration // time until the next hit would be allowed, zero if it already would be
+}
+
+// Limiter defines the interface for rate limiting algorithms
+type Limiter interface {
+	// Allow atomically records a hit for key and reports whether it is within limit
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error)
+
+	// Peek reports the current state of key without recording a hit
+	Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error)
+
+	// Reset clears all hits recorded for key
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy binds a limiter to a limit and window. The limit and window can be updated while
+// the policy is in use, e.g. when the configuration is reloaded.
+type Policy struct {
+	Limiter Limiter
+
+	mu     sync.RWMutex
+	limit  int
+	window time.Duration
+}
+
+// NewPolicy creates a new policy
+func NewPolicy(limiter Limiter, limit int, window time.Duration) *Policy {
+	return &Policy{
+		Limiter: limiter,
+		limit:   limit,
+		window:  window,
+	}
+}
+
+// Limits returns the policy's current limit and window
+func (p *Policy) Limits() (int, time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.limit, p.window
+}
+
+// Update changes the policy's limit and window; hits already recorded count against the new limit
+func (p *Policy) Update(limit int, window time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limit = limit
+	p.window = window
+}
+
+// Allow records a hit for key and reports whether it is within the policy
+func (p *Policy) Allow(ctx context.Context, key string) (*Result, error) {
+	limit, window := p.Limits()
+	return p.Limiter.Allow(ctx, key, limit, window)
+}
+
+// Peek reports the current state of key under the policy without recording a hit
+func (p *Policy) Peek(ctx context.Context, key string) (*Result, error) {
+	limit, window := p.Limits()
+	return p.Limiter.Peek(ctx, key, limit, window)
+}
+
+// Reset clears all hits recorded for key
+func (p *Policy) Reset(ctx context.Context, key string) error {
+	return p.Limiter.Reset(ctx, key)
+}
+
+// newResult builds a Result, deriving Remaining from count and limit
+func newResult(allowed bool, count int64, limit int, resetIn, retryAfter time.Duration) *Result {
+	remaining := limit - int(count)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if resetIn < 0 {
+		resetIn = 0
+	}
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return &Result{
+		Allowed:    allowed,
+		Count:      count,
+		Limit:      limit,
+		Remaining:  remaining,
+		ResetIn:    resetIn,
+		RetryAfter: retryAfter,
+	}
+}
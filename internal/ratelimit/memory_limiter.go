@@ -0,0 +1,320 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how many hits a memory limiter records between evictions of expired keys
+const sweepInterval = 1024
+
+// NewMemoryLimiter creates an in-memory limiter for the given algorithm;
+// an empty algorithm selects the fixed window
+func NewMemoryLimiter(algorithm string) (Limiter, error) {
+	switch algorithm {
+	case "", AlgorithmFixedWindow:
+		return NewMemoryFixedWindowLimiter(), nil
+	case AlgorithmSlidingWindow:
+		return NewMemorySlidingWindowLimiter(), nil
+	case AlgorithmTokenBucket:
+		return NewMemoryTokenBucketLimiter(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm: %s", algorithm)
+	}
+}
+
+// memoryStore is a mutex-guarded map of per-key limiter state with periodic eviction.
+// Memory limiters are intended for tests and single-instance deployments.
+type memoryStore[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*T
+	hits    int
+	expired func(entry *T, now time.Time) bool
+}
+
+func newMemoryStore[T any](expired func(entry *T, now time.Time) bool) memoryStore[T] {
+	return memoryStore[T]{
+		entries: make(map[string]*T),
+		expired: expired,
+	}
+}
+
+// hit counts a recorded hit and evicts expired keys every sweepInterval hits;
+// callers must hold s.mu
+func (s *memoryStore[T]) hit(now time.Time) {
+	s.hits++
+	if s.hits%sweepInterval != 0 {
+		return
+	}
+	for key, entry := range s.entries {
+		if s.expired(entry, now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// reset removes key
+func (s *memoryStore[T]) reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+}
+
+// fixedWindow is the state of a key in MemoryFixedWindowLimiter
+type fixedWindow struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryFixedWindowLimiter implements Limiter with fixed-window counters in process memory
+type MemoryFixedWindowLimiter struct {
+	store memoryStore[fixedWindow]
+}
+
+// NewMemoryFixedWindowLimiter creates a new in-memory fixed-window limiter
+func NewMemoryFixedWindowLimiter() *MemoryFixedWindowLimiter {
+	return &MemoryFixedWindowLimiter{
+		store: newMemoryStore(func(w *fixedWindow, now time.Time) bool {
+			return !now.Before(w.expiresAt)
+		}),
+	}
+}
+
+// Allow atomically records a hit for key and reports whether it is within limit
+func (l *MemoryFixedWindowLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	now := time.Now()
+	l.store.hit(now)
+
+	w, ok := l.store.entries[key]
+	if !ok || l.store.expired(w, now) {
+		w = &fixedWindow{expiresAt: now.Add(window)}
+		l.store.entries[key] = w
+	}
+	w.count++
+
+	return l.result(w, limit, now, w.count <= int64(limit)), nil
+}
+
+// Peek reports the current state of key without recording a hit
+func (l *MemoryFixedWindowLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.store.entries[key]
+	if !ok || l.store.expired(w, now) {
+		return newResult(limit > 0, 0, limit, 0, 0), nil
+	}
+
+	return l.result(w, limit, now, w.count < int64(limit)), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *MemoryFixedWindowLimiter) Reset(ctx context.Context, key string) error {
+	l.store.reset(key)
+	return nil
+}
+
+func (l *MemoryFixedWindowLimiter) result(w *fixedWindow, limit int, now time.Time, allowed bool) *Result {
+	resetIn := w.expiresAt.Sub(now)
+	var retryAfter time.Duration
+	if !allowed {
+		retryAfter = resetIn
+	}
+	return newResult(allowed, w.count, limit, resetIn, retryAfter)
+}
+
+// slidingLog is the state of a key in MemorySlidingWindowLimiter
+type slidingLog struct {
+	hits      []time.Time
+	expiresAt time.Time
+}
+
+// MemorySlidingWindowLimiter implements Limiter with a sliding window log in process memory
+type MemorySlidingWindowLimiter struct {
+	store memoryStore[slidingLog]
+}
+
+// NewMemorySlidingWindowLimiter creates a new in-memory sliding-window limiter
+func NewMemorySlidingWindowLimiter() *MemorySlidingWindowLimiter {
+	return &MemorySlidingWindowLimiter{
+		store: newMemoryStore(func(log *slidingLog, now time.Time) bool {
+			return !now.Before(log.expiresAt)
+		}),
+	}
+}
+
+// Allow atomically records a hit for key and reports whether it is within limit
+func (l *MemorySlidingWindowLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	now := time.Now()
+	l.store.hit(now)
+
+	log, ok := l.store.entries[key]
+	if !ok {
+		log = &slidingLog{}
+		l.store.entries[key] = log
+	}
+	log.hits = inWindow(log.hits, now, window)
+
+	allowed := len(log.hits) < limit
+	if allowed {
+		log.hits = append(log.hits, now)
+		log.expiresAt = now.Add(window)
+	}
+
+	return slidingResult(log.hits, limit, now, window, allowed), nil
+}
+
+// Peek reports the current state of key without recording a hit
+func (l *MemorySlidingWindowLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	now := time.Now()
+	var hits []time.Time
+	if log, ok := l.store.entries[key]; ok {
+		hits = inWindow(log.hits, now, window)
+	}
+
+	return slidingResult(hits, limit, now, window, len(hits) < limit), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *MemorySlidingWindowLimiter) Reset(ctx context.Context, key string) error {
+	l.store.reset(key)
+	return nil
+}
+
+// inWindow drops hits that are no longer inside the window ending at now
+func inWindow(hits []time.Time, now time.Time, window time.Duration) []time.Time {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
+
+// slidingResult builds the result for a sliding window log ordered oldest first
+func slidingResult(hits []time.Time, limit int, now time.Time, window time.Duration, allowed bool) *Result {
+	count := len(hits)
+	if count == 0 {
+		return newResult(allowed, 0, limit, 0, 0)
+	}
+
+	resetIn := hits[count-1].Add(window).Sub(now)
+	var retryAfter time.Duration
+	if !allowed {
+		// The next hit is allowed once enough of the oldest hits leave the window
+		index := count - limit
+		if index > count-1 {
+			index = count - 1
+		}
+		retryAfter = hits[index].Add(window).Sub(now)
+	}
+	return newResult(allowed, int64(count), limit, resetIn, retryAfter)
+}
+
+// tokenBucket is the state of a key in MemoryTokenBucketLimiter
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+// MemoryTokenBucketLimiter implements Limiter with token buckets in process memory.
+// A bucket holds up to limit tokens and refills at limit tokens per window.
+type MemoryTokenBucketLimiter struct {
+	store memoryStore[tokenBucket]
+}
+
+// NewMemoryTokenBucketLimiter creates a new in-memory token-bucket limiter
+func NewMemoryTokenBucketLimiter() *MemoryTokenBucketLimiter {
+	return &MemoryTokenBucketLimiter{
+		store: newMemoryStore(func(b *tokenBucket, now time.Time) bool {
+			return !now.Before(b.fullAt)
+		}),
+	}
+}
+
+// Allow atomically takes a token for key and reports whether one was available
+func (l *MemoryTokenBucketLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	now := time.Now()
+	l.store.hit(now)
+
+	bucket, ok := l.store.entries[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit), updatedAt: now}
+		l.store.entries[key] = bucket
+	}
+
+	return takeToken(bucket, limit, window, now, true), nil
+}
+
+// Peek reports the current state of key without taking a token
+func (l *MemoryTokenBucketLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.store.entries[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit), updatedAt: now}
+	} else {
+		copied := *bucket
+		bucket = &copied
+	}
+
+	return takeToken(bucket, limit, window, now, false), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *MemoryTokenBucketLimiter) Reset(ctx context.Context, key string) error {
+	l.store.reset(key)
+	return nil
+}
+
+// takeToken refills bucket up to now and, if consume is set, takes a token from it
+func takeToken(bucket *tokenBucket, limit int, window time.Duration, now time.Time, consume bool) *Result {
+	if limit <= 0 || window <= 0 {
+		return newResult(false, 0, limit, 0, window)
+	}
+
+	// Tokens per nanosecond
+	rate := float64(limit) / float64(window)
+
+	elapsed := now.Sub(bucket.updatedAt)
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(limit), bucket.tokens+float64(elapsed)*rate)
+	}
+	bucket.updatedAt = now
+
+	allowed := bucket.tokens >= 1
+	if allowed && consume {
+		bucket.tokens--
+	}
+
+	resetIn := time.Duration(math.Ceil((float64(limit) - bucket.tokens) / rate))
+	bucket.fullAt = now.Add(resetIn)
+
+	var retryAfter time.Duration
+	if !allowed {
+		retryAfter = time.Duration(math.Ceil((1 - bucket.tokens) / rate))
+	}
+
+	remaining := int64(math.Floor(bucket.tokens))
+	return newResult(allowed, int64(limit)-remaining, limit, resetIn, retryAfter)
+}
@@ -0,0 +1,330 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// NewRedisLimiter creates a Redis-backed limiter for the given algorithm;
+// an empty algorithm selects the fixed window
+func NewRedisLimiter(client *redis.Client, algorithm string) (Limiter, error) {
+	switch algorithm {
+	case "", AlgorithmFixedWindow:
+		return NewRedisFixedWindowLimiter(client), nil
+	case AlgorithmSlidingWindow:
+		return NewRedisSlidingWindowLimiter(client), nil
+	case AlgorithmTokenBucket:
+		return NewRedisTokenBucketLimiter(client), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm: %s", algorithm)
+	}
+}
+
+// fixedWindowScript increments the counter and (re)applies the window TTL in one step,
+// so concurrent callers can neither lose increments nor leave a key without expiry.
+// Returns {count, ttl_ms}.
+var fixedWindowScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`)
+
+// fixedWindowPeekScript reads the counter and its TTL. Returns {count, ttl_ms}.
+var fixedWindowPeekScript = redis.NewScript(`
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+local ttl = redis.call("PTTL", KEYS[1])
+return {count, ttl}
+`)
+
+// slidingWindowScript keeps a log of hit timestamps in a sorted set, drops entries
+// older than the window and records the hit only if the log is below the limit.
+// ARGV: now_ms, window_ms, limit, member. Returns {allowed, count, reset_ms, retry_ms}.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+if count == 0 then
+	return {allowed, 0, 0, 0}
+end
+redis.call("PEXPIRE", KEYS[1], window)
+
+local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+local reset = tonumber(newest[2]) + window - now
+local retry = 0
+if allowed == 0 then
+	local index = math.min(count - limit, count - 1)
+	local blocking = redis.call("ZRANGE", KEYS[1], index, index, "WITHSCORES")
+	retry = tonumber(blocking[2]) + window - now
+end
+return {allowed, count, reset, retry}
+`)
+
+// slidingWindowPeekScript counts the hits still inside the window without modifying the log.
+// ARGV: now_ms, window_ms, limit. Returns {count, reset_ms, retry_ms}.
+var slidingWindowPeekScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local min = "(" .. (now - window)
+
+local count = redis.call("ZCOUNT", KEYS[1], min, "+inf")
+if count == 0 then
+	return {0, 0, 0}
+end
+
+local newest = redis.call("ZREVRANGEBYSCORE", KEYS[1], "+inf", min, "WITHSCORES", "LIMIT", 0, 1)
+local reset = tonumber(newest[2]) + window - now
+local retry = 0
+if count >= limit then
+	local index = math.min(count - limit, count - 1)
+	local blocking = redis.call("ZRANGEBYSCORE", KEYS[1], min, "+inf", "WITHSCORES", "LIMIT", index, 1)
+	retry = tonumber(blocking[2]) + window - now
+end
+return {count, reset, retry}
+`)
+
+// tokenBucketScript refills a bucket of capacity limit at limit tokens per window
+// and takes one token if available. State is dropped once the bucket would be full again.
+// ARGV: now_ms, window_ms, limit, consume (1 or 0). Returns {allowed, remaining, reset_ms, retry_ms}.
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local consume = tonumber(ARGV[4])
+if limit <= 0 or window <= 0 then
+	return {0, 0, 0, window}
+end
+local rate = limit / window
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = limit
+	ts = now
+end
+tokens = math.min(limit, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	allowed = 1
+	if consume == 1 then
+		tokens = tokens - 1
+	end
+end
+
+local reset = math.ceil((limit - tokens) / rate)
+local retry = 0
+if allowed == 0 then
+	retry = math.ceil((1 - tokens) / rate)
+end
+if consume == 1 then
+	redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+	redis.call("PEXPIRE", KEYS[1], reset + 1)
+end
+return {allowed, math.floor(tokens), reset, retry}
+`)
+
+// redisScripts lists every script used by the Redis limiters
+var redisScripts = []*redis.Script{
+	fixedWindowScript,
+	fixedWindowPeekScript,
+	slidingWindowScript,
+	slidingWindowPeekScript,
+	tokenBucketScript,
+}
+
+// LoadScripts loads the Redis limiter scripts into the script cache,
+// so the first rate limit checks don't fall back from EVALSHA to EVAL
+func LoadScripts(ctx context.Context, client *redis.Client) error {
+	for _, script := range redisScripts {
+		if err := script.Load(ctx, client).Err(); err != nil {
+			return fmt.Errorf("error loading rate limit script: %w", err)
+		}
+	}
+	return nil
+}
+
+// redisScriptResult runs a script and returns its integer array reply
+func redisScriptResult(ctx context.Context, client *redis.Client, script *redis.Script, key string, want int, args ...interface{}) ([]int64, error) {
+	values, err := script.Run(ctx, client, []string{key}, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != want {
+		return nil, fmt.Errorf("unexpected rate limit script result: %v", values)
+	}
+	return values, nil
+}
+
+// nowMillis returns the current time in Unix milliseconds
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// RedisFixedWindowLimiter implements Limiter with fixed-window counters in Redis
+type RedisFixedWindowLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisFixedWindowLimiter creates a new Redis fixed-window limiter
+func NewRedisFixedWindowLimiter(client *redis.Client) *RedisFixedWindowLimiter {
+	return &RedisFixedWindowLimiter{client: client}
+}
+
+// Allow atomically records a hit for key and reports whether it is within limit
+func (l *RedisFixedWindowLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	values, err := redisScriptResult(ctx, l.client, fixedWindowScript, key, 2, window.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("error incrementing rate limit: %w", err)
+	}
+
+	count, resetIn := values[0], time.Duration(values[1])*time.Millisecond
+	allowed := count <= int64(limit)
+	var retryAfter time.Duration
+	if !allowed {
+		retryAfter = resetIn
+	}
+	return newResult(allowed, count, limit, resetIn, retryAfter), nil
+}
+
+// Peek reports the current state of key without recording a hit
+func (l *RedisFixedWindowLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	values, err := redisScriptResult(ctx, l.client, fixedWindowPeekScript, key, 2)
+	if err != nil {
+		return nil, fmt.Errorf("error checking rate limit: %w", err)
+	}
+
+	count, resetIn := values[0], time.Duration(values[1])*time.Millisecond
+	allowed := count < int64(limit)
+	var retryAfter time.Duration
+	if !allowed {
+		retryAfter = resetIn
+	}
+	return newResult(allowed, count, limit, resetIn, retryAfter), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *RedisFixedWindowLimiter) Reset(ctx context.Context, key string) error {
+	return resetRedisKey(ctx, l.client, key)
+}
+
+// RedisSlidingWindowLimiter implements Limiter with a sliding window log in Redis.
+// Unlike fixed windows it cannot be burst at window boundaries.
+type RedisSlidingWindowLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisSlidingWindowLimiter creates a new Redis sliding-window limiter
+func NewRedisSlidingWindowLimiter(client *redis.Client) *RedisSlidingWindowLimiter {
+	return &RedisSlidingWindowLimiter{client: client}
+}
+
+// Allow atomically records a hit for key and reports whether it is within limit
+func (l *RedisSlidingWindowLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	now := nowMillis()
+	member := strconv.FormatInt(now, 10) + "-" + strconv.FormatInt(rand.Int63(), 36)
+
+	values, err := redisScriptResult(ctx, l.client, slidingWindowScript, key, 4, now, window.Milliseconds(), limit, member)
+	if err != nil {
+		return nil, fmt.Errorf("error recording rate limit hit: %w", err)
+	}
+
+	return newResult(
+		values[0] == 1,
+		values[1],
+		limit,
+		time.Duration(values[2])*time.Millisecond,
+		time.Duration(values[3])*time.Millisecond,
+	), nil
+}
+
+// Peek reports the current state of key without recording a hit
+func (l *RedisSlidingWindowLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	values, err := redisScriptResult(ctx, l.client, slidingWindowPeekScript, key, 3, nowMillis(), window.Milliseconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error checking rate limit: %w", err)
+	}
+
+	return newResult(
+		values[0] < int64(limit),
+		values[0],
+		limit,
+		time.Duration(values[1])*time.Millisecond,
+		time.Duration(values[2])*time.Millisecond,
+	), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *RedisSlidingWindowLimiter) Reset(ctx context.Context, key string) error {
+	return resetRedisKey(ctx, l.client, key)
+}
+
+// RedisTokenBucketLimiter implements Limiter with token buckets in Redis.
+// A bucket holds up to limit tokens and refills at limit tokens per window.
+type RedisTokenBucketLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisTokenBucketLimiter creates a new Redis token-bucket limiter
+func NewRedisTokenBucketLimiter(client *redis.Client) *RedisTokenBucketLimiter {
+	return &RedisTokenBucketLimiter{client: client}
+}
+
+// Allow atomically takes a token for key and reports whether one was available
+func (l *RedisTokenBucketLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	return l.run(ctx, key, limit, window, 1)
+}
+
+// Peek reports the current state of key without taking a token
+func (l *RedisTokenBucketLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	return l.run(ctx, key, limit, window, 0)
+}
+
+// run executes the token bucket script, consuming a token if consume is 1
+func (l *RedisTokenBucketLimiter) run(ctx context.Context, key string, limit int, window time.Duration, consume int) (*Result, error) {
+	values, err := redisScriptResult(ctx, l.client, tokenBucketScript, key, 4, nowMillis(), window.Milliseconds(), limit, consume)
+	if err != nil {
+		return nil, fmt.Errorf("error checking rate limit: %w", err)
+	}
+
+	remaining := values[1]
+	return newResult(
+		values[0] == 1,
+		int64(limit)-remaining,
+		limit,
+		time.Duration(values[2])*time.Millisecond,
+		time.Duration(values[3])*time.Millisecond,
+	), nil
+}
+
+// Reset clears all hits recorded for key
+func (l *RedisTokenBucketLimiter) Reset(ctx context.Context, key string) error {
+	return resetRedisKey(ctx, l.client, key)
+}
+
+// resetRedisKey deletes a rate limit key
+func resetRedisKey(ctx context.Context, client *redis.Client, key string) error {
+	if err := client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("error resetting rate limit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/sharding"
+)
+
+// ShardedLimiter spreads rate limit keys across several limiters, typically one per Redis shard.
+// Each key is always checked by the limiter of the shard it routes to, so its hits are counted in one place.
+type ShardedLimiter struct {
+	router   *sharding.Router
+	limiters []Limiter
+}
+
+// NewShardedLimiter creates a sharded limiter; limiters are in the router's shard order
+func NewShardedLimiter(router *sharding.Router, limiters []Limiter) *ShardedLimiter {
+	return &ShardedLimiter{router: router, limiters: limiters}
+}
+
+// Allow records a hit for key on its shard and reports whether it is within limit
+func (l *ShardedLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	return l.limiters[l.router.Route(key)].Allow(ctx, key, limit, window)
+}
+
+// Peek reports the current state of key on its shard without recording a hit
+func (l *ShardedLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	return l.limiters[l.router.Route(key)].Peek(ctx, key, limit, window)
+}
+
+// Reset clears all hits recorded for key on its shard
+func (l *ShardedLimiter) Reset(ctx context.Context, key string) error {
+	return l.limiters[l.router.Route(key)].Reset(ctx, key)
+}
@@ -0,0 +1,540 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/canary"
+	"github.com/lilokie/otp-auth/internal/dynamodb"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
+	"github.com/lilokie/otp-auth/internal/sharding"
+)
+
+var algorithms = []string{
+	ratelimit.AlgorithmFixedWindow,
+	ratelimit.AlgorithmSlidingWindow,
+	ratelimit.AlgorithmTokenBucket,
+}
+
+// limiters returns the limiter implementations under test for each algorithm.
+// Redis limiters are only included when REDIS_ADDR points to a reachable Redis instance, and
+// DynamoDB limiters when DYNAMODB_ENDPOINT and DYNAMODB_TABLE name a table, e.g. in DynamoDB Local.
+func limiters(t *testing.T, algorithms ...string) map[string]ratelimit.Limiter {
+	t.Helper()
+
+	var client *redis.Client
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		client = redis.NewClient(&redis.Options{Addr: addr})
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			t.Logf("skipping redis limiters: %v", err)
+			client.Close()
+			client = nil
+		} else {
+			t.Cleanup(func() { client.Close() })
+		}
+	}
+
+	var dynamoClient *dynamodb.Client
+	table := os.Getenv("DYNAMODB_TABLE")
+	if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" && table != "" {
+		var err error
+		t.Setenv("AWS_ACCESS_KEY_ID", "local")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "local")
+		if dynamoClient, err = dynamodb.NewClient(context.Background(), "us-east-1", endpoint, time.Second); err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+	}
+
+	result := make(map[string]ratelimit.Limiter)
+	for _, algorithm := range algorithms {
+		limiter, err := ratelimit.NewMemoryLimiter(algorithm)
+		if err != nil {
+			t.Fatalf("NewMemoryLimiter: %v", err)
+		}
+		result["memory/"+algorithm] = limiter
+
+		if client != nil {
+			limiter, err := ratelimit.NewRedisLimiter(client, algorithm)
+			if err != nil {
+				t.Fatalf("NewRedisLimiter: %v", err)
+			}
+			result["redis/"+algorithm] = limiter
+		}
+
+		if dynamoClient != nil {
+			limiter, err := ratelimit.NewDynamoDBLimiter(dynamoClient, table, algorithm)
+			if err != nil {
+				t.Fatalf("NewDynamoDBLimiter: %v", err)
+			}
+			result["dynamodb/"+algorithm] = limiter
+		}
+	}
+
+	return result
+}
+
+func testKey() string {
+	return "rate_limit:test:" + uuid.NewString()
+}
+
+func TestLimiterAllowsUpToLimit(t *testing.T) {
+	for name, limiter := range limiters(t, algorithms...) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := testKey()
+			defer limiter.Reset(ctx, key)
+
+			for i := 1; i <= 3; i++ {
+				res, err := limiter.Allow(ctx, key, 3, time.Minute)
+				if err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+				if !res.Allowed {
+					t.Fatalf("hit %d: expected allowed", i)
+				}
+				if res.Remaining != 3-i {
+					t.Fatalf("hit %d: expected remaining %d, got %d", i, 3-i, res.Remaining)
+				}
+				if res.ResetIn <= 0 || res.ResetIn > time.Minute {
+					t.Fatalf("hit %d: unexpected reset %v", i, res.ResetIn)
+				}
+			}
+
+			res, err := limiter.Allow(ctx, key, 3, time.Minute)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if res.Allowed {
+				t.Fatal("expected fourth hit to be rejected")
+			}
+
+			if res.RetryAfter <= 0 {
+				t.Fatalf("expected retry after on rejected hit, got %v", res.RetryAfter)
+			}
+
+			peek, err := limiter.Peek(ctx, key, 3, time.Minute)
+			if err != nil {
+				t.Fatalf("Peek: %v", err)
+			}
+			if peek.Allowed || peek.Remaining != 0 {
+				t.Fatalf("unexpected peek result: %+v", peek)
+			}
+		})
+	}
+}
+
+func TestLimiterWindowExpires(t *testing.T) {
+	for name, limiter := range limiters(t, algorithms...) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := testKey()
+			defer limiter.Reset(ctx, key)
+
+			if _, err := limiter.Allow(ctx, key, 1, 50*time.Millisecond); err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			res, err := limiter.Allow(ctx, key, 1, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if res.Allowed {
+				t.Fatal("expected second hit in window to be rejected")
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			res, err = limiter.Allow(ctx, key, 1, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if !res.Allowed {
+				t.Fatal("expected hit in new window to be allowed")
+			}
+		})
+	}
+}
+
+func TestFixedWindowCountsRejectedHits(t *testing.T) {
+	for name, limiter := range limiters(t, ratelimit.AlgorithmFixedWindow) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := testKey()
+			defer limiter.Reset(ctx, key)
+
+			for i := 0; i < 4; i++ {
+				if _, err := limiter.Allow(ctx, key, 3, time.Minute); err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+			}
+
+			peek, err := limiter.Peek(ctx, key, 3, time.Minute)
+			if err != nil {
+				t.Fatalf("Peek: %v", err)
+			}
+			if peek.Count != 4 {
+				t.Fatalf("expected 4 recorded hits, got %d", peek.Count)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowPreventsBoundaryBurst(t *testing.T) {
+	const window = 200 * time.Millisecond
+
+	for name, limiter := range limiters(t, ratelimit.AlgorithmSlidingWindow) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := testKey()
+			defer limiter.Reset(ctx, key)
+
+			for i := 0; i < 2; i++ {
+				res, err := limiter.Allow(ctx, key, 2, window)
+				if err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+				if !res.Allowed {
+					t.Fatalf("hit %d: expected allowed", i+1)
+				}
+			}
+
+			// A fixed window started at the first hit would have rolled over by
+			// now; the sliding window still holds both hits.
+			time.Sleep(window / 2)
+
+			res, err := limiter.Allow(ctx, key, 2, window)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if res.Allowed {
+				t.Fatal("expected hit inside sliding window to be rejected")
+			}
+			if res.Count != 2 {
+				t.Fatalf("expected rejected hit not to be recorded, got count %d", res.Count)
+			}
+			if res.RetryAfter <= 0 || res.RetryAfter > window {
+				t.Fatalf("unexpected retry after %v", res.RetryAfter)
+			}
+
+			time.Sleep(res.RetryAfter + 20*time.Millisecond)
+
+			res, err = limiter.Allow(ctx, key, 2, window)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if !res.Allowed {
+				t.Fatal("expected hit to be allowed once the oldest hit left the window")
+			}
+		})
+	}
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	const window = 200 * time.Millisecond
+
+	for name, limiter := range limiters(t, ratelimit.AlgorithmTokenBucket) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := testKey()
+			defer limiter.Reset(ctx, key)
+
+			for i := 0; i < 4; i++ {
+				if _, err := limiter.Allow(ctx, key, 4, window); err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+			}
+			res, err := limiter.Allow(ctx, key, 4, window)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if res.Allowed {
+				t.Fatal("expected empty bucket to reject hit")
+			}
+
+			// One token refills every window/4
+			time.Sleep(window/4 + 20*time.Millisecond)
+
+			res, err = limiter.Allow(ctx, key, 4, window)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if !res.Allowed {
+				t.Fatal("expected refilled token to be allowed")
+			}
+			res, err = limiter.Allow(ctx, key, 4, window)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if res.Allowed {
+				t.Fatal("expected only one token to have refilled")
+			}
+		})
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	if _, err := ratelimit.NewMemoryLimiter("leaky_bucket"); err == nil {
+		t.Fatal("expected error for unknown algorithm")
+	}
+}
+
+func TestLimiterConcurrentCallers(t *testing.T) {
+	const (
+		limit   = 10
+		callers = 100
+	)
+
+	for name, limiter := range limiters(t, algorithms...) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := testKey()
+			defer limiter.Reset(ctx, key)
+
+			var (
+				wg      sync.WaitGroup
+				allowed int64
+				start   = make(chan struct{})
+			)
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					res, err := limiter.Allow(ctx, key, limit, time.Minute)
+					if err != nil {
+						t.Errorf("Allow: %v", err)
+						return
+					}
+					if res.Allowed {
+						atomic.AddInt64(&allowed, 1)
+					}
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			if allowed != limit {
+				t.Fatalf("expected exactly %d allowed hits, got %d", limit, allowed)
+			}
+
+			peek, err := limiter.Peek(ctx, key, limit, time.Minute)
+			if err != nil {
+				t.Fatalf("Peek: %v", err)
+			}
+			if peek.Allowed {
+				t.Fatalf("expected key to stay limited, got %+v", peek)
+			}
+			if peek.ResetIn <= 0 {
+				t.Fatal("expected key to keep its expiry under concurrency")
+			}
+		})
+	}
+}
+
+func TestLimiterReset(t *testing.T) {
+	for name, limiter := range limiters(t, algorithms...) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := testKey()
+
+			if _, err := limiter.Allow(ctx, key, 1, time.Minute); err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if err := limiter.Reset(ctx, key); err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+
+			res, err := limiter.Allow(ctx, key, 1, time.Minute)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if !res.Allowed {
+				t.Fatal("expected hit after reset to be allowed")
+			}
+		})
+	}
+}
+
+func TestShardedLimiterCountsEachKeyOnItsShard(t *testing.T) {
+	ctx := context.Background()
+	router, err := sharding.NewRouter([]string{"eu-1", "eu-2"})
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	shards := make([]ratelimit.Limiter, router.Len())
+	for i := range shards {
+		if shards[i], err = ratelimit.NewMemoryLimiter(ratelimit.AlgorithmFixedWindow); err != nil {
+			t.Fatalf("NewMemoryLimiter: %v", err)
+		}
+	}
+	limiter := ratelimit.NewShardedLimiter(router, shards)
+
+	key := ratelimit.PhoneKey("+989121234567")
+	for i := 0; i < 3; i++ {
+		if _, err := limiter.Allow(ctx, key, 2, time.Minute); err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+	}
+
+	// All hits landed on the key's shard; the other shard has never seen it
+	home, other := shards[router.Route(key)], shards[1-router.Route(key)]
+	if result, _ := home.Peek(ctx, key, 2, time.Minute); result.Count != 3 || result.Allowed {
+		t.Fatalf("expected 3 hits over the limit on the key's shard, got %+v", result)
+	}
+	if result, _ := other.Peek(ctx, key, 2, time.Minute); result.Count != 0 {
+		t.Fatalf("expected no hits on the other shard, got %+v", result)
+	}
+
+	if err := limiter.Reset(ctx, key); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if result, _ := limiter.Peek(ctx, key, 2, time.Minute); result.Count != 0 {
+		t.Fatalf("expected the key to be reset, got %+v", result)
+	}
+}
+
+func TestPolicyUpdateAppliesNewLimit(t *testing.T) {
+	limiter, err := ratelimit.NewMemoryLimiter(ratelimit.AlgorithmFixedWindow)
+	if err != nil {
+		t.Fatalf("NewMemoryLimiter: %v", err)
+	}
+	policy := ratelimit.NewPolicy(limiter, 1, time.Minute)
+	ctx := context.Background()
+	key := testKey()
+
+	if res, err := policy.Allow(ctx, key); err != nil || !res.Allowed {
+		t.Fatalf("first hit: res=%+v err=%v", res, err)
+	}
+	if res, err := policy.Allow(ctx, key); err != nil || res.Allowed {
+		t.Fatalf("expected second hit to be denied: res=%+v err=%v", res, err)
+	}
+
+	policy.Update(3, time.Hour)
+	if limit, window := policy.Limits(); limit != 3 || window != time.Hour {
+		t.Fatalf("Limits = %d, %v; want 3, 1h", limit, window)
+	}
+	if res, err := policy.Allow(ctx, key); err != nil || !res.Allowed {
+		t.Fatalf("expected hit under raised limit to be allowed: res=%+v err=%v", res, err)
+	}
+}
+
+func TestCanaryLimiterKeepsVariantsApart(t *testing.T) {
+	ctx := context.Background()
+	canaryCtx := canary.NewContext(ctx, canary.Canary)
+	stable, err := ratelimit.NewMemoryLimiter(ratelimit.AlgorithmFixedWindow)
+	if err != nil {
+		t.Fatalf("NewMemoryLimiter: %v", err)
+	}
+	canaryLimiter, err := ratelimit.NewMemoryLimiter(ratelimit.AlgorithmTokenBucket)
+	if err != nil {
+		t.Fatalf("NewMemoryLimiter: %v", err)
+	}
+	registry := metrics.NewRegistry()
+	limiter := ratelimit.NewCanaryLimiter(stable, canaryLimiter, registry)
+
+	// Hits of one variant don't count against the other
+	for i := 0; i < 2; i++ {
+		if result, err := limiter.Allow(ctx, "key", 2, time.Minute); err != nil || !result.Allowed {
+			t.Fatalf("expected stable hit %d allowed, got %+v (%v)", i+1, result, err)
+		}
+	}
+	if result, err := limiter.Allow(canaryCtx, "key", 2, time.Minute); err != nil || !result.Allowed {
+		t.Fatalf("expected the canary hit allowed, got %+v (%v)", result, err)
+	}
+	if result, err := limiter.Allow(ctx, "key", 2, time.Minute); err != nil || result.Allowed {
+		t.Fatalf("expected the third stable hit limited, got %+v (%v)", result, err)
+	}
+
+	var out strings.Builder
+	registry.WriteTo(&out)
+	for _, series := range []string{
+		`ratelimit_decisions_total{outcome="allowed",variant="stable"} 2`,
+		`ratelimit_decisions_total{outcome="limited",variant="stable"} 1`,
+		`ratelimit_decisions_total{outcome="allowed",variant="canary"} 1`,
+	} {
+		if !strings.Contains(out.String(), series) {
+			t.Fatalf("expected %s in metrics:\n%s", series, out.String())
+		}
+	}
+
+	// Reset clears both variants
+	if err := limiter.Reset(ctx, "key"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if result, err := limiter.Peek(ctx, "key", 2, time.Minute); err != nil || result.Count != 0 {
+		t.Fatalf("expected stable hits reset, got %+v (%v)", result, err)
+	}
+	if result, err := limiter.Peek(canaryCtx, "key", 2, time.Minute); err != nil || result.Remaining != 2 {
+		t.Fatalf("expected canary hits reset, got %+v (%v)", result, err)
+	}
+}
+
+// downLimiter is a limiter that fails while down is set, like one whose store is unreachable
+type downLimiter struct {
+	ratelimit.Limiter
+	down atomic.Bool
+}
+
+func (l *downLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*ratelimit.Result, error) {
+	if l.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return l.Limiter.Allow(ctx, key, limit, window)
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	ctx := context.Background()
+	newStore := func() *downLimiter {
+		store, _ := ratelimit.NewMemoryLimiter(ratelimit.AlgorithmFixedWindow)
+		return &downLimiter{Limiter: store}
+	}
+
+	// Failing open allows every hit while the store is down
+	store := newStore()
+	registry := metrics.NewRegistry()
+	limiter := ratelimit.NewFallbackLimiter(store, nil, registry, logging.Discard())
+	store.down.Store(true)
+	for i := 0; i < 3; i++ {
+		if result, err := limiter.Allow(ctx, "key", 1, time.Minute); err != nil || !result.Allowed {
+			t.Fatalf("expected hit %d allowed while failing open, got %+v (%v)", i+1, result, err)
+		}
+	}
+
+	// Falling back locally keeps counting hits while the store is down
+	store = newStore()
+	local, _ := ratelimit.NewMemoryLimiter(ratelimit.AlgorithmFixedWindow)
+	limiter = ratelimit.NewFallbackLimiter(store, local, registry, logging.Discard())
+	store.down.Store(true)
+	if result, err := limiter.Allow(ctx, "key", 1, time.Minute); err != nil || !result.Allowed {
+		t.Fatalf("expected the first local hit allowed, got %+v (%v)", result, err)
+	}
+	if result, err := limiter.Allow(ctx, "key", 1, time.Minute); err != nil || result.Allowed {
+		t.Fatalf("expected the second local hit limited, got %+v (%v)", result, err)
+	}
+
+	// Once the store is back, its own counts apply again
+	store.down.Store(false)
+	if result, err := limiter.Allow(ctx, "key", 1, time.Minute); err != nil || !result.Allowed {
+		t.Fatalf("expected the store's first hit allowed, got %+v (%v)", result, err)
+	}
+
+	var out strings.Builder
+	registry.WriteTo(&out)
+	for _, series := range []string{
+		`ratelimit_fallbacks_total{policy="open"} 3`,
+		`ratelimit_fallbacks_total{policy="local"} 2`,
+	} {
+		if !strings.Contains(out.String(), series) {
+			t.Fatalf("expected %s in metrics:\n%s", series, out.String())
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// BreakerUserRepository runs every operation of a UserRepository through a circuit breaker
+type BreakerUserRepository struct {
+	repo    UserRepository
+	breaker *concurrency.CircuitBreaker
+}
+
+// NewBreakerUserRepository wraps repo with breaker
+func NewBreakerUserRepository(repo UserRepository, breaker *concurrency.CircuitBreaker) *BreakerUserRepository {
+	return &BreakerUserRepository{repo: repo, breaker: breaker}
+}
+
+// Create creates a new user
+func (r *BreakerUserRepository) Create(ctx context.Context, phoneNumber string) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.Create(ctx, phoneNumber)
+		return err
+	})
+	return user, err
+}
+
+// FindOrCreateByPhoneNumber returns the user with a phone number, creating them if there is none
+func (r *BreakerUserRepository) FindOrCreateByPhoneNumber(ctx context.Context, phoneNumber string) (user *models.User, created bool, err error) {
+	err = r.breaker.Do(func() error {
+		user, created, err = r.repo.FindOrCreateByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return user, created, err
+}
+
+// CreateImported creates a user brought in from another system
+func (r *BreakerUserRepository) CreateImported(ctx context.Context, phoneNumber string, phoneVerified bool, verifiedSource *string) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.CreateImported(ctx, phoneNumber, phoneVerified, verifiedSource)
+		return err
+	})
+	return user, err
+}
+
+// MarkPhoneVerified records that a user's phone number was verified by source
+func (r *BreakerUserRepository) MarkPhoneVerified(ctx context.Context, id uuid.UUID, source string) error {
+	return r.breaker.Do(func() error {
+		return r.repo.MarkPhoneVerified(ctx, id, source)
+	})
+}
+
+// SetRole sets the role of a user
+func (r *BreakerUserRepository) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	return r.breaker.Do(func() error {
+		return r.repo.SetRole(ctx, id, role)
+	})
+}
+
+// SetAnalyticsConsent sets whether a user consents to analytics
+func (r *BreakerUserRepository) SetAnalyticsConsent(ctx context.Context, id uuid.UUID, consent bool) error {
+	return r.breaker.Do(func() error {
+		return r.repo.SetAnalyticsConsent(ctx, id, consent)
+	})
+}
+
+// Stats counts active users by phone verification status and source
+func (r *BreakerUserRepository) Stats(ctx context.Context) (stats *models.UserStats, err error) {
+	err = r.breaker.Do(func() error {
+		stats, err = r.repo.Stats(ctx)
+		return err
+	})
+	return stats, err
+}
+
+// FindByID finds a user by ID
+func (r *BreakerUserRepository) FindByID(ctx context.Context, id uuid.UUID) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.FindByID(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+// FindByPhoneNumber finds a user by phone number
+func (r *BreakerUserRepository) FindByPhoneNumber(ctx context.Context, phoneNumber string) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.FindByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return user, err
+}
+
+// List returns a list of users with pagination and search
+func (r *BreakerUserRepository) List(ctx context.Context, params models.PaginationParams) (users []models.User, totalCount int64, err error) {
+	err = r.breaker.Do(func() error {
+		users, totalCount, err = r.repo.List(ctx, params)
+		return err
+	})
+	return users, totalCount, err
+}
+
+// Update updates a user
+func (r *BreakerUserRepository) Update(ctx context.Context, user *models.User) error {
+	return r.breaker.Do(func() error {
+		return r.repo.Update(ctx, user)
+	})
+}
+
+// UpdateProfile sets the profile fields of a user given in update, leaving the others unchanged
+func (r *BreakerUserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, update models.UpdateProfileRequest) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.UpdateProfile(ctx, id, update)
+		return err
+	})
+	return user, err
+}
+
+// UpdateMetadata sets the metadata keys of a user given with a value and removes those given with nil
+func (r *BreakerUserRepository) UpdateMetadata(ctx context.Context, id uuid.UUID, update map[string]*string) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.UpdateMetadata(ctx, id, update)
+		return err
+	})
+	return user, err
+}
+
+// Delete soft-deletes a user
+func (r *BreakerUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.breaker.Do(func() error {
+		return r.repo.Delete(ctx, id)
+	})
+}
+
+// FindDeletedByID finds a soft-deleted user by ID
+func (r *BreakerUserRepository) FindDeletedByID(ctx context.Context, id uuid.UUID) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.FindDeletedByID(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+// FindDeletedByPhoneNumber finds a soft-deleted user by phone number
+func (r *BreakerUserRepository) FindDeletedByPhoneNumber(ctx context.Context, phoneNumber string) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.FindDeletedByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return user, err
+}
+
+// Restore un-deletes a user that was soft-deleted after deletedAfter
+func (r *BreakerUserRepository) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (user *models.User, err error) {
+	err = r.breaker.Do(func() error {
+		user, err = r.repo.Restore(ctx, id, deletedAfter)
+		return err
+	})
+	return user, err
+}
+
+// Purge permanently deletes the users soft-deleted before deletedBefore
+func (r *BreakerUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (ids []uuid.UUID, err error) {
+	err = r.breaker.Do(func() error {
+		ids, err = r.repo.Purge(ctx, deletedBefore)
+		return err
+	})
+	return ids, err
+}
+
+// BreakerOTPRepository runs every operation of an OTPRepository through a circuit breaker
+type BreakerOTPRepository struct {
+	repo    OTPRepository
+	breaker *concurrency.CircuitBreaker
+}
+
+// NewBreakerOTPRepository wraps repo with breaker
+func NewBreakerOTPRepository(repo OTPRepository, breaker *concurrency.CircuitBreaker) *BreakerOTPRepository {
+	return &BreakerOTPRepository{repo: repo, breaker: breaker}
+}
+
+// StoreChallenge stores an OTP challenge with expiration
+func (r *BreakerOTPRepository) StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error {
+	return r.breaker.Do(func() error {
+		return r.repo.StoreChallenge(ctx, challenge, expiration)
+	})
+}
+
+// GetChallenge retrieves a pending OTP challenge by ID
+func (r *BreakerOTPRepository) GetChallenge(ctx context.Context, id string) (challenge *models.OTPChallenge, err error) {
+	err = r.breaker.Do(func() error {
+		challenge, err = r.repo.GetChallenge(ctx, id)
+		return err
+	})
+	return challenge, err
+}
+
+// GetLatestChallenge retrieves the most recently issued pending OTP challenge for a phone number
+func (r *BreakerOTPRepository) GetLatestChallenge(ctx context.Context, phoneNumber string) (challenge *models.OTPChallenge, err error) {
+	err = r.breaker.Do(func() error {
+		challenge, err = r.repo.GetLatestChallenge(ctx, phoneNumber)
+		return err
+	})
+	return challenge, err
+}
+
+// DeleteChallenge deletes an OTP challenge
+func (r *BreakerOTPRepository) DeleteChallenge(ctx context.Context, challenge *models.OTPChallenge) error {
+	return r.breaker.Do(func() error {
+		return r.repo.DeleteChallenge(ctx, challenge)
+	})
+}
+
+// DeleteChallengesByPhone deletes all pending OTP challenges for a phone number
+func (r *BreakerOTPRepository) DeleteChallengesByPhone(ctx context.Context, phoneNumber string) (deleted int64, err error) {
+	err = r.breaker.Do(func() error {
+		deleted, err = r.repo.DeleteChallengesByPhone(ctx, phoneNumber)
+		return err
+	})
+	return deleted, err
+}
+
+// DeleteChallengesByPrefix deletes all pending OTP challenges for phone numbers starting with prefix
+func (r *BreakerOTPRepository) DeleteChallengesByPrefix(ctx context.Context, prefix string) (deleted int64, err error) {
+	err = r.breaker.Do(func() error {
+		deleted, err = r.repo.DeleteChallengesByPrefix(ctx, prefix)
+		return err
+	})
+	return deleted, err
+}
+
+// AcquireResendCooldown starts a resend cooldown for a phone number unless one is running,
+// returning the remaining time of the running cooldown or zero if it was started
+func (r *BreakerOTPRepository) AcquireResendCooldown(ctx context.Context, phoneNumber string, cooldown time.Duration) (remaining time.Duration, err error) {
+	err = r.breaker.Do(func() error {
+		remaining, err = r.repo.AcquireResendCooldown(ctx, phoneNumber, cooldown)
+		return err
+	})
+	return remaining, err
+}
+
+// GetLockout returns the verification lockout state for a phone number
+func (r *BreakerOTPRepository) GetLockout(ctx context.Context, phoneNumber string) (state *models.LockoutState, err error) {
+	err = r.breaker.Do(func() error {
+		state, err = r.repo.GetLockout(ctx, phoneNumber)
+		return err
+	})
+	return state, err
+}
+
+// RecordFailedVerification counts a failed verification for a phone number and locks it
+// for cooldown once maxAttempts failures happened within window
+func (r *BreakerOTPRepository) RecordFailedVerification(ctx context.Context, phoneNumber string, maxAttempts int, window, cooldown time.Duration) (state *models.LockoutState, err error) {
+	err = r.breaker.Do(func() error {
+		state, err = r.repo.RecordFailedVerification(ctx, phoneNumber, maxAttempts, window, cooldown)
+		return err
+	})
+	return state, err
+}
+
+// ClearFailedVerifications resets the failed verification count and lockout for a phone number
+func (r *BreakerOTPRepository) ClearFailedVerifications(ctx context.Context, phoneNumber string) error {
+	return r.breaker.Do(func() error {
+		return r.repo.ClearFailedVerifications(ctx, phoneNumber)
+	})
+}
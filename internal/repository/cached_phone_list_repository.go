@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/pubsub"
+)
+
+// phoneListTopic is the pub/sub topic notifying instances of changes to the phone lists
+const phoneListTopic = "phone_lists"
+
+// CachedPhoneListRepository decorates a PhoneListRepository, matching phone numbers against
+// an in-memory copy of the lists instead of querying them on every OTP request. Changes made
+// through any instance are published on the pub/sub bus, and every instance reloads its
+// copy on the next match.
+type CachedPhoneListRepository struct {
+	PhoneListRepository
+	bus *pubsub.Bus
+
+	load       sync.Mutex // serializes reloads
+	mu         sync.Mutex // guards the copy
+	entries    []models.PhoneListEntry
+	valid      bool
+	generation uint64 // incremented by each invalidation
+}
+
+// NewCachedPhoneListRepository creates a new cached phone list repository, subscribing
+// to changes on bus
+func NewCachedPhoneListRepository(repo PhoneListRepository, bus *pubsub.Bus) *CachedPhoneListRepository {
+	r := &CachedPhoneListRepository{PhoneListRepository: repo, bus: bus}
+	// Changes and resyncs alike only invalidate the copy, so handling them never blocks
+	bus.Subscribe(phoneListTopic, func(pubsub.Message) { r.invalidate() })
+	return r
+}
+
+// Add puts a prefix on a list, reporting whether it was added or on the list already
+func (r *CachedPhoneListRepository) Add(ctx context.Context, entry *models.PhoneListEntry) (bool, error) {
+	added, err := r.PhoneListRepository.Add(ctx, entry)
+	if err != nil || !added {
+		return added, err
+	}
+	return true, r.notify(ctx)
+}
+
+// Remove takes a prefix off a list, reporting whether it was on the list
+func (r *CachedPhoneListRepository) Remove(ctx context.Context, list, prefix string) (bool, error) {
+	removed, err := r.PhoneListRepository.Remove(ctx, list, prefix)
+	if err != nil || !removed {
+		return removed, err
+	}
+	return true, r.notify(ctx)
+}
+
+// Match returns the entries of both lists whose prefix phoneNumber starts with
+func (r *CachedPhoneListRepository) Match(ctx context.Context, phoneNumber string) ([]models.PhoneListEntry, error) {
+	all, ok := r.cached()
+	if !ok {
+		var err error
+		if all, err = r.reload(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// The copy is ordered by list and prefix like List, so matches are too
+	entries := []models.PhoneListEntry{}
+	for _, entry := range all {
+		if strings.HasPrefix(phoneNumber, entry.Prefix) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// cached returns the copy of the lists, if it is valid
+func (r *CachedPhoneListRepository) cached() ([]models.PhoneListEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.entries, r.valid
+}
+
+// reload loads the lists, keeping them as the copy unless it was invalidated meanwhile
+func (r *CachedPhoneListRepository) reload(ctx context.Context) ([]models.PhoneListEntry, error) {
+	r.load.Lock()
+	defer r.load.Unlock()
+
+	// Another match may have reloaded the lists while this one waited
+	if entries, ok := r.cached(); ok {
+		return entries, nil
+	}
+
+	r.mu.Lock()
+	generation := r.generation
+	r.mu.Unlock()
+
+	entries, err := r.PhoneListRepository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation == generation {
+		r.entries = entries
+		r.valid = true
+	}
+	return entries, nil
+}
+
+// notify invalidates the copy of every instance after a change to the lists. This instance's
+// copy is invalidated right away, so its own changes apply to the next match.
+func (r *CachedPhoneListRepository) notify(ctx context.Context) error {
+	r.invalidate()
+	if err := r.bus.Publish(ctx, phoneListTopic, nil); err != nil {
+		return fmt.Errorf("error notifying phone list change: %w", err)
+	}
+	return nil
+}
+
+// invalidate drops the copy of the lists, reloading them on the next match
+func (r *CachedPhoneListRepository) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = nil
+	r.valid = false
+	r.generation++
+}
@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/lilokie/otp-auth/internal/dynamodb"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// Sort keys of the single-item DynamoDB records; a phone number's challenge index entries are
+// sorted by issue time instead, so they can be queried newest first
+const (
+	challengeSortKey = "otp_challenge"
+	cooldownSortKey  = "otp_cooldown"
+	failuresSortKey  = "otp_failures"
+)
+
+// DynamoDBOTPRepository implements OTPRepository using DynamoDB. Every record carries its
+// expiry in expires_at (Unix milliseconds), which reads check, as DynamoDB TTL only removes
+// expired items eventually. Each challenge is stored under its ID with an index entry under
+// its phone number, in the same key layout as RedisOTPRepository.
+type DynamoDBOTPRepository struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoDBOTPRepository creates a new DynamoDB OTP repository storing its records in table
+func NewDynamoDBOTPRepository(client *dynamodb.Client, table string) *DynamoDBOTPRepository {
+	return &DynamoDBOTPRepository{client: client, table: table}
+}
+
+// expired reports whether a record read from DynamoDB has expired at now
+func expired(item map[string]types.AttributeValue, now time.Time) bool {
+	return len(item) == 0 || dynamodb.IntOf(item, "expires_at") <= now.UnixMilli()
+}
+
+// StoreChallenge stores an OTP challenge with expiration
+func (r *DynamoDBOTPRepository) StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return fmt.Errorf("error encoding OTP challenge: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(expiration)
+	// Zero-padded so index entries sort by issue time
+	indexSortKey := fmt.Sprintf("%020d#%s", now.UnixNano(), challenge.ID)
+
+	// The index entry goes first: one left behind by a failed store is skipped like an expired one
+	index := dynamodb.Key(phoneChallengesKeyPrefix+challenge.PhoneNumber, indexSortKey)
+	index["challenge_id"] = dynamodb.String(challenge.ID)
+	index["expires_at"] = dynamodb.Number(expiresAt.UnixMilli())
+	index[dynamodb.TTLAttribute] = dynamodb.TTL(expiresAt)
+	if _, err := r.client.PutItem(ctx, &awsdynamodb.PutItemInput{TableName: aws.String(r.table), Item: index}); err != nil {
+		return fmt.Errorf("error storing OTP challenge: %w", err)
+	}
+
+	item := dynamodb.Key(challengeKeyPrefix+challenge.ID, challengeSortKey)
+	item["data"] = dynamodb.String(string(data))
+	item["index_sk"] = dynamodb.String(indexSortKey)
+	item["expires_at"] = dynamodb.Number(expiresAt.UnixMilli())
+	item[dynamodb.TTLAttribute] = dynamodb.TTL(expiresAt)
+	if _, err := r.client.PutItem(ctx, &awsdynamodb.PutItemInput{TableName: aws.String(r.table), Item: item}); err != nil {
+		return fmt.Errorf("error storing OTP challenge: %w", err)
+	}
+	return nil
+}
+
+// GetChallenge retrieves a pending OTP challenge by ID
+func (r *DynamoDBOTPRepository) GetChallenge(ctx context.Context, id string) (*models.OTPChallenge, error) {
+	output, err := r.client.GetItem(ctx, &awsdynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            dynamodb.Key(challengeKeyPrefix+id, challengeSortKey),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving OTP challenge: %w", err)
+	}
+	if expired(output.Item, time.Now()) {
+		return nil, fmt.Errorf("OTP not found or expired")
+	}
+	return decodeChallenge(output.Item)
+}
+
+// decodeChallenge decodes the challenge stored in a challenge record
+func decodeChallenge(item map[string]types.AttributeValue) (*models.OTPChallenge, error) {
+	challenge := &models.OTPChallenge{}
+	if err := json.Unmarshal([]byte(dynamodb.StringOf(item, "data")), challenge); err != nil {
+		return nil, fmt.Errorf("error decoding OTP challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// GetLatestChallenge retrieves the most recently issued pending OTP challenge for a phone number
+func (r *DynamoDBOTPRepository) GetLatestChallenge(ctx context.Context, phoneNumber string) (*models.OTPChallenge, error) {
+	entries, err := r.indexEntries(ctx, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newest first; entries of expired challenges linger until DynamoDB removes them
+	for _, entry := range entries {
+		challenge, err := r.GetChallenge(ctx, dynamodb.StringOf(entry, "challenge_id"))
+		if err == nil {
+			return challenge, nil
+		}
+		if err.Error() != "OTP not found or expired" {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("OTP not found or expired")
+}
+
+// indexEntries returns the challenge index entries of a phone number, newest first
+func (r *DynamoDBOTPRepository) indexEntries(ctx context.Context, phoneNumber string) ([]map[string]types.AttributeValue, error) {
+	input := &awsdynamodb.QueryInput{
+		TableName:                 aws.String(r.table),
+		KeyConditionExpression:    aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": dynamodb.String(phoneChallengesKeyPrefix + phoneNumber)},
+		ScanIndexForward:          aws.Bool(false),
+		ConsistentRead:            aws.Bool(true),
+	}
+
+	var entries []map[string]types.AttributeValue
+	for {
+		page, err := r.client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("error listing OTP challenges: %w", err)
+		}
+		entries = append(entries, page.Items...)
+		if len(page.LastEvaluatedKey) == 0 {
+			return entries, nil
+		}
+		input.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+}
+
+// DeleteChallenge deletes an OTP challenge
+func (r *DynamoDBOTPRepository) DeleteChallenge(ctx context.Context, challenge *models.OTPChallenge) error {
+	old, err := r.deleteChallenge(ctx, challenge.ID)
+	if err == nil && len(old) > 0 {
+		_, err = r.client.DeleteItem(ctx, &awsdynamodb.DeleteItemInput{
+			TableName: aws.String(r.table),
+			Key:       dynamodb.Key(phoneChallengesKeyPrefix+challenge.PhoneNumber, dynamodb.StringOf(old, "index_sk")),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting OTP challenge: %w", err)
+	}
+	return nil
+}
+
+// deleteChallenge deletes a challenge record, returning it or nil if there was none
+func (r *DynamoDBOTPRepository) deleteChallenge(ctx context.Context, id string) (map[string]types.AttributeValue, error) {
+	output, err := r.client.DeleteItem(ctx, &awsdynamodb.DeleteItemInput{
+		TableName:    aws.String(r.table),
+		Key:          dynamodb.Key(challengeKeyPrefix+id, challengeSortKey),
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Attributes, nil
+}
+
+// DeleteChallengesByPhone deletes all pending OTP challenges for a phone number
+func (r *DynamoDBOTPRepository) DeleteChallengesByPhone(ctx context.Context, phoneNumber string) (int64, error) {
+	entries, err := r.indexEntries(ctx, phoneNumber)
+	if err != nil {
+		return 0, err
+	}
+	return r.deleteChallenges(ctx, entries)
+}
+
+// DeleteChallengesByPrefix deletes all pending OTP challenges for phone numbers starting with prefix.
+// It scans the whole table, so it is only meant for occasional admin use.
+func (r *DynamoDBOTPRepository) DeleteChallengesByPrefix(ctx context.Context, prefix string) (int64, error) {
+	input := &awsdynamodb.ScanInput{
+		TableName:                 aws.String(r.table),
+		FilterExpression:          aws.String("begins_with(pk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":prefix": dynamodb.String(phoneChallengesKeyPrefix + prefix)},
+	}
+
+	var deleted int64
+	for {
+		page, err := r.client.Scan(ctx, input)
+		if err != nil {
+			return deleted, fmt.Errorf("error scanning OTP challenges: %w", err)
+		}
+		n, err := r.deleteChallenges(ctx, page.Items)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if len(page.LastEvaluatedKey) == 0 {
+			return deleted, nil
+		}
+		input.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+}
+
+// deleteChallenges deletes the challenges of index entries and the entries themselves,
+// returning the number of challenges that had not expired yet
+func (r *DynamoDBOTPRepository) deleteChallenges(ctx context.Context, entries []map[string]types.AttributeValue) (int64, error) {
+	var deleted int64
+	now := time.Now()
+	for _, entry := range entries {
+		old, err := r.deleteChallenge(ctx, dynamodb.StringOf(entry, "challenge_id"))
+		if err == nil {
+			_, err = r.client.DeleteItem(ctx, &awsdynamodb.DeleteItemInput{
+				TableName: aws.String(r.table),
+				Key:       dynamodb.Key(dynamodb.StringOf(entry, dynamodb.PartitionKey), dynamodb.StringOf(entry, dynamodb.SortKey)),
+			})
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("error deleting OTP challenges: %w", err)
+		}
+		if !expired(old, now) {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// AcquireResendCooldown starts a resend cooldown for a phone number unless one is running,
+// returning the remaining time of the running cooldown or zero if it was started
+func (r *DynamoDBOTPRepository) AcquireResendCooldown(ctx context.Context, phoneNumber string, cooldown time.Duration) (time.Duration, error) {
+	if cooldown <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(cooldown)
+	item := dynamodb.Key(cooldownKeyPrefix+phoneNumber, cooldownSortKey)
+	item["expires_at"] = dynamodb.Number(expiresAt.UnixMilli())
+	item[dynamodb.TTLAttribute] = dynamodb.TTL(expiresAt)
+
+	_, err := r.client.PutItem(ctx, &awsdynamodb.PutItemInput{
+		TableName:                           aws.String(r.table),
+		Item:                                item,
+		ConditionExpression:                 aws.String("attribute_not_exists(pk) OR expires_at <= :now"),
+		ExpressionAttributeValues:           map[string]types.AttributeValue{":now": dynamodb.Number(now.UnixMilli())},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err == nil {
+		return 0, nil
+	}
+	var conditionErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionErr) {
+		return 0, fmt.Errorf("error acquiring resend cooldown: %w", err)
+	}
+
+	// The failed condition returns the running cooldown
+	remaining := time.Duration(dynamodb.IntOf(conditionErr.Item, "expires_at")-now.UnixMilli()) * time.Millisecond
+	return max(remaining, time.Millisecond), nil
+}
+
+// GetLockout returns the verification lockout state for a phone number
+func (r *DynamoDBOTPRepository) GetLockout(ctx context.Context, phoneNumber string) (*models.LockoutState, error) {
+	output, err := r.client.GetItem(ctx, &awsdynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            dynamodb.Key(failuresKeyPrefix+phoneNumber, failuresSortKey),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting lockout: %w", err)
+	}
+
+	now := time.Now()
+	state := failureState(output.Item, now)
+	if state.lockedUntil > 0 {
+		return &models.LockoutState{Locked: true, RetryAfter: time.Duration(state.lockedUntil-now.UnixMilli()) * time.Millisecond}, nil
+	}
+	return &models.LockoutState{FailedAttempts: int(state.failures)}, nil
+}
+
+// failureRecord is the failed verification record of a phone number
+type failureRecord struct {
+	failures     int64 // failed verifications in the current window
+	windowEndsAt int64 // Unix milliseconds, 0 if no window is running
+	lockedUntil  int64 // Unix milliseconds, 0 if not locked
+}
+
+// failureState reads a failed verification record as of now, clearing its expired parts
+func failureState(item map[string]types.AttributeValue, now time.Time) failureRecord {
+	state := failureRecord{
+		failures:     dynamodb.IntOf(item, "failures"),
+		windowEndsAt: dynamodb.IntOf(item, "window_ends_at"),
+		lockedUntil:  dynamodb.IntOf(item, "locked_until"),
+	}
+	if state.windowEndsAt <= now.UnixMilli() {
+		state.failures, state.windowEndsAt = 0, 0
+	}
+	if state.lockedUntil <= now.UnixMilli() {
+		state.lockedUntil = 0
+	}
+	return state
+}
+
+// RecordFailedVerification counts a failed verification for a phone number and locks it
+// for cooldown once maxAttempts failures happened within window
+func (r *DynamoDBOTPRepository) RecordFailedVerification(ctx context.Context, phoneNumber string, maxAttempts int, window, cooldown time.Duration) (*models.LockoutState, error) {
+	var result *models.LockoutState
+	key := dynamodb.Key(failuresKeyPrefix+phoneNumber, failuresSortKey)
+
+	// Counted by read-modify-write, so concurrent guesses cannot exceed the limit
+	err := r.client.Modify(ctx, r.table, key, func(current map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		now := time.Now()
+		state := failureState(current, now)
+		if state.lockedUntil > 0 {
+			result = &models.LockoutState{Locked: true, RetryAfter: time.Duration(state.lockedUntil-now.UnixMilli()) * time.Millisecond}
+			return nil, nil
+		}
+
+		state.failures++
+		if state.windowEndsAt == 0 {
+			state.windowEndsAt = now.Add(window).UnixMilli()
+		}
+		result = &models.LockoutState{FailedAttempts: int(state.failures)}
+		if state.failures >= int64(maxAttempts) {
+			state.lockedUntil = now.Add(cooldown).UnixMilli()
+			result.Locked, result.RetryAfter = true, cooldown
+			state.failures, state.windowEndsAt = 0, 0
+		}
+
+		expiresAt := time.UnixMilli(max(state.windowEndsAt, state.lockedUntil))
+		return map[string]types.AttributeValue{
+			"failures":            dynamodb.Number(state.failures),
+			"window_ends_at":      dynamodb.Number(state.windowEndsAt),
+			"locked_until":        dynamodb.Number(state.lockedUntil),
+			dynamodb.TTLAttribute: dynamodb.TTL(expiresAt),
+		}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error recording failed verification: %w", err)
+	}
+	return result, nil
+}
+
+// ClearFailedVerifications resets the failed verification count and lockout for a phone number
+func (r *DynamoDBOTPRepository) ClearFailedVerifications(ctx context.Context, phoneNumber string) error {
+	_, err := r.client.DeleteItem(ctx, &awsdynamodb.DeleteItemInput{
+		TableName: aws.String(r.table),
+		Key:       dynamodb.Key(failuresKeyPrefix+phoneNumber, failuresSortKey),
+	})
+	if err != nil {
+		return fmt.Errorf("error clearing failed verifications: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// EventRecordingUserRepository appends a domain event for every change made through a UserRepository,
+// so the user read models can be rebuilt from the event log
+type EventRecordingUserRepository struct {
+	UserRepository
+	events EventRepository
+}
+
+// NewEventRecordingUserRepository wraps repo, recording its changes in events
+func NewEventRecordingUserRepository(repo UserRepository, events EventRepository) *EventRecordingUserRepository {
+	return &EventRecordingUserRepository{UserRepository: repo, events: events}
+}
+
+// Create creates a new user whose phone number was just verified by OTP
+func (r *EventRecordingUserRepository) Create(ctx context.Context, phoneNumber string) (*models.User, error) {
+	user, err := r.UserRepository.Create(ctx, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	return user, r.record(ctx, models.EventUserCreated, user.ID, user)
+}
+
+// FindOrCreateByPhoneNumber returns the user with a phone number, creating them if there is none
+func (r *EventRecordingUserRepository) FindOrCreateByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, bool, error) {
+	user, created, err := r.UserRepository.FindOrCreateByPhoneNumber(ctx, phoneNumber)
+	if err != nil || !created {
+		return user, created, err
+	}
+	return user, true, r.record(ctx, models.EventUserCreated, user.ID, user)
+}
+
+// CreateImported creates a user brought in from another system
+func (r *EventRecordingUserRepository) CreateImported(ctx context.Context, phoneNumber string, phoneVerified bool, verifiedSource *string) (*models.User, error) {
+	user, err := r.UserRepository.CreateImported(ctx, phoneNumber, phoneVerified, verifiedSource)
+	if err != nil {
+		return nil, err
+	}
+	return user, r.record(ctx, models.EventUserCreated, user.ID, user)
+}
+
+// MarkPhoneVerified records that a user's phone number was verified by source
+func (r *EventRecordingUserRepository) MarkPhoneVerified(ctx context.Context, id uuid.UUID, source string) error {
+	if err := r.UserRepository.MarkPhoneVerified(ctx, id, source); err != nil {
+		return err
+	}
+	return r.record(ctx, models.EventUserPhoneVerified, id, map[string]interface{}{
+		"verified_source": source,
+	})
+}
+
+// SetRole sets the role of a user
+func (r *EventRecordingUserRepository) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	if err := r.UserRepository.SetRole(ctx, id, role); err != nil {
+		return err
+	}
+	return r.record(ctx, models.EventUserRoleChanged, id, map[string]interface{}{
+		"role": role,
+	})
+}
+
+// SetAnalyticsConsent sets whether a user consents to analytics
+func (r *EventRecordingUserRepository) SetAnalyticsConsent(ctx context.Context, id uuid.UUID, consent bool) error {
+	if err := r.UserRepository.SetAnalyticsConsent(ctx, id, consent); err != nil {
+		return err
+	}
+	return r.record(ctx, models.EventUserConsentChanged, id, map[string]interface{}{
+		"analytics_consent": consent,
+	})
+}
+
+// Update updates a user
+func (r *EventRecordingUserRepository) Update(ctx context.Context, user *models.User) error {
+	if err := r.UserRepository.Update(ctx, user); err != nil {
+		return err
+	}
+	return r.record(ctx, models.EventUserUpdated, user.ID, map[string]interface{}{
+		"phone_number": user.PhoneNumber,
+	})
+}
+
+// UpdateProfile sets the profile fields of a user given in update, leaving the others unchanged
+func (r *EventRecordingUserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, update models.UpdateProfileRequest) (*models.User, error) {
+	user, err := r.UserRepository.UpdateProfile(ctx, id, update)
+	if err != nil {
+		return nil, err
+	}
+	// Only the fields given are recorded, so replaying leaves the others as they were
+	return user, r.record(ctx, models.EventUserProfileUpdated, id, update)
+}
+
+// UpdateMetadata sets the metadata keys of a user given with a value and removes those given with nil
+func (r *EventRecordingUserRepository) UpdateMetadata(ctx context.Context, id uuid.UUID, update map[string]*string) (*models.User, error) {
+	user, err := r.UserRepository.UpdateMetadata(ctx, id, update)
+	if err != nil {
+		return nil, err
+	}
+	// Removed keys are recorded as null, so replaying removes them too
+	return user, r.record(ctx, models.EventUserMetadataUpdated, id, map[string]interface{}{
+		"metadata": update,
+	})
+}
+
+// Delete soft-deletes a user
+func (r *EventRecordingUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := r.UserRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	return r.record(ctx, models.EventUserDeleted, id, nil)
+}
+
+// Restore un-deletes a user that was soft-deleted after deletedAfter
+func (r *EventRecordingUserRepository) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*models.User, error) {
+	user, err := r.UserRepository.Restore(ctx, id, deletedAfter)
+	if err != nil {
+		return nil, err
+	}
+	return user, r.record(ctx, models.EventUserRestored, user.ID, user)
+}
+
+// Purge permanently deletes the users soft-deleted before deletedBefore
+func (r *EventRecordingUserRepository) Purge(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error) {
+	ids, err := r.UserRepository.Purge(ctx, deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := r.record(ctx, models.EventUserPurged, id, nil); err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
+
+// record appends a user event with payload encoded as JSON
+func (r *EventRecordingUserRepository) record(ctx context.Context, eventType string, userID uuid.UUID, payload interface{}) error {
+	raw := json.RawMessage("{}")
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error encoding domain event: %w", err)
+		}
+		raw = encoded
+	}
+
+	event := &models.DomainEvent{
+		Type:          eventType,
+		AggregateType: models.AggregateUser,
+		AggregateID:   userID.String(),
+		Payload:       raw,
+	}
+	if err := r.events.Append(ctx, event); err != nil {
+		return fmt.Errorf("error recording domain event: %w", err)
+	}
+	return nil
+}
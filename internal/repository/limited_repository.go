@@ -0,0 +1,592 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/concurrency"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// LimitedUserRepository runs every operation of a UserRepository through an adaptive concurrency limiter
+type LimitedUserRepository struct {
+	repo    UserRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedUserRepository wraps repo with limiter
+func NewLimitedUserRepository(repo UserRepository, limiter *concurrency.AdaptiveLimiter) *LimitedUserRepository {
+	return &LimitedUserRepository{repo: repo, limiter: limiter}
+}
+
+// Create creates a new user
+func (r *LimitedUserRepository) Create(ctx context.Context, phoneNumber string) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.Create(ctx, phoneNumber)
+		return err
+	})
+	return user, err
+}
+
+// FindOrCreateByPhoneNumber returns the user with a phone number, creating them if there is none
+func (r *LimitedUserRepository) FindOrCreateByPhoneNumber(ctx context.Context, phoneNumber string) (user *models.User, created bool, err error) {
+	err = r.limiter.Do(func() error {
+		user, created, err = r.repo.FindOrCreateByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return user, created, err
+}
+
+// CreateImported creates a user brought in from another system
+func (r *LimitedUserRepository) CreateImported(ctx context.Context, phoneNumber string, phoneVerified bool, verifiedSource *string) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.CreateImported(ctx, phoneNumber, phoneVerified, verifiedSource)
+		return err
+	})
+	return user, err
+}
+
+// MarkPhoneVerified records that a user's phone number was verified by source
+func (r *LimitedUserRepository) MarkPhoneVerified(ctx context.Context, id uuid.UUID, source string) error {
+	return r.limiter.Do(func() error {
+		return r.repo.MarkPhoneVerified(ctx, id, source)
+	})
+}
+
+// SetRole sets the role of a user
+func (r *LimitedUserRepository) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	return r.limiter.Do(func() error {
+		return r.repo.SetRole(ctx, id, role)
+	})
+}
+
+// SetAnalyticsConsent sets whether a user consents to analytics
+func (r *LimitedUserRepository) SetAnalyticsConsent(ctx context.Context, id uuid.UUID, consent bool) error {
+	return r.limiter.Do(func() error {
+		return r.repo.SetAnalyticsConsent(ctx, id, consent)
+	})
+}
+
+// Stats counts active users by phone verification status and source
+func (r *LimitedUserRepository) Stats(ctx context.Context) (stats *models.UserStats, err error) {
+	err = r.limiter.Do(func() error {
+		stats, err = r.repo.Stats(ctx)
+		return err
+	})
+	return stats, err
+}
+
+// FindByID finds a user by ID
+func (r *LimitedUserRepository) FindByID(ctx context.Context, id uuid.UUID) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.FindByID(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+// FindByPhoneNumber finds a user by phone number
+func (r *LimitedUserRepository) FindByPhoneNumber(ctx context.Context, phoneNumber string) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.FindByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return user, err
+}
+
+// List returns a list of users with pagination and search
+func (r *LimitedUserRepository) List(ctx context.Context, params models.PaginationParams) (users []models.User, totalCount int64, err error) {
+	err = r.limiter.Do(func() error {
+		users, totalCount, err = r.repo.List(ctx, params)
+		return err
+	})
+	return users, totalCount, err
+}
+
+// Update updates a user
+func (r *LimitedUserRepository) Update(ctx context.Context, user *models.User) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Update(ctx, user)
+	})
+}
+
+// UpdateProfile sets the profile fields of a user given in update, leaving the others unchanged
+func (r *LimitedUserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, update models.UpdateProfileRequest) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.UpdateProfile(ctx, id, update)
+		return err
+	})
+	return user, err
+}
+
+// UpdateMetadata sets the metadata keys of a user given with a value and removes those given with nil
+func (r *LimitedUserRepository) UpdateMetadata(ctx context.Context, id uuid.UUID, update map[string]*string) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.UpdateMetadata(ctx, id, update)
+		return err
+	})
+	return user, err
+}
+
+// Delete soft-deletes a user
+func (r *LimitedUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Delete(ctx, id)
+	})
+}
+
+// FindDeletedByID finds a soft-deleted user by ID
+func (r *LimitedUserRepository) FindDeletedByID(ctx context.Context, id uuid.UUID) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.FindDeletedByID(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+// FindDeletedByPhoneNumber finds a soft-deleted user by phone number
+func (r *LimitedUserRepository) FindDeletedByPhoneNumber(ctx context.Context, phoneNumber string) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.FindDeletedByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return user, err
+}
+
+// Restore un-deletes a user that was soft-deleted after deletedAfter
+func (r *LimitedUserRepository) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (user *models.User, err error) {
+	err = r.limiter.Do(func() error {
+		user, err = r.repo.Restore(ctx, id, deletedAfter)
+		return err
+	})
+	return user, err
+}
+
+// Purge permanently deletes the users soft-deleted before deletedBefore
+func (r *LimitedUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (ids []uuid.UUID, err error) {
+	err = r.limiter.Do(func() error {
+		ids, err = r.repo.Purge(ctx, deletedBefore)
+		return err
+	})
+	return ids, err
+}
+
+// LimitedAuditRepository runs every operation of an AuditRepository through an adaptive concurrency limiter
+type LimitedAuditRepository struct {
+	repo    AuditRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedAuditRepository wraps repo with limiter
+func NewLimitedAuditRepository(repo AuditRepository, limiter *concurrency.AdaptiveLimiter) *LimitedAuditRepository {
+	return &LimitedAuditRepository{repo: repo, limiter: limiter}
+}
+
+// Create records a new audit log entry
+func (r *LimitedAuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Create(ctx, entry)
+	})
+}
+
+// ListByTarget returns the latest entries about a target
+func (r *LimitedAuditRepository) ListByTarget(ctx context.Context, targetType, targetID string, limit int) (entries []models.AuditLog, totalCount int64, err error) {
+	err = r.limiter.Do(func() error {
+		entries, totalCount, err = r.repo.ListByTarget(ctx, targetType, targetID, limit)
+		return err
+	})
+	return entries, totalCount, err
+}
+
+// LimitedBackupCodeRepository runs every operation of a BackupCodeRepository through an adaptive concurrency limiter
+type LimitedBackupCodeRepository struct {
+	repo    BackupCodeRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedBackupCodeRepository wraps repo with limiter
+func NewLimitedBackupCodeRepository(repo BackupCodeRepository, limiter *concurrency.AdaptiveLimiter) *LimitedBackupCodeRepository {
+	return &LimitedBackupCodeRepository{repo: repo, limiter: limiter}
+}
+
+// ReplaceBackupCodes replaces all backup codes of a user
+func (r *LimitedBackupCodeRepository) ReplaceBackupCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	return r.limiter.Do(func() error {
+		return r.repo.ReplaceBackupCodes(ctx, userID, codeHashes)
+	})
+}
+
+// UseBackupCode marks an unused backup code of a user as used
+func (r *LimitedBackupCodeRepository) UseBackupCode(ctx context.Context, userID uuid.UUID, codeHash string) (used bool, err error) {
+	err = r.limiter.Do(func() error {
+		used, err = r.repo.UseBackupCode(ctx, userID, codeHash)
+		return err
+	})
+	return used, err
+}
+
+// LimitedEventRepository runs every operation of an EventRepository through an adaptive concurrency limiter
+type LimitedEventRepository struct {
+	repo    EventRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedEventRepository wraps repo with limiter
+func NewLimitedEventRepository(repo EventRepository, limiter *concurrency.AdaptiveLimiter) *LimitedEventRepository {
+	return &LimitedEventRepository{repo: repo, limiter: limiter}
+}
+
+// Append stores a domain event
+func (r *LimitedEventRepository) Append(ctx context.Context, event *models.DomainEvent) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Append(ctx, event)
+	})
+}
+
+// ListAfter returns events with a sequence number above afterSequence
+func (r *LimitedEventRepository) ListAfter(ctx context.Context, afterSequence int64, limit int) (events []models.DomainEvent, err error) {
+	err = r.limiter.Do(func() error {
+		events, err = r.repo.ListAfter(ctx, afterSequence, limit)
+		return err
+	})
+	return events, err
+}
+
+// ListByAggregate returns the latest events about an aggregate
+func (r *LimitedEventRepository) ListByAggregate(ctx context.Context, aggregateType, aggregateID string, limit int) (events []models.DomainEvent, totalCount int64, err error) {
+	err = r.limiter.Do(func() error {
+		events, totalCount, err = r.repo.ListByAggregate(ctx, aggregateType, aggregateID, limit)
+		return err
+	})
+	return events, totalCount, err
+}
+
+// LimitedAbuseReportRepository runs every operation of an AbuseReportRepository through an adaptive concurrency limiter
+type LimitedAbuseReportRepository struct {
+	repo    AbuseReportRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedAbuseReportRepository wraps repo with limiter
+func NewLimitedAbuseReportRepository(repo AbuseReportRepository, limiter *concurrency.AdaptiveLimiter) *LimitedAbuseReportRepository {
+	return &LimitedAbuseReportRepository{repo: repo, limiter: limiter}
+}
+
+// Create stores a new abuse report
+func (r *LimitedAbuseReportRepository) Create(ctx context.Context, report *models.AbuseReport) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Create(ctx, report)
+	})
+}
+
+// List returns a page of abuse reports
+func (r *LimitedAbuseReportRepository) List(ctx context.Context, params models.AbuseReportListParams) (reports []models.AbuseReport, totalCount int64, err error) {
+	err = r.limiter.Do(func() error {
+		reports, totalCount, err = r.repo.List(ctx, params)
+		return err
+	})
+	return reports, totalCount, err
+}
+
+// GetByID finds an abuse report by ID
+func (r *LimitedAbuseReportRepository) GetByID(ctx context.Context, id uuid.UUID) (report *models.AbuseReport, err error) {
+	err = r.limiter.Do(func() error {
+		report, err = r.repo.GetByID(ctx, id)
+		return err
+	})
+	return report, err
+}
+
+// Review sets the status of a report and of the other pending reports of its phone number
+func (r *LimitedAbuseReportRepository) Review(ctx context.Context, id uuid.UUID, status string, reviewerID *uuid.UUID) (reviewed int64, err error) {
+	err = r.limiter.Do(func() error {
+		reviewed, err = r.repo.Review(ctx, id, status, reviewerID)
+		return err
+	})
+	return reviewed, err
+}
+
+// HasActiveReports reports whether a phone number has a pending or confirmed abuse report
+func (r *LimitedAbuseReportRepository) HasActiveReports(ctx context.Context, phoneNumber string) (reported bool, err error) {
+	err = r.limiter.Do(func() error {
+		reported, err = r.repo.HasActiveReports(ctx, phoneNumber)
+		return err
+	})
+	return reported, err
+}
+
+// LimitedTrustedDeviceRepository runs every operation of a TrustedDeviceRepository through an adaptive concurrency limiter
+type LimitedTrustedDeviceRepository struct {
+	repo    TrustedDeviceRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedTrustedDeviceRepository wraps repo with limiter
+func NewLimitedTrustedDeviceRepository(repo TrustedDeviceRepository, limiter *concurrency.AdaptiveLimiter) *LimitedTrustedDeviceRepository {
+	return &LimitedTrustedDeviceRepository{repo: repo, limiter: limiter}
+}
+
+// Create stores a new trusted device
+func (r *LimitedTrustedDeviceRepository) Create(ctx context.Context, device *models.TrustedDevice) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Create(ctx, device)
+	})
+}
+
+// FindActiveByTokenHash finds the unrevoked, unexpired device with the given token hash
+func (r *LimitedTrustedDeviceRepository) FindActiveByTokenHash(ctx context.Context, tokenHash string, now time.Time) (device *models.TrustedDevice, err error) {
+	err = r.limiter.Do(func() error {
+		device, err = r.repo.FindActiveByTokenHash(ctx, tokenHash, now)
+		return err
+	})
+	return device, err
+}
+
+// MarkUsed records that a device signed in at usedAt
+func (r *LimitedTrustedDeviceRepository) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	return r.limiter.Do(func() error {
+		return r.repo.MarkUsed(ctx, id, usedAt)
+	})
+}
+
+// ListActiveByUser returns a user's unrevoked, unexpired devices
+func (r *LimitedTrustedDeviceRepository) ListActiveByUser(ctx context.Context, userID uuid.UUID, now time.Time) (devices []models.TrustedDevice, err error) {
+	err = r.limiter.Do(func() error {
+		devices, err = r.repo.ListActiveByUser(ctx, userID, now)
+		return err
+	})
+	return devices, err
+}
+
+// Revoke revokes one of a user's devices
+func (r *LimitedTrustedDeviceRepository) Revoke(ctx context.Context, userID, id uuid.UUID, revokedAt time.Time) (revoked bool, err error) {
+	err = r.limiter.Do(func() error {
+		revoked, err = r.repo.Revoke(ctx, userID, id, revokedAt)
+		return err
+	})
+	return revoked, err
+}
+
+// LimitedAPIKeyRepository runs every operation of an APIKeyRepository through an adaptive concurrency limiter
+type LimitedAPIKeyRepository struct {
+	repo    APIKeyRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedAPIKeyRepository wraps repo with limiter
+func NewLimitedAPIKeyRepository(repo APIKeyRepository, limiter *concurrency.AdaptiveLimiter) *LimitedAPIKeyRepository {
+	return &LimitedAPIKeyRepository{repo: repo, limiter: limiter}
+}
+
+// Create stores a new API key
+func (r *LimitedAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Create(ctx, key)
+	})
+}
+
+// FindActiveByKeyHash finds the unrevoked API key with the given key hash
+func (r *LimitedAPIKeyRepository) FindActiveByKeyHash(ctx context.Context, keyHash string) (key *models.APIKey, err error) {
+	err = r.limiter.Do(func() error {
+		key, err = r.repo.FindActiveByKeyHash(ctx, keyHash)
+		return err
+	})
+	return key, err
+}
+
+// MarkUsed records that a key authenticated a request at usedAt
+func (r *LimitedAPIKeyRepository) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	return r.limiter.Do(func() error {
+		return r.repo.MarkUsed(ctx, id, usedAt)
+	})
+}
+
+// List returns every API key
+func (r *LimitedAPIKeyRepository) List(ctx context.Context) (keys []models.APIKey, err error) {
+	err = r.limiter.Do(func() error {
+		keys, err = r.repo.List(ctx)
+		return err
+	})
+	return keys, err
+}
+
+// Revoke revokes an API key
+func (r *LimitedAPIKeyRepository) Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) (revoked bool, err error) {
+	err = r.limiter.Do(func() error {
+		revoked, err = r.repo.Revoke(ctx, id, revokedAt)
+		return err
+	})
+	return revoked, err
+}
+
+// LimitedLoginHistoryRepository runs every operation of a LoginHistoryRepository through an adaptive concurrency limiter
+type LimitedLoginHistoryRepository struct {
+	repo    LoginHistoryRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedLoginHistoryRepository wraps repo with limiter
+func NewLimitedLoginHistoryRepository(repo LoginHistoryRepository, limiter *concurrency.AdaptiveLimiter) *LimitedLoginHistoryRepository {
+	return &LimitedLoginHistoryRepository{repo: repo, limiter: limiter}
+}
+
+// Record stores a login attempt
+func (r *LimitedLoginHistoryRepository) Record(ctx context.Context, attempt *models.LoginAttempt) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Record(ctx, attempt)
+	})
+}
+
+// ListByUser returns a page of a user's login attempts
+func (r *LimitedLoginHistoryRepository) ListByUser(ctx context.Context, userID uuid.UUID, params models.PaginationParams) (attempts []models.LoginAttempt, totalCount int64, err error) {
+	err = r.limiter.Do(func() error {
+		attempts, totalCount, err = r.repo.ListByUser(ctx, userID, params)
+		return err
+	})
+	return attempts, totalCount, err
+}
+
+// LimitedSuppressionRepository runs every operation of a SuppressionRepository through an adaptive concurrency limiter
+type LimitedSuppressionRepository struct {
+	repo    SuppressionRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedSuppressionRepository wraps repo with limiter
+func NewLimitedSuppressionRepository(repo SuppressionRepository, limiter *concurrency.AdaptiveLimiter) *LimitedSuppressionRepository {
+	return &LimitedSuppressionRepository{repo: repo, limiter: limiter}
+}
+
+// Add puts a phone number on the suppression list for a reason
+func (r *LimitedSuppressionRepository) Add(ctx context.Context, suppression *models.Suppression) (added bool, err error) {
+	err = r.limiter.Do(func() error {
+		added, err = r.repo.Add(ctx, suppression)
+		return err
+	})
+	return added, err
+}
+
+// Remove takes a phone number off the suppression list for a reason, or for every reason
+func (r *LimitedSuppressionRepository) Remove(ctx context.Context, phoneNumber, reason string) (removed int64, err error) {
+	err = r.limiter.Do(func() error {
+		removed, err = r.repo.Remove(ctx, phoneNumber, reason)
+		return err
+	})
+	return removed, err
+}
+
+// IsSuppressed reports whether a phone number is on the suppression list for any reason
+func (r *LimitedSuppressionRepository) IsSuppressed(ctx context.Context, phoneNumber string) (suppressed bool, err error) {
+	err = r.limiter.Do(func() error {
+		suppressed, err = r.repo.IsSuppressed(ctx, phoneNumber)
+		return err
+	})
+	return suppressed, err
+}
+
+// List returns the whole suppression list
+func (r *LimitedSuppressionRepository) List(ctx context.Context) (suppressions []models.Suppression, err error) {
+	err = r.limiter.Do(func() error {
+		suppressions, err = r.repo.List(ctx)
+		return err
+	})
+	return suppressions, err
+}
+
+// LimitedPhoneListRepository runs every operation of a PhoneListRepository through an adaptive concurrency limiter
+type LimitedPhoneListRepository struct {
+	repo    PhoneListRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedPhoneListRepository wraps repo with limiter
+func NewLimitedPhoneListRepository(repo PhoneListRepository, limiter *concurrency.AdaptiveLimiter) *LimitedPhoneListRepository {
+	return &LimitedPhoneListRepository{repo: repo, limiter: limiter}
+}
+
+// Add puts a prefix on a list
+func (r *LimitedPhoneListRepository) Add(ctx context.Context, entry *models.PhoneListEntry) (added bool, err error) {
+	err = r.limiter.Do(func() error {
+		added, err = r.repo.Add(ctx, entry)
+		return err
+	})
+	return added, err
+}
+
+// Remove takes a prefix off a list
+func (r *LimitedPhoneListRepository) Remove(ctx context.Context, list, prefix string) (removed bool, err error) {
+	err = r.limiter.Do(func() error {
+		removed, err = r.repo.Remove(ctx, list, prefix)
+		return err
+	})
+	return removed, err
+}
+
+// Match returns the entries of both lists whose prefix phoneNumber starts with
+func (r *LimitedPhoneListRepository) Match(ctx context.Context, phoneNumber string) (entries []models.PhoneListEntry, err error) {
+	err = r.limiter.Do(func() error {
+		entries, err = r.repo.Match(ctx, phoneNumber)
+		return err
+	})
+	return entries, err
+}
+
+// List returns the entries of both lists
+func (r *LimitedPhoneListRepository) List(ctx context.Context) (entries []models.PhoneListEntry, err error) {
+	err = r.limiter.Do(func() error {
+		entries, err = r.repo.List(ctx)
+		return err
+	})
+	return entries, err
+}
+
+// LimitedWebhookRepository runs every operation of a WebhookRepository through an adaptive concurrency limiter
+type LimitedWebhookRepository struct {
+	repo    WebhookRepository
+	limiter *concurrency.AdaptiveLimiter
+}
+
+// NewLimitedWebhookRepository wraps repo with limiter
+func NewLimitedWebhookRepository(repo WebhookRepository, limiter *concurrency.AdaptiveLimiter) *LimitedWebhookRepository {
+	return &LimitedWebhookRepository{repo: repo, limiter: limiter}
+}
+
+// LastSequence returns the sequence number of the last domain event queued for webhooks
+func (r *LimitedWebhookRepository) LastSequence(ctx context.Context) (sequence int64, err error) {
+	err = r.limiter.Do(func() error {
+		sequence, err = r.repo.LastSequence(ctx)
+		return err
+	})
+	return sequence, err
+}
+
+// SetLastSequence stores the sequence number of the last domain event queued for webhooks
+func (r *LimitedWebhookRepository) SetLastSequence(ctx context.Context, sequence int64) error {
+	return r.limiter.Do(func() error {
+		return r.repo.SetLastSequence(ctx, sequence)
+	})
+}
+
+// Enqueue stores new deliveries
+func (r *LimitedWebhookRepository) Enqueue(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Enqueue(ctx, deliveries)
+	})
+}
+
+// ClaimDue returns and postpones pending deliveries that are due
+func (r *LimitedWebhookRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) (deliveries []models.WebhookDelivery, err error) {
+	err = r.limiter.Do(func() error {
+		deliveries, err = r.repo.ClaimDue(ctx, now, leaseUntil, limit)
+		return err
+	})
+	return deliveries, err
+}
+
+// Update stores the outcome of a delivery attempt
+func (r *LimitedWebhookRepository) Update(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return r.limiter.Do(func() error {
+		return r.repo.Update(ctx, delivery)
+	})
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryAbuseReportRepository implements AbuseReportRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryAbuseReportRepository struct {
+	mu      sync.RWMutex
+	reports map[uuid.UUID]*models.AbuseReport
+}
+
+// NewInMemoryAbuseReportRepository creates a new in-memory abuse report repository
+func NewInMemoryAbuseReportRepository() *InMemoryAbuseReportRepository {
+	return &InMemoryAbuseReportRepository{
+		reports: make(map[uuid.UUID]*models.AbuseReport),
+	}
+}
+
+// Create stores a new abuse report
+func (r *InMemoryAbuseReportRepository) Create(ctx context.Context, report *models.AbuseReport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *report
+	r.reports[report.ID] = &stored
+	return nil
+}
+
+// List returns a page of abuse reports with the given status, or of every status if empty, oldest first
+func (r *InMemoryAbuseReportRepository) List(ctx context.Context, params models.AbuseReportListParams) ([]models.AbuseReport, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matching := []models.AbuseReport{}
+	for _, report := range r.reports {
+		if params.Status == "" || report.Status == params.Status {
+			matching = append(matching, *report)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		if !matching[i].CreatedAt.Equal(matching[j].CreatedAt) {
+			return matching[i].CreatedAt.Before(matching[j].CreatedAt)
+		}
+		return matching[i].ID.String() < matching[j].ID.String()
+	})
+
+	start := (params.Page - 1) * params.PageSize
+	if start > len(matching) {
+		start = len(matching)
+	}
+	end := start + params.PageSize
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return matching[start:end], int64(len(matching)), nil
+}
+
+// GetByID finds an abuse report by ID
+func (r *InMemoryAbuseReportRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.AbuseReport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	report, ok := r.reports[id]
+	if !ok {
+		return nil, fmt.Errorf("error finding abuse report by ID: %w", sql.ErrNoRows)
+	}
+	found := *report
+	return &found, nil
+}
+
+// Review sets the status of a report and of the other pending reports of its phone number
+func (r *InMemoryAbuseReportRepository) Review(ctx context.Context, id uuid.UUID, status string, reviewerID *uuid.UUID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	target, ok := r.reports[id]
+	if !ok {
+		return 0, fmt.Errorf("abuse report not found")
+	}
+
+	now := time.Now()
+	var reviewed int64
+	for _, report := range r.reports {
+		if report.PhoneNumber != target.PhoneNumber || (report.ID != id && report.Status != models.AbuseReportPending) {
+			continue
+		}
+		report.Status = status
+		report.ReviewedAt = &now
+		report.ReviewedBy = reviewerID
+		reviewed++
+	}
+	return reviewed, nil
+}
+
+// HasActiveReports reports whether a phone number has a pending or confirmed abuse report
+func (r *InMemoryAbuseReportRepository) HasActiveReports(ctx context.Context, phoneNumber string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, report := range r.reports {
+		if report.PhoneNumber == phoneNumber &&
+			(report.Status == models.AbuseReportPending || report.Status == models.AbuseReportConfirmed) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InMemoryActiveUserRepository implements ActiveUserRepository in process memory with exact counts.
+// It is intended for tests and single-instance deployments.
+type InMemoryActiveUserRepository struct {
+	mu           sync.RWMutex
+	days         map[string]map[uuid.UUID]bool
+	lastSequence int64
+}
+
+// NewInMemoryActiveUserRepository creates a new in-memory active user repository
+func NewInMemoryActiveUserRepository() *InMemoryActiveUserRepository {
+	return &InMemoryActiveUserRepository{
+		days: make(map[string]map[uuid.UUID]bool),
+	}
+}
+
+// RecordActivity records that a user was active on the UTC day of at
+func (r *InMemoryActiveUserRepository) RecordActivity(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := activeUsersDayKey(at.UTC().Truncate(24 * time.Hour))
+	if r.days[key] == nil {
+		r.days[key] = make(map[uuid.UUID]bool)
+	}
+	r.days[key][userID] = true
+	return nil
+}
+
+// CountActive counts the distinct users active on the UTC days from since through until
+func (r *InMemoryActiveUserRepository) CountActive(ctx context.Context, since, until time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make(map[uuid.UUID]bool)
+	for day := since.UTC().Truncate(24 * time.Hour); !day.After(until); day = day.Add(24 * time.Hour) {
+		for userID := range r.days[activeUsersDayKey(day)] {
+			users[userID] = true
+		}
+	}
+	return int64(len(users)), nil
+}
+
+// LastSequence returns the sequence number of the last domain event fed to the read model
+func (r *InMemoryActiveUserRepository) LastSequence(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastSequence, nil
+}
+
+// SetLastSequence stores the sequence number of the last domain event fed to the read model
+func (r *InMemoryActiveUserRepository) SetLastSequence(ctx context.Context, sequence int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sequence > r.lastSequence {
+		r.lastSequence = sequence
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryAPIKeyRepository implements APIKeyRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryAPIKeyRepository struct {
+	mu   sync.RWMutex
+	keys map[uuid.UUID]*models.APIKey
+}
+
+// NewInMemoryAPIKeyRepository creates a new in-memory API key repository
+func NewInMemoryAPIKeyRepository() *InMemoryAPIKeyRepository {
+	return &InMemoryAPIKeyRepository{
+		keys: make(map[uuid.UUID]*models.APIKey),
+	}
+}
+
+// Create stores a new API key
+func (r *InMemoryAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.keys {
+		if existing.KeyHash == key.KeyHash {
+			return fmt.Errorf("error creating API key: duplicate key hash")
+		}
+	}
+	stored := *key
+	r.keys[key.ID] = &stored
+	return nil
+}
+
+// FindActiveByKeyHash finds the unrevoked API key with the given key hash
+func (r *InMemoryAPIKeyRepository) FindActiveByKeyHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash && key.RevokedAt == nil {
+			found := *key
+			return &found, nil
+		}
+	}
+	return nil, fmt.Errorf("error finding API key: %w", sql.ErrNoRows)
+}
+
+// MarkUsed records that a key authenticated a request at usedAt
+func (r *InMemoryAPIKeyRepository) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.keys[id]; ok {
+		key.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+// List returns every API key, revoked ones included, newest first
+func (r *InMemoryAPIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, key := range r.keys {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.After(keys[j].CreatedAt)
+		}
+		return keys[i].ID.String() < keys[j].ID.String()
+	})
+	return keys, nil
+}
+
+// Revoke revokes an API key, reporting whether an unrevoked key was found
+func (r *InMemoryAPIKeyRepository) Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || key.RevokedAt != nil {
+		return false, nil
+	}
+	key.RevokedAt = &revokedAt
+	return true, nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryAuditRepository implements AuditRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryAuditRepository struct {
+	mu      sync.RWMutex
+	entries []models.AuditLog
+}
+
+// NewInMemoryAuditRepository creates a new in-memory audit repository
+func NewInMemoryAuditRepository() *InMemoryAuditRepository {
+	return &InMemoryAuditRepository{}
+}
+
+// Create records a new audit log entry
+func (r *InMemoryAuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if entry.ActorType == "" {
+		entry.ActorType = models.AuditActorUser
+	}
+	stored := *entry
+	if len(stored.Metadata) == 0 {
+		stored.Metadata = []byte("{}")
+	}
+
+	r.entries = append(r.entries, stored)
+	return nil
+}
+
+// ListByTarget returns the latest limit entries about a target, newest first, and how many
+// entries there are about it
+func (r *InMemoryAuditRepository) ListByTarget(ctx context.Context, targetType, targetID string, limit int) ([]models.AuditLog, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Entries are recorded in time order, so the last recorded are the newest
+	entries := []models.AuditLog{}
+	var totalCount int64
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		entry := r.entries[i]
+		if entry.TargetType != targetType || entry.TargetID != targetID {
+			continue
+		}
+		totalCount++
+		if len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, totalCount, nil
+}
+
+// stage returns a copy of the repository to record entries in and a function adding the
+// entries recorded in it to the repository
+func (r *InMemoryAuditRepository) stage() (*InMemoryAuditRepository, func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	staged := &InMemoryAuditRepository{entries: append([]models.AuditLog(nil), r.entries...)}
+	recorded := len(staged.entries)
+	return staged, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.entries = append(r.entries, staged.entries[recorded:]...)
+	}
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// InMemoryBackupCodeRepository implements BackupCodeRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryBackupCodeRepository struct {
+	mu    sync.Mutex
+	codes map[uuid.UUID]map[string]bool // user ID -> code hash -> used
+}
+
+// NewInMemoryBackupCodeRepository creates a new in-memory backup code repository
+func NewInMemoryBackupCodeRepository() *InMemoryBackupCodeRepository {
+	return &InMemoryBackupCodeRepository{
+		codes: make(map[uuid.UUID]map[string]bool),
+	}
+}
+
+// ReplaceBackupCodes replaces all backup codes of a user with the given code hashes
+func (r *InMemoryBackupCodeRepository) ReplaceBackupCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := make(map[string]bool, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes[codeHash] = false
+	}
+	r.codes[userID] = codes
+	return nil
+}
+
+// UseBackupCode marks an unused backup code of a user as used
+func (r *InMemoryBackupCodeRepository) UseBackupCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used, ok := r.codes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	r.codes[userID][codeHash] = true
+	return true, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryEventRepository implements EventRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryEventRepository struct {
+	mu     sync.RWMutex
+	events []models.DomainEvent
+}
+
+// NewInMemoryEventRepository creates a new in-memory domain event repository
+func NewInMemoryEventRepository() *InMemoryEventRepository {
+	return &InMemoryEventRepository{}
+}
+
+// Append stores a domain event, assigning its sequence number
+func (r *InMemoryEventRepository) Append(ctx context.Context, event *models.DomainEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	event.Sequence = int64(len(r.events)) + 1
+
+	r.events = append(r.events, *event)
+	return nil
+}
+
+// ListAfter returns up to limit events with a sequence number above afterSequence, in sequence order
+func (r *InMemoryEventRepository) ListAfter(ctx context.Context, afterSequence int64, limit int) ([]models.DomainEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []models.DomainEvent{}
+	for _, event := range r.events {
+		if len(events) == limit {
+			break
+		}
+		if event.Sequence > afterSequence {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// ListByAggregate returns the latest limit events about an aggregate, newest first, and how
+// many events there are about it
+func (r *InMemoryEventRepository) ListByAggregate(ctx context.Context, aggregateType, aggregateID string, limit int) ([]models.DomainEvent, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []models.DomainEvent{}
+	var totalCount int64
+	for i := len(r.events) - 1; i >= 0; i-- {
+		event := r.events[i]
+		if event.AggregateType != aggregateType || event.AggregateID != aggregateID {
+			continue
+		}
+		totalCount++
+		if len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, totalCount, nil
+}
+
+// stage returns a copy of the repository to append events to and a function appending the
+// events appended to it to the repository, numbering them after the events there
+func (r *InMemoryEventRepository) stage() (*InMemoryEventRepository, func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	staged := &InMemoryEventRepository{events: append([]models.DomainEvent(nil), r.events...)}
+	appended := len(staged.events)
+	return staged, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for _, event := range staged.events[appended:] {
+			event.Sequence = int64(len(r.events)) + 1
+			r.events = append(r.events, event)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// heldLock is a lock held in InMemoryLockRepository
+type heldLock struct {
+	token     string
+	expiresAt time.Time
+}
+
+// InMemoryLockRepository implements LockRepository in process memory.
+// It is intended for tests and single-instance deployments.
+type InMemoryLockRepository struct {
+	mu    sync.Mutex
+	locks map[string]heldLock
+}
+
+// NewInMemoryLockRepository creates a new in-memory lock repository
+func NewInMemoryLockRepository() *InMemoryLockRepository {
+	return &InMemoryLockRepository{locks: make(map[string]heldLock)}
+}
+
+// AcquireLock takes the lock named key for ttl unless it is held, returning the token to
+// release it with, or "" if another holder has it
+func (r *InMemoryLockRepository) AcquireLock(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if lock, ok := r.locks[key]; ok && now.Before(lock.expiresAt) {
+		return "", nil
+	}
+	token := uuid.New().String()
+	r.locks[key] = heldLock{token: token, expiresAt: now.Add(ttl)}
+	return token, nil
+}
+
+// ReleaseLock releases a lock taken with token. A lock that expired and was taken by
+// another holder in the meantime is left alone.
+func (r *InMemoryLockRepository) ReleaseLock(ctx context.Context, key, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if lock, ok := r.locks[key]; ok && lock.token == token {
+		delete(r.locks, key)
+	}
+	return nil
+}
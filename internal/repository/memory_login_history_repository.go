@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryLoginHistoryRepository implements LoginHistoryRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryLoginHistoryRepository struct {
+	mu       sync.RWMutex
+	attempts []models.LoginAttempt
+}
+
+// NewInMemoryLoginHistoryRepository creates a new in-memory login history repository
+func NewInMemoryLoginHistoryRepository() *InMemoryLoginHistoryRepository {
+	return &InMemoryLoginHistoryRepository{}
+}
+
+// Record stores a login attempt
+func (r *InMemoryLoginHistoryRepository) Record(ctx context.Context, attempt *models.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts = append(r.attempts, *attempt)
+	return nil
+}
+
+// ListByUser returns a page of a user's login attempts, newest first
+func (r *InMemoryLoginHistoryRepository) ListByUser(ctx context.Context, userID uuid.UUID, params models.PaginationParams) ([]models.LoginAttempt, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Attempts recorded at the same time are listed newest recorded first
+	matching := []models.LoginAttempt{}
+	for i := len(r.attempts) - 1; i >= 0; i-- {
+		if attempt := r.attempts[i]; attempt.UserID != nil && *attempt.UserID == userID {
+			matching = append(matching, attempt)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].CreatedAt.After(matching[j].CreatedAt)
+	})
+
+	start := (params.Page - 1) * params.PageSize
+	if start > len(matching) {
+		start = len(matching)
+	}
+	end := start + params.PageSize
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return matching[start:end], int64(len(matching)), nil
+}
+
+// stage returns a copy of the repository to record attempts in and a function adding the
+// attempts recorded in it to the repository
+func (r *InMemoryLoginHistoryRepository) stage() (*InMemoryLoginHistoryRepository, func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	staged := &InMemoryLoginHistoryRepository{attempts: append([]models.LoginAttempt(nil), r.attempts...)}
+	recorded := len(staged.attempts)
+	return staged, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.attempts = append(r.attempts, staged.attempts[recorded:]...)
+	}
+}
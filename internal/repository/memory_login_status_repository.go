@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// storedLoginStatus is a login status kept by InMemoryLoginStatusRepository
+type storedLoginStatus struct {
+	status    models.LoginStatus
+	expiresAt time.Time
+}
+
+// InMemoryLoginStatusRepository implements LoginStatusRepository in process memory.
+// It is intended for tests and single-instance deployments.
+type InMemoryLoginStatusRepository struct {
+	mu          sync.Mutex
+	statuses    map[string]storedLoginStatus                 // challenge ID -> status
+	subscribers map[string]map[chan *models.LoginStatus]bool // challenge ID -> subscriptions
+}
+
+// NewInMemoryLoginStatusRepository creates a new in-memory login status repository
+func NewInMemoryLoginStatusRepository() *InMemoryLoginStatusRepository {
+	return &InMemoryLoginStatusRepository{
+		statuses:    make(map[string]storedLoginStatus),
+		subscribers: make(map[string]map[chan *models.LoginStatus]bool),
+	}
+}
+
+// Save stores the login status of a challenge with expiration and notifies its subscribers
+func (r *InMemoryLoginStatusRepository) Save(ctx context.Context, status *models.LoginStatus, expiration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statuses[status.ChallengeID] = storedLoginStatus{status: *status, expiresAt: time.Now().Add(expiration)}
+	for subscriber := range r.subscribers[status.ChallengeID] {
+		// Like Redis Pub/Sub, statuses are dropped for subscribers that fall behind
+		saved := *status
+		select {
+		case subscriber <- &saved:
+		default:
+		}
+	}
+	return nil
+}
+
+// Get retrieves the stored login status of a challenge
+func (r *InMemoryLoginStatusRepository) Get(ctx context.Context, challengeID string) (*models.LoginStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.statuses[challengeID]
+	if !ok || !time.Now().Before(stored.expiresAt) {
+		return nil, fmt.Errorf("login status not found")
+	}
+	status := stored.status
+	return &status, nil
+}
+
+// Subscribe returns the login statuses saved for a challenge from now on; the channel
+// is closed once ctx is done
+func (r *InMemoryLoginStatusRepository) Subscribe(ctx context.Context, challengeID string) (<-chan *models.LoginStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscriber := make(chan *models.LoginStatus, 16)
+	if r.subscribers[challengeID] == nil {
+		r.subscribers[challengeID] = make(map[chan *models.LoginStatus]bool)
+	}
+	r.subscribers[challengeID][subscriber] = true
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.subscribers[challengeID], subscriber)
+		if len(r.subscribers[challengeID]) == 0 {
+			delete(r.subscribers, challengeID)
+		}
+		close(subscriber)
+	}()
+	return subscriber, nil
+}
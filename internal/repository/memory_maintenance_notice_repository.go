@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryMaintenanceNoticeRepository implements MaintenanceNoticeRepository in process memory.
+// It is intended for tests and single-instance deployments.
+type InMemoryMaintenanceNoticeRepository struct {
+	mu      sync.RWMutex
+	notices map[string]models.MaintenanceNotice
+}
+
+// NewInMemoryMaintenanceNoticeRepository creates a new in-memory maintenance notice repository
+func NewInMemoryMaintenanceNoticeRepository() *InMemoryMaintenanceNoticeRepository {
+	return &InMemoryMaintenanceNoticeRepository{notices: make(map[string]models.MaintenanceNotice)}
+}
+
+// Create stores a maintenance notice
+func (r *InMemoryMaintenanceNoticeRepository) Create(ctx context.Context, notice *models.MaintenanceNotice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.notices[notice.ID] = *notice
+	return nil
+}
+
+// List returns every maintenance notice by start time
+func (r *InMemoryMaintenanceNoticeRepository) List(ctx context.Context) ([]models.MaintenanceNotice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	notices := make([]models.MaintenanceNotice, 0, len(r.notices))
+	for _, notice := range r.notices {
+		notices = append(notices, notice)
+	}
+	sortMaintenanceNotices(notices)
+	return notices, nil
+}
+
+// Delete removes a maintenance notice, reporting whether it existed
+func (r *InMemoryMaintenanceNoticeRepository) Delete(ctx context.Context, id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.notices[id]
+	delete(r.notices, id)
+	return ok, nil
+}
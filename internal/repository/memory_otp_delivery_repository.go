@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// storedDelivery is an OTP delivery kept by InMemoryOTPDeliveryRepository
+type storedDelivery struct {
+	delivery  models.OTPDelivery
+	expiresAt time.Time
+}
+
+// InMemoryOTPDeliveryRepository implements OTPDeliveryRepository in process memory.
+// It is intended for tests and single-instance deployments.
+type InMemoryOTPDeliveryRepository struct {
+	mu         sync.Mutex
+	deliveries map[string]storedDelivery // challenge ID -> delivery
+}
+
+// NewInMemoryOTPDeliveryRepository creates a new in-memory OTP delivery repository
+func NewInMemoryOTPDeliveryRepository() *InMemoryOTPDeliveryRepository {
+	return &InMemoryOTPDeliveryRepository{
+		deliveries: make(map[string]storedDelivery),
+	}
+}
+
+// Save stores the delivery status of an OTP challenge's latest send with expiration, replacing any earlier status
+func (r *InMemoryOTPDeliveryRepository) Save(ctx context.Context, delivery *models.OTPDelivery, expiration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deliveries[delivery.ChallengeID] = storedDelivery{delivery: *delivery, expiresAt: time.Now().Add(expiration)}
+	return nil
+}
+
+// UpdateStatus sets the status of the sent message a provider's delivery receipt refers to,
+// reporting whether it was updated
+func (r *InMemoryOTPDeliveryRepository) UpdateStatus(ctx context.Context, provider, messageID, status string, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, stored := range r.deliveries {
+		d := stored.delivery
+		if d.Provider != provider || d.MessageID != messageID || !now.Before(stored.expiresAt) {
+			continue
+		}
+		if d.Status != models.DeliverySent {
+			return false, nil
+		}
+		stored.delivery.Status = status
+		stored.delivery.UpdatedAt = at
+		r.deliveries[id] = stored
+		return true, nil
+	}
+	return false, nil
+}
+
+// Get retrieves the delivery status of the latest send of an OTP challenge
+func (r *InMemoryOTPDeliveryRepository) Get(ctx context.Context, challengeID string) (*models.OTPDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.deliveries[challengeID]
+	if !ok || !time.Now().Before(stored.expiresAt) {
+		return nil, fmt.Errorf("OTP delivery not found")
+	}
+	delivery := stored.delivery
+	return &delivery, nil
+}
@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// storedChallenge is an OTP challenge kept by InMemoryOTPRepository
+type storedChallenge struct {
+	challenge models.OTPChallenge
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+// failedVerifications counts failed verifications of a phone number within a window
+type failedVerifications struct {
+	count     int
+	expiresAt time.Time
+}
+
+// InMemoryOTPRepository implements OTPRepository in process memory.
+// It mirrors the Redis repository's behaviour and is intended for tests and single-instance
+// deployments, where DeleteExpired evicts the records Redis would have expired.
+type InMemoryOTPRepository struct {
+	mu         sync.Mutex
+	challenges map[string]storedChallenge // challenge ID -> challenge
+	failures   map[string]failedVerifications
+	lockouts   map[string]time.Time // phone number -> end of lockout
+	cooldowns  map[string]time.Time // phone number -> end of resend cooldown
+	tombstones map[string]time.Time // challenge ID -> end of tombstone
+}
+
+// NewInMemoryOTPRepository creates a new in-memory OTP repository
+func NewInMemoryOTPRepository() *InMemoryOTPRepository {
+	return &InMemoryOTPRepository{
+		challenges: make(map[string]storedChallenge),
+		failures:   make(map[string]failedVerifications),
+		lockouts:   make(map[string]time.Time),
+		cooldowns:  make(map[string]time.Time),
+		tombstones: make(map[string]time.Time),
+	}
+}
+
+// StoreChallenge stores an OTP challenge with expiration
+func (r *InMemoryOTPRepository) StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := r.tombstones[challenge.ID]; ok && now.Before(until) {
+		return nil
+	}
+	r.challenges[challenge.ID] = storedChallenge{
+		challenge: *challenge,
+		issuedAt:  now,
+		expiresAt: now.Add(expiration),
+	}
+	return nil
+}
+
+// GetChallenge retrieves a pending OTP challenge by ID
+func (r *InMemoryOTPRepository) GetChallenge(ctx context.Context, id string) (*models.OTPChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.challenges[id]
+	if !ok || !time.Now().Before(stored.expiresAt) {
+		delete(r.challenges, id)
+		return nil, fmt.Errorf("OTP not found or expired")
+	}
+	challenge := stored.challenge
+	return &challenge, nil
+}
+
+// GetLatestChallenge retrieves the most recently issued pending OTP challenge for a phone number
+func (r *InMemoryOTPRepository) GetLatestChallenge(ctx context.Context, phoneNumber string) (*models.OTPChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var latest *storedChallenge
+	for _, stored := range r.challenges {
+		if stored.challenge.PhoneNumber != phoneNumber || !now.Before(stored.expiresAt) {
+			continue
+		}
+		if latest == nil || !stored.issuedAt.Before(latest.issuedAt) {
+			stored := stored
+			latest = &stored
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("OTP not found or expired")
+	}
+	challenge := latest.challenge
+	return &challenge, nil
+}
+
+// DeleteChallenge deletes an OTP challenge
+func (r *InMemoryOTPRepository) DeleteChallenge(ctx context.Context, challenge *models.OTPChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.challenges, challenge.ID)
+	return nil
+}
+
+// TombstoneChallenge deletes an OTP challenge and keeps a tombstone of it for ttl, so a copy
+// of the challenge replicated late cannot store it again, reporting whether it was pending
+func (r *InMemoryOTPRepository) TombstoneChallenge(ctx context.Context, challenge *models.OTPChallenge, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	stored, ok := r.challenges[challenge.ID]
+	pending := ok && now.Before(stored.expiresAt)
+	delete(r.challenges, challenge.ID)
+	r.tombstones[challenge.ID] = now.Add(ttl)
+	return pending, nil
+}
+
+// IsTombstoned reports whether an OTP challenge was deleted by TombstoneChallenge
+func (r *InMemoryOTPRepository) IsTombstoned(ctx context.Context, id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.tombstones[id]
+	return ok && time.Now().Before(until), nil
+}
+
+// ListChallenges returns the pending OTP challenges for phone numbers starting with prefix
+func (r *InMemoryOTPRepository) ListChallenges(ctx context.Context, prefix string) ([]*models.OTPChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	challenges := []*models.OTPChallenge{}
+	for _, stored := range r.challenges {
+		if strings.HasPrefix(stored.challenge.PhoneNumber, prefix) && now.Before(stored.expiresAt) {
+			challenge := stored.challenge
+			challenges = append(challenges, &challenge)
+		}
+	}
+	return challenges, nil
+}
+
+// DeleteChallengesByPhone deletes all pending OTP challenges for a phone number
+func (r *InMemoryOTPRepository) DeleteChallengesByPhone(ctx context.Context, phoneNumber string) (int64, error) {
+	return r.deleteChallenges(func(p string) bool { return p == phoneNumber }), nil
+}
+
+// DeleteChallengesByPrefix deletes all pending OTP challenges for phone numbers starting with prefix
+func (r *InMemoryOTPRepository) DeleteChallengesByPrefix(ctx context.Context, prefix string) (int64, error) {
+	return r.deleteChallenges(func(p string) bool { return strings.HasPrefix(p, prefix) }), nil
+}
+
+// deleteChallenges deletes the challenges of phone numbers matching match,
+// returning the number of challenges that had not expired yet
+func (r *InMemoryOTPRepository) deleteChallenges(match func(phoneNumber string) bool) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for id, stored := range r.challenges {
+		if !match(stored.challenge.PhoneNumber) {
+			continue
+		}
+		// Expired challenges are already gone in Redis and are not counted
+		if now.Before(stored.expiresAt) {
+			deleted++
+		}
+		delete(r.challenges, id)
+	}
+	return deleted
+}
+
+// AcquireResendCooldown starts a resend cooldown for a phone number unless one is running,
+// returning the remaining time of the running cooldown or zero if it was started
+func (r *InMemoryOTPRepository) AcquireResendCooldown(ctx context.Context, phoneNumber string, cooldown time.Duration) (time.Duration, error) {
+	if cooldown <= 0 {
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := r.cooldowns[phoneNumber]; ok && now.Before(until) {
+		return until.Sub(now), nil
+	}
+	r.cooldowns[phoneNumber] = now.Add(cooldown)
+	return 0, nil
+}
+
+// GetLockout returns the verification lockout state for a phone number
+func (r *InMemoryOTPRepository) GetLockout(ctx context.Context, phoneNumber string) (*models.LockoutState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := r.lockouts[phoneNumber]; ok && now.Before(until) {
+		return &models.LockoutState{Locked: true, RetryAfter: until.Sub(now)}, nil
+	}
+
+	var failures int
+	if f, ok := r.failures[phoneNumber]; ok && now.Before(f.expiresAt) {
+		failures = f.count
+	}
+	return &models.LockoutState{FailedAttempts: failures}, nil
+}
+
+// RecordFailedVerification counts a failed verification for a phone number and locks it
+// for cooldown once maxAttempts failures happened within window
+func (r *InMemoryOTPRepository) RecordFailedVerification(ctx context.Context, phoneNumber string, maxAttempts int, window, cooldown time.Duration) (*models.LockoutState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := r.lockouts[phoneNumber]; ok && now.Before(until) {
+		return &models.LockoutState{Locked: true, RetryAfter: until.Sub(now)}, nil
+	}
+
+	f, ok := r.failures[phoneNumber]
+	if !ok || !now.Before(f.expiresAt) {
+		f = failedVerifications{expiresAt: now.Add(window)}
+	}
+	f.count++
+
+	if f.count >= maxAttempts {
+		delete(r.failures, phoneNumber)
+		r.lockouts[phoneNumber] = now.Add(cooldown)
+		return &models.LockoutState{FailedAttempts: f.count, Locked: true, RetryAfter: cooldown}, nil
+	}
+
+	r.failures[phoneNumber] = f
+	return &models.LockoutState{FailedAttempts: f.count}, nil
+}
+
+// ClearFailedVerifications resets the failed verification count and lockout for a phone number
+func (r *InMemoryOTPRepository) ClearFailedVerifications(ctx context.Context, phoneNumber string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.failures, phoneNumber)
+	delete(r.lockouts, phoneNumber)
+	return nil
+}
+
+// DeleteExpired deletes the expired challenges, cooldowns, failed verifications, lockouts
+// and tombstones, returning the number of records deleted
+func (r *InMemoryOTPRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for id, stored := range r.challenges {
+		if !now.Before(stored.expiresAt) {
+			delete(r.challenges, id)
+			deleted++
+		}
+	}
+	for phoneNumber, f := range r.failures {
+		if !now.Before(f.expiresAt) {
+			delete(r.failures, phoneNumber)
+			deleted++
+		}
+	}
+	deleted += deleteExpiredTimes(r.lockouts, now)
+	deleted += deleteExpiredTimes(r.cooldowns, now)
+	deleted += deleteExpiredTimes(r.tombstones, now)
+	return deleted, nil
+}
+
+// deleteExpiredTimes deletes the keys of m whose time is not after now, returning how many were deleted
+func deleteExpiredTimes(m map[string]time.Time, now time.Time) int64 {
+	var deleted int64
+	for key, until := range m {
+		if !now.Before(until) {
+			delete(m, key)
+			deleted++
+		}
+	}
+	return deleted
+}
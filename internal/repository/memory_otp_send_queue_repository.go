@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// queuedOTPSend is a job kept by InMemoryOTPSendQueueRepository
+type queuedOTPSend struct {
+	job   models.OTPSendJob
+	dueAt time.Time
+}
+
+// InMemoryOTPSendQueueRepository implements OTPSendQueueRepository in process memory.
+// It is intended for tests and single-instance deployments.
+type InMemoryOTPSendQueueRepository struct {
+	mu          sync.Mutex
+	jobs        map[string]*queuedOTPSend
+	deadLetters []models.OTPSendJob // newest first
+}
+
+// NewInMemoryOTPSendQueueRepository creates a new in-memory OTP send queue repository
+func NewInMemoryOTPSendQueueRepository() *InMemoryOTPSendQueueRepository {
+	return &InMemoryOTPSendQueueRepository{
+		jobs: make(map[string]*queuedOTPSend),
+	}
+}
+
+// Enqueue adds a job to the queue, due at once, unless maxLength jobs are queued already
+// or, with tenantMaxLength above 0, tenantMaxLength jobs of job.Tenant
+func (r *InMemoryOTPSendQueueRepository) Enqueue(ctx context.Context, job *models.OTPSendJob, maxLength, tenantMaxLength int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.jobs) >= maxLength {
+		return false, nil
+	}
+	if tenantMaxLength > 0 && r.tenantLength(job.Tenant) >= int64(tenantMaxLength) {
+		return false, nil
+	}
+	r.jobs[job.ID] = &queuedOTPSend{job: *job, dueAt: time.Now()}
+	return true, nil
+}
+
+// ClaimDue returns up to limit jobs due at now and leases them until leaseUntil
+func (r *InMemoryOTPSendQueueRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.OTPSendJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := []*queuedOTPSend{}
+	for _, queued := range r.jobs {
+		if !queued.dueAt.After(now) {
+			due = append(due, queued)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].dueAt.Before(due[j].dueAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]models.OTPSendJob, len(due))
+	for i, queued := range due {
+		queued.dueAt = leaseUntil
+		claimed[i] = queued.job
+	}
+	return claimed, nil
+}
+
+// Reschedule stores a claimed job's attempts and makes it due again at
+func (r *InMemoryOTPSendQueueRepository) Reschedule(ctx context.Context, job *models.OTPSendJob, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.jobs[job.ID] = &queuedOTPSend{job: *job, dueAt: at}
+	return nil
+}
+
+// Complete removes a job from the queue
+func (r *InMemoryOTPSendQueueRepository) Complete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.jobs, id)
+	return nil
+}
+
+// DeadLetter moves a job from the queue to the dead-letter list, which keeps the newest maxSize jobs
+func (r *InMemoryOTPSendQueueRepository) DeadLetter(ctx context.Context, job *models.OTPSendJob, maxSize int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.jobs, job.ID)
+	r.deadLetters = append([]models.OTPSendJob{*job}, r.deadLetters...)
+	if len(r.deadLetters) > maxSize {
+		r.deadLetters = r.deadLetters[:maxSize]
+	}
+	return nil
+}
+
+// DeadLetters returns the jobs on the dead-letter list, newest first
+func (r *InMemoryOTPSendQueueRepository) DeadLetters(ctx context.Context) ([]models.OTPSendJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]models.OTPSendJob{}, r.deadLetters...), nil
+}
+
+// Length returns the number of queued jobs, leased ones included
+func (r *InMemoryOTPSendQueueRepository) Length(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return int64(len(r.jobs)), nil
+}
+
+// TenantLength returns the number of queued jobs of a tenant, leased ones included
+func (r *InMemoryOTPSendQueueRepository) TenantLength(ctx context.Context, tenant string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.tenantLength(tenant), nil
+}
+
+// tenantLength counts the queued jobs of a tenant; r.mu must be held
+func (r *InMemoryOTPSendQueueRepository) tenantLength(tenant string) int64 {
+	var n int64
+	for _, queued := range r.jobs {
+		if queued.job.Tenant == tenant {
+			n++
+		}
+	}
+	return n
+}
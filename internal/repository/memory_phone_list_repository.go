@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryPhoneListRepository implements PhoneListRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryPhoneListRepository struct {
+	mu      sync.RWMutex
+	entries map[string]map[string]models.PhoneListEntry // list -> prefix -> entry
+}
+
+// NewInMemoryPhoneListRepository creates a new in-memory phone list repository
+func NewInMemoryPhoneListRepository() *InMemoryPhoneListRepository {
+	return &InMemoryPhoneListRepository{
+		entries: make(map[string]map[string]models.PhoneListEntry),
+	}
+}
+
+// Add puts a prefix on a list, reporting whether it was added or on the list already
+func (r *InMemoryPhoneListRepository) Add(ctx context.Context, entry *models.PhoneListEntry) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prefixes := r.entries[entry.List]
+	if prefixes == nil {
+		prefixes = make(map[string]models.PhoneListEntry)
+		r.entries[entry.List] = prefixes
+	}
+	if _, ok := prefixes[entry.Prefix]; ok {
+		return false, nil
+	}
+	prefixes[entry.Prefix] = *entry
+	return true, nil
+}
+
+// Remove takes a prefix off a list, reporting whether it was on the list
+func (r *InMemoryPhoneListRepository) Remove(ctx context.Context, list, prefix string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.entries[list][prefix]; !ok {
+		return false, nil
+	}
+	delete(r.entries[list], prefix)
+	return true, nil
+}
+
+// Match returns the entries of both lists whose prefix phoneNumber starts with
+func (r *InMemoryPhoneListRepository) Match(ctx context.Context, phoneNumber string) ([]models.PhoneListEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := []models.PhoneListEntry{}
+	for _, prefixes := range r.entries {
+		for prefix, entry := range prefixes {
+			if strings.HasPrefix(phoneNumber, prefix) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sortPhoneListEntries(entries)
+	return entries, nil
+}
+
+// List returns the entries of both lists ordered by list and prefix
+func (r *InMemoryPhoneListRepository) List(ctx context.Context) ([]models.PhoneListEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := []models.PhoneListEntry{}
+	for _, prefixes := range r.entries {
+		for _, entry := range prefixes {
+			entries = append(entries, entry)
+		}
+	}
+	sortPhoneListEntries(entries)
+	return entries, nil
+}
+
+// sortPhoneListEntries orders entries by list and prefix
+func sortPhoneListEntries(entries []models.PhoneListEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].List != entries[j].List {
+			return entries[i].List < entries[j].List
+		}
+		return entries[i].Prefix < entries[j].Prefix
+	})
+}
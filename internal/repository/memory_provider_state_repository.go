@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryProviderStateRepository implements ProviderStateRepository in process memory.
+// It is intended for tests and single-instance deployments.
+type InMemoryProviderStateRepository struct {
+	mu          sync.RWMutex
+	disabled    map[string]bool
+	health      map[string]*providerWindow
+	quarantined map[string]time.Time
+}
+
+// providerWindow holds a provider's send counts for one error rate window
+type providerWindow struct {
+	sent      int64
+	failed    int64
+	expiresAt time.Time
+}
+
+// NewInMemoryProviderStateRepository creates a new in-memory provider state repository
+func NewInMemoryProviderStateRepository() *InMemoryProviderStateRepository {
+	return &InMemoryProviderStateRepository{
+		disabled:    make(map[string]bool),
+		health:      make(map[string]*providerWindow),
+		quarantined: make(map[string]time.Time),
+	}
+}
+
+// DisabledProviders returns the names of providers taken out of rotation
+func (r *InMemoryProviderStateRepository) DisabledProviders(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.disabled))
+	for name := range r.disabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SetProviderEnabled puts a provider back into or takes it out of rotation
+func (r *InMemoryProviderStateRepository) SetProviderEnabled(ctx context.Context, name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if enabled {
+		delete(r.disabled, name)
+	} else {
+		r.disabled[name] = true
+	}
+	return nil
+}
+
+// RecordProviderResult counts a send through a provider, and whether it failed, in its error rate window
+func (r *InMemoryProviderStateRepository) RecordProviderResult(ctx context.Context, name string, failed bool, window time.Duration) (models.ProviderHealth, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	w, ok := r.health[name]
+	if !ok || !now.Before(w.expiresAt) {
+		w = &providerWindow{expiresAt: now.Add(window)}
+		r.health[name] = w
+	}
+	w.sent++
+	if failed {
+		w.failed++
+	}
+	return models.ProviderHealth{Sent: w.sent, Failed: w.failed}, nil
+}
+
+// QuarantineProvider takes a provider out of rotation for duration and starts its error count over
+func (r *InMemoryProviderStateRepository) QuarantineProvider(ctx context.Context, name string, duration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.quarantined[name] = time.Now().Add(duration)
+	delete(r.health, name)
+	return nil
+}
+
+// ResetProviderHealth ends a provider's quarantine and starts its error count over
+func (r *InMemoryProviderStateRepository) ResetProviderHealth(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.quarantined, name)
+	delete(r.health, name)
+	return nil
+}
+
+// ProvidersHealth returns the health of the named providers by name
+func (r *InMemoryProviderStateRepository) ProvidersHealth(ctx context.Context, names []string) (map[string]models.ProviderHealth, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	health := make(map[string]models.ProviderHealth, len(names))
+	for _, name := range names {
+		var h models.ProviderHealth
+		if w, ok := r.health[name]; ok && now.Before(w.expiresAt) {
+			h.Sent = w.sent
+			h.Failed = w.failed
+		}
+		if until, ok := r.quarantined[name]; ok && now.Before(until) {
+			until := until
+			h.QuarantinedUntil = &until
+		}
+		health[name] = h
+	}
+	return health, nil
+}
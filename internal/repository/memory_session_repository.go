@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// storedSession is a session kept by InMemorySessionRepository
+type storedSession struct {
+	session  models.Session
+	sequence int64 // orders sessions created at the same time
+}
+
+// InMemorySessionRepository implements SessionRepository in process memory.
+// It mirrors the Redis repository's behaviour and is intended for tests.
+type InMemorySessionRepository struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*storedSession
+	sequence int64
+}
+
+// NewInMemorySessionRepository creates a new in-memory session repository
+func NewInMemorySessionRepository() *InMemorySessionRepository {
+	return &InMemorySessionRepository{
+		sessions: make(map[uuid.UUID]*storedSession),
+	}
+}
+
+// Create stores a new session until it expires and revokes the user's oldest sessions
+// beyond maxSessions (unlimited if 0), returning the IDs of the revoked sessions
+func (r *InMemorySessionRepository) Create(ctx context.Context, session *models.Session, maxSessions int) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if !session.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("error storing session: already expired")
+	}
+
+	r.sequence++
+	r.sessions[session.ID] = &storedSession{session: *session, sequence: r.sequence}
+
+	revoked := []uuid.UUID{}
+	if maxSessions <= 0 {
+		return revoked, nil
+	}
+	live := r.userSessions(session.UserID, now)
+	for i := len(live) - 1; i >= maxSessions; i-- {
+		delete(r.sessions, live[i].session.ID)
+		revoked = append(revoked, live[i].session.ID)
+	}
+	return revoked, nil
+}
+
+// Get finds an unexpired session by ID
+func (r *InMemorySessionRepository) Get(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.sessions[id]
+	if !ok || !stored.session.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("session not found or expired")
+	}
+	session := stored.session
+	return &session, nil
+}
+
+// FindByRefreshTokenHash finds the unexpired session with the given refresh token hash
+func (r *InMemorySessionRepository) FindByRefreshTokenHash(ctx context.Context, refreshTokenHash string) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, stored := range r.sessions {
+		if stored.session.RefreshTokenHash == refreshTokenHash && stored.session.ExpiresAt.After(now) {
+			session := stored.session
+			return &session, nil
+		}
+	}
+	return nil, fmt.Errorf("session not found or expired")
+}
+
+// Rotate replaces the refresh token hash and last use of a session, reporting whether
+// oldRefreshTokenHash still belonged to it, so each refresh token is used only once
+func (r *InMemorySessionRepository) Rotate(ctx context.Context, session *models.Session, oldRefreshTokenHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.sessions[session.ID]
+	if !ok || stored.session.RefreshTokenHash != oldRefreshTokenHash || !stored.session.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	stored.session.RefreshTokenHash = session.RefreshTokenHash
+	stored.session.LastUsedAt = session.LastUsedAt
+	return true, nil
+}
+
+// ListByUser returns a user's unexpired sessions, newest first
+func (r *InMemorySessionRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := []models.Session{}
+	for _, stored := range r.userSessions(userID, time.Now()) {
+		sessions = append(sessions, stored.session)
+	}
+	return sessions, nil
+}
+
+// DeleteAllByUser deletes all of a user's sessions, returning the IDs of the deleted sessions
+func (r *InMemorySessionRepository) DeleteAllByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := []uuid.UUID{}
+	for _, stored := range r.userSessions(userID, time.Now()) {
+		delete(r.sessions, stored.session.ID)
+		deleted = append(deleted, stored.session.ID)
+	}
+	return deleted, nil
+}
+
+// userSessions returns a user's sessions unexpired at now, newest first. The caller holds r.mu.
+func (r *InMemorySessionRepository) userSessions(userID uuid.UUID, now time.Time) []*storedSession {
+	var sessions []*storedSession
+	for _, stored := range r.sessions {
+		if stored.session.UserID == userID && stored.session.ExpiresAt.After(now) {
+			sessions = append(sessions, stored)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].session.CreatedAt.Equal(sessions[j].session.CreatedAt) {
+			return sessions[i].session.CreatedAt.After(sessions[j].session.CreatedAt)
+		}
+		return sessions[i].sequence > sessions[j].sequence
+	})
+	return sessions
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemorySuppressionRepository implements SuppressionRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemorySuppressionRepository struct {
+	mu           sync.RWMutex
+	suppressions map[string]map[string]models.Suppression // phone number -> reason -> entry
+}
+
+// NewInMemorySuppressionRepository creates a new in-memory suppression repository
+func NewInMemorySuppressionRepository() *InMemorySuppressionRepository {
+	return &InMemorySuppressionRepository{
+		suppressions: make(map[string]map[string]models.Suppression),
+	}
+}
+
+// Add puts a phone number on the suppression list for a reason, reporting whether
+// it was added or already suppressed for that reason
+func (r *InMemorySuppressionRepository) Add(ctx context.Context, suppression *models.Suppression) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reasons := r.suppressions[suppression.PhoneNumber]
+	if reasons == nil {
+		reasons = make(map[string]models.Suppression)
+		r.suppressions[suppression.PhoneNumber] = reasons
+	}
+	if _, ok := reasons[suppression.Reason]; ok {
+		return false, nil
+	}
+	reasons[suppression.Reason] = *suppression
+	return true, nil
+}
+
+// Remove takes a phone number off the suppression list for a reason, or for every reason
+// if reason is empty, returning how many entries were removed
+func (r *InMemorySuppressionRepository) Remove(ctx context.Context, phoneNumber, reason string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reasons := r.suppressions[phoneNumber]
+	var removed int64
+	for stored := range reasons {
+		if reason == "" || stored == reason {
+			delete(reasons, stored)
+			removed++
+		}
+	}
+	if len(reasons) == 0 {
+		delete(r.suppressions, phoneNumber)
+	}
+	return removed, nil
+}
+
+// IsSuppressed reports whether a phone number is on the suppression list for any reason
+func (r *InMemorySuppressionRepository) IsSuppressed(ctx context.Context, phoneNumber string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.suppressions[phoneNumber]) > 0, nil
+}
+
+// List returns the whole suppression list, oldest first
+func (r *InMemorySuppressionRepository) List(ctx context.Context) ([]models.Suppression, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	suppressions := []models.Suppression{}
+	for _, reasons := range r.suppressions {
+		for _, suppression := range reasons {
+			suppressions = append(suppressions, suppression)
+		}
+	}
+	sort.Slice(suppressions, func(i, j int) bool {
+		a, b := suppressions[i], suppressions[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		if a.PhoneNumber != b.PhoneNumber {
+			return a.PhoneNumber < b.PhoneNumber
+		}
+		return a.Reason < b.Reason
+	})
+	return suppressions, nil
+}
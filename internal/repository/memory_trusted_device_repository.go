@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryTrustedDeviceRepository implements TrustedDeviceRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryTrustedDeviceRepository struct {
+	mu      sync.RWMutex
+	devices map[uuid.UUID]*models.TrustedDevice
+}
+
+// NewInMemoryTrustedDeviceRepository creates a new in-memory trusted device repository
+func NewInMemoryTrustedDeviceRepository() *InMemoryTrustedDeviceRepository {
+	return &InMemoryTrustedDeviceRepository{
+		devices: make(map[uuid.UUID]*models.TrustedDevice),
+	}
+}
+
+// Create stores a new trusted device
+func (r *InMemoryTrustedDeviceRepository) Create(ctx context.Context, device *models.TrustedDevice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *device
+	r.devices[device.ID] = &stored
+	return nil
+}
+
+// FindActiveByTokenHash finds the unrevoked, unexpired device with the given token hash
+func (r *InMemoryTrustedDeviceRepository) FindActiveByTokenHash(ctx context.Context, tokenHash string, now time.Time) (*models.TrustedDevice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, device := range r.devices {
+		if device.TokenHash == tokenHash && isActiveDevice(device, now) {
+			found := *device
+			return &found, nil
+		}
+	}
+	return nil, fmt.Errorf("error finding trusted device: %w", sql.ErrNoRows)
+}
+
+// MarkUsed records that a device signed in at usedAt
+func (r *InMemoryTrustedDeviceRepository) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if device, ok := r.devices[id]; ok {
+		device.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+// ListActiveByUser returns a user's unrevoked, unexpired devices, newest first
+func (r *InMemoryTrustedDeviceRepository) ListActiveByUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]models.TrustedDevice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	devices := []models.TrustedDevice{}
+	for _, device := range r.devices {
+		if device.UserID == userID && isActiveDevice(device, now) {
+			devices = append(devices, *device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if !devices[i].CreatedAt.Equal(devices[j].CreatedAt) {
+			return devices[i].CreatedAt.After(devices[j].CreatedAt)
+		}
+		return devices[i].ID.String() < devices[j].ID.String()
+	})
+	return devices, nil
+}
+
+// Revoke revokes one of a user's devices, reporting whether an unrevoked device was found
+func (r *InMemoryTrustedDeviceRepository) Revoke(ctx context.Context, userID, id uuid.UUID, revokedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device, ok := r.devices[id]
+	if !ok || device.UserID != userID || device.RevokedAt != nil {
+		return false, nil
+	}
+	device.RevokedAt = &revokedAt
+	return true, nil
+}
+
+// isActiveDevice reports whether a device is neither revoked nor expired at now
+func isActiveDevice(device *models.TrustedDevice, now time.Time) bool {
+	return device.RevokedAt == nil && device.ExpiresAt.After(now)
+}
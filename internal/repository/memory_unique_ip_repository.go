@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// InMemoryUniqueIPRepository implements UniqueIPRepository in process memory with exact counts.
+// It is intended for tests and single-instance deployments.
+type InMemoryUniqueIPRepository struct {
+	mu   sync.RWMutex
+	days map[string]map[string]map[string]bool // day -> endpoint -> IPs
+}
+
+// NewInMemoryUniqueIPRepository creates a new in-memory unique IP repository
+func NewInMemoryUniqueIPRepository() *InMemoryUniqueIPRepository {
+	return &InMemoryUniqueIPRepository{
+		days: make(map[string]map[string]map[string]bool),
+	}
+}
+
+// AddIPs records the client IPs that requested each endpoint on the UTC day of day
+func (r *InMemoryUniqueIPRepository) AddIPs(ctx context.Context, day time.Time, ipsByEndpoint map[string][]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := day.UTC().Format("2006-01-02")
+	if r.days[key] == nil {
+		r.days[key] = make(map[string]map[string]bool)
+	}
+	for endpoint, ips := range ipsByEndpoint {
+		if r.days[key][endpoint] == nil {
+			r.days[key][endpoint] = make(map[string]bool)
+		}
+		for _, ip := range ips {
+			r.days[key][endpoint][ip] = true
+		}
+	}
+	return nil
+}
+
+// CountIPs counts the distinct client IPs that requested each endpoint on the UTC day of day
+func (r *InMemoryUniqueIPRepository) CountIPs(ctx context.Context, day time.Time) (map[string]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	endpoints := r.days[day.UTC().Format("2006-01-02")]
+	counts := make(map[string]int64, len(endpoints))
+	for endpoint, ips := range endpoints {
+		counts[endpoint] = int64(len(ips))
+	}
+	return counts, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"sync"
+)
+
+// InMemoryUnitOfWork implements UnitOfWork over in-memory repositories, for tests. Units of
+// work run one at a time against copies of the repositories, so their changes are applied
+// together when fn succeeds and discarded when it fails.
+type InMemoryUnitOfWork struct {
+	mu     sync.Mutex
+	users  *InMemoryUserRepository
+	audit  *InMemoryAuditRepository
+	events *InMemoryEventRepository
+	logins *InMemoryLoginHistoryRepository
+}
+
+// NewInMemoryUnitOfWork creates a new in-memory unit of work over the given repositories
+func NewInMemoryUnitOfWork(
+	users *InMemoryUserRepository,
+	audit *InMemoryAuditRepository,
+	events *InMemoryEventRepository,
+	logins *InMemoryLoginHistoryRepository,
+) *InMemoryUnitOfWork {
+	return &InMemoryUnitOfWork{users: users, audit: audit, events: events, logins: logins}
+}
+
+// WithTx runs fn against copies of the repositories, applying its changes to them if fn
+// returns nil and discarding them otherwise
+func (u *InMemoryUnitOfWork) WithTx(ctx context.Context, fn func(repos Repositories) error) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	users, applyUsers := u.users.stage()
+	audit, applyAudit := u.audit.stage()
+	events, applyEvents := u.events.stage()
+	logins, applyLogins := u.logins.stage()
+	err := fn(Repositories{
+		Users:  NewEventRecordingUserRepository(users, events),
+		Audit:  audit,
+		Events: events,
+		Logins: logins,
+	})
+	if err != nil {
+		return err
+	}
+
+	applyUsers()
+	applyAudit()
+	applyEvents()
+	applyLogins()
+	return nil
+}
@@ -0,0 +1,495 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryUserRepository implements UserRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests;
+// lookups that find nothing wrap sql.ErrNoRows like their PostgreSQL counterparts, user
+// lookups as ErrUserNotFound.
+type InMemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[uuid.UUID]*models.User
+}
+
+// NewInMemoryUserRepository creates a new in-memory user repository
+func NewInMemoryUserRepository() *InMemoryUserRepository {
+	return &InMemoryUserRepository{
+		users: make(map[uuid.UUID]*models.User),
+	}
+}
+
+// Create creates a new user whose phone number was just verified by OTP
+func (r *InMemoryUserRepository) Create(ctx context.Context, phoneNumber string) (*models.User, error) {
+	source := models.VerifiedSourceOTP
+	return r.create(phoneNumber, true, &source)
+}
+
+// FindOrCreateByPhoneNumber returns the user with a phone number, creating them if there is none
+func (r *InMemoryUserRepository) FindOrCreateByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user := r.findByPhoneNumber(phoneNumber); user != nil {
+		if user.DeletedAt != nil {
+			return nil, false, fmt.Errorf("error finding user by phone number: %w", ErrUserNotFound)
+		}
+		return copyUser(user), false, nil
+	}
+
+	source := models.VerifiedSourceOTP
+	return copyUser(r.insert(phoneNumber, true, &source)), true, nil
+}
+
+// CreateImported creates a user brought in from another system
+func (r *InMemoryUserRepository) CreateImported(ctx context.Context, phoneNumber string, phoneVerified bool, verifiedSource *string) (*models.User, error) {
+	return r.create(phoneNumber, phoneVerified, verifiedSource)
+}
+
+// create stores a new user with the given phone verification status
+func (r *InMemoryUserRepository) create(phoneNumber string, phoneVerified bool, verifiedSource *string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Phone numbers are unique across active and soft-deleted users
+	for _, user := range r.users {
+		if user.PhoneNumber == phoneNumber {
+			return nil, fmt.Errorf("error creating user: phone number %s already exists", phoneNumber)
+		}
+	}
+
+	return copyUser(r.insert(phoneNumber, phoneVerified, verifiedSource)), nil
+}
+
+// insert stores a new user with a phone number not taken by any user; r.mu must be held for writing
+func (r *InMemoryUserRepository) insert(phoneNumber string, phoneVerified bool, verifiedSource *string) *models.User {
+	now := time.Now()
+	user := &models.User{
+		ID:               uuid.New(),
+		PhoneNumber:      phoneNumber,
+		Role:             models.RoleUser,
+		PhoneVerified:    phoneVerified,
+		AnalyticsConsent: true,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if verifiedSource != nil {
+		source := *verifiedSource
+		user.VerifiedSource = &source
+	}
+	r.users[user.ID] = user
+	return user
+}
+
+// FindByID finds a user by ID
+func (r *InMemoryUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, fmt.Errorf("error finding user by ID: %w", ErrUserNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+// FindByPhoneNumber finds a user by phone number
+func (r *InMemoryUserRepository) FindByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user := r.findByPhoneNumber(phoneNumber)
+	if user == nil || user.DeletedAt != nil {
+		return nil, fmt.Errorf("error finding user by phone number: %w", ErrUserNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+// List returns a list of users with pagination and search
+func (r *InMemoryUserRepository) List(ctx context.Context, params models.PaginationParams) ([]models.User, int64, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 10
+	}
+
+	r.mu.RLock()
+	var matched []models.User
+	for _, user := range r.users {
+		if user.DeletedAt != nil {
+			continue
+		}
+		if params.Search != "" && !strings.Contains(user.PhoneNumber, params.Search) {
+			continue
+		}
+		if params.CreatedAfter != nil && user.CreatedAt.Before(*params.CreatedAfter) {
+			continue
+		}
+		if params.CreatedBefore != nil && !user.CreatedAt.Before(*params.CreatedBefore) {
+			continue
+		}
+		if !hasMetadata(user, params.Metadata) {
+			continue
+		}
+		matched = append(matched, *copyUser(user))
+	}
+	r.mu.RUnlock()
+
+	// Newest first unless asked otherwise, like the PostgreSQL repository
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if params.SortBy == models.UserSortPhoneNumber && !params.Keyset() && a.PhoneNumber != b.PhoneNumber {
+			return (a.PhoneNumber < b.PhoneNumber) == params.Ascending()
+		}
+		if params.Ascending() {
+			a, b = b, a
+		}
+		return userPosition{a.CreatedAt, a.ID}.precedes(b.CreatedAt, b.ID)
+	})
+
+	if params.Keyset() {
+		return listAfter(matched, params)
+	}
+
+	// Estimates are exact here
+	totalCount := int64(len(matched))
+	if params.IncludeTotal == models.IncludeTotalFalse {
+		totalCount = 0
+	}
+
+	// Apply pagination
+	offset := (params.Page - 1) * params.PageSize
+	if offset >= len(matched) {
+		return []models.User{}, totalCount, nil
+	}
+	end := offset + params.PageSize
+	if !params.Counted() {
+		end++
+	}
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	return matched[offset:end], totalCount, nil
+}
+
+// listAfter returns up to params.Limit of the users, sorted by creation time, after params.Cursor
+func listAfter(users []models.User, params models.PaginationParams) ([]models.User, int64, error) {
+	if params.Limit <= 0 {
+		params.Limit = 10
+	}
+	if params.Cursor != "" {
+		position, err := parseUserCursor(params.Cursor)
+		if err != nil {
+			return nil, 0, err
+		}
+		start := sort.Search(len(users), func(i int) bool {
+			if params.Ascending() {
+				return userPosition{users[i].CreatedAt, users[i].ID}.precedes(position.createdAt, position.id)
+			}
+			return position.precedes(users[i].CreatedAt, users[i].ID)
+		})
+		users = users[start:]
+	}
+	if len(users) > params.Limit {
+		users = users[:params.Limit]
+	}
+	return users, 0, nil
+}
+
+// Update updates a user
+func (r *InMemoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if other := r.findByPhoneNumber(user.PhoneNumber); other != nil && other.ID != user.ID {
+		return fmt.Errorf("error updating user: phone number %s already exists", user.PhoneNumber)
+	}
+
+	now := time.Now()
+	if stored, ok := r.users[user.ID]; ok && stored.DeletedAt == nil {
+		stored.PhoneNumber = user.PhoneNumber
+		stored.UpdatedAt = now
+	}
+
+	user.UpdatedAt = now
+	return nil
+}
+
+// MarkPhoneVerified records that a user's phone number was verified by source
+func (r *InMemoryUserRepository) MarkPhoneVerified(ctx context.Context, id uuid.UUID, source string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[id]; ok && user.DeletedAt == nil {
+		user.PhoneVerified = true
+		user.VerifiedSource = &source
+		user.UpdatedAt = time.Now()
+	}
+
+	return nil
+}
+
+// SetRole sets the role of a user
+func (r *InMemoryUserRepository) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return fmt.Errorf("error setting user role: %w", sql.ErrNoRows)
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// SetAnalyticsConsent sets whether a user consents to analytics
+func (r *InMemoryUserRepository) SetAnalyticsConsent(ctx context.Context, id uuid.UUID, consent bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return fmt.Errorf("error setting analytics consent: %w", sql.ErrNoRows)
+	}
+	user.AnalyticsConsent = consent
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// Stats counts active users by phone verification status and source
+func (r *InMemoryUserRepository) Stats(ctx context.Context) (*models.UserStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := &models.UserStats{VerifiedBySource: make(map[string]int64)}
+	for _, user := range r.users {
+		if user.DeletedAt != nil {
+			continue
+		}
+		stats.TotalUsers++
+		if !user.PhoneVerified {
+			stats.Unverified++
+			continue
+		}
+		stats.PhoneVerified++
+		source := ""
+		if user.VerifiedSource != nil {
+			source = *user.VerifiedSource
+		}
+		stats.VerifiedBySource[source]++
+	}
+
+	return stats, nil
+}
+
+// UpdateProfile sets the profile fields of a user given in update, leaving the others unchanged
+func (r *InMemoryUserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, update models.UpdateProfileRequest) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, fmt.Errorf("error updating user profile: %w", sql.ErrNoRows)
+	}
+	if update.FirstName != nil {
+		user.FirstName = *update.FirstName
+	}
+	if update.LastName != nil {
+		user.LastName = *update.LastName
+	}
+	if update.Email != nil {
+		user.Email = *update.Email
+	}
+	if update.AvatarURL != nil {
+		user.AvatarURL = *update.AvatarURL
+	}
+	user.UpdatedAt = time.Now()
+
+	return copyUser(user), nil
+}
+
+// UpdateMetadata sets the metadata keys of a user given with a value and removes those given
+// with nil, leaving the others unchanged
+func (r *InMemoryUserRepository) UpdateMetadata(ctx context.Context, id uuid.UUID, update map[string]*string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, fmt.Errorf("error updating user metadata: %w", sql.ErrNoRows)
+	}
+	for key, value := range update {
+		if value == nil {
+			delete(user.Metadata, key)
+			continue
+		}
+		if user.Metadata == nil {
+			user.Metadata = models.UserMetadata{}
+		}
+		user.Metadata[key] = *value
+	}
+	user.UpdatedAt = time.Now()
+
+	return copyUser(user), nil
+}
+
+// Delete soft-deletes a user by setting its deleted_at marker
+func (r *InMemoryUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[id]; ok && user.DeletedAt == nil {
+		now := time.Now()
+		user.DeletedAt = &now
+		user.UpdatedAt = now
+	}
+
+	return nil
+}
+
+// FindDeletedByID finds a soft-deleted user by ID
+func (r *InMemoryUserRepository) FindDeletedByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, fmt.Errorf("error finding deleted user by ID: %w", ErrUserNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+// FindDeletedByPhoneNumber finds a soft-deleted user by phone number
+func (r *InMemoryUserRepository) FindDeletedByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user := r.findByPhoneNumber(phoneNumber)
+	if user == nil || user.DeletedAt == nil {
+		return nil, fmt.Errorf("error finding deleted user by phone number: %w", ErrUserNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+// Restore clears the deleted_at marker of a user deleted after the given time
+func (r *InMemoryUserRepository) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil || user.DeletedAt.Before(deletedAfter) {
+		return nil, fmt.Errorf("error restoring user: %w", sql.ErrNoRows)
+	}
+
+	user.DeletedAt = nil
+	user.UpdatedAt = time.Now()
+
+	return copyUser(user), nil
+}
+
+// Purge removes the users soft-deleted before deletedBefore
+func (r *InMemoryUserRepository) Purge(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []uuid.UUID
+	for id, user := range r.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(deletedBefore) {
+			delete(r.users, id)
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// stage returns a copy of the repository to make changes in and a function applying them to
+// the repository. Only the users changed in the copy are written back, so changes made to
+// other users in the meantime are kept.
+func (r *InMemoryUserRepository) stage() (*InMemoryUserRepository, func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	staged := NewInMemoryUserRepository()
+	before := make(map[uuid.UUID]*models.User, len(r.users))
+	for id, user := range r.users {
+		staged.users[id] = copyUser(user)
+		before[id] = copyUser(user)
+	}
+	return staged, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for id, user := range staged.users {
+			if previous, ok := before[id]; !ok || !reflect.DeepEqual(previous, user) {
+				r.users[id] = copyUser(user)
+			}
+		}
+		for id := range before {
+			if _, ok := staged.users[id]; !ok {
+				delete(r.users, id)
+			}
+		}
+	}
+}
+
+// findByPhoneNumber returns the stored user with the given phone number, deleted or not;
+// callers must hold r.mu
+func (r *InMemoryUserRepository) findByPhoneNumber(phoneNumber string) *models.User {
+	for _, user := range r.users {
+		if user.PhoneNumber == phoneNumber {
+			return user
+		}
+	}
+	return nil
+}
+
+// copyUser returns a copy of user so callers cannot mutate repository state
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	if user.VerifiedSource != nil {
+		source := *user.VerifiedSource
+		copied.VerifiedSource = &source
+	}
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+	if user.Metadata != nil {
+		copied.Metadata = make(models.UserMetadata, len(user.Metadata))
+		for key, value := range user.Metadata {
+			copied.Metadata[key] = value
+		}
+	}
+	return &copied
+}
+
+// hasMetadata reports whether a user has all keys of metadata with the same values
+func hasMetadata(user *models.User, metadata map[string]string) bool {
+	for key, value := range metadata {
+		if actual, ok := user.Metadata[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// InMemoryWebhookRepository implements WebhookRepository in process memory.
+// It mirrors the PostgreSQL repository's behaviour and is intended for tests.
+type InMemoryWebhookRepository struct {
+	mu           sync.RWMutex
+	deliveries   []*models.WebhookDelivery
+	lastSequence int64
+}
+
+// NewInMemoryWebhookRepository creates a new in-memory webhook repository
+func NewInMemoryWebhookRepository() *InMemoryWebhookRepository {
+	return &InMemoryWebhookRepository{}
+}
+
+// LastSequence returns the sequence number of the last domain event queued for webhooks
+func (r *InMemoryWebhookRepository) LastSequence(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastSequence, nil
+}
+
+// SetLastSequence stores the sequence number of the last domain event queued for webhooks,
+// unless a later one is stored already
+func (r *InMemoryWebhookRepository) SetLastSequence(ctx context.Context, sequence int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sequence > r.lastSequence {
+		r.lastSequence = sequence
+	}
+	return nil
+}
+
+// Enqueue stores new deliveries, skipping those already queued for the same endpoint and event
+func (r *InMemoryWebhookRepository) Enqueue(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		if r.queued(delivery.Endpoint, delivery.EventID) {
+			continue
+		}
+		delivery := delivery
+		r.deliveries = append(r.deliveries, &delivery)
+	}
+	return nil
+}
+
+// queued reports whether an event is queued for an endpoint already; callers must hold r.mu
+func (r *InMemoryWebhookRepository) queued(endpoint string, eventID uuid.UUID) bool {
+	for _, delivery := range r.deliveries {
+		if delivery.Endpoint == endpoint && delivery.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimDue returns up to limit pending deliveries due at now, earliest first, and postpones
+// them to leaseUntil so other instances don't attempt them at the same time
+func (r *InMemoryWebhookRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := []*models.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.Status == models.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]models.WebhookDelivery, len(due))
+	for i, delivery := range due {
+		delivery.NextAttemptAt = leaseUntil
+		claimed[i] = *delivery
+	}
+	return claimed, nil
+}
+
+// Update stores the outcome of a delivery attempt
+func (r *InMemoryWebhookRepository) Update(ctx context.Context, delivery *models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.deliveries {
+		if stored.ID == delivery.ID {
+			*stored = *delivery
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook delivery not found")
+}
+
+// Deliveries returns all queued deliveries in the order they were queued
+func (r *InMemoryWebhookRepository) Deliveries() []models.WebhookDelivery {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deliveries := make([]models.WebhookDelivery, len(r.deliveries))
+	for i, delivery := range r.deliveries {
+		deliveries[i] = *delivery
+	}
+	return deliveries
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresAbuseReportRepository implements AbuseReportRepository using PostgreSQL
+type PostgresAbuseReportRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresAbuseReportRepository creates a new PostgreSQL abuse report repository giving up on
+// calls after timeout, 0 for no limit
+func NewPostgresAbuseReportRepository(db *sqlx.DB, timeout time.Duration) *PostgresAbuseReportRepository {
+	return &PostgresAbuseReportRepository{db: db, timeout: timeout}
+}
+
+// Create stores a new abuse report
+func (r *PostgresAbuseReportRepository) Create(ctx context.Context, report *models.AbuseReport) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO abuse_reports (id, phone_number, reporter_type, details, ip_address, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		annotateQuery(ctx, query),
+		report.ID,
+		report.PhoneNumber,
+		report.ReporterType,
+		report.Details,
+		report.IPAddress,
+		report.Status,
+		report.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating abuse report: %w", err)
+	}
+	return nil
+}
+
+// List returns a page of abuse reports with the given status, or of every status if empty, oldest first
+func (r *PostgresAbuseReportRepository) List(ctx context.Context, params models.AbuseReportListParams) ([]models.AbuseReport, int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	offset := (params.Page - 1) * params.PageSize
+
+	// $1 = '' matches every status
+	countQuery := `SELECT COUNT(*) FROM abuse_reports WHERE ($1 = '' OR status = $1)`
+	query := `
+		SELECT id, phone_number, reporter_type, details, ip_address, status, created_at, reviewed_at, reviewed_by
+		FROM abuse_reports
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY created_at, id
+		LIMIT $2 OFFSET $3
+	`
+
+	var totalCount int64
+	if err := r.db.GetContext(ctx, &totalCount, annotateQuery(ctx, countQuery), params.Status); err != nil {
+		return nil, 0, fmt.Errorf("error counting abuse reports: %w", err)
+	}
+
+	reports := []models.AbuseReport{}
+	if err := r.db.SelectContext(ctx, &reports, annotateQuery(ctx, query), params.Status, params.PageSize, offset); err != nil {
+		return nil, 0, fmt.Errorf("error listing abuse reports: %w", err)
+	}
+
+	return reports, totalCount, nil
+}
+
+// GetByID finds an abuse report by ID
+func (r *PostgresAbuseReportRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.AbuseReport, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT id, phone_number, reporter_type, details, ip_address, status, created_at, reviewed_at, reviewed_by
+		FROM abuse_reports
+		WHERE id = $1
+	`
+
+	report := &models.AbuseReport{}
+	if err := r.db.GetContext(ctx, report, annotateQuery(ctx, query), id); err != nil {
+		return nil, fmt.Errorf("error finding abuse report by ID: %w", err)
+	}
+	return report, nil
+}
+
+// Review sets the status of a report and of the other pending reports of its phone number
+func (r *PostgresAbuseReportRepository) Review(ctx context.Context, id uuid.UUID, status string, reviewerID *uuid.UUID) (int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE abuse_reports
+		SET status = $1, reviewed_at = $2, reviewed_by = $3
+		WHERE phone_number = (SELECT phone_number FROM abuse_reports WHERE id = $4)
+		AND (id = $4 OR status = 'pending')
+	`
+
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), status, time.Now(), reviewerID, id)
+	if err != nil {
+		return 0, fmt.Errorf("error reviewing abuse report: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return 0, fmt.Errorf("abuse report not found")
+	}
+
+	return rowsAffected, nil
+}
+
+// HasActiveReports reports whether a phone number has a pending or confirmed abuse report
+func (r *PostgresAbuseReportRepository) HasActiveReports(ctx context.Context, phoneNumber string) (bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM abuse_reports
+			WHERE phone_number = $1 AND status IN ('pending', 'confirmed')
+		)
+	`
+
+	var reported bool
+	if err := r.db.GetContext(ctx, &reported, annotateQuery(ctx, query), phoneNumber); err != nil {
+		return false, fmt.Errorf("error checking abuse reports: %w", err)
+	}
+	return reported, nil
+}
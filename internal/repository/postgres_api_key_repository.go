@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresAPIKeyRepository implements APIKeyRepository using PostgreSQL
+type PostgresAPIKeyRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresAPIKeyRepository creates a new PostgreSQL API key repository giving up on
+// calls after timeout, 0 for no limit
+func NewPostgresAPIKeyRepository(db *sqlx.DB, timeout time.Duration) *PostgresAPIKeyRepository {
+	return &PostgresAPIKeyRepository{db: db, timeout: timeout}
+}
+
+// Create stores a new API key
+func (r *PostgresAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO api_keys (id, name, key_hash, key_prefix, scopes, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		annotateQuery(ctx, query),
+		key.ID,
+		key.Name,
+		key.KeyHash,
+		key.KeyPrefix,
+		key.Scopes,
+		key.CreatedBy,
+		key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating API key: %w", err)
+	}
+	return nil
+}
+
+// FindActiveByKeyHash finds the unrevoked API key with the given key hash
+func (r *PostgresAPIKeyRepository) FindActiveByKeyHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT id, name, key_hash, key_prefix, scopes, created_by, created_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL
+	`
+
+	key := &models.APIKey{}
+	if err := r.db.GetContext(ctx, key, annotateQuery(ctx, query), keyHash); err != nil {
+		return nil, fmt.Errorf("error finding API key: %w", err)
+	}
+	return key, nil
+}
+
+// MarkUsed records that a key authenticated a request at usedAt
+func (r *PostgresAPIKeyRepository) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`
+
+	if _, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), usedAt, id); err != nil {
+		return fmt.Errorf("error updating API key: %w", err)
+	}
+	return nil
+}
+
+// List returns every API key, revoked ones included, newest first
+func (r *PostgresAPIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT id, name, key_hash, key_prefix, scopes, created_by, created_at, last_used_at, revoked_at
+		FROM api_keys
+		ORDER BY created_at DESC, id
+	`
+
+	keys := []models.APIKey{}
+	if err := r.db.SelectContext(ctx, &keys, annotateQuery(ctx, query)); err != nil {
+		return nil, fmt.Errorf("error listing API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke revokes an API key, reporting whether an unrevoked key was found
+func (r *PostgresAPIKeyRepository) Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) (bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), revokedAt, id)
+	if err != nil {
+		return false, fmt.Errorf("error revoking API key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
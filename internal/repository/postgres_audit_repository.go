@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresAuditRepository implements AuditRepository using PostgreSQL
+type PostgresAuditRepository struct {
+	db      sqlx.ExtContext
+	timeout time.Duration
+}
+
+// NewPostgresAuditRepository creates a new PostgreSQL audit repository running its
+// queries on db, a database or a transaction, giving up on calls after timeout, 0 for no limit
+func NewPostgresAuditRepository(db sqlx.ExtContext, timeout time.Duration) *PostgresAuditRepository {
+	return &PostgresAuditRepository{db: db, timeout: timeout}
+}
+
+// Create records a new audit log entry
+func (r *PostgresAuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO audit_logs (id, actor_id, actor_type, action, target_type, target_id, ip_address, user_agent, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if entry.ActorType == "" {
+		entry.ActorType = models.AuditActorUser
+	}
+	metadata := "{}"
+	if len(entry.Metadata) > 0 {
+		metadata = string(entry.Metadata)
+	}
+
+	_, err := r.db.ExecContext(
+		ctx,
+		annotateQuery(ctx, query),
+		entry.ID,
+		entry.ActorID,
+		entry.ActorType,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetID,
+		entry.IPAddress,
+		entry.UserAgent,
+		metadata,
+		entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating audit log: %w", err)
+	}
+
+	return nil
+}
+
+// ListByTarget returns the latest limit entries about a target, newest first, and how many
+// entries there are about it
+func (r *PostgresAuditRepository) ListByTarget(ctx context.Context, targetType, targetID string, limit int) ([]models.AuditLog, int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	countQuery := `SELECT COUNT(*) FROM audit_logs WHERE target_type = $1 AND target_id = $2`
+	query := `
+		SELECT id, actor_id, actor_type, action, target_type, target_id, ip_address, user_agent, metadata, created_at
+		FROM audit_logs
+		WHERE target_type = $1 AND target_id = $2
+		ORDER BY created_at DESC, id
+		LIMIT $3
+	`
+
+	var totalCount int64
+	if err := sqlx.GetContext(ctx, r.db, &totalCount, annotateQuery(ctx, countQuery), targetType, targetID); err != nil {
+		return nil, 0, fmt.Errorf("error counting audit logs: %w", err)
+	}
+
+	entries := []models.AuditLog{}
+	if err := sqlx.SelectContext(ctx, r.db, &entries, annotateQuery(ctx, query), targetType, targetID, limit); err != nil {
+		return nil, 0, fmt.Errorf("error listing audit logs: %w", err)
+	}
+
+	return entries, totalCount, nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresBackupCodeRepository implements BackupCodeRepository using PostgreSQL
+type PostgresBackupCodeRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresBackupCodeRepository creates a new PostgreSQL backup code repository giving up on
+// calls after timeout, 0 for no limit
+func NewPostgresBackupCodeRepository(db *sqlx.DB, timeout time.Duration) *PostgresBackupCodeRepository {
+	return &PostgresBackupCodeRepository{db: db, timeout: timeout}
+}
+
+// ReplaceBackupCodes replaces all backup codes of a user with the given code hashes
+func (r *PostgresBackupCodeRepository) ReplaceBackupCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Generating a new set invalidates the previous one, used or not
+	_, err = tx.ExecContext(ctx, annotateQuery(ctx, `DELETE FROM backup_codes WHERE user_id = $1`), userID)
+	if err != nil {
+		return fmt.Errorf("error deleting backup codes: %w", err)
+	}
+
+	query := `
+		INSERT INTO backup_codes (id, user_id, code_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	now := time.Now()
+	for _, codeHash := range codeHashes {
+		_, err = tx.ExecContext(ctx, annotateQuery(ctx, query), uuid.New(), userID, codeHash, now)
+		if err != nil {
+			return fmt.Errorf("error creating backup code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing backup codes: %w", err)
+	}
+
+	return nil
+}
+
+// UseBackupCode marks an unused backup code of a user as used
+func (r *PostgresBackupCodeRepository) UseBackupCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE backup_codes
+		SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), time.Now(), userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using backup code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresEventRepository implements EventRepository using PostgreSQL
+type PostgresEventRepository struct {
+	db      sqlx.ExtContext
+	timeout time.Duration
+}
+
+// NewPostgresEventRepository creates a new PostgreSQL domain event repository running its
+// queries on db, a database or a transaction, giving up on calls after timeout, 0 for no limit
+func NewPostgresEventRepository(db sqlx.ExtContext, timeout time.Duration) *PostgresEventRepository {
+	return &PostgresEventRepository{db: db, timeout: timeout}
+}
+
+// Append stores a domain event, assigning its sequence number
+func (r *PostgresEventRepository) Append(ctx context.Context, event *models.DomainEvent) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO domain_events (id, type, aggregate_type, aggregate_id, payload, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING sequence
+	`
+
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	payload := "{}"
+	if len(event.Payload) > 0 {
+		payload = string(event.Payload)
+	}
+
+	err := r.db.QueryRowxContext(
+		ctx,
+		annotateQuery(ctx, query),
+		event.ID,
+		event.Type,
+		event.AggregateType,
+		event.AggregateID,
+		payload,
+		event.OccurredAt,
+	).Scan(&event.Sequence)
+	if err != nil {
+		return fmt.Errorf("error appending domain event: %w", err)
+	}
+
+	return nil
+}
+
+// ListAfter returns up to limit events with a sequence number above afterSequence, in sequence order
+func (r *PostgresEventRepository) ListAfter(ctx context.Context, afterSequence int64, limit int) ([]models.DomainEvent, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT sequence, id, type, aggregate_type, aggregate_id, payload, occurred_at
+		FROM domain_events
+		WHERE sequence > $1
+		ORDER BY sequence
+		LIMIT $2
+	`
+
+	events := []models.DomainEvent{}
+	err := sqlx.SelectContext(ctx, r.db, &events, annotateQuery(ctx, query), afterSequence, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing domain events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ListByAggregate returns the latest limit events about an aggregate, newest first, and how
+// many events there are about it
+func (r *PostgresEventRepository) ListByAggregate(ctx context.Context, aggregateType, aggregateID string, limit int) ([]models.DomainEvent, int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	countQuery := `SELECT COUNT(*) FROM domain_events WHERE aggregate_type = $1 AND aggregate_id = $2`
+	query := `
+		SELECT sequence, id, type, aggregate_type, aggregate_id, payload, occurred_at
+		FROM domain_events
+		WHERE aggregate_type = $1 AND aggregate_id = $2
+		ORDER BY sequence DESC
+		LIMIT $3
+	`
+
+	var totalCount int64
+	if err := sqlx.GetContext(ctx, r.db, &totalCount, annotateQuery(ctx, countQuery), aggregateType, aggregateID); err != nil {
+		return nil, 0, fmt.Errorf("error counting domain events: %w", err)
+	}
+
+	events := []models.DomainEvent{}
+	if err := sqlx.SelectContext(ctx, r.db, &events, annotateQuery(ctx, query), aggregateType, aggregateID, limit); err != nil {
+		return nil, 0, fmt.Errorf("error listing domain events: %w", err)
+	}
+
+	return events, totalCount, nil
+}
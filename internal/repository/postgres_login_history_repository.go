@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresLoginHistoryRepository implements LoginHistoryRepository using PostgreSQL
+type PostgresLoginHistoryRepository struct {
+	db      sqlx.ExtContext
+	timeout time.Duration
+}
+
+// NewPostgresLoginHistoryRepository creates a new PostgreSQL login history repository running its
+// queries on db, a database or a transaction, giving up on calls after timeout, 0 for no limit
+func NewPostgresLoginHistoryRepository(db sqlx.ExtContext, timeout time.Duration) *PostgresLoginHistoryRepository {
+	return &PostgresLoginHistoryRepository{db: db, timeout: timeout}
+}
+
+// Record stores a login attempt
+func (r *PostgresLoginHistoryRepository) Record(ctx context.Context, attempt *models.LoginAttempt) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO login_attempts (id, user_id, phone_number, method, success, failure_reason, ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		annotateQuery(ctx, query),
+		attempt.ID,
+		attempt.UserID,
+		attempt.PhoneNumber,
+		attempt.Method,
+		attempt.Success,
+		attempt.FailureReason,
+		attempt.IPAddress,
+		attempt.UserAgent,
+		attempt.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording login attempt: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns a page of a user's login attempts, newest first
+func (r *PostgresLoginHistoryRepository) ListByUser(ctx context.Context, userID uuid.UUID, params models.PaginationParams) ([]models.LoginAttempt, int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	offset := (params.Page - 1) * params.PageSize
+
+	countQuery := `SELECT COUNT(*) FROM login_attempts WHERE user_id = $1`
+	query := `
+		SELECT id, user_id, phone_number, method, success, failure_reason, ip_address, user_agent, created_at
+		FROM login_attempts
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`
+
+	var totalCount int64
+	if err := sqlx.GetContext(ctx, r.db, &totalCount, annotateQuery(ctx, countQuery), userID); err != nil {
+		return nil, 0, fmt.Errorf("error counting login attempts: %w", err)
+	}
+
+	attempts := []models.LoginAttempt{}
+	if err := sqlx.SelectContext(ctx, r.db, &attempts, annotateQuery(ctx, query), userID, params.PageSize, offset); err != nil {
+		return nil, 0, fmt.Errorf("error listing login attempts: %w", err)
+	}
+
+	return attempts, totalCount, nil
+}
@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresOTPRepository implements OTPRepository using PostgreSQL, for deployments without
+// Redis for OTPs. Challenges are rows of otp_challenges and the resend cooldown and failed
+// verifications of a phone number a row of otp_rate_limits. Every expiry is a column compared
+// with the database clock, so instances with skewed clocks agree on it; reads ignore expired
+// rows, which DeleteExpired removes.
+type PostgresOTPRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresOTPRepository creates a new PostgreSQL OTP repository giving up on calls after
+// timeout, 0 for no limit
+func NewPostgresOTPRepository(db *sqlx.DB, timeout time.Duration) *PostgresOTPRepository {
+	return &PostgresOTPRepository{db: db, timeout: timeout}
+}
+
+// StoreChallenge stores an OTP challenge with expiration. Storing a challenge again replaces it
+// and makes it the latest of its phone number.
+func (r *PostgresOTPRepository) StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return fmt.Errorf("error encoding OTP challenge: %w", err)
+	}
+
+	query := `
+		INSERT INTO otp_challenges (id, phone_number, data, issued_at, expires_at)
+		VALUES ($1, $2, $3, NOW(), NOW() + $4 * INTERVAL '1 millisecond')
+		ON CONFLICT (id) DO UPDATE
+		SET data = EXCLUDED.data, issued_at = EXCLUDED.issued_at, expires_at = EXCLUDED.expires_at
+	`
+
+	_, err = r.db.ExecContext(ctx, annotateQuery(ctx, query), challenge.ID, challenge.PhoneNumber, string(data), expiration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("error storing OTP challenge: %w", err)
+	}
+	return nil
+}
+
+// GetChallenge retrieves a pending OTP challenge by ID
+func (r *PostgresOTPRepository) GetChallenge(ctx context.Context, id string) (*models.OTPChallenge, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT data FROM otp_challenges WHERE id = $1 AND expires_at > NOW()`
+	return r.getChallenge(ctx, query, id)
+}
+
+// GetLatestChallenge retrieves the most recently issued pending OTP challenge for a phone number
+func (r *PostgresOTPRepository) GetLatestChallenge(ctx context.Context, phoneNumber string) (*models.OTPChallenge, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT data FROM otp_challenges
+		WHERE phone_number = $1 AND expires_at > NOW()
+		ORDER BY issued_at DESC
+		LIMIT 1
+	`
+	return r.getChallenge(ctx, query, phoneNumber)
+}
+
+// getChallenge decodes the challenge query finds
+func (r *PostgresOTPRepository) getChallenge(ctx context.Context, query string, args ...interface{}) (*models.OTPChallenge, error) {
+	var data []byte
+	err := r.db.GetContext(ctx, &data, annotateQuery(ctx, query), args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("OTP not found or expired")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving OTP challenge: %w", err)
+	}
+
+	challenge := &models.OTPChallenge{}
+	if err := json.Unmarshal(data, challenge); err != nil {
+		return nil, fmt.Errorf("error decoding OTP challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// DeleteChallenge deletes an OTP challenge
+func (r *PostgresOTPRepository) DeleteChallenge(ctx context.Context, challenge *models.OTPChallenge) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `DELETE FROM otp_challenges WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), challenge.ID); err != nil {
+		return fmt.Errorf("error deleting OTP challenge: %w", err)
+	}
+	return nil
+}
+
+// DeleteChallengesByPhone deletes all pending OTP challenges for a phone number
+func (r *PostgresOTPRepository) DeleteChallengesByPhone(ctx context.Context, phoneNumber string) (int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `DELETE FROM otp_challenges WHERE phone_number = $1 AND expires_at > NOW()`
+	return r.deleteChallenges(ctx, query, phoneNumber)
+}
+
+// DeleteChallengesByPrefix deletes all pending OTP challenges for phone numbers starting with prefix
+func (r *PostgresOTPRepository) DeleteChallengesByPrefix(ctx context.Context, prefix string) (int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	// Compared as a prefix rather than with LIKE, so prefixes need no escaping
+	query := `DELETE FROM otp_challenges WHERE LEFT(phone_number, LENGTH($1)) = $1 AND expires_at > NOW()`
+	return r.deleteChallenges(ctx, query, prefix)
+}
+
+// deleteChallenges runs a delete of challenges, returning the number deleted
+func (r *PostgresOTPRepository) deleteChallenges(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), args...)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting OTP challenges: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error deleting OTP challenges: %w", err)
+	}
+	return deleted, nil
+}
+
+// AcquireResendCooldown starts a resend cooldown for a phone number unless one is running,
+// returning the remaining time of the running cooldown or zero if it was started
+func (r *PostgresOTPRepository) AcquireResendCooldown(ctx context.Context, phoneNumber string, cooldown time.Duration) (time.Duration, error) {
+	if cooldown <= 0 {
+		return 0, nil
+	}
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	// The row is only updated if its cooldown is over, so of concurrent calls one starts it
+	query := `
+		INSERT INTO otp_rate_limits (phone_number, cooldown_until)
+		VALUES ($1, NOW() + $2 * INTERVAL '1 millisecond')
+		ON CONFLICT (phone_number) DO UPDATE
+		SET cooldown_until = EXCLUDED.cooldown_until
+		WHERE otp_rate_limits.cooldown_until IS NULL OR otp_rate_limits.cooldown_until <= NOW()
+	`
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), phoneNumber, cooldown.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("error acquiring resend cooldown: %w", err)
+	}
+	if acquired, err := result.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("error acquiring resend cooldown: %w", err)
+	} else if acquired > 0 {
+		return 0, nil
+	}
+
+	// A separate statement, so it sees the cooldown a concurrent call started
+	query = `SELECT EXTRACT(EPOCH FROM cooldown_until - NOW()) * 1000 FROM otp_rate_limits WHERE phone_number = $1`
+	var remaining float64
+	if err := r.db.GetContext(ctx, &remaining, annotateQuery(ctx, query), phoneNumber); err != nil {
+		return 0, fmt.Errorf("error acquiring resend cooldown: %w", err)
+	}
+	return max(time.Duration(remaining*float64(time.Millisecond)), time.Millisecond), nil
+}
+
+// rateLimitRow is the failed verification state of a phone number, as of the database clock
+type rateLimitRow struct {
+	Failures     int64      `db:"failures"`
+	WindowEndsAt *time.Time `db:"window_ends_at"`
+	LockedUntil  *time.Time `db:"locked_until"`
+	Now          time.Time  `db:"now"`
+}
+
+// state returns the failures within the running window, if any, and the time left of the
+// lockout, 0 if the phone number isn't locked
+func (row rateLimitRow) state() (int64, time.Duration) {
+	failures := row.Failures
+	if row.WindowEndsAt == nil || !row.WindowEndsAt.After(row.Now) {
+		failures = 0
+	}
+	var locked time.Duration
+	if row.LockedUntil != nil && row.LockedUntil.After(row.Now) {
+		locked = row.LockedUntil.Sub(row.Now)
+	}
+	return failures, locked
+}
+
+// GetLockout returns the verification lockout state for a phone number
+func (r *PostgresOTPRepository) GetLockout(ctx context.Context, phoneNumber string) (*models.LockoutState, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT failures, window_ends_at, locked_until, NOW() AS now FROM otp_rate_limits WHERE phone_number = $1`
+
+	var row rateLimitRow
+	err := r.db.GetContext(ctx, &row, annotateQuery(ctx, query), phoneNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.LockoutState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting lockout: %w", err)
+	}
+
+	failures, locked := row.state()
+	if locked > 0 {
+		return &models.LockoutState{Locked: true, RetryAfter: locked}, nil
+	}
+	return &models.LockoutState{FailedAttempts: int(failures)}, nil
+}
+
+// RecordFailedVerification counts a failed verification for a phone number and locks it
+// for cooldown once maxAttempts failures happened within window. The phone number's row is
+// locked while it is counted, so concurrent guesses cannot exceed the limit.
+func (r *PostgresOTPRepository) RecordFailedVerification(ctx context.Context, phoneNumber string, maxAttempts int, window, cooldown time.Duration) (*models.LockoutState, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error recording failed verification: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO otp_rate_limits (phone_number) VALUES ($1)
+		ON CONFLICT (phone_number) DO UPDATE SET phone_number = EXCLUDED.phone_number
+		RETURNING failures, window_ends_at, locked_until, NOW() AS now
+	`
+	var row rateLimitRow
+	if err := tx.GetContext(ctx, &row, annotateQuery(ctx, query), phoneNumber); err != nil {
+		return nil, fmt.Errorf("error recording failed verification: %w", err)
+	}
+
+	failures, locked := row.state()
+	if locked > 0 {
+		return &models.LockoutState{Locked: true, RetryAfter: locked}, nil
+	}
+
+	failures++
+	windowEndsAt := row.WindowEndsAt
+	if failures == 1 {
+		ends := row.Now.Add(window)
+		windowEndsAt = &ends
+	}
+	result := &models.LockoutState{FailedAttempts: int(failures)}
+	var lockedUntil *time.Time
+	if failures >= int64(maxAttempts) {
+		until := row.Now.Add(cooldown)
+		lockedUntil = &until
+		result.Locked, result.RetryAfter = true, cooldown
+		failures, windowEndsAt = 0, nil
+	}
+
+	query = `UPDATE otp_rate_limits SET failures = $1, window_ends_at = $2, locked_until = $3 WHERE phone_number = $4`
+	if _, err := tx.ExecContext(ctx, annotateQuery(ctx, query), failures, windowEndsAt, lockedUntil, phoneNumber); err != nil {
+		return nil, fmt.Errorf("error recording failed verification: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error recording failed verification: %w", err)
+	}
+	return result, nil
+}
+
+// ClearFailedVerifications resets the failed verification count and lockout for a phone number
+func (r *PostgresOTPRepository) ClearFailedVerifications(ctx context.Context, phoneNumber string) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE otp_rate_limits SET failures = 0, window_ends_at = NULL, locked_until = NULL WHERE phone_number = $1`
+	if _, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), phoneNumber); err != nil {
+		return fmt.Errorf("error clearing failed verifications: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes the expired challenges and the rate limit rows whose cooldown, failure
+// window and lockout are all over, returning the number of rows deleted
+func (r *PostgresOTPRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	var deleted int64
+	for _, query := range []string{
+		`DELETE FROM otp_challenges WHERE expires_at <= NOW()`,
+		// GREATEST ignores NULLs, and is NULL only if all are
+		`DELETE FROM otp_rate_limits WHERE COALESCE(GREATEST(cooldown_until, window_ends_at, locked_until), '-infinity') <= NOW()`,
+	} {
+		result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query))
+		if err != nil {
+			return deleted, fmt.Errorf("error deleting expired OTPs: %w", err)
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			deleted += n
+		}
+	}
+	return deleted, nil
+}
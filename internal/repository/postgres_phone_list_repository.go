@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresPhoneListRepository implements PhoneListRepository using PostgreSQL
+type PostgresPhoneListRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresPhoneListRepository creates a new PostgreSQL phone list repository giving up on
+// calls after timeout, 0 for no limit
+func NewPostgresPhoneListRepository(db *sqlx.DB, timeout time.Duration) *PostgresPhoneListRepository {
+	return &PostgresPhoneListRepository{db: db, timeout: timeout}
+}
+
+// Add puts a prefix on a list, reporting whether it was added or on the list already
+func (r *PostgresPhoneListRepository) Add(ctx context.Context, entry *models.PhoneListEntry) (bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO phone_lists (list, prefix, reason, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (list, prefix) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(
+		ctx,
+		annotateQuery(ctx, query),
+		entry.List,
+		entry.Prefix,
+		entry.Reason,
+		entry.CreatedBy,
+		entry.CreatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error adding phone list entry: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Remove takes a prefix off a list, reporting whether it was on the list
+func (r *PostgresPhoneListRepository) Remove(ctx context.Context, list, prefix string) (bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `DELETE FROM phone_lists WHERE list = $1 AND prefix = $2`
+
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), list, prefix)
+	if err != nil {
+		return false, fmt.Errorf("error removing phone list entry: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Match returns the entries of both lists whose prefix phoneNumber starts with
+func (r *PostgresPhoneListRepository) Match(ctx context.Context, phoneNumber string) ([]models.PhoneListEntry, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	// Prefixes are digits with a leading plus, so they contain no LIKE wildcards
+	query := `
+		SELECT list, prefix, reason, created_by, created_at
+		FROM phone_lists
+		WHERE $1 LIKE prefix || '%'
+		ORDER BY list, prefix
+	`
+
+	entries := []models.PhoneListEntry{}
+	if err := r.db.SelectContext(ctx, &entries, annotateQuery(ctx, query), phoneNumber); err != nil {
+		return nil, fmt.Errorf("error matching phone lists: %w", err)
+	}
+	return entries, nil
+}
+
+// List returns the entries of both lists ordered by list and prefix
+func (r *PostgresPhoneListRepository) List(ctx context.Context) ([]models.PhoneListEntry, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT list, prefix, reason, created_by, created_at
+		FROM phone_lists
+		ORDER BY list, prefix
+	`
+
+	entries := []models.PhoneListEntry{}
+	if err := r.db.SelectContext(ctx, &entries, annotateQuery(ctx, query)); err != nil {
+		return nil, fmt.Errorf("error listing phone lists: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/requestid"
+)
+
+// annotateQuery prefixes a query with a comment naming the request it is run for, so slow
+// queries in pg_stat_activity and the Postgres logs can be traced back to the request.
+// Request IDs are validated by the request ID middleware and cannot close the comment.
+func annotateQuery(ctx context.Context, query string) string {
+	id := requestid.FromContext(ctx)
+	if id == "" || !requestid.Valid(id) {
+		return query
+	}
+	return "/* request_id=" + id + " */ " + query
+}
+
+// queryContext bounds ctx by timeout, so a slow or unreachable database can't hold up callers
+// whose contexts never end, such as background workers. Callers with a sooner deadline keep
+// theirs, and a timeout of 0 leaves ctx unbounded.
+func queryContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresSuppressionRepository implements SuppressionRepository using PostgreSQL
+type PostgresSuppressionRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresSuppressionRepository creates a new PostgreSQL suppression repository giving up on
+// calls after timeout, 0 for no limit
+func NewPostgresSuppressionRepository(db *sqlx.DB, timeout time.Duration) *PostgresSuppressionRepository {
+	return &PostgresSuppressionRepository{db: db, timeout: timeout}
+}
+
+// Add puts a phone number on the suppression list for a reason, reporting whether
+// it was added or already suppressed for that reason
+func (r *PostgresSuppressionRepository) Add(ctx context.Context, suppression *models.Suppression) (bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO suppressions (phone_number, reason, source, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (phone_number, reason) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(
+		ctx,
+		annotateQuery(ctx, query),
+		suppression.PhoneNumber,
+		suppression.Reason,
+		suppression.Source,
+		suppression.CreatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error adding suppression: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Remove takes a phone number off the suppression list for a reason, or for every reason
+// if reason is empty, returning how many entries were removed
+func (r *PostgresSuppressionRepository) Remove(ctx context.Context, phoneNumber, reason string) (int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	// $2 = '' matches every reason
+	query := `DELETE FROM suppressions WHERE phone_number = $1 AND ($2 = '' OR reason = $2)`
+
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), phoneNumber, reason)
+	if err != nil {
+		return 0, fmt.Errorf("error removing suppression: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// IsSuppressed reports whether a phone number is on the suppression list for any reason
+func (r *PostgresSuppressionRepository) IsSuppressed(ctx context.Context, phoneNumber string) (bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM suppressions WHERE phone_number = $1)`
+
+	var suppressed bool
+	if err := r.db.GetContext(ctx, &suppressed, annotateQuery(ctx, query), phoneNumber); err != nil {
+		return false, fmt.Errorf("error checking suppression list: %w", err)
+	}
+	return suppressed, nil
+}
+
+// List returns the whole suppression list, oldest first
+func (r *PostgresSuppressionRepository) List(ctx context.Context) ([]models.Suppression, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT phone_number, reason, source, created_at
+		FROM suppressions
+		ORDER BY created_at, phone_number, reason
+	`
+
+	suppressions := []models.Suppression{}
+	if err := r.db.SelectContext(ctx, &suppressions, annotateQuery(ctx, query)); err != nil {
+		return nil, fmt.Errorf("error listing suppressions: %w", err)
+	}
+	return suppressions, nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresTrustedDeviceRepository implements TrustedDeviceRepository using PostgreSQL
+type PostgresTrustedDeviceRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresTrustedDeviceRepository creates a new PostgreSQL trusted device repository giving up on
+// calls after timeout, 0 for no limit
+func NewPostgresTrustedDeviceRepository(db *sqlx.DB, timeout time.Duration) *PostgresTrustedDeviceRepository {
+	return &PostgresTrustedDeviceRepository{db: db, timeout: timeout}
+}
+
+// Create stores a new trusted device
+func (r *PostgresTrustedDeviceRepository) Create(ctx context.Context, device *models.TrustedDevice) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO trusted_devices (id, user_id, token_hash, name, user_agent, ip_address, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		annotateQuery(ctx, query),
+		device.ID,
+		device.UserID,
+		device.TokenHash,
+		device.Name,
+		device.UserAgent,
+		device.IPAddress,
+		device.CreatedAt,
+		device.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating trusted device: %w", err)
+	}
+	return nil
+}
+
+// FindActiveByTokenHash finds the unrevoked, unexpired device with the given token hash
+func (r *PostgresTrustedDeviceRepository) FindActiveByTokenHash(ctx context.Context, tokenHash string, now time.Time) (*models.TrustedDevice, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, token_hash, name, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at
+		FROM trusted_devices
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > $2
+	`
+
+	device := &models.TrustedDevice{}
+	if err := r.db.GetContext(ctx, device, annotateQuery(ctx, query), tokenHash, now); err != nil {
+		return nil, fmt.Errorf("error finding trusted device: %w", err)
+	}
+	return device, nil
+}
+
+// MarkUsed records that a device signed in at usedAt
+func (r *PostgresTrustedDeviceRepository) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE trusted_devices SET last_used_at = $1 WHERE id = $2`
+
+	if _, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), usedAt, id); err != nil {
+		return fmt.Errorf("error updating trusted device: %w", err)
+	}
+	return nil
+}
+
+// ListActiveByUser returns a user's unrevoked, unexpired devices, newest first
+func (r *PostgresTrustedDeviceRepository) ListActiveByUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]models.TrustedDevice, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, token_hash, name, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at
+		FROM trusted_devices
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC, id
+	`
+
+	devices := []models.TrustedDevice{}
+	if err := r.db.SelectContext(ctx, &devices, annotateQuery(ctx, query), userID, now); err != nil {
+		return nil, fmt.Errorf("error listing trusted devices: %w", err)
+	}
+	return devices, nil
+}
+
+// Revoke revokes one of a user's devices, reporting whether an unrevoked device was found
+func (r *PostgresTrustedDeviceRepository) Revoke(ctx context.Context, userID, id uuid.UUID, revokedAt time.Time) (bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE trusted_devices
+		SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), revokedAt, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("error revoking trusted device: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresUnitOfWork implements UnitOfWork with PostgreSQL transactions
+type PostgresUnitOfWork struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresUnitOfWork creates a new PostgreSQL unit of work whose transactions may take up to
+// timeout, 0 for no limit
+func NewPostgresUnitOfWork(db *sqlx.DB, timeout time.Duration) *PostgresUnitOfWork {
+	return &PostgresUnitOfWork{db: db, timeout: timeout}
+}
+
+// WithTx runs fn in a transaction, committing it if fn returns nil and rolling it back otherwise
+func (u *PostgresUnitOfWork) WithTx(ctx context.Context, fn func(repos Repositories) error) error {
+	ctx, cancel := queryContext(ctx, u.timeout)
+	defer cancel()
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	events := NewPostgresEventRepository(tx, u.timeout)
+	err = fn(Repositories{
+		Users:  NewEventRecordingUserRepository(NewPostgresUserRepository(tx, u.timeout), events),
+		Audit:  NewPostgresAuditRepository(tx, u.timeout),
+		Events: events,
+		Logins: NewPostgresLoginHistoryRepository(tx, u.timeout),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
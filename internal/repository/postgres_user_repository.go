@@ -2,30 +2,148 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/sqlbuilder"
 )
 
 // PostgresUserRepository implements UserRepository using PostgreSQL
 type PostgresUserRepository struct {
-	db *sqlx.DB
+	db         sqlx.ExtContext
+	timeout    time.Duration
+	statements atomic.Pointer[postgresUserStatements]
 }
 
-// NewPostgresUserRepository creates a new PostgreSQL user repository
-func NewPostgresUserRepository(db *sqlx.DB) *PostgresUserRepository {
-	return &PostgresUserRepository{db: db}
+// postgresUserStatements are the user lookups on the sign-in and authentication paths,
+// prepared by Prepare
+type postgresUserStatements struct {
+	findByID          *sqlx.Stmt
+	findByPhoneNumber *sqlx.Stmt
 }
 
-// Create creates a new user
+const (
+	findUserByIDQuery = `
+		SELECT id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	findUserByPhoneNumberQuery = `
+		SELECT id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
+		FROM users
+		WHERE phone_number = $1 AND deleted_at IS NULL
+	`
+)
+
+// NewPostgresUserRepository creates a new PostgreSQL user repository running its
+// queries on db, a database or a transaction, giving up on calls after timeout, 0 for no limit
+func NewPostgresUserRepository(db sqlx.ExtContext, timeout time.Duration) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db, timeout: timeout}
+}
+
+// Prepare prepares the lookups of users by ID and phone number, which then skip parsing and
+// planning on each call, and returns the statements so they can be prepared on more
+// connections ahead of use. Prepared lookups are not annotated with the request ID, as their
+// text is fixed. db must be a database or transaction that can prepare statements.
+func (r *PostgresUserRepository) Prepare(ctx context.Context) ([]*sql.Stmt, error) {
+	if statements := r.statements.Load(); statements != nil {
+		return []*sql.Stmt{statements.findByID.Stmt, statements.findByPhoneNumber.Stmt}, nil
+	}
+	preparer, ok := r.db.(sqlx.PreparerContext)
+	if !ok {
+		return nil, errors.New("error preparing user statements: database cannot prepare statements")
+	}
+
+	findByID, err := sqlx.PreparexContext(ctx, preparer, findUserByIDQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing user statements: %w", err)
+	}
+	findByPhoneNumber, err := sqlx.PreparexContext(ctx, preparer, findUserByPhoneNumberQuery)
+	if err != nil {
+		findByID.Close()
+		return nil, fmt.Errorf("error preparing user statements: %w", err)
+	}
+
+	statements := &postgresUserStatements{findByID: findByID, findByPhoneNumber: findByPhoneNumber}
+	if !r.statements.CompareAndSwap(nil, statements) {
+		// Prepared concurrently; keep the statements already in use
+		findByID.Close()
+		findByPhoneNumber.Close()
+		statements = r.statements.Load()
+	}
+	return []*sql.Stmt{statements.findByID.Stmt, statements.findByPhoneNumber.Stmt}, nil
+}
+
+// Create creates a new user whose phone number was just verified by OTP
 func (r *PostgresUserRepository) Create(ctx context.Context, phoneNumber string) (*models.User, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	source := models.VerifiedSourceOTP
+	return r.create(ctx, phoneNumber, true, &source)
+}
+
+// FindOrCreateByPhoneNumber returns the user with a phone number, creating them if there is none.
+// The insert does nothing if the phone number is taken, so concurrent calls cannot fail on the
+// unique constraint.
+func (r *PostgresUserRepository) FindOrCreateByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, bool, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO users (id, phone_number, phone_verified, verified_source, created_at, updated_at)
+		VALUES ($1, $2, TRUE, $3, $4, $5)
+		ON CONFLICT (phone_number) DO NOTHING
+		RETURNING id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
+	`
+
+	now := time.Now()
+	user := &models.User{}
+	err := r.db.QueryRowxContext(
+		ctx,
+		annotateQuery(ctx, query),
+		uuid.New(),
+		phoneNumber,
+		models.VerifiedSourceOTP,
+		now,
+		now,
+	).StructScan(user)
+	if err == nil {
+		return user, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("error creating user: %w", err)
+	}
+
+	// Nothing was inserted, so the user exists, unless they are soft-deleted
+	user, err = r.FindByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return nil, false, err
+	}
+	return user, false, nil
+}
+
+// CreateImported creates a user brought in from another system
+func (r *PostgresUserRepository) CreateImported(ctx context.Context, phoneNumber string, phoneVerified bool, verifiedSource *string) (*models.User, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	return r.create(ctx, phoneNumber, phoneVerified, verifiedSource)
+}
+
+// create inserts a new user with the given phone verification status
+func (r *PostgresUserRepository) create(ctx context.Context, phoneNumber string, phoneVerified bool, verifiedSource *string) (*models.User, error) {
 	query := `
-		INSERT INTO users (id, phone_number, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, phone_number, created_at, updated_at
+		INSERT INTO users (id, phone_number, phone_verified, verified_source, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
 	`
 
 	now := time.Now()
@@ -34,9 +152,11 @@ func (r *PostgresUserRepository) Create(ctx context.Context, phoneNumber string)
 	user := &models.User{}
 	err := r.db.QueryRowxContext(
 		ctx,
-		query,
+		annotateQuery(ctx, query),
 		id,
 		phoneNumber,
+		phoneVerified,
+		verifiedSource,
 		now,
 		now,
 	).StructScan(user)
@@ -47,18 +167,119 @@ func (r *PostgresUserRepository) Create(ctx context.Context, phoneNumber string)
 	return user, nil
 }
 
-// FindByID finds a user by ID
-func (r *PostgresUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+// MarkPhoneVerified records that a user's phone number was verified by source
+func (r *PostgresUserRepository) MarkPhoneVerified(ctx context.Context, id uuid.UUID, source string) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET phone_verified = TRUE, verified_source = $1, updated_at = $2
+		WHERE id = $3 AND deleted_at IS NULL
+	`
+
+	_, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), source, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("error marking phone verified: %w", err)
+	}
+
+	return nil
+}
+
+// SetRole sets the role of a user
+func (r *PostgresUserRepository) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET role = $1, updated_at = $2
+		WHERE id = $3 AND deleted_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), role, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("error setting user role: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("error setting user role: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// SetAnalyticsConsent sets whether a user consents to analytics
+func (r *PostgresUserRepository) SetAnalyticsConsent(ctx context.Context, id uuid.UUID, consent bool) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
 	query := `
-		SELECT id, phone_number, created_at, updated_at
+		UPDATE users
+		SET analytics_consent = $1, updated_at = $2
+		WHERE id = $3 AND deleted_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), consent, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("error setting analytics consent: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("error setting analytics consent: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// Stats counts active users by phone verification status and source
+func (r *PostgresUserRepository) Stats(ctx context.Context) (*models.UserStats, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT phone_verified, COALESCE(verified_source, '') AS verified_source, COUNT(*) AS count
 		FROM users
-		WHERE id = $1
+		WHERE deleted_at IS NULL
+		GROUP BY phone_verified, verified_source
 	`
 
+	var rows []struct {
+		PhoneVerified  bool   `db:"phone_verified"`
+		VerifiedSource string `db:"verified_source"`
+		Count          int64  `db:"count"`
+	}
+	err := sqlx.SelectContext(ctx, r.db, &rows, annotateQuery(ctx, query))
+	if err != nil {
+		return nil, fmt.Errorf("error counting users: %w", err)
+	}
+
+	stats := &models.UserStats{VerifiedBySource: make(map[string]int64)}
+	for _, row := range rows {
+		stats.TotalUsers += row.Count
+		if !row.PhoneVerified {
+			stats.Unverified += row.Count
+			continue
+		}
+		stats.PhoneVerified += row.Count
+		stats.VerifiedBySource[row.VerifiedSource] += row.Count
+	}
+
+	return stats, nil
+}
+
+// FindByID finds a user by ID
+func (r *PostgresUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
 	user := &models.User{}
-	err := r.db.GetContext(ctx, user, query, id)
+	var err error
+	if statements := r.statements.Load(); statements != nil {
+		err = statements.findByID.GetContext(ctx, user, id)
+	} else {
+		err = sqlx.GetContext(ctx, r.db, user, annotateQuery(ctx, findUserByIDQuery), id)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error finding user by ID: %w", err)
+		return nil, findUserError("error finding user by ID", err)
 	}
 
 	return user, nil
@@ -66,16 +287,18 @@ func (r *PostgresUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*m
 
 // FindByPhoneNumber finds a user by phone number
 func (r *PostgresUserRepository) FindByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
-	query := `
-		SELECT id, phone_number, created_at, updated_at
-		FROM users
-		WHERE phone_number = $1
-	`
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
 
 	user := &models.User{}
-	err := r.db.GetContext(ctx, user, query, phoneNumber)
+	var err error
+	if statements := r.statements.Load(); statements != nil {
+		err = statements.findByPhoneNumber.GetContext(ctx, user, phoneNumber)
+	} else {
+		err = sqlx.GetContext(ctx, r.db, user, annotateQuery(ctx, findUserByPhoneNumberQuery), phoneNumber)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error finding user by phone number: %w", err)
+		return nil, findUserError("error finding user by phone number", err)
 	}
 
 	return user, nil
@@ -83,6 +306,9 @@ func (r *PostgresUserRepository) FindByPhoneNumber(ctx context.Context, phoneNum
 
 // List returns a list of users with pagination and search
 func (r *PostgresUserRepository) List(ctx context.Context, params models.PaginationParams) ([]models.User, int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
 	if params.Page <= 0 {
 		params.Page = 1
 	}
@@ -90,60 +316,147 @@ func (r *PostgresUserRepository) List(ctx context.Context, params models.Paginat
 		params.PageSize = 10
 	}
 
-	// Calculate offset
-	offset := (params.Page - 1) * params.PageSize
+	builder := sqlbuilder.Select("id", "phone_number", "role", "phone_verified", "verified_source", "analytics_consent", "first_name", "last_name", "email", "avatar_url", "metadata", "created_at", "updated_at", "deleted_at").
+		From("users").
+		Where("deleted_at IS NULL")
+	if params.Search != "" {
+		builder.Where("phone_number LIKE ?", sqlbuilder.Contains(params.Search))
+	}
+	if params.CreatedAfter != nil {
+		builder.Where("created_at >= ?", *params.CreatedAfter)
+	}
+	if params.CreatedBefore != nil {
+		builder.Where("created_at < ?", *params.CreatedBefore)
+	}
+	if len(params.Metadata) > 0 {
+		builder.Where("metadata @> ?", models.UserMetadata(params.Metadata))
+	}
+	order := sqlbuilder.Desc
+	if params.Ascending() {
+		order = sqlbuilder.Asc
+	}
+	if params.Keyset() {
+		return r.listAfter(ctx, builder, params, order)
+	}
+	// Users created at the same time are ordered by ID, so pages don't overlap. One user more
+	// than the page tells whether more follow when they aren't counted.
+	limit := params.PageSize
+	if !params.Counted() {
+		limit++
+	}
+	builder.OrderBy(userSortColumn(params.SortBy), order).
+		OrderBy("id", order).
+		Limit(limit).
+		Offset((params.Page - 1) * params.PageSize)
 
-	// Base query
-	countQuery := `SELECT COUNT(*) FROM users`
-	query := `
-		SELECT id, phone_number, created_at, updated_at
-		FROM users
-	`
+	totalCount, err := r.count(ctx, builder, params)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	// Add search condition if provided
-	var args []interface{}
-	if params.Search != "" {
-		whereClause := `WHERE phone_number LIKE $1`
-		countQuery = countQuery + " " + whereClause
-		query = query + " " + whereClause
-		args = append(args, "%"+params.Search+"%")
+	// Get users
+	query, args, err := builder.ToSQL()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error building user list query: %w", err)
+	}
+	var users []models.User
+	err = sqlx.SelectContext(ctx, r.db, &users, annotateQuery(ctx, query), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing users: %w", err)
 	}
 
-	// Add pagination
-	query = query + ` ORDER BY created_at DESC LIMIT $` + fmt.Sprintf("%d", len(args)+1) +
-		` OFFSET $` + fmt.Sprintf("%d", len(args)+2)
+	return users, totalCount, nil
+}
 
-	args = append(args, params.PageSize, offset)
+// count returns the number of users builder matches, as asked for by params.IncludeTotal. The
+// estimate is the row count of the table statistics, which include deleted users, for lists
+// without search, creation time range or metadata; filtered lists are counted exactly.
+func (r *PostgresUserRepository) count(ctx context.Context, builder *sqlbuilder.SelectBuilder, params models.PaginationParams) (int64, error) {
+	if params.IncludeTotal == models.IncludeTotalFalse {
+		return 0, nil
+	}
+	filtered := params.Search != "" || params.CreatedAfter != nil || params.CreatedBefore != nil || len(params.Metadata) > 0
+	if params.IncludeTotal == models.IncludeTotalEstimate && !filtered {
+		var estimate int64
+		query := `SELECT reltuples::bigint FROM pg_class WHERE oid = 'users'::regclass`
+		if err := sqlx.GetContext(ctx, r.db, &estimate, annotateQuery(ctx, query)); err != nil {
+			return 0, fmt.Errorf("error estimating users: %w", err)
+		}
+		// Tables never analyzed have no estimate
+		if estimate >= 0 {
+			return estimate, nil
+		}
+	}
 
-	// Get total count
-	var totalCount int64
-	err := r.db.GetContext(ctx, &totalCount, countQuery, args[:len(args)-2]...)
+	query, args, err := builder.CountSQL()
 	if err != nil {
-		return nil, 0, fmt.Errorf("error counting users: %w", err)
+		return 0, fmt.Errorf("error building user count query: %w", err)
+	}
+	var totalCount int64
+	if err := sqlx.GetContext(ctx, r.db, &totalCount, annotateQuery(ctx, query), args...); err != nil {
+		return 0, fmt.Errorf("error counting users: %w", err)
 	}
+	return totalCount, nil
+}
 
-	// Get users
+// listAfter returns up to params.Limit users of builder's after params.Cursor by creation time,
+// in order. The users are found by seeking in the (created_at, id) index rather than by
+// skipping rows.
+func (r *PostgresUserRepository) listAfter(ctx context.Context, builder *sqlbuilder.SelectBuilder, params models.PaginationParams, order sqlbuilder.Order) ([]models.User, int64, error) {
+	if params.Limit <= 0 {
+		params.Limit = 10
+	}
+	if params.Cursor != "" {
+		position, err := parseUserCursor(params.Cursor)
+		if err != nil {
+			return nil, 0, err
+		}
+		if order == sqlbuilder.Asc {
+			builder.Where("(created_at, id) > (?, ?)", position.createdAt, position.id)
+		} else {
+			builder.Where("(created_at, id) < (?, ?)", position.createdAt, position.id)
+		}
+	}
+	builder.OrderBy("created_at", order).
+		OrderBy("id", order).
+		Limit(params.Limit)
+
+	query, args, err := builder.ToSQL()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error building user list query: %w", err)
+	}
 	var users []models.User
-	err = r.db.SelectContext(ctx, &users, query, args...)
+	err = sqlx.SelectContext(ctx, r.db, &users, annotateQuery(ctx, query), args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error listing users: %w", err)
 	}
+	return users, 0, nil
+}
 
-	return users, totalCount, nil
+// userSortColumn returns the column users are sorted by for sortBy, which clients choose, so
+// only known fields map to a column
+func userSortColumn(sortBy string) string {
+	if sortBy == models.UserSortPhoneNumber {
+		return "phone_number"
+	}
+	return "created_at"
 }
 
 // Update updates a user
 func (r *PostgresUserRepository) Update(ctx context.Context, user *models.User) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
 	query := `
 		UPDATE users
 		SET phone_number = $1, updated_at = $2
-		WHERE id = $3
+		WHERE id = $3 AND deleted_at IS NULL
 	`
 
 	now := time.Now()
 	_, err := r.db.ExecContext(
 		ctx,
-		query,
+		annotateQuery(ctx, query),
 		user.PhoneNumber,
 		now,
 		user.ID,
@@ -156,17 +469,184 @@ func (r *PostgresUserRepository) Update(ctx context.Context, user *models.User)
 	return nil
 }
 
-// Delete deletes a user
+// UpdateProfile sets the profile fields of a user given in update, leaving the others unchanged
+func (r *PostgresUserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, update models.UpdateProfileRequest) (*models.User, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET first_name = COALESCE($1, first_name),
+			last_name = COALESCE($2, last_name),
+			email = COALESCE($3, email),
+			avatar_url = COALESCE($4, avatar_url),
+			updated_at = $5
+		WHERE id = $6 AND deleted_at IS NULL
+		RETURNING id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
+	`
+
+	user := &models.User{}
+	err := r.db.QueryRowxContext(
+		ctx,
+		annotateQuery(ctx, query),
+		update.FirstName,
+		update.LastName,
+		update.Email,
+		update.AvatarURL,
+		time.Now(),
+		id,
+	).StructScan(user)
+	if err != nil {
+		return nil, fmt.Errorf("error updating user profile: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateMetadata sets the metadata keys of a user given with a value and removes those given
+// with nil, leaving the others unchanged
+func (r *PostgresUserRepository) UpdateMetadata(ctx context.Context, id uuid.UUID, update map[string]*string) (*models.User, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	set := models.UserMetadata{}
+	removed := []string{}
+	for key, value := range update {
+		if value == nil {
+			removed = append(removed, key)
+		} else {
+			set[key] = *value
+		}
+	}
+
+	query := `
+		UPDATE users
+		SET metadata = (metadata || $1::jsonb) - $2::text[], updated_at = $3
+		WHERE id = $4 AND deleted_at IS NULL
+		RETURNING id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
+	`
+
+	user := &models.User{}
+	err := r.db.QueryRowxContext(
+		ctx,
+		annotateQuery(ctx, query),
+		set,
+		pq.Array(removed),
+		time.Now(),
+		id,
+	).StructScan(user)
+	if err != nil {
+		return nil, fmt.Errorf("error updating user metadata: %w", err)
+	}
+
+	return user, nil
+}
+
+// Delete soft-deletes a user by setting its deleted_at marker
 func (r *PostgresUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
 	query := `
-		DELETE FROM users
-		WHERE id = $1
+		UPDATE users
+		SET deleted_at = $1, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NULL
 	`
 
-	_, err := r.db.ExecContext(ctx, query, id)
+	_, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("error deleting user: %w", err)
 	}
 
 	return nil
 }
+
+// FindDeletedByID finds a soft-deleted user by ID
+func (r *PostgresUserRepository) FindDeletedByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
+		FROM users
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+
+	user := &models.User{}
+	err := sqlx.GetContext(ctx, r.db, user, annotateQuery(ctx, query), id)
+	if err != nil {
+		return nil, findUserError("error finding deleted user by ID", err)
+	}
+
+	return user, nil
+}
+
+// FindDeletedByPhoneNumber finds a soft-deleted user by phone number
+func (r *PostgresUserRepository) FindDeletedByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		SELECT id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
+		FROM users
+		WHERE phone_number = $1 AND deleted_at IS NOT NULL
+	`
+
+	user := &models.User{}
+	err := sqlx.GetContext(ctx, r.db, user, annotateQuery(ctx, query), phoneNumber)
+	if err != nil {
+		return nil, findUserError("error finding deleted user by phone number", err)
+	}
+
+	return user, nil
+}
+
+// Restore clears the deleted_at marker of a user deleted after the given time
+func (r *PostgresUserRepository) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*models.User, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NOT NULL AND deleted_at >= $3
+		RETURNING id, phone_number, role, phone_verified, verified_source, analytics_consent, first_name, last_name, email, avatar_url, metadata, created_at, updated_at, deleted_at
+	`
+
+	user := &models.User{}
+	err := r.db.QueryRowxContext(ctx, annotateQuery(ctx, query), time.Now(), id, deletedAfter).StructScan(user)
+	if err != nil {
+		return nil, fmt.Errorf("error restoring user: %w", err)
+	}
+
+	return user, nil
+}
+
+// Purge permanently deletes the users soft-deleted before deletedBefore; their login history,
+// backup codes and trusted devices are deleted with them by the foreign keys
+func (r *PostgresUserRepository) Purge(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		DELETE FROM users
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		RETURNING id
+	`
+
+	var ids []uuid.UUID
+	err := sqlx.SelectContext(ctx, r.db, &ids, annotateQuery(ctx, query), deletedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("error purging deleted users: %w", err)
+	}
+
+	return ids, nil
+}
+
+// findUserError wraps the error of a user lookup, reporting that no user was found as ErrUserNotFound
+func findUserError(message string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUserNotFound
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// PostgresWebhookRepository implements WebhookRepository using PostgreSQL
+type PostgresWebhookRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewPostgresWebhookRepository creates a new PostgreSQL webhook repository giving up on
+// calls after timeout, 0 for no limit
+func NewPostgresWebhookRepository(db *sqlx.DB, timeout time.Duration) *PostgresWebhookRepository {
+	return &PostgresWebhookRepository{db: db, timeout: timeout}
+}
+
+// LastSequence returns the sequence number of the last domain event queued for webhooks
+func (r *PostgresWebhookRepository) LastSequence(ctx context.Context) (int64, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT COALESCE(MAX(last_sequence), 0) FROM webhook_cursor`
+
+	var sequence int64
+	if err := r.db.GetContext(ctx, &sequence, annotateQuery(ctx, query)); err != nil {
+		return 0, fmt.Errorf("error reading webhook cursor: %w", err)
+	}
+	return sequence, nil
+}
+
+// SetLastSequence stores the sequence number of the last domain event queued for webhooks,
+// unless a later one is stored already
+func (r *PostgresWebhookRepository) SetLastSequence(ctx context.Context, sequence int64) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO webhook_cursor (last_sequence)
+		VALUES ($1)
+		ON CONFLICT (id) DO UPDATE
+		SET last_sequence = GREATEST(webhook_cursor.last_sequence, EXCLUDED.last_sequence)
+	`
+
+	if _, err := r.db.ExecContext(ctx, annotateQuery(ctx, query), sequence); err != nil {
+		return fmt.Errorf("error storing webhook cursor: %w", err)
+	}
+	return nil
+}
+
+// Enqueue stores new deliveries, skipping those already queued for the same endpoint and event
+func (r *PostgresWebhookRepository) Enqueue(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO webhook_deliveries (id, endpoint, event_id, event_type, body, status, attempts, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (endpoint, event_id) DO NOTHING
+	`
+
+	for _, delivery := range deliveries {
+		_, err = tx.ExecContext(
+			ctx,
+			annotateQuery(ctx, query),
+			delivery.ID,
+			delivery.Endpoint,
+			delivery.EventID,
+			delivery.EventType,
+			delivery.Body,
+			delivery.Status,
+			delivery.Attempts,
+			delivery.NextAttemptAt,
+			delivery.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("error queueing webhook delivery: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimDue returns up to limit pending deliveries due at now, earliest first, and postpones
+// them to leaseUntil so other instances don't attempt them at the same time
+func (r *PostgresWebhookRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, endpoint, event_id, event_type, body, status, attempts, next_attempt_at, last_error, created_at, delivered_at
+	`
+
+	deliveries := []models.WebhookDelivery{}
+	if err := r.db.SelectContext(ctx, &deliveries, annotateQuery(ctx, query), leaseUntil, now, limit); err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Update stores the outcome of a delivery attempt
+func (r *PostgresWebhookRepository) Update(ctx context.Context, delivery *models.WebhookDelivery) error {
+	ctx, cancel := queryContext(ctx, r.timeout)
+	defer cancel()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, delivered_at = $5
+		WHERE id = $6
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		annotateQuery(ctx, query),
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	activeUsersKeyPrefix   = "active_users:"
+	activeUsersSequenceKey = "active_users:sequence"
+
+	// activeUsersDayRetention keeps daily sets long enough for the monthly count
+	activeUsersDayRetention = 31 * 24 * time.Hour
+)
+
+// setLastSequenceScript stores a sequence number unless a later one is stored already,
+// so instances feeding the read model concurrently never move it backwards.
+// KEYS: sequence. ARGV: sequence.
+var setLastSequenceScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if tonumber(ARGV[1]) > current then
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// RedisActiveUserRepository implements ActiveUserRepository using one HyperLogLog per UTC day,
+// so counting distinct users takes constant memory however many sign in
+type RedisActiveUserRepository struct {
+	client *redis.Client
+}
+
+// NewRedisActiveUserRepository creates a new Redis active user repository
+func NewRedisActiveUserRepository(client *redis.Client) *RedisActiveUserRepository {
+	return &RedisActiveUserRepository{client: client}
+}
+
+// RecordActivity records that a user was active on the UTC day of at
+func (r *RedisActiveUserRepository) RecordActivity(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	day := at.UTC().Truncate(24 * time.Hour)
+	key := activeUsersDayKey(day)
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.PFAdd(ctx, key, userID.String())
+		pipe.ExpireAt(ctx, key, day.Add(activeUsersDayRetention))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error recording user activity: %w", err)
+	}
+	return nil
+}
+
+// CountActive counts the distinct users active on the UTC days from since through until
+func (r *RedisActiveUserRepository) CountActive(ctx context.Context, since, until time.Time) (int64, error) {
+	var keys []string
+	for day := since.UTC().Truncate(24 * time.Hour); !day.After(until); day = day.Add(24 * time.Hour) {
+		keys = append(keys, activeUsersDayKey(day))
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	// PFCOUNT over several keys estimates the size of their union
+	count, err := r.client.PFCount(ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error counting active users: %w", err)
+	}
+	return count, nil
+}
+
+// LastSequence returns the sequence number of the last domain event fed to the read model
+func (r *RedisActiveUserRepository) LastSequence(ctx context.Context) (int64, error) {
+	sequence, err := r.client.Get(ctx, activeUsersSequenceKey).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error getting active users sequence: %w", err)
+	}
+	return sequence, nil
+}
+
+// SetLastSequence stores the sequence number of the last domain event fed to the read model
+func (r *RedisActiveUserRepository) SetLastSequence(ctx context.Context, sequence int64) error {
+	if err := setLastSequenceScript.Run(ctx, r.client, []string{activeUsersSequenceKey}, sequence).Err(); err != nil {
+		return fmt.Errorf("error setting active users sequence: %w", err)
+	}
+	return nil
+}
+
+// activeUsersDayKey returns the key of the HyperLogLog of users active on a UTC day
+func activeUsersDayKey(day time.Time) string {
+	return activeUsersKeyPrefix + day.Format("2006-01-02")
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const lockKeyPrefix = "lock:"
+
+// releaseLockScript deletes a lock if it is still held with the token it was taken with.
+// KEYS: lock. ARGV: token.
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLockRepository implements LockRepository using Redis
+type RedisLockRepository struct {
+	client *redis.Client
+}
+
+// NewRedisLockRepository creates a new Redis lock repository
+func NewRedisLockRepository(client *redis.Client) *RedisLockRepository {
+	return &RedisLockRepository{client: client}
+}
+
+// AcquireLock takes the lock named key for ttl unless it is held, returning the token to
+// release it with, or "" if another holder has it
+func (r *RedisLockRepository) AcquireLock(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	token := uuid.New().String()
+	acquired, err := r.client.SetNX(ctx, lockKeyPrefix+key, token, ttl).Result()
+	if err != nil {
+		return "", fmt.Errorf("error acquiring lock: %w", err)
+	}
+	if !acquired {
+		return "", nil
+	}
+	return token, nil
+}
+
+// ReleaseLock releases a lock taken with token. A lock that expired and was taken by
+// another holder in the meantime is left alone.
+func (r *RedisLockRepository) ReleaseLock(ctx context.Context, key, token string) error {
+	if err := releaseLockScript.Run(ctx, r.client, []string{lockKeyPrefix + key}, token).Err(); err != nil {
+		return fmt.Errorf("error releasing lock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/pubsub"
+)
+
+const (
+	loginStatusKeyPrefix   = "login_status:"
+	loginStatusTopicPrefix = "login_status:"
+)
+
+// RedisLoginStatusRepository implements LoginStatusRepository using Redis, notifying
+// subscribers on any instance through the pub/sub bus
+type RedisLoginStatusRepository struct {
+	client *redis.Client
+	bus    *pubsub.Bus
+}
+
+// NewRedisLoginStatusRepository creates a new Redis login status repository
+func NewRedisLoginStatusRepository(client *redis.Client, bus *pubsub.Bus) *RedisLoginStatusRepository {
+	return &RedisLoginStatusRepository{client: client, bus: bus}
+}
+
+// Save stores the login status of a challenge with expiration and notifies its subscribers
+func (r *RedisLoginStatusRepository) Save(ctx context.Context, status *models.LoginStatus, expiration time.Duration) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("error encoding login status: %w", err)
+	}
+
+	if err := r.client.Set(ctx, loginStatusKeyPrefix+status.ChallengeID, data, expiration).Err(); err != nil {
+		return fmt.Errorf("error storing login status: %w", err)
+	}
+	if err := r.bus.Publish(ctx, loginStatusTopicPrefix+status.ChallengeID, data); err != nil {
+		return fmt.Errorf("error notifying login status: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves the stored login status of a challenge
+func (r *RedisLoginStatusRepository) Get(ctx context.Context, challengeID string) (*models.LoginStatus, error) {
+	data, err := r.client.Get(ctx, loginStatusKeyPrefix+challengeID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("login status not found")
+		}
+		return nil, fmt.Errorf("error retrieving login status: %w", err)
+	}
+
+	status := &models.LoginStatus{}
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, fmt.Errorf("error decoding login status: %w", err)
+	}
+	return status, nil
+}
+
+// Subscribe returns the login statuses saved for a challenge from now on; the channel
+// is closed once ctx is done
+func (r *RedisLoginStatusRepository) Subscribe(ctx context.Context, challengeID string) (<-chan *models.LoginStatus, error) {
+	// A challenge's status changes a couple of times at most, so the buffer never fills up
+	// unless the subscriber has stopped reading
+	messages := make(chan pubsub.Message, 16)
+	unsubscribe := r.bus.Subscribe(loginStatusTopicPrefix+challengeID, func(message pubsub.Message) {
+		select {
+		case messages <- message:
+		default:
+		}
+	})
+
+	statuses := make(chan *models.LoginStatus)
+	go func() {
+		defer close(statuses)
+		defer unsubscribe()
+
+		for {
+			var message pubsub.Message
+			select {
+			case <-ctx.Done():
+				return
+			case message = <-messages:
+			}
+
+			status := &models.LoginStatus{}
+			if message.Resync {
+				// The status may have changed while the bus was disconnected
+				stored, err := r.Get(ctx, challengeID)
+				if err != nil {
+					continue
+				}
+				status = stored
+			} else if err := json.Unmarshal(message.Payload, status); err != nil {
+				continue
+			}
+			select {
+			case statuses <- status:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return statuses, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// maintenanceNoticesKey is the hash holding the maintenance notices as JSON, by ID
+const maintenanceNoticesKey = "maintenance:notices"
+
+// RedisMaintenanceNoticeRepository implements MaintenanceNoticeRepository using Redis, so
+// notices are shared by all instances
+type RedisMaintenanceNoticeRepository struct {
+	client *redis.Client
+}
+
+// NewRedisMaintenanceNoticeRepository creates a new Redis maintenance notice repository
+func NewRedisMaintenanceNoticeRepository(client *redis.Client) *RedisMaintenanceNoticeRepository {
+	return &RedisMaintenanceNoticeRepository{client: client}
+}
+
+// Create stores a maintenance notice
+func (r *RedisMaintenanceNoticeRepository) Create(ctx context.Context, notice *models.MaintenanceNotice) error {
+	data, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("error encoding maintenance notice: %w", err)
+	}
+	if err := r.client.HSet(ctx, maintenanceNoticesKey, notice.ID, data).Err(); err != nil {
+		return fmt.Errorf("error storing maintenance notice: %w", err)
+	}
+	return nil
+}
+
+// List returns every maintenance notice by start time
+func (r *RedisMaintenanceNoticeRepository) List(ctx context.Context) ([]models.MaintenanceNotice, error) {
+	values, err := r.client.HVals(ctx, maintenanceNoticesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing maintenance notices: %w", err)
+	}
+
+	notices := make([]models.MaintenanceNotice, 0, len(values))
+	for _, value := range values {
+		var notice models.MaintenanceNotice
+		if err := json.Unmarshal([]byte(value), &notice); err != nil {
+			return nil, fmt.Errorf("error decoding maintenance notice: %w", err)
+		}
+		notices = append(notices, notice)
+	}
+	sortMaintenanceNotices(notices)
+	return notices, nil
+}
+
+// Delete removes a maintenance notice, reporting whether it existed
+func (r *RedisMaintenanceNoticeRepository) Delete(ctx context.Context, id string) (bool, error) {
+	removed, err := r.client.HDel(ctx, maintenanceNoticesKey, id).Result()
+	if err != nil {
+		return false, fmt.Errorf("error deleting maintenance notice: %w", err)
+	}
+	return removed > 0, nil
+}
+
+// sortMaintenanceNotices orders notices by start time, then by ID for notices starting together
+func sortMaintenanceNotices(notices []models.MaintenanceNotice) {
+	sort.Slice(notices, func(i, j int) bool {
+		if !notices[i].StartsAt.Equal(notices[j].StartsAt) {
+			return notices[i].StartsAt.Before(notices[j].StartsAt)
+		}
+		return notices[i].ID < notices[j].ID
+	})
+}
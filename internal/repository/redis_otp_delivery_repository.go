@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+const (
+	otpDeliveryKeyPrefix        = "otp_delivery:"
+	otpDeliveryMessageKeyPrefix = "otp_delivery_message:"
+)
+
+// updateDeliveryStatusScript sets the status of the delivery a provider's message belongs to,
+// if the message is the delivery's latest send and has no final status yet.
+// KEYS: message. ARGV: delivery prefix, message ID, status, updated_at (RFC 3339).
+// Returns 1 if updated, 0 otherwise.
+var updateDeliveryStatusScript = redis.NewScript(`
+local id = redis.call("GET", KEYS[1])
+if not id then
+	return 0
+end
+local data = redis.call("GET", ARGV[1] .. id)
+local ttl = redis.call("PTTL", ARGV[1] .. id)
+if not data or ttl <= 0 then
+	return 0
+end
+
+local delivery = cjson.decode(data)
+if delivery.message_id ~= ARGV[2] or delivery.status ~= "sent" then
+	return 0
+end
+delivery.status = ARGV[3]
+delivery.updated_at = ARGV[4]
+redis.call("SET", ARGV[1] .. id, cjson.encode(delivery), "PX", ttl)
+return 1
+`)
+
+// RedisOTPDeliveryRepository implements OTPDeliveryRepository using Redis
+type RedisOTPDeliveryRepository struct {
+	client *redis.Client
+}
+
+// NewRedisOTPDeliveryRepository creates a new Redis OTP delivery repository
+func NewRedisOTPDeliveryRepository(client *redis.Client) *RedisOTPDeliveryRepository {
+	return &RedisOTPDeliveryRepository{client: client}
+}
+
+// Save stores the delivery status of an OTP challenge's latest send with expiration, replacing any earlier status
+func (r *RedisOTPDeliveryRepository) Save(ctx context.Context, delivery *models.OTPDelivery, expiration time.Duration) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("error encoding OTP delivery: %w", err)
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, otpDeliveryKeyPrefix+delivery.ChallengeID, data, expiration)
+		// Only messages a provider accepted get delivery receipts
+		if delivery.MessageID != "" {
+			pipe.Set(ctx, otpDeliveryMessageKey(delivery.Provider, delivery.MessageID), delivery.ChallengeID, expiration)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error storing OTP delivery: %w", err)
+	}
+	return nil
+}
+
+// UpdateStatus sets the status of the sent message a provider's delivery receipt refers to,
+// reporting whether it was updated
+func (r *RedisOTPDeliveryRepository) UpdateStatus(ctx context.Context, provider, messageID, status string, at time.Time) (bool, error) {
+	keys := []string{otpDeliveryMessageKey(provider, messageID)}
+	updated, err := updateDeliveryStatusScript.Run(ctx, r.client, keys, otpDeliveryKeyPrefix, messageID, status, at.UTC().Format(time.RFC3339Nano)).Int()
+	if err != nil {
+		return false, fmt.Errorf("error updating OTP delivery status: %w", err)
+	}
+	return updated == 1, nil
+}
+
+// Get retrieves the delivery status of the latest send of an OTP challenge
+func (r *RedisOTPDeliveryRepository) Get(ctx context.Context, challengeID string) (*models.OTPDelivery, error) {
+	data, err := r.client.Get(ctx, otpDeliveryKeyPrefix+challengeID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("OTP delivery not found")
+		}
+		return nil, fmt.Errorf("error retrieving OTP delivery: %w", err)
+	}
+
+	delivery := &models.OTPDelivery{}
+	if err := json.Unmarshal(data, delivery); err != nil {
+		return nil, fmt.Errorf("error decoding OTP delivery: %w", err)
+	}
+	return delivery, nil
+}
+
+// otpDeliveryMessageKey returns the key mapping a provider's message to its OTP challenge
+func otpDeliveryMessageKey(provider, messageID string) string {
+	return otpDeliveryMessageKeyPrefix + provider + ":" + messageID
+}
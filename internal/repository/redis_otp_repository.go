@@ -2,11 +2,13 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/lilokie/otp-auth/internal/models"
 )
 
 // RedisOTPRepository implements OTPRepository using Redis
@@ -15,82 +17,327 @@ type RedisOTPRepository struct {
 }
 
 const (
-	otpKeyPrefix       = "otp:"
-	rateLimitKeyPrefix = "rate_limit:"
+	challengeKeyPrefix       = "otp_challenge:"
+	phoneChallengesKeyPrefix = "otp_challenge_expiries:"
+	tombstoneKeyPrefix       = "otp_challenge_tombstone:"
+	failuresKeyPrefix        = "otp_failures:"
+	lockoutKeyPrefix         = "otp_lockout:"
+	cooldownKeyPrefix        = "otp_cooldown:"
 )
 
+// storeChallengeScript stores a challenge and adds it to the phone number's challenges, a
+// sorted set of challenge IDs scored by when they expire. Every key carries its own TTL for
+// Redis's active expiration to reclaim: the set lives as long as its longest-lived challenge,
+// and the IDs of expired challenges are dropped from it on each store instead of lingering
+// until the set expires. Tombstoned challenges are not stored.
+// KEYS: challenge, phone challenges, tombstone. ARGV: challenge JSON, expiration_ms, challenge ID, now_ms.
+var storeChallengeScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[3]) == 1 then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", ARGV[4])
+redis.call("ZADD", KEYS[2], tonumber(ARGV[4]) + tonumber(ARGV[2]), ARGV[3])
+if redis.call("PTTL", KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// tombstoneChallengeScript deletes a challenge and leaves a tombstone keeping it from being stored again.
+// KEYS: challenge, phone challenges, tombstone. ARGV: challenge ID, tombstone_ttl_ms.
+// Returns 1 if the challenge was pending, 0 otherwise.
+var tombstoneChallengeScript = redis.NewScript(`
+local pending = redis.call("DEL", KEYS[1])
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("SET", KEYS[3], 1, "PX", ARGV[2])
+return pending
+`)
+
+// acquireCooldownScript starts a cooldown unless one is running.
+// KEYS: cooldown. ARGV: cooldown_ms. Returns the remaining ms of a running cooldown, 0 if started.
+var acquireCooldownScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], 1, "NX", "PX", ARGV[1]) then
+	return 0
+end
+return math.max(redis.call("PTTL", KEYS[1]), 1)
+`)
+
+// recordFailureScript counts a failed verification and starts the lockout once the
+// limit is reached, in one step so concurrent guesses cannot exceed the limit.
+// KEYS: failures, lockout. ARGV: max_attempts, window_ms, cooldown_ms.
+// Returns {failed_attempts, lockout_ttl_ms}.
+var recordFailureScript = redis.NewScript(`
+local locked = redis.call("PTTL", KEYS[2])
+if locked > 0 then
+	return {0, locked}
+end
+
+local count = redis.call("INCR", KEYS[1])
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if count >= tonumber(ARGV[1]) then
+	redis.call("SET", KEYS[2], count, "PX", ARGV[3])
+	redis.call("DEL", KEYS[1])
+	return {count, tonumber(ARGV[3])}
+end
+return {count, 0}
+`)
+
 // NewRedisOTPRepository creates a new Redis OTP repository
 func NewRedisOTPRepository(client *redis.Client) *RedisOTPRepository {
 	return &RedisOTPRepository{client: client}
 }
 
-// StoreOTP stores an OTP with expiration
-func (r *RedisOTPRepository) StoreOTP(ctx context.Context, phoneNumber, otp string, expiration time.Duration) error {
-	key := otpKeyPrefix + phoneNumber
-	err := r.client.Set(ctx, key, otp, expiration).Err()
+// StoreChallenge stores an OTP challenge with expiration
+func (r *RedisOTPRepository) StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error {
+	data, err := json.Marshal(challenge)
 	if err != nil {
-		return fmt.Errorf("error storing OTP: %w", err)
+		return fmt.Errorf("error encoding OTP challenge: %w", err)
+	}
+
+	keys := []string{challengeKeyPrefix + challenge.ID, phoneChallengesKeyPrefix + challenge.PhoneNumber, tombstoneKeyPrefix + challenge.ID}
+	err = storeChallengeScript.Run(ctx, r.client, keys, data, expiration.Milliseconds(), challenge.ID, time.Now().UnixMilli()).Err()
+	if err != nil {
+		return fmt.Errorf("error storing OTP challenge: %w", err)
 	}
 	return nil
 }
 
-// GetOTP retrieves an OTP for a phone number
-func (r *RedisOTPRepository) GetOTP(ctx context.Context, phoneNumber string) (string, error) {
-	key := otpKeyPrefix + phoneNumber
-	otp, err := r.client.Get(ctx, key).Result()
+// GetChallenge retrieves a pending OTP challenge by ID
+func (r *RedisOTPRepository) GetChallenge(ctx context.Context, id string) (*models.OTPChallenge, error) {
+	data, err := r.client.Get(ctx, challengeKeyPrefix+id).Bytes()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return "", fmt.Errorf("OTP not found or expired")
+			return nil, fmt.Errorf("OTP not found or expired")
 		}
-		return "", fmt.Errorf("error retrieving OTP: %w", err)
+		return nil, fmt.Errorf("error retrieving OTP challenge: %w", err)
+	}
+
+	challenge := &models.OTPChallenge{}
+	if err := json.Unmarshal(data, challenge); err != nil {
+		return nil, fmt.Errorf("error decoding OTP challenge: %w", err)
 	}
-	return otp, nil
+	return challenge, nil
 }
 
-// DeleteOTP deletes an OTP for a phone number
-func (r *RedisOTPRepository) DeleteOTP(ctx context.Context, phoneNumber string) error {
-	key := otpKeyPrefix + phoneNumber
-	err := r.client.Del(ctx, key).Err()
+// GetLatestChallenge retrieves the most recently issued pending OTP challenge for a phone number.
+// Challenges are ordered by when they expire, which is the order they were issued in as long
+// as the expiration jitter is shorter than the resend cooldown between them.
+func (r *RedisOTPRepository) GetLatestChallenge(ctx context.Context, phoneNumber string) (*models.OTPChallenge, error) {
+	ids, err := r.pendingChallengeIDs(ctx, phoneChallengesKeyPrefix+phoneNumber)
 	if err != nil {
-		return fmt.Errorf("error deleting OTP: %w", err)
+		return nil, err
 	}
-	return nil
+
+	// Newest first; a challenge may still expire between listing and reading it
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		challenge, err := r.GetChallenge(ctx, id)
+		if err == nil {
+			return challenge, nil
+		}
+		if err.Error() != "OTP not found or expired" {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("OTP not found or expired")
 }
 
-// CheckRateLimit checks if the rate limit for a phone number has been exceeded
-func (r *RedisOTPRepository) CheckRateLimit(ctx context.Context, phoneNumber string, limit int, window time.Duration) (bool, error) {
-	key := rateLimitKeyPrefix + phoneNumber
-	count, err := r.client.Get(ctx, key).Int()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return false, fmt.Errorf("error checking rate limit: %w", err)
+// DeleteChallenge deletes an OTP challenge
+func (r *RedisOTPRepository) DeleteChallenge(ctx context.Context, challenge *models.OTPChallenge) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, challengeKeyPrefix+challenge.ID)
+		pipe.ZRem(ctx, phoneChallengesKeyPrefix+challenge.PhoneNumber, challenge.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting OTP challenge: %w", err)
 	}
-	return count >= limit, nil
+	return nil
 }
 
-// IncrementRateLimit increments the rate limit counter for a phone number
-func (r *RedisOTPRepository) IncrementRateLimit(ctx context.Context, phoneNumber string, window time.Duration) error {
-	key := rateLimitKeyPrefix + phoneNumber
+// TombstoneChallenge deletes an OTP challenge and keeps a tombstone of it for ttl, so a copy
+// of the challenge replicated late cannot store it again, reporting whether it was pending
+func (r *RedisOTPRepository) TombstoneChallenge(ctx context.Context, challenge *models.OTPChallenge, ttl time.Duration) (bool, error) {
+	keys := []string{challengeKeyPrefix + challenge.ID, phoneChallengesKeyPrefix + challenge.PhoneNumber, tombstoneKeyPrefix + challenge.ID}
+	pending, err := tombstoneChallengeScript.Run(ctx, r.client, keys, challenge.ID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("error deleting OTP challenge: %w", err)
+	}
+	return pending == 1, nil
+}
 
-	// Check if key exists
-	exists, err := r.client.Exists(ctx, key).Result()
+// IsTombstoned reports whether an OTP challenge was deleted by TombstoneChallenge
+func (r *RedisOTPRepository) IsTombstoned(ctx context.Context, id string) (bool, error) {
+	n, err := r.client.Exists(ctx, tombstoneKeyPrefix+id).Result()
 	if err != nil {
-		return fmt.Errorf("error checking if rate limit key exists: %w", err)
+		return false, fmt.Errorf("error retrieving OTP challenge: %w", err)
 	}
+	return n == 1, nil
+}
 
-	// If key doesn't exist, set it with expiration
-	if exists == 0 {
-		err = r.client.Set(ctx, key, 1, window).Err()
+// ListChallenges returns the pending OTP challenges for phone numbers starting with prefix
+func (r *RedisOTPRepository) ListChallenges(ctx context.Context, prefix string) ([]*models.OTPChallenge, error) {
+	challenges := []*models.OTPChallenge{}
+
+	iter := r.client.Scan(ctx, 0, phoneChallengesKeyPrefix+prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		ids, err := r.pendingChallengeIDs(ctx, iter.Val())
 		if err != nil {
-			return fmt.Errorf("error setting rate limit: %w", err)
+			return nil, err
 		}
-		return nil
+		if len(ids) == 0 {
+			continue
+		}
+
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = challengeKeyPrefix + id
+		}
+		values, err := r.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error listing OTP challenges: %w", err)
+		}
+		// Challenges may expire between listing and reading them
+		for _, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue
+			}
+			challenge := &models.OTPChallenge{}
+			if err := json.Unmarshal([]byte(data), challenge); err != nil {
+				return nil, fmt.Errorf("error decoding OTP challenge: %w", err)
+			}
+			challenges = append(challenges, challenge)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning OTP challenges: %w", err)
 	}
 
-	// Otherwise, increment it
-	_, err = r.client.Incr(ctx, key).Result()
+	return challenges, nil
+}
+
+// DeleteChallengesByPhone deletes all pending OTP challenges for a phone number
+func (r *RedisOTPRepository) DeleteChallengesByPhone(ctx context.Context, phoneNumber string) (int64, error) {
+	return r.deleteChallenges(ctx, phoneChallengesKeyPrefix+phoneNumber)
+}
+
+// DeleteChallengesByPrefix deletes all pending OTP challenges for phone numbers starting with prefix
+func (r *RedisOTPRepository) DeleteChallengesByPrefix(ctx context.Context, prefix string) (int64, error) {
+	var deleted int64
+
+	iter := r.client.Scan(ctx, 0, phoneChallengesKeyPrefix+prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		n, err := r.deleteChallenges(ctx, iter.Val())
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, fmt.Errorf("error scanning OTP challenges: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// deleteChallenges deletes a phone number's challenges set and the challenges in it,
+// returning the number of challenges that had not expired yet
+func (r *RedisOTPRepository) deleteChallenges(ctx context.Context, setKey string) (int64, error) {
+	ids, err := r.pendingChallengeIDs(ctx, setKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = challengeKeyPrefix + id
+	}
+	deleted, err := r.client.Del(ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error deleting OTP challenges: %w", err)
+	}
+	if err := r.client.Del(ctx, setKey).Err(); err != nil {
+		return deleted, fmt.Errorf("error deleting OTP challenges: %w", err)
+	}
+	return deleted, nil
+}
+
+// pendingChallengeIDs returns the IDs in a phone number's challenges set of the challenges that
+// have not expired yet, in the order they expire
+func (r *RedisOTPRepository) pendingChallengeIDs(ctx context.Context, setKey string) ([]string, error) {
+	ids, err := r.client.ZRangeByScore(ctx, setKey, &redis.ZRangeBy{
+		Min: fmt.Sprintf("(%d", time.Now().UnixMilli()),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing OTP challenges: %w", err)
+	}
+	return ids, nil
+}
+
+// AcquireResendCooldown starts a resend cooldown for a phone number unless one is running,
+// returning the remaining time of the running cooldown or zero if it was started
+func (r *RedisOTPRepository) AcquireResendCooldown(ctx context.Context, phoneNumber string, cooldown time.Duration) (time.Duration, error) {
+	if cooldown <= 0 {
+		return 0, nil
+	}
+
+	remaining, err := acquireCooldownScript.Run(ctx, r.client, []string{cooldownKeyPrefix + phoneNumber}, cooldown.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("error acquiring resend cooldown: %w", err)
+	}
+	return time.Duration(remaining) * time.Millisecond, nil
+}
+
+// GetLockout returns the verification lockout state for a phone number
+func (r *RedisOTPRepository) GetLockout(ctx context.Context, phoneNumber string) (*models.LockoutState, error) {
+	ttl, err := r.client.PTTL(ctx, lockoutKeyPrefix+phoneNumber).Result()
 	if err != nil {
-		return fmt.Errorf("error incrementing rate limit: %w", err)
+		return nil, fmt.Errorf("error getting lockout: %w", err)
+	}
+	if ttl > 0 {
+		return &models.LockoutState{Locked: true, RetryAfter: ttl}, nil
 	}
 
+	failures, err := r.client.Get(ctx, failuresKeyPrefix+phoneNumber).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("error getting failed verifications: %w", err)
+	}
+	return &models.LockoutState{FailedAttempts: failures}, nil
+}
+
+// RecordFailedVerification counts a failed verification for a phone number and locks it
+// for cooldown once maxAttempts failures happened within window
+func (r *RedisOTPRepository) RecordFailedVerification(ctx context.Context, phoneNumber string, maxAttempts int, window, cooldown time.Duration) (*models.LockoutState, error) {
+	keys := []string{failuresKeyPrefix + phoneNumber, lockoutKeyPrefix + phoneNumber}
+	values, err := recordFailureScript.Run(ctx, r.client, keys, maxAttempts, window.Milliseconds(), cooldown.Milliseconds()).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("error recording failed verification: %w", err)
+	}
+	if len(values) != 2 {
+		return nil, fmt.Errorf("unexpected failed verification result: %v", values)
+	}
+
+	retryAfter := time.Duration(values[1]) * time.Millisecond
+	return &models.LockoutState{
+		FailedAttempts: int(values[0]),
+		Locked:         retryAfter > 0,
+		RetryAfter:     retryAfter,
+	}, nil
+}
+
+// ClearFailedVerifications resets the failed verification count and lockout for a phone number
+func (r *RedisOTPRepository) ClearFailedVerifications(ctx context.Context, phoneNumber string) error {
+	err := r.client.Del(ctx, failuresKeyPrefix+phoneNumber, lockoutKeyPrefix+phoneNumber).Err()
+	if err != nil {
+		return fmt.Errorf("error clearing failed verifications: %w", err)
+	}
 	return nil
 }
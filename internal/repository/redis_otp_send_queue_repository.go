@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+const (
+	otpSendJobsKey        = "sms:queue:jobs"     // hash of job ID -> job JSON
+	otpSendScheduleKey    = "sms:queue:schedule" // sorted set of job IDs by when they are due
+	otpSendDeadLettersKey = "sms:queue:dead"     // list of dead-lettered job JSON, newest first
+	otpSendTenantsKey     = "sms:queue:tenants"  // hash of tenant -> number of its queued jobs
+)
+
+// enqueueOTPSendScript adds a job due at once unless the queue, or the tenant's share of it
+// with a tenant_max_length above 0, is full.
+// KEYS: jobs, schedule, tenants. ARGV: job ID, job JSON, now_ms, max_length, tenant, tenant_max_length.
+// Returns 1 if added, 0 if the queue is full.
+var enqueueOTPSendScript = redis.NewScript(`
+if redis.call("ZCARD", KEYS[2]) >= tonumber(ARGV[4]) then
+	return 0
+end
+if ARGV[5] ~= "" then
+	local queued = tonumber(redis.call("HGET", KEYS[3], ARGV[5]) or "0")
+	if tonumber(ARGV[6]) > 0 and queued >= tonumber(ARGV[6]) then
+		return 0
+	end
+	redis.call("HINCRBY", KEYS[3], ARGV[5], 1)
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("ZADD", KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+// removeOTPSendScript removes a job from the queue, no longer counting it against its tenant,
+// and pushes dead_letter onto the dead-letter list, keeping max_size jobs, unless it is empty.
+// KEYS: jobs, schedule, tenants, dead letters. ARGV: job ID, dead_letter, max_size.
+var removeOTPSendScript = redis.NewScript(`
+local job = redis.call("HGET", KEYS[1], ARGV[1])
+if job then
+	local tenant = cjson.decode(job).tenant
+	if type(tenant) == "string" and tenant ~= "" and redis.call("HINCRBY", KEYS[3], tenant, -1) <= 0 then
+		redis.call("HDEL", KEYS[3], tenant)
+	end
+	redis.call("HDEL", KEYS[1], ARGV[1])
+end
+redis.call("ZREM", KEYS[2], ARGV[1])
+if ARGV[2] ~= "" then
+	redis.call("LPUSH", KEYS[4], ARGV[2])
+	redis.call("LTRIM", KEYS[4], 0, tonumber(ARGV[3]) - 1)
+end
+return 1
+`)
+
+// claimOTPSendScript leases the jobs due at now until lease_until, so concurrent workers claim
+// different jobs and jobs of workers that died become due again.
+// KEYS: jobs, schedule. ARGV: now_ms, lease_until_ms, limit. Returns the claimed jobs' JSON.
+var claimOTPSendScript = redis.NewScript(`
+local claimed = {}
+for _, id in ipairs(redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])) do
+	local job = redis.call("HGET", KEYS[1], id)
+	if job then
+		redis.call("ZADD", KEYS[2], ARGV[2], id)
+		table.insert(claimed, job)
+	else
+		redis.call("ZREM", KEYS[2], id)
+	end
+end
+return claimed
+`)
+
+// RedisOTPSendQueueRepository implements OTPSendQueueRepository using Redis,
+// so every instance's workers share one queue
+type RedisOTPSendQueueRepository struct {
+	client *redis.Client
+}
+
+// NewRedisOTPSendQueueRepository creates a new Redis OTP send queue repository
+func NewRedisOTPSendQueueRepository(client *redis.Client) *RedisOTPSendQueueRepository {
+	return &RedisOTPSendQueueRepository{client: client}
+}
+
+// Enqueue adds a job to the queue, due at once, unless maxLength jobs are queued already
+// or, with tenantMaxLength above 0, tenantMaxLength jobs of job.Tenant
+func (r *RedisOTPSendQueueRepository) Enqueue(ctx context.Context, job *models.OTPSendJob, maxLength, tenantMaxLength int) (bool, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return false, fmt.Errorf("error encoding OTP send job: %w", err)
+	}
+
+	keys := []string{otpSendJobsKey, otpSendScheduleKey, otpSendTenantsKey}
+	added, err := enqueueOTPSendScript.Run(ctx, r.client, keys,
+		job.ID, data, time.Now().UnixMilli(), maxLength, job.Tenant, tenantMaxLength,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("error queueing OTP: %w", err)
+	}
+	return added == 1, nil
+}
+
+// ClaimDue returns up to limit jobs due at now and leases them until leaseUntil
+func (r *RedisOTPSendQueueRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.OTPSendJob, error) {
+	keys := []string{otpSendJobsKey, otpSendScheduleKey}
+	values, err := claimOTPSendScript.Run(ctx, r.client, keys, now.UnixMilli(), leaseUntil.UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("error claiming queued OTPs: %w", err)
+	}
+
+	jobs := make([]models.OTPSendJob, len(values))
+	for i, value := range values {
+		if err := json.Unmarshal([]byte(value), &jobs[i]); err != nil {
+			return nil, fmt.Errorf("error decoding OTP send job: %w", err)
+		}
+	}
+	return jobs, nil
+}
+
+// Reschedule stores a claimed job's attempts and makes it due again at
+func (r *RedisOTPSendQueueRepository) Reschedule(ctx context.Context, job *models.OTPSendJob, at time.Time) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("error encoding OTP send job: %w", err)
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, otpSendJobsKey, job.ID, data)
+		pipe.ZAdd(ctx, otpSendScheduleKey, &redis.Z{Score: float64(at.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error rescheduling queued OTP: %w", err)
+	}
+	return nil
+}
+
+// Complete removes a job from the queue
+func (r *RedisOTPSendQueueRepository) Complete(ctx context.Context, id string) error {
+	keys := []string{otpSendJobsKey, otpSendScheduleKey, otpSendTenantsKey, otpSendDeadLettersKey}
+	if err := removeOTPSendScript.Run(ctx, r.client, keys, id, "", 0).Err(); err != nil {
+		return fmt.Errorf("error completing queued OTP: %w", err)
+	}
+	return nil
+}
+
+// DeadLetter moves a job from the queue to the dead-letter list, which keeps the newest maxSize jobs
+func (r *RedisOTPSendQueueRepository) DeadLetter(ctx context.Context, job *models.OTPSendJob, maxSize int) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("error encoding OTP send job: %w", err)
+	}
+
+	keys := []string{otpSendJobsKey, otpSendScheduleKey, otpSendTenantsKey, otpSendDeadLettersKey}
+	if err := removeOTPSendScript.Run(ctx, r.client, keys, job.ID, data, maxSize).Err(); err != nil {
+		return fmt.Errorf("error dead-lettering queued OTP: %w", err)
+	}
+	return nil
+}
+
+// DeadLetters returns the jobs on the dead-letter list, newest first
+func (r *RedisOTPSendQueueRepository) DeadLetters(ctx context.Context) ([]models.OTPSendJob, error) {
+	values, err := r.client.LRange(ctx, otpSendDeadLettersKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing dead-lettered OTPs: %w", err)
+	}
+
+	jobs := make([]models.OTPSendJob, len(values))
+	for i, value := range values {
+		if err := json.Unmarshal([]byte(value), &jobs[i]); err != nil {
+			return nil, fmt.Errorf("error decoding OTP send job: %w", err)
+		}
+	}
+	return jobs, nil
+}
+
+// Length returns the number of queued jobs, leased ones included
+func (r *RedisOTPSendQueueRepository) Length(ctx context.Context) (int64, error) {
+	n, err := r.client.ZCard(ctx, otpSendScheduleKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error getting OTP queue length: %w", err)
+	}
+	return n, nil
+}
+
+// TenantLength returns the number of queued jobs of a tenant, leased ones included
+func (r *RedisOTPSendQueueRepository) TenantLength(ctx context.Context, tenant string) (int64, error) {
+	n, err := r.client.HGet(ctx, otpSendTenantsKey, tenant).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("error getting OTP queue length: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+const (
+	disabledProvidersKey     = "sms:providers:disabled"
+	providerHealthPrefix     = "sms:providers:health:"
+	providerQuarantinePrefix = "sms:providers:quarantine:"
+)
+
+// recordProviderResultScript counts a send in a provider's error rate window,
+// starting the window on its first send, and returns the window's counts
+var recordProviderResultScript = redis.NewScript(`
+local sent = redis.call("HINCRBY", KEYS[1], "sent", 1)
+local failed = redis.call("HINCRBY", KEYS[1], "failed", ARGV[1])
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return {sent, failed}
+`)
+
+// RedisProviderStateRepository implements ProviderStateRepository using Redis,
+// so rotation changes and provider health are shared by all instances
+type RedisProviderStateRepository struct {
+	client *redis.Client
+}
+
+// NewRedisProviderStateRepository creates a new Redis provider state repository
+func NewRedisProviderStateRepository(client *redis.Client) *RedisProviderStateRepository {
+	return &RedisProviderStateRepository{client: client}
+}
+
+// DisabledProviders returns the names of providers taken out of rotation
+func (r *RedisProviderStateRepository) DisabledProviders(ctx context.Context) ([]string, error) {
+	names, err := r.client.SMembers(ctx, disabledProvidersKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting disabled providers: %w", err)
+	}
+	return names, nil
+}
+
+// SetProviderEnabled puts a provider back into or takes it out of rotation
+func (r *RedisProviderStateRepository) SetProviderEnabled(ctx context.Context, name string, enabled bool) error {
+	var err error
+	if enabled {
+		err = r.client.SRem(ctx, disabledProvidersKey, name).Err()
+	} else {
+		err = r.client.SAdd(ctx, disabledProvidersKey, name).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("error setting provider state: %w", err)
+	}
+	return nil
+}
+
+// RecordProviderResult counts a send through a provider, and whether it failed, in its error rate window
+func (r *RedisProviderStateRepository) RecordProviderResult(ctx context.Context, name string, failed bool, window time.Duration) (models.ProviderHealth, error) {
+	var failedCount int
+	if failed {
+		failedCount = 1
+	}
+
+	counts, err := recordProviderResultScript.Run(ctx, r.client, []string{providerHealthPrefix + name}, failedCount, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return models.ProviderHealth{}, fmt.Errorf("error recording provider result: %w", err)
+	}
+	return models.ProviderHealth{Sent: counts[0], Failed: counts[1]}, nil
+}
+
+// QuarantineProvider takes a provider out of rotation for duration and starts its error count over
+func (r *RedisProviderStateRepository) QuarantineProvider(ctx context.Context, name string, duration time.Duration) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, providerQuarantinePrefix+name, 1, duration)
+		pipe.Del(ctx, providerHealthPrefix+name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error quarantining provider: %w", err)
+	}
+	return nil
+}
+
+// ResetProviderHealth ends a provider's quarantine and starts its error count over
+func (r *RedisProviderStateRepository) ResetProviderHealth(ctx context.Context, name string) error {
+	if err := r.client.Del(ctx, providerQuarantinePrefix+name, providerHealthPrefix+name).Err(); err != nil {
+		return fmt.Errorf("error resetting provider health: %w", err)
+	}
+	return nil
+}
+
+// ProvidersHealth returns the health of the named providers by name
+func (r *RedisProviderStateRepository) ProvidersHealth(ctx context.Context, names []string) (map[string]models.ProviderHealth, error) {
+	counts := make([]*redis.SliceCmd, len(names))
+	quarantines := make([]*redis.DurationCmd, len(names))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, name := range names {
+			counts[i] = pipe.HMGet(ctx, providerHealthPrefix+name, "sent", "failed")
+			quarantines[i] = pipe.PTTL(ctx, providerQuarantinePrefix+name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting provider health: %w", err)
+	}
+
+	now := time.Now()
+	health := make(map[string]models.ProviderHealth, len(names))
+	for i, name := range names {
+		values := counts[i].Val()
+		h := models.ProviderHealth{Sent: parseCount(values[0]), Failed: parseCount(values[1])}
+		// PTTL is negative for keys that don't exist or have no expiry
+		if remaining := quarantines[i].Val(); remaining > 0 {
+			until := now.Add(remaining)
+			h.QuarantinedUntil = &until
+		}
+		health[name] = h
+	}
+	return health, nil
+}
+
+// parseCount reads a counter returned by HMGET, which is nil for missing fields
+func parseCount(value interface{}) int64 {
+	s, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+const (
+	sessionKeyPrefix      = "session:"
+	sessionRefreshPrefix  = "session_refresh:"
+	userSessionsKeyPrefix = "user_sessions:"
+)
+
+// createSessionScript stores a session and its refresh token and adds it to the user's sessions,
+// which live as long as the longest-lived session in them. Expired sessions are dropped from
+// the user's sessions, then the oldest are revoked beyond max_sessions (0 for no limit).
+// KEYS: session, refresh token, user sessions.
+// ARGV: session JSON, expiration_ms, session ID, created_at_ms, max_sessions, session prefix, refresh prefix.
+// Returns the IDs of the revoked sessions.
+var createSessionScript = redis.NewScript(`
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("SET", KEYS[2], ARGV[3], "PX", ARGV[2])
+redis.call("ZADD", KEYS[3], ARGV[4], ARGV[3])
+if redis.call("PTTL", KEYS[3]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[3], ARGV[2])
+end
+
+local live = {}
+for _, id in ipairs(redis.call("ZRANGE", KEYS[3], 0, -1)) do
+	if redis.call("EXISTS", ARGV[6] .. id) == 1 then
+		table.insert(live, id)
+	else
+		redis.call("ZREM", KEYS[3], id)
+	end
+end
+
+local revoked = {}
+local max = tonumber(ARGV[5])
+if max > 0 then
+	for i = 1, #live - max do
+		local session = cjson.decode(redis.call("GET", ARGV[6] .. live[i]))
+		redis.call("DEL", ARGV[6] .. live[i], ARGV[7] .. session.refresh_token_hash)
+		redis.call("ZREM", KEYS[3], live[i])
+		table.insert(revoked, live[i])
+	end
+end
+return revoked
+`)
+
+// rotateSessionScript replaces a session and its refresh token if the old refresh token still
+// belongs to it; the new refresh token expires with the session.
+// KEYS: session, old refresh token, new refresh token. ARGV: session ID, session JSON.
+// Returns 1 if rotated, 0 otherwise.
+var rotateSessionScript = redis.NewScript(`
+if redis.call("GET", KEYS[2]) ~= ARGV[1] then
+	return 0
+end
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl <= 0 then
+	return 0
+end
+redis.call("DEL", KEYS[2])
+redis.call("SET", KEYS[1], ARGV[2], "PX", ttl)
+redis.call("SET", KEYS[3], ARGV[1], "PX", ttl)
+return 1
+`)
+
+// deleteUserSessionsScript deletes all of a user's sessions and their refresh tokens.
+// KEYS: user sessions. ARGV: session prefix, refresh prefix.
+// Returns the IDs of the sessions that had not expired yet.
+var deleteUserSessionsScript = redis.NewScript(`
+local deleted = {}
+for _, id in ipairs(redis.call("ZRANGE", KEYS[1], 0, -1)) do
+	local data = redis.call("GET", ARGV[1] .. id)
+	if data then
+		local session = cjson.decode(data)
+		redis.call("DEL", ARGV[1] .. id, ARGV[2] .. session.refresh_token_hash)
+		table.insert(deleted, id)
+	end
+end
+redis.call("DEL", KEYS[1])
+return deleted
+`)
+
+// redisSession is the form a session is stored in, keeping the fields hidden from API responses
+type redisSession struct {
+	ID               uuid.UUID  `json:"id"`
+	UserID           uuid.UUID  `json:"user_id"`
+	RefreshTokenHash string     `json:"refresh_token_hash"`
+	UserAgent        string     `json:"user_agent"`
+	IPAddress        string     `json:"ip_address"`
+	Country          string     `json:"country,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+}
+
+// RedisSessionRepository implements SessionRepository using Redis. Sessions expire with
+// their keys; each user's sessions are indexed in a sorted set by creation time.
+type RedisSessionRepository struct {
+	client *redis.Client
+}
+
+// NewRedisSessionRepository creates a new Redis session repository
+func NewRedisSessionRepository(client *redis.Client) *RedisSessionRepository {
+	return &RedisSessionRepository{client: client}
+}
+
+// Create stores a new session until it expires and revokes the user's oldest sessions
+// beyond maxSessions (unlimited if 0), returning the IDs of the revoked sessions
+func (r *RedisSessionRepository) Create(ctx context.Context, session *models.Session, maxSessions int) ([]uuid.UUID, error) {
+	data, err := encodeSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	expiration := time.Until(session.ExpiresAt)
+	if expiration <= 0 {
+		return nil, fmt.Errorf("error storing session: already expired")
+	}
+
+	id := session.ID.String()
+	keys := []string{
+		sessionKeyPrefix + id,
+		sessionRefreshPrefix + session.RefreshTokenHash,
+		userSessionsKeyPrefix + session.UserID.String(),
+	}
+	revoked, err := createSessionScript.Run(ctx, r.client, keys,
+		data, expiration.Milliseconds(), id, session.CreatedAt.UnixMilli(), maxSessions,
+		sessionKeyPrefix, sessionRefreshPrefix,
+	).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("error storing session: %w", err)
+	}
+	return parseSessionIDs(revoked)
+}
+
+// Get finds an unexpired session by ID
+func (r *RedisSessionRepository) Get(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	data, err := r.client.Get(ctx, sessionKeyPrefix+id.String()).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("session not found or expired")
+		}
+		return nil, fmt.Errorf("error retrieving session: %w", err)
+	}
+	return decodeSession(data)
+}
+
+// FindByRefreshTokenHash finds the unexpired session with the given refresh token hash
+func (r *RedisSessionRepository) FindByRefreshTokenHash(ctx context.Context, refreshTokenHash string) (*models.Session, error) {
+	id, err := r.client.Get(ctx, sessionRefreshPrefix+refreshTokenHash).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("session not found or expired")
+		}
+		return nil, fmt.Errorf("error retrieving session: %w", err)
+	}
+
+	sessionID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding session ID: %w", err)
+	}
+	return r.Get(ctx, sessionID)
+}
+
+// Rotate replaces the refresh token hash and last use of a session, reporting whether
+// oldRefreshTokenHash still belonged to it, so each refresh token is used only once
+func (r *RedisSessionRepository) Rotate(ctx context.Context, session *models.Session, oldRefreshTokenHash string) (bool, error) {
+	data, err := encodeSession(session)
+	if err != nil {
+		return false, err
+	}
+
+	id := session.ID.String()
+	keys := []string{
+		sessionKeyPrefix + id,
+		sessionRefreshPrefix + oldRefreshTokenHash,
+		sessionRefreshPrefix + session.RefreshTokenHash,
+	}
+	rotated, err := rotateSessionScript.Run(ctx, r.client, keys, id, data).Int()
+	if err != nil {
+		return false, fmt.Errorf("error rotating session: %w", err)
+	}
+	return rotated == 1, nil
+}
+
+// ListByUser returns a user's unexpired sessions, newest first
+func (r *RedisSessionRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	ids, err := r.client.ZRevRange(ctx, userSessionsKeyPrefix+userID.String(), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+	if len(ids) == 0 {
+		return []models.Session{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKeyPrefix + id
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+
+	sessions := make([]models.Session, 0, len(values))
+	for _, value := range values {
+		// Expired sessions stay in the index until the user's next sign-in
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		session, err := decodeSession([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+// DeleteAllByUser deletes all of a user's sessions, returning the IDs of the deleted sessions
+func (r *RedisSessionRepository) DeleteAllByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	deleted, err := deleteUserSessionsScript.Run(ctx, r.client,
+		[]string{userSessionsKeyPrefix + userID.String()},
+		sessionKeyPrefix, sessionRefreshPrefix,
+	).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("error deleting sessions: %w", err)
+	}
+	return parseSessionIDs(deleted)
+}
+
+// encodeSession encodes a session for storage
+func encodeSession(session *models.Session) ([]byte, error) {
+	data, err := json.Marshal(redisSession{
+		ID:               session.ID,
+		UserID:           session.UserID,
+		RefreshTokenHash: session.RefreshTokenHash,
+		UserAgent:        session.UserAgent,
+		IPAddress:        session.IPAddress,
+		Country:          session.Country,
+		CreatedAt:        session.CreatedAt,
+		LastUsedAt:       session.LastUsedAt,
+		ExpiresAt:        session.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding session: %w", err)
+	}
+	return data, nil
+}
+
+// decodeSession decodes a stored session
+func decodeSession(data []byte) (*models.Session, error) {
+	var stored redisSession
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("error decoding session: %w", err)
+	}
+	return &models.Session{
+		ID:               stored.ID,
+		UserID:           stored.UserID,
+		RefreshTokenHash: stored.RefreshTokenHash,
+		UserAgent:        stored.UserAgent,
+		IPAddress:        stored.IPAddress,
+		Country:          stored.Country,
+		CreatedAt:        stored.CreatedAt,
+		LastUsedAt:       stored.LastUsedAt,
+		ExpiresAt:        stored.ExpiresAt,
+	}, nil
+}
+
+// parseSessionIDs parses the session IDs returned by a script
+func parseSessionIDs(ids []string) ([]uuid.UUID, error) {
+	parsed := make([]uuid.UUID, len(ids))
+	for i, id := range ids {
+		sessionID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding session ID: %w", err)
+		}
+		parsed[i] = sessionID
+	}
+	return parsed, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const uniqueIPsKeyPrefix = "unique_ips:"
+
+// RedisUniqueIPRepository implements UniqueIPRepository using one HyperLogLog per endpoint and UTC day,
+// so counting distinct IPs takes constant memory however many clients send requests
+type RedisUniqueIPRepository struct {
+	client    *redis.Client
+	retention time.Duration
+}
+
+// NewRedisUniqueIPRepository creates a new Redis unique IP repository keeping the counts of a day for retention
+func NewRedisUniqueIPRepository(client *redis.Client, retention time.Duration) *RedisUniqueIPRepository {
+	return &RedisUniqueIPRepository{client: client, retention: retention}
+}
+
+// AddIPs records the client IPs that requested each endpoint on the UTC day of day
+func (r *RedisUniqueIPRepository) AddIPs(ctx context.Context, day time.Time, ipsByEndpoint map[string][]string) error {
+	day = day.UTC().Truncate(24 * time.Hour)
+	expireAt := day.Add(r.retention)
+	endpointsKey := uniqueIPsEndpointsKey(day)
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for endpoint, ips := range ipsByEndpoint {
+			members := make([]interface{}, len(ips))
+			for i, ip := range ips {
+				members[i] = ip
+			}
+			key := uniqueIPsKey(day, endpoint)
+			pipe.PFAdd(ctx, key, members...)
+			pipe.ExpireAt(ctx, key, expireAt)
+			pipe.SAdd(ctx, endpointsKey, endpoint)
+		}
+		pipe.ExpireAt(ctx, endpointsKey, expireAt)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error recording unique IPs: %w", err)
+	}
+	return nil
+}
+
+// CountIPs counts the distinct client IPs that requested each endpoint on the UTC day of day
+func (r *RedisUniqueIPRepository) CountIPs(ctx context.Context, day time.Time) (map[string]int64, error) {
+	day = day.UTC().Truncate(24 * time.Hour)
+
+	endpoints, err := r.client.SMembers(ctx, uniqueIPsEndpointsKey(day)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing endpoints: %w", err)
+	}
+
+	counts := make(map[string]int64, len(endpoints))
+	if len(endpoints) == 0 {
+		return counts, nil
+	}
+
+	cmds := make([]*redis.IntCmd, len(endpoints))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, endpoint := range endpoints {
+			cmds[i] = pipe.PFCount(ctx, uniqueIPsKey(day, endpoint))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting unique IPs: %w", err)
+	}
+	for i, endpoint := range endpoints {
+		counts[endpoint] = cmds[i].Val()
+	}
+	return counts, nil
+}
+
+// uniqueIPsEndpointsKey returns the key of the set of endpoints requested on a UTC day
+func uniqueIPsEndpointsKey(day time.Time) string {
+	return uniqueIPsKeyPrefix + day.Format("2006-01-02") + ":endpoints"
+}
+
+// uniqueIPsKey returns the key of the HyperLogLog of IPs that requested an endpoint on a UTC day
+func uniqueIPsKey(day time.Time, endpoint string) string {
+	return uniqueIPsKeyPrefix + day.Format("2006-01-02") + ":" + endpoint
+}
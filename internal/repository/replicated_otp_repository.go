@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// OTPRegion is one region's copy of the OTPs replicated by ReplicatedOTPRepository
+type OTPRegion struct {
+	Name       string
+	Repository RegionalOTPRepository
+}
+
+// ReplicatedOTPRepository implements OTPRepository across regions in active-active mode, so an
+// OTP requested in one region can be verified in another. Every write is applied to every region;
+// it fails only if the local region fails, and writes missed by an unreachable region are not
+// caught up later. Reads go to the local region and fall back to the others for challenges the
+// local region has not seen.
+//
+// Challenge IDs are never reused, so the only conflict between regions is a challenge being stored
+// and deleted at once. Deletes leave tombstones that stores cannot overwrite, so a challenge that
+// was verified in one region stays deleted everywhere even if its store reaches a region late.
+// Failed verifications are counted in every region, so each region reaches the lockout on its own.
+type ReplicatedOTPRepository struct {
+	regions      []OTPRegion // the local region first
+	tombstoneTTL time.Duration
+	logger       *slog.Logger
+}
+
+// NewReplicatedOTPRepository creates a new replicated OTP repository. regions starts with the
+// local region; tombstones of deleted challenges are kept for tombstoneTTL, which must exceed
+// the lifetime of a challenge.
+func NewReplicatedOTPRepository(regions []OTPRegion, tombstoneTTL time.Duration, logger *slog.Logger) *ReplicatedOTPRepository {
+	return &ReplicatedOTPRepository{regions: regions, tombstoneTTL: tombstoneTTL, logger: logger}
+}
+
+// replicate applies op to every region at once, returning the local region's error.
+// Errors of other regions are logged rather than failing the write.
+func (r *ReplicatedOTPRepository) replicate(ctx context.Context, op func(i int, repo RegionalOTPRepository) error) error {
+	errs := make([]error, len(r.regions))
+	var wg sync.WaitGroup
+	for i, region := range r.regions {
+		wg.Add(1)
+		go func(i int, repo RegionalOTPRepository) {
+			defer wg.Done()
+			errs[i] = op(i, repo)
+		}(i, region.Repository)
+	}
+	wg.Wait()
+
+	for i, err := range errs[1:] {
+		if err != nil {
+			r.logRegionError(ctx, r.regions[i+1].Name, err)
+		}
+	}
+	return errs[0]
+}
+
+// logRegionError logs an error of a region other than the local one
+func (r *ReplicatedOTPRepository) logRegionError(ctx context.Context, region string, err error) {
+	logging.FromContext(ctx, r.logger).WarnContext(ctx, "OTP replication to region failed",
+		"region", region,
+		"error", err,
+	)
+}
+
+// StoreChallenge stores an OTP challenge with expiration in every region
+func (r *ReplicatedOTPRepository) StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error {
+	return r.replicate(ctx, func(_ int, repo RegionalOTPRepository) error {
+		return repo.StoreChallenge(ctx, challenge, expiration)
+	})
+}
+
+// GetChallenge retrieves a pending OTP challenge by ID, from another region if the local
+// region has not seen it
+func (r *ReplicatedOTPRepository) GetChallenge(ctx context.Context, id string) (*models.OTPChallenge, error) {
+	return r.get(ctx, id, func(repo RegionalOTPRepository) (*models.OTPChallenge, error) {
+		return repo.GetChallenge(ctx, id)
+	})
+}
+
+// GetLatestChallenge retrieves the most recently issued pending OTP challenge for a phone number,
+// from another region if the local region has none
+func (r *ReplicatedOTPRepository) GetLatestChallenge(ctx context.Context, phoneNumber string) (*models.OTPChallenge, error) {
+	return r.get(ctx, "", func(repo RegionalOTPRepository) (*models.OTPChallenge, error) {
+		return repo.GetLatestChallenge(ctx, phoneNumber)
+	})
+}
+
+// get reads a challenge from the local region, falling back to the other regions in order.
+// Challenges the local region holds a tombstone for were deleted and are not read elsewhere;
+// id is the challenge's ID if known up front.
+func (r *ReplicatedOTPRepository) get(ctx context.Context, id string, read func(repo RegionalOTPRepository) (*models.OTPChallenge, error)) (*models.OTPChallenge, error) {
+	local := r.regions[0].Repository
+	challenge, err := read(local)
+	if err == nil || err.Error() != "OTP not found or expired" {
+		return challenge, err
+	}
+	if id != "" {
+		tombstoned, err := local.IsTombstoned(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if tombstoned {
+			return nil, fmt.Errorf("OTP not found or expired")
+		}
+	}
+
+	for _, region := range r.regions[1:] {
+		challenge, err := read(region.Repository)
+		if err != nil {
+			if err.Error() != "OTP not found or expired" {
+				r.logRegionError(ctx, region.Name, err)
+			}
+			continue
+		}
+		tombstoned, err := local.IsTombstoned(ctx, challenge.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !tombstoned {
+			return challenge, nil
+		}
+	}
+	return nil, fmt.Errorf("OTP not found or expired")
+}
+
+// DeleteChallenge deletes an OTP challenge in every region
+func (r *ReplicatedOTPRepository) DeleteChallenge(ctx context.Context, challenge *models.OTPChallenge) error {
+	return r.replicate(ctx, func(_ int, repo RegionalOTPRepository) error {
+		_, err := repo.TombstoneChallenge(ctx, challenge, r.tombstoneTTL)
+		return err
+	})
+}
+
+// DeleteChallengesByPhone deletes all pending OTP challenges for a phone number in every region
+func (r *ReplicatedOTPRepository) DeleteChallengesByPhone(ctx context.Context, phoneNumber string) (int64, error) {
+	return r.deleteChallenges(ctx, phoneNumber, func(challenge *models.OTPChallenge) bool {
+		return challenge.PhoneNumber == phoneNumber
+	})
+}
+
+// DeleteChallengesByPrefix deletes all pending OTP challenges for phone numbers starting with prefix in every region
+func (r *ReplicatedOTPRepository) DeleteChallengesByPrefix(ctx context.Context, prefix string) (int64, error) {
+	return r.deleteChallenges(ctx, prefix, func(challenge *models.OTPChallenge) bool {
+		return true
+	})
+}
+
+// deleteChallenges tombstones, in every region, the challenges any region holds for phone numbers
+// starting with prefix that match, returning the number of distinct challenges deleted
+func (r *ReplicatedOTPRepository) deleteChallenges(ctx context.Context, prefix string, match func(challenge *models.OTPChallenge) bool) (int64, error) {
+	seen := make(map[string]bool)
+	var challenges []*models.OTPChallenge
+	for i, region := range r.regions {
+		listed, err := region.Repository.ListChallenges(ctx, prefix)
+		if err != nil {
+			if i == 0 {
+				return 0, err
+			}
+			r.logRegionError(ctx, region.Name, err)
+			continue
+		}
+		for _, challenge := range listed {
+			if !seen[challenge.ID] && match(challenge) {
+				seen[challenge.ID] = true
+				challenges = append(challenges, challenge)
+			}
+		}
+	}
+
+	var deleted int64
+	for _, challenge := range challenges {
+		if err := r.DeleteChallenge(ctx, challenge); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// AcquireResendCooldown starts a resend cooldown for a phone number in every region unless one is
+// running, returning the longest remaining time of the cooldowns running in any region or zero
+func (r *ReplicatedOTPRepository) AcquireResendCooldown(ctx context.Context, phoneNumber string, cooldown time.Duration) (time.Duration, error) {
+	remaining := make([]time.Duration, len(r.regions))
+	err := r.replicate(ctx, func(i int, repo RegionalOTPRepository) error {
+		var err error
+		remaining[i], err = repo.AcquireResendCooldown(ctx, phoneNumber, cooldown)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var longest time.Duration
+	for _, d := range remaining {
+		if d > longest {
+			longest = d
+		}
+	}
+	return longest, nil
+}
+
+// GetLockout returns the verification lockout state for a phone number in the local region
+func (r *ReplicatedOTPRepository) GetLockout(ctx context.Context, phoneNumber string) (*models.LockoutState, error) {
+	return r.regions[0].Repository.GetLockout(ctx, phoneNumber)
+}
+
+// RecordFailedVerification counts a failed verification for a phone number in every region,
+// returning the local region's lockout state
+func (r *ReplicatedOTPRepository) RecordFailedVerification(ctx context.Context, phoneNumber string, maxAttempts int, window, cooldown time.Duration) (*models.LockoutState, error) {
+	states := make([]*models.LockoutState, len(r.regions))
+	err := r.replicate(ctx, func(i int, repo RegionalOTPRepository) error {
+		var err error
+		states[i], err = repo.RecordFailedVerification(ctx, phoneNumber, maxAttempts, window, cooldown)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return states[0], nil
+}
+
+// ClearFailedVerifications resets the failed verification count and lockout for a phone number in every region
+func (r *ReplicatedOTPRepository) ClearFailedVerifications(ctx context.Context, phoneNumber string) error {
+	return r.replicate(ctx, func(_ int, repo RegionalOTPRepository) error {
+		return repo.ClearFailedVerifications(ctx, phoneNumber)
+	})
+}
@@ -2,47 +2,458 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/lilokie/otp-auth/internal/models"
 )
 
+// ErrUserNotFound is returned by user lookups that find no user. It wraps sql.ErrNoRows, so
+// checks for either match it; lookups failing with any other error did not get an answer.
+var ErrUserNotFound = fmt.Errorf("user not found: %w", sql.ErrNoRows)
+
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
-	// Create creates a new user
+	// Create creates a new user whose phone number was just verified by OTP
 	Create(ctx context.Context, phoneNumber string) (*models.User, error)
 
+	// FindOrCreateByPhoneNumber returns the user with a phone number, creating them as by Create
+	// if there is none, and whether they were created. Concurrent calls for the same phone number
+	// create one user and all return it. If the phone number belongs to a soft-deleted user, the
+	// error wraps ErrUserNotFound.
+	FindOrCreateByPhoneNumber(ctx context.Context, phoneNumber string) (user *models.User, created bool, err error)
+
+	// CreateImported creates a user brought in from another system; verifiedSource names
+	// the system that verified the phone number and must be nil unless phoneVerified is set
+	CreateImported(ctx context.Context, phoneNumber string, phoneVerified bool, verifiedSource *string) (*models.User, error)
+
+	// MarkPhoneVerified records that a user's phone number was verified by source
+	MarkPhoneVerified(ctx context.Context, id uuid.UUID, source string) error
+
+	// SetRole sets the role of a user
+	SetRole(ctx context.Context, id uuid.UUID, role string) error
+
+	// SetAnalyticsConsent sets whether a user consents to analytics, i.e. whether events
+	// about the user reach analytics webhook endpoints unchanged
+	SetAnalyticsConsent(ctx context.Context, id uuid.UUID, consent bool) error
+
+	// Stats counts active users by phone verification status and source
+	Stats(ctx context.Context) (*models.UserStats, error)
+
 	// FindByID finds a user by ID
 	FindByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 
 	// FindByPhoneNumber finds a user by phone number
 	FindByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error)
 
-	// List returns a list of users with pagination and search
+	// List returns a list of users with pagination and search, newest first, and the number of
+	// users matching the search. Users match params.Metadata if they have all of its keys with
+	// the same values. With params.Cursor or params.Limit set, it returns up to Limit
+	// users after the user the cursor was returned for by UserCursor, or from the newest if it
+	// is empty, without counting the users matching; the count is then 0. Unknown cursors fail
+	// with ErrInvalidCursor. Pages not counted exactly, as of params.IncludeTotal, have one more
+	// user than the page size when more follow; the count is then 0 or the estimate.
 	List(ctx context.Context, params models.PaginationParams) ([]models.User, int64, error)
 
 	// Update updates a user
 	Update(ctx context.Context, user *models.User) error
 
-	// Delete deletes a user
+	// UpdateProfile sets the profile fields of a user given in update, leaving the others
+	// unchanged, and returns the updated user
+	UpdateProfile(ctx context.Context, id uuid.UUID, update models.UpdateProfileRequest) (*models.User, error)
+
+	// UpdateMetadata sets the metadata keys of a user given with a value and removes those
+	// given with nil, leaving the others unchanged, and returns the updated user
+	UpdateMetadata(ctx context.Context, id uuid.UUID, update map[string]*string) (*models.User, error)
+
+	// Delete soft-deletes a user
 	Delete(ctx context.Context, id uuid.UUID) error
+
+	// FindDeletedByID finds a soft-deleted user by ID
+	FindDeletedByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+
+	// FindDeletedByPhoneNumber finds a soft-deleted user by phone number
+	FindDeletedByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error)
+
+	// Restore un-deletes a user that was soft-deleted after deletedAfter
+	Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*models.User, error)
+
+	// Purge permanently deletes the users soft-deleted before deletedBefore, along with their
+	// login history, backup codes and trusted devices, and returns their IDs
+	Purge(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error)
+}
+
+// AuditRepository defines the interface for audit trail operations
+type AuditRepository interface {
+	// Create records a new audit log entry
+	Create(ctx context.Context, entry *models.AuditLog) error
+
+	// ListByTarget returns the latest limit entries about a target, newest first, and how many
+	// entries there are about it
+	ListByTarget(ctx context.Context, targetType, targetID string, limit int) ([]models.AuditLog, int64, error)
+}
+
+// EventRepository defines the interface for the append-only domain event log
+type EventRepository interface {
+	// Append stores a domain event, assigning its sequence number
+	Append(ctx context.Context, event *models.DomainEvent) error
+
+	// ListAfter returns up to limit events with a sequence number above afterSequence, in sequence order
+	ListAfter(ctx context.Context, afterSequence int64, limit int) ([]models.DomainEvent, error)
+
+	// ListByAggregate returns the latest limit events about an aggregate, newest first, and how
+	// many events there are about it
+	ListByAggregate(ctx context.Context, aggregateType, aggregateID string, limit int) ([]models.DomainEvent, int64, error)
+}
+
+// Repositories are the repositories a unit of work runs its steps against
+type Repositories struct {
+	Users  UserRepository // records its changes in Events
+	Audit  AuditRepository
+	Events EventRepository
+	Logins LoginHistoryRepository
+}
+
+// UnitOfWork runs multi-step operations on the database as one. Only the database's
+// repositories take part; sessions, OTPs and other data kept in Redis are not rolled back.
+type UnitOfWork interface {
+	// WithTx runs fn against repositories whose changes are committed together when fn returns
+	// nil, and rolled back when it returns an error, which WithTx returns
+	WithTx(ctx context.Context, fn func(repos Repositories) error) error
+}
+
+// ActiveUserRepository defines the interface for the active user read model
+type ActiveUserRepository interface {
+	// RecordActivity records that a user was active on the UTC day of at
+	RecordActivity(ctx context.Context, userID uuid.UUID, at time.Time) error
+
+	// CountActive counts the distinct users active on the UTC days from since through until
+	CountActive(ctx context.Context, since, until time.Time) (int64, error)
+
+	// LastSequence returns the sequence number of the last domain event fed to the read model
+	LastSequence(ctx context.Context) (int64, error)
+
+	// SetLastSequence stores the sequence number of the last domain event fed to the read model
+	SetLastSequence(ctx context.Context, sequence int64) error
+}
+
+// SessionRepository defines the interface for session operations
+type SessionRepository interface {
+	// Create stores a new session until it expires and revokes the user's oldest sessions
+	// beyond maxSessions (unlimited if 0), returning the IDs of the revoked sessions
+	Create(ctx context.Context, session *models.Session, maxSessions int) ([]uuid.UUID, error)
+
+	// Get finds an unexpired session by ID
+	Get(ctx context.Context, id uuid.UUID) (*models.Session, error)
+
+	// FindByRefreshTokenHash finds the unexpired session with the given refresh token hash
+	FindByRefreshTokenHash(ctx context.Context, refreshTokenHash string) (*models.Session, error)
+
+	// Rotate replaces the refresh token hash and last use of a session, reporting whether
+	// oldRefreshTokenHash still belonged to it, so each refresh token is used only once
+	Rotate(ctx context.Context, session *models.Session, oldRefreshTokenHash string) (bool, error)
+
+	// ListByUser returns a user's unexpired sessions, newest first
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+
+	// DeleteAllByUser deletes all of a user's sessions, returning the IDs of the deleted sessions
+	DeleteAllByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// UniqueIPRepository defines the interface for counting distinct client IPs per endpoint and day
+type UniqueIPRepository interface {
+	// AddIPs records the client IPs that requested each endpoint on the UTC day of day
+	AddIPs(ctx context.Context, day time.Time, ipsByEndpoint map[string][]string) error
+
+	// CountIPs counts the distinct client IPs that requested each endpoint on the UTC day of day
+	CountIPs(ctx context.Context, day time.Time) (map[string]int64, error)
+}
+
+// AbuseReportRepository defines the interface for abuse report operations
+type AbuseReportRepository interface {
+	// Create stores a new abuse report
+	Create(ctx context.Context, report *models.AbuseReport) error
+
+	// List returns a page of abuse reports with the given status, or of every status if empty, oldest first
+	List(ctx context.Context, params models.AbuseReportListParams) ([]models.AbuseReport, int64, error)
+
+	// GetByID finds an abuse report by ID
+	GetByID(ctx context.Context, id uuid.UUID) (*models.AbuseReport, error)
+
+	// Review sets the status of a report and of the other pending reports of its phone number,
+	// returning how many reports were updated
+	Review(ctx context.Context, id uuid.UUID, status string, reviewerID *uuid.UUID) (int64, error)
+
+	// HasActiveReports reports whether a phone number has a pending or confirmed abuse report
+	HasActiveReports(ctx context.Context, phoneNumber string) (bool, error)
+}
+
+// SuppressionRepository defines the interface for the suppression list
+type SuppressionRepository interface {
+	// Add puts a phone number on the suppression list for a reason, reporting whether
+	// it was added or already suppressed for that reason
+	Add(ctx context.Context, suppression *models.Suppression) (bool, error)
+
+	// Remove takes a phone number off the suppression list for a reason, or for every reason
+	// if reason is empty, returning how many entries were removed
+	Remove(ctx context.Context, phoneNumber, reason string) (int64, error)
+
+	// IsSuppressed reports whether a phone number is on the suppression list for any reason
+	IsSuppressed(ctx context.Context, phoneNumber string) (bool, error)
+
+	// List returns the whole suppression list, oldest first
+	List(ctx context.Context) ([]models.Suppression, error)
+}
+
+// PhoneListRepository defines the interface for the phone number blocklist and allowlist
+type PhoneListRepository interface {
+	// Add puts a prefix on a list, reporting whether it was added or on the list already
+	Add(ctx context.Context, entry *models.PhoneListEntry) (bool, error)
+
+	// Remove takes a prefix off a list, reporting whether it was on the list
+	Remove(ctx context.Context, list, prefix string) (bool, error)
+
+	// Match returns the entries of both lists whose prefix phoneNumber starts with
+	Match(ctx context.Context, phoneNumber string) ([]models.PhoneListEntry, error)
+
+	// List returns the entries of both lists ordered by list and prefix
+	List(ctx context.Context) ([]models.PhoneListEntry, error)
+}
+
+// TrustedDeviceRepository defines the interface for trusted device operations
+type TrustedDeviceRepository interface {
+	// Create stores a new trusted device
+	Create(ctx context.Context, device *models.TrustedDevice) error
+
+	// FindActiveByTokenHash finds the unrevoked, unexpired device with the given token hash
+	FindActiveByTokenHash(ctx context.Context, tokenHash string, now time.Time) (*models.TrustedDevice, error)
+
+	// MarkUsed records that a device signed in at usedAt
+	MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+
+	// ListActiveByUser returns a user's unrevoked, unexpired devices, newest first
+	ListActiveByUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]models.TrustedDevice, error)
+
+	// Revoke revokes one of a user's devices, reporting whether an unrevoked device was found
+	Revoke(ctx context.Context, userID, id uuid.UUID, revokedAt time.Time) (bool, error)
+}
+
+// APIKeyRepository defines the interface for API key operations
+type APIKeyRepository interface {
+	// Create stores a new API key
+	Create(ctx context.Context, key *models.APIKey) error
+
+	// FindActiveByKeyHash finds the unrevoked API key with the given key hash
+	FindActiveByKeyHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+
+	// MarkUsed records that a key authenticated a request at usedAt
+	MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+
+	// List returns every API key, revoked ones included, newest first
+	List(ctx context.Context) ([]models.APIKey, error)
+
+	// Revoke revokes an API key, reporting whether an unrevoked key was found
+	Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) (bool, error)
+}
+
+// LoginHistoryRepository defines the interface for login attempt operations
+type LoginHistoryRepository interface {
+	// Record stores a login attempt
+	Record(ctx context.Context, attempt *models.LoginAttempt) error
+
+	// ListByUser returns a page of a user's login attempts, newest first
+	ListByUser(ctx context.Context, userID uuid.UUID, params models.PaginationParams) ([]models.LoginAttempt, int64, error)
+}
+
+// WebhookRepository defines the interface for the webhook delivery queue
+type WebhookRepository interface {
+	// LastSequence returns the sequence number of the last domain event queued for webhooks
+	LastSequence(ctx context.Context) (int64, error)
+
+	// SetLastSequence stores the sequence number of the last domain event queued for webhooks,
+	// unless a later one is stored already
+	SetLastSequence(ctx context.Context, sequence int64) error
+
+	// Enqueue stores new deliveries, skipping those already queued for the same endpoint and event
+	Enqueue(ctx context.Context, deliveries []models.WebhookDelivery) error
+
+	// ClaimDue returns up to limit pending deliveries due at now, earliest first, and postpones
+	// them to leaseUntil so other instances don't attempt them at the same time
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error)
+
+	// Update stores the outcome of a delivery attempt
+	Update(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// BackupCodeRepository defines the interface for one-time backup code operations
+type BackupCodeRepository interface {
+	// ReplaceBackupCodes replaces all backup codes of a user with the given code hashes
+	ReplaceBackupCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+
+	// UseBackupCode marks an unused backup code of a user as used,
+	// reporting whether a matching unused code was found
+	UseBackupCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
 }
 
 // OTPRepository defines the interface for OTP operations
 type OTPRepository interface {
-	// StoreOTP stores an OTP with expiration
-	StoreOTP(ctx context.Context, phoneNumber, otp string, expiration time.Duration) error
+	// StoreChallenge stores an OTP challenge with expiration
+	StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error
+
+	// GetChallenge retrieves a pending OTP challenge by ID
+	GetChallenge(ctx context.Context, id string) (*models.OTPChallenge, error)
+
+	// GetLatestChallenge retrieves the most recently issued pending OTP challenge for a phone number
+	GetLatestChallenge(ctx context.Context, phoneNumber string) (*models.OTPChallenge, error)
+
+	// DeleteChallenge deletes an OTP challenge
+	DeleteChallenge(ctx context.Context, challenge *models.OTPChallenge) error
+
+	// DeleteChallengesByPhone deletes all pending OTP challenges for a phone number
+	DeleteChallengesByPhone(ctx context.Context, phoneNumber string) (int64, error)
+
+	// DeleteChallengesByPrefix deletes all pending OTP challenges for phone numbers starting with prefix
+	DeleteChallengesByPrefix(ctx context.Context, prefix string) (int64, error)
+
+	// AcquireResendCooldown starts a resend cooldown for a phone number unless one is running,
+	// returning the remaining time of the running cooldown or zero if it was started
+	AcquireResendCooldown(ctx context.Context, phoneNumber string, cooldown time.Duration) (time.Duration, error)
+
+	// GetLockout returns the verification lockout state for a phone number
+	GetLockout(ctx context.Context, phoneNumber string) (*models.LockoutState, error)
+
+	// RecordFailedVerification counts a failed verification for a phone number and locks it
+	// for cooldown once maxAttempts failures happened within window
+	RecordFailedVerification(ctx context.Context, phoneNumber string, maxAttempts int, window, cooldown time.Duration) (*models.LockoutState, error)
+
+	// ClearFailedVerifications resets the failed verification count and lockout for a phone number
+	ClearFailedVerifications(ctx context.Context, phoneNumber string) error
+}
+
+// OTPCleanupRepository deletes expired OTP records from stores that don't expire them
+type OTPCleanupRepository interface {
+	// DeleteExpired deletes the expired challenges, cooldowns and failed verifications,
+	// returning the number of records deleted
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// RegionalOTPRepository is an OTPRepository holding one region's copy of OTPs replicated across regions
+type RegionalOTPRepository interface {
+	OTPRepository
 
-	// GetOTP retrieves an OTP for a phone number
-	GetOTP(ctx context.Context, phoneNumber string) (string, error)
+	// TombstoneChallenge deletes an OTP challenge and keeps a tombstone of it for ttl, so a copy
+	// of the challenge replicated late cannot store it again, reporting whether it was pending
+	TombstoneChallenge(ctx context.Context, challenge *models.OTPChallenge, ttl time.Duration) (bool, error)
 
-	// DeleteOTP deletes an OTP for a phone number
-	DeleteOTP(ctx context.Context, phoneNumber string) error
+	// IsTombstoned reports whether an OTP challenge was deleted by TombstoneChallenge
+	IsTombstoned(ctx context.Context, id string) (bool, error)
+
+	// ListChallenges returns the pending OTP challenges for phone numbers starting with prefix
+	ListChallenges(ctx context.Context, prefix string) ([]*models.OTPChallenge, error)
+}
+
+// OTPDeliveryRepository defines the interface for OTP delivery status storage
+type OTPDeliveryRepository interface {
+	// Save stores the delivery status of an OTP challenge's latest send with expiration, replacing any earlier status
+	Save(ctx context.Context, delivery *models.OTPDelivery, expiration time.Duration) error
+
+	// UpdateStatus sets the status of the sent message a provider's delivery receipt refers to,
+	// reporting whether it was updated. Receipts for superseded sends or sends that already
+	// have a final status are ignored.
+	UpdateStatus(ctx context.Context, provider, messageID, status string, at time.Time) (bool, error)
+
+	// Get retrieves the delivery status of the latest send of an OTP challenge
+	Get(ctx context.Context, challengeID string) (*models.OTPDelivery, error)
+}
+
+// LoginStatusRepository defines the interface for the sign-in statuses of challenges,
+// which are pushed to the clients subscribed to them
+type LoginStatusRepository interface {
+	// Save stores the login status of a challenge with expiration and notifies its subscribers
+	Save(ctx context.Context, status *models.LoginStatus, expiration time.Duration) error
+
+	// Get retrieves the stored login status of a challenge
+	Get(ctx context.Context, challengeID string) (*models.LoginStatus, error)
+
+	// Subscribe returns the login statuses saved for a challenge from now on; the channel
+	// is closed once ctx is done
+	Subscribe(ctx context.Context, challengeID string) (<-chan *models.LoginStatus, error)
+}
+
+// OTPSendQueueRepository defines the interface for the queue of OTPs sent in the background
+type OTPSendQueueRepository interface {
+	// Enqueue adds a job to the queue, due at once, unless maxLength jobs are queued already
+	// or, with tenantMaxLength above 0, tenantMaxLength jobs of job.Tenant. It reports whether
+	// the job was added.
+	Enqueue(ctx context.Context, job *models.OTPSendJob, maxLength, tenantMaxLength int) (bool, error)
+
+	// ClaimDue returns up to limit jobs due at now and leases them until leaseUntil,
+	// when they become due again unless completed or rescheduled
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.OTPSendJob, error)
+
+	// Reschedule stores a claimed job's attempts and makes it due again at
+	Reschedule(ctx context.Context, job *models.OTPSendJob, at time.Time) error
+
+	// Complete removes a job from the queue
+	Complete(ctx context.Context, id string) error
+
+	// DeadLetter moves a job from the queue to the dead-letter list, which keeps the newest maxSize jobs
+	DeadLetter(ctx context.Context, job *models.OTPSendJob, maxSize int) error
+
+	// DeadLetters returns the jobs on the dead-letter list, newest first
+	DeadLetters(ctx context.Context) ([]models.OTPSendJob, error)
+
+	// Length returns the number of queued jobs, leased ones included
+	Length(ctx context.Context) (int64, error)
+
+	// TenantLength returns the number of queued jobs of a tenant, leased ones included
+	TenantLength(ctx context.Context, tenant string) (int64, error)
+}
+
+// MaintenanceNoticeRepository defines the interface for announcements of planned downtime
+type MaintenanceNoticeRepository interface {
+	// Create stores a maintenance notice
+	Create(ctx context.Context, notice *models.MaintenanceNotice) error
+
+	// List returns every maintenance notice, ended ones included, by start time
+	List(ctx context.Context) ([]models.MaintenanceNotice, error)
+
+	// Delete removes a maintenance notice, reporting whether it existed
+	Delete(ctx context.Context, id string) (bool, error)
+}
+
+// ProviderStateRepository defines the interface for SMS provider rotation state
+type ProviderStateRepository interface {
+	// DisabledProviders returns the names of providers taken out of rotation
+	DisabledProviders(ctx context.Context) ([]string, error)
+
+	// SetProviderEnabled puts a provider back into or takes it out of rotation
+	SetProviderEnabled(ctx context.Context, name string, enabled bool) error
+
+	// RecordProviderResult counts a send through a provider, and whether it failed, in the
+	// provider's error rate window, starting a window of length window if none is running,
+	// and returns the window's counts
+	RecordProviderResult(ctx context.Context, name string, failed bool, window time.Duration) (models.ProviderHealth, error)
+
+	// QuarantineProvider takes a provider out of rotation for duration and starts its error count over
+	QuarantineProvider(ctx context.Context, name string, duration time.Duration) error
+
+	// ResetProviderHealth ends a provider's quarantine and starts its error count over
+	ResetProviderHealth(ctx context.Context, name string) error
+
+	// ProvidersHealth returns the health of the named providers by name
+	ProvidersHealth(ctx context.Context, names []string) (map[string]models.ProviderHealth, error)
+}
 
-	// CheckRateLimit checks if the rate limit for a phone number has been exceeded
-	CheckRateLimit(ctx context.Context, phoneNumber string, limit int, window time.Duration) (bool, error)
+// LockRepository defines the interface for short-lived locks serializing work across instances
+type LockRepository interface {
+	// AcquireLock takes the lock named key for ttl unless it is held, returning the token to
+	// release it with, or "" if another holder has it
+	AcquireLock(ctx context.Context, key string, ttl time.Duration) (string, error)
 
-	// IncrementRateLimit increments the rate limit counter for a phone number
-	IncrementRateLimit(ctx context.Context, phoneNumber string, window time.Duration) error
+	// ReleaseLock releases a lock taken with token. A lock that expired and was taken by
+	// another holder in the meantime is left alone.
+	ReleaseLock(ctx context.Context, key, token string) error
 }
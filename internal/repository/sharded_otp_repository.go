@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/sharding"
+)
+
+// challengeShardKeyPrefix prefixes the keys recording which shard holds a challenge
+const challengeShardKeyPrefix = "otp_challenge_shard:"
+
+// ShardedOTPRepository implements OTPRepository across several Redis instances.
+// Everything about a phone number, its challenges included, lives on the shard its
+// number routes to. Challenges are also looked up by ID alone, so the name of their
+// shard is recorded under the ID on the shard the ID routes to.
+type ShardedOTPRepository struct {
+	router *sharding.Router
+	shards []*RedisOTPRepository
+}
+
+// NewShardedOTPRepository creates a new sharded OTP repository; clients are in the router's shard order
+func NewShardedOTPRepository(router *sharding.Router, clients []*redis.Client) *ShardedOTPRepository {
+	shards := make([]*RedisOTPRepository, len(clients))
+	for i, client := range clients {
+		shards[i] = NewRedisOTPRepository(client)
+	}
+	return &ShardedOTPRepository{router: router, shards: shards}
+}
+
+// phoneShard returns the shard holding a phone number's keys
+func (r *ShardedOTPRepository) phoneShard(phoneNumber string) *RedisOTPRepository {
+	return r.shards[r.router.Route(phoneNumber)]
+}
+
+// StoreChallenge stores an OTP challenge with expiration
+func (r *ShardedOTPRepository) StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error {
+	index := r.router.Route(challenge.PhoneNumber)
+	if err := r.shards[index].StoreChallenge(ctx, challenge, expiration); err != nil {
+		return err
+	}
+
+	pointer := r.shards[r.router.Route(challenge.ID)].client
+	err := pointer.Set(ctx, challengeShardKeyPrefix+challenge.ID, r.router.Name(index), expiration).Err()
+	if err != nil {
+		return fmt.Errorf("error storing OTP challenge: %w", err)
+	}
+	return nil
+}
+
+// GetChallenge retrieves a pending OTP challenge by ID
+func (r *ShardedOTPRepository) GetChallenge(ctx context.Context, id string) (*models.OTPChallenge, error) {
+	pointer := r.shards[r.router.Route(id)].client
+	name, err := pointer.Get(ctx, challengeShardKeyPrefix+id).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("OTP not found or expired")
+		}
+		return nil, fmt.Errorf("error retrieving OTP challenge: %w", err)
+	}
+
+	// The challenge's shard may have been removed from the configuration since
+	index := r.router.Index(name)
+	if index < 0 {
+		return nil, fmt.Errorf("OTP not found or expired")
+	}
+	return r.shards[index].GetChallenge(ctx, id)
+}
+
+// GetLatestChallenge retrieves the most recently issued pending OTP challenge for a phone number
+func (r *ShardedOTPRepository) GetLatestChallenge(ctx context.Context, phoneNumber string) (*models.OTPChallenge, error) {
+	return r.phoneShard(phoneNumber).GetLatestChallenge(ctx, phoneNumber)
+}
+
+// DeleteChallenge deletes an OTP challenge
+func (r *ShardedOTPRepository) DeleteChallenge(ctx context.Context, challenge *models.OTPChallenge) error {
+	if err := r.phoneShard(challenge.PhoneNumber).DeleteChallenge(ctx, challenge); err != nil {
+		return err
+	}
+
+	pointer := r.shards[r.router.Route(challenge.ID)].client
+	if err := pointer.Del(ctx, challengeShardKeyPrefix+challenge.ID).Err(); err != nil {
+		return fmt.Errorf("error deleting OTP challenge: %w", err)
+	}
+	return nil
+}
+
+// DeleteChallengesByPhone deletes all pending OTP challenges for a phone number.
+// The shard records of the deleted challenges expire with them.
+func (r *ShardedOTPRepository) DeleteChallengesByPhone(ctx context.Context, phoneNumber string) (int64, error) {
+	return r.phoneShard(phoneNumber).DeleteChallengesByPhone(ctx, phoneNumber)
+}
+
+// DeleteChallengesByPrefix deletes all pending OTP challenges for phone numbers starting with prefix
+func (r *ShardedOTPRepository) DeleteChallengesByPrefix(ctx context.Context, prefix string) (int64, error) {
+	var deleted int64
+	for _, shard := range r.shards {
+		n, err := shard.DeleteChallengesByPrefix(ctx, prefix)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// AcquireResendCooldown starts a resend cooldown for a phone number unless one is running,
+// returning the remaining time of the running cooldown or zero if it was started
+func (r *ShardedOTPRepository) AcquireResendCooldown(ctx context.Context, phoneNumber string, cooldown time.Duration) (time.Duration, error) {
+	return r.phoneShard(phoneNumber).AcquireResendCooldown(ctx, phoneNumber, cooldown)
+}
+
+// GetLockout returns the verification lockout state for a phone number
+func (r *ShardedOTPRepository) GetLockout(ctx context.Context, phoneNumber string) (*models.LockoutState, error) {
+	return r.phoneShard(phoneNumber).GetLockout(ctx, phoneNumber)
+}
+
+// RecordFailedVerification counts a failed verification for a phone number and locks it
+// for cooldown once maxAttempts failures happened within window
+func (r *ShardedOTPRepository) RecordFailedVerification(ctx context.Context, phoneNumber string, maxAttempts int, window, cooldown time.Duration) (*models.LockoutState, error) {
+	return r.phoneShard(phoneNumber).RecordFailedVerification(ctx, phoneNumber, maxAttempts, window, cooldown)
+}
+
+// ClearFailedVerifications resets the failed verification count and lockout for a phone number
+func (r *ShardedOTPRepository) ClearFailedVerifications(ctx context.Context, phoneNumber string) error {
+	return r.phoneShard(phoneNumber).ClearFailedVerifications(ctx, phoneNumber)
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/pubsub"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+func TestCachedPhoneListRepositoryPropagatesChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two instances sharing the lists and a broker
+	lists := repository.NewInMemoryPhoneListRepository()
+	broker := pubsub.NewInMemoryBroker()
+	newInstance := func() *repository.CachedPhoneListRepository {
+		bus := pubsub.NewBus(broker, metrics.NewRegistry(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+		go bus.Run(ctx)
+		return repository.NewCachedPhoneListRepository(lists, bus)
+	}
+	first := newInstance()
+	second := newInstance()
+
+	// Load the second instance's copy before the change
+	if entries, err := second.Match(ctx, "+989123456789"); err != nil || len(entries) != 0 {
+		t.Fatalf("expected no matches, got %+v, %v", entries, err)
+	}
+
+	if _, err := first.Add(ctx, &models.PhoneListEntry{List: models.PhoneListBlock, Prefix: "+98912"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if entries, err := first.Match(ctx, "+989123456789"); err != nil || len(entries) != 1 {
+		t.Fatalf("expected the change to apply on its instance at once, got %+v, %v", entries, err)
+	}
+
+	waitForMatches := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			entries, err := second.Match(ctx, "+989123456789")
+			if err != nil {
+				t.Fatalf("Match: %v", err)
+			}
+			if len(entries) == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d matches on the other instance, got %+v", want, entries)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitForMatches(1)
+
+	if _, err := first.Remove(ctx, models.PhoneListBlock, "+98912"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	waitForMatches(0)
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// partitionedRegion is a region that fails every call while down, as if unreachable
+type partitionedRegion struct {
+	*repository.InMemoryOTPRepository
+	down bool
+}
+
+var errRegionDown = errors.New("region unreachable")
+
+func (r *partitionedRegion) StoreChallenge(ctx context.Context, challenge *models.OTPChallenge, expiration time.Duration) error {
+	if r.down {
+		return errRegionDown
+	}
+	return r.InMemoryOTPRepository.StoreChallenge(ctx, challenge, expiration)
+}
+
+func (r *partitionedRegion) GetChallenge(ctx context.Context, id string) (*models.OTPChallenge, error) {
+	if r.down {
+		return nil, errRegionDown
+	}
+	return r.InMemoryOTPRepository.GetChallenge(ctx, id)
+}
+
+func (r *partitionedRegion) TombstoneChallenge(ctx context.Context, challenge *models.OTPChallenge, ttl time.Duration) (bool, error) {
+	if r.down {
+		return false, errRegionDown
+	}
+	return r.InMemoryOTPRepository.TombstoneChallenge(ctx, challenge, ttl)
+}
+
+// newRegions returns the OTP stores of two regions and a replicated repository for each of them
+func newRegions() (a, b *partitionedRegion, inA, inB *repository.ReplicatedOTPRepository) {
+	a = &partitionedRegion{InMemoryOTPRepository: repository.NewInMemoryOTPRepository()}
+	b = &partitionedRegion{InMemoryOTPRepository: repository.NewInMemoryOTPRepository()}
+	inA = repository.NewReplicatedOTPRepository([]repository.OTPRegion{
+		{Name: "a", Repository: a},
+		{Name: "b", Repository: b},
+	}, time.Minute, logging.Discard())
+	inB = repository.NewReplicatedOTPRepository([]repository.OTPRegion{
+		{Name: "b", Repository: b},
+		{Name: "a", Repository: a},
+	}, time.Minute, logging.Discard())
+	return a, b, inA, inB
+}
+
+func TestReplicatedOTPRepositoryVerifyInOtherRegion(t *testing.T) {
+	ctx := context.Background()
+	a, b, inA, inB := newRegions()
+
+	challenge := &models.OTPChallenge{ID: "challenge-1", PhoneNumber: "+15550001", Code: "123456"}
+	if err := inA.StoreChallenge(ctx, challenge, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	if _, err := b.GetChallenge(ctx, challenge.ID); err != nil {
+		t.Fatalf("expected the challenge to be replicated to the other region: %v", err)
+	}
+
+	got, err := inB.GetChallenge(ctx, challenge.ID)
+	if err != nil || *got != *challenge {
+		t.Fatalf("expected the challenge in the other region, got %+v (%v)", got, err)
+	}
+	if err := inB.DeleteChallenge(ctx, got); err != nil {
+		t.Fatalf("DeleteChallenge: %v", err)
+	}
+	if _, err := inA.GetChallenge(ctx, challenge.ID); err == nil {
+		t.Fatal("expected the verified challenge to be deleted in every region")
+	}
+	if tombstoned, _ := a.IsTombstoned(ctx, challenge.ID); !tombstoned {
+		t.Fatal("expected a tombstone in the region the challenge was requested in")
+	}
+}
+
+func TestReplicatedOTPRepositoryFallsBackToOtherRegion(t *testing.T) {
+	ctx := context.Background()
+	_, b, inA, inB := newRegions()
+
+	// Region b misses the store while unreachable
+	b.down = true
+	challenge := &models.OTPChallenge{ID: "challenge-1", PhoneNumber: "+15550001", Code: "123456"}
+	if err := inA.StoreChallenge(ctx, challenge, time.Minute); err != nil {
+		t.Fatalf("expected the store to succeed with another region down, got %v", err)
+	}
+	b.down = false
+
+	got, err := inB.GetChallenge(ctx, challenge.ID)
+	if err != nil || got.ID != challenge.ID {
+		t.Fatalf("expected region b to read the challenge from region a, got %+v (%v)", got, err)
+	}
+
+	// The local region failing fails the write
+	b.down = true
+	if err := inB.StoreChallenge(ctx, &models.OTPChallenge{ID: "challenge-2", PhoneNumber: "+15550001"}, time.Minute); !errors.Is(err, errRegionDown) {
+		t.Fatalf("expected the local region's error, got %v", err)
+	}
+}
+
+func TestReplicatedOTPRepositoryDeleteWinsOverLateStore(t *testing.T) {
+	ctx := context.Background()
+	a, b, inA, inB := newRegions()
+
+	// The challenge is stored in region a and verified there before its store reaches region b
+	challenge := &models.OTPChallenge{ID: "challenge-1", PhoneNumber: "+15550001", Code: "123456"}
+	if err := a.InMemoryOTPRepository.StoreChallenge(ctx, challenge, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	if err := inA.DeleteChallenge(ctx, challenge); err != nil {
+		t.Fatalf("DeleteChallenge: %v", err)
+	}
+
+	// The late store must not bring the used challenge back in region b
+	if err := b.StoreChallenge(ctx, challenge, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	if _, err := inB.GetChallenge(ctx, challenge.ID); err == nil {
+		t.Fatal("expected the tombstone to win over the late store")
+	}
+}
+
+func TestReplicatedOTPRepositoryIgnoresRemoteCopyOfDeletedChallenge(t *testing.T) {
+	ctx := context.Background()
+	a, b, inA, inB := newRegions()
+
+	challenge := &models.OTPChallenge{ID: "challenge-1", PhoneNumber: "+15550001", Code: "123456"}
+	if err := inA.StoreChallenge(ctx, challenge, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+
+	// Region a misses the delete of a challenge verified in region b
+	a.down = true
+	if err := inB.DeleteChallenge(ctx, challenge); err != nil {
+		t.Fatalf("DeleteChallenge: %v", err)
+	}
+	a.down = false
+
+	// Region b doesn't fall back to region a's stale copy
+	if _, err := inB.GetChallenge(ctx, challenge.ID); err == nil {
+		t.Fatal("expected the deleted challenge not to be read from another region")
+	}
+	// Deleting again by phone number clears the stale copy everywhere
+	deleted, err := inB.DeleteChallengesByPhone(ctx, challenge.PhoneNumber)
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected the stale copy to be deleted, got %d (%v)", deleted, err)
+	}
+	if _, err := b.InMemoryOTPRepository.GetChallenge(ctx, challenge.ID); err == nil {
+		t.Fatal("expected no copy in region b")
+	}
+	if _, err := inA.GetChallenge(ctx, challenge.ID); err == nil {
+		t.Fatal("expected the stale copy to be gone from region a")
+	}
+}
+
+func TestReplicatedOTPRepositoryLockoutAndCooldownAcrossRegions(t *testing.T) {
+	ctx := context.Background()
+	_, _, inA, inB := newRegions()
+
+	// Failures counted in either region add up in both
+	if _, err := inA.RecordFailedVerification(ctx, "+15550001", 2, time.Minute, time.Minute); err != nil {
+		t.Fatalf("RecordFailedVerification: %v", err)
+	}
+	state, err := inB.RecordFailedVerification(ctx, "+15550001", 2, time.Minute, time.Minute)
+	if err != nil || !state.Locked {
+		t.Fatalf("expected the second failure across regions to lock, got %+v (%v)", state, err)
+	}
+	if state, _ := inA.GetLockout(ctx, "+15550001"); !state.Locked {
+		t.Fatal("expected the lockout in region a too")
+	}
+
+	// A cooldown started in one region holds in the other
+	if remaining, err := inA.AcquireResendCooldown(ctx, "+15550001", time.Minute); err != nil || remaining != 0 {
+		t.Fatalf("expected the cooldown to start, got %v (%v)", remaining, err)
+	}
+	if remaining, err := inB.AcquireResendCooldown(ctx, "+15550001", time.Minute); err != nil || remaining <= 0 {
+		t.Fatalf("expected the cooldown to hold in region b, got %v (%v)", remaining, err)
+	}
+}
@@ -1,8 +1,384 @@
 package tests
 
-import "testing"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// The in-memory repositories must stay drop-in replacements for the real ones
+var (
+	_ repository.UserRepository          = (*repository.InMemoryUserRepository)(nil)
+	_ repository.OTPRepository           = (*repository.InMemoryOTPRepository)(nil)
+	_ repository.ProviderStateRepository = (*repository.InMemoryProviderStateRepository)(nil)
+	_ repository.SessionRepository       = (*repository.InMemorySessionRepository)(nil)
+	_ repository.SessionRepository       = (*repository.RedisSessionRepository)(nil)
+	_ repository.RegionalOTPRepository   = (*repository.InMemoryOTPRepository)(nil)
+	_ repository.RegionalOTPRepository   = (*repository.RedisOTPRepository)(nil)
+	_ repository.OTPRepository           = (*repository.ReplicatedOTPRepository)(nil)
+	_ repository.OTPRepository           = (*repository.DynamoDBOTPRepository)(nil)
+	_ repository.OTPRepository           = (*repository.PostgresOTPRepository)(nil)
+	_ repository.OTPCleanupRepository    = (*repository.PostgresOTPRepository)(nil)
+	_ repository.OTPCleanupRepository    = (*repository.InMemoryOTPRepository)(nil)
+	_ repository.OTPSendQueueRepository  = (*repository.InMemoryOTPSendQueueRepository)(nil)
+	_ repository.OTPSendQueueRepository  = (*repository.RedisOTPSendQueueRepository)(nil)
+	_ repository.LoginStatusRepository   = (*repository.InMemoryLoginStatusRepository)(nil)
+	_ repository.LoginStatusRepository   = (*repository.RedisLoginStatusRepository)(nil)
+	_ repository.PhoneListRepository     = (*repository.CachedPhoneListRepository)(nil)
+	_ repository.LockRepository          = (*repository.InMemoryLockRepository)(nil)
+	_ repository.LockRepository          = (*repository.RedisLockRepository)(nil)
+	_ repository.UserRepository          = (*repository.BreakerUserRepository)(nil)
+	_ repository.OTPRepository           = (*repository.BreakerOTPRepository)(nil)
+	_ repository.APIKeyRepository        = (*repository.InMemoryAPIKeyRepository)(nil)
+	_ repository.APIKeyRepository        = (*repository.PostgresAPIKeyRepository)(nil)
+	_ repository.AuditRepository         = (*repository.InMemoryAuditRepository)(nil)
+	_ repository.UnitOfWork              = (*repository.InMemoryUnitOfWork)(nil)
+	_ repository.APIKeyRepository        = (*repository.LimitedAPIKeyRepository)(nil)
+)
 
 func TestDummy(t *testing.T) {
 	// Just a placeholder test
 	//sorry for that :(
 }
+
+func TestInMemoryUserRepositoryCreateAndFind(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryUserRepository()
+
+	user, err := repo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if user.Role != models.RoleUser {
+		t.Fatalf("expected role %q, got %q", models.RoleUser, user.Role)
+	}
+
+	if _, err := repo.Create(ctx, "+15550001"); err == nil {
+		t.Fatal("expected duplicate phone number to be rejected")
+	}
+
+	byID, err := repo.FindByID(ctx, user.ID)
+	if err != nil || byID.PhoneNumber != user.PhoneNumber {
+		t.Fatalf("FindByID: %+v, %v", byID, err)
+	}
+	byPhone, err := repo.FindByPhoneNumber(ctx, user.PhoneNumber)
+	if err != nil || byPhone.ID != user.ID {
+		t.Fatalf("FindByPhoneNumber: %+v, %v", byPhone, err)
+	}
+
+	if _, err := repo.FindByPhoneNumber(ctx, "+15559999"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for unknown user, got %v", err)
+	}
+
+	// Lookups that find no user report it as such, unlike failed lookups
+	if _, err := repo.FindByID(ctx, uuid.New()); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound for unknown ID, got %v", err)
+	}
+	if _, err := repo.FindDeletedByPhoneNumber(ctx, user.PhoneNumber); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound for a user that is not deleted, got %v", err)
+	}
+}
+
+func TestInMemoryUserRepositoryList(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryUserRepository()
+
+	for _, phone := range []string{"+15550001", "+15550002", "+15560003"} {
+		if _, err := repo.Create(ctx, phone); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	users, total, err := repo.List(ctx, models.PaginationParams{Page: 1, PageSize: 2})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 3 || len(users) != 2 {
+		t.Fatalf("expected 2 of 3 users, got %d of %d", len(users), total)
+	}
+	if users[0].PhoneNumber != "+15560003" {
+		t.Fatalf("expected newest user first, got %s", users[0].PhoneNumber)
+	}
+
+	users, total, err = repo.List(ctx, models.PaginationParams{Page: 1, PageSize: 10, Search: "1555"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 2 || len(users) != 2 {
+		t.Fatalf("expected 2 matching users, got %d of %d", len(users), total)
+	}
+}
+
+func TestInMemoryUserRepositorySoftDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryUserRepository()
+
+	user, err := repo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := repo.FindByID(ctx, user.ID); err == nil {
+		t.Fatal("expected deleted user to be hidden")
+	}
+	if _, total, _ := repo.List(ctx, models.PaginationParams{}); total != 0 {
+		t.Fatalf("expected deleted user to be excluded from list, got %d", total)
+	}
+	deleted, err := repo.FindDeletedByPhoneNumber(ctx, user.PhoneNumber)
+	if err != nil || deleted.DeletedAt == nil {
+		t.Fatalf("FindDeletedByPhoneNumber: %+v, %v", deleted, err)
+	}
+
+	if _, err := repo.Restore(ctx, user.ID, time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("expected restore outside the window to fail")
+	}
+	restored, err := repo.Restore(ctx, user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Fatal("expected restored user to have no deleted_at")
+	}
+	if _, err := repo.FindByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected restored user to be found: %v", err)
+	}
+}
+
+func TestInMemoryUserRepositoryFindOrCreateByPhoneNumber(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryUserRepository()
+
+	// Concurrent verifications of a new phone number create one user
+	var wg sync.WaitGroup
+	users := make([]*models.User, 10)
+	created := make([]bool, len(users))
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user, ok, err := repo.FindOrCreateByPhoneNumber(ctx, "+15550001")
+			if err != nil {
+				t.Errorf("FindOrCreateByPhoneNumber: %v", err)
+				return
+			}
+			users[i], created[i] = user, ok
+		}(i)
+	}
+	wg.Wait()
+
+	creations := 0
+	for i, user := range users {
+		if user == nil {
+			t.FailNow()
+		}
+		if user.ID != users[0].ID {
+			t.Fatalf("got users %s and %s for the same phone number", users[0].ID, user.ID)
+		}
+		if created[i] {
+			creations++
+		}
+	}
+	if creations != 1 {
+		t.Fatalf("created = %d times, want 1", creations)
+	}
+	if !users[0].PhoneVerified || users[0].VerifiedSource == nil || *users[0].VerifiedSource != models.VerifiedSourceOTP {
+		t.Fatalf("created user = %+v, want phone verified by OTP", users[0])
+	}
+
+	// Soft-deleted users are not found nor recreated
+	if err := repo.Delete(ctx, users[0].ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := repo.FindOrCreateByPhoneNumber(ctx, "+15550001"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("err = %v, want sql.ErrNoRows for a soft-deleted user", err)
+	}
+}
+
+func TestInMemoryOTPRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryOTPRepository()
+
+	first := &models.OTPChallenge{ID: "c1", PhoneNumber: "+15550001", Code: "123456", IPAddress: "203.0.113.1", UserAgent: "test"}
+	if err := repo.StoreChallenge(ctx, first, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	challenge, err := repo.GetChallenge(ctx, "c1")
+	if err != nil || *challenge != *first {
+		t.Fatalf("GetChallenge: %+v, %v", challenge, err)
+	}
+
+	// The latest pending challenge of a phone number wins
+	time.Sleep(time.Millisecond)
+	second := &models.OTPChallenge{ID: "c2", PhoneNumber: "+15550001", Code: "654321"}
+	if err := repo.StoreChallenge(ctx, second, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	latest, err := repo.GetLatestChallenge(ctx, "+15550001")
+	if err != nil || latest.ID != "c2" {
+		t.Fatalf("GetLatestChallenge: %+v, %v", latest, err)
+	}
+
+	expiring := &models.OTPChallenge{ID: "c3", PhoneNumber: "+15550002", Code: "654321"}
+	if err := repo.StoreChallenge(ctx, expiring, 10*time.Millisecond); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := repo.GetChallenge(ctx, "c3"); err == nil {
+		t.Fatal("expected expired challenge to be gone")
+	}
+	if _, err := repo.GetLatestChallenge(ctx, "+15550002"); err == nil {
+		t.Fatal("expected no pending challenge after expiry")
+	}
+
+	outside := &models.OTPChallenge{ID: "c4", PhoneNumber: "+15560003", Code: "111111"}
+	if err := repo.StoreChallenge(ctx, outside, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	deleted, err := repo.DeleteChallengesByPrefix(ctx, "+1555")
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeleteChallengesByPrefix: %d, %v", deleted, err)
+	}
+	if _, err := repo.GetChallenge(ctx, "c4"); err != nil {
+		t.Fatalf("expected challenge outside prefix to remain: %v", err)
+	}
+
+	if err := repo.DeleteChallenge(ctx, outside); err != nil {
+		t.Fatalf("DeleteChallenge: %v", err)
+	}
+	if _, err := repo.GetChallenge(ctx, "c4"); err == nil {
+		t.Fatal("expected deleted challenge to be gone")
+	}
+}
+
+func TestInMemoryOTPRepositoryLockout(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryOTPRepository()
+
+	state, err := repo.RecordFailedVerification(ctx, "+15550001", 2, time.Minute, 50*time.Millisecond)
+	if err != nil || state.Locked || state.FailedAttempts != 1 {
+		t.Fatalf("first failure: %+v, %v", state, err)
+	}
+	state, err = repo.RecordFailedVerification(ctx, "+15550001", 2, time.Minute, 50*time.Millisecond)
+	if err != nil || !state.Locked {
+		t.Fatalf("expected second failure to lock: %+v, %v", state, err)
+	}
+
+	state, err = repo.GetLockout(ctx, "+15550001")
+	if err != nil || !state.Locked || state.RetryAfter <= 0 {
+		t.Fatalf("GetLockout: %+v, %v", state, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	state, err = repo.GetLockout(ctx, "+15550001")
+	if err != nil || state.Locked || state.FailedAttempts != 0 {
+		t.Fatalf("expected lockout to end after cooldown: %+v, %v", state, err)
+	}
+
+	repo.RecordFailedVerification(ctx, "+15550001", 2, time.Minute, time.Minute)
+	if err := repo.ClearFailedVerifications(ctx, "+15550001"); err != nil {
+		t.Fatalf("ClearFailedVerifications: %v", err)
+	}
+	state, _ = repo.GetLockout(ctx, "+15550001")
+	if state.FailedAttempts != 0 {
+		t.Fatalf("expected failures to be cleared, got %d", state.FailedAttempts)
+	}
+}
+
+func TestInMemoryOTPRepositoryResendCooldown(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryOTPRepository()
+
+	remaining, err := repo.AcquireResendCooldown(ctx, "+15550001", 50*time.Millisecond)
+	if err != nil || remaining != 0 {
+		t.Fatalf("first acquire: %v, %v", remaining, err)
+	}
+	remaining, err = repo.AcquireResendCooldown(ctx, "+15550001", 50*time.Millisecond)
+	if err != nil || remaining <= 0 {
+		t.Fatalf("expected running cooldown: %v, %v", remaining, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	remaining, err = repo.AcquireResendCooldown(ctx, "+15550001", 50*time.Millisecond)
+	if err != nil || remaining != 0 {
+		t.Fatalf("expected cooldown to end: %v, %v", remaining, err)
+	}
+}
+
+func TestInMemoryOTPRepositoryDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryOTPRepository()
+
+	expiring := &models.OTPChallenge{ID: "expiring", PhoneNumber: "+15550001"}
+	pending := &models.OTPChallenge{ID: "pending", PhoneNumber: "+15550002"}
+	if err := repo.StoreChallenge(ctx, expiring, 20*time.Millisecond); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	if err := repo.StoreChallenge(ctx, pending, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	if _, err := repo.AcquireResendCooldown(ctx, "+15550001", 20*time.Millisecond); err != nil {
+		t.Fatalf("AcquireResendCooldown: %v", err)
+	}
+	if _, err := repo.RecordFailedVerification(ctx, "+15550001", 5, 20*time.Millisecond, time.Minute); err != nil {
+		t.Fatalf("RecordFailedVerification: %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	deleted, err := repo.DeleteExpired(ctx)
+	if err != nil || deleted != 3 {
+		t.Fatalf("DeleteExpired: %d, %v", deleted, err)
+	}
+	if _, err := repo.GetChallenge(ctx, pending.ID); err != nil {
+		t.Fatalf("expected the pending challenge to be kept: %v", err)
+	}
+	if deleted, err := repo.DeleteExpired(ctx); err != nil || deleted != 0 {
+		t.Fatalf("DeleteExpired again: %d, %v", deleted, err)
+	}
+}
+
+func TestInMemoryLockRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryLockRepository()
+
+	token, err := repo.AcquireLock(ctx, "verify:+15550001", time.Minute)
+	if err != nil || token == "" {
+		t.Fatalf("expected to acquire the lock, got %q (%v)", token, err)
+	}
+	if other, err := repo.AcquireLock(ctx, "verify:+15550001", time.Minute); err != nil || other != "" {
+		t.Fatalf("expected the held lock to be refused, got %q (%v)", other, err)
+	}
+	if other, err := repo.AcquireLock(ctx, "verify:+15550002", time.Minute); err != nil || other == "" {
+		t.Fatalf("expected another key's lock to be acquired, got %q (%v)", other, err)
+	}
+
+	// Releasing with another holder's token leaves the lock alone
+	if err := repo.ReleaseLock(ctx, "verify:+15550001", "other-token"); err != nil {
+		t.Fatalf("ReleaseLock: %v", err)
+	}
+	if other, _ := repo.AcquireLock(ctx, "verify:+15550001", time.Minute); other != "" {
+		t.Fatal("expected the lock to stay held after a release with the wrong token")
+	}
+	if err := repo.ReleaseLock(ctx, "verify:+15550001", token); err != nil {
+		t.Fatalf("ReleaseLock: %v", err)
+	}
+	if again, err := repo.AcquireLock(ctx, "verify:+15550001", time.Millisecond); err != nil || again == "" {
+		t.Fatalf("expected the released lock to be acquired, got %q (%v)", again, err)
+	}
+
+	// Expired locks can be taken over
+	time.Sleep(5 * time.Millisecond)
+	if again, err := repo.AcquireLock(ctx, "verify:+15550001", time.Minute); err != nil || again == "" {
+		t.Fatalf("expected the expired lock to be acquired, got %q (%v)", again, err)
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// sessionRepositories returns the session repositories to test by name.
+// The Redis repository is only included when REDIS_ADDR points to a reachable Redis instance.
+func sessionRepositories(t *testing.T) map[string]repository.SessionRepository {
+	t.Helper()
+
+	repos := map[string]repository.SessionRepository{
+		"memory": repository.NewInMemorySessionRepository(),
+	}
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			t.Logf("skipping redis session repository: %v", err)
+		} else {
+			t.Cleanup(func() { client.Close() })
+			repos["redis"] = repository.NewRedisSessionRepository(client)
+		}
+	}
+	return repos
+}
+
+// newSession returns a session of userID created at createdAt that lasts an hour
+func newSession(userID uuid.UUID, createdAt time.Time) *models.Session {
+	return &models.Session{
+		ID:               uuid.New(),
+		UserID:           userID,
+		RefreshTokenHash: uuid.NewString(),
+		CreatedAt:        createdAt,
+		ExpiresAt:        createdAt.Add(time.Hour),
+	}
+}
+
+func TestSessionRepositoryLimit(t *testing.T) {
+	for name, repo := range sessionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			userID := uuid.New()
+			now := time.Now()
+
+			var sessions []*models.Session
+			for i := 0; i < 3; i++ {
+				session := newSession(userID, now.Add(time.Duration(i)*time.Millisecond))
+				revoked, err := repo.Create(ctx, session, 2)
+				if err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+				if i < 2 && len(revoked) != 0 {
+					t.Fatalf("expected nothing revoked below the limit, got %v", revoked)
+				}
+				if i == 2 && (len(revoked) != 1 || revoked[0] != sessions[0].ID) {
+					t.Fatalf("expected the oldest session revoked, got %v", revoked)
+				}
+				sessions = append(sessions, session)
+			}
+
+			listed, err := repo.ListByUser(ctx, userID)
+			if err != nil {
+				t.Fatalf("ListByUser: %v", err)
+			}
+			if len(listed) != 2 || listed[0].ID != sessions[2].ID || listed[1].ID != sessions[1].ID {
+				t.Fatalf("expected the two newest sessions, newest first, got %+v", listed)
+			}
+			if _, err := repo.Get(ctx, sessions[0].ID); err == nil {
+				t.Fatal("expected the revoked session to be gone")
+			}
+			if _, err := repo.FindByRefreshTokenHash(ctx, sessions[0].RefreshTokenHash); err == nil {
+				t.Fatal("expected the revoked session's refresh token to be gone")
+			}
+		})
+	}
+}
+
+func TestSessionRepositoryRotate(t *testing.T) {
+	for name, repo := range sessionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			session := newSession(uuid.New(), time.Now())
+			if _, err := repo.Create(ctx, session, 0); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			oldHash := session.RefreshTokenHash
+			usedAt := time.Now()
+			session.RefreshTokenHash = uuid.NewString()
+			session.LastUsedAt = &usedAt
+			rotated, err := repo.Rotate(ctx, session, oldHash)
+			if err != nil || !rotated {
+				t.Fatalf("expected rotation, got %v, %v", rotated, err)
+			}
+
+			// The old refresh token is spent
+			if _, err := repo.FindByRefreshTokenHash(ctx, oldHash); err == nil {
+				t.Fatal("expected the old refresh token to be gone")
+			}
+			if rotated, err := repo.Rotate(ctx, session, oldHash); err != nil || rotated {
+				t.Fatalf("expected a second rotation with the old token to fail, got %v, %v", rotated, err)
+			}
+
+			found, err := repo.FindByRefreshTokenHash(ctx, session.RefreshTokenHash)
+			if err != nil {
+				t.Fatalf("FindByRefreshTokenHash: %v", err)
+			}
+			if found.ID != session.ID || found.LastUsedAt == nil {
+				t.Fatalf("expected the rotated session, got %+v", found)
+			}
+		})
+	}
+}
+
+func TestSessionRepositoryDeleteAllByUser(t *testing.T) {
+	for name, repo := range sessionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			userID, otherID := uuid.New(), uuid.New()
+
+			for _, id := range []uuid.UUID{userID, userID, otherID} {
+				if _, err := repo.Create(ctx, newSession(id, time.Now()), 0); err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+			}
+
+			deleted, err := repo.DeleteAllByUser(ctx, userID)
+			if err != nil {
+				t.Fatalf("DeleteAllByUser: %v", err)
+			}
+			if len(deleted) != 2 {
+				t.Fatalf("expected 2 sessions deleted, got %v", deleted)
+			}
+			if listed, _ := repo.ListByUser(ctx, userID); len(listed) != 0 {
+				t.Fatalf("expected no sessions left, got %+v", listed)
+			}
+			if listed, _ := repo.ListByUser(ctx, otherID); len(listed) != 1 {
+				t.Fatalf("expected other user's session to stay, got %+v", listed)
+			}
+			if deleted, _ := repo.DeleteAllByUser(ctx, userID); len(deleted) != 0 {
+				t.Fatalf("expected nothing left to delete, got %v", deleted)
+			}
+		})
+	}
+}
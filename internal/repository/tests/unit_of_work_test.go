@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// unitOfWorkRepositories are the in-memory repositories an in-memory unit of work runs against
+type unitOfWorkRepositories struct {
+	users  *repository.InMemoryUserRepository
+	audit  *repository.InMemoryAuditRepository
+	events *repository.InMemoryEventRepository
+	logins *repository.InMemoryLoginHistoryRepository
+}
+
+func newUnitOfWork() (*repository.InMemoryUnitOfWork, *unitOfWorkRepositories) {
+	repos := &unitOfWorkRepositories{
+		users:  repository.NewInMemoryUserRepository(),
+		audit:  repository.NewInMemoryAuditRepository(),
+		events: repository.NewInMemoryEventRepository(),
+		logins: repository.NewInMemoryLoginHistoryRepository(),
+	}
+	return repository.NewInMemoryUnitOfWork(repos.users, repos.audit, repos.events, repos.logins), repos
+}
+
+// write makes changes in each repository of a unit of work, creating a user and deleting existing
+func write(ctx context.Context, repos repository.Repositories, existing uuid.UUID) error {
+	if _, err := repos.Users.Create(ctx, "+15550002"); err != nil {
+		return err
+	}
+	if err := repos.Users.Delete(ctx, existing); err != nil {
+		return err
+	}
+	if err := repos.Audit.Create(ctx, &models.AuditLog{Action: "user.create", TargetType: "user", TargetID: existing.String()}); err != nil {
+		return err
+	}
+	if err := repos.Events.Append(ctx, &models.DomainEvent{Type: "test.event", AggregateType: "test", AggregateID: "1"}); err != nil {
+		return err
+	}
+	return repos.Logins.Record(ctx, &models.LoginAttempt{ID: uuid.New(), UserID: &existing, PhoneNumber: "+15550001", Success: true, CreatedAt: time.Now()})
+}
+
+func TestInMemoryUnitOfWorkRollsBack(t *testing.T) {
+	ctx := context.Background()
+	unitOfWork, repos := newUnitOfWork()
+	existing, err := repos.users.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	failure := errors.New("step failed")
+	err = unitOfWork.WithTx(ctx, func(tx repository.Repositories) error {
+		if err := write(ctx, tx, existing.ID); err != nil {
+			return err
+		}
+		// Changes are visible within the unit of work
+		if _, err := tx.Users.FindByPhoneNumber(ctx, "+15550002"); err != nil {
+			t.Errorf("expected the created user within the unit of work: %v", err)
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+
+	// None of the writes made before fn failed are left behind
+	if _, err := repos.users.FindByPhoneNumber(ctx, "+15550002"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("expected no created user, got %v", err)
+	}
+	if user, err := repos.users.FindByID(ctx, existing.ID); err != nil || user.DeletedAt != nil {
+		t.Fatalf("expected the existing user not to be deleted, got %+v (%v)", user, err)
+	}
+	if events, _ := repos.events.ListAfter(ctx, 0, 10); len(events) != 0 {
+		t.Fatalf("expected no events, got %+v", events)
+	}
+	if attempts, total, _ := repos.logins.ListByUser(ctx, existing.ID, models.PaginationParams{Page: 1, PageSize: 10}); total != 0 {
+		t.Fatalf("expected no login attempts, got %+v", attempts)
+	}
+	if entries, total, _ := repos.audit.ListByTarget(ctx, "user", existing.ID.String(), 10); total != 0 {
+		t.Fatalf("expected no audit entries, got %+v", entries)
+	}
+}
+
+func TestInMemoryUnitOfWorkCommits(t *testing.T) {
+	ctx := context.Background()
+	unitOfWork, repos := newUnitOfWork()
+	existing, err := repos.users.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	other, err := repos.users.Create(ctx, "+15550003")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var created uuid.UUID
+	err = unitOfWork.WithTx(ctx, func(tx repository.Repositories) error {
+		if err := write(ctx, tx, existing.ID); err != nil {
+			return err
+		}
+		user, err := tx.Users.FindByPhoneNumber(ctx, "+15550002")
+		if err != nil {
+			return err
+		}
+		created = user.ID
+
+		// Users changed outside the unit of work meanwhile keep their changes
+		return repos.users.SetRole(ctx, other.ID, models.RoleOperator)
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	if _, err := repos.users.FindByID(ctx, created); err != nil {
+		t.Fatalf("expected the created user, got %v", err)
+	}
+	if _, err := repos.users.FindDeletedByID(ctx, existing.ID); err != nil {
+		t.Fatalf("expected the existing user to be deleted, got %v", err)
+	}
+	if user, err := repos.users.FindByID(ctx, other.ID); err != nil || user.Role != models.RoleOperator {
+		t.Fatalf("expected the role granted meanwhile to be kept, got %+v (%v)", user, err)
+	}
+
+	// The user's creation and deletion are recorded before the appended event, numbered in order
+	events, _ := repos.events.ListAfter(ctx, 0, 10)
+	if len(events) != 3 || events[2].Type != "test.event" || events[2].Sequence != 3 {
+		t.Fatalf("expected the recorded events, got %+v", events)
+	}
+	if _, total, _ := repos.logins.ListByUser(ctx, existing.ID, models.PaginationParams{Page: 1, PageSize: 10}); total != 1 {
+		t.Fatalf("expected the login attempt, got %d", total)
+	}
+	if _, total, _ := repos.audit.ListByTarget(ctx, "user", existing.ID.String(), 10); total != 1 {
+		t.Fatalf("expected the audit entry, got %d", total)
+	}
+}
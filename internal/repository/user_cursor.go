@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// ErrInvalidCursor is returned when listing users after a cursor UserCursor did not return
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// userPosition is where a user is in the user list, newest first: by creation time, with
+// users created at the same time ordered by ID
+type userPosition struct {
+	createdAt time.Time
+	id        uuid.UUID
+}
+
+// precedes reports whether p comes before a user created at createdAt with id in the user list
+func (p userPosition) precedes(createdAt time.Time, id uuid.UUID) bool {
+	if !createdAt.Equal(p.createdAt) {
+		return createdAt.Before(p.createdAt)
+	}
+	return strings.Compare(id.String(), p.id.String()) < 0
+}
+
+// UserCursor returns the opaque cursor listing users continues after user with
+func UserCursor(user *models.User) string {
+	position := user.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + user.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+// parseUserCursor returns the position of the user a cursor was returned for
+func parseUserCursor(cursor string) (userPosition, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return userPosition{}, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return userPosition{}, ErrInvalidCursor
+	}
+	var position userPosition
+	if position.createdAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return userPosition{}, ErrInvalidCursor
+	}
+	if position.id, err = uuid.Parse(id); err != nil {
+		return userPosition{}, ErrInvalidCursor
+	}
+	return position, nil
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/requestid"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"0f8fad5b-d9cb-469f-a165-70867728950e", true},
+		{"gateway.eu-1:42_abc", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"", false},
+		{"abc */ DROP TABLE users; /*", false},
+		{"abc\r\nX-Injected: 1", false},
+		{"ünïcode", false},
+	}
+	for _, tt := range tests {
+		if got := requestid.Valid(tt.id); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+
+	if id := requestid.New(); !requestid.Valid(id) {
+		t.Fatalf("expected generated request ID %q to be valid", id)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if id := requestid.FromContext(ctx); id != "" {
+		t.Fatalf("expected no request ID, got %q", id)
+	}
+	if id := requestid.FromContext(requestid.NewContext(ctx, "req-1")); id != "req-1" {
+		t.Fatalf("expected req-1, got %q", id)
+	}
+}
@@ -0,0 +1,284 @@
+// Package scenario runs declarative scenarios of API calls against a live instance, checking
+// behavior that spans several requests and features, such as lockouts and cooldowns. Scenarios
+// are YAML files listing steps: a request with the response it must get, optionally repeated,
+// or a wait.
+//
+//	name: lockout after repeated wrong codes
+//	steps:
+//	  - request: {method: POST, path: /v1/auth/request-otp, body: {phone_number: "${phone}"}}
+//	    expect: {status: 200}
+//	    save: {challenge: challenge_id}
+//	  - request: {method: POST, path: /v1/auth/verify-otp, body: {challenge_id: "${challenge}", otp: "000000"}}
+//	    repeat: 4
+//	    expect: {status: 401}
+//
+// "${name}" in paths, headers and body strings is replaced by a variable: values saved from
+// earlier responses, or phone, a random mobile number for the run, so runs don't share state.
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Scenario is a named sequence of steps
+type Scenario struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+}
+
+// Step is a request with the response it must get, or a wait
+type Step struct {
+	Name    string            `yaml:"name"`
+	Request *Request          `yaml:"request"`
+	Repeat  int               `yaml:"repeat"` // times the request is made, each expecting the response; 1 if 0
+	Expect  Expect            `yaml:"expect"`
+	Save    map[string]string `yaml:"save"` // variable -> top-level field of the response to store in it
+	Wait    time.Duration     `yaml:"wait"` // e.g. "2s", waited before the request, if any
+}
+
+// Request is an API call
+type Request struct {
+	Method  string                 `yaml:"method"`
+	Path    string                 `yaml:"path"`
+	Headers map[string]string      `yaml:"headers"`
+	Body    map[string]interface{} `yaml:"body"` // sent as JSON
+}
+
+// Expect is the response a request must get
+type Expect struct {
+	Status int                    `yaml:"status"`
+	Body   map[string]interface{} `yaml:"body"` // top-level fields the response must have, e.g. error_code
+}
+
+// Load reads the scenario in a YAML file
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading scenario: %w", err)
+	}
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error parsing scenario %s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	for i, step := range s.Steps {
+		if step.Request == nil && step.Wait <= 0 {
+			return nil, fmt.Errorf("scenario %s: step %d has neither a request nor a wait", path, i+1)
+		}
+	}
+	return &s, nil
+}
+
+// LoadDir reads the scenarios in the .yaml and .yml files of dir, in file name order
+func LoadDir(dir string) ([]*Scenario, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading scenarios: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	scenarios := make([]*Scenario, 0, len(names))
+	for _, name := range names {
+		s, err := Load(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, nil
+}
+
+// Failure is a step that didn't get the expected response
+type Failure struct {
+	Step    int // 1-based
+	Name    string
+	Message string
+}
+
+func (f *Failure) Error() string {
+	if f.Name != "" {
+		return fmt.Sprintf("step %d (%s): %s", f.Step, f.Name, f.Message)
+	}
+	return fmt.Sprintf("step %d: %s", f.Step, f.Message)
+}
+
+// Runner runs scenarios against the instance at a base URL
+type Runner struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewRunner creates a runner sending its requests to baseURL, e.g. "http://localhost:8080"
+func NewRunner(baseURL string, httpClient *http.Client) *Runner {
+	return &Runner{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// Run runs the steps of s in order, stopping at the first that fails with a *Failure
+func (r *Runner) Run(ctx context.Context, s *Scenario) error {
+	vars := map[string]string{"phone": randomPhoneNumber()}
+	for i, step := range s.Steps {
+		if step.Wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.Wait):
+			}
+		}
+		if step.Request == nil {
+			continue
+		}
+
+		repeat := max(step.Repeat, 1)
+		for n := 1; n <= repeat; n++ {
+			message, err := r.runRequest(ctx, &step, vars)
+			if err != nil {
+				return err
+			}
+			if message != "" {
+				if repeat > 1 {
+					message = fmt.Sprintf("request %d of %d: %s", n, repeat, message)
+				}
+				return &Failure{Step: i + 1, Name: step.Name, Message: message}
+			}
+		}
+	}
+	return nil
+}
+
+// runRequest makes the request of step and checks its response, storing the fields step saves
+// in vars. It returns why the response isn't the expected one, or "" if it is.
+func (r *Runner) runRequest(ctx context.Context, step *Step, vars map[string]string) (string, error) {
+	var body io.Reader
+	if step.Request.Body != nil {
+		data, err := json.Marshal(substitute(step.Request.Body, vars))
+		if err != nil {
+			return "", fmt.Errorf("error encoding request body: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	method := step.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+expand(step.Request.Path, vars), body)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range step.Request.Headers {
+		req.Header.Set(name, expand(value, vars))
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Sprintf("request failed: %v", err), nil
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Sprintf("error reading response: %v", err), nil
+	}
+
+	if step.Expect.Status != 0 && resp.StatusCode != step.Expect.Status {
+		return fmt.Sprintf("got status %d, want %d: %s", resp.StatusCode, step.Expect.Status, data), nil
+	}
+	if len(step.Expect.Body) == 0 && len(step.Save) == 0 {
+		return "", nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Sprintf("response is not a JSON object: %s", data), nil
+	}
+	for name, want := range substitute(step.Expect.Body, vars).(map[string]interface{}) {
+		if got, ok := fields[name]; !ok || !equal(got, want) {
+			return fmt.Sprintf("got %s %v, want %v", name, got, want), nil
+		}
+	}
+	for variable, field := range step.Save {
+		value, ok := fields[field]
+		if !ok {
+			return fmt.Sprintf("response has no %s to save", field), nil
+		}
+		vars[variable] = fmt.Sprint(value)
+	}
+	return "", nil
+}
+
+// variablePattern matches the variable references in scenario strings
+var variablePattern = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// expand replaces the variable references in s with their values, leaving unknown ones as they are
+func expand(s string, vars map[string]string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if value, ok := vars[ref[2:len(ref)-1]]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// substitute returns value with the variable references in its strings expanded
+func substitute(value interface{}, vars map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expand(v, vars)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = substitute(item, vars)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = substitute(item, vars)
+		}
+		return out
+	}
+	return value
+}
+
+// equal reports whether a decoded JSON value equals a value from a scenario. Numbers are
+// compared by value, as JSON decodes them as float64 and YAML as int.
+func equal(got, want interface{}) bool {
+	if gotNumber, ok := got.(float64); ok {
+		switch w := want.(type) {
+		case int:
+			return gotNumber == float64(w)
+		case float64:
+			return gotNumber == w
+		}
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+// randomPhoneNumber returns a random Iranian mobile number
+func randomPhoneNumber() string {
+	return fmt.Sprintf("0912%07d", rand.IntN(10_000_000))
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/scenario"
+)
+
+// lockoutServer fakes the OTP endpoints, locking a challenge after three wrong codes
+func lockoutServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	failures := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/auth/request-otp", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			PhoneNumber string `json:"phone_number"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if !strings.HasPrefix(body.PhoneNumber, "0912") {
+			http.Error(w, "bad phone number", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"challenge_id": "challenge-1"})
+	})
+	mux.HandleFunc("POST /v1/auth/verify-otp", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ChallengeID string `json:"challenge_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.ChallengeID != "challenge-1" {
+			http.Error(w, "unknown challenge", http.StatusBadRequest)
+			return
+		}
+		failures++
+		if failures >= 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error_code": "OTP_LOCKED", "status": 429})
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error_code": "INVALID_OTP", "status": 401})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeScenario writes a scenario file to a temporary directory and loads it
+func writeScenario(t *testing.T, content string) *scenario.Scenario {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lockout.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	s, err := scenario.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return s
+}
+
+const lockoutScenario = `
+steps:
+  - request: {method: POST, path: /v1/auth/request-otp, body: {phone_number: "${phone}"}}
+    expect: {status: 200}
+    save: {challenge: challenge_id}
+  - name: wrong codes
+    request: {method: POST, path: /v1/auth/verify-otp, body: {challenge_id: "${challenge}", otp: "000000"}}
+    repeat: %d
+    expect: {status: 401, body: {error_code: INVALID_OTP}}
+  - name: locked
+    request: {method: POST, path: /v1/auth/verify-otp, body: {challenge_id: "${challenge}", otp: "000000"}}
+    expect: {status: 429, body: {error_code: OTP_LOCKED, status: 429}}
+`
+
+func TestRunScenario(t *testing.T) {
+	server := lockoutServer(t)
+	s := writeScenario(t, strings.Replace(lockoutScenario, "%d", "2", 1))
+	if s.Name != "lockout" {
+		t.Fatalf("expected the scenario to be named after its file, got %q", s.Name)
+	}
+
+	if err := scenario.NewRunner(server.URL+"/", server.Client()).Run(context.Background(), s); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestRunScenarioReportsFailedStep(t *testing.T) {
+	server := lockoutServer(t)
+	s := writeScenario(t, strings.Replace(lockoutScenario, "%d", "3", 1))
+
+	err := scenario.NewRunner(server.URL, server.Client()).Run(context.Background(), s)
+	var failure *scenario.Failure
+	if !errors.As(err, &failure) || failure.Step != 2 || failure.Name != "wrong codes" ||
+		!strings.Contains(failure.Message, "request 3 of 3: got status 429, want 401") {
+		t.Fatalf("expected the third wrong code to fail step 2, got %v", err)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	scenarios, err := scenario.LoadDir("../../../scenarios")
+	if err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("expected the bundled scenarios to load")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "empty.yaml"), []byte("steps: [{name: nothing}]"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := scenario.LoadDir(dir); err == nil {
+		t.Fatal("expected a step without a request or wait to be rejected")
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// AbuseReportService handles reports of unsolicited OTP SMS and their review.
+// A reported phone number is on the suppression list until an admin dismisses the report.
+type AbuseReportService struct {
+	abuseReportRepo repository.AbuseReportRepository
+	suppressions    *SuppressionService
+	auditService    *AuditService
+	events          *EventService
+}
+
+// NewAbuseReportService creates a new abuse report service
+func NewAbuseReportService(
+	abuseReportRepo repository.AbuseReportRepository,
+	suppressions *SuppressionService,
+	auditService *AuditService,
+	events *EventService,
+) *AbuseReportService {
+	return &AbuseReportService{
+		abuseReportRepo: abuseReportRepo,
+		suppressions:    suppressions,
+		auditService:    auditService,
+		events:          events,
+	}
+}
+
+// Report records an abuse report for a phone number, suppressing OTPs to it pending review
+func (s *AbuseReportService) Report(ctx context.Context, req models.AbuseReportRequest, ipAddress string) (*models.AbuseReport, error) {
+	if !utils.IsValidPhoneNumber(req.PhoneNumber) {
+		return nil, fmt.Errorf("invalid phone number")
+	}
+
+	report := &models.AbuseReport{
+		ID:           uuid.New(),
+		PhoneNumber:  utils.NormalizePhoneNumber(req.PhoneNumber),
+		ReporterType: req.ReporterType,
+		IPAddress:    ipAddress,
+		Status:       models.AbuseReportPending,
+		CreatedAt:    time.Now(),
+	}
+	if req.Details != "" {
+		report.Details = &req.Details
+	}
+
+	if err := s.abuseReportRepo.Create(ctx, report); err != nil {
+		return nil, err
+	}
+	if _, err := s.suppressions.Suppress(ctx, report.PhoneNumber, models.SuppressionAbuseReport, models.SuppressionSourceAbuseReport); err != nil {
+		return nil, err
+	}
+
+	err := s.events.Publish(ctx, models.EventAbuseReported, models.AggregatePhone, report.PhoneNumber, map[string]interface{}{
+		"report_id":     report.ID,
+		"reporter_type": report.ReporterType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ListReports returns a page of abuse reports, oldest first
+func (s *AbuseReportService) ListReports(ctx context.Context, params models.AbuseReportListParams) ([]models.AbuseReport, int64, error) {
+	reports, totalCount, err := s.abuseReportRepo.List(ctx, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing abuse reports: %w", err)
+	}
+	return reports, totalCount, nil
+}
+
+// ReviewReport confirms or dismisses a report together with the other pending reports of its
+// phone number. Dismissing lifts the suppression unless an earlier report was confirmed.
+func (s *AbuseReportService) ReviewReport(ctx context.Context, actor models.AuditActor, id uuid.UUID, status string) (int64, error) {
+	if status != models.AbuseReportConfirmed && status != models.AbuseReportDismissed {
+		return 0, fmt.Errorf("invalid status")
+	}
+
+	var reviewerID *uuid.UUID
+	if actor.ID != uuid.Nil {
+		reviewerID = &actor.ID
+	}
+	reviewed, err := s.abuseReportRepo.Review(ctx, id, status, reviewerID)
+	if err != nil {
+		return 0, err
+	}
+	if status == models.AbuseReportDismissed {
+		if err := s.liftSuppression(ctx, id); err != nil {
+			return reviewed, err
+		}
+	}
+
+	err = s.auditService.Record(ctx, actor, AuditActionAbuseReview, AuditTargetAbuseReport, id.String(), map[string]interface{}{
+		"status":   status,
+		"reviewed": reviewed,
+	})
+	if err != nil {
+		return reviewed, err
+	}
+
+	return reviewed, nil
+}
+
+// liftSuppression takes the phone number of a dismissed report off the suppression list,
+// unless it has a confirmed report. Suppressions for other reasons are kept.
+func (s *AbuseReportService) liftSuppression(ctx context.Context, id uuid.UUID) error {
+	report, err := s.abuseReportRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	reported, err := s.abuseReportRepo.HasActiveReports(ctx, report.PhoneNumber)
+	if err != nil || reported {
+		return err
+	}
+	_, err = s.suppressions.Unsuppress(ctx, report.PhoneNumber, models.SuppressionAbuseReport)
+	return err
+}
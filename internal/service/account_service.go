@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// maxExportEntries caps how many entries of each kind, e.g. logins or events, an export holds
+const maxExportEntries = 10000
+
+// AccountService lets users delete their accounts and export their personal data, and erases
+// deleted accounts once they can no longer be restored
+type AccountService struct {
+	userRepo       repository.UserRepository
+	auditRepo      repository.AuditRepository
+	eventRepo      repository.EventRepository
+	logins         repository.LoginHistoryRepository
+	sessions       *SessionService
+	trustedDevices *TrustedDeviceService
+	config         *config.Config
+	logger         *slog.Logger
+}
+
+// NewAccountService creates a new account service
+func NewAccountService(
+	userRepo repository.UserRepository,
+	auditRepo repository.AuditRepository,
+	eventRepo repository.EventRepository,
+	logins repository.LoginHistoryRepository,
+	sessions *SessionService,
+	trustedDevices *TrustedDeviceService,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *AccountService {
+	return &AccountService{
+		userRepo:       userRepo,
+		auditRepo:      auditRepo,
+		eventRepo:      eventRepo,
+		logins:         logins,
+		sessions:       sessions,
+		trustedDevices: trustedDevices,
+		config:         cfg,
+		logger:         logger,
+	}
+}
+
+// DeleteAccount soft-deletes a user, signs them out everywhere and revokes their trusted devices.
+// The user can be restored by an admin until the restore window has passed, after which the
+// purge job erases them.
+func (s *AccountService) DeleteAccount(ctx context.Context, userID uuid.UUID) error {
+	if _, err := s.userRepo.FindByID(ctx, userID); err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if err := s.userRepo.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	if _, err := s.sessions.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+	devices, err := s.trustedDevices.ListDevices(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		if err := s.trustedDevices.RevokeDevice(ctx, userID, device.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Export returns all the personal data stored about a user
+func (s *AccountService) Export(ctx context.Context, userID uuid.UUID) (*models.AccountExport, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+	export := &models.AccountExport{ExportedAt: time.Now().UTC(), User: *user}
+
+	export.Logins, _, err = s.logins.ListByUser(ctx, user.ID, models.PaginationParams{Page: 1, PageSize: maxExportEntries})
+	if err != nil {
+		return nil, fmt.Errorf("error listing login history: %w", err)
+	}
+	export.Sessions, err = s.sessions.ListSessions(ctx, user.ID, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+	export.TrustedDevices, err = s.trustedDevices.ListDevices(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, aggregate := range []struct{ aggregateType, aggregateID string }{
+		{models.AggregateUser, user.ID.String()},
+		{models.AggregatePhone, user.PhoneNumber},
+	} {
+		events, _, err := s.eventRepo.ListByAggregate(ctx, aggregate.aggregateType, aggregate.aggregateID, maxExportEntries)
+		if err != nil {
+			return nil, fmt.Errorf("error listing domain events: %w", err)
+		}
+		export.Events = append(export.Events, events...)
+	}
+	sort.SliceStable(export.Events, func(i, j int) bool {
+		return export.Events[i].OccurredAt.After(export.Events[j].OccurredAt)
+	})
+
+	for _, target := range []struct{ targetType, targetID string }{
+		{AuditTargetUser, user.ID.String()},
+		{AuditTargetPhone, user.PhoneNumber},
+	} {
+		auditLogs, _, err := s.auditRepo.ListByTarget(ctx, target.targetType, target.targetID, maxExportEntries)
+		if err != nil {
+			return nil, fmt.Errorf("error listing audit logs: %w", err)
+		}
+		export.AuditLogs = append(export.AuditLogs, auditLogs...)
+	}
+	sort.SliceStable(export.AuditLogs, func(i, j int) bool {
+		return export.AuditLogs[i].CreatedAt.After(export.AuditLogs[j].CreatedAt)
+	})
+
+	return export, nil
+}
+
+// Run erases deleted accounts past the restore window every interval until ctx is done
+func (s *AccountService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Purge(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("Error purging deleted users", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge permanently deletes the users deleted longer ago than the restore window and returns
+// how many were erased
+func (s *AccountService) Purge(ctx context.Context) (int, error) {
+	ids, err := s.userRepo.Purge(ctx, time.Now().Add(-s.config.GetRestoreWindow()))
+	if err != nil {
+		return 0, fmt.Errorf("error purging deleted users: %w", err)
+	}
+	if len(ids) > 0 {
+		s.logger.Info("Purged deleted users", "count", len(ids))
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+const (
+	// activeUsersBatchSize is how many domain events are read from the log at a time
+	activeUsersBatchSize = 500
+
+	weeklyActiveDays  = 7
+	monthlyActiveDays = 30
+)
+
+// ActiveUserService maintains daily, weekly and monthly active user counts by feeding
+// sign-in events from the domain event log to the active user read model
+type ActiveUserService struct {
+	activeUserRepo repository.ActiveUserRepository
+	events         *EventService
+	logger         *slog.Logger
+}
+
+// NewActiveUserService creates a new active user service
+func NewActiveUserService(activeUserRepo repository.ActiveUserRepository, events *EventService, logger *slog.Logger) *ActiveUserService {
+	return &ActiveUserService{
+		activeUserRepo: activeUserRepo,
+		events:         events,
+		logger:         logger,
+	}
+}
+
+// Run feeds new domain events to the read model every interval until ctx is cancelled
+func (s *ActiveUserService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sync(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("Error updating active users", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync feeds the domain events recorded since the last sync to the read model.
+// Recording activity is idempotent, so events fed twice by concurrent instances are harmless.
+func (s *ActiveUserService) Sync(ctx context.Context) error {
+	lastSequence, err := s.activeUserRepo.LastSequence(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Days that dropped out of the monthly count no longer matter
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -(monthlyActiveDays - 1))
+	synced, err := s.events.Replay(ctx, lastSequence, activeUsersBatchSize, func(event models.DomainEvent) error {
+		if event.Type != models.EventOTPVerified || event.OccurredAt.Before(since) {
+			return nil
+		}
+		var payload struct {
+			UserID uuid.UUID `json:"user_id"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("error decoding sign-in: %w", err)
+		}
+		return s.activeUserRepo.RecordActivity(ctx, payload.UserID, event.OccurredAt)
+	})
+	if synced > lastSequence {
+		// Keep the progress made before a failure
+		if setErr := s.activeUserRepo.SetLastSequence(ctx, synced); setErr != nil && err == nil {
+			err = setErr
+		}
+	}
+	return err
+}
+
+// GetActiveUserStats estimates how many distinct users signed in today and during the last 7 and 30 days
+func (s *ActiveUserService) GetActiveUserStats(ctx context.Context) (*models.ActiveUserStats, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	stats := &models.ActiveUserStats{}
+	for _, window := range []struct {
+		days  int
+		count *int64
+	}{
+		{1, &stats.Daily},
+		{weeklyActiveDays, &stats.Weekly},
+		{monthlyActiveDays, &stats.Monthly},
+	} {
+		count, err := s.activeUserRepo.CountActive(ctx, today.AddDate(0, 0, -(window.days-1)), today)
+		if err != nil {
+			return nil, err
+		}
+		*window.count = count
+	}
+	return stats, nil
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
+
+// phonePrefixPattern restricts OTP expiry prefixes to digits with an optional leading plus
+var phonePrefixPattern = regexp.MustCompile(`^\+?[0-9]+$`)
+
+// AdminService handles administrative and runbook operations
+type AdminService struct {
+	userRepo            repository.UserRepository
+	unitOfWork          repository.UnitOfWork
+	otpRepo             repository.OTPRepository
+	otpRateLimit        *ratelimit.Policy // enforced by AuthService per phone number
+	requestOTPRateLimit *ratelimit.Policy // enforced by middleware on the request-otp route
+	sender              *sms.Sender
+	deliveries          *DeliveryService
+	sessions            *SessionService
+	auditService        *AuditService
+	config              *config.Config
+}
+
+// NewAdminService creates a new admin service
+func NewAdminService(
+	userRepo repository.UserRepository,
+	unitOfWork repository.UnitOfWork,
+	otpRepo repository.OTPRepository,
+	otpRateLimit *ratelimit.Policy,
+	requestOTPRateLimit *ratelimit.Policy,
+	sender *sms.Sender,
+	deliveries *DeliveryService,
+	sessions *SessionService,
+	auditService *AuditService,
+	config *config.Config,
+) *AdminService {
+	return &AdminService{
+		userRepo:            userRepo,
+		unitOfWork:          unitOfWork,
+		otpRepo:             otpRepo,
+		otpRateLimit:        otpRateLimit,
+		requestOTPRateLimit: requestOTPRateLimit,
+		sender:              sender,
+		deliveries:          deliveries,
+		sessions:            sessions,
+		auditService:        auditService,
+		config:              config,
+	}
+}
+
+// RestoreUser un-deletes a soft-deleted user if it is still within the restore window
+func (s *AdminService) RestoreUser(ctx context.Context, actor models.AuditActor, id uuid.UUID) (*models.User, error) {
+	deleted, err := s.userRepo.FindDeletedByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("deleted user not found")
+		}
+		return nil, fmt.Errorf("error finding deleted user: %w", err)
+	}
+
+	// Users deleted before the window started are past recovery
+	windowStart := time.Now().Add(-s.config.GetRestoreWindow())
+	if deleted.DeletedAt.Before(windowStart) {
+		if err := s.auditService.Record(ctx, actor, AuditActionUserRestoreDenied, AuditTargetUser, id.String(), map[string]interface{}{
+			"reason":     "restore window expired",
+			"deleted_at": deleted.DeletedAt,
+		}); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("restore window expired")
+	}
+
+	// The user is restored and the restore audited in one unit of work, so no user is
+	// restored without an audit entry
+	var user *models.User
+	err = s.unitOfWork.WithTx(ctx, func(repos repository.Repositories) error {
+		var err error
+		user, err = repos.Users.Restore(ctx, id, windowStart)
+		if err != nil {
+			return fmt.Errorf("error restoring user: %w", err)
+		}
+
+		return NewAuditService(repos.Audit).Record(ctx, actor, AuditActionUserRestore, AuditTargetUser, id.String(), map[string]interface{}{
+			"phone_number": user.PhoneNumber,
+			"deleted_at":   deleted.DeletedAt,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// FlushRateLimits clears every rate limit counter and the verification lockout kept for a phone number
+func (s *AdminService) FlushRateLimits(ctx context.Context, actor models.AuditActor, phoneNumber string) error {
+	if err := s.otpRateLimit.Reset(ctx, ratelimit.PhoneKey(phoneNumber)); err != nil {
+		return fmt.Errorf("error flushing rate limits: %w", err)
+	}
+	if err := s.requestOTPRateLimit.Reset(ctx, ratelimit.OTPPhoneKey(phoneNumber)); err != nil {
+		return fmt.Errorf("error flushing rate limits: %w", err)
+	}
+	if err := s.otpRepo.ClearFailedVerifications(ctx, phoneNumber); err != nil {
+		return fmt.Errorf("error flushing rate limits: %w", err)
+	}
+
+	return s.auditService.Record(ctx, actor, AuditActionRateLimitFlush, AuditTargetPhone, phoneNumber, nil)
+}
+
+// RevokeSessions revokes all of a user's sessions, e.g. so a user denied signing in from
+// another country by sessions.countryConflicts can sign in again, and returns how many were revoked
+func (s *AdminService) RevokeSessions(ctx context.Context, actor models.AuditActor, id uuid.UUID) (int, error) {
+	if _, err := s.userRepo.FindByID(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("user not found")
+		}
+		return 0, fmt.Errorf("error finding user: %w", err)
+	}
+
+	revoked, err := s.sessions.RevokeAllSessions(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.auditService.Record(ctx, actor, AuditActionSessionsRevoke, AuditTargetUser, id.String(), map[string]interface{}{
+		"revoked": revoked,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// UpdateUserMetadata sets the metadata keys of a user given with a value and removes those
+// given with nil, leaving the others unchanged
+func (s *AdminService) UpdateUserMetadata(ctx context.Context, actor models.AuditActor, id uuid.UUID, update map[string]*string) (*models.User, error) {
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+	if err := validateMetadataUpdate(user.Metadata, update); err != nil {
+		return nil, err
+	}
+
+	user, err = s.userRepo.UpdateMetadata(ctx, id, update)
+	if err != nil {
+		return nil, fmt.Errorf("error updating user metadata: %w", err)
+	}
+
+	// Values may be personal data, so only which keys changed is recorded
+	var set, removed []string
+	for key, value := range update {
+		if value == nil {
+			removed = append(removed, key)
+		} else {
+			set = append(set, key)
+		}
+	}
+	sort.Strings(set)
+	sort.Strings(removed)
+	err = s.auditService.Record(ctx, actor, AuditActionUserMetadataUpdate, AuditTargetUser, id.String(), map[string]interface{}{
+		"set":     set,
+		"removed": removed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ResendOTP re-delivers the latest pending OTP for a phone number without generating a new one
+func (s *AdminService) ResendOTP(ctx context.Context, actor models.AuditActor, phoneNumber string) error {
+	challenge, err := s.otpRepo.GetLatestChallenge(ctx, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("no pending OTP")
+	}
+
+	if err := s.deliveries.SendOTP(ctx, challenge); err != nil {
+		return err
+	}
+
+	return s.auditService.Record(ctx, actor, AuditActionOTPResend, AuditTargetPhone, phoneNumber, nil)
+}
+
+// ExpireOTPs deletes all pending OTPs for phone numbers starting with prefix
+func (s *AdminService) ExpireOTPs(ctx context.Context, actor models.AuditActor, prefix string) (int64, error) {
+	if !phonePrefixPattern.MatchString(prefix) {
+		return 0, fmt.Errorf("invalid phone prefix")
+	}
+
+	expired, err := s.otpRepo.DeleteChallengesByPrefix(ctx, prefix)
+	if err != nil {
+		return expired, fmt.Errorf("error expiring OTPs: %w", err)
+	}
+
+	err = s.auditService.Record(ctx, actor, AuditActionOTPExpire, AuditTargetPhonePrefix, prefix, map[string]interface{}{
+		"expired": expired,
+	})
+	if err != nil {
+		return expired, err
+	}
+
+	return expired, nil
+}
+
+// ListProviders returns all SMS providers with their rotation state
+func (s *AdminService) ListProviders(ctx context.Context) ([]models.ProviderStatus, error) {
+	return s.sender.Providers(ctx)
+}
+
+// SetProviderEnabled puts an SMS provider back into or takes it out of rotation
+func (s *AdminService) SetProviderEnabled(ctx context.Context, actor models.AuditActor, name string, enabled bool) error {
+	if err := s.sender.SetProviderEnabled(ctx, name, enabled); err != nil {
+		return err
+	}
+
+	return s.auditService.Record(ctx, actor, AuditActionProviderToggle, AuditTargetProvider, name, map[string]interface{}{
+		"enabled": enabled,
+	})
+}
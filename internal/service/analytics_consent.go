@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// What analytics webhook endpoints get of events about users without analytics consent
+const (
+	AnalyticsAnonymize = "anonymize" // the event without the fields identifying the user
+	AnalyticsDrop      = "drop"      // nothing
+)
+
+// identifyingFields are the fields of event data left out of anonymized events
+var identifyingFields = map[string]bool{
+	"id":           true,
+	"user_id":      true,
+	"phone_number": true,
+	"first_name":   true,
+	"last_name":    true,
+	"email":        true,
+	"avatar_url":   true,
+	"metadata":     true,
+	"challenge_id": true,
+	"device_id":    true,
+	"device_name":  true,
+	"session_ids":  true,
+	"report_id":    true,
+	"ip_address":   true,
+	"user_agent":   true,
+}
+
+// AnalyticsConsent looks up whether the users domain events are about consent to analytics,
+// and anonymizes events for those who don't
+type AnalyticsConsent struct {
+	userRepo repository.UserRepository
+}
+
+// NewAnalyticsConsent creates a new analytics consent lookup
+func NewAnalyticsConsent(userRepo repository.UserRepository) *AnalyticsConsent {
+	return &AnalyticsConsent{userRepo: userRepo}
+}
+
+// Consented reports whether the user an event is about consents to analytics. Events about a
+// phone number without a user, e.g. OTP requests before signing up, count as consented, as
+// users consent until they withdraw it.
+func (a *AnalyticsConsent) Consented(ctx context.Context, event models.DomainEvent) (bool, error) {
+	var user *models.User
+	var err error
+	switch event.AggregateType {
+	case models.AggregateUser:
+		id, parseErr := uuid.Parse(event.AggregateID)
+		if parseErr != nil {
+			// No user has such an ID
+			return true, nil
+		}
+		user, err = a.userRepo.FindByID(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			user, err = a.userRepo.FindDeletedByID(ctx, id)
+		}
+	case models.AggregatePhone:
+		user, err = a.userRepo.FindByPhoneNumber(ctx, event.AggregateID)
+		if errors.Is(err, sql.ErrNoRows) {
+			user, err = a.userRepo.FindDeletedByPhoneNumber(ctx, event.AggregateID)
+		}
+	default:
+		return true, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error looking up analytics consent: %w", err)
+	}
+	return user.AnalyticsConsent, nil
+}
+
+// Anonymize returns event without the aggregate ID and the fields of its data identifying the
+// user, at any depth
+func (a *AnalyticsConsent) Anonymize(event models.WebhookEvent) (models.WebhookEvent, error) {
+	event.AggregateID = ""
+	if len(event.Data) == 0 {
+		return event, nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return event, fmt.Errorf("error decoding event data: %w", err)
+	}
+	anonymized, err := json.Marshal(withoutIdentifyingFields(data))
+	if err != nil {
+		return event, fmt.Errorf("error encoding event data: %w", err)
+	}
+	event.Data = anonymized
+	return event, nil
+}
+
+// withoutIdentifyingFields removes identifying fields from objects in decoded JSON
+func withoutIdentifyingFields(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if identifyingFields[key] {
+				delete(v, key)
+				continue
+			}
+			v[key] = withoutIdentifyingFields(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = withoutIdentifyingFields(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognize and scan for
+const apiKeyPrefix = "otpk_"
+
+// apiKeyDisplayLength is how many leading characters of a key are kept to tell keys apart
+const apiKeyDisplayLength = 12
+
+// apiKeyUseInterval is how often the last use of a key is recorded, so busy callers don't
+// write on every request
+const apiKeyUseInterval = time.Minute
+
+// APIKeyService handles the API keys services authenticate with to call the API on their own
+// behalf, limited to the scopes they were granted
+type APIKeyService struct {
+	keyRepo      repository.APIKeyRepository
+	auditService *AuditService
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(keyRepo repository.APIKeyRepository, auditService *AuditService) *APIKeyService {
+	return &APIKeyService{keyRepo: keyRepo, auditService: auditService}
+}
+
+// Create creates an API key with the given scopes on behalf of an admin and returns it with
+// the key. Only a hash is stored, so the key cannot be retrieved again.
+func (s *APIKeyService) Create(ctx context.Context, actor models.AuditActor, req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating API key: %w", err)
+	}
+	rawKey := apiKeyPrefix + token
+
+	key := models.APIKey{
+		ID:        uuid.New(),
+		Name:      req.Name,
+		KeyHash:   hashOpaqueToken(rawKey),
+		KeyPrefix: rawKey[:apiKeyDisplayLength],
+		Scopes:    models.APIKeyScopes{},
+		CreatedAt: time.Now().UTC(),
+	}
+	for _, scope := range req.Scopes {
+		if !key.HasScope(scope) {
+			key.Scopes = append(key.Scopes, scope)
+		}
+	}
+	if actor.ID != uuid.Nil && actor.Type != models.AuditActorAPIKey {
+		createdBy := actor.ID
+		key.CreatedBy = &createdBy
+	}
+	if err := s.keyRepo.Create(ctx, &key); err != nil {
+		return nil, fmt.Errorf("error storing API key: %w", err)
+	}
+
+	err = s.auditService.Record(ctx, actor, AuditActionAPIKeyCreate, AuditTargetAPIKey, key.ID.String(), map[string]interface{}{
+		"name":   key.Name,
+		"scopes": key.Scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CreateAPIKeyResponse{APIKey: key, Key: rawKey}, nil
+}
+
+// List returns every API key, revoked ones included, newest first
+func (s *APIKeyService) List(ctx context.Context) ([]models.APIKey, error) {
+	keys, err := s.keyRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke revokes an API key on behalf of an admin; requests with it are rejected from then on
+func (s *APIKeyService) Revoke(ctx context.Context, actor models.AuditActor, id uuid.UUID) error {
+	revoked, err := s.keyRepo.Revoke(ctx, id, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error revoking API key: %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("API key not found")
+	}
+
+	return s.auditService.Record(ctx, actor, AuditActionAPIKeyRevoke, AuditTargetAPIKey, id.String(), nil)
+}
+
+// Authenticate finds the unrevoked API key rawKey is, recording its use. Unknown and revoked
+// keys are both reported as "invalid API key".
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey string) (*models.APIKey, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, fmt.Errorf("invalid API key")
+	}
+
+	key, err := s.keyRepo.FindActiveByKeyHash(ctx, hashOpaqueToken(rawKey))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invalid API key")
+		}
+		return nil, fmt.Errorf("error finding API key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUseInterval {
+		if err := s.keyRepo.MarkUsed(ctx, key.ID, now); err != nil {
+			return nil, fmt.Errorf("error updating API key: %w", err)
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
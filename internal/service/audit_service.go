@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// Audit actions
+const (
+	AuditActionUserRestore        = "user.restore"
+	AuditActionUserRestoreDenied  = "user.restore_denied"
+	AuditActionRateLimitFlush     = "ratelimit.flush"
+	AuditActionOTPResend          = "otp.resend"
+	AuditActionOTPExpire          = "otp.expire"
+	AuditActionProviderToggle     = "provider.toggle"
+	AuditActionUserMigrate        = "user.migrate"
+	AuditActionUserImport         = "user.import"
+	AuditActionAbuseReview        = "abuse.review"
+	AuditActionSuppressionImport  = "suppression.import"
+	AuditActionSuppressionRemove  = "suppression.remove"
+	AuditActionPhoneListAdd       = "phone_list.add"
+	AuditActionPhoneListRemove    = "phone_list.remove"
+	AuditActionUserRoleGrant      = "user.role_grant"
+	AuditActionMaintenanceCreate  = "maintenance.create"
+	AuditActionMaintenanceDelete  = "maintenance.delete"
+	AuditActionUserExport         = "user.export"
+	AuditActionSessionsRevoke     = "sessions.revoke"
+	AuditActionUserMetadataUpdate = "user.metadata_update"
+	AuditActionUserRead           = "user.read"
+	AuditActionUserList           = "user.list"
+	AuditActionAPIKeyCreate       = "api_key.create"
+	AuditActionAPIKeyRevoke       = "api_key.revoke"
+)
+
+// Audit target types
+const (
+	AuditTargetUser              = "user"
+	AuditTargetPhone             = "phone"
+	AuditTargetPhonePrefix       = "phone_prefix"
+	AuditTargetProvider          = "provider"
+	AuditTargetLegacyBatch       = "legacy_batch"
+	AuditTargetUserImport        = "user_import"
+	AuditTargetAbuseReport       = "abuse_report"
+	AuditTargetSuppressionImport = "suppression_import"
+	AuditTargetMaintenance       = "maintenance_notice"
+	AuditTargetUserExport        = "user_export"
+	AuditTargetAPIKey            = "api_key"
+	AuditTargetUserList          = "user_list"
+)
+
+// AuditService records actions in the audit trail
+type AuditService struct {
+	auditRepo repository.AuditRepository
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(auditRepo repository.AuditRepository) *AuditService {
+	return &AuditService{auditRepo: auditRepo}
+}
+
+// Record stores an audit log entry for an action performed by actor, a user unless
+// actor.Type says otherwise
+func (s *AuditService) Record(
+	ctx context.Context,
+	actor models.AuditActor,
+	action, targetType, targetID string,
+	metadata map[string]interface{},
+) error {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("error encoding audit metadata: %w", err)
+	}
+
+	entry := &models.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		ActorType:  actor.Type,
+		IPAddress:  actor.IPAddress,
+		UserAgent:  actor.UserAgent,
+		Metadata:   raw,
+	}
+	if entry.ActorType == "" {
+		entry.ActorType = models.AuditActorUser
+	}
+	if actor.ID != uuid.Nil {
+		actorID := actor.ID
+		entry.ActorID = &actorID
+	}
+
+	if err := s.auditRepo.Create(ctx, entry); err != nil {
+		return fmt.Errorf("error recording audit log: %w", err)
+	}
+	return nil
+}
@@ -2,102 +2,843 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"math/rand"
 	"strconv"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/email"
+	"github.com/lilokie/otp-auth/internal/flashcall"
+	"github.com/lilokie/otp-auth/internal/geo"
 	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
 	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/silentauth"
 )
 
+// verifyLockRetryInterval is how often a verification waiting for a concurrent one retries the lock
+const verifyLockRetryInterval = 50 * time.Millisecond
+
+// ErrVerificationInProgress is returned when a concurrent verification for the same phone number
+// held the lock for longer than the configured wait
+var ErrVerificationInProgress = errors.New("verification in progress")
+
+// ErrChannelDisabled is returned when an OTP is requested over a channel that is not enabled
+var ErrChannelDisabled = errors.New("OTP channel not enabled")
+
+// ErrNotVerified is returned when a phone number's carrier reports that the device a request
+// came from has another phone number
+var ErrNotVerified = errors.New("phone number not verified by carrier")
+
+// ErrNoEmailAddress is returned when an OTP is requested by email for a phone number without
+// a user, or whose user has no email address on their profile
+var ErrNoEmailAddress = errors.New("no email address for phone number")
+
+// LockoutError is returned when OTP verification is blocked for a phone number
+// after too many failed attempts
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return "too many failed attempts"
+}
+
+// InvalidOTPError is returned for a wrong OTP or backup code while the challenge stays pending
+type InvalidOTPError struct {
+	ExpiresAt time.Time // when the challenge expires, zero if unknown
+}
+
+func (e *InvalidOTPError) Error() string {
+	return "invalid OTP"
+}
+
+// ResendCooldownError is returned when an OTP is resent before the resend cooldown has passed
+type ResendCooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ResendCooldownError) Error() string {
+	return "resend cooldown active"
+}
+
 // AuthService handles authentication-related business logic
 type AuthService struct {
-	userRepo repository.UserRepository
-	otpRepo  repository.OTPRepository
-	config   *config.Config
+	userRepo    repository.UserRepository
+	otpRepo     repository.OTPRepository
+	logins      repository.LoginHistoryRepository
+	unitOfWork  repository.UnitOfWork
+	backupCodes *BackupCodeService
+	devices     *TrustedDeviceService
+	sessions    *SessionService
+	phoneLists  *PhoneListService
+	events      *EventService
+	rateLimit   *ratelimit.Policy
+	deliveries  *DeliveryService
+	emails      email.Sender
+	calls       flashcall.Caller
+	silent      silentauth.Verifier
+	coordinator *OTPCoordinator
+	statuses    repository.LoginStatusRepository
+	locks       repository.LockRepository
+	hooks       *Hooks
+	config      config.Provider
+	jitter      *ExpiryJitter
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService(
 	userRepo repository.UserRepository,
 	otpRepo repository.OTPRepository,
-	config *config.Config,
+	logins repository.LoginHistoryRepository,
+	unitOfWork repository.UnitOfWork,
+	backupCodes *BackupCodeService,
+	devices *TrustedDeviceService,
+	sessions *SessionService,
+	phoneLists *PhoneListService,
+	events *EventService,
+	rateLimit *ratelimit.Policy,
+	deliveries *DeliveryService,
+	emails email.Sender,
+	calls flashcall.Caller,
+	silent silentauth.Verifier,
+	statuses repository.LoginStatusRepository,
+	locks repository.LockRepository,
+	hooks *Hooks,
+	config config.Provider,
 ) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
-		otpRepo:  otpRepo,
-		config:   config,
+		userRepo:    userRepo,
+		otpRepo:     otpRepo,
+		logins:      logins,
+		unitOfWork:  unitOfWork,
+		backupCodes: backupCodes,
+		devices:     devices,
+		sessions:    sessions,
+		phoneLists:  phoneLists,
+		events:      events,
+		rateLimit:   rateLimit,
+		deliveries:  deliveries,
+		emails:      emails,
+		calls:       calls,
+		silent:      silent,
+		coordinator: NewOTPCoordinator(otpRepo, config),
+		statuses:    statuses,
+		locks:       locks,
+		hooks:       hooks,
+		config:      config,
+		jitter:      NewExpiryJitter(),
+	}
+}
+
+// GenerateOTP issues an OTP challenge for a phone number, bound to the requesting client, and sends it by SMS
+func (s *AuthService) GenerateOTP(ctx context.Context, phoneNumber, ipAddress, userAgent string) (*models.OTPChallenge, error) {
+	return s.GenerateOTPVia(ctx, phoneNumber, models.ChannelSMS, ipAddress, userAgent)
+}
+
+// GenerateOTPVia issues an OTP challenge for a phone number, bound to the requesting client, and
+// sends it over channel. An OTP already pending on another channel is handled as configured in
+// otp.channels.duplicates, see OTPCoordinator: it is either sent over channel as well, and its
+// challenge returned, or invalidated.
+func (s *AuthService) GenerateOTPVia(ctx context.Context, phoneNumber, channel, ipAddress, userAgent string) (*models.OTPChallenge, error) {
+	// Blocked phone numbers don't count against the rate limit
+	if err := s.phoneLists.CheckPhoneNumber(ctx, phoneNumber); err != nil {
+		return nil, err
+	}
+
+	// Record the request against the phone number's rate limit
+	result, err := s.rateLimit.Allow(ctx, ratelimit.PhoneKey(phoneNumber))
+	if err != nil {
+		return nil, fmt.Errorf("error checking rate limit: %w", err)
+	}
+	if !result.Allowed {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	cfg := s.config.Current()
+	switch channel {
+	case models.ChannelEmail:
+		if !cfg.OTP.Channels.Email {
+			return nil, ErrChannelDisabled
+		}
+		if _, err := s.emailAddress(ctx, phoneNumber); err != nil {
+			return nil, err
+		}
+	case models.ChannelFlashCall:
+		if !cfg.OTP.Channels.FlashCall {
+			return nil, ErrChannelDisabled
+		}
+	}
+
+	challenge, err := s.coordinator.Coordinate(ctx, phoneNumber, channel, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	reused := challenge != nil
+	if !reused {
+		// Each request gets its own challenge, so interleaved requests don't overwrite each other
+		challenge = &models.OTPChallenge{
+			ID:          uuid.New().String(),
+			PhoneNumber: phoneNumber,
+			Code:        s.generateRandomOTP(cfg.OTP.Length),
+			IPAddress:   ipAddress,
+			UserAgent:   userAgent,
+			Channel:     channel,
+		}
+
+		// Store OTP in Redis; jitter keeps bursts of OTPs from expiring in the same instant
+		expiration := s.jitter.Apply(cfg.GetOTPExpiration(), cfg.GetOTPExpirationJitter())
+		challenge.ExpiresAt = time.Now().UTC().Add(expiration).Truncate(time.Second)
+		err = s.otpRepo.StoreChallenge(ctx, challenge, expiration)
+		if err != nil {
+			return nil, fmt.Errorf("error storing OTP: %w", err)
+		}
+	}
+
+	// Resends of this OTP have to wait for the cooldown
+	_, err = s.otpRepo.AcquireResendCooldown(ctx, phoneNumber, cfg.GetOTPResendCooldown())
+	if err != nil {
+		return nil, fmt.Errorf("error starting resend cooldown: %w", err)
+	}
+
+	// A reused challenge stays stored as issued, as storing it again could bring it back after
+	// a concurrent verification completed it. While sending SMS is saturated, the OTP may be
+	// queued to be sent later.
+	if channel == models.ChannelSMS {
+		challenge.SendDelay, err = s.deliveries.SendOTPOrDefer(ctx, challenge)
+	} else {
+		err = s.sendOTP(ctx, challenge, channel)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.events.Publish(ctx, models.EventOTPRequested, models.AggregatePhone, phoneNumber, map[string]interface{}{
+		"challenge_id": challenge.ID,
+		"channel":      channel,
+		"reused":       reused,
+		"deferred":     challenge.SendDelay > 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
 }
 
-// GenerateOTP generates a one-time password for a phone number
-func (s *AuthService) GenerateOTP(ctx context.Context, phoneNumber string) (string, error) {
-	// Check rate limit
-	exceeded, err := s.otpRepo.CheckRateLimit(ctx, phoneNumber, s.config.OTP.RateLimit.Count, s.config.GetRateLimitDuration())
+// sendOTP delivers the OTP of a challenge over channel: by SMS through the SMS provider
+// rotation, by flash call from a number ending in the OTP, or by email to the address on the
+// user's profile
+func (s *AuthService) sendOTP(ctx context.Context, challenge *models.OTPChallenge, channel string) error {
+	switch channel {
+	case models.ChannelEmail:
+	case models.ChannelFlashCall:
+		callerID := flashcall.CallerID(s.config.Current().FlashCall.CallerPrefix, challenge.Code)
+		if err := s.calls.Call(ctx, challenge.PhoneNumber, callerID); err != nil {
+			return fmt.Errorf("error placing flash call: %w", err)
+		}
+		return nil
+	default:
+		return s.deliveries.SendOTP(ctx, challenge)
+	}
+
+	address, err := s.emailAddress(ctx, challenge.PhoneNumber)
 	if err != nil {
-		return "", fmt.Errorf("error checking rate limit: %w", err)
+		return err
 	}
-	if exceeded {
-		return "", fmt.Errorf("rate limit exceeded")
+	cfg := s.config.Current()
+	body := fmt.Sprintf("Your verification code is %s. It expires at %s.", challenge.Code, challenge.ExpiresAt.Format(time.RFC1123))
+	if err := s.emails.Send(ctx, address, cfg.Email.Subject, body); err != nil {
+		return fmt.Errorf("error sending OTP by email: %w", err)
+	}
+	return nil
+}
+
+// emailAddress returns the email address OTPs for a phone number are sent to by email
+func (s *AuthService) emailAddress(ctx context.Context, phoneNumber string) (string, error) {
+	user, err := s.userRepo.FindByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoEmailAddress
+		}
+		return "", err
+	}
+	if user.Email == "" {
+		return "", ErrNoEmailAddress
+	}
+	return user.Email, nil
+}
+
+// ResendOTP re-delivers the OTP of a pending challenge, at most once per resend cooldown
+func (s *AuthService) ResendOTP(ctx context.Context, challengeID, ipAddress, userAgent string) error {
+	challenge, err := s.findChallenge(ctx, challengeID, ipAddress, userAgent)
+	if err != nil {
+		if err.Error() == "invalid challenge" {
+			return fmt.Errorf("no pending OTP")
+		}
+		return err
+	}
+
+	remaining, err := s.otpRepo.AcquireResendCooldown(ctx, challenge.PhoneNumber, s.config.Current().GetOTPResendCooldown())
+	if err != nil {
+		return fmt.Errorf("error acquiring resend cooldown: %w", err)
+	}
+	if remaining > 0 {
+		return &ResendCooldownError{RetryAfter: remaining}
+	}
+
+	if err := s.sendOTP(ctx, challenge, challengeChannel(challenge)); err != nil {
+		return err
+	}
+
+	return s.events.Publish(ctx, models.EventOTPResent, models.AggregatePhone, challenge.PhoneNumber, map[string]interface{}{
+		"challenge_id": challenge.ID,
+	})
+}
+
+// OTPStatus returns the delivery status of the latest send of a pending challenge's OTP
+func (s *AuthService) OTPStatus(ctx context.Context, challengeID, ipAddress, userAgent string) (*models.OTPDelivery, error) {
+	challenge, err := s.findChallenge(ctx, challengeID, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.deliveries.Status(ctx, challenge.ID)
+	if err != nil {
+		if err.Error() == "OTP delivery not found" {
+			return nil, fmt.Errorf("invalid challenge")
+		}
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// VerifyOTP verifies the OTP of a challenge and starts a session if valid
+func (s *AuthService) VerifyOTP(ctx context.Context, challengeID, otp, ipAddress, userAgent string) (*models.SessionTokens, *models.User, error) {
+	return s.verifyChallenge(ctx, challengeID, "otp", ipAddress, userAgent, func(challenge *models.OTPChallenge) (bool, error) {
+		return challenge.Code == otp, nil
+	})
+}
+
+// VerifyBackupCode completes a challenge with one of the user's backup codes instead of its OTP,
+// for users who cannot receive SMS. Wrong backup codes count towards the lockout like wrong OTPs.
+func (s *AuthService) VerifyBackupCode(ctx context.Context, challengeID, backupCode, ipAddress, userAgent string) (*models.SessionTokens, *models.User, error) {
+	return s.verifyChallenge(ctx, challengeID, "backup_code", ipAddress, userAgent, func(challenge *models.OTPChallenge) (bool, error) {
+		return s.backupCodes.UseBackupCode(ctx, challenge.PhoneNumber, backupCode)
+	})
+}
+
+// verifyChallenge completes a challenge if check accepts the code given for it and starts a session;
+// method names the kind of code in domain events and the login history
+func (s *AuthService) verifyChallenge(
+	ctx context.Context,
+	challengeID, method, ipAddress, userAgent string,
+	check func(challenge *models.OTPChallenge) (bool, error),
+) (*models.SessionTokens, *models.User, error) {
+	challenge, err := s.findChallenge(ctx, challengeID, ipAddress, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	phoneNumber := challenge.PhoneNumber
+
+	// Verifications for a phone number run one at a time, so client retries cannot create
+	// the user or start a session twice
+	unlock, err := s.lockVerification(ctx, phoneNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	// A concurrent verification may have completed the challenge while this one waited
+	challenge, err = s.findChallenge(ctx, challengeID, ipAddress, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Refuse verification while the phone number is locked out
+	if err := s.checkLockout(ctx, phoneNumber, method, ipAddress, userAgent); err != nil {
+		return nil, nil, err
+	}
+
+	// Verify the code
+	valid, err := check(challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !valid {
+		err = s.events.Publish(ctx, models.EventOTPVerificationFailed, models.AggregatePhone, phoneNumber, map[string]interface{}{
+			"challenge_id": challenge.ID,
+			"method":       method,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		err = s.recordLoginFailure(ctx, phoneNumber, method, models.LoginFailureInvalidCode, ipAddress, userAgent)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = s.recordFailedVerification(ctx, challenge)
+		s.hooks.runOTPFailed(ctx, &OTPFailure{
+			PhoneNumber: phoneNumber,
+			ChallengeID: challenge.ID,
+			Method:      method,
+			IPAddress:   ipAddress,
+			UserAgent:   userAgent,
+		})
+		return nil, nil, err
+	}
+
+	// Delete challenge to prevent reuse
+	err = s.otpRepo.DeleteChallenge(ctx, challenge)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error deleting OTP: %w", err)
+	}
+
+	// A successful verification starts the failure count over
+	err = s.otpRepo.ClearFailedVerifications(ctx, phoneNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error clearing failed verifications: %w", err)
+	}
+
+	tokens, user, err := s.signIn(ctx, phoneNumber, method, models.VerifiedSourceOTP, ipAddress, userAgent, map[string]interface{}{
+		"challenge_id": challenge.ID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Notify the client's subscriptions to the challenge's login status. The status outlives
+	// the deleted challenge for as long as the challenge could have, for clients subscribing late.
+	cfg := s.config.Current()
+	err = s.statuses.Save(ctx, &models.LoginStatus{
+		ChallengeID: challenge.ID,
+		Status:      models.LoginStatusVerified,
+		IPAddress:   challenge.IPAddress,
+		UserAgent:   challenge.UserAgent,
+		UpdatedAt:   time.Now(),
+	}, cfg.GetOTPExpiration()+cfg.GetOTPExpirationJitter())
+	if err != nil {
+		return nil, nil, err
 	}
+	return tokens, user, nil
+}
 
-	// Generate OTP
-	otp := s.generateRandomOTP(s.config.OTP.Length)
+// WatchLoginStatus returns the login status of a challenge issued to the given client, followed
+// by its changes until ctx is done. The channel is closed once the challenge is verified.
+func (s *AuthService) WatchLoginStatus(ctx context.Context, challengeID, ipAddress, userAgent string) (<-chan *models.LoginStatus, error) {
+	ctx, cancel := context.WithCancel(ctx)
 
-	// Store OTP in Redis
-	err = s.otpRepo.StoreOTP(ctx, phoneNumber, otp, s.config.GetOTPExpiration())
+	// Subscribe before looking up the status, so a verification in between isn't missed
+	updates, err := s.statuses.Subscribe(ctx, challengeID)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	current, err := s.loginStatus(ctx, challengeID, ipAddress, userAgent)
 	if err != nil {
-		return "", fmt.Errorf("error storing OTP: %w", err)
+		cancel()
+		return nil, err
 	}
 
-	// Increment rate limit
-	err = s.otpRepo.IncrementRateLimit(ctx, phoneNumber, s.config.GetRateLimitDuration())
+	statuses := make(chan *models.LoginStatus, 1)
+	statuses <- current
+	go func() {
+		defer cancel()
+		defer close(statuses)
+		if current.Status == models.LoginStatusVerified {
+			return
+		}
+		for status := range updates {
+			select {
+			case statuses <- status:
+			case <-ctx.Done():
+				return
+			}
+			if status.Status == models.LoginStatusVerified {
+				return
+			}
+		}
+	}()
+	return statuses, nil
+}
+
+// PollLoginStatus returns the login status of a challenge issued to the given client. While the
+// challenge is pending, it waits up to wait for it to be verified, returning the pending status
+// if it isn't by then, so clients that can't use WatchLoginStatus can long-poll.
+func (s *AuthService) PollLoginStatus(ctx context.Context, challengeID, ipAddress, userAgent string, wait time.Duration) (*models.LoginStatus, error) {
+	if wait <= 0 {
+		return s.loginStatus(ctx, challengeID, ipAddress, userAgent)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	statuses, err := s.WatchLoginStatus(ctx, challengeID, ipAddress, userAgent)
 	if err != nil {
-		return "", fmt.Errorf("error incrementing rate limit: %w", err)
+		return nil, err
 	}
 
-	return otp, nil
+	// The channel is closed once the challenge is verified or the wait is over
+	var latest *models.LoginStatus
+	for status := range statuses {
+		latest = status
+	}
+	return latest, nil
 }
 
-// VerifyOTP verifies an OTP and returns a JWT token if valid
-func (s *AuthService) VerifyOTP(ctx context.Context, phoneNumber, otp string) (string, *models.User, error) {
-	// Get stored OTP
-	storedOTP, err := s.otpRepo.GetOTP(ctx, phoneNumber)
+// loginStatus returns the current login status of a challenge issued to the given client
+func (s *AuthService) loginStatus(ctx context.Context, challengeID, ipAddress, userAgent string) (*models.LoginStatus, error) {
+	// Verified challenges are deleted, but their status is kept
+	status, err := s.statuses.Get(ctx, challengeID)
+	if err == nil {
+		if status.IPAddress != ipAddress || status.UserAgent != userAgent {
+			return nil, fmt.Errorf("invalid challenge")
+		}
+		return status, nil
+	}
+	if err.Error() != "login status not found" {
+		return nil, err
+	}
+
+	challenge, err := s.findChallenge(ctx, challengeID, ipAddress, userAgent)
 	if err != nil {
-		return "", nil, fmt.Errorf("error retrieving OTP: %w", err)
+		return nil, err
 	}
+	return &models.LoginStatus{
+		ChallengeID: challenge.ID,
+		Status:      models.LoginStatusPending,
+		IPAddress:   challenge.IPAddress,
+		UserAgent:   challenge.UserAgent,
+		UpdatedAt:   time.Now(),
+	}, nil
+}
 
-	// Verify OTP
-	if storedOTP != otp {
-		return "", nil, fmt.Errorf("invalid OTP")
+// SignInWithDevice starts a session for the user with the given phone number without an OTP
+// if deviceToken is the token of one of the user's trusted devices. Like an OTP, a trusted
+// device doesn't sign in blocked or locked out phone numbers.
+func (s *AuthService) SignInWithDevice(ctx context.Context, phoneNumber, deviceToken, ipAddress, userAgent string) (*models.SessionTokens, *models.User, error) {
+	method := models.LoginMethodTrustedDevice
+	if err := s.phoneLists.CheckPhoneNumber(ctx, phoneNumber); err != nil {
+		return nil, nil, err
 	}
 
-	// Delete OTP to prevent reuse
-	err = s.otpRepo.DeleteOTP(ctx, phoneNumber)
+	unlock, err := s.lockVerification(ctx, phoneNumber)
 	if err != nil {
-		return "", nil, fmt.Errorf("error deleting OTP: %w", err)
+		return nil, nil, err
+	}
+	defer unlock()
+	if err := s.checkLockout(ctx, phoneNumber, method, ipAddress, userAgent); err != nil {
+		return nil, nil, err
 	}
 
-	// Find user by phone number or create if not exists
 	user, err := s.userRepo.FindByPhoneNumber(ctx, phoneNumber)
 	if err != nil {
-		// User not found, create new user
-		user, err = s.userRepo.Create(ctx, phoneNumber)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, fmt.Errorf("invalid device token")
+		}
+		return nil, nil, fmt.Errorf("error finding user: %w", err)
+	}
+
+	device, err := s.devices.Authenticate(ctx, user.ID, deviceToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.hooks.runLogin(ctx, &Login{User: user, Method: method, IPAddress: ipAddress, UserAgent: userAgent})
+	if err != nil {
+		return nil, nil, s.hookFailed(ctx, phoneNumber, method, ipAddress, userAgent, err)
+	}
+
+	err = recordLogin(ctx, s.logins, &models.LoginAttempt{
+		UserID:      &user.ID,
+		PhoneNumber: phoneNumber,
+		Method:      method,
+		Success:     true,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Signing in from a trusted device stands in for verifying an OTP
+	err = s.events.Publish(ctx, models.EventOTPVerified, models.AggregatePhone, phoneNumber, map[string]interface{}{
+		"method":    method,
+		"user_id":   user.ID,
+		"device_id": device.ID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.sessions.Start(ctx, user, ipAddress, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
+}
+
+// SignInSilently starts a session for the user with a phone number, creating them if there is
+// none, without an OTP if the phone number's carrier confirms that the device the request came
+// from has it, by the number its enrichment proxy passed or by carrierToken. It fails with
+// silentauth.ErrUnavailable if the carrier couldn't tell, and with ErrNotVerified if it reported
+// another number; clients are sent an OTP instead. Like verifying an OTP, it is refused for
+// blocked phone numbers and while the phone number is locked out.
+func (s *AuthService) SignInSilently(ctx context.Context, phoneNumber, carrierToken, ipAddress, userAgent string) (*models.SessionTokens, *models.User, error) {
+	method := models.LoginMethodSilentNetwork
+	if err := s.phoneLists.CheckPhoneNumber(ctx, phoneNumber); err != nil {
+		return nil, nil, err
+	}
+
+	unlock, err := s.lockVerification(ctx, phoneNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	if err := s.checkLockout(ctx, phoneNumber, method, ipAddress, userAgent); err != nil {
+		return nil, nil, err
+	}
+
+	verified, err := s.silent.Verify(ctx, phoneNumber, silentauth.Evidence{
+		MSISDN: silentauth.MSISDNFromContext(ctx),
+		Token:  carrierToken,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if !verified {
+		err = s.events.Publish(ctx, models.EventOTPVerificationFailed, models.AggregatePhone, phoneNumber, map[string]interface{}{
+			"method": method,
+		})
 		if err != nil {
-			return "", nil, fmt.Errorf("error creating user: %w", err)
+			return nil, nil, err
 		}
+		err = s.recordLoginFailure(ctx, phoneNumber, method, models.LoginFailureNotVerified, ipAddress, userAgent)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrNotVerified
 	}
 
-	// Generate JWT token
-	token, err := s.generateJWT(user)
+	return s.signIn(ctx, phoneNumber, method, models.VerifiedSourceCarrier, ipAddress, userAgent, map[string]interface{}{})
+}
+
+// signIn finds the user with a phone number just verified by method, creating them if there is
+// none, marks their phone number verified by source if it wasn't, runs the login hooks and starts
+// a session, recording the login and publishing otp.verified with details. The database writes
+// are made in one unit of work, so a sign-in failing part way leaves none of them behind. It is
+// called with the phone number's verification lock held.
+func (s *AuthService) signIn(ctx context.Context, phoneNumber, method, source, ipAddress, userAgent string, details map[string]interface{}) (*models.SessionTokens, *models.User, error) {
+	var tokens *models.SessionTokens
+	var user *models.User
+	var hookErr error
+	err := s.unitOfWork.WithTx(ctx, func(repos repository.Repositories) error {
+		// Find user by phone number or create if not exists, in one step, so verifications of a
+		// new phone number on other instances cannot both create the user
+		var newUser bool
+		var err error
+		user, newUser, err = repos.Users.FindOrCreateByPhoneNumber(ctx, phoneNumber)
+		if err != nil {
+			// Soft-deleted accounts cannot sign in until an admin restores them
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("account deleted")
+			}
+			return fmt.Errorf("error finding or creating user: %w", err)
+		}
+		if newUser {
+			if hookErr = s.hooks.runUserCreated(ctx, user); hookErr != nil {
+				return hookErr
+			}
+		}
+
+		// Users imported without a verified phone number have just verified it, and new users
+		// are created verified by OTP
+		if !user.PhoneVerified || (newUser && source != models.VerifiedSourceOTP) {
+			err = repos.Users.MarkPhoneVerified(ctx, user.ID, source)
+			if err != nil {
+				return fmt.Errorf("error marking phone verified: %w", err)
+			}
+			user.PhoneVerified = true
+			user.VerifiedSource = &source
+		}
+
+		hookErr = s.hooks.runLogin(ctx, &Login{User: user, Method: method, NewUser: newUser, IPAddress: ipAddress, UserAgent: userAgent})
+		if hookErr != nil {
+			return hookErr
+		}
+
+		err = recordLogin(ctx, repos.Logins, &models.LoginAttempt{
+			UserID:      &user.ID,
+			PhoneNumber: phoneNumber,
+			Method:      method,
+			Success:     true,
+			IPAddress:   ipAddress,
+			UserAgent:   userAgent,
+		})
+		if err != nil {
+			return err
+		}
+
+		details["method"] = method
+		details["user_id"] = user.ID
+		err = NewEventService(repos.Events).Publish(ctx, models.EventOTPVerified, models.AggregatePhone, phoneNumber, details)
+		if err != nil {
+			return err
+		}
+
+		// Sessions are not kept in the database, so the session is started last, once only
+		// committing can fail
+		tokens, err = s.sessions.Start(ctx, user, ipAddress, userAgent)
+		return err
+	})
+	if hookErr != nil {
+		// The refused sign-in is recorded outside the rolled back unit of work
+		return nil, nil, s.hookFailed(ctx, phoneNumber, method, ipAddress, userAgent, hookErr)
+	}
 	if err != nil {
-		return "", nil, fmt.Errorf("error generating JWT: %w", err)
+		return nil, nil, err
 	}
+	return tokens, user, nil
+}
 
-	return token, user, nil
+// checkLockout fails with a LockoutError, recording the refused login, while the phone number is
+// locked out after too many wrong codes
+func (s *AuthService) checkLockout(ctx context.Context, phoneNumber, method, ipAddress, userAgent string) error {
+	lockout, err := s.otpRepo.GetLockout(ctx, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("error checking lockout: %w", err)
+	}
+	if !lockout.Locked {
+		return nil
+	}
+	err = s.recordLoginFailure(ctx, phoneNumber, method, models.LoginFailureLockedOut, ipAddress, userAgent)
+	if err != nil {
+		return err
+	}
+	return &LockoutError{RetryAfter: lockout.RetryAfter}
+}
+
+// TrustDevice trusts the device a user just signed in from and returns its device token
+func (s *AuthService) TrustDevice(ctx context.Context, user *models.User, name, ipAddress, userAgent string) (string, error) {
+	return s.devices.TrustDevice(ctx, user.ID, name, ipAddress, userAgent)
+}
+
+// lockVerification takes the verification lock of a phone number, waiting for a concurrent
+// verification to release it for up to the configured wait, and returns the function releasing it
+func (s *AuthService) lockVerification(ctx context.Context, phoneNumber string) (func(), error) {
+	policy := s.config.Current().OTP.VerifyLock
+	key := "verify:" + phoneNumber
+	deadline := time.Now().Add(policy.GetWait())
+	for {
+		token, err := s.locks.AcquireLock(ctx, key, policy.GetTTL())
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			return func() {
+				// The lock is released even if the request was cancelled; one failing to
+				// release expires after its TTL
+				_ = s.locks.ReleaseLock(context.WithoutCancel(ctx), key, token)
+			}, nil
+		}
+
+		if time.Now().Add(verifyLockRetryInterval).After(deadline) {
+			return nil, ErrVerificationInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(verifyLockRetryInterval):
+		}
+	}
+}
+
+// recordFailedVerification counts a wrong OTP for a challenge and returns the error to report
+// for it: a LockoutError if this failure locked the phone number, an InvalidOTPError otherwise
+func (s *AuthService) recordFailedVerification(ctx context.Context, challenge *models.OTPChallenge) error {
+	phoneNumber := challenge.PhoneNumber
+	policy := s.config.Current().OTP.Lockout
+	if policy.MaxAttempts <= 0 {
+		return &InvalidOTPError{ExpiresAt: challenge.ExpiresAt}
+	}
+
+	lockout, err := s.otpRepo.RecordFailedVerification(ctx, phoneNumber, policy.MaxAttempts, policy.GetWindow(), policy.GetCooldown())
+	if err != nil {
+		return fmt.Errorf("error recording failed verification: %w", err)
+	}
+	if !lockout.Locked {
+		return &InvalidOTPError{ExpiresAt: challenge.ExpiresAt}
+	}
+
+	// Burn the pending OTPs so guessing cannot resume where it stopped after the cooldown
+	if _, err := s.otpRepo.DeleteChallengesByPhone(ctx, phoneNumber); err != nil {
+		return fmt.Errorf("error deleting OTP: %w", err)
+	}
+
+	err = s.events.Publish(ctx, models.EventOTPLockedOut, models.AggregatePhone, phoneNumber, map[string]interface{}{
+		"retry_after": int(lockout.RetryAfter.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+	return &LockoutError{RetryAfter: lockout.RetryAfter}
+}
+
+// recordLoginFailure adds a failed verification to the login history of the phone number's user, if it has one
+func (s *AuthService) recordLoginFailure(ctx context.Context, phoneNumber, method, reason, ipAddress, userAgent string) error {
+	attempt := &models.LoginAttempt{
+		PhoneNumber:   phoneNumber,
+		Method:        method,
+		FailureReason: &reason,
+		IPAddress:     ipAddress,
+		UserAgent:     userAgent,
+	}
+	if user, err := s.userRepo.FindByPhoneNumber(ctx, phoneNumber); err == nil {
+		attempt.UserID = &user.ID
+	}
+	return recordLogin(ctx, s.logins, attempt)
+}
+
+// hookFailed records a sign-in refused by a hook as a failed login attempt and returns the
+// hook's error; sign-ins aborted by other hook errors are not the client's doing and not recorded
+func (s *AuthService) hookFailed(ctx context.Context, phoneNumber, method, ipAddress, userAgent string, err error) error {
+	var denied *HookDeniedError
+	if !errors.As(err, &denied) {
+		return err
+	}
+	if recordErr := s.recordLoginFailure(ctx, phoneNumber, method, models.LoginFailureDenied, ipAddress, userAgent); recordErr != nil {
+		return recordErr
+	}
+	return err
+}
+
+// recordLogin stores a login attempt made now in logins
+func recordLogin(ctx context.Context, logins repository.LoginHistoryRepository, attempt *models.LoginAttempt) error {
+	attempt.ID = uuid.New()
+	attempt.CreatedAt = time.Now()
+	if err := logins.Record(ctx, attempt); err != nil {
+		return fmt.Errorf("error recording login attempt: %w", err)
+	}
+	return nil
+}
+
+// findChallenge returns a pending challenge if it was issued to the given client.
+// Unknown, expired and foreign challenges are all reported as "invalid challenge".
+func (s *AuthService) findChallenge(ctx context.Context, challengeID, ipAddress, userAgent string) (*models.OTPChallenge, error) {
+	challenge, err := s.otpRepo.GetChallenge(ctx, challengeID)
+	if err != nil {
+		if err.Error() == "OTP not found or expired" {
+			return nil, fmt.Errorf("invalid challenge")
+		}
+		return nil, fmt.Errorf("error retrieving OTP: %w", err)
+	}
+
+	if challenge.IPAddress != ipAddress || challenge.UserAgent != userAgent {
+		return nil, fmt.Errorf("invalid challenge")
+	}
+	return challenge, nil
 }
 
 // generateRandomOTP generates a random numeric OTP of the specified length
@@ -122,25 +863,13 @@ func powInt(x, y int) int {
 	return result
 }
 
-// generateJWT generates a JWT token for a user
-func (s *AuthService) generateJWT(user *models.User) (string, error) {
-	// Create the JWT claims, which includes the user ID and expiry time
-	expirationTime := time.Now().Add(time.Duration(s.config.JWT.ExpirationHours) * time.Hour)
-
-	claims := jwt.MapClaims{
-		"user_id":      user.ID.String(),
-		"phone_number": user.PhoneNumber,
-		"exp":          expirationTime.Unix(),
-	}
-
-	// Create the token with the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString([]byte(s.config.JWT.Secret))
+// IssueToken starts a session for a user without OTP verification, for users whose
+// identity was established elsewhere, and returns its access token
+func (s *AuthService) IssueToken(ctx context.Context, user *models.User) (string, error) {
+	// The request comes from whoever vouches for the user, so its country isn't the user's
+	tokens, err := s.sessions.Start(geo.NewContext(ctx, ""), user, "", "")
 	if err != nil {
 		return "", err
 	}
-
-	return tokenString, nil
+	return tokens.AccessToken, nil
 }
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// backupCodeAlphabet leaves out characters that are easily mistaken for each other
+const backupCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// BackupCodeService handles one-time backup codes, accepted instead of an OTP
+// when a user cannot receive SMS
+type BackupCodeService struct {
+	backupCodeRepo repository.BackupCodeRepository
+	userRepo       repository.UserRepository
+	events         *EventService
+	config         *config.Config
+}
+
+// NewBackupCodeService creates a new backup code service
+func NewBackupCodeService(
+	backupCodeRepo repository.BackupCodeRepository,
+	userRepo repository.UserRepository,
+	events *EventService,
+	config *config.Config,
+) *BackupCodeService {
+	return &BackupCodeService{
+		backupCodeRepo: backupCodeRepo,
+		userRepo:       userRepo,
+		events:         events,
+		config:         config,
+	}
+}
+
+// GenerateBackupCodes generates a new set of backup codes for a user, replacing any earlier set.
+// Only hashes are stored, so the returned codes cannot be retrieved again.
+func (s *BackupCodeService) GenerateBackupCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	if _, err := s.userRepo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+
+	codes := make([]string, s.config.GetBackupCodeCount())
+	hashes := make([]string, len(codes))
+	for i := range codes {
+		code, err := generateBackupCode(s.config.GetBackupCodeLength())
+		if err != nil {
+			return nil, fmt.Errorf("error generating backup code: %w", err)
+		}
+		codes[i] = code
+		hashes[i] = hashBackupCode(userID, code)
+	}
+
+	err := s.backupCodeRepo.ReplaceBackupCodes(ctx, userID, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("error storing backup codes: %w", err)
+	}
+
+	err = s.events.Publish(ctx, models.EventBackupCodesGenerated, models.AggregateUser, userID.String(), map[string]interface{}{
+		"count": len(codes),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// UseBackupCode consumes a backup code of the active user with the given phone number,
+// reporting whether it was valid
+func (s *BackupCodeService) UseBackupCode(ctx context.Context, phoneNumber, code string) (bool, error) {
+	// Only existing users can have backup codes
+	user, err := s.userRepo.FindByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error finding user: %w", err)
+	}
+
+	used, err := s.backupCodeRepo.UseBackupCode(ctx, user.ID, hashBackupCode(user.ID, code))
+	if err != nil {
+		return false, fmt.Errorf("error using backup code: %w", err)
+	}
+	return used, nil
+}
+
+// generateBackupCode generates a random code of length characters, split in two halves by a dash
+func generateBackupCode(length int) (string, error) {
+	max := big.NewInt(int64(len(backupCodeAlphabet)))
+
+	var b strings.Builder
+	for i := 0; i < length; i++ {
+		if i == length/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(backupCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// hashBackupCode hashes a backup code for storage. Codes are compared without
+// the separator, whitespace or case, and salted with the user ID.
+func hashBackupCode(userID uuid.UUID, code string) string {
+	normalized := strings.ToLower(strings.Join(strings.FieldsFunc(code, func(r rune) bool {
+		return r == '-' || r == ' '
+	}), ""))
+
+	sum := sha256.Sum256([]byte(userID.String() + ":" + normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,440 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/sms"
+	"github.com/lilokie/otp-auth/internal/tenant"
+)
+
+// ErrSendQueueFull is returned when an OTP cannot be queued because the send queue is full
+var ErrSendQueueFull = errors.New("OTP send queue full")
+
+// SendBacklogError is returned when an OTP isn't queued while sending SMS is saturated, as it
+// would expire before it is sent
+type SendBacklogError struct {
+	RetryAfter time.Duration // until the queue is expected to have drained enough
+}
+
+func (e *SendBacklogError) Error() string {
+	return "OTP send queue too long to send before expiry"
+}
+
+// DeliveryService sends OTPs and tracks whether they reached the phone, from the delivery
+// receipts (DLRs) SMS providers post back for the messages they sent. With the send queue
+// enabled, OTPs are queued and sent by background workers, which retry failed sends with
+// exponential backoff and move sends that run out of attempts to a dead-letter list.
+type DeliveryService struct {
+	deliveryRepo repository.OTPDeliveryRepository
+	queueRepo    repository.OTPSendQueueRepository
+	otpRepo      repository.OTPRepository
+	sender       *sms.Sender
+	config       config.Provider
+	logger       *slog.Logger
+	queueLength  metrics.Gauge
+	tenantLength *metrics.GaugeVec
+	deadLetters  metrics.Counter
+	deferred     metrics.Counter
+	overflowed   metrics.Counter
+	wake         chan struct{} // signals idle workers that an OTP was queued
+}
+
+// NewDeliveryService creates a new delivery service
+func NewDeliveryService(
+	deliveryRepo repository.OTPDeliveryRepository,
+	queueRepo repository.OTPSendQueueRepository,
+	otpRepo repository.OTPRepository,
+	sender *sms.Sender,
+	registry *metrics.Registry,
+	cfg config.Provider,
+	logger *slog.Logger,
+) *DeliveryService {
+	return &DeliveryService{
+		deliveryRepo: deliveryRepo,
+		queueRepo:    queueRepo,
+		otpRepo:      otpRepo,
+		sender:       sender,
+		config:       cfg,
+		logger:       logger,
+		queueLength: registry.Gauge("sms_queue_length",
+			"Number of OTPs waiting in the send queue, including those being sent."),
+		tenantLength: registry.GaugeVec("sms_queue_tenant_length",
+			"Number of a tenant's OTPs waiting in the send queue, including those being sent.", "tenant"),
+		deadLetters: registry.Counter("sms_queue_dead_letters_total",
+			"Total number of queued OTPs given up on after running out of send attempts."),
+		deferred: registry.Counter("sms_overflow_deferred_total",
+			"Total number of OTP requests queued because sending SMS was saturated."),
+		overflowed: registry.Counter("sms_overflow_rejected_total",
+			"Total number of OTP requests rejected because the overflow queue was full as well, or too long to send them before they expired."),
+		wake: make(chan struct{}, cfg.Current().SMS.Queue.GetWorkers()),
+	}
+}
+
+// SendOTP delivers the OTP of a challenge through the SMS provider rotation and records
+// the send as the challenge's latest, awaiting its delivery receipt. With the send queue
+// enabled, the OTP is queued instead and sent in the background.
+func (s *DeliveryService) SendOTP(ctx context.Context, challenge *models.OTPChallenge) error {
+	if !s.config.Current().SMS.Queue.Enabled {
+		return s.deliver(ctx, challenge)
+	}
+
+	// Suppressed phone numbers are still rejected up front
+	if err := s.sender.CheckPhone(ctx, challenge.PhoneNumber); err != nil {
+		return fmt.Errorf("error sending OTP: %w", err)
+	}
+
+	// Record the status before queueing, so a worker's sent status is never overwritten
+	if err := s.record(ctx, challenge.ID, sms.Receipt{}, models.DeliveryQueued); err != nil {
+		return err
+	}
+	job := &models.OTPSendJob{
+		ID:          uuid.New().String(),
+		ChallengeID: challenge.ID,
+		Tenant:      tenant.FromContext(ctx),
+		EnqueuedAt:  time.Now(),
+	}
+	added, err := s.queueRepo.Enqueue(ctx, job, s.config.Current().SMS.Queue.GetMaxLength(), 0)
+	if err != nil {
+		return fmt.Errorf("error sending OTP: %w", err)
+	}
+	if !added {
+		if err := s.record(ctx, challenge.ID, sms.Receipt{}, models.DeliveryFailed); err != nil {
+			return err
+		}
+		return ErrSendQueueFull
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SendOTPOrDefer sends the OTP of a challenge like SendOTP, except that while every SMS provider
+// is throttled or the send queue is full and the overflow is enabled for the request's tenant,
+// the OTP is queued in up to sms.overflow.maxLength extra places and sent in the background. It
+// returns the estimated delay before a queued OTP is sent, or zero if the OTP was sent or queued
+// as usual. OTPs that would expire before they are sent aren't queued; a *SendBacklogError is
+// returned instead.
+func (s *DeliveryService) SendOTPOrDefer(ctx context.Context, challenge *models.OTPChallenge) (time.Duration, error) {
+	err := s.SendOTP(ctx, challenge)
+	if err == nil {
+		return 0, nil
+	}
+	enabled, tenantMaxLength := s.config.Current().SMS.Overflow.ForTenant(tenant.FromContext(ctx))
+	if !enabled {
+		return 0, err
+	}
+	if !errors.Is(err, sms.ErrProviderThrottled) && !errors.Is(err, ErrSendQueueFull) {
+		return 0, err
+	}
+	return s.deferSend(ctx, challenge, tenantMaxLength)
+}
+
+// deferSend queues the OTP of a challenge in the overflow places of the send queue, holding
+// at most tenantMaxLength OTPs of the request's tenant if above 0, and returns the estimated
+// delay before it is sent
+func (s *DeliveryService) deferSend(ctx context.Context, challenge *models.OTPChallenge, tenantMaxLength int) (time.Duration, error) {
+	cfg := s.config.Current()
+	maxLength := cfg.SMS.Overflow.GetMaxLength()
+	if cfg.SMS.Queue.Enabled {
+		maxLength += cfg.SMS.Queue.GetMaxLength()
+	}
+
+	// The OTP would be queued either way, so a failed lookup only makes the estimate optimistic
+	length, err := s.queueRepo.Length(ctx)
+	if err != nil {
+		s.logger.Warn("Error getting OTP send queue length", "error", err)
+		length = 0
+	}
+	delay := s.estimateDelay(length + 1)
+	if !challenge.ExpiresAt.IsZero() {
+		if ttl := time.Until(challenge.ExpiresAt); delay >= ttl {
+			// The workers would only drop it as expired once its turn comes
+			s.overflowed.Inc()
+			if err := s.record(ctx, challenge.ID, sms.Receipt{}, models.DeliveryFailed); err != nil {
+				return 0, err
+			}
+			return 0, &SendBacklogError{RetryAfter: delay - ttl}
+		}
+	}
+
+	if err := s.record(ctx, challenge.ID, sms.Receipt{}, models.DeliveryQueued); err != nil {
+		return 0, err
+	}
+	job := &models.OTPSendJob{
+		ID:          uuid.New().String(),
+		ChallengeID: challenge.ID,
+		Tenant:      tenant.FromContext(ctx),
+		EnqueuedAt:  time.Now(),
+	}
+	added, err := s.queueRepo.Enqueue(ctx, job, maxLength, tenantMaxLength)
+	if err != nil {
+		return 0, fmt.Errorf("error sending OTP: %w", err)
+	}
+	if !added {
+		s.overflowed.Inc()
+		if err := s.record(ctx, challenge.ID, sms.Receipt{}, models.DeliveryFailed); err != nil {
+			return 0, err
+		}
+		return 0, ErrSendQueueFull
+	}
+	s.deferred.Inc()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	s.queueLength.Set(float64(length + 1))
+	if job.Tenant != "" {
+		s.reportTenantLength(ctx, job.Tenant)
+	}
+	return delay, nil
+}
+
+// reportTenantLength exports the number of a tenant's OTPs in the send queue
+func (s *DeliveryService) reportTenantLength(ctx context.Context, name string) {
+	length, err := s.queueRepo.TenantLength(ctx, name)
+	if err != nil {
+		s.logger.Warn("Error getting OTP send queue length", "tenant", name, "error", err)
+		return
+	}
+	s.tenantLength.With(name).Set(float64(length))
+}
+
+// estimateDelay returns how long sending the OTPs queued takes at sms.overflow.drainRate or,
+// if unset, at the combined rateLimit of the providers. Without either, every worker is assumed
+// to send an OTP per second. Estimates are whole seconds, at least one.
+func (s *DeliveryService) estimateDelay(queued int64) time.Duration {
+	cfg := s.config.Current()
+	rate := cfg.SMS.Overflow.DrainRate
+	if rate <= 0 {
+		for _, provider := range cfg.SMS.Providers {
+			rate += provider.RateLimit
+		}
+	}
+	if rate <= 0 {
+		rate = float64(cfg.SMS.Queue.GetWorkers())
+	}
+	seconds := math.Max(1, math.Ceil(float64(queued)/rate))
+	return time.Duration(seconds) * time.Second
+}
+
+// deliver sends the OTP of a challenge and records the send
+func (s *DeliveryService) deliver(ctx context.Context, challenge *models.OTPChallenge) error {
+	receipt, err := s.sender.SendOTP(ctx, challenge.PhoneNumber, challenge.Code)
+	if err != nil {
+		return fmt.Errorf("error sending OTP: %w", err)
+	}
+	return s.record(ctx, challenge.ID, receipt, models.DeliverySent)
+}
+
+// record stores the delivery status of a challenge's latest send
+func (s *DeliveryService) record(ctx context.Context, challengeID string, receipt sms.Receipt, status string) error {
+	// The status is only looked up through the challenge, so it needn't outlive it
+	cfg := s.config.Current()
+	err := s.deliveryRepo.Save(ctx, &models.OTPDelivery{
+		ChallengeID: challengeID,
+		Provider:    receipt.Provider,
+		MessageID:   receipt.MessageID,
+		Status:      status,
+		UpdatedAt:   time.Now(),
+	}, cfg.GetOTPExpiration()+cfg.GetOTPExpirationJitter())
+	if err != nil {
+		return fmt.Errorf("error recording OTP delivery: %w", err)
+	}
+	return nil
+}
+
+// Run sends queued OTPs with the configured number of workers until ctx is cancelled,
+// reporting the queue length every poll interval. OTPs being sent when ctx is cancelled
+// are still sent; Run returns once they are.
+func (s *DeliveryService) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	for i := 0; i < s.config.Current().SMS.Queue.GetWorkers(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.work(ctx)
+		}()
+	}
+	defer workers.Wait()
+
+	ticker := time.NewTicker(s.config.Current().SMS.Queue.GetPollInterval())
+	defer ticker.Stop()
+
+	for {
+		if length, err := s.queueRepo.Length(ctx); err == nil {
+			s.queueLength.Set(float64(length))
+		} else if ctx.Err() == nil {
+			s.logger.Error("Error getting OTP send queue length", "error", err)
+		}
+		for name := range s.config.Current().SMS.Overflow.Tenants {
+			s.reportTenantLength(ctx, name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// work sends queued OTPs one at a time, waiting for an OTP to be queued or the poll interval
+// whenever the queue has nothing due
+func (s *DeliveryService) work(ctx context.Context) {
+	// Sends aren't cut off by cancellation, so OTPs aren't left waiting for their lease to expire
+	sendCtx := context.WithoutCancel(ctx)
+	for ctx.Err() == nil {
+		processed, err := s.ProcessNext(sendCtx)
+		if err != nil {
+			s.logger.Error("Error sending queued OTP", "error", err)
+		}
+		if processed && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-time.After(s.config.Current().SMS.Queue.GetPollInterval()):
+		}
+	}
+}
+
+// ProcessNext claims the next due OTP in the send queue and sends it, rescheduling it with
+// backoff if the send fails. It reports whether an OTP was due.
+func (s *DeliveryService) ProcessNext(ctx context.Context) (bool, error) {
+	now := time.Now()
+	jobs, err := s.queueRepo.ClaimDue(ctx, now, now.Add(s.lease()), 1)
+	if err != nil || len(jobs) == 0 {
+		return false, err
+	}
+	return true, s.process(ctx, &jobs[0])
+}
+
+// process sends a claimed OTP and completes, reschedules or dead-letters it
+func (s *DeliveryService) process(ctx context.Context, job *models.OTPSendJob) error {
+	challenge, err := s.otpRepo.GetChallenge(ctx, job.ChallengeID)
+	if err != nil {
+		if err.Error() == "OTP not found or expired" {
+			// Verified, expired or replaced while queued; nothing left to send
+			return s.queueRepo.Complete(ctx, job.ID)
+		}
+		return err
+	}
+
+	receipt, sendErr := s.sender.SendOTP(ctx, challenge.PhoneNumber, challenge.Code)
+	if sendErr == nil {
+		// Don't send the OTP again if only recording the send failed
+		recordErr := s.record(ctx, challenge.ID, receipt, models.DeliverySent)
+		if err := s.queueRepo.Complete(ctx, job.ID); err != nil {
+			return err
+		}
+		return recordErr
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the OTP is sent again once its lease expires
+		return ctx.Err()
+	}
+
+	job.Attempts++
+	job.LastError = sendErr.Error()
+	switch {
+	case errors.Is(sendErr, sms.ErrPhoneSuppressed):
+		// Suppressed while queued; retrying won't help
+		if err := s.queueRepo.Complete(ctx, job.ID); err != nil {
+			return err
+		}
+		return s.record(ctx, challenge.ID, sms.Receipt{}, models.DeliveryFailed)
+	case job.Attempts >= s.config.Current().SMS.Queue.GetMaxAttempts():
+		if err := s.queueRepo.DeadLetter(ctx, job, s.config.Current().SMS.Queue.GetDeadLetterSize()); err != nil {
+			return err
+		}
+		s.deadLetters.Inc()
+		s.logger.Error("Giving up queued OTP",
+			"job_id", job.ID,
+			"challenge_id", job.ChallengeID,
+			"attempts", job.Attempts,
+			"error", sendErr,
+		)
+		return s.record(ctx, challenge.ID, sms.Receipt{}, models.DeliveryFailed)
+	default:
+		nextAttemptAt := time.Now().Add(s.backoff(job.Attempts))
+		s.logger.Warn("Queued OTP send failed",
+			"job_id", job.ID,
+			"challenge_id", job.ChallengeID,
+			"attempts", job.Attempts,
+			"next_attempt_at", nextAttemptAt,
+			"error", sendErr,
+		)
+		return s.queueRepo.Reschedule(ctx, job, nextAttemptAt)
+	}
+}
+
+// lease returns how long a worker holds a claimed OTP: long enough to try every provider in turn
+func (s *DeliveryService) lease() time.Duration {
+	cfg := s.config.Current()
+	providers := max(1, len(cfg.SMS.Providers))
+	return 2 * cfg.SMS.Failover.GetTimeout() * time.Duration(providers)
+}
+
+// backoff returns the delay before the next attempt after a number of failed attempts:
+// the initial backoff, doubled for every further failure, up to the maximum backoff
+func (s *DeliveryService) backoff(attempts int) time.Duration {
+	queue := s.config.Current().SMS.Queue
+	delay := queue.GetInitialBackoff()
+	maxDelay := queue.GetMaxBackoff()
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// HandleDeliveryReceipt updates the delivery status of the OTP a provider's delivery receipt
+// refers to. Receipts are authenticated with the provider's callback token; statuses other than
+// delivered and failed, and receipts for unknown, expired or superseded sends, are ignored.
+func (s *DeliveryService) HandleDeliveryReceipt(ctx context.Context, providerName, token string, req models.DeliveryReceiptRequest) error {
+	provider, ok := s.config.Current().GetSMSProvider(providerName)
+	if !ok || provider.CallbackToken == "" {
+		return fmt.Errorf("unknown provider")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(provider.CallbackToken)) != 1 {
+		return fmt.Errorf("invalid callback token")
+	}
+
+	switch req.Status {
+	case models.DeliveryDelivered, models.DeliveryFailed:
+	default:
+		return nil
+	}
+
+	if _, err := s.deliveryRepo.UpdateStatus(ctx, provider.Name, req.MessageID, req.Status, time.Now()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Status returns the delivery status of the latest send of an OTP challenge
+func (s *DeliveryService) Status(ctx context.Context, challengeID string) (*models.OTPDelivery, error) {
+	return s.deliveryRepo.Get(ctx, challengeID)
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// EventService records domain events in the append-only event log and replays them
+type EventService struct {
+	eventRepo repository.EventRepository
+}
+
+// NewEventService creates a new event service
+func NewEventService(eventRepo repository.EventRepository) *EventService {
+	return &EventService{eventRepo: eventRepo}
+}
+
+// Publish appends a domain event about an aggregate to the event log
+func (s *EventService) Publish(
+	ctx context.Context,
+	eventType, aggregateType, aggregateID string,
+	payload map[string]interface{},
+) error {
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding domain event: %w", err)
+	}
+
+	event := &models.DomainEvent{
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       raw,
+	}
+	if err := s.eventRepo.Append(ctx, event); err != nil {
+		return fmt.Errorf("error recording domain event: %w", err)
+	}
+	return nil
+}
+
+// Replay passes every event with a sequence number above afterSequence to apply, in sequence order,
+// reading batchSize events at a time. It returns the sequence number of the last event applied.
+func (s *EventService) Replay(
+	ctx context.Context,
+	afterSequence int64,
+	batchSize int,
+	apply func(event models.DomainEvent) error,
+) (int64, error) {
+	for {
+		events, err := s.eventRepo.ListAfter(ctx, afterSequence, batchSize)
+		if err != nil {
+			return afterSequence, fmt.Errorf("error reading domain events: %w", err)
+		}
+
+		for _, event := range events {
+			if err := apply(event); err != nil {
+				return afterSequence, fmt.Errorf("error applying domain event %d: %w", event.Sequence, err)
+			}
+			afterSequence = event.Sequence
+		}
+
+		if len(events) < batchSize {
+			return afterSequence, nil
+		}
+	}
+}
+
+// UserProjection is a read model of users rebuilt from user domain events
+type UserProjection struct {
+	users map[uuid.UUID]*models.User
+}
+
+// NewUserProjection creates an empty user projection
+func NewUserProjection() *UserProjection {
+	return &UserProjection{users: make(map[uuid.UUID]*models.User)}
+}
+
+// Apply updates the projection with a domain event; events about other aggregates are ignored
+func (p *UserProjection) Apply(event models.DomainEvent) error {
+	if event.AggregateType != models.AggregateUser {
+		return nil
+	}
+	id, err := uuid.Parse(event.AggregateID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID %q: %w", event.AggregateID, err)
+	}
+
+	switch event.Type {
+	case models.EventUserCreated, models.EventUserRestored:
+		// Users recorded before analytics consent was tracked consented by default
+		user := &models.User{AnalyticsConsent: true}
+		if err := json.Unmarshal(event.Payload, user); err != nil {
+			return fmt.Errorf("error decoding user: %w", err)
+		}
+		p.users[id] = user
+		return nil
+	case models.EventUserPurged:
+		delete(p.users, id)
+		return nil
+	}
+
+	// The remaining events change users created earlier in the log
+	user, ok := p.users[id]
+	if !ok {
+		return nil
+	}
+	switch event.Type {
+	case models.EventUserUpdated:
+		var payload struct {
+			PhoneNumber string `json:"phone_number"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("error decoding user update: %w", err)
+		}
+		user.PhoneNumber = payload.PhoneNumber
+	case models.EventUserPhoneVerified:
+		var payload struct {
+			VerifiedSource string `json:"verified_source"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("error decoding phone verification: %w", err)
+		}
+		user.PhoneVerified = true
+		user.VerifiedSource = &payload.VerifiedSource
+	case models.EventUserRoleChanged:
+		var payload struct {
+			Role string `json:"role"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("error decoding role change: %w", err)
+		}
+		user.Role = payload.Role
+	case models.EventUserProfileUpdated:
+		var update models.UpdateProfileRequest
+		if err := json.Unmarshal(event.Payload, &update); err != nil {
+			return fmt.Errorf("error decoding profile update: %w", err)
+		}
+		if update.FirstName != nil {
+			user.FirstName = *update.FirstName
+		}
+		if update.LastName != nil {
+			user.LastName = *update.LastName
+		}
+		if update.Email != nil {
+			user.Email = *update.Email
+		}
+		if update.AvatarURL != nil {
+			user.AvatarURL = *update.AvatarURL
+		}
+	case models.EventUserMetadataUpdated:
+		var payload struct {
+			Metadata map[string]*string `json:"metadata"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("error decoding metadata update: %w", err)
+		}
+		for key, value := range payload.Metadata {
+			if value == nil {
+				delete(user.Metadata, key)
+				continue
+			}
+			if user.Metadata == nil {
+				user.Metadata = models.UserMetadata{}
+			}
+			user.Metadata[key] = *value
+		}
+	case models.EventUserConsentChanged:
+		var payload struct {
+			AnalyticsConsent bool `json:"analytics_consent"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("error decoding consent change: %w", err)
+		}
+		user.AnalyticsConsent = payload.AnalyticsConsent
+	case models.EventUserDeleted:
+		deletedAt := event.OccurredAt
+		user.DeletedAt = &deletedAt
+	default:
+		return nil
+	}
+	user.UpdatedAt = event.OccurredAt
+	return nil
+}
+
+// Users returns the active users of the projection, oldest first
+func (p *UserProjection) Users() []models.User {
+	users := make([]models.User, 0, len(p.users))
+	for _, user := range p.users {
+		if user.DeletedAt == nil {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users
+}
+
+// Stats counts the active users of the projection by phone verification status and source
+func (p *UserProjection) Stats() *models.UserStats {
+	stats := &models.UserStats{VerifiedBySource: make(map[string]int64)}
+	for _, user := range p.Users() {
+		stats.TotalUsers++
+		if !user.PhoneVerified {
+			stats.Unverified++
+			continue
+		}
+		stats.PhoneVerified++
+		source := ""
+		if user.VerifiedSource != nil {
+			source = *user.VerifiedSource
+		}
+		stats.VerifiedBySource[source]++
+	}
+	return stats
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"math/bits"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// jitterStrata is the number of equal slices the jitter range is divided into
+const jitterStrata = 64
+
+// ExpiryJitter spreads TTLs over a jitter range using stratified ("blue-noise")
+// sampling: consecutive calls land in strata visited in bit-reversed order with a
+// random offset inside each one, so any burst of OTPs expires evenly across the
+// range instead of clumping the way independent random offsets do
+type ExpiryJitter struct {
+	counter uint64
+}
+
+// NewExpiryJitter creates a jitter source
+func NewExpiryJitter() *ExpiryJitter {
+	return &ExpiryJitter{}
+}
+
+// Apply returns ttl extended by the next jitter offset, of up to max
+func (j *ExpiryJitter) Apply(ttl, max time.Duration) time.Duration {
+	if max <= 0 {
+		return ttl
+	}
+
+	n := atomic.AddUint64(&j.counter, 1) - 1
+	stratum := bits.Reverse8(uint8(n%jitterStrata)) >> 2 // 6-bit reversal for 64 strata
+	position := (float64(stratum) + rand.Float64()) / jitterStrata
+
+	return ttl + time.Duration(position*float64(max))
+}
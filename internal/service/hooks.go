@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// Hook names, as sent by webhook hooks and listed in hooks.events
+const (
+	HookUserCreated = "user.created"
+	HookLogin       = "user.login"
+	HookOTPFailed   = "otp.failed"
+)
+
+// HookDeniedError is returned by user created and login hooks to refuse a sign-in
+type HookDeniedError struct {
+	Reason string // shown to the client, empty for a generic message
+}
+
+func (e *HookDeniedError) Error() string {
+	if e.Reason == "" {
+		return "sign-in denied"
+	}
+	return "sign-in denied: " + e.Reason
+}
+
+// Login describes a sign-in about to start a session
+type Login struct {
+	User      *models.User
+	Method    string // otp, backup_code or trusted_device
+	NewUser   bool   // the user was created by this sign-in
+	IPAddress string
+	UserAgent string
+}
+
+// OTPFailure describes a wrong OTP or backup code
+type OTPFailure struct {
+	PhoneNumber string
+	ChallengeID string
+	Method      string // otp or backup_code
+	IPAddress   string
+	UserAgent   string
+}
+
+// UserCreatedHook is called with a user created by signing up with an OTP. Returning an error
+// aborts the sign-in, though the user stays created; a *HookDeniedError refuses it with 403.
+type UserCreatedHook func(ctx context.Context, user *models.User) error
+
+// LoginHook is called before a session is started for a sign-in. Returning an error aborts the
+// sign-in; a *HookDeniedError refuses it with 403.
+type LoginHook func(ctx context.Context, login *Login) error
+
+// OTPFailedHook is called after a wrong OTP or backup code was recorded. Errors are logged,
+// the client is told about the wrong code either way.
+type OTPFailedHook func(ctx context.Context, failure *OTPFailure) error
+
+// Hooks is a registry of callbacks run by the auth service, where deployments embedding the
+// service plug in their own business logic. Hooks of a kind run in the order they were
+// registered, synchronously within the request, so they should be quick.
+type Hooks struct {
+	logger *slog.Logger
+
+	mu          sync.RWMutex
+	userCreated []UserCreatedHook
+	login       []LoginHook
+	otpFailed   []OTPFailedHook
+}
+
+// NewHooks creates an empty hook registry
+func NewHooks(logger *slog.Logger) *Hooks {
+	return &Hooks{logger: logger}
+}
+
+// OnUserCreated registers a hook called when a user signs up
+func (h *Hooks) OnUserCreated(hook UserCreatedHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.userCreated = append(h.userCreated, hook)
+}
+
+// OnLogin registers a hook called when a user signs in
+func (h *Hooks) OnLogin(hook LoginHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.login = append(h.login, hook)
+}
+
+// OnOTPFailed registers a hook called when a wrong OTP or backup code is given
+func (h *Hooks) OnOTPFailed(hook OTPFailedHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.otpFailed = append(h.otpFailed, hook)
+}
+
+// runUserCreated runs the user created hooks, stopping at the first error
+func (h *Hooks) runUserCreated(ctx context.Context, user *models.User) error {
+	h.mu.RLock()
+	hooks := h.userCreated
+	h.mu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(ctx, user); err != nil {
+			return fmt.Errorf("error running %s hook: %w", HookUserCreated, err)
+		}
+	}
+	return nil
+}
+
+// runLogin runs the login hooks, stopping at the first error
+func (h *Hooks) runLogin(ctx context.Context, login *Login) error {
+	h.mu.RLock()
+	hooks := h.login
+	h.mu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(ctx, login); err != nil {
+			return fmt.Errorf("error running %s hook: %w", HookLogin, err)
+		}
+	}
+	return nil
+}
+
+// runOTPFailed runs every OTP failed hook, logging their errors
+func (h *Hooks) runOTPFailed(ctx context.Context, failure *OTPFailure) {
+	h.mu.RLock()
+	hooks := h.otpFailed
+	h.mu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(ctx, failure); err != nil {
+			h.logger.Error("Error running OTP failed hook", "error", err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// Import limits
+const (
+	// MaxImportBatchSize is the largest number of users imported in one batch
+	MaxImportBatchSize = 1000
+
+	// maxVerifiedSourceLength matches the users.verified_source column
+	maxVerifiedSourceLength = 50
+)
+
+// ImportService imports users from other systems, keeping phone verification done there
+type ImportService struct {
+	userRepo     repository.UserRepository
+	auditService *AuditService
+}
+
+// NewImportService creates a new import service
+func NewImportService(userRepo repository.UserRepository, auditService *AuditService) *ImportService {
+	return &ImportService{
+		userRepo:     userRepo,
+		auditService: auditService,
+	}
+}
+
+// ImportUsers creates a user for each entry whose phone number is not taken yet.
+// Users imported with a verified phone number sign in like any existing user;
+// the others are marked verified by OTP on their first sign-in. Entries that
+// cannot be imported are reported individually without failing the batch.
+func (s *ImportService) ImportUsers(ctx context.Context, actor models.AuditActor, users []models.ImportUser) (*models.ImportUsersResponse, error) {
+	if len(users) > MaxImportBatchSize {
+		return nil, fmt.Errorf("batch too large")
+	}
+
+	response := &models.ImportUsersResponse{
+		BatchID: uuid.New(),
+		Results: make([]models.UserImportResult, 0, len(users)),
+	}
+	bySource := make(map[string]int)
+	for _, importUser := range users {
+		result := s.importUser(ctx, importUser)
+		switch {
+		case result.Error != "":
+			response.Failed++
+		case result.Created:
+			response.Imported++
+			if importUser.PhoneVerified {
+				bySource[importUser.VerifiedSource]++
+			}
+		default:
+			response.Skipped++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	err := s.auditService.Record(ctx, actor, AuditActionUserImport, AuditTargetUserImport, response.BatchID.String(), map[string]interface{}{
+		"users":              len(users),
+		"imported":           response.Imported,
+		"skipped":            response.Skipped,
+		"failed":             response.Failed,
+		"verified_by_source": bySource,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// importUser creates the user for an import entry unless its phone number is taken
+func (s *ImportService) importUser(ctx context.Context, importUser models.ImportUser) models.UserImportResult {
+	result := models.UserImportResult{PhoneNumber: importUser.PhoneNumber}
+
+	if !utils.IsValidPhoneNumber(importUser.PhoneNumber) {
+		result.Error = "invalid phone number"
+		return result
+	}
+
+	var verifiedSource *string
+	source := strings.TrimSpace(importUser.VerifiedSource)
+	switch {
+	case importUser.PhoneVerified && source == "":
+		result.Error = "verified source required"
+		return result
+	case !importUser.PhoneVerified && source != "":
+		result.Error = "verified source given for unverified phone number"
+		return result
+	case len(source) > maxVerifiedSourceLength:
+		result.Error = "verified source too long"
+		return result
+	case importUser.PhoneVerified:
+		verifiedSource = &source
+	}
+
+	// Existing users are left alone, deleted ones included
+	user, err := s.userRepo.FindByPhoneNumber(ctx, importUser.PhoneNumber)
+	if err == nil {
+		result.UserID = &user.ID
+		return result
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		result.Error = "error finding user"
+		return result
+	}
+	if _, err := s.userRepo.FindDeletedByPhoneNumber(ctx, importUser.PhoneNumber); err == nil {
+		result.Error = "account deleted"
+		return result
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		result.Error = "error finding user"
+		return result
+	}
+
+	user, err = s.userRepo.CreateImported(ctx, importUser.PhoneNumber, importUser.PhoneVerified, verifiedSource)
+	if err != nil {
+		result.Error = "error creating user"
+		return result
+	}
+
+	result.UserID = &user.ID
+	result.Created = true
+	return result
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// MaintenanceService manages the notices announcing planned downtime, which clients fetch to
+// show banners ahead of it
+type MaintenanceService struct {
+	repo         repository.MaintenanceNoticeRepository
+	auditService *AuditService
+	config       config.Provider
+
+	mu       sync.Mutex // guards the cached notices
+	cached   []models.MaintenanceNotice
+	cachedAt time.Time
+}
+
+// NewMaintenanceService creates a new maintenance service
+func NewMaintenanceService(repo repository.MaintenanceNoticeRepository, auditService *AuditService, cfg config.Provider) *MaintenanceService {
+	return &MaintenanceService{repo: repo, auditService: auditService, config: cfg}
+}
+
+// Create announces a maintenance window on behalf of an admin
+func (s *MaintenanceService) Create(ctx context.Context, actor models.AuditActor, req models.CreateMaintenanceNoticeRequest) (*models.MaintenanceNotice, error) {
+	if !req.EndsAt.After(req.StartsAt) {
+		return nil, &ValidationError{Message: "ends_at must be after starts_at"}
+	}
+	now := time.Now().UTC()
+	if !req.EndsAt.After(now) {
+		return nil, &ValidationError{Message: "ends_at must be in the future"}
+	}
+	severity := req.Severity
+	if severity == "" {
+		severity = models.MaintenanceSeverityInfo
+	}
+
+	notice := &models.MaintenanceNotice{
+		ID:        uuid.New().String(),
+		Message:   req.Message,
+		Severity:  severity,
+		StartsAt:  req.StartsAt.UTC(),
+		EndsAt:    req.EndsAt.UTC(),
+		CreatedAt: now,
+	}
+	if err := s.repo.Create(ctx, notice); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+
+	err := s.auditService.Record(ctx, actor, AuditActionMaintenanceCreate, AuditTargetMaintenance, notice.ID, map[string]interface{}{
+		"severity":  notice.Severity,
+		"starts_at": notice.StartsAt,
+		"ends_at":   notice.EndsAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Ended notices are only kept until the next one is announced
+	if err := s.deleteEnded(ctx, now); err != nil {
+		return nil, err
+	}
+	return notice, nil
+}
+
+// List returns the maintenance notices that have not ended, by start time
+func (s *MaintenanceService) List(ctx context.Context) ([]models.MaintenanceNotice, error) {
+	notices, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return notEnded(notices, time.Now()), nil
+}
+
+// Delete withdraws a maintenance notice on behalf of an admin, reporting whether it existed
+func (s *MaintenanceService) Delete(ctx context.Context, actor models.AuditActor, id string) (bool, error) {
+	deleted, err := s.repo.Delete(ctx, id)
+	if err != nil || !deleted {
+		return false, err
+	}
+	s.invalidate()
+
+	err = s.auditService.Record(ctx, actor, AuditActionMaintenanceDelete, AuditTargetMaintenance, id, nil)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Current returns the maintenance notices that are in progress or upcoming, by start time.
+// They are read on every request for the maintenance header, so each instance caches them for
+// maintenance.cacheTtl; notices announced through other instances show up once it has passed.
+func (s *MaintenanceService) Current(ctx context.Context) ([]models.MaintenanceNotice, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	if s.cached != nil && now.Sub(s.cachedAt) < s.config.Current().Maintenance.GetCacheTTL() {
+		notices := s.cached
+		s.mu.Unlock()
+		return notEnded(notices, now), nil
+	}
+	s.mu.Unlock()
+
+	notices, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing maintenance notices: %w", err)
+	}
+	notices = notEnded(notices, now)
+
+	s.mu.Lock()
+	s.cached, s.cachedAt = notices, now
+	s.mu.Unlock()
+	return notices, nil
+}
+
+// invalidate drops the cached notices, so changes made through this instance apply right away
+func (s *MaintenanceService) invalidate() {
+	s.mu.Lock()
+	s.cached = nil
+	s.mu.Unlock()
+}
+
+// deleteEnded deletes the notices that ended before now
+func (s *MaintenanceService) deleteEnded(ctx context.Context, now time.Time) error {
+	notices, err := s.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, notice := range notices {
+		if notice.EndsAt.After(now) {
+			continue
+		}
+		if _, err := s.repo.Delete(ctx, notice.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notEnded returns the notices that have not ended at now, keeping their order
+func notEnded(notices []models.MaintenanceNotice, now time.Time) []models.MaintenanceNotice {
+	current := make([]models.MaintenanceNotice, 0, len(notices))
+	for _, notice := range notices {
+		if notice.EndsAt.After(now) {
+			current = append(current, notice)
+		}
+	}
+	return current
+}
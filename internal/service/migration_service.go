@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// MigrationService handles the one-time migration of users from the legacy system
+type MigrationService struct {
+	userRepo     repository.UserRepository
+	authService  *AuthService
+	auditService *AuditService
+	config       *config.Config
+}
+
+// NewMigrationService creates a new migration service
+func NewMigrationService(
+	userRepo repository.UserRepository,
+	authService *AuthService,
+	auditService *AuditService,
+	config *config.Config,
+) *MigrationService {
+	return &MigrationService{
+		userRepo:     userRepo,
+		authService:  authService,
+		auditService: auditService,
+		config:       config,
+	}
+}
+
+// LegacySignature returns the hex HMAC-SHA256 the legacy system must sign a batch with.
+// The signed payload is the issued-at unix timestamp followed by one
+// "legacy_id<TAB>phone_number" line per user, each line terminated by a newline.
+func LegacySignature(secret string, issuedAt int64, users []models.LegacyUser) string {
+	var payload strings.Builder
+	payload.WriteString(strconv.FormatInt(issuedAt, 10))
+	payload.WriteByte('\n')
+	for _, user := range users {
+		payload.WriteString(user.LegacyID)
+		payload.WriteByte('\t')
+		payload.WriteString(user.PhoneNumber)
+		payload.WriteByte('\n')
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MigrateLegacyUsers verifies a signed batch of legacy users and returns a token for each,
+// creating users that don't exist yet. Entries that cannot be migrated are reported
+// individually without failing the batch.
+func (s *MigrationService) MigrateLegacyUsers(ctx context.Context, actor models.AuditActor, req *models.MigrateLegacyUsersRequest) (*models.MigrateLegacyUsersResponse, error) {
+	cfg := s.config.Migration
+	if cfg.LegacySecret == "" {
+		return nil, fmt.Errorf("legacy migration disabled")
+	}
+	if cfg.MaxBatchSize > 0 && len(req.Users) > cfg.MaxBatchSize {
+		return nil, fmt.Errorf("batch too large")
+	}
+	if err := s.verifyBatch(req); err != nil {
+		return nil, err
+	}
+
+	response := &models.MigrateLegacyUsersResponse{
+		Results: make([]models.LegacyMigrationResult, 0, len(req.Users)),
+	}
+	created := 0
+	for _, legacyUser := range req.Users {
+		result := s.migrateUser(ctx, legacyUser)
+		if result.Error != "" {
+			response.Failed++
+		} else {
+			response.Migrated++
+		}
+		if result.Created {
+			created++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	err := s.auditService.Record(ctx, actor, AuditActionUserMigrate, AuditTargetLegacyBatch, strconv.FormatInt(req.IssuedAt, 10), map[string]interface{}{
+		"users":    len(req.Users),
+		"migrated": response.Migrated,
+		"created":  created,
+		"failed":   response.Failed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// verifyBatch checks the batch signature and freshness
+func (s *MigrationService) verifyBatch(req *models.MigrateLegacyUsersRequest) error {
+	// Separators inside fields would make the signed payload ambiguous
+	for _, user := range req.Users {
+		if strings.ContainsAny(user.LegacyID, "\t\n") || strings.ContainsAny(user.PhoneNumber, "\t\n") {
+			return fmt.Errorf("invalid signature")
+		}
+	}
+
+	expected := LegacySignature(s.config.Migration.LegacySecret, req.IssuedAt, req.Users)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(req.Signature))) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	// Signed batches are only accepted for a limited time to limit replays
+	age := time.Since(time.Unix(req.IssuedAt, 0))
+	if maxAge := s.config.GetMigrationSignatureMaxAge(); age > maxAge || age < -maxAge {
+		return fmt.Errorf("signature expired")
+	}
+
+	return nil
+}
+
+// migrateUser finds or creates the user for a legacy user and issues a token for it
+func (s *MigrationService) migrateUser(ctx context.Context, legacyUser models.LegacyUser) models.LegacyMigrationResult {
+	result := models.LegacyMigrationResult{LegacyID: legacyUser.LegacyID}
+
+	if !utils.IsValidPhoneNumber(legacyUser.PhoneNumber) {
+		result.Error = "invalid phone number"
+		return result
+	}
+
+	user, err := s.userRepo.FindByPhoneNumber(ctx, legacyUser.PhoneNumber)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			result.Error = "error finding user"
+			return result
+		}
+		// Deleted accounts stay deleted; they can only come back through an admin restore
+		_, delErr := s.userRepo.FindDeletedByPhoneNumber(ctx, legacyUser.PhoneNumber)
+		if delErr == nil {
+			result.Error = "account deleted"
+			return result
+		}
+		if !errors.Is(delErr, sql.ErrNoRows) {
+			result.Error = "error finding user"
+			return result
+		}
+
+		// The legacy system verified its users' phone numbers
+		source := models.VerifiedSourceLegacyMigration
+		user, err = s.userRepo.CreateImported(ctx, legacyUser.PhoneNumber, true, &source)
+		if err != nil {
+			result.Error = "error creating user"
+			return result
+		}
+		result.Created = true
+	}
+
+	token, err := s.authService.IssueToken(ctx, user)
+	if err != nil {
+		result.Error = "error issuing token"
+		return result
+	}
+
+	result.UserID = &user.ID
+	result.Token = token
+	return result
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// OTPCleanupService deletes expired OTPs from stores that keep them until they are deleted,
+// such as Postgres, so their tables don't grow with every OTP ever sent
+type OTPCleanupService struct {
+	otpRepo repository.OTPCleanupRepository
+	logger  *slog.Logger
+}
+
+// NewOTPCleanupService creates a new OTP cleanup service
+func NewOTPCleanupService(otpRepo repository.OTPCleanupRepository, logger *slog.Logger) *OTPCleanupService {
+	return &OTPCleanupService{otpRepo: otpRepo, logger: logger}
+}
+
+// Run deletes expired OTPs every interval until ctx is done
+func (s *OTPCleanupService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Cleanup(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("Error deleting expired OTPs", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup deletes the expired OTP challenges, cooldowns and failed verifications and returns
+// how many records were deleted
+func (s *OTPCleanupService) Cleanup(ctx context.Context) (int64, error) {
+	deleted, err := s.otpRepo.DeleteExpired(ctx)
+	if err != nil {
+		return deleted, fmt.Errorf("error deleting expired OTPs: %w", err)
+	}
+	if deleted > 0 {
+		s.logger.Debug("Deleted expired OTPs", "count", deleted)
+	}
+	return deleted, nil
+}
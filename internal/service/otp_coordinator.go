@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// What a request for an OTP over one channel does to an OTP pending on another, see otp.channels.duplicates
+const (
+	OTPDuplicatesReuse      = "reuse"      // the pending OTP is sent over the new channel too, so both deliver the same code
+	OTPDuplicatesInvalidate = "invalidate" // the pending OTPs are deleted and a new one is issued
+)
+
+// OTPCoordinator decides whether an OTP request is answered with a new challenge or with the
+// challenge already pending for the phone number, so codes requested over several channels,
+// e.g. SMS and then email, don't leave the user with different codes that each look valid
+type OTPCoordinator struct {
+	otpRepo repository.OTPRepository
+	config  config.Provider
+}
+
+// NewOTPCoordinator creates a new OTP coordinator
+func NewOTPCoordinator(otpRepo repository.OTPRepository, cfg config.Provider) *OTPCoordinator {
+	return &OTPCoordinator{otpRepo: otpRepo, config: cfg}
+}
+
+// Coordinate returns the pending challenge whose code a request for an OTP over channel is to
+// deliver, or nil if a new challenge is to be issued. Only the latest challenge of the phone
+// number is considered, and only if it was issued over another channel:
+//
+//   - with the reuse policy, it is returned if it was issued to the same client, as challenges
+//     are bound to their client
+//   - with the invalidate policy, all pending challenges of the phone number are deleted
+//
+// Requests over the channel the latest challenge was issued over get a new challenge, as before
+// channels existed.
+func (c *OTPCoordinator) Coordinate(ctx context.Context, phoneNumber, channel, ipAddress, userAgent string) (*models.OTPChallenge, error) {
+	latest, err := c.otpRepo.GetLatestChallenge(ctx, phoneNumber)
+	if err != nil {
+		if err.Error() == "OTP not found or expired" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding pending OTP: %w", err)
+	}
+	if challengeChannel(latest) == channel {
+		return nil, nil
+	}
+
+	if c.config.Current().OTP.Channels.Duplicates == OTPDuplicatesInvalidate {
+		if _, err := c.otpRepo.DeleteChallengesByPhone(ctx, phoneNumber); err != nil {
+			return nil, fmt.Errorf("error invalidating pending OTPs: %w", err)
+		}
+		return nil, nil
+	}
+
+	if latest.IPAddress != ipAddress || latest.UserAgent != userAgent {
+		return nil, nil
+	}
+	return latest, nil
+}
+
+// challengeChannel returns the channel a challenge was issued over; challenges stored before
+// channels existed were sent by SMS
+func challengeChannel(challenge *models.OTPChallenge) string {
+	if challenge.Channel == "" {
+		return models.ChannelSMS
+	}
+	return challenge.Channel
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// phoneListPrefixPattern restricts blocklist and allowlist prefixes to digits with an optional leading plus
+var phoneListPrefixPattern = regexp.MustCompile(`^\+?[0-9]{1,15}$`)
+
+// PhoneListService maintains the phone number blocklist and allowlist and decides
+// which phone numbers may be sent OTPs. Blocked phone numbers never get OTPs; in
+// allowlist-only mode, only phone numbers on the allowlist do.
+type PhoneListService struct {
+	phoneListRepo repository.PhoneListRepository
+	auditService  *AuditService
+	config        *config.Config
+}
+
+// NewPhoneListService creates a new phone list service
+func NewPhoneListService(phoneListRepo repository.PhoneListRepository, auditService *AuditService, cfg *config.Config) *PhoneListService {
+	return &PhoneListService{
+		phoneListRepo: phoneListRepo,
+		auditService:  auditService,
+		config:        cfg,
+	}
+}
+
+// CheckPhoneNumber returns an error if no OTP may be sent to phoneNumber
+func (s *PhoneListService) CheckPhoneNumber(ctx context.Context, phoneNumber string) error {
+	entries, err := s.phoneListRepo.Match(ctx, utils.NormalizePhoneNumber(phoneNumber))
+	if err != nil {
+		return fmt.Errorf("error checking phone lists: %w", err)
+	}
+
+	allowed := !s.config.OTP.AllowlistOnly
+	for _, entry := range entries {
+		switch entry.List {
+		case models.PhoneListBlock:
+			// The blocklist wins over the allowlist
+			return fmt.Errorf("phone number blocked")
+		case models.PhoneListAllow:
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("phone number blocked")
+	}
+	return nil
+}
+
+// Add puts a phone number or prefix on a list on behalf of an admin, reporting whether it was added
+func (s *PhoneListService) Add(ctx context.Context, actor models.AuditActor, list, prefix, reason string) (bool, error) {
+	list, prefix, err := s.parseEntry(list, prefix)
+	if err != nil {
+		return false, err
+	}
+
+	createdBy := actor.ID
+	added, err := s.phoneListRepo.Add(ctx, &models.PhoneListEntry{
+		List:      list,
+		Prefix:    prefix,
+		Reason:    reason,
+		CreatedBy: &createdBy,
+		CreatedAt: time.Now(),
+	})
+	if err != nil || !added {
+		return false, err
+	}
+
+	err = s.auditService.Record(ctx, actor, AuditActionPhoneListAdd, AuditTargetPhonePrefix, prefix, map[string]interface{}{
+		"list":   list,
+		"reason": reason,
+	})
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Remove takes a phone number or prefix off a list on behalf of an admin, reporting whether it was on the list
+func (s *PhoneListService) Remove(ctx context.Context, actor models.AuditActor, list, prefix string) (bool, error) {
+	list, prefix, err := s.parseEntry(list, prefix)
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := s.phoneListRepo.Remove(ctx, list, prefix)
+	if err != nil || !removed {
+		return false, err
+	}
+
+	err = s.auditService.Record(ctx, actor, AuditActionPhoneListRemove, AuditTargetPhonePrefix, prefix, map[string]interface{}{
+		"list": list,
+	})
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// List returns the entries of both lists ordered by list and prefix
+func (s *PhoneListService) List(ctx context.Context) ([]models.PhoneListEntry, error) {
+	entries, err := s.phoneListRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing phone lists: %w", err)
+	}
+	return entries, nil
+}
+
+// parseEntry validates a list and prefix given by an admin, defaulting the list to the blocklist.
+// Prefixes are normalized like phone numbers, so 0912 and 98912 both become +98912.
+func (s *PhoneListService) parseEntry(list, prefix string) (string, string, error) {
+	switch list {
+	case "":
+		list = models.PhoneListBlock
+	case models.PhoneListBlock, models.PhoneListAllow:
+	default:
+		return "", "", fmt.Errorf("invalid list")
+	}
+
+	if !phoneListPrefixPattern.MatchString(prefix) {
+		return "", "", fmt.Errorf("invalid phone prefix")
+	}
+	switch {
+	case strings.HasPrefix(prefix, "+"):
+	case strings.HasPrefix(prefix, "0"):
+		prefix = "+98" + prefix[1:]
+	default:
+		prefix = "+" + prefix
+	}
+	return list, prefix, nil
+}
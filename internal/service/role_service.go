@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// RoleService grants roles to users, e.g. to bootstrap the first admin
+type RoleService struct {
+	unitOfWork repository.UnitOfWork
+}
+
+// NewRoleService creates a new role service
+func NewRoleService(unitOfWork repository.UnitOfWork) *RoleService {
+	return &RoleService{unitOfWork: unitOfWork}
+}
+
+// GrantRole grants role to the user with phoneNumber, creating the user if there is none yet.
+// Created users verify their phone number by OTP on their first sign-in, like imported users.
+// The user is created, given the role and the grant audited in one unit of work, so a failed
+// grant leaves no user without the role behind. It reports whether the user was created.
+func (s *RoleService) GrantRole(ctx context.Context, actor models.AuditActor, phoneNumber, role string) (*models.User, bool, error) {
+	if !utils.IsValidPhoneNumber(phoneNumber) {
+		return nil, false, fmt.Errorf("invalid phone number")
+	}
+	switch role {
+	case models.RoleUser, models.RoleOperator, models.RoleAdmin:
+	default:
+		return nil, false, fmt.Errorf("unknown role %q", role)
+	}
+
+	var user *models.User
+	created := false
+	err := s.unitOfWork.WithTx(ctx, func(repos repository.Repositories) error {
+		var err error
+		user, err = repos.Users.FindByPhoneNumber(ctx, phoneNumber)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("error finding user: %w", err)
+			}
+			if _, err := repos.Users.FindDeletedByPhoneNumber(ctx, phoneNumber); err == nil {
+				return fmt.Errorf("account deleted")
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("error finding deleted user: %w", err)
+			}
+			if user, err = repos.Users.CreateImported(ctx, phoneNumber, false, nil); err != nil {
+				return err
+			}
+			created = true
+		}
+
+		previous := user.Role
+		if previous != role {
+			if err := repos.Users.SetRole(ctx, user.ID, role); err != nil {
+				return err
+			}
+			user.Role = role
+		}
+
+		return NewAuditService(repos.Audit).Record(ctx, actor, AuditActionUserRoleGrant, AuditTargetUser, user.ID.String(), map[string]interface{}{
+			"role":          role,
+			"previous_role": previous,
+			"created":       created,
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, created, nil
+}
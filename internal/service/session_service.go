@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/geo"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// Reasons sessions are revoked, given in sessions.revoked events
+const (
+	sessionRevokedSignedOut = "signed_out"
+	sessionRevokedLimit     = "session_limit"
+)
+
+// ErrCountryConflict is returned when a user with an active session from another country signs
+// in while sessions.countryConflicts is deny
+var ErrCountryConflict = errors.New("session active in another country")
+
+// SessionService handles the sessions users sign in to. Each session issues short-lived
+// access tokens carrying its ID as jti, renewed with a refresh token that is rotated on every use.
+type SessionService struct {
+	sessionRepo repository.SessionRepository
+	userRepo    repository.UserRepository
+	events      *EventService
+	tokens      *TokenSigner
+	config      *config.Config
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(
+	sessionRepo repository.SessionRepository,
+	userRepo repository.UserRepository,
+	events *EventService,
+	tokens *TokenSigner,
+	config *config.Config,
+) *SessionService {
+	return &SessionService{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		events:      events,
+		tokens:      tokens,
+		config:      config,
+	}
+}
+
+// Start starts a session for a user who just signed in and returns its tokens.
+// The session records the country the request came from, if known. The user's oldest
+// sessions beyond the configured maximum are revoked.
+func (s *SessionService) Start(ctx context.Context, user *models.User, ipAddress, userAgent string) (*models.SessionTokens, error) {
+	country := geo.CountryFromContext(ctx)
+	if err := s.checkCountry(ctx, user, country); err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:               uuid.New(),
+		UserID:           user.ID,
+		RefreshTokenHash: hashOpaqueToken(refreshToken),
+		UserAgent:        userAgent,
+		IPAddress:        ipAddress,
+		Country:          country,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(s.config.GetSessionExpiration()),
+	}
+	revoked, err := s.sessionRepo.Create(ctx, session, s.config.Sessions.MaxConcurrent)
+	if err != nil {
+		return nil, fmt.Errorf("error storing session: %w", err)
+	}
+	if err := s.publishRevoked(ctx, user.ID, revoked, sessionRevokedLimit); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.issueAccessToken(ctx, user, session, now)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SessionTokens{
+		SessionID:    session.ID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// checkCountry applies the sessions.countryConflicts policy to a user signing in from country.
+// With notify or deny, signing in while the user has active sessions from other countries
+// publishes a session.country_conflict event; with deny, the sign-in is refused with
+// ErrCountryConflict until those sessions are ended. Sign-ins and sessions from unknown
+// countries never conflict.
+func (s *SessionService) checkCountry(ctx context.Context, user *models.User, country string) error {
+	policy := s.config.GetCountryConflicts()
+	if policy == config.CountryConflictsAllow || country == "" {
+		return nil
+	}
+
+	sessions, err := s.sessionRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error listing sessions: %w", err)
+	}
+	var conflicting []uuid.UUID
+	var countries []string
+	for _, session := range sessions {
+		if session.Country != "" && session.Country != country {
+			conflicting = append(conflicting, session.ID)
+			if !slices.Contains(countries, session.Country) {
+				countries = append(countries, session.Country)
+			}
+		}
+	}
+	if len(conflicting) == 0 {
+		return nil
+	}
+
+	denied := policy == config.CountryConflictsDeny
+	err = s.events.Publish(ctx, models.EventSessionCountryConflict, models.AggregateUser, user.ID.String(), map[string]interface{}{
+		"country":           country,
+		"session_ids":       conflicting,
+		"session_countries": countries,
+		"denied":            denied,
+	})
+	if err != nil {
+		return err
+	}
+	if denied {
+		return ErrCountryConflict
+	}
+	return nil
+}
+
+// Refresh issues a new access token for the session of a refresh token, replacing the
+// refresh token. Unknown, used, expired and revoked refresh tokens, as well as those of
+// deleted users, are all reported as "invalid refresh token".
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string) (*models.SessionTokens, error) {
+	oldHash := hashOpaqueToken(refreshToken)
+	session, err := s.sessionRepo.FindByRefreshTokenHash(ctx, oldHash)
+	if err != nil {
+		if err.Error() == "session not found or expired" {
+			return nil, fmt.Errorf("invalid refresh token")
+		}
+		return nil, fmt.Errorf("error finding session: %w", err)
+	}
+
+	// Access tokens carry the user's current phone number and role
+	user, err := s.userRepo.FindByID(ctx, session.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invalid refresh token")
+		}
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+
+	newRefreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+	now := time.Now()
+	session.RefreshTokenHash = hashOpaqueToken(newRefreshToken)
+	session.LastUsedAt = &now
+
+	// Of concurrent refreshes with the same token only one wins
+	rotated, err := s.sessionRepo.Rotate(ctx, session, oldHash)
+	if err != nil {
+		return nil, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+	if !rotated {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	accessToken, err := s.issueAccessToken(ctx, user, session, now)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SessionTokens{
+		SessionID:    session.ID,
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
+// CheckSession returns "session revoked" unless the session is an unexpired session of the user
+func (s *SessionService) CheckSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	session, err := s.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		if err.Error() == "session not found or expired" {
+			return fmt.Errorf("session revoked")
+		}
+		return fmt.Errorf("error finding session: %w", err)
+	}
+	if session.UserID != userID {
+		return fmt.Errorf("session revoked")
+	}
+	return nil
+}
+
+// ListSessions lists a user's active sessions, newest first, marking the session with ID currentID
+func (s *SessionService) ListSessions(ctx context.Context, userID, currentID uuid.UUID) ([]models.Session, error) {
+	sessions, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeAllSessions revokes all of a user's sessions, signing the user out everywhere,
+// and returns how many were revoked
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int, error) {
+	revoked, err := s.sessionRepo.DeleteAllByUser(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+	if err := s.publishRevoked(ctx, userID, revoked, sessionRevokedSignedOut); err != nil {
+		return 0, err
+	}
+	return len(revoked), nil
+}
+
+// publishRevoked publishes a sessions.revoked event if any sessions were revoked
+func (s *SessionService) publishRevoked(ctx context.Context, userID uuid.UUID, sessionIDs []uuid.UUID, reason string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	return s.events.Publish(ctx, models.EventSessionsRevoked, models.AggregateUser, userID.String(), map[string]interface{}{
+		"session_ids": sessionIDs,
+		"reason":      reason,
+	})
+}
+
+// issueAccessToken generates a JWT access token for a session, expiring no later than the session
+func (s *SessionService) issueAccessToken(ctx context.Context, user *models.User, session *models.Session, now time.Time) (string, error) {
+	expirationTime := now.Add(time.Duration(s.config.JWT.ExpirationHours) * time.Hour)
+	if session.ExpiresAt.Before(expirationTime) {
+		expirationTime = session.ExpiresAt
+	}
+
+	claims := jwt.MapClaims{
+		"jti":          session.ID.String(),
+		"user_id":      user.ID.String(),
+		"phone_number": user.PhoneNumber,
+		"role":         user.Role,
+		"exp":          expirationTime.Unix(),
+	}
+
+	token, err := s.tokens.Sign(ctx, claims)
+	if err != nil {
+		return "", fmt.Errorf("error generating JWT: %w", err)
+	}
+	return token, nil
+}
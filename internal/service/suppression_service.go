@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// MaxSuppressionImportBatchSize is the largest number of entries imported into the suppression list in one batch
+const MaxSuppressionImportBatchSize = 1000
+
+// SuppressionService maintains the suppression list of phone numbers no SMS are sent to.
+// Numbers are added by abuse reports, by SMS provider callbacks for users who replied STOP
+// or numbers the carrier could not deliver to, and by imports from other systems.
+type SuppressionService struct {
+	suppressionRepo repository.SuppressionRepository
+	auditService    *AuditService
+	events          *EventService
+	config          config.Provider
+}
+
+// NewSuppressionService creates a new suppression service
+func NewSuppressionService(
+	suppressionRepo repository.SuppressionRepository,
+	auditService *AuditService,
+	events *EventService,
+	cfg config.Provider,
+) *SuppressionService {
+	return &SuppressionService{
+		suppressionRepo: suppressionRepo,
+		auditService:    auditService,
+		events:          events,
+		config:          cfg,
+	}
+}
+
+// Suppress puts a phone number on the suppression list for a reason, reporting whether it was added
+func (s *SuppressionService) Suppress(ctx context.Context, phoneNumber, reason, source string) (bool, error) {
+	phoneNumber = utils.NormalizePhoneNumber(phoneNumber)
+	added, err := s.suppressionRepo.Add(ctx, &models.Suppression{
+		PhoneNumber: phoneNumber,
+		Reason:      reason,
+		Source:      source,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil || !added {
+		return false, err
+	}
+
+	err = s.events.Publish(ctx, models.EventPhoneSuppressed, models.AggregatePhone, phoneNumber, map[string]interface{}{
+		"reason": reason,
+		"source": source,
+	})
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Unsuppress takes a phone number off the suppression list for a reason, or for every reason
+// if reason is empty, returning how many entries were removed
+func (s *SuppressionService) Unsuppress(ctx context.Context, phoneNumber, reason string) (int64, error) {
+	phoneNumber = utils.NormalizePhoneNumber(phoneNumber)
+	removed, err := s.suppressionRepo.Remove(ctx, phoneNumber, reason)
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+
+	err = s.events.Publish(ctx, models.EventPhoneUnsuppressed, models.AggregatePhone, phoneNumber, map[string]interface{}{
+		"reason": reason,
+	})
+	if err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// HandleProviderCallback suppresses the phone number of a delivery status callback from an SMS
+// provider when the user replied STOP or the carrier reported the number undeliverable.
+// Callbacks are authenticated with the provider's callback token; other statuses are ignored.
+func (s *SuppressionService) HandleProviderCallback(ctx context.Context, providerName, token string, req models.ProviderCallbackRequest) error {
+	provider, ok := s.config.Current().GetSMSProvider(providerName)
+	if !ok || provider.CallbackToken == "" {
+		return fmt.Errorf("unknown provider")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(provider.CallbackToken)) != 1 {
+		return fmt.Errorf("invalid callback token")
+	}
+	if !utils.IsValidPhoneNumber(req.PhoneNumber) {
+		return fmt.Errorf("invalid phone number")
+	}
+
+	var reason string
+	switch req.Status {
+	case models.ProviderCallbackStop:
+		reason = models.SuppressionOptedOut
+	case models.ProviderCallbackUndeliverable:
+		reason = models.SuppressionCarrierBounce
+	default:
+		return nil
+	}
+
+	_, err := s.Suppress(ctx, req.PhoneNumber, reason, provider.Name)
+	return err
+}
+
+// Import adds a batch of entries to the suppression list. Entries that cannot be
+// imported are reported individually without failing the batch.
+func (s *SuppressionService) Import(ctx context.Context, actor models.AuditActor, entries []models.ImportSuppression) (*models.ImportSuppressionsResponse, error) {
+	if len(entries) > MaxSuppressionImportBatchSize {
+		return nil, fmt.Errorf("batch too large")
+	}
+
+	response := &models.ImportSuppressionsResponse{
+		BatchID: uuid.New(),
+		Results: make([]models.SuppressionImportResult, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		result := models.SuppressionImportResult{PhoneNumber: entry.PhoneNumber, Reason: entry.Reason}
+		switch {
+		case !utils.IsValidPhoneNumber(entry.PhoneNumber):
+			result.Error = "invalid phone number"
+		case !validSuppressionReason(entry.Reason):
+			result.Error = "invalid reason"
+		default:
+			added, err := s.Suppress(ctx, entry.PhoneNumber, entry.Reason, models.SuppressionSourceImport)
+			if err != nil {
+				result.Error = "error adding suppression"
+			}
+			result.Added = added
+		}
+
+		switch {
+		case result.Error != "":
+			response.Failed++
+		case result.Added:
+			response.Added++
+		default:
+			response.Skipped++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	err := s.auditService.Record(ctx, actor, AuditActionSuppressionImport, AuditTargetSuppressionImport, response.BatchID.String(), map[string]interface{}{
+		"entries": len(entries),
+		"added":   response.Added,
+		"skipped": response.Skipped,
+		"failed":  response.Failed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Export returns the whole suppression list, oldest first
+func (s *SuppressionService) Export(ctx context.Context) ([]models.Suppression, error) {
+	suppressions, err := s.suppressionRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting suppression list: %w", err)
+	}
+	return suppressions, nil
+}
+
+// Remove takes a phone number off the suppression list for a reason, or for every reason
+// if reason is empty, on behalf of an admin
+func (s *SuppressionService) Remove(ctx context.Context, actor models.AuditActor, phoneNumber, reason string) (int64, error) {
+	if !utils.IsValidPhoneNumber(phoneNumber) {
+		return 0, fmt.Errorf("invalid phone number")
+	}
+	if reason != "" && !validSuppressionReason(reason) {
+		return 0, fmt.Errorf("invalid reason")
+	}
+
+	removed, err := s.Unsuppress(ctx, phoneNumber, reason)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.auditService.Record(ctx, actor, AuditActionSuppressionRemove, AuditTargetPhone, utils.NormalizePhoneNumber(phoneNumber), map[string]interface{}{
+		"reason":  reason,
+		"removed": removed,
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	return removed, nil
+}
+
+// validSuppressionReason reports whether reason is a known suppression reason
+func validSuppressionReason(reason string) bool {
+	switch reason {
+	case models.SuppressionOptedOut, models.SuppressionCarrierBounce, models.SuppressionAbuseReport:
+		return true
+	}
+	return false
+}
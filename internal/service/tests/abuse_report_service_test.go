@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
+
+func newAbuseReportService(t *testing.T) (*service.AbuseReportService, *authDeps, *recordingAuditRepository) {
+	t.Helper()
+
+	cfg := testConfig()
+	deps := newAuthDeps(t, cfg)
+	auditRepo := &recordingAuditRepository{}
+	auditService := service.NewAuditService(auditRepo)
+	eventService := service.NewEventService(deps.eventRepo)
+	abuseReportService := service.NewAbuseReportService(
+		repository.NewInMemoryAbuseReportRepository(),
+		service.NewSuppressionService(deps.suppressionRepo, auditService, eventService, cfg),
+		auditService,
+		eventService,
+	)
+	return abuseReportService, deps, auditRepo
+}
+
+func TestReportSuppressesOTPsToPhoneNumber(t *testing.T) {
+	ctx := context.Background()
+	abuseReportService, deps, _ := newAbuseReportService(t)
+
+	_, err := abuseReportService.Report(ctx, models.AbuseReportRequest{
+		PhoneNumber:  "09121234567",
+		ReporterType: models.AbuseReporterUser,
+	}, testIP)
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	// The same number written in another format must be suppressed too
+	for _, phoneNumber := range []string{"09121234567", "+989121234567", "989121234567"} {
+		_, err := deps.authService.GenerateOTP(ctx, phoneNumber, testIP, testUserAgent)
+		if !errors.Is(err, sms.ErrPhoneSuppressed) {
+			t.Fatalf("GenerateOTP(%s): expected ErrPhoneSuppressed, got %v", phoneNumber, err)
+		}
+	}
+
+	if _, err := deps.authService.GenerateOTP(ctx, "+989127654321", testIP, testUserAgent); err != nil {
+		t.Fatalf("GenerateOTP for an unreported number: %v", err)
+	}
+}
+
+func TestReportRejectsInvalidPhoneNumber(t *testing.T) {
+	abuseReportService, _, _ := newAbuseReportService(t)
+
+	_, err := abuseReportService.Report(context.Background(), models.AbuseReportRequest{
+		PhoneNumber:  "12345",
+		ReporterType: models.AbuseReporterCarrier,
+	}, testIP)
+	if err == nil || err.Error() != "invalid phone number" {
+		t.Fatalf("expected invalid phone number error, got %v", err)
+	}
+}
+
+func TestDismissingReportsLiftsSuppression(t *testing.T) {
+	ctx := context.Background()
+	abuseReportService, deps, auditRepo := newAbuseReportService(t)
+
+	var reports []*models.AbuseReport
+	for _, reporterType := range []string{models.AbuseReporterUser, models.AbuseReporterCarrier} {
+		report, err := abuseReportService.Report(ctx, models.AbuseReportRequest{
+			PhoneNumber:  "+989121234567",
+			ReporterType: reporterType,
+		}, testIP)
+		if err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		reports = append(reports, report)
+	}
+
+	actor := models.AuditActor{ID: uuid.New()}
+	reviewed, err := abuseReportService.ReviewReport(ctx, actor, reports[0].ID, models.AbuseReportDismissed)
+	if err != nil {
+		t.Fatalf("ReviewReport: %v", err)
+	}
+	if reviewed != 2 {
+		t.Fatalf("expected both pending reports to be reviewed, got %d", reviewed)
+	}
+	if len(auditRepo.entries) != 1 || auditRepo.entries[0].Action != service.AuditActionAbuseReview {
+		t.Fatalf("expected one abuse review audit entry, got %+v", auditRepo.entries)
+	}
+
+	if _, err := deps.authService.GenerateOTP(ctx, "+989121234567", testIP, testUserAgent); err != nil {
+		t.Fatalf("GenerateOTP after dismissal: %v", err)
+	}
+
+	pending, total, err := abuseReportService.ListReports(ctx, models.AbuseReportListParams{
+		Status:   models.AbuseReportPending,
+		Page:     1,
+		PageSize: 10,
+	})
+	if err != nil {
+		t.Fatalf("ListReports: %v", err)
+	}
+	if total != 0 || len(pending) != 0 {
+		t.Fatalf("expected no pending reports, got %d", total)
+	}
+}
+
+func TestConfirmedReportKeepsSuppression(t *testing.T) {
+	ctx := context.Background()
+	abuseReportService, deps, _ := newAbuseReportService(t)
+
+	report, err := abuseReportService.Report(ctx, models.AbuseReportRequest{
+		PhoneNumber:  "+989121234567",
+		ReporterType: models.AbuseReporterCarrier,
+	}, testIP)
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if _, err := abuseReportService.ReviewReport(ctx, models.AuditActor{ID: uuid.New()}, report.ID, models.AbuseReportConfirmed); err != nil {
+		t.Fatalf("ReviewReport: %v", err)
+	}
+
+	_, err = deps.authService.GenerateOTP(ctx, "+989121234567", testIP, testUserAgent)
+	if !errors.Is(err, sms.ErrPhoneSuppressed) {
+		t.Fatalf("expected ErrPhoneSuppressed after confirmation, got %v", err)
+	}
+
+	if _, err := abuseReportService.ReviewReport(ctx, models.AuditActor{}, report.ID, "pending"); err == nil || err.Error() != "invalid status" {
+		t.Fatalf("expected invalid status error, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestAccountExportAndDeletion(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.OTP.TrustedDevices.Enabled = true
+	cfg.Admin.RestoreWindow = 720
+	deps := newAuthDeps(t, cfg)
+	auditRepo := &recordingAuditRepository{}
+	accountService := service.NewAccountService(deps.userRepo, auditRepo, deps.eventRepo, deps.loginHistoryRepo, deps.sessions, deps.devices, cfg, logging.Discard())
+
+	user, err := deps.userRepo.Create(ctx, "+989121234567")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	tokens, err := deps.sessions.Start(ctx, user, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := deps.devices.TrustDevice(ctx, user.ID, "laptop", testIP, testUserAgent); err != nil {
+		t.Fatalf("TrustDevice: %v", err)
+	}
+	if err := deps.loginHistoryRepo.Record(ctx, &models.LoginAttempt{ID: uuid.New(), UserID: &user.ID, PhoneNumber: user.PhoneNumber, Method: "otp", Success: true, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	for _, event := range []*models.DomainEvent{
+		{Type: models.EventOTPRequested, AggregateType: models.AggregatePhone, AggregateID: user.PhoneNumber, OccurredAt: time.Now()},
+		// Someone else's event stays out
+		{Type: models.EventOTPRequested, AggregateType: models.AggregatePhone, AggregateID: "+989127654321", OccurredAt: time.Now()},
+	} {
+		if err := deps.eventRepo.Append(ctx, event); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	auditRepo.Create(ctx, &models.AuditLog{Action: service.AuditActionRateLimitFlush, TargetType: service.AuditTargetPhone, TargetID: user.PhoneNumber, CreatedAt: time.Now()})
+
+	export, err := accountService.Export(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if export.User.ID != user.ID || len(export.Logins) != 1 || len(export.Sessions) != 1 || len(export.TrustedDevices) != 1 || len(export.AuditLogs) != 1 {
+		t.Fatalf("expected the user's login, session, device and audit log entry, got %+v", export)
+	}
+	phoneEvents := 0
+	for _, event := range export.Events {
+		if event.AggregateType == models.AggregatePhone {
+			if event.AggregateID != user.PhoneNumber {
+				t.Fatalf("expected only events about %s, got one about %s", user.PhoneNumber, event.AggregateID)
+			}
+			phoneEvents++
+		}
+	}
+	if phoneEvents != 1 {
+		t.Fatalf("expected 1 event about the phone number, got %d", phoneEvents)
+	}
+
+	if err := accountService.DeleteAccount(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	// Signed out everywhere, with no trusted devices left
+	if err := deps.sessions.CheckSession(ctx, user.ID, tokens.SessionID); err == nil {
+		t.Fatal("expected the session to be revoked")
+	}
+	if devices, err := deps.devices.ListDevices(ctx, user.ID); err != nil || len(devices) != 0 {
+		t.Fatalf("expected no trusted devices, got %v (%v)", devices, err)
+	}
+	if _, err := accountService.Export(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected deleted users to have nothing to export, got %v", err)
+	}
+	if err := accountService.DeleteAccount(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected deleting twice to find no user, got %v", err)
+	}
+
+	// Within the restore window the user is kept
+	if purged, err := accountService.Purge(ctx); err != nil || purged != 0 {
+		t.Fatalf("expected nothing purged within the restore window, got %d (%v)", purged, err)
+	}
+	if _, err := deps.userRepo.FindDeletedByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected the user to be restorable: %v", err)
+	}
+
+	cfg.Admin.RestoreWindow = 0
+	if purged, err := accountService.Purge(ctx); err != nil || purged != 1 {
+		t.Fatalf("expected the user purged after the restore window, got %d (%v)", purged, err)
+	}
+	if _, err := deps.userRepo.FindDeletedByID(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the user erased, got %v", err)
+	}
+}
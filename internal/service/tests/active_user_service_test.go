@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// appendSignIn records a sign-in of a user that happened daysAgo days ago
+func appendSignIn(t *testing.T, eventRepo repository.EventRepository, userID uuid.UUID, daysAgo int) {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]interface{}{"user_id": userID, "method": "otp"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	err = eventRepo.Append(context.Background(), &models.DomainEvent{
+		Type:          models.EventOTPVerified,
+		AggregateType: models.AggregatePhone,
+		AggregateID:   "+15550001",
+		Payload:       payload,
+		OccurredAt:    time.Now().UTC().AddDate(0, 0, -daysAgo),
+	})
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+}
+
+func TestActiveUserStats(t *testing.T) {
+	ctx := context.Background()
+	eventRepo := repository.NewInMemoryEventRepository()
+	activeUserRepo := repository.NewInMemoryActiveUserRepository()
+	eventService := service.NewEventService(eventRepo)
+	activeUsers := service.NewActiveUserService(activeUserRepo, eventService, logging.Discard())
+
+	daily, weekly, monthly, stale := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	appendSignIn(t, eventRepo, daily, 0)
+	appendSignIn(t, eventRepo, daily, 3) // counted once per window
+	appendSignIn(t, eventRepo, weekly, 6)
+	appendSignIn(t, eventRepo, monthly, 29)
+	appendSignIn(t, eventRepo, stale, 30)
+	if err := eventService.Publish(ctx, models.EventOTPRequested, models.AggregatePhone, "+15550001", nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	if err := activeUsers.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	stats, err := activeUsers.GetActiveUserStats(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveUserStats: %v", err)
+	}
+	if want := (models.ActiveUserStats{Daily: 1, Weekly: 2, Monthly: 3}); *stats != want {
+		t.Fatalf("expected %+v, got %+v", want, *stats)
+	}
+
+	// Later syncs pick up where the last one stopped
+	if sequence, _ := activeUserRepo.LastSequence(ctx); sequence != 6 {
+		t.Fatalf("expected last sequence 6, got %d", sequence)
+	}
+	appendSignIn(t, eventRepo, weekly, 0)
+	if err := activeUsers.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if stats, _ := activeUsers.GetActiveUserStats(ctx); stats.Daily != 2 || stats.Monthly != 3 {
+		t.Fatalf("expected 2 daily and 3 monthly active users, got %+v", *stats)
+	}
+}
+
+func TestVerifyOTPCountsActiveUser(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+	activeUsers := service.NewActiveUserService(repository.NewInMemoryActiveUserRepository(), service.NewEventService(deps.eventRepo), logging.Discard())
+
+	challengeID := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	if _, _, err := deps.authService.VerifyOTP(ctx, challengeID, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+
+	if err := activeUsers.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	stats, err := service.NewUserService(deps.userRepo, deps.loginHistoryRepo, activeUsers, testConfig()).GetUserStats(ctx)
+	if err != nil {
+		t.Fatalf("GetUserStats: %v", err)
+	}
+	if stats.ActiveUsers == nil || stats.ActiveUsers.Daily != 1 || stats.ActiveUsers.Monthly != 1 {
+		t.Fatalf("expected one active user, got %+v", stats.ActiveUsers)
+	}
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// newAdminService wires an AdminService restoring users deleted up to restoreWindow hours ago
+func newAdminService(t *testing.T, restoreWindow int) (*service.AdminService, *authDeps) {
+	t.Helper()
+
+	cfg := testConfig()
+	cfg.Admin = config.AdminConfig{RestoreWindow: restoreWindow}
+	deps := newAuthDeps(t, cfg)
+	return newAdminServiceWith(deps, deps.unitOfWork, cfg), deps
+}
+
+// newAdminServiceWith wires an AdminService against deps running its units of work on unitOfWork
+func newAdminServiceWith(deps *authDeps, unitOfWork repository.UnitOfWork, cfg *config.Config) *service.AdminService {
+	return service.NewAdminService(deps.userRepo, unitOfWork, deps.otpRepo, nil, nil, nil, deps.deliveries, deps.sessions, service.NewAuditService(deps.auditRepo), cfg)
+}
+
+// auditActions returns the actions of the audit entries about a user, oldest first
+func auditActions(t *testing.T, deps *authDeps, user *models.User) []string {
+	t.Helper()
+
+	entries, _, err := deps.auditRepo.ListByTarget(context.Background(), service.AuditTargetUser, user.ID.String(), 10)
+	if err != nil {
+		t.Fatalf("ListByTarget: %v", err)
+	}
+	actions := make([]string, len(entries))
+	for i, entry := range entries {
+		actions[len(entries)-1-i] = entry.Action
+	}
+	return actions
+}
+
+func TestSoftDeleteAndRestoreUser(t *testing.T) {
+	ctx := context.Background()
+	adminService, deps := newAdminService(t, 24)
+	userService := newUserService(deps.userRepo)
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := userService.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	// Deleting hides the user and keeps them from signing in, but keeps their data
+	if _, err := userService.GetUserByID(ctx, user.ID); err == nil {
+		t.Fatal("expected deleted user to be hidden")
+	}
+	if _, err := deps.userRepo.FindDeletedByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected deleted user to be kept: %v", err)
+	}
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	if _, _, err := deps.authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); err == nil || err.Error() != "account deleted" {
+		t.Fatalf("expected deleted user not to sign in, got %v", err)
+	}
+
+	restored, err := adminService.RestoreUser(ctx, models.AuditActor{}, user.ID)
+	if err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	if restored.ID != user.ID || restored.DeletedAt != nil {
+		t.Fatalf("expected the user restored, got %+v", restored)
+	}
+	if _, err := userService.GetUserByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected restored user to be found: %v", err)
+	}
+	if actions := auditActions(t, deps, user); len(actions) != 1 || actions[0] != service.AuditActionUserRestore {
+		t.Fatalf("expected a user.restore audit entry, got %v", actions)
+	}
+
+	// Only deleted users can be restored
+	if _, err := adminService.RestoreUser(ctx, models.AuditActor{}, user.ID); err == nil || err.Error() != "deleted user not found" {
+		t.Fatalf("expected active user not to be restored, got %v", err)
+	}
+}
+
+func TestRestoreUserWindowExpired(t *testing.T) {
+	ctx := context.Background()
+	// With no restore window, every deleted user is past recovery
+	adminService, deps := newAdminService(t, 0)
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := deps.userRepo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := adminService.RestoreUser(ctx, models.AuditActor{}, user.ID); err == nil || err.Error() != "restore window expired" {
+		t.Fatalf("expected restore window expired, got %v", err)
+	}
+	if _, err := deps.userRepo.FindDeletedByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected user to stay deleted: %v", err)
+	}
+	if actions := auditActions(t, deps, user); len(actions) != 1 || actions[0] != service.AuditActionUserRestoreDenied {
+		t.Fatalf("expected a user.restore_denied audit entry, got %v", actions)
+	}
+}
+
+// unavailableAuditRepository fails to record audit entries, like a repository whose database is down
+type unavailableAuditRepository struct {
+	repository.AuditRepository
+}
+
+func (r unavailableAuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	return errors.New("connection refused")
+}
+
+// unavailableAuditUnitOfWork runs units of work that fail to record audit entries
+type unavailableAuditUnitOfWork struct {
+	repository.UnitOfWork
+}
+
+func (u unavailableAuditUnitOfWork) WithTx(ctx context.Context, fn func(repos repository.Repositories) error) error {
+	return u.UnitOfWork.WithTx(ctx, func(repos repository.Repositories) error {
+		repos.Audit = unavailableAuditRepository{repos.Audit}
+		return fn(repos)
+	})
+}
+
+func TestRestoreUserNotRestoredWhenAuditFails(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.Admin = config.AdminConfig{RestoreWindow: 24}
+	deps := newAuthDeps(t, cfg)
+	adminService := newAdminServiceWith(deps, unavailableAuditUnitOfWork{deps.unitOfWork}, cfg)
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := deps.userRepo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := adminService.RestoreUser(ctx, models.AuditActor{}, user.ID); err == nil {
+		t.Fatal("RestoreUser succeeded while audit entries cannot be recorded")
+	}
+	if _, err := deps.userRepo.FindDeletedByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected user to stay deleted without an audit entry: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestAPIKeyServiceLifecycle(t *testing.T) {
+	auditRepo := &recordingAuditRepository{}
+	apiKeys := service.NewAPIKeyService(repository.NewInMemoryAPIKeyRepository(), service.NewAuditService(auditRepo))
+	ctx := context.Background()
+	admin := models.AuditActor{ID: uuid.New()}
+
+	created, err := apiKeys.Create(ctx, admin, models.CreateAPIKeyRequest{
+		Name:   "billing",
+		Scopes: []string{models.APIKeyScopeUsersRead, models.APIKeyScopeUsersRead},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, created.KeyPrefix) || created.KeyHash == "" || strings.Contains(created.KeyHash, created.Key) {
+		t.Fatalf("unexpected key %q with prefix %q and hash %q", created.Key, created.KeyPrefix, created.KeyHash)
+	}
+	if len(created.Scopes) != 1 || created.CreatedBy == nil || *created.CreatedBy != admin.ID {
+		t.Fatalf("created key = %+v, want one scope created by the admin", created.APIKey)
+	}
+
+	key, err := apiKeys.Authenticate(ctx, created.Key)
+	if err != nil || key.ID != created.ID || key.LastUsedAt == nil {
+		t.Fatalf("Authenticate: %+v, %v", key, err)
+	}
+	if !key.HasScope(models.APIKeyScopeUsersRead) || key.HasScope(models.APIKeyScopeUsersMetadata) {
+		t.Fatalf("scopes = %v, want users:read only", key.Scopes)
+	}
+	for _, rawKey := range []string{"", "otpk_unknown", created.Key[5:]} {
+		if _, err := apiKeys.Authenticate(ctx, rawKey); err == nil || err.Error() != "invalid API key" {
+			t.Fatalf("Authenticate(%q) = %v, want invalid API key", rawKey, err)
+		}
+	}
+
+	if err := apiKeys.Revoke(ctx, admin, created.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := apiKeys.Authenticate(ctx, created.Key); err == nil || err.Error() != "invalid API key" {
+		t.Fatalf("expected a revoked key to be rejected, got %v", err)
+	}
+	if err := apiKeys.Revoke(ctx, admin, created.ID); err == nil || err.Error() != "API key not found" {
+		t.Fatalf("expected revoking a revoked key to report it not found, got %v", err)
+	}
+
+	keys, err := apiKeys.List(ctx)
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Fatalf("List: %+v, %v", keys, err)
+	}
+
+	if len(auditRepo.entries) != 2 || auditRepo.entries[0].Action != service.AuditActionAPIKeyCreate || auditRepo.entries[1].Action != service.AuditActionAPIKeyRevoke {
+		t.Fatalf("audit entries = %+v, want api_key.create and api_key.revoke", auditRepo.entries)
+	}
+	if entry := auditRepo.entries[0]; entry.ActorType != models.AuditActorUser || entry.TargetID != created.ID.String() {
+		t.Fatalf("audit entry = %+v, want the admin acting on the key", entry)
+	}
+}
+
+func TestAuditServiceRecordsAPIKeyActors(t *testing.T) {
+	auditRepo := &recordingAuditRepository{}
+	keyID := uuid.New()
+
+	actor := models.AuditActor{ID: keyID, Type: models.AuditActorAPIKey}
+	if err := service.NewAuditService(auditRepo).Record(context.Background(), actor, service.AuditActionUserMetadataUpdate, service.AuditTargetUser, uuid.NewString(), nil); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	entry := auditRepo.entries[0]
+	if entry.ActorType != models.AuditActorAPIKey || entry.ActorID == nil || *entry.ActorID != keyID {
+		t.Fatalf("audit entry = %+v, want the API key as actor", entry)
+	}
+}
@@ -1,8 +1,505 @@
 package tests
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/ratelimit"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/silentauth"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
 
 func TestDummy(t *testing.T) {
 	// Just a placeholder test
 	//sorry for that :(
 }
+
+// testConfig returns a configuration suitable for service tests
+func testConfig() *config.Config {
+	return &config.Config{
+		JWT: config.JWTConfig{
+			Secret:          "test-secret",
+			ExpirationHours: 1,
+		},
+		OTP: config.OTPConfig{
+			Expiration:     120,
+			Length:         6,
+			ResendCooldown: 60,
+			RateLimit: config.RateLimitConfig{
+				Count: 3,
+				Time:  10,
+			},
+			Lockout: config.LockoutConfig{
+				MaxAttempts: 3,
+				Window:      15,
+				Cooldown:    30,
+			},
+		},
+	}
+}
+
+// newAuthService wires an AuthService against in-memory dependencies
+func newAuthService(t *testing.T, cfg *config.Config) (*service.AuthService, *repository.InMemoryUserRepository, *repository.InMemoryOTPRepository) {
+	t.Helper()
+
+	deps := newAuthDeps(t, cfg)
+	return deps.authService, deps.userRepo, deps.otpRepo
+}
+
+// authDeps is an AuthService together with the in-memory dependencies it was wired against
+type authDeps struct {
+	authService *service.AuthService
+	backupCodes *service.BackupCodeService
+	userRepo    *repository.InMemoryUserRepository
+	otpRepo     *repository.InMemoryOTPRepository
+	eventRepo   *repository.InMemoryEventRepository
+	auditRepo   *repository.InMemoryAuditRepository
+	unitOfWork  *repository.InMemoryUnitOfWork
+
+	suppressionRepo  *repository.InMemorySuppressionRepository
+	loginHistoryRepo *repository.InMemoryLoginHistoryRepository
+	deviceRepo       *repository.InMemoryTrustedDeviceRepository
+	devices          *service.TrustedDeviceService
+	sessionRepo      *repository.InMemorySessionRepository
+	sessions         *service.SessionService
+	phoneListRepo    *repository.InMemoryPhoneListRepository
+	deliveryRepo     *repository.InMemoryOTPDeliveryRepository
+	sendQueueRepo    *repository.InMemoryOTPSendQueueRepository
+	deliveries       *service.DeliveryService
+	emails           *recordingEmailSender
+	calls            *recordingCaller
+	loginStatusRepo  *repository.InMemoryLoginStatusRepository
+	lockRepo         *repository.InMemoryLockRepository
+	hooks            *service.Hooks
+}
+
+// newAuthDeps wires an AuthService against in-memory dependencies
+func newAuthDeps(t *testing.T, cfg *config.Config) *authDeps {
+	t.Helper()
+
+	deps := &authDeps{
+		userRepo:  repository.NewInMemoryUserRepository(),
+		otpRepo:   repository.NewInMemoryOTPRepository(),
+		eventRepo: repository.NewInMemoryEventRepository(),
+	}
+	eventService := service.NewEventService(deps.eventRepo)
+	deps.backupCodes = service.NewBackupCodeService(repository.NewInMemoryBackupCodeRepository(), deps.userRepo, eventService, cfg)
+
+	limiter, err := ratelimit.NewMemoryLimiter(cfg.OTP.RateLimit.Algorithm)
+	if err != nil {
+		t.Fatalf("NewMemoryLimiter: %v", err)
+	}
+	policy := ratelimit.NewPolicy(limiter, cfg.OTP.RateLimit.Count, cfg.GetRateLimitDuration())
+
+	providers, err := sms.NewProviders(cfg.SMS.Providers, logging.Discard())
+	if err != nil {
+		t.Fatalf("NewProviders: %v", err)
+	}
+	deps.suppressionRepo = repository.NewInMemorySuppressionRepository()
+	sender := sms.NewSender(providers, repository.NewInMemoryProviderStateRepository(), deps.suppressionRepo, cfg.SMS.Failover, logging.Discard())
+
+	deps.loginHistoryRepo = repository.NewInMemoryLoginHistoryRepository()
+	deps.auditRepo = repository.NewInMemoryAuditRepository()
+	deps.unitOfWork = repository.NewInMemoryUnitOfWork(deps.userRepo, deps.auditRepo, deps.eventRepo, deps.loginHistoryRepo)
+	deps.deviceRepo = repository.NewInMemoryTrustedDeviceRepository()
+	deps.devices = service.NewTrustedDeviceService(deps.deviceRepo, eventService, cfg)
+	deps.sessionRepo = repository.NewInMemorySessionRepository()
+	deps.sessions = service.NewSessionService(deps.sessionRepo, deps.userRepo, eventService, service.NewTokenSigner(cfg, nil), cfg)
+	deps.phoneListRepo = repository.NewInMemoryPhoneListRepository()
+	phoneLists := service.NewPhoneListService(deps.phoneListRepo, service.NewAuditService(&recordingAuditRepository{}), cfg)
+	deps.deliveryRepo = repository.NewInMemoryOTPDeliveryRepository()
+	deps.sendQueueRepo = repository.NewInMemoryOTPSendQueueRepository()
+	deps.deliveries = service.NewDeliveryService(deps.deliveryRepo, deps.sendQueueRepo, deps.otpRepo, sender, metrics.NewRegistry(), cfg, logging.Discard())
+	deps.emails = &recordingEmailSender{}
+	deps.calls = &recordingCaller{}
+	deps.loginStatusRepo = repository.NewInMemoryLoginStatusRepository()
+	deps.lockRepo = repository.NewInMemoryLockRepository()
+	deps.hooks = service.NewHooks(logging.Discard())
+	deps.authService = service.NewAuthService(deps.userRepo, deps.otpRepo, deps.loginHistoryRepo, deps.unitOfWork, deps.backupCodes, deps.devices, deps.sessions, phoneLists, eventService, policy, deps.deliveries, deps.emails, deps.calls, silentauth.NewVerifier(cfg.SilentAuth), deps.loginStatusRepo, deps.lockRepo, deps.hooks, cfg)
+	return deps
+}
+
+// Client the challenges in tests are issued to
+const (
+	testIP        = "203.0.113.1"
+	testUserAgent = "otp-test"
+)
+
+// storeChallenge stores a pending challenge for testIP and testUserAgent and returns its ID
+func storeChallenge(t *testing.T, otpRepo *repository.InMemoryOTPRepository, id, phoneNumber, code string) string {
+	t.Helper()
+
+	challenge := &models.OTPChallenge{
+		ID:          id,
+		PhoneNumber: phoneNumber,
+		Code:        code,
+		IPAddress:   testIP,
+		UserAgent:   testUserAgent,
+	}
+	if err := otpRepo.StoreChallenge(context.Background(), challenge, time.Minute); err != nil {
+		t.Fatalf("StoreChallenge: %v", err)
+	}
+	return id
+}
+
+func TestGenerateOTPStoresChallenge(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+
+	challenge, err := authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	if len(challenge.Code) != 6 {
+		t.Fatalf("expected 6 digit OTP, got %q", challenge.Code)
+	}
+	if remaining := time.Until(challenge.ExpiresAt); remaining <= 118*time.Second || remaining > 120*time.Second {
+		t.Fatalf("expected the challenge to expire in 2 minutes, got %v", remaining)
+	}
+
+	stored, err := otpRepo.GetChallenge(ctx, challenge.ID)
+	if err != nil || *stored != *challenge {
+		t.Fatalf("expected stored challenge %+v, got %+v (%v)", challenge, stored, err)
+	}
+
+	// Interleaved requests get their own challenges
+	other, err := authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	if other.ID == challenge.ID {
+		t.Fatal("expected a new challenge ID")
+	}
+	if _, err := otpRepo.GetChallenge(ctx, challenge.ID); err != nil {
+		t.Fatalf("expected first challenge to remain pending: %v", err)
+	}
+}
+
+func TestGenerateOTPReadsCurrentConfig(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	authService, _, _ := newAuthService(t, cfg)
+
+	// A *Config is its own provider, so changing it stands in for a reload
+	cfg.OTP.Length = 8
+	challenge, err := authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	if len(challenge.Code) != 8 {
+		t.Fatalf("expected reloaded 8 digit OTP, got %q", challenge.Code)
+	}
+}
+
+func TestGenerateOTPRateLimit(t *testing.T) {
+	ctx := context.Background()
+	authService, _, _ := newAuthService(t, testConfig())
+
+	for i := 0; i < 3; i++ {
+		if _, err := authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent); err != nil {
+			t.Fatalf("GenerateOTP %d: %v", i+1, err)
+		}
+	}
+
+	_, err := authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err == nil || err.Error() != "rate limit exceeded" {
+		t.Fatalf("expected rate limit exceeded, got %v", err)
+	}
+
+	// Other phone numbers are unaffected
+	if _, err := authService.GenerateOTP(ctx, "+15550002", testIP, testUserAgent); err != nil {
+		t.Fatalf("GenerateOTP for other phone: %v", err)
+	}
+}
+
+func TestResendOTPCooldown(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+
+	challenge, err := authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+
+	// The request itself starts the cooldown
+	err = authService.ResendOTP(ctx, challenge.ID, testIP, testUserAgent)
+	var cooldownErr *service.ResendCooldownError
+	if !errors.As(err, &cooldownErr) {
+		t.Fatalf("expected ResendCooldownError, got %v", err)
+	}
+	if cooldownErr.RetryAfter <= 0 || cooldownErr.RetryAfter > time.Minute {
+		t.Fatalf("unexpected retry after %v", cooldownErr.RetryAfter)
+	}
+
+	// Once the cooldown is over the pending OTP can be resent
+	id := storeChallenge(t, otpRepo, "challenge-2", "+15550002", "123456")
+	if err := authService.ResendOTP(ctx, id, testIP, testUserAgent); err != nil {
+		t.Fatalf("ResendOTP: %v", err)
+	}
+	if err := authService.ResendOTP(ctx, id, testIP, testUserAgent); !errors.As(err, &cooldownErr) {
+		t.Fatalf("expected second resend to hit the cooldown, got %v", err)
+	}
+}
+
+func TestResendOTPNoPendingOTP(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+
+	err := authService.ResendOTP(ctx, "unknown", testIP, testUserAgent)
+	if err == nil || err.Error() != "no pending OTP" {
+		t.Fatalf("expected no pending OTP, got %v", err)
+	}
+
+	// Challenges cannot be resent from another client
+	id := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+	err = authService.ResendOTP(ctx, id, "198.51.100.1", testUserAgent)
+	if err == nil || err.Error() != "no pending OTP" {
+		t.Fatalf("expected no pending OTP for another client, got %v", err)
+	}
+}
+
+func TestVerifyOTPCreatesUser(t *testing.T) {
+	ctx := context.Background()
+	authService, userRepo, otpRepo := newAuthService(t, testConfig())
+
+	challenge, err := authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+
+	tokens, user, err := authService.VerifyOTP(ctx, challenge.ID, challenge.Code, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatal("expected a token and a refresh token")
+	}
+	if _, err := userRepo.FindByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected user to be created: %v", err)
+	}
+
+	// Challenges are single use
+	_, _, err = authService.VerifyOTP(ctx, challenge.ID, challenge.Code, testIP, testUserAgent)
+	if err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected used challenge to be invalid, got %v", err)
+	}
+
+	// Signing in again returns the same user
+	id := storeChallenge(t, otpRepo, "challenge-2", "+15550001", "123456")
+	_, again, err := authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Fatalf("expected existing user %s, got %s", user.ID, again.ID)
+	}
+}
+
+func TestVerifyOTPInvalidCode(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+
+	id := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+
+	_, _, err := authService.VerifyOTP(ctx, id, "654321", testIP, testUserAgent)
+	if err == nil || err.Error() != "invalid OTP" {
+		t.Fatalf("expected invalid OTP, got %v", err)
+	}
+	// Clients are told when the challenge they can still retry expires
+	challenge, err := authService.GenerateOTP(ctx, "+15550002", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	_, _, err = authService.VerifyOTP(ctx, challenge.ID, "000000", testIP, testUserAgent)
+	var invalidErr *service.InvalidOTPError
+	if !errors.As(err, &invalidErr) || !invalidErr.ExpiresAt.Equal(challenge.ExpiresAt) {
+		t.Fatalf("expected an InvalidOTPError expiring at %v, got %v", challenge.ExpiresAt, err)
+	}
+}
+
+func TestVerifyOTPConcurrentRetries(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+
+	challenge, err := deps.authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+
+	// Retries of the same verification create one user and start one session
+	const retries = 5
+	var wg sync.WaitGroup
+	errs := make([]error, retries)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, errs[i] = deps.authService.VerifyOTP(ctx, challenge.ID, challenge.Code, testIP, testUserAgent)
+		}()
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else if err.Error() != "invalid challenge" {
+			t.Fatalf("expected retries to find the challenge used, got %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected one verification to succeed, got %d", succeeded)
+	}
+	user, err := deps.userRepo.FindByPhoneNumber(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("FindByPhoneNumber: %v", err)
+	}
+	sessions, err := deps.sessionRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected one session, got %d", len(sessions))
+	}
+}
+
+func TestVerifyOTPLockHeld(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.OTP.VerifyLock = config.VerifyLockConfig{TTL: 10, Wait: 100}
+	deps := newAuthDeps(t, cfg)
+
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	token, err := deps.lockRepo.AcquireLock(ctx, "verify:+15550001", time.Minute)
+	if err != nil || token == "" {
+		t.Fatalf("AcquireLock: %q, %v", token, err)
+	}
+
+	// A verification gives up once the lock has been held for longer than the wait
+	_, _, err = deps.authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	if !errors.Is(err, service.ErrVerificationInProgress) {
+		t.Fatalf("expected ErrVerificationInProgress, got %v", err)
+	}
+
+	// and succeeds once it is released
+	if err := deps.lockRepo.ReleaseLock(ctx, "verify:+15550001", token); err != nil {
+		t.Fatalf("ReleaseLock: %v", err)
+	}
+	if _, _, err := deps.authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+}
+
+func TestVerifyOTPBoundToClient(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+
+	id := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+
+	_, _, err := authService.VerifyOTP(ctx, id, "123456", "198.51.100.1", testUserAgent)
+	if err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected invalid challenge for another IP address, got %v", err)
+	}
+	_, _, err = authService.VerifyOTP(ctx, id, "123456", testIP, "other-agent")
+	if err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected invalid challenge for another user agent, got %v", err)
+	}
+
+	// The issuing client can still use it
+	if _, _, err := authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+}
+
+func TestVerifyOTPDeletedAccount(t *testing.T) {
+	ctx := context.Background()
+	authService, userRepo, otpRepo := newAuthService(t, testConfig())
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := userRepo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	id := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+
+	_, _, err = authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	if err == nil || err.Error() != "account deleted" {
+		t.Fatalf("expected account deleted, got %v", err)
+	}
+}
+
+func TestVerifyOTPLockout(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+
+	id := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+	other := storeChallenge(t, otpRepo, "challenge-2", "+15550001", "654321")
+
+	for i := 0; i < 2; i++ {
+		_, _, err := authService.VerifyOTP(ctx, id, "000000", testIP, testUserAgent)
+		if err == nil || err.Error() != "invalid OTP" {
+			t.Fatalf("attempt %d: expected invalid OTP, got %v", i+1, err)
+		}
+	}
+
+	// The third failure locks the phone number out, counting failures across its challenges
+	_, _, err := authService.VerifyOTP(ctx, other, "000000", testIP, testUserAgent)
+	var lockoutErr *service.LockoutError
+	if !errors.As(err, &lockoutErr) {
+		t.Fatalf("expected lockout error, got %v", err)
+	}
+	if lockoutErr.RetryAfter != 30*time.Minute {
+		t.Fatalf("expected retry after 30m, got %v", lockoutErr.RetryAfter)
+	}
+
+	// All pending challenges of the phone number are gone
+	for _, challengeID := range []string{id, other} {
+		if _, err := otpRepo.GetChallenge(ctx, challengeID); err == nil {
+			t.Fatalf("expected challenge %s to be deleted on lockout", challengeID)
+		}
+	}
+
+	// Even the right code of a new challenge is refused while locked out
+	id = storeChallenge(t, otpRepo, "challenge-3", "+15550001", "123456")
+	_, _, err = authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	if !errors.As(err, &lockoutErr) {
+		t.Fatalf("expected lockout error for correct code, got %v", err)
+	}
+
+	lockout, err := otpRepo.GetLockout(ctx, "+15550001")
+	if err != nil || !lockout.Locked {
+		t.Fatalf("expected phone number to be locked: %+v, %v", lockout, err)
+	}
+}
+
+func TestVerifyOTPSuccessResetsFailures(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+
+	id := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+	for i := 0; i < 2; i++ {
+		authService.VerifyOTP(ctx, id, "000000", testIP, testUserAgent)
+	}
+	if _, _, err := authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+
+	lockout, err := otpRepo.GetLockout(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("GetLockout: %v", err)
+	}
+	if lockout.FailedAttempts != 0 {
+		t.Fatalf("expected failures to be cleared, got %d", lockout.FailedAttempts)
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestGenerateBackupCodes(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+	backupCodes, userRepo := deps.backupCodes, deps.userRepo
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	codes, err := backupCodes.GenerateBackupCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GenerateBackupCodes: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(strings.ReplaceAll(code, "-", "")) != 10 {
+			t.Fatalf("expected 10 character code, got %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	if _, err := backupCodes.GenerateBackupCodes(ctx, uuid.New()); err == nil || err.Error() != "user not found" {
+		t.Fatalf("expected user not found, got %v", err)
+	}
+}
+
+func TestVerifyBackupCode(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+	authService, backupCodes, userRepo, otpRepo := deps.authService, deps.backupCodes, deps.userRepo, deps.otpRepo
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	codes, err := backupCodes.GenerateBackupCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GenerateBackupCodes: %v", err)
+	}
+
+	// Codes are accepted regardless of case and separator
+	challengeID := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+	tokens, verified, err := authService.VerifyBackupCode(ctx, challengeID, strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")), testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("VerifyBackupCode: %v", err)
+	}
+	if tokens.AccessToken == "" || verified.ID != user.ID {
+		t.Fatalf("expected token for user %s, got %q for %+v", user.ID, tokens.AccessToken, verified)
+	}
+	if _, err := otpRepo.GetChallenge(ctx, challengeID); err == nil {
+		t.Fatal("expected challenge to be deleted")
+	}
+
+	// Each code works only once
+	challengeID = storeChallenge(t, otpRepo, "challenge-2", "+15550001", "123456")
+	if _, _, err := authService.VerifyBackupCode(ctx, challengeID, codes[0], testIP, testUserAgent); err == nil || err.Error() != "invalid OTP" {
+		t.Fatalf("expected invalid OTP for reused code, got %v", err)
+	}
+	if _, _, err := authService.VerifyBackupCode(ctx, challengeID, codes[1], testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyBackupCode with unused code: %v", err)
+	}
+
+	// Generating a new set invalidates the earlier one
+	if _, err := backupCodes.GenerateBackupCodes(ctx, user.ID); err != nil {
+		t.Fatalf("GenerateBackupCodes: %v", err)
+	}
+	challengeID = storeChallenge(t, otpRepo, "challenge-3", "+15550001", "123456")
+	if _, _, err := authService.VerifyBackupCode(ctx, challengeID, codes[2], testIP, testUserAgent); err == nil || err.Error() != "invalid OTP" {
+		t.Fatalf("expected invalid OTP for replaced code, got %v", err)
+	}
+}
+
+func TestVerifyBackupCodeUnknownUser(t *testing.T) {
+	ctx := context.Background()
+	authService, userRepo, otpRepo := newAuthService(t, testConfig())
+
+	// Backup codes never create users
+	challengeID := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+	if _, _, err := authService.VerifyBackupCode(ctx, challengeID, "abcde-fghjk", testIP, testUserAgent); err == nil || err.Error() != "invalid OTP" {
+		t.Fatalf("expected invalid OTP, got %v", err)
+	}
+	if _, err := userRepo.FindByPhoneNumber(ctx, "+15550001"); err == nil {
+		t.Fatal("expected no user to be created")
+	}
+}
+
+func TestVerifyBackupCodeLockout(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+	authService, backupCodes, userRepo, otpRepo := deps.authService, deps.backupCodes, deps.userRepo, deps.otpRepo
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	codes, err := backupCodes.GenerateBackupCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GenerateBackupCodes: %v", err)
+	}
+
+	// Wrong backup codes count towards the lockout like wrong OTPs
+	challengeID := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+	for i := 0; i < 2; i++ {
+		if _, _, err := authService.VerifyBackupCode(ctx, challengeID, "abcde-fghjk", testIP, testUserAgent); err == nil || err.Error() != "invalid OTP" {
+			t.Fatalf("attempt %d: expected invalid OTP, got %v", i+1, err)
+		}
+	}
+	_, _, err = authService.VerifyOTP(ctx, challengeID, "000000", testIP, testUserAgent)
+	var lockoutErr *service.LockoutError
+	if !errors.As(err, &lockoutErr) {
+		t.Fatalf("expected lockout, got %v", err)
+	}
+
+	// A valid code is not consumed while locked out
+	challengeID = storeChallenge(t, otpRepo, "challenge-2", "+15550001", "123456")
+	if _, _, err := authService.VerifyBackupCode(ctx, challengeID, codes[0], testIP, testUserAgent); !errors.As(err, &lockoutErr) {
+		t.Fatalf("expected lockout, got %v", err)
+	}
+	if err := otpRepo.ClearFailedVerifications(ctx, "+15550001"); err != nil {
+		t.Fatalf("ClearFailedVerifications: %v", err)
+	}
+	if _, _, err := authService.VerifyBackupCode(ctx, challengeID, codes[0], testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyBackupCode after lockout: %v", err)
+	}
+}
@@ -0,0 +1,477 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/sms"
+	"github.com/lilokie/otp-auth/internal/tenant"
+)
+
+func newDeliveryDeps(t *testing.T) *authDeps {
+	t.Helper()
+
+	cfg := testConfig()
+	cfg.SMS.Providers = []config.SMSProviderConfig{
+		{Name: "primary", Type: sms.ProviderTypeLog, CallbackToken: "primary-token"},
+	}
+	return newAuthDeps(t, cfg)
+}
+
+func TestDeliveryReceiptUpdatesOTPStatus(t *testing.T) {
+	ctx := context.Background()
+	deps := newDeliveryDeps(t)
+
+	challenge, err := deps.authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	delivery, err := deps.authService.OTPStatus(ctx, challenge.ID, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("OTPStatus: %v", err)
+	}
+	if delivery.Status != models.DeliverySent || delivery.Provider != "primary" || delivery.MessageID == "" {
+		t.Fatalf("expected a sent OTP awaiting its receipt, got %+v", delivery)
+	}
+
+	// Intermediate statuses are acknowledged without changing the status
+	receipt := models.DeliveryReceiptRequest{MessageID: delivery.MessageID, Status: "queued"}
+	if err := deps.deliveries.HandleDeliveryReceipt(ctx, "primary", "primary-token", receipt); err != nil {
+		t.Fatalf("HandleDeliveryReceipt: %v", err)
+	}
+	receipt.Status = models.DeliveryDelivered
+	if err := deps.deliveries.HandleDeliveryReceipt(ctx, "primary", "primary-token", receipt); err != nil {
+		t.Fatalf("HandleDeliveryReceipt: %v", err)
+	}
+	delivery, err = deps.authService.OTPStatus(ctx, challenge.ID, testIP, testUserAgent)
+	if err != nil || delivery.Status != models.DeliveryDelivered {
+		t.Fatalf("expected the OTP to be delivered, got %+v (%v)", delivery, err)
+	}
+
+	// A final status isn't overwritten by later receipts
+	receipt.Status = models.DeliveryFailed
+	if err := deps.deliveries.HandleDeliveryReceipt(ctx, "primary", "primary-token", receipt); err != nil {
+		t.Fatalf("HandleDeliveryReceipt: %v", err)
+	}
+	if delivery, _ := deps.deliveryRepo.Get(ctx, challenge.ID); delivery.Status != models.DeliveryDelivered {
+		t.Fatalf("expected the delivered status to stick, got %q", delivery.Status)
+	}
+}
+
+func TestDeliveryReceiptForSupersededSendIgnored(t *testing.T) {
+	ctx := context.Background()
+	deps := newDeliveryDeps(t)
+
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	challenge, err := deps.otpRepo.GetChallenge(ctx, id)
+	if err != nil {
+		t.Fatalf("GetChallenge: %v", err)
+	}
+	if err := deps.deliveries.SendOTP(ctx, challenge); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+	first, _ := deps.deliveryRepo.Get(ctx, id)
+
+	// Resending replaces the status; a late receipt for the first send doesn't touch it
+	if err := deps.authService.ResendOTP(ctx, id, testIP, testUserAgent); err != nil {
+		t.Fatalf("ResendOTP: %v", err)
+	}
+	receipt := models.DeliveryReceiptRequest{MessageID: first.MessageID, Status: models.DeliveryFailed}
+	if err := deps.deliveries.HandleDeliveryReceipt(ctx, "primary", "primary-token", receipt); err != nil {
+		t.Fatalf("HandleDeliveryReceipt: %v", err)
+	}
+
+	latest, err := deps.authService.OTPStatus(ctx, id, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("OTPStatus: %v", err)
+	}
+	if latest.MessageID == first.MessageID || latest.Status != models.DeliverySent {
+		t.Fatalf("expected the resend to be awaiting its receipt, got %+v", latest)
+	}
+}
+
+func TestDeliveryReceiptAuthentication(t *testing.T) {
+	ctx := context.Background()
+	deps := newDeliveryDeps(t)
+	receipt := models.DeliveryReceiptRequest{MessageID: "message-1", Status: models.DeliveryDelivered}
+
+	if err := deps.deliveries.HandleDeliveryReceipt(ctx, "unknown", "primary-token", receipt); err == nil || err.Error() != "unknown provider" {
+		t.Fatalf("expected unknown provider, got %v", err)
+	}
+	if err := deps.deliveries.HandleDeliveryReceipt(ctx, "primary", "wrong-token", receipt); err == nil || err.Error() != "invalid callback token" {
+		t.Fatalf("expected invalid callback token, got %v", err)
+	}
+	// Receipts for messages that aren't tracked are acknowledged
+	if err := deps.deliveries.HandleDeliveryReceipt(ctx, "primary", "primary-token", receipt); err != nil {
+		t.Fatalf("expected a receipt for an unknown message to be ignored, got %v", err)
+	}
+}
+
+func TestOTPStatusBoundToClient(t *testing.T) {
+	ctx := context.Background()
+	deps := newDeliveryDeps(t)
+
+	challenge, err := deps.authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	if _, err := deps.authService.OTPStatus(ctx, challenge.ID, "198.51.100.1", testUserAgent); err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected invalid challenge for another client, got %v", err)
+	}
+
+	// Challenges that were never sent have no status
+	id := storeChallenge(t, deps.otpRepo, "challenge-2", "+15550002", "123456")
+	if _, err := deps.authService.OTPStatus(ctx, id, testIP, testUserAgent); err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected invalid challenge without a send, got %v", err)
+	}
+}
+
+// failingProvider is an SMS provider whose sends always fail
+type failingProvider struct{}
+
+func (failingProvider) Name() string { return "primary" }
+
+func (failingProvider) SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error) {
+	return "", errors.New("provider unavailable")
+}
+
+// blockingProvider is an SMS provider whose sends wait to be released, ignoring cancellation
+type blockingProvider struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (blockingProvider) Name() string { return "primary" }
+
+func (p blockingProvider) SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return "message-1", nil
+}
+
+// newFailingDeliveries returns a delivery service sharing deps' repositories whose sends always fail
+func newFailingDeliveries(deps *authDeps, cfg *config.Config) *service.DeliveryService {
+	return newDeliveriesWith(deps, cfg, failingProvider{})
+}
+
+// newDeliveriesWith returns a delivery service sharing deps' repositories that sends through provider
+func newDeliveriesWith(deps *authDeps, cfg *config.Config, provider sms.Provider) *service.DeliveryService {
+	sender := sms.NewSender([]sms.Provider{provider}, repository.NewInMemoryProviderStateRepository(),
+		repository.NewInMemorySuppressionRepository(), cfg.SMS.Failover, logging.Discard())
+	return service.NewDeliveryService(deps.deliveryRepo, deps.sendQueueRepo, deps.otpRepo, sender,
+		metrics.NewRegistry(), cfg, logging.Discard())
+}
+
+func TestQueuedOTPSentInBackground(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.SMS.Queue.Enabled = true
+	deps := newAuthDeps(t, cfg)
+
+	challenge, err := deps.authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	if delivery, _ := deps.deliveryRepo.Get(ctx, challenge.ID); delivery == nil || delivery.Status != models.DeliveryQueued {
+		t.Fatalf("expected the OTP to be queued, got %+v", delivery)
+	}
+
+	processed, err := deps.deliveries.ProcessNext(ctx)
+	if err != nil || !processed {
+		t.Fatalf("expected the queued OTP to be sent, got %v (%v)", processed, err)
+	}
+	delivery, _ := deps.deliveryRepo.Get(ctx, challenge.ID)
+	if delivery.Status != models.DeliverySent || delivery.MessageID == "" {
+		t.Fatalf("expected a sent OTP awaiting its receipt, got %+v", delivery)
+	}
+	if length, _ := deps.sendQueueRepo.Length(ctx); length != 0 {
+		t.Fatalf("expected an empty queue, got %d", length)
+	}
+}
+
+func TestSendQueueFull(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.SMS.Queue.Enabled = true
+	cfg.SMS.Queue.MaxLength = 1
+	deps := newAuthDeps(t, cfg)
+
+	for i, id := range []string{"challenge-1", "challenge-2"} {
+		storeChallenge(t, deps.otpRepo, id, "+15550001", "123456")
+		challenge, _ := deps.otpRepo.GetChallenge(ctx, id)
+		err := deps.deliveries.SendOTP(ctx, challenge)
+		if i == 0 && err != nil {
+			t.Fatalf("SendOTP: %v", err)
+		}
+		if i == 1 && !errors.Is(err, service.ErrSendQueueFull) {
+			t.Fatalf("expected ErrSendQueueFull, got %v", err)
+		}
+	}
+}
+
+func TestOTPRequestsQueuedWhileSendQueueFull(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.SMS.Queue.Enabled = true
+	cfg.SMS.Queue.MaxLength = 1
+	cfg.SMS.Overflow = config.SMSOverflowConfig{Enabled: true, MaxLength: 1, DrainRate: 1}
+	deps := newAuthDeps(t, cfg)
+
+	// The first OTP fits in the send queue, the second in the overflow
+	for i, wantDelay := range []time.Duration{0, 2 * time.Second} {
+		challenge, err := deps.authService.GenerateOTP(ctx, fmt.Sprintf("+1555000%d", i), testIP, testUserAgent)
+		if err != nil {
+			t.Fatalf("GenerateOTP %d: %v", i+1, err)
+		}
+		if challenge.SendDelay != wantDelay {
+			t.Errorf("OTP %d: SendDelay = %v, want %v", i+1, challenge.SendDelay, wantDelay)
+		}
+	}
+
+	_, err := deps.authService.GenerateOTP(ctx, "+15550009", testIP, testUserAgent)
+	if !errors.Is(err, service.ErrSendQueueFull) {
+		t.Fatalf("expected ErrSendQueueFull once the overflow is full, got %v", err)
+	}
+}
+
+// throttledProvider is an SMS provider whose send queue is always full
+type throttledProvider struct{}
+
+func (throttledProvider) Name() string { return "primary" }
+
+func (throttledProvider) SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error) {
+	return "", sms.ErrProviderThrottled
+}
+
+func TestOTPQueuedWhileProvidersThrottled(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.SMS.Providers = []config.SMSProviderConfig{{Name: "primary", Type: sms.ProviderTypeLog, RateLimit: 0.5}}
+	deps := newAuthDeps(t, cfg)
+	storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	challenge, _ := deps.otpRepo.GetChallenge(ctx, "challenge-1")
+
+	deliveries := newDeliveriesWith(deps, cfg, throttledProvider{})
+	if _, err := deliveries.SendOTPOrDefer(ctx, challenge); !errors.Is(err, sms.ErrProviderThrottled) {
+		t.Fatalf("expected ErrProviderThrottled without the overflow, got %v", err)
+	}
+
+	cfg.SMS.Overflow.Enabled = true
+	delay, err := deliveries.SendOTPOrDefer(ctx, challenge)
+	if err != nil {
+		t.Fatalf("SendOTPOrDefer: %v", err)
+	}
+	// One OTP queued at the provider's half a message per second
+	if delay != 2*time.Second {
+		t.Errorf("delay = %v, want 2s", delay)
+	}
+	if delivery, _ := deps.deliveryRepo.Get(ctx, challenge.ID); delivery == nil || delivery.Status != models.DeliveryQueued {
+		t.Fatalf("expected the OTP to be queued, got %+v", delivery)
+	}
+	if length, _ := deps.sendQueueRepo.Length(ctx); length != 1 {
+		t.Fatalf("queue length = %d, want 1", length)
+	}
+}
+
+func TestOTPNotQueuedPastExpiry(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.SMS.Providers = []config.SMSProviderConfig{{Name: "primary", Type: sms.ProviderTypeLog, RateLimit: 0.5}}
+	cfg.SMS.Overflow.Enabled = true
+	deps := newAuthDeps(t, cfg)
+	storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	challenge, _ := deps.otpRepo.GetChallenge(ctx, "challenge-1")
+
+	// At half a message per second the OTP would only be sent after it expired
+	challenge.ExpiresAt = time.Now().Add(time.Second)
+	deliveries := newDeliveriesWith(deps, cfg, throttledProvider{})
+	_, err := deliveries.SendOTPOrDefer(ctx, challenge)
+	var backlogErr *service.SendBacklogError
+	if !errors.As(err, &backlogErr) {
+		t.Fatalf("expected a SendBacklogError, got %v", err)
+	}
+	// The queue needs 2s to drain, of which the OTP lasts 1s
+	if backlogErr.RetryAfter < time.Second || backlogErr.RetryAfter > 2*time.Second {
+		t.Errorf("RetryAfter = %v, want about 1s", backlogErr.RetryAfter)
+	}
+	if length, _ := deps.sendQueueRepo.Length(ctx); length != 0 {
+		t.Fatalf("queue length = %d, want 0", length)
+	}
+	if delivery, _ := deps.deliveryRepo.Get(ctx, challenge.ID); delivery == nil || delivery.Status != models.DeliveryFailed {
+		t.Fatalf("expected the OTP to have failed, got %+v", delivery)
+	}
+
+	// With time to spare it is queued
+	challenge.ExpiresAt = time.Now().Add(time.Minute)
+	if delay, err := deliveries.SendOTPOrDefer(ctx, challenge); err != nil || delay != 2*time.Second {
+		t.Fatalf("expected the OTP to be queued for 2s, got %v (%v)", delay, err)
+	}
+}
+
+func TestOverflowPolicyPerTenant(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.SMS.Providers = []config.SMSProviderConfig{{Name: "primary", Type: sms.ProviderTypeLog, RateLimit: 1}}
+	cfg.SMS.Overflow.Tenants = map[string]config.SMSOverflowTenantConfig{
+		"shop": {Enabled: true, MaxLength: 1},
+		"bank": {Enabled: true},
+	}
+	deps := newAuthDeps(t, cfg)
+	deliveries := newDeliveriesWith(deps, cfg, throttledProvider{})
+	challenge := func(id string) *models.OTPChallenge {
+		storeChallenge(t, deps.otpRepo, id, "+15550001", "123456")
+		challenge, _ := deps.otpRepo.GetChallenge(ctx, id)
+		return challenge
+	}
+
+	// Requests of other tenants, or none, get the global policy, disabled here
+	if _, err := deliveries.SendOTPOrDefer(ctx, challenge("challenge-1")); !errors.Is(err, sms.ErrProviderThrottled) {
+		t.Fatalf("expected ErrProviderThrottled without a tenant, got %v", err)
+	}
+	if _, err := deliveries.SendOTPOrDefer(tenant.NewContext(ctx, "blog"), challenge("challenge-2")); !errors.Is(err, sms.ErrProviderThrottled) {
+		t.Fatalf("expected ErrProviderThrottled for an unlisted tenant, got %v", err)
+	}
+
+	// shop may have one OTP queued at once
+	shopCtx := tenant.NewContext(ctx, "shop")
+	if _, err := deliveries.SendOTPOrDefer(shopCtx, challenge("challenge-3")); err != nil {
+		t.Fatalf("SendOTPOrDefer: %v", err)
+	}
+	if _, err := deliveries.SendOTPOrDefer(shopCtx, challenge("challenge-4")); !errors.Is(err, service.ErrSendQueueFull) {
+		t.Fatalf("expected ErrSendQueueFull once shop's share is full, got %v", err)
+	}
+	if length, _ := deps.sendQueueRepo.TenantLength(ctx, "shop"); length != 1 {
+		t.Fatalf("shop's queue length = %d, want 1", length)
+	}
+
+	// bank has no limit of its own and queues behind shop's OTP
+	delay, err := deliveries.SendOTPOrDefer(tenant.NewContext(ctx, "bank"), challenge("challenge-5"))
+	if err != nil || delay != 2*time.Second {
+		t.Fatalf("expected bank's OTP to be queued for 2s, got %v (%v)", delay, err)
+	}
+}
+
+func TestQueuedOTPRetriedThenDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.SMS.Queue.Enabled = true
+	cfg.SMS.Queue.MaxAttempts = 2
+	deps := newAuthDeps(t, cfg)
+	deliveries := newFailingDeliveries(deps, cfg)
+
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	challenge, _ := deps.otpRepo.GetChallenge(ctx, id)
+	if err := deliveries.SendOTP(ctx, challenge); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+
+	// The first failure is retried after the backoff
+	if processed, err := deliveries.ProcessNext(ctx); err != nil || !processed {
+		t.Fatalf("expected the queued OTP to be attempted, got %v (%v)", processed, err)
+	}
+	if processed, _ := deliveries.ProcessNext(ctx); processed {
+		t.Fatal("expected the retry to wait for the backoff")
+	}
+	if delivery, _ := deps.deliveryRepo.Get(ctx, id); delivery.Status != models.DeliveryQueued {
+		t.Fatalf("expected the OTP to stay queued while retrying, got %q", delivery.Status)
+	}
+
+	// Make the retry due, and the last attempt dead-letters the OTP
+	jobs, _ := deps.sendQueueRepo.ClaimDue(ctx, time.Now().Add(time.Hour), time.Now(), 1)
+	if len(jobs) != 1 || jobs[0].Attempts != 1 || jobs[0].LastError == "" {
+		t.Fatalf("expected one failed attempt to be recorded, got %+v", jobs)
+	}
+	if processed, err := deliveries.ProcessNext(ctx); err != nil || !processed {
+		t.Fatalf("expected the retry to be attempted, got %v (%v)", processed, err)
+	}
+	deadLetters, _ := deps.sendQueueRepo.DeadLetters(ctx)
+	if len(deadLetters) != 1 || deadLetters[0].ChallengeID != id || deadLetters[0].Attempts != 2 {
+		t.Fatalf("expected the OTP to be dead-lettered, got %+v", deadLetters)
+	}
+	if length, _ := deps.sendQueueRepo.Length(ctx); length != 0 {
+		t.Fatalf("expected an empty queue, got %d", length)
+	}
+	if delivery, _ := deps.deliveryRepo.Get(ctx, id); delivery.Status != models.DeliveryFailed {
+		t.Fatalf("expected the OTP to have failed, got %q", delivery.Status)
+	}
+}
+
+func TestQueuedOTPDroppedOnceVerified(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.SMS.Queue.Enabled = true
+	deps := newAuthDeps(t, cfg)
+
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	challenge, _ := deps.otpRepo.GetChallenge(ctx, id)
+	if err := deps.deliveries.SendOTP(ctx, challenge); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+	if err := deps.otpRepo.DeleteChallenge(ctx, challenge); err != nil {
+		t.Fatalf("DeleteChallenge: %v", err)
+	}
+
+	if processed, err := deps.deliveries.ProcessNext(ctx); err != nil || !processed {
+		t.Fatalf("expected the queued OTP to be processed, got %v (%v)", processed, err)
+	}
+	if length, _ := deps.sendQueueRepo.Length(ctx); length != 0 {
+		t.Fatalf("expected the OTP to be dropped, got a queue of %d", length)
+	}
+}
+
+func TestQueuedOTPSendFinishedOnShutdown(t *testing.T) {
+	cfg := testConfig()
+	cfg.SMS.Queue.Enabled = true
+	cfg.SMS.Queue.Workers = 1
+	deps := newAuthDeps(t, cfg)
+	provider := blockingProvider{started: make(chan struct{}), release: make(chan struct{})}
+	deliveries := newDeliveriesWith(deps, cfg, provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		deliveries.Run(ctx)
+		close(done)
+	}()
+
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	challenge, _ := deps.otpRepo.GetChallenge(context.Background(), id)
+	if err := deliveries.SendOTP(context.Background(), challenge); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+
+	// Shut down while the OTP is being sent; Run waits for the send to finish
+	select {
+	case <-provider.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the queued OTP to be sent")
+	}
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("expected Run to wait for the send in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(provider.release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return once the send finished")
+	}
+
+	if delivery, _ := deps.deliveryRepo.Get(context.Background(), id); delivery.Status != models.DeliverySent {
+		t.Fatalf("expected the OTP to be sent, got %q", delivery.Status)
+	}
+	if length, _ := deps.sendQueueRepo.Length(context.Background()); length != 0 {
+		t.Fatalf("expected an empty queue, got %d", length)
+	}
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestMintDevToken(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.Sessions.MaxConcurrent = 1
+	deps := newAuthDeps(t, cfg)
+	tokens := service.NewTokenSigner(cfg, nil)
+	devToken := service.DevToken{
+		UserID:      uuid.New(),
+		PhoneNumber: "+989121234567",
+		Role:        models.RoleAdmin,
+		Scopes:      []string{models.APIKeyScopeUsersRead, models.APIKeyScopeUsersMetadata},
+		ExpiresIn:   time.Hour,
+	}
+
+	// Dev tokens are only minted in development
+	cfg.Service.Env = "production"
+	if _, err := deps.sessions.MintDevToken(ctx, devToken); err == nil {
+		t.Fatal("expected dev tokens to be refused outside development")
+	}
+
+	cfg.Service.Env = config.EnvDevelopment
+	signed, err := deps.sessions.MintDevToken(ctx, devToken)
+	if err != nil {
+		t.Fatalf("MintDevToken: %v", err)
+	}
+	token, err := tokens.Parse(ctx, signed)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["user_id"] != devToken.UserID.String() || claims["phone_number"] != devToken.PhoneNumber || claims["role"] != models.RoleAdmin {
+		t.Fatalf("expected the dev token's claims, got %v", claims)
+	}
+	if claims["scope"] != "users:read users:metadata" {
+		t.Fatalf("expected the dev token's scopes, got %v", claims["scope"])
+	}
+
+	// Dev tokens have a session that is checked and revoked like any other, without counting
+	// towards sessions.maxConcurrent
+	jti, _ := claims["jti"].(string)
+	sessionID, err := uuid.Parse(jti)
+	if err != nil {
+		t.Fatalf("expected a session ID as jti, got %v", claims)
+	}
+	if _, err := deps.sessions.MintDevToken(ctx, devToken); err != nil {
+		t.Fatalf("MintDevToken: %v", err)
+	}
+	if err := deps.sessions.CheckSession(ctx, devToken.UserID, sessionID); err != nil {
+		t.Fatalf("CheckSession: %v", err)
+	}
+	if _, err := deps.sessions.RevokeAllSessions(ctx, devToken.UserID); err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+	if err := deps.sessions.CheckSession(ctx, devToken.UserID, sessionID); err == nil || err.Error() != "session revoked" {
+		t.Fatalf("expected the revoked dev token's session to be refused, got %v", err)
+	}
+
+	devToken.Scopes = []string{"users read"}
+	if _, err := deps.sessions.MintDevToken(ctx, devToken); err == nil {
+		t.Fatal("expected a scope with a space to be refused")
+	}
+	devToken.Scopes = nil
+
+	devToken.Role = "superuser"
+	if _, err := deps.sessions.MintDevToken(ctx, devToken); err == nil {
+		t.Fatal("expected an unknown role to be refused")
+	}
+}
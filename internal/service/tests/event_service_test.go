@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestReplayRebuildsUserReadModels(t *testing.T) {
+	ctx := context.Background()
+	eventRepo := repository.NewInMemoryEventRepository()
+	baseRepo := repository.NewInMemoryUserRepository()
+	userRepo := repository.NewEventRecordingUserRepository(baseRepo, eventRepo)
+
+	verified, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	legacy := "legacy_crm"
+	if _, err := userRepo.CreateImported(ctx, "+15550002", true, &legacy); err != nil {
+		t.Fatalf("CreateImported: %v", err)
+	}
+	unverified, err := userRepo.CreateImported(ctx, "+15550003", false, nil)
+	if err != nil {
+		t.Fatalf("CreateImported: %v", err)
+	}
+	deleted, err := userRepo.CreateImported(ctx, "+15550004", false, nil)
+	if err != nil {
+		t.Fatalf("CreateImported: %v", err)
+	}
+	restored, err := userRepo.Create(ctx, "+15550005")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := userRepo.MarkPhoneVerified(ctx, unverified.ID, models.VerifiedSourceOTP); err != nil {
+		t.Fatalf("MarkPhoneVerified: %v", err)
+	}
+	if err := userRepo.SetRole(ctx, unverified.ID, models.RoleAdmin); err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	verified.PhoneNumber = "+15550009"
+	if err := userRepo.Update(ctx, verified); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := userRepo.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := userRepo.Delete(ctx, restored.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := userRepo.Restore(ctx, restored.ID, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if purged, err := userRepo.Purge(ctx, time.Now().Add(time.Second)); err != nil || len(purged) != 1 || purged[0] != deleted.ID {
+		t.Fatalf("expected the deleted user purged, got %v (%v)", purged, err)
+	}
+
+	// Events about other aggregates are skipped by the user projection
+	eventService := service.NewEventService(eventRepo)
+	if err := eventService.Publish(ctx, models.EventOTPRequested, models.AggregatePhone, "+15550001", nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	// Small batches exercise paging through the log
+	projection := service.NewUserProjection()
+	lastSequence, err := eventService.Replay(ctx, 0, 2, projection.Apply)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if lastSequence != 13 {
+		t.Fatalf("expected to replay 13 events, got %d", lastSequence)
+	}
+
+	live, err := baseRepo.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if rebuilt := projection.Stats(); !reflect.DeepEqual(rebuilt, live) {
+		t.Fatalf("expected rebuilt stats %+v, got %+v", live, rebuilt)
+	}
+
+	users := projection.Users()
+	if len(users) != 4 {
+		t.Fatalf("expected 4 active users, got %d", len(users))
+	}
+	for _, user := range users {
+		stored, err := baseRepo.FindByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if user.PhoneNumber != stored.PhoneNumber || user.PhoneVerified != stored.PhoneVerified || user.Role != stored.Role {
+			t.Fatalf("expected rebuilt user %+v, got %+v", *stored, user)
+		}
+	}
+}
+
+func TestVerifyOTPPublishesEvents(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+	authService, otpRepo := deps.authService, deps.otpRepo
+
+	challengeID := storeChallenge(t, otpRepo, "challenge-1", "+15550001", "123456")
+	if _, _, err := authService.VerifyOTP(ctx, challengeID, "000000", testIP, testUserAgent); err == nil {
+		t.Fatal("expected wrong OTP to fail")
+	}
+	if _, _, err := authService.VerifyOTP(ctx, challengeID, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+
+	events, err := deps.eventRepo.ListAfter(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("ListAfter: %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	want := []string{models.EventOTPVerificationFailed, models.EventUserCreated, models.EventOTPVerified}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+}
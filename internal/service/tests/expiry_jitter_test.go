@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestExpiryJitterDisabled(t *testing.T) {
+	jitter := service.NewExpiryJitter()
+	for _, max := range []time.Duration{0, -time.Second} {
+		if got := jitter.Apply(5*time.Minute, max); got != 5*time.Minute {
+			t.Errorf("Apply with max %v = %v, want the TTL unchanged", max, got)
+		}
+	}
+}
+
+func TestExpiryJitterWithinRange(t *testing.T) {
+	jitter := service.NewExpiryJitter()
+	ttl, max := 5*time.Minute, 30*time.Second
+	for i := 0; i < 1000; i++ {
+		if got := jitter.Apply(ttl, max); got < ttl || got > ttl+max {
+			t.Fatalf("Apply = %v, want within [%v, %v]", got, ttl, ttl+max)
+		}
+	}
+}
+
+func TestExpiryJitterSpreadsBursts(t *testing.T) {
+	jitter := service.NewExpiryJitter()
+	const strata = 64
+	ttl, max := 5*time.Minute, 64*time.Second
+
+	// The first two OTPs of a burst expire in opposite halves of the range
+	first, second := jitter.Apply(ttl, max)-ttl, jitter.Apply(ttl, max)-ttl
+	if (first < max/2) == (second < max/2) {
+		t.Fatalf("expected offsets in opposite halves, got %v and %v", first, second)
+	}
+
+	// Any burst of 64 consecutive OTPs puts exactly one in every 1/64 slice of the range
+	counts := make([]int, strata)
+	for i := 0; i < strata; i++ {
+		offset := jitter.Apply(ttl, max) - ttl
+		counts[int(offset*strata/max)]++
+	}
+	for slice, count := range counts {
+		if count != 1 {
+			t.Fatalf("slice %d got %d of a burst of %d, want 1: %v", slice, count, strata, counts)
+		}
+	}
+}
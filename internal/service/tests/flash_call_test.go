@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// placedCall is a flash call placed through recordingCaller
+type placedCall struct {
+	phoneNumber string
+	callerID    string
+}
+
+// recordingCaller records the flash calls it is asked to place
+type recordingCaller struct {
+	mu    sync.Mutex
+	calls []placedCall
+}
+
+func (c *recordingCaller) Call(ctx context.Context, phoneNumber, callerID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, placedCall{phoneNumber: phoneNumber, callerID: callerID})
+	return nil
+}
+
+func (c *recordingCaller) placed() []placedCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]placedCall(nil), c.calls...)
+}
+
+func TestFlashCallOTP(t *testing.T) {
+	cfg := testConfig()
+	cfg.FlashCall.CallerPrefix = "+98215550"
+	cfg.OTP.ResendCooldown = 0
+	deps := newAuthDeps(t, cfg)
+	ctx := context.Background()
+
+	_, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelFlashCall, testIP, testUserAgent)
+	if !errors.Is(err, service.ErrChannelDisabled) {
+		t.Fatalf("err = %v, want ErrChannelDisabled", err)
+	}
+
+	cfg.OTP.Channels.FlashCall = true
+	challenge, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelFlashCall, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTPVia: %v", err)
+	}
+	calls := deps.calls.placed()
+	if len(calls) != 1 || calls[0].phoneNumber != "+15550001" || calls[0].callerID != "+98215550"+challenge.Code {
+		t.Fatalf("expected a call from the prefix followed by the OTP, got %+v", calls)
+	}
+
+	// Resends call again from the same number
+	if err := deps.authService.ResendOTP(ctx, challenge.ID, testIP, testUserAgent); err != nil {
+		t.Fatalf("ResendOTP: %v", err)
+	}
+	if calls := deps.calls.placed(); len(calls) != 2 || calls[1].callerID != calls[0].callerID {
+		t.Fatalf("expected the resend to call from the same number, got %+v", calls)
+	}
+
+	// The last digits of the calling number are the code
+	callerID := calls[0].callerID
+	if _, _, err := deps.authService.VerifyOTP(ctx, challenge.ID, callerID[len(callerID)-cfg.OTP.Length:], testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+}
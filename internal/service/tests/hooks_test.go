@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/webhook"
+)
+
+func TestHooksRunOnSignUpAndLogin(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+
+	var calls []string
+	deps.hooks.OnUserCreated(func(ctx context.Context, user *models.User) error {
+		calls = append(calls, "created "+user.PhoneNumber)
+		return nil
+	})
+	deps.hooks.OnLogin(func(ctx context.Context, login *service.Login) error {
+		if login.NewUser {
+			calls = append(calls, "login new "+login.Method)
+		} else {
+			calls = append(calls, "login "+login.Method)
+		}
+		return nil
+	})
+
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	if _, _, err := deps.authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+	id = storeChallenge(t, deps.otpRepo, "challenge-2", "+15550001", "123456")
+	if _, _, err := deps.authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+
+	want := []string{"created +15550001", "login new otp", "login otp"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+	}
+}
+
+func TestLoginHookDeniesSignIn(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+	deps.hooks.OnLogin(func(ctx context.Context, login *service.Login) error {
+		return &service.HookDeniedError{Reason: "Outside business hours"}
+	})
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	_, _, err = deps.authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	var deniedErr *service.HookDeniedError
+	if !errors.As(err, &deniedErr) || deniedErr.Reason != "Outside business hours" {
+		t.Fatalf("expected a HookDeniedError, got %v", err)
+	}
+	if sessions, _ := deps.sessionRepo.ListByUser(ctx, user.ID); len(sessions) != 0 {
+		t.Fatalf("expected no session for a denied sign-in, got %d", len(sessions))
+	}
+
+	attempts, _, err := deps.loginHistoryRepo.ListByUser(ctx, user.ID, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	if len(attempts) != 1 || attempts[0].Success || attempts[0].FailureReason == nil || *attempts[0].FailureReason != models.LoginFailureDenied {
+		t.Fatalf("expected a denied login attempt, got %+v", attempts)
+	}
+
+	// A denied first sign-in leaves no user behind
+	id = storeChallenge(t, deps.otpRepo, "challenge-2", "+15550002", "123456")
+	if _, _, err := deps.authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); !errors.As(err, &deniedErr) {
+		t.Fatalf("expected a HookDeniedError, got %v", err)
+	}
+	if _, err := deps.userRepo.FindByPhoneNumber(ctx, "+15550002"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("expected no user for a denied first sign-in, got %v", err)
+	}
+}
+
+func TestOTPFailedHookErrorsAreIgnored(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+	var failures []*service.OTPFailure
+	deps.hooks.OnOTPFailed(func(ctx context.Context, failure *service.OTPFailure) error {
+		failures = append(failures, failure)
+		return errors.New("hook unavailable")
+	})
+
+	id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	_, _, err := deps.authService.VerifyOTP(ctx, id, "654321", testIP, testUserAgent)
+	var invalidErr *service.InvalidOTPError
+	if !errors.As(err, &invalidErr) {
+		t.Fatalf("expected an InvalidOTPError, got %v", err)
+	}
+	if len(failures) != 1 || failures[0].ChallengeID != id || failures[0].PhoneNumber != "+15550001" || failures[0].Method != "otp" {
+		t.Fatalf("unexpected OTP failures %+v", failures)
+	}
+}
+
+// hookReceiver records the hooks called on it and answers with status
+type hookReceiver struct {
+	mu     sync.Mutex
+	status int
+	hooks  []string
+}
+
+func (r *hookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var payload struct {
+		Hook string `json:"hook"`
+	}
+	json.Unmarshal(body, &payload)
+
+	r.mu.Lock()
+	r.hooks = append(r.hooks, payload.Hook+" "+req.Header.Get(webhook.HeaderEvent))
+	status := r.status
+	r.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func TestWebhookHooks(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		failClosed bool
+		wantDenied bool
+		wantErr    bool
+	}{
+		{"allowed", http.StatusNoContent, false, false, false},
+		{"denied", http.StatusForbidden, false, true, false},
+		{"failing open", http.StatusInternalServerError, false, false, false},
+		{"failing closed", http.StatusInternalServerError, true, false, true},
+	}
+	for _, tt := range tests {
+		receiver := &hookReceiver{status: tt.status}
+		server := httptest.NewServer(receiver)
+
+		deps := newAuthDeps(t, testConfig())
+		cfg := config.HooksConfig{URL: server.URL, Secret: "hook-secret", Events: []string{service.HookLogin}, FailClosed: tt.failClosed}
+		service.NewWebhookHooks(webhook.NewClient(time.Second), cfg, logging.Discard()).Register(deps.hooks)
+
+		id := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+		_, _, err := deps.authService.VerifyOTP(context.Background(), id, "123456", testIP, testUserAgent)
+		server.Close()
+
+		var deniedErr *service.HookDeniedError
+		if denied := errors.As(err, &deniedErr); denied != tt.wantDenied {
+			t.Errorf("%s: denied = %v, want %v (error %v)", tt.name, denied, tt.wantDenied, err)
+		}
+		if !tt.wantDenied && (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		// Only the subscribed hook is called
+		if len(receiver.hooks) != 1 || receiver.hooks[0] != "user.login user.login" {
+			t.Errorf("%s: hooks called = %v, want [user.login]", tt.name, receiver.hooks)
+		}
+	}
+}
+
+// mustFindUser returns the user with a phone number
+func mustFindUser(t *testing.T, deps *authDeps, phoneNumber string) *models.User {
+	t.Helper()
+	user, err := deps.userRepo.FindByPhoneNumber(context.Background(), phoneNumber)
+	if err != nil {
+		t.Fatalf("FindByPhoneNumber: %v", err)
+	}
+	return user
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestImportUsers(t *testing.T) {
+	ctx := context.Background()
+	authService, userRepo, otpRepo := newAuthService(t, testConfig())
+	auditRepo := &recordingAuditRepository{}
+	importService := service.NewImportService(userRepo, service.NewAuditService(auditRepo))
+
+	existing, err := userRepo.Create(ctx, "09120000001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	response, err := importService.ImportUsers(ctx, models.AuditActor{}, []models.ImportUser{
+		{PhoneNumber: "09120000001", PhoneVerified: true, VerifiedSource: "legacy_crm"},
+		{PhoneNumber: "09120000002", PhoneVerified: true, VerifiedSource: "legacy_crm"},
+		{PhoneNumber: "09120000003"},
+		{PhoneNumber: "09120000004", PhoneVerified: true},
+		{PhoneNumber: "09120000005", VerifiedSource: "legacy_crm"},
+		{PhoneNumber: "not-a-phone"},
+	})
+	if err != nil {
+		t.Fatalf("ImportUsers: %v", err)
+	}
+	if response.Imported != 2 || response.Skipped != 1 || response.Failed != 3 {
+		t.Fatalf("unexpected counts: %+v", response)
+	}
+	if response.Results[0].UserID == nil || *response.Results[0].UserID != existing.ID || response.Results[0].Created {
+		t.Fatalf("expected existing user to be skipped, got %+v", response.Results[0])
+	}
+	if len(auditRepo.entries) != 1 || auditRepo.entries[0].Action != service.AuditActionUserImport ||
+		auditRepo.entries[0].TargetID != response.BatchID.String() {
+		t.Fatalf("expected one user.import audit entry, got %+v", auditRepo.entries)
+	}
+
+	verified, err := userRepo.FindByPhoneNumber(ctx, "09120000002")
+	if err != nil || !verified.PhoneVerified || verified.VerifiedSource == nil || *verified.VerifiedSource != "legacy_crm" {
+		t.Fatalf("expected pre-verified user, got %+v (%v)", verified, err)
+	}
+
+	// A pre-verified user signs in as an existing user
+	id := storeChallenge(t, otpRepo, "challenge-09120000002", "09120000002", "123456")
+	_, user, err := authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	if err != nil || user.ID != verified.ID || *user.VerifiedSource != "legacy_crm" {
+		t.Fatalf("expected imported user to sign in unchanged, got %+v (%v)", user, err)
+	}
+
+	// An unverified user is verified by its first sign-in
+	id = storeChallenge(t, otpRepo, "challenge-09120000003", "09120000003", "123456")
+	_, user, err = authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	if err != nil || !user.PhoneVerified || *user.VerifiedSource != models.VerifiedSourceOTP {
+		t.Fatalf("expected sign-in to verify the phone number, got %+v (%v)", user, err)
+	}
+
+	stats, err := newUserService(userRepo).GetUserStats(ctx)
+	if err != nil {
+		t.Fatalf("GetUserStats: %v", err)
+	}
+	if stats.TotalUsers != 3 || stats.PhoneVerified != 3 || stats.Unverified != 0 ||
+		stats.VerifiedBySource[models.VerifiedSourceOTP] != 2 || stats.VerifiedBySource["legacy_crm"] != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestImportUsersBatchTooLarge(t *testing.T) {
+	_, userRepo, _ := newAuthService(t, testConfig())
+	importService := service.NewImportService(userRepo, service.NewAuditService(&recordingAuditRepository{}))
+
+	users := make([]models.ImportUser, service.MaxImportBatchSize+1)
+	_, err := importService.ImportUsers(context.Background(), models.AuditActor{}, users)
+	if err == nil || err.Error() != "batch too large" {
+		t.Fatalf("expected batch too large, got %v", err)
+	}
+}
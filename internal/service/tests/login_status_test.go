@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// nextStatus receives the next login status, failing the test if none arrives in time
+func nextStatus(t *testing.T, statuses <-chan *models.LoginStatus) (*models.LoginStatus, bool) {
+	t.Helper()
+
+	select {
+	case status, ok := <-statuses:
+		return status, ok
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for login status")
+		return nil, false
+	}
+}
+
+func TestWatchLoginStatusNotifiesVerification(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+	id := storeChallenge(t, otpRepo, "challenge-watch", "+15550001", "123456")
+
+	statuses, err := authService.WatchLoginStatus(ctx, id, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("WatchLoginStatus: %v", err)
+	}
+	if status, ok := nextStatus(t, statuses); !ok || status.Status != models.LoginStatusPending || status.ChallengeID != id {
+		t.Fatalf("expected pending status first, got %+v", status)
+	}
+
+	if _, _, err := authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+	if status, ok := nextStatus(t, statuses); !ok || status.Status != models.LoginStatusVerified {
+		t.Fatalf("expected verified status, got %+v", status)
+	}
+	if _, ok := nextStatus(t, statuses); ok {
+		t.Fatal("expected the stream to end after verification")
+	}
+
+	// Clients subscribing after the verification get its status right away
+	late, err := authService.WatchLoginStatus(ctx, id, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("WatchLoginStatus: %v", err)
+	}
+	if status, ok := nextStatus(t, late); !ok || status.Status != models.LoginStatusVerified {
+		t.Fatalf("expected verified status for late subscriber, got %+v", status)
+	}
+	if _, ok := nextStatus(t, late); ok {
+		t.Fatal("expected the late stream to end")
+	}
+}
+
+func TestWatchLoginStatusBoundToClient(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+	id := storeChallenge(t, otpRepo, "challenge-foreign", "+15550001", "123456")
+
+	if _, err := authService.WatchLoginStatus(ctx, id, "198.51.100.7", testUserAgent); err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected invalid challenge for another client, got %v", err)
+	}
+	if _, err := authService.WatchLoginStatus(ctx, "unknown", testIP, testUserAgent); err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected invalid challenge for unknown challenge, got %v", err)
+	}
+
+	// The verified status stays bound to the client too
+	if _, _, err := authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+	if _, err := authService.WatchLoginStatus(ctx, id, testIP, "other-agent"); err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected invalid challenge for another client, got %v", err)
+	}
+}
+
+func TestWatchLoginStatusEndsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	authService, _, otpRepo := newAuthService(t, testConfig())
+	id := storeChallenge(t, otpRepo, "challenge-cancel", "+15550001", "123456")
+
+	statuses, err := authService.WatchLoginStatus(ctx, id, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("WatchLoginStatus: %v", err)
+	}
+	nextStatus(t, statuses)
+
+	cancel()
+	if _, ok := nextStatus(t, statuses); ok {
+		t.Fatal("expected the stream to end with its context")
+	}
+}
+
+func TestPollLoginStatus(t *testing.T) {
+	ctx := context.Background()
+	authService, _, otpRepo := newAuthService(t, testConfig())
+	id := storeChallenge(t, otpRepo, "challenge-poll", "+15550001", "123456")
+
+	// Without a wait the current status is returned at once
+	status, err := authService.PollLoginStatus(ctx, id, testIP, testUserAgent, 0)
+	if err != nil || status.Status != models.LoginStatusPending {
+		t.Fatalf("expected pending status, got %+v, %v", status, err)
+	}
+
+	// A wait that runs out returns the pending status
+	start := time.Now()
+	status, err = authService.PollLoginStatus(ctx, id, testIP, testUserAgent, 50*time.Millisecond)
+	if err != nil || status.Status != models.LoginStatusPending {
+		t.Fatalf("expected pending status after the wait, got %+v, %v", status, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected the poll to wait, returned after %v", elapsed)
+	}
+
+	// A verification during the wait is returned right away
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	}()
+	status, err = authService.PollLoginStatus(ctx, id, testIP, testUserAgent, 5*time.Second)
+	if err != nil || status.Status != models.LoginStatusVerified {
+		t.Fatalf("expected verified status, got %+v, %v", status, err)
+	}
+
+	if _, err := authService.PollLoginStatus(ctx, id, "198.51.100.7", testUserAgent, time.Second); err == nil || err.Error() != "invalid challenge" {
+		t.Fatalf("expected invalid challenge for another client, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func newMaintenanceService() (*service.MaintenanceService, *repository.InMemoryMaintenanceNoticeRepository, *recordingAuditRepository) {
+	repo := repository.NewInMemoryMaintenanceNoticeRepository()
+	auditRepo := &recordingAuditRepository{}
+	return service.NewMaintenanceService(repo, service.NewAuditService(auditRepo), testConfig()), repo, auditRepo
+}
+
+func TestMaintenanceServiceCreate(t *testing.T) {
+	maintenance, _, auditRepo := newMaintenanceService()
+	ctx := context.Background()
+	start := time.Now().Add(time.Hour)
+
+	notice, err := maintenance.Create(ctx, models.AuditActor{}, models.CreateMaintenanceNoticeRequest{
+		Message:  "Scheduled database upgrade",
+		StartsAt: start,
+		EndsAt:   start.Add(2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if notice.Severity != models.MaintenanceSeverityInfo {
+		t.Fatalf("severity = %q, want info by default", notice.Severity)
+	}
+	if len(auditRepo.entries) != 1 || auditRepo.entries[0].Action != service.AuditActionMaintenanceCreate || auditRepo.entries[0].TargetID != notice.ID {
+		t.Fatalf("audit entries = %+v, want one maintenance.create entry", auditRepo.entries)
+	}
+
+	// The notice is announced right away on the instance that created it
+	notices, err := maintenance.Current(ctx)
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if len(notices) != 1 || notices[0].ID != notice.ID {
+		t.Fatalf("current notices = %+v, want the new notice", notices)
+	}
+}
+
+func TestMaintenanceServiceCreateRejectsInvalidWindows(t *testing.T) {
+	maintenance, _, _ := newMaintenanceService()
+	ctx := context.Background()
+	now := time.Now()
+
+	windows := []struct{ start, end time.Time }{
+		{now.Add(2 * time.Hour), now.Add(time.Hour)},   // ends before it starts
+		{now.Add(-2 * time.Hour), now.Add(-time.Hour)}, // ended already
+	}
+	for _, window := range windows {
+		_, err := maintenance.Create(ctx, models.AuditActor{}, models.CreateMaintenanceNoticeRequest{
+			Message:  "Upgrade",
+			StartsAt: window.start,
+			EndsAt:   window.end,
+		})
+		var validationErr *service.ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("Create(%v-%v) err = %v, want a validation error", window.start, window.end, err)
+		}
+	}
+}
+
+func TestMaintenanceServiceCurrentSkipsEndedNotices(t *testing.T) {
+	maintenance, repo, _ := newMaintenanceService()
+	ctx := context.Background()
+	now := time.Now()
+
+	// A notice that ended since it was announced
+	ended := &models.MaintenanceNotice{ID: "ended", Message: "Done", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}
+	if err := repo.Create(ctx, ended); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	active, err := maintenance.Create(ctx, models.AuditActor{}, models.CreateMaintenanceNoticeRequest{
+		Message:  "Upgrade in progress",
+		Severity: models.MaintenanceSeverityCritical,
+		StartsAt: now.Add(-time.Minute),
+		EndsAt:   now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	notices, err := maintenance.Current(ctx)
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if len(notices) != 1 || notices[0].ID != active.ID || !notices[0].Active(time.Now()) {
+		t.Fatalf("current notices = %+v, want only the active notice", notices)
+	}
+
+	// Announcing a notice deletes the ended ones
+	all, _ := repo.List(ctx)
+	if len(all) != 1 {
+		t.Fatalf("stored notices = %+v, want the ended one deleted", all)
+	}
+}
+
+func TestMaintenanceServiceDelete(t *testing.T) {
+	maintenance, _, auditRepo := newMaintenanceService()
+	ctx := context.Background()
+	start := time.Now().Add(time.Hour)
+
+	notice, err := maintenance.Create(ctx, models.AuditActor{}, models.CreateMaintenanceNoticeRequest{
+		Message:  "Upgrade",
+		StartsAt: start,
+		EndsAt:   start.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := maintenance.Current(ctx); err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+
+	deleted, err := maintenance.Delete(ctx, models.AuditActor{}, notice.ID)
+	if err != nil || !deleted {
+		t.Fatalf("Delete = %v, %v, want deleted", deleted, err)
+	}
+	if deleted, _ := maintenance.Delete(ctx, models.AuditActor{}, notice.ID); deleted {
+		t.Fatal("Delete of a deleted notice reported deleted")
+	}
+	if len(auditRepo.entries) != 2 || auditRepo.entries[1].Action != service.AuditActionMaintenanceDelete {
+		t.Fatalf("audit entries = %+v, want create and delete entries", auditRepo.entries)
+	}
+
+	// The cached notices are dropped with the deletion
+	notices, err := maintenance.Current(ctx)
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if len(notices) != 0 {
+		t.Fatalf("current notices = %+v, want none after deletion", notices)
+	}
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// recordingAuditRepository keeps audit entries in memory
+type recordingAuditRepository struct {
+	entries []*models.AuditLog
+}
+
+func (r *recordingAuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *recordingAuditRepository) ListByTarget(ctx context.Context, targetType, targetID string, limit int) ([]models.AuditLog, int64, error) {
+	entries := []models.AuditLog{}
+	var totalCount int64
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if r.entries[i].TargetType != targetType || r.entries[i].TargetID != targetID {
+			continue
+		}
+		totalCount++
+		if len(entries) < limit {
+			entries = append(entries, *r.entries[i])
+		}
+	}
+	return entries, totalCount, nil
+}
+
+func newMigrationService(t *testing.T) (*service.MigrationService, *repository.InMemoryUserRepository, *recordingAuditRepository) {
+	t.Helper()
+
+	cfg := testConfig()
+	cfg.Migration.LegacySecret = "legacy-secret"
+	cfg.Migration.MaxBatchSize = 3
+	cfg.Migration.SignatureMaxAge = 10
+
+	authService, userRepo, _ := newAuthService(t, cfg)
+	auditRepo := &recordingAuditRepository{}
+	migrationService := service.NewMigrationService(userRepo, authService, service.NewAuditService(auditRepo), cfg)
+	return migrationService, userRepo, auditRepo
+}
+
+func signedBatch(secret string, issuedAt time.Time, users ...models.LegacyUser) *models.MigrateLegacyUsersRequest {
+	return &models.MigrateLegacyUsersRequest{
+		Users:     users,
+		IssuedAt:  issuedAt.Unix(),
+		Signature: service.LegacySignature(secret, issuedAt.Unix(), users),
+	}
+}
+
+func TestMigrateLegacyUsers(t *testing.T) {
+	ctx := context.Background()
+	migrationService, userRepo, auditRepo := newMigrationService(t)
+
+	existing, err := userRepo.Create(ctx, "09120000001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	deleted, err := userRepo.Create(ctx, "09120000003")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := userRepo.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	req := signedBatch("legacy-secret", time.Now(),
+		models.LegacyUser{LegacyID: "a", PhoneNumber: "09120000001"},
+		models.LegacyUser{LegacyID: "b", PhoneNumber: "09120000002"},
+		models.LegacyUser{LegacyID: "c", PhoneNumber: "09120000003"},
+	)
+	resp, err := migrationService.MigrateLegacyUsers(ctx, models.AuditActor{}, req)
+	if err != nil {
+		t.Fatalf("MigrateLegacyUsers: %v", err)
+	}
+	if resp.Migrated != 2 || resp.Failed != 1 {
+		t.Fatalf("expected 2 migrated and 1 failed, got %+v", resp)
+	}
+
+	if r := resp.Results[0]; r.Created || r.UserID == nil || *r.UserID != existing.ID || r.Token == "" {
+		t.Fatalf("expected existing user to get a token, got %+v", r)
+	}
+	if r := resp.Results[1]; !r.Created || r.Token == "" {
+		t.Fatalf("expected new user to be created, got %+v", r)
+	}
+	if _, err := userRepo.FindByPhoneNumber(ctx, "09120000002"); err != nil {
+		t.Fatalf("expected migrated user to exist: %v", err)
+	}
+	if r := resp.Results[2]; r.Error != "account deleted" || r.Token != "" {
+		t.Fatalf("expected deleted account to be refused, got %+v", r)
+	}
+
+	if len(auditRepo.entries) != 1 || auditRepo.entries[0].Action != service.AuditActionUserMigrate {
+		t.Fatalf("expected one migration audit entry, got %+v", auditRepo.entries)
+	}
+}
+
+func TestMigrateLegacyUsersRejectsBadBatches(t *testing.T) {
+	ctx := context.Background()
+	migrationService, _, _ := newMigrationService(t)
+	user := models.LegacyUser{LegacyID: "a", PhoneNumber: "09120000001"}
+
+	tests := []struct {
+		name string
+		req  *models.MigrateLegacyUsersRequest
+		want string
+	}{
+		{"wrong secret", signedBatch("other-secret", time.Now(), user), "invalid signature"},
+		{"expired", signedBatch("legacy-secret", time.Now().Add(-time.Hour), user), "signature expired"},
+		{"too large", signedBatch("legacy-secret", time.Now(), user, user, user, user), "batch too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrationService.MigrateLegacyUsers(ctx, models.AuditActor{}, tt.req)
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Tampering with a signed batch invalidates it
+	req := signedBatch("legacy-secret", time.Now(), user)
+	req.Users[0].PhoneNumber = "09120000009"
+	if _, err := migrationService.MigrateLegacyUsers(ctx, models.AuditActor{}, req); err == nil || err.Error() != "invalid signature" {
+		t.Fatalf("expected invalid signature for tampered batch, got %v", err)
+	}
+}
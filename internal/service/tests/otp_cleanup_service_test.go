@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// countingCleanupRepository is an OTPCleanupRepository counting its calls
+type countingCleanupRepository struct {
+	calls   chan struct{}
+	deleted int64
+	err     error
+}
+
+func (r *countingCleanupRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	select {
+	case r.calls <- struct{}{}:
+	default:
+	}
+	return r.deleted, r.err
+}
+
+func TestOTPCleanupServiceCleanup(t *testing.T) {
+	repo := &countingCleanupRepository{calls: make(chan struct{}, 1), deleted: 3}
+	cleanupService := service.NewOTPCleanupService(repo, logging.Discard())
+
+	if deleted, err := cleanupService.Cleanup(context.Background()); err != nil || deleted != 3 {
+		t.Fatalf("Cleanup: %d, %v", deleted, err)
+	}
+
+	repo.err = errors.New("connection refused")
+	if _, err := cleanupService.Cleanup(context.Background()); err == nil {
+		t.Fatal("expected the repository's error")
+	}
+}
+
+func TestOTPCleanupServiceRunsUntilCancelled(t *testing.T) {
+	repo := &countingCleanupRepository{calls: make(chan struct{}, 1), err: errors.New("connection refused")}
+	cleanupService := service.NewOTPCleanupService(repo, logging.Discard())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cleanupService.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	// Failed cleanups are retried on the next tick rather than stopping the loop
+	for i := 0; i < 3; i++ {
+		select {
+		case <-repo.calls:
+		case <-time.After(time.Second):
+			t.Fatalf("expected cleanup %d", i+1)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return once cancelled")
+	}
+}
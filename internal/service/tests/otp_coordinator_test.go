@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// sentEmail is an email sent through a recordingEmailSender
+type sentEmail struct {
+	to, subject, body string
+}
+
+// recordingEmailSender keeps the emails it is asked to send in memory
+type recordingEmailSender struct {
+	mu   sync.Mutex
+	sent []sentEmail
+}
+
+func (s *recordingEmailSender) Send(ctx context.Context, to, subject, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, sentEmail{to: to, subject: subject, body: body})
+	return nil
+}
+
+func (s *recordingEmailSender) emails() []sentEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sentEmail(nil), s.sent...)
+}
+
+// newEmailUser creates a user with an email address on their profile
+func newEmailUser(t *testing.T, deps *authDeps, phoneNumber string) {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := deps.userRepo.Create(ctx, phoneNumber)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	address := "user@example.com"
+	if _, err := deps.userRepo.UpdateProfile(ctx, user.ID, models.UpdateProfileRequest{Email: &address}); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+}
+
+func TestGenerateOTPViaReusesCodeAcrossChannels(t *testing.T) {
+	cfg := testConfig()
+	cfg.OTP.Channels.Email = true
+	cfg.OTP.Channels.Duplicates = service.OTPDuplicatesReuse
+	deps := newAuthDeps(t, cfg)
+	newEmailUser(t, deps, "+15550001")
+	ctx := context.Background()
+
+	bySMS, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelSMS, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTPVia(sms): %v", err)
+	}
+	byEmail, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelEmail, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTPVia(email): %v", err)
+	}
+
+	if byEmail.ID != bySMS.ID || byEmail.Code != bySMS.Code {
+		t.Fatalf("email challenge = %s/%s, want the SMS challenge %s/%s", byEmail.ID, byEmail.Code, bySMS.ID, bySMS.Code)
+	}
+	emails := deps.emails.emails()
+	if len(emails) != 1 || emails[0].to != "user@example.com" || !strings.Contains(emails[0].body, bySMS.Code) {
+		t.Fatalf("emails = %+v, want one to user@example.com with code %s", emails, bySMS.Code)
+	}
+
+	// The code works whichever channel it arrived over
+	if _, _, err := deps.authService.VerifyOTP(ctx, bySMS.ID, bySMS.Code, testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+}
+
+func TestGenerateOTPViaIssuesNewCodeForOtherClient(t *testing.T) {
+	cfg := testConfig()
+	cfg.OTP.Channels.Email = true
+	cfg.OTP.Channels.Duplicates = service.OTPDuplicatesReuse
+	deps := newAuthDeps(t, cfg)
+	newEmailUser(t, deps, "+15550001")
+	ctx := context.Background()
+
+	bySMS, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelSMS, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTPVia(sms): %v", err)
+	}
+	byEmail, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelEmail, "198.51.100.7", testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTPVia(email): %v", err)
+	}
+	if byEmail.ID == bySMS.ID {
+		t.Fatal("challenge of another client was reused")
+	}
+}
+
+func TestGenerateOTPViaInvalidatesCodeOnOtherChannel(t *testing.T) {
+	cfg := testConfig()
+	cfg.OTP.Channels.Email = true
+	cfg.OTP.Channels.Duplicates = service.OTPDuplicatesInvalidate
+	deps := newAuthDeps(t, cfg)
+	newEmailUser(t, deps, "+15550001")
+	ctx := context.Background()
+
+	bySMS, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelSMS, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTPVia(sms): %v", err)
+	}
+	byEmail, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelEmail, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTPVia(email): %v", err)
+	}
+
+	if byEmail.ID == bySMS.ID {
+		t.Fatal("SMS challenge was reused, want a new one")
+	}
+	if _, err := deps.otpRepo.GetChallenge(ctx, bySMS.ID); err == nil {
+		t.Fatal("SMS challenge still pending after the email request")
+	}
+	if _, _, err := deps.authService.VerifyOTP(ctx, bySMS.ID, bySMS.Code, testIP, testUserAgent); err == nil {
+		t.Fatal("VerifyOTP accepted the invalidated SMS code")
+	}
+	if _, _, err := deps.authService.VerifyOTP(ctx, byEmail.ID, byEmail.Code, testIP, testUserAgent); err != nil {
+		t.Fatalf("VerifyOTP(email): %v", err)
+	}
+}
+
+func TestGenerateOTPViaKeepsCodesOnSameChannel(t *testing.T) {
+	cfg := testConfig()
+	cfg.OTP.Channels.Duplicates = service.OTPDuplicatesInvalidate
+	deps := newAuthDeps(t, cfg)
+	ctx := context.Background()
+
+	first, err := deps.authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	if _, err := deps.authService.GenerateOTP(ctx, "+15550001", testIP, testUserAgent); err != nil {
+		t.Fatalf("GenerateOTP: %v", err)
+	}
+	if _, err := deps.otpRepo.GetChallenge(ctx, first.ID); err != nil {
+		t.Fatalf("first challenge no longer pending: %v", err)
+	}
+}
+
+func TestGenerateOTPViaEmailRequiresChannelAndAddress(t *testing.T) {
+	cfg := testConfig()
+	deps := newAuthDeps(t, cfg)
+	ctx := context.Background()
+
+	_, err := deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelEmail, testIP, testUserAgent)
+	if !errors.Is(err, service.ErrChannelDisabled) {
+		t.Fatalf("err = %v, want ErrChannelDisabled", err)
+	}
+
+	cfg.OTP.Channels.Email = true
+	_, err = deps.authService.GenerateOTPVia(ctx, "+15550001", models.ChannelEmail, testIP, testUserAgent)
+	if !errors.Is(err, service.ErrNoEmailAddress) {
+		t.Fatalf("err = %v, want ErrNoEmailAddress", err)
+	}
+}
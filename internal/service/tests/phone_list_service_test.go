@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func newPhoneListService(t *testing.T, cfg *config.Config) (*service.PhoneListService, *authDeps, *recordingAuditRepository) {
+	t.Helper()
+
+	deps := newAuthDeps(t, cfg)
+	auditRepo := &recordingAuditRepository{}
+	return service.NewPhoneListService(deps.phoneListRepo, service.NewAuditService(auditRepo), cfg), deps, auditRepo
+}
+
+func TestBlockedPhonePrefixGetsNoOTP(t *testing.T) {
+	ctx := context.Background()
+	phoneLists, deps, auditRepo := newPhoneListService(t, testConfig())
+	actor := models.AuditActor{ID: uuid.New()}
+
+	// Prefixes are normalized like phone numbers
+	added, err := phoneLists.Add(ctx, actor, "", "0912", "SMS pumping")
+	if err != nil || !added {
+		t.Fatalf("expected prefix to be added, got %v, %v", added, err)
+	}
+	if added, err := phoneLists.Add(ctx, actor, models.PhoneListBlock, "+98912", ""); err != nil || added {
+		t.Fatalf("expected the same prefix to be skipped, got %v, %v", added, err)
+	}
+
+	for _, phoneNumber := range []string{"09121234567", "+989121234567"} {
+		if _, err := deps.authService.GenerateOTP(ctx, phoneNumber, testIP, testUserAgent); err == nil || err.Error() != "phone number blocked" {
+			t.Fatalf("expected %s to be blocked, got %v", phoneNumber, err)
+		}
+	}
+	if _, err := deps.authService.GenerateOTP(ctx, "09351234567", testIP, testUserAgent); err != nil {
+		t.Fatalf("expected other prefixes to get an OTP, got %v", err)
+	}
+
+	removed, err := phoneLists.Remove(ctx, actor, models.PhoneListBlock, "98912")
+	if err != nil || !removed {
+		t.Fatalf("expected prefix to be removed, got %v, %v", removed, err)
+	}
+	if _, err := deps.authService.GenerateOTP(ctx, "09121234567", testIP, testUserAgent); err != nil {
+		t.Fatalf("expected unblocked phone number to get an OTP, got %v", err)
+	}
+
+	if len(auditRepo.entries) != 2 || auditRepo.entries[0].Action != service.AuditActionPhoneListAdd ||
+		auditRepo.entries[1].Action != service.AuditActionPhoneListRemove || auditRepo.entries[1].TargetID != "+98912" {
+		t.Fatalf("expected the add and remove to be audited, got %+v", auditRepo.entries)
+	}
+}
+
+func TestAllowlistOnlyMode(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.OTP.AllowlistOnly = true
+	phoneLists, deps, _ := newPhoneListService(t, cfg)
+	actor := models.AuditActor{ID: uuid.New()}
+
+	if _, err := deps.authService.GenerateOTP(ctx, "09121234567", testIP, testUserAgent); err == nil || err.Error() != "phone number blocked" {
+		t.Fatalf("expected phone number off the allowlist to be blocked, got %v", err)
+	}
+
+	if _, err := phoneLists.Add(ctx, actor, models.PhoneListAllow, "+98912", "QA team"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := deps.authService.GenerateOTP(ctx, "09121234567", testIP, testUserAgent); err != nil {
+		t.Fatalf("expected allowed phone number to get an OTP, got %v", err)
+	}
+
+	// The blocklist wins over the allowlist
+	if _, err := phoneLists.Add(ctx, actor, models.PhoneListBlock, "+989121234567", ""); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := deps.authService.GenerateOTP(ctx, "09121234567", testIP, testUserAgent); err == nil || err.Error() != "phone number blocked" {
+		t.Fatalf("expected blocked phone number to be blocked despite the allowlist, got %v", err)
+	}
+
+	entries, err := phoneLists.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 2 || entries[0].List != models.PhoneListAllow || entries[1].List != models.PhoneListBlock {
+		t.Fatalf("expected the allow entry before the block entry, got %+v", entries)
+	}
+}
+
+func TestPhoneListInvalidEntries(t *testing.T) {
+	ctx := context.Background()
+	phoneLists, _, auditRepo := newPhoneListService(t, testConfig())
+	actor := models.AuditActor{ID: uuid.New()}
+
+	if _, err := phoneLists.Add(ctx, actor, "deny", "+98912", ""); err == nil || err.Error() != "invalid list" {
+		t.Fatalf("expected invalid list, got %v", err)
+	}
+	for _, prefix := range []string{"", "+", "+98 912", "98912%", "+1234567890123456"} {
+		if _, err := phoneLists.Add(ctx, actor, models.PhoneListBlock, prefix, ""); err == nil || err.Error() != "invalid phone prefix" {
+			t.Fatalf("expected %q to be an invalid prefix, got %v", prefix, err)
+		}
+	}
+	if removed, err := phoneLists.Remove(ctx, actor, models.PhoneListAllow, "+98912"); err != nil || removed {
+		t.Fatalf("expected nothing to remove, got %v, %v", removed, err)
+	}
+	if len(auditRepo.entries) != 0 {
+		t.Fatalf("expected no audit entries, got %+v", auditRepo.entries)
+	}
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// newRoleService creates a role service whose units of work run against userRepo and auditRepo
+func newRoleService(userRepo *repository.InMemoryUserRepository, auditRepo *repository.InMemoryAuditRepository) *service.RoleService {
+	return service.NewRoleService(newUnitOfWork(userRepo, auditRepo))
+}
+
+// newUnitOfWork creates a unit of work running against userRepo and auditRepo
+func newUnitOfWork(userRepo *repository.InMemoryUserRepository, auditRepo *repository.InMemoryAuditRepository) *repository.InMemoryUnitOfWork {
+	return repository.NewInMemoryUnitOfWork(userRepo, auditRepo, repository.NewInMemoryEventRepository(), repository.NewInMemoryLoginHistoryRepository())
+}
+
+func TestGrantRole(t *testing.T) {
+	ctx := context.Background()
+	authService, userRepo, otpRepo := newAuthService(t, testConfig())
+	auditRepo := repository.NewInMemoryAuditRepository()
+	roleService := newRoleService(userRepo, auditRepo)
+
+	// Granting a role to an unknown phone number creates its user
+	admin, created, err := roleService.GrantRole(ctx, models.AuditActor{}, "09120000001", models.RoleAdmin)
+	if err != nil || !created || admin.Role != models.RoleAdmin || admin.PhoneVerified {
+		t.Fatalf("expected new unverified admin, got %+v, created %v (%v)", admin, created, err)
+	}
+
+	// Existing users keep their account
+	existing, err := userRepo.Create(ctx, "09120000002")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	operator, created, err := roleService.GrantRole(ctx, models.AuditActor{}, "09120000002", models.RoleOperator)
+	if err != nil || created || operator.ID != existing.ID {
+		t.Fatalf("expected existing user to become operator, got %+v, created %v (%v)", operator, created, err)
+	}
+	if stored, err := userRepo.FindByID(ctx, existing.ID); err != nil || stored.Role != models.RoleOperator {
+		t.Fatalf("expected stored operator role, got %+v (%v)", stored, err)
+	}
+
+	for _, user := range []*models.User{admin, existing} {
+		entries, _, err := auditRepo.ListByTarget(ctx, service.AuditTargetUser, user.ID.String(), 10)
+		if err != nil || len(entries) != 1 || entries[0].Action != service.AuditActionUserRoleGrant {
+			t.Fatalf("expected a user.role_grant audit entry per grant, got %+v (%v)", entries, err)
+		}
+	}
+
+	// The created admin signs in by OTP, verifying the phone number
+	id := storeChallenge(t, otpRepo, "challenge-09120000001", "09120000001", "123456")
+	_, user, err := authService.VerifyOTP(ctx, id, "123456", testIP, testUserAgent)
+	if err != nil || user.ID != admin.ID || user.Role != models.RoleAdmin || !user.PhoneVerified {
+		t.Fatalf("expected admin to sign in, got %+v (%v)", user, err)
+	}
+}
+
+func TestGrantRoleRejected(t *testing.T) {
+	ctx := context.Background()
+	_, userRepo, _ := newAuthService(t, testConfig())
+	roleService := newRoleService(userRepo, repository.NewInMemoryAuditRepository())
+
+	deleted, err := userRepo.Create(ctx, "09120000003")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := userRepo.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	tests := []struct {
+		phoneNumber, role, err string
+	}{
+		{"not-a-phone", models.RoleAdmin, "invalid phone number"},
+		{"09120000004", "superuser", `unknown role "superuser"`},
+		{"09120000003", models.RoleAdmin, "account deleted"},
+	}
+	for _, tt := range tests {
+		if _, _, err := roleService.GrantRole(ctx, models.AuditActor{}, tt.phoneNumber, tt.role); err == nil || err.Error() != tt.err {
+			t.Errorf("GrantRole(%q, %q): expected %q, got %v", tt.phoneNumber, tt.role, tt.err, err)
+		}
+	}
+	if _, err := userRepo.FindByPhoneNumber(ctx, "09120000004"); err == nil {
+		t.Fatal("expected no user to be created for an unknown role")
+	}
+}
+
+// unavailableUserRepository fails every user lookup, like a repository whose database is down
+type unavailableUserRepository struct {
+	repository.UserRepository
+}
+
+func (r unavailableUserRepository) FindByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+// unavailableUsersUnitOfWork runs units of work whose user lookups fail
+type unavailableUsersUnitOfWork struct {
+	repository.UnitOfWork
+}
+
+func (u unavailableUsersUnitOfWork) WithTx(ctx context.Context, fn func(repos repository.Repositories) error) error {
+	return u.UnitOfWork.WithTx(ctx, func(repos repository.Repositories) error {
+		repos.Users = unavailableUserRepository{repos.Users}
+		return fn(repos)
+	})
+}
+
+func TestGrantRoleDoesNotCreateUserWhenLookupFails(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	roleService := service.NewRoleService(unavailableUsersUnitOfWork{newUnitOfWork(userRepo, repository.NewInMemoryAuditRepository())})
+
+	if _, _, err := roleService.GrantRole(ctx, models.AuditActor{}, "09120000001", models.RoleAdmin); err == nil {
+		t.Fatal("GrantRole succeeded while user lookups fail")
+	}
+	if _, err := userRepo.FindByPhoneNumber(ctx, "09120000001"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("user created despite the failed lookup: %v", err)
+	}
+}
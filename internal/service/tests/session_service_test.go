@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/geo"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestSessionRefresh(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	deps := newAuthDeps(t, cfg)
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	tokens, err := deps.sessions.Start(ctx, user, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Access tokens carry the session ID as jti
+	token, err := jwt.Parse(tokens.AccessToken, func(*jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWT.Secret), nil
+	})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if claims := token.Claims.(jwt.MapClaims); claims["jti"] != tokens.SessionID.String() {
+		t.Fatalf("expected jti %s, got %v", tokens.SessionID, token.Claims)
+	}
+
+	refreshed, err := deps.sessions.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.SessionID != tokens.SessionID || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("expected a new refresh token for session %s, got %+v", tokens.SessionID, refreshed)
+	}
+
+	// Refresh tokens are single use
+	if _, err := deps.sessions.Refresh(ctx, tokens.RefreshToken); err == nil || err.Error() != "invalid refresh token" {
+		t.Fatalf("expected used refresh token to be invalid, got %v", err)
+	}
+	if _, err := deps.sessions.Refresh(ctx, "not-a-refresh-token"); err == nil || err.Error() != "invalid refresh token" {
+		t.Fatalf("expected invalid refresh token, got %v", err)
+	}
+
+	// Deleted users cannot refresh
+	if err := deps.userRepo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := deps.sessions.Refresh(ctx, refreshed.RefreshToken); err == nil || err.Error() != "invalid refresh token" {
+		t.Fatalf("expected invalid refresh token for deleted user, got %v", err)
+	}
+}
+
+func TestSessionLimitAndRevokeAll(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.Sessions.MaxConcurrent = 2
+	deps := newAuthDeps(t, cfg)
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var sessionIDs []uuid.UUID
+	for i := 0; i < 3; i++ {
+		tokens, err := deps.sessions.Start(ctx, user, testIP, testUserAgent)
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		sessionIDs = append(sessionIDs, tokens.SessionID)
+	}
+
+	// The oldest session was revoked to stay within the limit
+	if err := deps.sessions.CheckSession(ctx, user.ID, sessionIDs[0]); err == nil || err.Error() != "session revoked" {
+		t.Fatalf("expected oldest session revoked, got %v", err)
+	}
+	if err := deps.sessions.CheckSession(ctx, user.ID, sessionIDs[2]); err != nil {
+		t.Fatalf("CheckSession: %v", err)
+	}
+	if err := deps.sessions.CheckSession(ctx, uuid.New(), sessionIDs[2]); err == nil || err.Error() != "session revoked" {
+		t.Fatalf("expected another user's session to be rejected, got %v", err)
+	}
+
+	sessions, err := deps.sessions.ListSessions(ctx, user.ID, sessionIDs[1])
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != sessionIDs[2] || sessions[0].Current || !sessions[1].Current {
+		t.Fatalf("expected the two newest sessions with the second marked current, got %+v", sessions)
+	}
+
+	revoked, err := deps.sessions.RevokeAllSessions(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+	if revoked != 2 {
+		t.Fatalf("expected 2 sessions revoked, got %d", revoked)
+	}
+	for _, id := range sessionIDs {
+		if err := deps.sessions.CheckSession(ctx, user.ID, id); err == nil || err.Error() != "session revoked" {
+			t.Fatalf("expected session %s revoked, got %v", id, err)
+		}
+	}
+
+	events, err := deps.eventRepo.ListAfter(ctx, 0, 100)
+	if err != nil {
+		t.Fatalf("ListAfter: %v", err)
+	}
+	var revokedEvents int
+	for _, event := range events {
+		if event.Type == "sessions.revoked" {
+			revokedEvents++
+		}
+	}
+	if revokedEvents != 2 {
+		t.Fatalf("expected a sessions.revoked event for the limit and one for signing out, got %d", revokedEvents)
+	}
+}
+
+func TestSessionCountryConflicts(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.Sessions.CountryConflicts = config.CountryConflictsDeny
+	deps := newAuthDeps(t, cfg)
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	first, err := deps.sessions.Start(geo.NewContext(ctx, "IR"), user, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Sign-ins from the same or an unknown country don't conflict
+	if _, err := deps.sessions.Start(geo.NewContext(ctx, "IR"), user, testIP, testUserAgent); err != nil {
+		t.Fatalf("Start from the same country: %v", err)
+	}
+	if _, err := deps.sessions.Start(ctx, user, testIP, testUserAgent); err != nil {
+		t.Fatalf("Start from an unknown country: %v", err)
+	}
+
+	if _, err := deps.sessions.Start(geo.NewContext(ctx, "DE"), user, testIP, testUserAgent); !errors.Is(err, service.ErrCountryConflict) {
+		t.Fatalf("expected ErrCountryConflict, got %v", err)
+	}
+	sessions, err := deps.sessions.ListSessions(ctx, user.ID, first.SessionID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 3 || sessions[2].Country != "IR" {
+		t.Fatalf("expected the three sessions signed in, the first from IR, got %+v", sessions)
+	}
+
+	// Once the other sessions are ended, the user can sign in from elsewhere
+	if _, err := deps.sessions.RevokeAllSessions(ctx, user.ID); err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+	if _, err := deps.sessions.Start(geo.NewContext(ctx, "DE"), user, testIP, testUserAgent); err != nil {
+		t.Fatalf("Start after revoking: %v", err)
+	}
+
+	// With notify, the sign-in goes through and is only reported
+	cfg.Sessions.CountryConflicts = config.CountryConflictsNotify
+	if _, err := deps.sessions.Start(geo.NewContext(ctx, "FR"), user, testIP, testUserAgent); err != nil {
+		t.Fatalf("Start with notify: %v", err)
+	}
+
+	events, err := deps.eventRepo.ListAfter(ctx, 0, 100)
+	if err != nil {
+		t.Fatalf("ListAfter: %v", err)
+	}
+	var denied []bool
+	for _, event := range events {
+		if event.Type == models.EventSessionCountryConflict {
+			var payload struct {
+				Denied bool `json:"denied"`
+			}
+			if err := json.Unmarshal(event.Payload, &payload); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			denied = append(denied, payload.Denied)
+		}
+	}
+	if len(denied) != 2 || !denied[0] || denied[1] {
+		t.Fatalf("expected a denied and a notified session.country_conflict event, got %v", denied)
+	}
+}
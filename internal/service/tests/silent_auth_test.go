@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/silentauth"
+)
+
+func TestSignInSilently(t *testing.T) {
+	ctx := context.Background()
+
+	// Without carrier support, every phone number is verified by OTP
+	deps := newAuthDeps(t, testConfig())
+	_, _, err := deps.authService.SignInSilently(silentauth.NewContext(ctx, "15550001"), "+15550001", "", testIP, testUserAgent)
+	if !errors.Is(err, silentauth.ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+
+	cfg := testConfig()
+	cfg.SilentAuth.Provider = silentauth.ProviderHeader
+	deps = newAuthDeps(t, cfg)
+
+	// Requests that didn't come through the enrichment proxy fall back to OTP
+	_, _, err = deps.authService.SignInSilently(ctx, "+15550001", "", testIP, testUserAgent)
+	if !errors.Is(err, silentauth.ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+
+	tokens, user, err := deps.authService.SignInSilently(silentauth.NewContext(ctx, "15550001"), "+15550001", "", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("SignInSilently: %v", err)
+	}
+	if tokens.AccessToken == "" || !user.PhoneVerified || user.VerifiedSource == nil || *user.VerifiedSource != models.VerifiedSourceCarrier {
+		t.Fatalf("expected a session for a user verified by the carrier, got %+v, %+v", tokens, user)
+	}
+
+	// Another device on the carrier's network can't sign in as the user
+	_, _, err = deps.authService.SignInSilently(silentauth.NewContext(ctx, "15550002"), "+15550001", "", testIP, testUserAgent)
+	if !errors.Is(err, service.ErrNotVerified) {
+		t.Fatalf("err = %v, want ErrNotVerified", err)
+	}
+
+	attempts, _, err := deps.loginHistoryRepo.ListByUser(ctx, user.ID, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 login attempts, got %d", len(attempts))
+	}
+	for _, attempt := range attempts {
+		if attempt.Method != models.LoginMethodSilentNetwork {
+			t.Fatalf("expected silent network logins, got %q", attempt.Method)
+		}
+		if !attempt.Success && (attempt.FailureReason == nil || *attempt.FailureReason != models.LoginFailureNotVerified) {
+			t.Fatalf("expected the failure to be recorded as not verified, got %v", attempt.FailureReason)
+		}
+	}
+}
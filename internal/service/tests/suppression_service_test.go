@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
+
+func newSuppressionService(t *testing.T) (*service.SuppressionService, *authDeps, *recordingAuditRepository) {
+	t.Helper()
+
+	cfg := testConfig()
+	cfg.SMS.Providers = []config.SMSProviderConfig{
+		{Name: "primary", Type: sms.ProviderTypeLog, CallbackToken: "primary-token"},
+		{Name: "secondary", Type: sms.ProviderTypeLog},
+	}
+	deps := newAuthDeps(t, cfg)
+	auditRepo := &recordingAuditRepository{}
+	suppressionService := service.NewSuppressionService(
+		deps.suppressionRepo,
+		service.NewAuditService(auditRepo),
+		service.NewEventService(deps.eventRepo),
+		cfg,
+	)
+	return suppressionService, deps, auditRepo
+}
+
+func TestProviderCallbackSuppressesPhoneNumber(t *testing.T) {
+	ctx := context.Background()
+	suppressionService, deps, _ := newSuppressionService(t)
+
+	stop := models.ProviderCallbackRequest{PhoneNumber: "09121234567", Status: models.ProviderCallbackStop}
+	if err := suppressionService.HandleProviderCallback(ctx, "primary", "primary-token", stop); err != nil {
+		t.Fatalf("HandleProviderCallback: %v", err)
+	}
+
+	_, err := deps.authService.GenerateOTP(ctx, "+989121234567", testIP, testUserAgent)
+	if !errors.Is(err, sms.ErrPhoneSuppressed) {
+		t.Fatalf("expected ErrPhoneSuppressed after STOP, got %v", err)
+	}
+
+	suppressions, err := suppressionService.Export(ctx)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	want := models.Suppression{PhoneNumber: "+989121234567", Reason: models.SuppressionOptedOut, Source: "primary"}
+	if len(suppressions) != 1 || suppressions[0].PhoneNumber != want.PhoneNumber ||
+		suppressions[0].Reason != want.Reason || suppressions[0].Source != want.Source {
+		t.Fatalf("expected %+v, got %+v", want, suppressions)
+	}
+}
+
+func TestProviderCallbackRejections(t *testing.T) {
+	ctx := context.Background()
+	suppressionService, deps, _ := newSuppressionService(t)
+
+	undeliverable := models.ProviderCallbackRequest{PhoneNumber: "+989121234567", Status: models.ProviderCallbackUndeliverable}
+	tests := []struct {
+		name     string
+		provider string
+		token    string
+		req      models.ProviderCallbackRequest
+		wantErr  string
+	}{
+		{"unknown provider", "other", "primary-token", undeliverable, "unknown provider"},
+		{"callbacks disabled", "secondary", "", undeliverable, "unknown provider"},
+		{"wrong token", "primary", "wrong", undeliverable, "invalid callback token"},
+		{"invalid phone number", "primary", "primary-token", models.ProviderCallbackRequest{PhoneNumber: "123", Status: models.ProviderCallbackStop}, "invalid phone number"},
+		{"other status", "primary", "primary-token", models.ProviderCallbackRequest{PhoneNumber: "+989121234567", Status: "delivered"}, ""},
+	}
+	for _, tt := range tests {
+		err := suppressionService.HandleProviderCallback(ctx, tt.provider, tt.token, tt.req)
+		if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+
+	if suppressed, _ := deps.suppressionRepo.IsSuppressed(ctx, "+989121234567"); suppressed {
+		t.Fatal("expected rejected and ignored callbacks not to suppress the phone number")
+	}
+}
+
+func TestImportAndRemoveSuppressions(t *testing.T) {
+	ctx := context.Background()
+	suppressionService, deps, auditRepo := newSuppressionService(t)
+	actor := models.AuditActor{ID: uuid.New()}
+
+	response, err := suppressionService.Import(ctx, actor, []models.ImportSuppression{
+		{PhoneNumber: "09121234567", Reason: models.SuppressionOptedOut},
+		{PhoneNumber: "+989121234567", Reason: models.SuppressionOptedOut}, // same number, another format
+		{PhoneNumber: "+989121234567", Reason: models.SuppressionCarrierBounce},
+		{PhoneNumber: "123", Reason: models.SuppressionOptedOut},
+	})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if response.Added != 2 || response.Skipped != 1 || response.Failed != 1 {
+		t.Fatalf("expected 2 added, 1 skipped and 1 failed, got %+v", response)
+	}
+	if len(auditRepo.entries) != 1 || auditRepo.entries[0].TargetID != response.BatchID.String() {
+		t.Fatalf("expected the import to be audited by batch ID, got %+v", auditRepo.entries)
+	}
+
+	removed, err := suppressionService.Remove(ctx, actor, "09121234567", models.SuppressionOptedOut)
+	if err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 entry removed, got %d", removed)
+	}
+	if suppressed, _ := deps.suppressionRepo.IsSuppressed(ctx, "+989121234567"); !suppressed {
+		t.Fatal("expected the carrier bounce to keep the phone number suppressed")
+	}
+
+	if removed, err = suppressionService.Remove(ctx, actor, "+989121234567", ""); err != nil || removed != 1 {
+		t.Fatalf("expected the remaining entry to be removed, got %d, %v", removed, err)
+	}
+	if _, err := deps.authService.GenerateOTP(ctx, "+989121234567", testIP, testUserAgent); err != nil {
+		t.Fatalf("GenerateOTP after removal: %v", err)
+	}
+
+	if _, err := suppressionService.Remove(ctx, actor, "+989121234567", "unknown"); err == nil || err.Error() != "invalid reason" {
+		t.Fatalf("expected invalid reason error, got %v", err)
+	}
+}
+
+func TestDismissedAbuseReportKeepsOptOut(t *testing.T) {
+	ctx := context.Background()
+	suppressionService, deps, _ := newSuppressionService(t)
+	eventService := service.NewEventService(deps.eventRepo)
+	abuseReportService := service.NewAbuseReportService(
+		repository.NewInMemoryAbuseReportRepository(),
+		suppressionService,
+		service.NewAuditService(&recordingAuditRepository{}),
+		eventService,
+	)
+
+	report, err := abuseReportService.Report(ctx, models.AbuseReportRequest{
+		PhoneNumber:  "+989121234567",
+		ReporterType: models.AbuseReporterCarrier,
+	}, testIP)
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if _, err := suppressionService.Suppress(ctx, "+989121234567", models.SuppressionOptedOut, "primary"); err != nil {
+		t.Fatalf("Suppress: %v", err)
+	}
+	if _, err := abuseReportService.ReviewReport(ctx, models.AuditActor{ID: uuid.New()}, report.ID, models.AbuseReportDismissed); err != nil {
+		t.Fatalf("ReviewReport: %v", err)
+	}
+
+	suppressions, err := suppressionService.Export(ctx)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(suppressions) != 1 || suppressions[0].Reason != models.SuppressionOptedOut {
+		t.Fatalf("expected only the opt-out to remain, got %+v", suppressions)
+	}
+}
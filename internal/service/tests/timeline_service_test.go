@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestUserTimeline(t *testing.T) {
+	ctx := context.Background()
+	eventRepo := repository.NewInMemoryEventRepository()
+	userRepo := repository.NewInMemoryUserRepository()
+	auditRepo := &recordingAuditRepository{}
+	logins := repository.NewInMemoryLoginHistoryRepository()
+	sessions := repository.NewInMemorySessionRepository()
+	timelineService := service.NewTimelineService(userRepo, auditRepo, eventRepo, logins, sessions, testConfig())
+
+	user, err := userRepo.Create(ctx, "+989121234567")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	base := time.Now().Add(-time.Hour)
+
+	// An OTP requested before signing up, about the phone number
+	events := []models.DomainEvent{
+		{Type: models.EventOTPRequested, AggregateType: models.AggregatePhone, AggregateID: user.PhoneNumber, OccurredAt: base},
+		{Type: models.EventUserCreated, AggregateType: models.AggregateUser, AggregateID: user.ID.String(), OccurredAt: base.Add(2 * time.Minute)},
+		// Someone else's event stays out
+		{Type: models.EventOTPRequested, AggregateType: models.AggregatePhone, AggregateID: "+989127654321", OccurredAt: base.Add(3 * time.Minute)},
+	}
+	for i := range events {
+		if err := eventRepo.Append(ctx, &events[i]); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	lockedOut := "locked_out"
+	attempts := []models.LoginAttempt{
+		{ID: uuid.New(), UserID: &user.ID, Method: "otp", FailureReason: &lockedOut, CreatedAt: base.Add(time.Minute)},
+		{ID: uuid.New(), UserID: &user.ID, Method: "otp", Success: true, CreatedAt: base.Add(4 * time.Minute)},
+	}
+	for i := range attempts {
+		if err := logins.Record(ctx, &attempts[i]); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	session := &models.Session{ID: uuid.New(), UserID: user.ID, CreatedAt: base.Add(5 * time.Minute), ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := sessions.Create(ctx, session, 0); err != nil {
+		t.Fatalf("Create session: %v", err)
+	}
+	auditRepo.Create(ctx, &models.AuditLog{Action: service.AuditActionRateLimitFlush, TargetType: service.AuditTargetPhone, TargetID: user.PhoneNumber, CreatedAt: base.Add(6 * time.Minute)})
+
+	entries, total, err := timelineService.GetTimeline(ctx, user.ID, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("GetTimeline: %v", err)
+	}
+	want := []struct{ kind, entryType string }{
+		{service.TimelineAudit, service.AuditActionRateLimitFlush},
+		{service.TimelineSession, "started"},
+		{service.TimelineLogin, "otp"},
+		{service.TimelineEvent, models.EventUserCreated},
+		{service.TimelineLogin, "otp"},
+		{service.TimelineEvent, models.EventOTPRequested},
+	}
+	if total != int64(len(want)) || len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d of %d: %+v", len(want), len(entries), total, entries)
+	}
+	for i, w := range want {
+		if entries[i].Kind != w.kind || entries[i].Type != w.entryType {
+			t.Fatalf("entry %d: expected %s %s, got %s %s", i, w.kind, w.entryType, entries[i].Kind, entries[i].Type)
+		}
+	}
+
+	// Pages continue where the previous one ended
+	page, total, err := timelineService.GetTimeline(ctx, user.ID, models.PaginationParams{Page: 2, PageSize: 4})
+	if err != nil {
+		t.Fatalf("GetTimeline: %v", err)
+	}
+	if total != 6 || len(page) != 2 || page[0].Type != entries[4].Type || page[1].Type != models.EventOTPRequested {
+		t.Fatalf("expected the last 2 entries on page 2, got %+v", page)
+	}
+
+	var validationErr *service.ValidationError
+	if _, _, err := timelineService.GetTimeline(ctx, user.ID, models.PaginationParams{Page: 1000, PageSize: 10}); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error for a page too deep, got %v", err)
+	}
+	if _, _, err := timelineService.GetTimeline(ctx, uuid.New(), models.PaginationParams{Page: 1, PageSize: 10}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for an unknown user, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func newTokenExchangeService(t *testing.T) (*service.TokenExchangeService, string, *models.User) {
+	t.Helper()
+	return newTokenExchangeServiceWithRegistry(t, metrics.NewRegistry())
+}
+
+// newTokenExchangeServiceWithRegistry creates a token exchange service recording its metrics in
+// registry, configured by tokenExchangeTestConfig
+func newTokenExchangeServiceWithRegistry(t *testing.T, registry *metrics.Registry) (*service.TokenExchangeService, string, *models.User) {
+	t.Helper()
+
+	exchangeService, token, user, _ := newTokenExchangeDeps(t, tokenExchangeTestConfig(), registry)
+	return exchangeService, token, user
+}
+
+// newTokenExchangeDeps creates a token exchange service with cfg and a token of a new user,
+// along with the session service the token's session is kept by
+func newTokenExchangeDeps(t *testing.T, cfg *config.Config, registry *metrics.Registry) (*service.TokenExchangeService, string, *models.User, *service.SessionService) {
+	t.Helper()
+
+	deps := newAuthDeps(t, cfg)
+	user, err := deps.userRepo.Create(context.Background(), "09120000001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	token, err := deps.authService.IssueToken(context.Background(), user)
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+
+	exchangeService := service.NewTokenExchangeService(deps.userRepo, deps.sessions, service.NewEventService(repository.NewInMemoryEventRepository()), service.NewTokenSigner(cfg, nil), registry, cfg)
+	return exchangeService, token, user, deps.sessions
+}
+
+// tokenExchangeTestConfig enables token exchange for the billing and reports gateways. The
+// billing gateway is rotating its API key; the reports gateway's rotation is over.
+func tokenExchangeTestConfig() *config.Config {
+	cfg := testConfig()
+	cfg.TokenExchange = config.TokenExchangeConfig{
+		Secret:     "exchange-secret",
+		Expiration: 5,
+		Clients: []config.TokenExchangeClient{{
+			Name:      "billing-gateway",
+			APIKey:    "billing-key",
+			Audiences: []string{"billing"},
+			Scopes:    []string{"invoices:read", "invoices:write"},
+
+			PreviousAPIKey:       "old-billing-key",
+			PreviousAPIKeyExpiry: time.Now().Add(time.Hour).Format(time.RFC3339),
+		}, {
+			Name:      "reports-gateway",
+			APIKey:    "reports-key",
+			Audiences: []string{"reports"},
+
+			PreviousAPIKey:       "old-reports-key",
+			PreviousAPIKeyExpiry: time.Now().Add(-time.Hour).Format(time.RFC3339),
+		}},
+	}
+	return cfg
+}
+
+func exchangeRequest(subjectToken, audience, scope string) *models.TokenExchangeRequest {
+	return &models.TokenExchangeRequest{
+		GrantType:        models.GrantTypeTokenExchange,
+		SubjectToken:     subjectToken,
+		SubjectTokenType: models.TokenTypeAccessToken,
+		Audience:         audience,
+		Scope:            scope,
+	}
+}
+
+func TestTokenExchange(t *testing.T) {
+	exchangeService, subjectToken, user := newTokenExchangeService(t)
+
+	response, err := exchangeService.Exchange(context.Background(), "billing-key", exchangeRequest(subjectToken, "billing", "invoices:read"))
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if response.IssuedTokenType != models.TokenTypeAccessToken || response.TokenType != "Bearer" ||
+		response.Scope != "invoices:read" || response.ExpiresIn <= 0 || response.ExpiresIn > 300 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+
+	token, err := jwt.Parse(response.AccessToken, func(*jwt.Token) (interface{}, error) {
+		return []byte("exchange-secret"), nil
+	})
+	if err != nil || !token.Valid {
+		t.Fatalf("expected token signed with the exchange secret: %v", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["sub"] != user.ID.String() || claims["aud"] != "billing" || claims["scope"] != "invoices:read" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+	if act, ok := claims["act"].(map[string]interface{}); !ok || act["sub"] != "billing-gateway" {
+		t.Fatalf("expected actor claim for the client, got %v", claims["act"])
+	}
+
+	// Exchanged tokens cannot be exchanged again or used as user tokens
+	_, err = exchangeService.Exchange(context.Background(), "billing-key", exchangeRequest(response.AccessToken, "billing", ""))
+	assertExchangeError(t, err, "invalid_grant")
+}
+
+func TestTokenExchangeDefaultsToClientScopes(t *testing.T) {
+	exchangeService, subjectToken, _ := newTokenExchangeService(t)
+
+	response, err := exchangeService.Exchange(context.Background(), "billing-key", exchangeRequest(subjectToken, "billing", ""))
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if response.Scope != "invoices:read invoices:write" {
+		t.Fatalf("expected every client scope, got %q", response.Scope)
+	}
+}
+
+func TestTokenExchangeRejections(t *testing.T) {
+	exchangeService, subjectToken, _ := newTokenExchangeService(t)
+	ctx := context.Background()
+
+	_, err := exchangeService.Exchange(ctx, "wrong-key", exchangeRequest(subjectToken, "billing", ""))
+	assertExchangeError(t, err, "invalid_client")
+
+	_, err = exchangeService.Exchange(ctx, "billing-key", exchangeRequest(subjectToken, "payroll", ""))
+	assertExchangeError(t, err, "invalid_target")
+
+	_, err = exchangeService.Exchange(ctx, "billing-key", exchangeRequest(subjectToken, "billing", "invoices:read admin"))
+	assertExchangeError(t, err, "invalid_scope")
+
+	_, err = exchangeService.Exchange(ctx, "billing-key", exchangeRequest("not-a-token", "billing", ""))
+	assertExchangeError(t, err, "invalid_grant")
+
+	req := exchangeRequest(subjectToken, "billing", "")
+	req.GrantType = "password"
+	_, err = exchangeService.Exchange(ctx, "billing-key", req)
+	assertExchangeError(t, err, "unsupported_grant_type")
+
+	req = exchangeRequest(subjectToken, "billing", "")
+	req.SubjectTokenType = "urn:ietf:params:oauth:token-type:saml2"
+	_, err = exchangeService.Exchange(ctx, "billing-key", req)
+	assertExchangeError(t, err, "invalid_request")
+}
+
+func TestTokenExchangeRejectsRevokedSessions(t *testing.T) {
+	cfg := tokenExchangeTestConfig()
+	exchangeService, subjectToken, user, sessions := newTokenExchangeDeps(t, cfg, metrics.NewRegistry())
+	ctx := context.Background()
+
+	if _, err := sessions.RevokeAllSessions(ctx, user.ID); err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+	_, err := exchangeService.Exchange(ctx, "billing-key", exchangeRequest(subjectToken, "billing", ""))
+	assertExchangeError(t, err, "invalid_grant")
+
+	// Tokens without a session could never be revoked, so they are refused too
+	sessionless, err := service.NewTokenSigner(cfg, nil).Sign(ctx, jwt.MapClaims{
+		"user_id":      user.ID.String(),
+		"phone_number": user.PhoneNumber,
+		"exp":          time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	_, err = exchangeService.Exchange(ctx, "billing-key", exchangeRequest(sessionless, "billing", ""))
+	assertExchangeError(t, err, "invalid_grant")
+}
+
+func TestTokenExchangePreviousAPIKey(t *testing.T) {
+	registry := metrics.NewRegistry()
+	exchangeService, subjectToken, _ := newTokenExchangeServiceWithRegistry(t, registry)
+	ctx := context.Background()
+
+	// Both keys work while the billing gateway switches over
+	for _, apiKey := range []string{"billing-key", "old-billing-key", "old-billing-key"} {
+		if _, err := exchangeService.Exchange(ctx, apiKey, exchangeRequest(subjectToken, "billing", "")); err != nil {
+			t.Fatalf("Exchange with %q: %v", apiKey, err)
+		}
+	}
+
+	// Previous keys stop working at their expiry
+	_, err := exchangeService.Exchange(ctx, "old-reports-key", exchangeRequest(subjectToken, "reports", ""))
+	assertExchangeError(t, err, "invalid_client")
+
+	var sb strings.Builder
+	if _, err := registry.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	for _, want := range []string{
+		`token_exchange_api_key_uses_total{client="billing-gateway",key="current"} 1`,
+		`token_exchange_api_key_uses_total{client="billing-gateway",key="previous"} 2`,
+		`token_exchange_api_key_last_used_timestamp_seconds{client="billing-gateway",key="previous"}`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("expected metrics to contain %s, got:\n%s", want, sb.String())
+		}
+	}
+	if strings.Contains(sb.String(), "reports-gateway") {
+		t.Errorf("expected no uses of the expired key to be counted, got:\n%s", sb.String())
+	}
+}
+
+func TestTokenExchangeDisabled(t *testing.T) {
+	exchangeService, token, _, _ := newTokenExchangeDeps(t, testConfig(), metrics.NewRegistry())
+	_, err := exchangeService.Exchange(context.Background(), "billing-key", exchangeRequest(token, "billing", ""))
+	if err == nil || err.Error() != "token exchange disabled" {
+		t.Fatalf("expected token exchange disabled, got %v", err)
+	}
+}
+
+func assertExchangeError(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var exchangeErr *service.TokenExchangeError
+	if !errors.As(err, &exchangeErr) || exchangeErr.Code != code {
+		t.Fatalf("expected %s, got %v", code, err)
+	}
+}
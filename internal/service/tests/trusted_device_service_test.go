@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestSignInWithTrustedDevice(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.OTP.TrustedDevices.Enabled = true
+	deps := newAuthDeps(t, cfg)
+	authService, userRepo := deps.authService, deps.userRepo
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	other, err := userRepo.Create(ctx, "+15550002")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	deviceToken, err := authService.TrustDevice(ctx, user, "", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("TrustDevice: %v", err)
+	}
+
+	tokens, signedIn, err := authService.SignInWithDevice(ctx, user.PhoneNumber, deviceToken, testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("SignInWithDevice: %v", err)
+	}
+	if tokens.AccessToken == "" || signedIn.ID != user.ID {
+		t.Fatalf("expected a token for %s, got %q for %s", user.ID, tokens.AccessToken, signedIn.ID)
+	}
+
+	// The device token only works for the user it was issued to
+	for _, tc := range []struct {
+		name, phoneNumber, token string
+	}{
+		{"other user", other.PhoneNumber, deviceToken},
+		{"unknown user", "+15550003", deviceToken},
+		{"wrong token", user.PhoneNumber, "not-a-device-token"},
+		{"no token", user.PhoneNumber, ""},
+	} {
+		if _, _, err := authService.SignInWithDevice(ctx, tc.phoneNumber, tc.token, testIP, testUserAgent); err == nil || err.Error() != "invalid device token" {
+			t.Fatalf("%s: expected invalid device token, got %v", tc.name, err)
+		}
+	}
+
+	logins, total, err := deps.loginHistoryRepo.ListByUser(ctx, user.ID, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	if total != 1 || logins[0].Method != models.LoginMethodTrustedDevice || !logins[0].Success {
+		t.Fatalf("expected one trusted device login, got %+v", logins)
+	}
+
+	devices, err := deps.devices.ListDevices(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ListDevices: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Name != "Unnamed device" || devices[0].LastUsedAt == nil {
+		t.Fatalf("expected one used unnamed device, got %+v", devices)
+	}
+
+	// A revoked device needs an OTP again
+	if err := deps.devices.RevokeDevice(ctx, other.ID, devices[0].ID); err == nil || err.Error() != "trusted device not found" {
+		t.Fatalf("expected trusted device not found for other user, got %v", err)
+	}
+	if err := deps.devices.RevokeDevice(ctx, user.ID, devices[0].ID); err != nil {
+		t.Fatalf("RevokeDevice: %v", err)
+	}
+	if _, _, err := authService.SignInWithDevice(ctx, user.PhoneNumber, deviceToken, testIP, testUserAgent); err == nil || err.Error() != "invalid device token" {
+		t.Fatalf("expected invalid device token after revoking, got %v", err)
+	}
+	if err := deps.devices.RevokeDevice(ctx, user.ID, devices[0].ID); err == nil || err.Error() != "trusted device not found" {
+		t.Fatalf("expected trusted device not found when revoking twice, got %v", err)
+	}
+	if devices, err := deps.devices.ListDevices(ctx, user.ID); err != nil || len(devices) != 0 {
+		t.Fatalf("expected no devices after revoking, got %+v, %v", devices, err)
+	}
+}
+
+func TestSignInWithTrustedDeviceBlockedOrLockedOut(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.OTP.TrustedDevices.Enabled = true
+	deps := newAuthDeps(t, cfg)
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	deviceToken, err := deps.authService.TrustDevice(ctx, user, "", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("TrustDevice: %v", err)
+	}
+
+	// A trusted device doesn't get around the blocklist
+	if _, err := deps.phoneListRepo.Add(ctx, &models.PhoneListEntry{List: models.PhoneListBlock, Prefix: "+1555"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if tokens, _, err := deps.authService.SignInWithDevice(ctx, user.PhoneNumber, deviceToken, testIP, testUserAgent); err == nil || err.Error() != "phone number blocked" {
+		t.Fatalf("expected phone number blocked, got %+v, %v", tokens, err)
+	}
+	if _, err := deps.phoneListRepo.Remove(ctx, models.PhoneListBlock, "+1555"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	// Nor around a lockout after too many wrong codes
+	if _, err := deps.otpRepo.RecordFailedVerification(ctx, user.PhoneNumber, 1, 15*time.Minute, 30*time.Minute); err != nil {
+		t.Fatalf("RecordFailedVerification: %v", err)
+	}
+	var lockoutErr *service.LockoutError
+	if tokens, _, err := deps.authService.SignInWithDevice(ctx, user.PhoneNumber, deviceToken, testIP, testUserAgent); !errors.As(err, &lockoutErr) {
+		t.Fatalf("expected lockout error, got %+v, %v", tokens, err)
+	}
+
+	// The locked out attempt is recorded as failed
+	logins, total, err := deps.loginHistoryRepo.ListByUser(ctx, user.ID, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	if total != 1 || logins[0].Success || logins[0].FailureReason == nil || *logins[0].FailureReason != models.LoginFailureLockedOut {
+		t.Fatalf("expected one locked out trusted device login, got %+v", logins)
+	}
+}
+
+func TestTrustDeviceDisabled(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+
+	user, err := deps.userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := deps.authService.TrustDevice(ctx, user, "Laptop", testIP, testUserAgent); err == nil || err.Error() != "trusted devices disabled" {
+		t.Fatalf("expected trusted devices disabled, got %v", err)
+	}
+	if err := deps.devices.RevokeDevice(ctx, user.ID, uuid.New()); err == nil || err.Error() != "trusted device not found" {
+		t.Fatalf("expected trusted device not found, got %v", err)
+	}
+}
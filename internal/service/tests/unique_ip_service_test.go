@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// failingUniqueIPRepository fails to record IPs until it is told to succeed
+type failingUniqueIPRepository struct {
+	*repository.InMemoryUniqueIPRepository
+	fail bool
+}
+
+func (r *failingUniqueIPRepository) AddIPs(ctx context.Context, day time.Time, ipsByEndpoint map[string][]string) error {
+	if r.fail {
+		return errors.New("redis unavailable")
+	}
+	return r.InMemoryUniqueIPRepository.AddIPs(ctx, day, ipsByEndpoint)
+}
+
+func TestUniqueIPStats(t *testing.T) {
+	ctx := context.Background()
+	uniqueIPRepo := &failingUniqueIPRepository{InMemoryUniqueIPRepository: repository.NewInMemoryUniqueIPRepository(), fail: true}
+	uniqueIPs := service.NewUniqueIPService(uniqueIPRepo, metrics.NewRegistry(), logging.Discard())
+
+	uniqueIPs.RecordIP("POST /v1/auth/request-otp", "203.0.113.1")
+	uniqueIPs.RecordIP("POST /v1/auth/request-otp", "203.0.113.2")
+	uniqueIPs.RecordIP("POST /v1/auth/request-otp", "203.0.113.1")
+	uniqueIPs.RecordIP("POST /v1/auth/verify-otp", "203.0.113.1")
+
+	// IPs that could not be written are kept for the next flush
+	if err := uniqueIPs.Flush(ctx); err == nil {
+		t.Fatal("expected flush to fail")
+	}
+	uniqueIPRepo.fail = false
+	uniqueIPs.RecordIP("POST /v1/auth/verify-otp", "203.0.113.3")
+	if err := uniqueIPs.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	stats, err := uniqueIPs.GetUniqueIPStats(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("GetUniqueIPStats: %v", err)
+	}
+	want := map[string]int64{"POST /v1/auth/request-otp": 2, "POST /v1/auth/verify-otp": 2}
+	if stats.Date != time.Now().UTC().Format("2006-01-02") || !reflect.DeepEqual(stats.Endpoints, want) {
+		t.Fatalf("expected %v for today, got %+v", want, stats)
+	}
+
+	// Other days are counted separately
+	stats, err = uniqueIPs.GetUniqueIPStats(ctx, time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("GetUniqueIPStats: %v", err)
+	}
+	if len(stats.Endpoints) != 0 {
+		t.Fatalf("expected no IPs yesterday, got %+v", stats.Endpoints)
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestExportUsersInChunks(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	auditRepo := &recordingAuditRepository{}
+	exportService := service.NewUserExportService(userRepo, service.NewAuditService(auditRepo), logging.Discard())
+
+	// More users than are listed at a time
+	const total = 2500
+	for i := 0; i < total; i++ {
+		if _, err := userRepo.Create(ctx, fmt.Sprintf("+98912%07d", i)); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	chunks := 0
+	exported, err := exportService.Export(ctx, models.AuditActor{}, models.UserExportFormatCSV, models.PaginationParams{}, func(users []models.User) error {
+		chunks++
+		for _, user := range users {
+			if seen[user.ID] {
+				t.Fatalf("user %s exported twice", user.ID)
+			}
+			seen[user.ID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if exported != total || len(seen) != total || chunks != 3 {
+		t.Fatalf("exported %d users (%d distinct) in %d chunks, want %d in 3", exported, len(seen), chunks, total)
+	}
+	if len(auditRepo.entries) != 1 || auditRepo.entries[0].Action != service.AuditActionUserExport {
+		t.Fatalf("expected one user.export audit entry, got %+v", auditRepo.entries)
+	}
+
+	// Filters apply, and write errors end the export
+	failed := errors.New("client went away")
+	exported, err = exportService.Export(ctx, models.AuditActor{}, models.UserExportFormatJSONL, models.PaginationParams{Search: "+98912000000"}, func(users []models.User) error {
+		if len(users) != 10 {
+			t.Fatalf("expected the 10 users matching the search, got %d", len(users))
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) || exported != 0 {
+		t.Fatalf("expected the write error after no users, got %d, %v", exported, err)
+	}
+
+	var validationErr *service.ValidationError
+	for _, tc := range []struct {
+		format string
+		params models.PaginationParams
+	}{
+		{"xlsx", models.PaginationParams{}},
+		{models.UserExportFormatCSV, models.PaginationParams{SortBy: models.UserSortPhoneNumber}},
+		{models.UserExportFormatCSV, models.PaginationParams{Order: "random"}},
+	} {
+		_, err := exportService.Export(ctx, models.AuditActor{}, tc.format, tc.params, func([]models.User) error {
+			t.Fatal("expected nothing to be written")
+			return nil
+		})
+		if !errors.As(err, &validationErr) {
+			t.Errorf("expected validation error for %s %+v, got %v", tc.format, tc.params, err)
+		}
+	}
+	if len(auditRepo.entries) != 2 {
+		t.Fatalf("expected invalid exports not to be audited, got %d entries", len(auditRepo.entries))
+	}
+}
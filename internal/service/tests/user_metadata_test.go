@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+func TestUpdateUserMetadata(t *testing.T) {
+	ctx := context.Background()
+	eventRepo := repository.NewInMemoryEventRepository()
+	userRepo := repository.NewEventRecordingUserRepository(repository.NewInMemoryUserRepository(), eventRepo)
+	auditRepo := &recordingAuditRepository{}
+	adminService := service.NewAdminService(userRepo, nil, nil, nil, nil, nil, nil, nil, service.NewAuditService(auditRepo), testConfig())
+	userService := newUserService(userRepo)
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	other, err := userRepo.Create(ctx, "+15550002")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	plan, tier := "pro", "gold"
+	updated, err := adminService.UpdateUserMetadata(ctx, models.AuditActor{}, user.ID, map[string]*string{"plan": &plan, "tier": &tier})
+	if err != nil {
+		t.Fatalf("UpdateUserMetadata: %v", err)
+	}
+	if updated.Metadata["plan"] != plan || updated.Metadata["tier"] != tier {
+		t.Fatalf("expected plan and tier set, got %+v", updated.Metadata)
+	}
+	if _, err := adminService.UpdateUserMetadata(ctx, models.AuditActor{}, other.ID, map[string]*string{"plan": &tier}); err != nil {
+		t.Fatalf("UpdateUserMetadata: %v", err)
+	}
+
+	// Keys given as nil are removed, keys left out keep their value
+	updated, err = adminService.UpdateUserMetadata(ctx, models.AuditActor{}, user.ID, map[string]*string{"tier": nil})
+	if err != nil {
+		t.Fatalf("UpdateUserMetadata: %v", err)
+	}
+	if _, ok := updated.Metadata["tier"]; ok || updated.Metadata["plan"] != plan {
+		t.Fatalf("expected tier removed and plan kept, got %+v", updated.Metadata)
+	}
+
+	// Only which keys changed is audited, not their values
+	last := auditRepo.entries[len(auditRepo.entries)-1]
+	if len(auditRepo.entries) != 3 || last.Action != service.AuditActionUserMetadataUpdate || strings.Contains(string(last.Metadata), plan) {
+		t.Fatalf("expected metadata updates audited without values, got %+v", auditRepo.entries)
+	}
+
+	// Users are listed by metadata
+	users, total, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10, Metadata: map[string]string{"plan": plan}})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if total != 1 || len(users) != 1 || users[0].ID != user.ID {
+		t.Fatalf("expected only the user with plan %q, got %d of %d", plan, len(users), total)
+	}
+
+	var validationErr *service.ValidationError
+	long := strings.Repeat("x", 501)
+	for name, update := range map[string]map[string]*string{
+		"no keys":        {},
+		"invalid key":    {"plan[0]": &plan},
+		"value too long": {"plan": &long},
+	} {
+		if _, err := adminService.UpdateUserMetadata(ctx, models.AuditActor{}, user.ID, update); !errors.As(err, &validationErr) {
+			t.Fatalf("%s: expected a validation error, got %v", name, err)
+		}
+	}
+	if _, _, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10, Metadata: map[string]string{"a b": "c"}}); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error for an invalid metadata filter, got %v", err)
+	}
+
+	// The user read model sees the same metadata
+	projection := service.NewUserProjection()
+	if _, err := service.NewEventService(eventRepo).Replay(ctx, 0, 100, projection.Apply); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	for _, projected := range projection.Users() {
+		if projected.ID == user.ID && (len(projected.Metadata) != 1 || projected.Metadata["plan"] != plan) {
+			t.Fatalf("expected the projection to apply metadata updates, got %+v", projected.Metadata)
+		}
+	}
+}
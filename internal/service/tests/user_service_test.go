@@ -0,0 +1,358 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+)
+
+// newUserService creates a user service whose active user counts are kept in memory
+func newUserService(userRepo repository.UserRepository) *service.UserService {
+	eventService := service.NewEventService(repository.NewInMemoryEventRepository())
+	activeUsers := service.NewActiveUserService(repository.NewInMemoryActiveUserRepository(), eventService, logging.Discard())
+	return service.NewUserService(userRepo, repository.NewInMemoryLoginHistoryRepository(), activeUsers, testConfig())
+}
+
+func TestUserServiceGetAndList(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	userService := newUserService(userRepo)
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := userService.GetUserByID(ctx, user.ID)
+	if err != nil || got.PhoneNumber != user.PhoneNumber {
+		t.Fatalf("GetUserByID: %+v, %v", got, err)
+	}
+	if _, err := userService.GetUserByID(ctx, uuid.New()); err == nil {
+		t.Fatal("expected error for unknown user")
+	}
+
+	users, total, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if total != 1 || len(users) != 1 {
+		t.Fatalf("expected 1 user, got %d of %d", len(users), total)
+	}
+}
+
+func TestListUsersPaginationLimits(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.Pagination = config.PaginationConfig{MaxPageSize: 20, MaxSearchLength: 5}
+	userService := service.NewUserService(repository.NewInMemoryUserRepository(), repository.NewInMemoryLoginHistoryRepository(), nil, cfg)
+
+	if _, _, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 20, Search: "+1555"}); err != nil {
+		t.Fatalf("expected limits to be inclusive, got %v", err)
+	}
+
+	var validationErr *service.ValidationError
+	_, _, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 21})
+	if !errors.As(err, &validationErr) || validationErr.Message != "page_size must be at most 20" {
+		t.Fatalf("expected page size validation error, got %v", err)
+	}
+	_, _, err = userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10, Search: "+15550"})
+	if !errors.As(err, &validationErr) || validationErr.Message != "search must be at most 5 characters" {
+		t.Fatalf("expected search length validation error, got %v", err)
+	}
+	_, _, err = userService.ListLoginHistory(ctx, uuid.New(), models.PaginationParams{Page: 1, PageSize: 1000})
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected login history page size validation error, got %v", err)
+	}
+}
+
+func TestListUsersAfterCursor(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	userService := newUserService(userRepo)
+	for i := 0; i < 5; i++ {
+		if _, err := userRepo.Create(ctx, fmt.Sprintf("+1555000%d", i)); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	want, _, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+
+	// Paging by cursor lists the same users in the same order, in pages of 2, 2 and 1
+	var got []models.User
+	params := models.PaginationParams{Limit: 2}
+	for page := 1; ; page++ {
+		users, nextCursor, err := userService.ListUsersAfter(ctx, params)
+		if err != nil {
+			t.Fatalf("ListUsersAfter page %d: %v", page, err)
+		}
+		got = append(got, users...)
+		if nextCursor == "" {
+			if page != 3 {
+				t.Fatalf("last page is page %d, want 3", page)
+			}
+			break
+		}
+		params.Cursor = nextCursor
+	}
+	if len(got) != len(want) {
+		t.Fatalf("listed %d users by cursor, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID {
+			t.Fatalf("user %d = %s, want %s", i, got[i].ID, want[i].ID)
+		}
+	}
+
+	var validationErr *service.ValidationError
+	_, _, err = userService.ListUsersAfter(ctx, models.PaginationParams{Cursor: "not-a-cursor"})
+	if !errors.As(err, &validationErr) || validationErr.Message != "invalid cursor" {
+		t.Fatalf("expected invalid cursor validation error, got %v", err)
+	}
+	_, _, err = userService.ListUsersAfter(ctx, models.PaginationParams{Limit: 1000})
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected limit validation error, got %v", err)
+	}
+}
+
+func TestListUsersSortedAndByCreationTime(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	userService := newUserService(userRepo)
+	for _, phoneNumber := range []string{"+15550002", "+15550000", "+15550001"} {
+		if _, err := userRepo.Create(ctx, phoneNumber); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	users, _, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10, SortBy: models.UserSortPhoneNumber, Order: models.SortAsc})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	for i, user := range users {
+		if want := fmt.Sprintf("+1555000%d", i); user.PhoneNumber != want {
+			t.Fatalf("user %d = %s, want %s", i, user.PhoneNumber, want)
+		}
+	}
+
+	// Oldest first by cursor is newest first reversed
+	newest, _, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	var oldest []models.User
+	params := models.PaginationParams{Limit: 1, Order: models.SortAsc}
+	for {
+		users, nextCursor, err := userService.ListUsersAfter(ctx, params)
+		if err != nil {
+			t.Fatalf("ListUsersAfter: %v", err)
+		}
+		oldest = append(oldest, users...)
+		if nextCursor == "" {
+			break
+		}
+		params.Cursor = nextCursor
+	}
+	if len(oldest) != len(newest) {
+		t.Fatalf("listed %d users oldest first, want %d", len(oldest), len(newest))
+	}
+	for i := range oldest {
+		if oldest[i].ID != newest[len(newest)-1-i].ID {
+			t.Fatalf("user %d listed oldest first is %s", i, oldest[i].PhoneNumber)
+		}
+	}
+
+	// created_after is inclusive and created_before exclusive
+	first := oldest[0].CreatedAt
+	users, total, err := userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10, CreatedAfter: &first})
+	if err != nil || total != 3 || len(users) != 3 {
+		t.Fatalf("expected 3 users created from the first on, got %d of %d, %v", len(users), total, err)
+	}
+	users, total, err = userService.ListUsers(ctx, models.PaginationParams{Page: 1, PageSize: 10, CreatedBefore: &first})
+	if err != nil || total != 0 || len(users) != 0 {
+		t.Fatalf("expected no users created before the first, got %d of %d, %v", len(users), total, err)
+	}
+
+	var validationErr *service.ValidationError
+	for _, params := range []models.PaginationParams{
+		{Page: 1, PageSize: 10, SortBy: "password"},
+		{Page: 1, PageSize: 10, Order: "random"},
+		{Page: 1, PageSize: 10, CreatedAfter: &first, CreatedBefore: &first},
+	} {
+		if _, _, err := userService.ListUsers(ctx, params); !errors.As(err, &validationErr) {
+			t.Errorf("expected validation error for %+v, got %v", params, err)
+		}
+	}
+	_, _, err = userService.ListUsersAfter(ctx, models.PaginationParams{Limit: 10, SortBy: models.UserSortPhoneNumber})
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected sort_by validation error with a cursor, got %v", err)
+	}
+}
+
+func TestListUsersUncounted(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	userService := newUserService(userRepo)
+	for i := 0; i < 3; i++ {
+		if _, err := userRepo.Create(ctx, fmt.Sprintf("+1555000%d", i)); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		params       models.PaginationParams
+		wantUsers    int
+		wantEstimate int64
+		wantMore     bool
+	}{
+		{models.PaginationParams{Page: 1, PageSize: 2, IncludeTotal: models.IncludeTotalFalse}, 2, 0, true},
+		{models.PaginationParams{Page: 2, PageSize: 2, IncludeTotal: models.IncludeTotalFalse}, 1, 0, false},
+		{models.PaginationParams{Page: 1, PageSize: 3, IncludeTotal: models.IncludeTotalFalse}, 3, 0, false},
+		{models.PaginationParams{Page: 1, PageSize: 2, IncludeTotal: models.IncludeTotalEstimate}, 2, 3, true},
+	} {
+		users, estimate, hasMore, err := userService.ListUsersUncounted(ctx, tc.params)
+		if err != nil {
+			t.Fatalf("ListUsersUncounted(%+v): %v", tc.params, err)
+		}
+		if len(users) != tc.wantUsers || estimate != tc.wantEstimate || hasMore != tc.wantMore {
+			t.Errorf("ListUsersUncounted(%+v) = %d users, estimate %d, more %v; want %d, %d, %v",
+				tc.params, len(users), estimate, hasMore, tc.wantUsers, tc.wantEstimate, tc.wantMore)
+		}
+	}
+
+	var validationErr *service.ValidationError
+	_, _, _, err := userService.ListUsersUncounted(ctx, models.PaginationParams{Page: 1, PageSize: 2, IncludeTotal: "maybe"})
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected include_total validation error, got %v", err)
+	}
+}
+
+func TestUserServiceUpdateAndDelete(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	userService := newUserService(userRepo)
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	user.PhoneNumber = "+15550002"
+	if err := userService.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if _, err := userService.GetUserByPhoneNumber(ctx, "+15550002"); err != nil {
+		t.Fatalf("expected updated phone number to be found: %v", err)
+	}
+
+	if err := userService.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := userService.GetUserByID(ctx, user.ID); err == nil {
+		t.Fatal("expected deleted user to be hidden")
+	}
+}
+
+func TestListLoginHistory(t *testing.T) {
+	ctx := context.Background()
+	deps := newAuthDeps(t, testConfig())
+	userService := service.NewUserService(deps.userRepo, deps.loginHistoryRepo, nil, testConfig())
+
+	// A failure before the account exists belongs to no user's history
+	challengeID := storeChallenge(t, deps.otpRepo, "challenge-1", "+15550001", "123456")
+	if _, _, err := deps.authService.VerifyOTP(ctx, challengeID, "000000", testIP, testUserAgent); err == nil {
+		t.Fatal("expected wrong OTP to fail")
+	}
+	_, user, err := deps.authService.VerifyOTP(ctx, challengeID, "123456", testIP, testUserAgent)
+	if err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+
+	challengeID = storeChallenge(t, deps.otpRepo, "challenge-2", "+15550001", "654321")
+	if _, _, err := deps.authService.VerifyBackupCode(ctx, challengeID, "ABCD-EFGH", testIP, testUserAgent); err == nil {
+		t.Fatal("expected wrong backup code to fail")
+	}
+
+	logins, total, err := userService.ListLoginHistory(ctx, user.ID, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListLoginHistory: %v", err)
+	}
+	if total != 2 || len(logins) != 2 {
+		t.Fatalf("expected 2 logins, got %d of %d", len(logins), total)
+	}
+
+	failed, succeeded := logins[0], logins[1]
+	if failed.Success || failed.FailureReason == nil || *failed.FailureReason != models.LoginFailureInvalidCode ||
+		failed.Method != "backup_code" {
+		t.Fatalf("expected the newest login to be the failed one, got %+v", failed)
+	}
+	if !succeeded.Success || succeeded.FailureReason != nil || succeeded.Method != "otp" ||
+		succeeded.IPAddress != testIP || succeeded.UserAgent != testUserAgent {
+		t.Fatalf("expected the successful login, got %+v", succeeded)
+	}
+
+	logins, total, err = userService.ListLoginHistory(ctx, user.ID, models.PaginationParams{Page: 2, PageSize: 1})
+	if err != nil || total != 2 || len(logins) != 1 || !logins[0].Success {
+		t.Fatalf("expected the successful login on page 2, got %+v, %d, %v", logins, total, err)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	ctx := context.Background()
+	eventRepo := repository.NewInMemoryEventRepository()
+	userRepo := repository.NewEventRecordingUserRepository(repository.NewInMemoryUserRepository(), eventRepo)
+	userService := newUserService(userRepo)
+
+	user, err := userRepo.Create(ctx, "+15550001")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	firstName, email := " Sara ", "sara@example.com"
+	updated, err := userService.UpdateProfile(ctx, user.ID, models.UpdateProfileRequest{FirstName: &firstName, Email: &email})
+	if err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if updated.FirstName != "Sara" || updated.Email != email || updated.LastName != "" {
+		t.Fatalf("expected the trimmed first name and email set, got %+v", updated)
+	}
+
+	// Fields left out keep their value, empty strings clear them
+	lastName, cleared := "Ahmadi", ""
+	updated, err = userService.UpdateProfile(ctx, user.ID, models.UpdateProfileRequest{LastName: &lastName, Email: &cleared})
+	if err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if updated.FirstName != "Sara" || updated.LastName != lastName || updated.Email != "" {
+		t.Fatalf("expected a partial update, got %+v", updated)
+	}
+
+	var validationErr *service.ValidationError
+	invalidEmail := "not an email"
+	if _, err := userService.UpdateProfile(ctx, user.ID, models.UpdateProfileRequest{Email: &invalidEmail}); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error for an invalid email, got %v", err)
+	}
+	invalidAvatar := "javascript:alert(1)"
+	if _, err := userService.UpdateProfile(ctx, user.ID, models.UpdateProfileRequest{AvatarURL: &invalidAvatar}); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error for a non-http avatar URL, got %v", err)
+	}
+
+	// The user read model sees the same profile
+	projection := service.NewUserProjection()
+	if _, err := service.NewEventService(eventRepo).Replay(ctx, 0, 100, projection.Apply); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	users := projection.Users()
+	if len(users) != 1 || users[0].FirstName != "Sara" || users[0].LastName != lastName || users[0].Email != "" {
+		t.Fatalf("expected the projection to apply profile updates, got %+v", users)
+	}
+}
@@ -0,0 +1,291 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/service"
+	"github.com/lilokie/otp-auth/internal/webhook"
+)
+
+// webhookReceiver records the requests made to a test webhook endpoint, answering with status
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func newWebhookService(t *testing.T, endpoints ...config.WebhookEndpointConfig) (*service.WebhookService, *service.EventService, *repository.InMemoryEventRepository, *repository.InMemoryWebhookRepository) {
+	t.Helper()
+	return newWebhookServiceWithUsers(t, repository.NewInMemoryUserRepository(), endpoints...)
+}
+
+// newWebhookServiceWithUsers creates a webhook service looking up analytics consent in userRepo
+func newWebhookServiceWithUsers(t *testing.T, userRepo repository.UserRepository, endpoints ...config.WebhookEndpointConfig) (*service.WebhookService, *service.EventService, *repository.InMemoryEventRepository, *repository.InMemoryWebhookRepository) {
+	t.Helper()
+
+	cfg := &config.Config{
+		Webhooks: config.WebhooksConfig{
+			MaxAttempts:    2,
+			InitialBackoff: 30,
+			Endpoints:      endpoints,
+		},
+	}
+	eventRepo := repository.NewInMemoryEventRepository()
+	webhookRepo := repository.NewInMemoryWebhookRepository()
+	eventService := service.NewEventService(eventRepo)
+	webhookService := service.NewWebhookService(webhookRepo, eventService, service.NewAnalyticsConsent(userRepo), webhook.NewClient(cfg.GetWebhookTimeout()), cfg, logging.Discard())
+	return webhookService, eventService, eventRepo, webhookRepo
+}
+
+func TestWebhookDeliversSignedEvents(t *testing.T) {
+	ctx := context.Background()
+	receiver := &webhookReceiver{status: http.StatusNoContent}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhookService, eventService, _, webhookRepo := newWebhookService(t,
+		config.WebhookEndpointConfig{Name: "crm", URL: server.URL, Secret: "crm-secret", Events: []string{models.EventOTPVerified}},
+		config.WebhookEndpointConfig{Name: "audit", URL: server.URL, Secret: "audit-secret"},
+	)
+
+	if err := eventService.Publish(ctx, models.EventOTPRequested, models.AggregatePhone, "+989121234567", nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := eventService.Publish(ctx, models.EventOTPVerified, models.AggregatePhone, "+989121234567", map[string]interface{}{"method": "otp"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	if err := webhookService.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	// Syncing again must not queue the events twice
+	if err := webhookService.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if deliveries := webhookRepo.Deliveries(); len(deliveries) != 3 {
+		t.Fatalf("expected 1 delivery to crm and 2 to audit, got %d", len(deliveries))
+	}
+
+	if err := webhookService.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	for _, delivery := range webhookRepo.Deliveries() {
+		if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 1 || delivery.DeliveredAt == nil {
+			t.Fatalf("expected delivery to %s to be delivered, got %+v", delivery.Endpoint, delivery)
+		}
+	}
+
+	if len(receiver.requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(receiver.requests))
+	}
+	var verified int
+	for i, req := range receiver.requests {
+		var event models.WebhookEvent
+		if err := json.Unmarshal(receiver.bodies[i], &event); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if req.Header.Get(webhook.HeaderEvent) != event.Type {
+			t.Fatalf("expected event header %s, got %s", event.Type, req.Header.Get(webhook.HeaderEvent))
+		}
+		if event.Type == models.EventOTPVerified {
+			verified++
+		}
+
+		timestamp, err := strconv.ParseInt(req.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Fatalf("invalid timestamp header: %v", err)
+		}
+		signature := req.Header.Get(webhook.HeaderSignature)
+		if signature != webhook.Signature("crm-secret", timestamp, receiver.bodies[i]) &&
+			signature != webhook.Signature("audit-secret", timestamp, receiver.bodies[i]) {
+			t.Fatalf("signature %s does not match the body", signature)
+		}
+	}
+	if verified != 2 {
+		t.Fatalf("expected otp.verified to be delivered to both endpoints, got %d", verified)
+	}
+}
+
+func TestWebhookRetriesWithBackoffAndGivesUp(t *testing.T) {
+	ctx := context.Background()
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhookService, eventService, _, webhookRepo := newWebhookService(t,
+		config.WebhookEndpointConfig{Name: "crm", URL: server.URL, Secret: "crm-secret"},
+	)
+	if err := eventService.Publish(ctx, models.EventUserCreated, models.AggregateUser, "42", nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := webhookService.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	before := time.Now()
+	if err := webhookService.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	delivery := webhookRepo.Deliveries()[0]
+	if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != 1 || delivery.LastError == nil {
+		t.Fatalf("expected the delivery to be retried, got %+v", delivery)
+	}
+	if delay := delivery.NextAttemptAt.Sub(before); delay < 30*time.Second || delay > 31*time.Second {
+		t.Fatalf("expected the retry after the initial backoff, got %v", delay)
+	}
+
+	// Not due yet
+	if err := webhookService.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	if len(receiver.requests) != 1 {
+		t.Fatalf("expected no attempt before the backoff elapsed, got %d requests", len(receiver.requests))
+	}
+
+	delivery.NextAttemptAt = time.Now()
+	if err := webhookRepo.Update(ctx, &delivery); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := webhookService.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	if delivery := webhookRepo.Deliveries()[0]; delivery.Status != models.WebhookDeliveryFailed || delivery.Attempts != 2 {
+		t.Fatalf("expected the delivery to be given up after 2 attempts, got %+v", delivery)
+	}
+}
+
+func TestWebhookSkipsOldEvents(t *testing.T) {
+	ctx := context.Background()
+	webhookService, _, eventRepo, webhookRepo := newWebhookService(t,
+		config.WebhookEndpointConfig{Name: "crm", URL: "http://127.0.0.1:1", Secret: "crm-secret"},
+	)
+
+	err := eventRepo.Append(ctx, &models.DomainEvent{
+		Type:          models.EventUserCreated,
+		AggregateType: models.AggregateUser,
+		AggregateID:   "42",
+		Payload:       json.RawMessage(`{}`),
+		OccurredAt:    time.Now().Add(-2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	if err := webhookService.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if deliveries := webhookRepo.Deliveries(); len(deliveries) != 0 {
+		t.Fatalf("expected events older than the maximum age to be skipped, got %d deliveries", len(deliveries))
+	}
+	if sequence, _ := webhookRepo.LastSequence(ctx); sequence != 1 {
+		t.Fatalf("expected the cursor to move past skipped events, got %d", sequence)
+	}
+}
+
+func TestValidateWebhookEndpoints(t *testing.T) {
+	valid := config.WebhookEndpointConfig{Name: "crm", URL: "https://crm.example.com/hooks", Secret: "s"}
+	tests := []struct {
+		name      string
+		endpoints []config.WebhookEndpointConfig
+		wantErr   bool
+	}{
+		{"valid", []config.WebhookEndpointConfig{valid}, false},
+		{"duplicate name", []config.WebhookEndpointConfig{valid, valid}, true},
+		{"missing secret", []config.WebhookEndpointConfig{{Name: "crm", URL: valid.URL}}, true},
+		{"invalid URL", []config.WebhookEndpointConfig{{Name: "crm", URL: "crm.example.com", Secret: "s"}}, true},
+	}
+	for _, tt := range tests {
+		if err := webhook.ValidateEndpoints(tt.endpoints); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateEndpoints() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWebhookAnalyticsConsent(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repository.NewInMemoryUserRepository()
+	consenting, err := userRepo.Create(ctx, "+989121234567")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	withdrawn, err := userRepo.Create(ctx, "+989127654321")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := userRepo.SetAnalyticsConsent(ctx, withdrawn.ID, false); err != nil {
+		t.Fatalf("SetAnalyticsConsent: %v", err)
+	}
+
+	webhookService, eventService, _, webhookRepo := newWebhookServiceWithUsers(t, userRepo,
+		config.WebhookEndpointConfig{Name: "crm", URL: "http://crm.invalid", Secret: "crm-secret"},
+		config.WebhookEndpointConfig{Name: "metrics", URL: "http://metrics.invalid", Secret: "metrics-secret", Analytics: service.AnalyticsAnonymize},
+		config.WebhookEndpointConfig{Name: "warehouse", URL: "http://warehouse.invalid", Secret: "warehouse-secret", Analytics: service.AnalyticsDrop},
+	)
+
+	payload := map[string]interface{}{"method": "otp", "challenge_id": "c-1", "user_id": withdrawn.ID.String()}
+	for _, phoneNumber := range []string{consenting.PhoneNumber, withdrawn.PhoneNumber} {
+		if err := eventService.Publish(ctx, models.EventOTPVerified, models.AggregatePhone, phoneNumber, payload); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	if err := webhookService.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	byEndpoint := make(map[string][]models.WebhookEvent)
+	for _, delivery := range webhookRepo.Deliveries() {
+		var event models.WebhookEvent
+		if err := json.Unmarshal(delivery.Body, &event); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		byEndpoint[delivery.Endpoint] = append(byEndpoint[delivery.Endpoint], event)
+	}
+	if len(byEndpoint["crm"]) != 2 || len(byEndpoint["metrics"]) != 2 || len(byEndpoint["warehouse"]) != 1 {
+		t.Fatalf("expected 2 deliveries to crm and metrics and 1 to warehouse, got %d, %d and %d",
+			len(byEndpoint["crm"]), len(byEndpoint["metrics"]), len(byEndpoint["warehouse"]))
+	}
+	if byEndpoint["warehouse"][0].AggregateID != consenting.PhoneNumber {
+		t.Fatalf("expected warehouse to get the consenting user's event, got %+v", byEndpoint["warehouse"][0])
+	}
+	for _, event := range byEndpoint["crm"] {
+		if event.AggregateID == "" {
+			t.Fatalf("expected crm to get events unchanged, got %+v", event)
+		}
+	}
+
+	for _, event := range byEndpoint["metrics"] {
+		if event.AggregateID == consenting.PhoneNumber {
+			continue
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if event.AggregateID != "" || data["challenge_id"] != nil || data["user_id"] != nil || data["method"] != "otp" {
+			t.Fatalf("expected the withdrawn user's event anonymized, got %+v with data %v", event, data)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// Kinds of timeline entries
+const (
+	TimelineAudit   = "audit"   // an admin action on the user or their phone number
+	TimelineEvent   = "event"   // a domain event about the user or their phone number
+	TimelineLogin   = "login"   // a sign-in attempt, with why it was refused, e.g. locked out or denied
+	TimelineSession = "session" // an active session, when it started
+)
+
+// timelineSessionStarted is the type of session entries
+const timelineSessionStarted = "started"
+
+// maxTimelineDepth caps how far into a timeline pages reach, as every page is merged from the
+// newest entries of each source
+const maxTimelineDepth = 5000
+
+// TimelineService stitches a user's audit log entries, domain events, sign-in attempts and
+// sessions into one chronological timeline, for support investigations
+type TimelineService struct {
+	userRepo  repository.UserRepository
+	auditRepo repository.AuditRepository
+	eventRepo repository.EventRepository
+	logins    repository.LoginHistoryRepository
+	sessions  repository.SessionRepository
+	config    *config.Config
+}
+
+// NewTimelineService creates a new timeline service
+func NewTimelineService(
+	userRepo repository.UserRepository,
+	auditRepo repository.AuditRepository,
+	eventRepo repository.EventRepository,
+	logins repository.LoginHistoryRepository,
+	sessions repository.SessionRepository,
+	cfg *config.Config,
+) *TimelineService {
+	return &TimelineService{
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
+		eventRepo: eventRepo,
+		logins:    logins,
+		sessions:  sessions,
+		config:    cfg,
+	}
+}
+
+// GetTimeline returns a page of the timeline of a user, deleted or not, newest first, and how
+// many entries it has. Entries about the user's phone number are included from before the
+// user signed up.
+func (s *TimelineService) GetTimeline(ctx context.Context, userID uuid.UUID, params models.PaginationParams) ([]models.TimelineEntry, int64, error) {
+	if maxPageSize := s.config.GetMaxPageSize(); params.PageSize > maxPageSize {
+		return nil, 0, &ValidationError{Message: fmt.Sprintf("page_size must be at most %d", maxPageSize)}
+	}
+	if params.Page*params.PageSize > maxTimelineDepth {
+		return nil, 0, &ValidationError{Message: fmt.Sprintf("page and page_size must reach at most %d entries deep", maxTimelineDepth)}
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = s.userRepo.FindDeletedByID(ctx, userID)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error finding user: %w", err)
+	}
+
+	// The page is among the newest page*pageSize entries of all sources together
+	limit := params.Page * params.PageSize
+	var entries []models.TimelineEntry
+	var totalCount int64
+
+	for _, target := range []struct{ targetType, targetID string }{
+		{AuditTargetUser, user.ID.String()},
+		{AuditTargetPhone, user.PhoneNumber},
+	} {
+		auditLogs, count, err := s.auditRepo.ListByTarget(ctx, target.targetType, target.targetID, limit)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error listing audit logs: %w", err)
+		}
+		totalCount += count
+		for _, entry := range auditLogs {
+			entries = append(entries, models.TimelineEntry{At: entry.CreatedAt, Kind: TimelineAudit, Type: entry.Action, Data: entry})
+		}
+	}
+
+	for _, aggregate := range []struct{ aggregateType, aggregateID string }{
+		{models.AggregateUser, user.ID.String()},
+		{models.AggregatePhone, user.PhoneNumber},
+	} {
+		events, count, err := s.eventRepo.ListByAggregate(ctx, aggregate.aggregateType, aggregate.aggregateID, limit)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error listing domain events: %w", err)
+		}
+		totalCount += count
+		for _, event := range events {
+			entries = append(entries, models.TimelineEntry{At: event.OccurredAt, Kind: TimelineEvent, Type: event.Type, Data: event})
+		}
+	}
+
+	logins, count, err := s.logins.ListByUser(ctx, user.ID, models.PaginationParams{Page: 1, PageSize: limit})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing login history: %w", err)
+	}
+	totalCount += count
+	for _, login := range logins {
+		entries = append(entries, models.TimelineEntry{At: login.CreatedAt, Kind: TimelineLogin, Type: login.Method, Data: login})
+	}
+
+	sessions, err := s.sessions.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing sessions: %w", err)
+	}
+	totalCount += int64(len(sessions))
+	for _, session := range sessions {
+		entries = append(entries, models.TimelineEntry{At: session.CreatedAt, Kind: TimelineSession, Type: timelineSessionStarted, Data: session})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.After(entries[j].At)
+	})
+
+	offset := (params.Page - 1) * params.PageSize
+	if offset >= len(entries) {
+		return []models.TimelineEntry{}, totalCount, nil
+	}
+	end := offset + params.PageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	return entries[offset:end], totalCount, nil
+}
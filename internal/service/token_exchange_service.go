@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// TokenExchangeError is a token exchange request rejected with an OAuth 2.0 error code
+type TokenExchangeError struct {
+	Code        string // e.g. invalid_client, invalid_grant, invalid_target
+	Description string
+}
+
+func (e *TokenExchangeError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// TokenExchangeService exchanges user tokens for short-lived, audience-restricted tokens
+// that trusted services use to call downstream services on behalf of the user
+type TokenExchangeService struct {
+	userRepo repository.UserRepository
+	sessions *SessionService
+	events   *EventService
+	tokens   *TokenSigner
+	config   *config.Config
+	keyUses  *metrics.CounterVec
+	lastUsed *metrics.GaugeVec
+}
+
+// NewTokenExchangeService creates a new token exchange service that refuses the tokens of revoked sessions
+func NewTokenExchangeService(userRepo repository.UserRepository, sessions *SessionService, events *EventService, tokens *TokenSigner, registry *metrics.Registry, config *config.Config) *TokenExchangeService {
+	return &TokenExchangeService{
+		userRepo: userRepo,
+		sessions: sessions,
+		events:   events,
+		tokens:   tokens,
+		config:   config,
+		keyUses: registry.CounterVec("token_exchange_api_key_uses_total",
+			"Total number of token exchange requests authenticated by a client's current or previous API key.", "client", "key"),
+		lastUsed: registry.GaugeVec("token_exchange_api_key_last_used_timestamp_seconds",
+			"Unix time a client's current or previous API key last authenticated a token exchange request.", "client", "key"),
+	}
+}
+
+// Exchange validates the client's API key and the user's token and issues a token for
+// req.Audience, limited to the scopes the client may request. Exchanged tokens are signed
+// with the token exchange secret, so they are not accepted by this service itself.
+func (s *TokenExchangeService) Exchange(ctx context.Context, apiKey string, req *models.TokenExchangeRequest) (*models.TokenExchangeResponse, error) {
+	if s.config.TokenExchange.Secret == "" {
+		return nil, fmt.Errorf("token exchange disabled")
+	}
+
+	client := s.authenticateClient(apiKey, time.Now())
+	if client == nil {
+		return nil, &TokenExchangeError{Code: "invalid_client", Description: "unknown API key"}
+	}
+
+	if req.GrantType != models.GrantTypeTokenExchange {
+		return nil, &TokenExchangeError{Code: "unsupported_grant_type", Description: "grant_type must be " + models.GrantTypeTokenExchange}
+	}
+	if !isAccessTokenType(req.SubjectTokenType) {
+		return nil, &TokenExchangeError{Code: "invalid_request", Description: "unsupported subject_token_type"}
+	}
+	if req.RequestedTokenType != "" && !isAccessTokenType(req.RequestedTokenType) {
+		return nil, &TokenExchangeError{Code: "invalid_request", Description: "unsupported requested_token_type"}
+	}
+	if !contains(client.Audiences, req.Audience) {
+		return nil, &TokenExchangeError{Code: "invalid_target", Description: "audience not allowed for this client"}
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !contains(client.Scopes, scope) {
+			return nil, &TokenExchangeError{Code: "invalid_scope", Description: "scope " + scope + " not allowed for this client"}
+		}
+	}
+
+	userID, subjectExpiresAt, err := s.parseSubjectToken(ctx, req.SubjectToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleted users lose delegated access along with their own
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &TokenExchangeError{Code: "invalid_grant", Description: "user not found"}
+		}
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+
+	// Exchanged tokens never outlive the token they were exchanged for
+	now := time.Now()
+	expiresAt := now.Add(s.config.GetTokenExchangeExpiration())
+	if subjectExpiresAt.Before(expiresAt) {
+		expiresAt = subjectExpiresAt
+	}
+
+	scope := strings.Join(scopes, " ")
+	claims := jwt.MapClaims{
+		"sub":          user.ID.String(),
+		"user_id":      user.ID.String(),
+		"phone_number": user.PhoneNumber,
+		"aud":          req.Audience,
+		"scope":        scope,
+		"act":          map[string]interface{}{"sub": client.Name},
+		"iat":          now.Unix(),
+		"exp":          expiresAt.Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.config.TokenExchange.Secret))
+	if err != nil {
+		return nil, fmt.Errorf("error signing exchanged token: %w", err)
+	}
+
+	err = s.events.Publish(ctx, models.EventTokenExchanged, models.AggregateUser, user.ID.String(), map[string]interface{}{
+		"client":   client.Name,
+		"audience": req.Audience,
+		"scope":    scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenExchangeResponse{
+		AccessToken:     token,
+		IssuedTokenType: models.TokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(expiresAt.Sub(now).Seconds()),
+		Scope:           scope,
+	}, nil
+}
+
+// authenticateClient returns the client the API key belongs to, or nil. A client's previous
+// key is accepted until its expiry at now. Uses of each key are counted, so operators can tell
+// when clients have stopped using a previous key before it expires.
+func (s *TokenExchangeService) authenticateClient(apiKey string, now time.Time) *config.TokenExchangeClient {
+	if apiKey == "" {
+		return nil
+	}
+	for i := range s.config.TokenExchange.Clients {
+		client := &s.config.TokenExchange.Clients[i]
+		key := ""
+		switch {
+		case client.APIKey != "" && subtle.ConstantTimeCompare([]byte(client.APIKey), []byte(apiKey)) == 1:
+			key = "current"
+		case client.PreviousAPIKeyValid(now) && subtle.ConstantTimeCompare([]byte(client.PreviousAPIKey), []byte(apiKey)) == 1:
+			key = "previous"
+		default:
+			continue
+		}
+		s.keyUses.With(client.Name, key).Inc()
+		s.lastUsed.With(client.Name, key).Set(float64(now.Unix()))
+		return client
+	}
+	return nil
+}
+
+// parseSubjectToken validates a user token issued by this service for a session that is
+// still active and returns its user ID and expiry
+func (s *TokenExchangeService) parseSubjectToken(ctx context.Context, tokenString string) (uuid.UUID, time.Time, error) {
+	invalid := &TokenExchangeError{Code: "invalid_grant", Description: "invalid subject token"}
+
+	token, err := s.tokens.Parse(ctx, tokenString)
+	if err != nil || !token.Valid {
+		return uuid.Nil, time.Time{}, invalid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return uuid.Nil, time.Time{}, invalid
+	}
+	userIDStr, ok := claims["user_id"].(string)
+	if !ok {
+		return uuid.Nil, time.Time{}, invalid
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, time.Time{}, invalid
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return uuid.Nil, time.Time{}, invalid
+	}
+
+	// Delegated access ends with the session it was delegated from, so tokens of sessions that
+	// were signed out, revoked or replaced are refused, and so are tokens without a session,
+	// which could never be revoked
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return uuid.Nil, time.Time{}, invalid
+	}
+	sessionID, err := uuid.Parse(jti)
+	if err != nil {
+		return uuid.Nil, time.Time{}, invalid
+	}
+	if err := s.sessions.CheckSession(ctx, userID, sessionID); err != nil {
+		if err.Error() == "session revoked" {
+			return uuid.Nil, time.Time{}, &TokenExchangeError{Code: "invalid_grant", Description: "subject token session revoked"}
+		}
+		return uuid.Nil, time.Time{}, err
+	}
+
+	return userID, exp.Time, nil
+}
+
+// isAccessTokenType reports whether tokenType denotes the JWT access tokens this service issues
+func isAccessTokenType(tokenType string) bool {
+	return tokenType == models.TokenTypeAccessToken || tokenType == models.TokenTypeJWT
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
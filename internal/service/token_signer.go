@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/kms"
+)
+
+// TokenSigner signs and verifies the access tokens sessions issue: with the JWT secret (HS256),
+// or with a cloud KMS key if one is configured, so the private key never lives with the service
+type TokenSigner struct {
+	secret []byte
+	kms    *kms.Signer
+}
+
+// NewTokenSigner creates a token signer signing with kmsSigner, or with the JWT secret if it is nil
+func NewTokenSigner(config *config.Config, kmsSigner *kms.Signer) *TokenSigner {
+	return &TokenSigner{secret: []byte(config.JWT.Secret), kms: kmsSigner}
+}
+
+// Sign returns the signed access token with claims
+func (t *TokenSigner) Sign(ctx context.Context, claims jwt.MapClaims) (string, error) {
+	if t.kms != nil {
+		return t.kms.Sign(ctx, claims)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+}
+
+// Parse parses and verifies an access token
+func (t *TokenSigner) Parse(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	if t.kms != nil {
+		return jwt.Parse(tokenString, t.kms.Keyfunc(ctx))
+	}
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return t.secret, nil
+	})
+}
+
+// PublicKeys returns the public keys access tokens verify with, or none if they are signed with the secret
+func (t *TokenSigner) PublicKeys(ctx context.Context) ([]kms.JWK, error) {
+	if t.kms == nil {
+		return []kms.JWK{}, nil
+	}
+	return t.kms.JWKS(ctx)
+}
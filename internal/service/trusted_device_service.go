@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// defaultDeviceName names trusted devices the user did not name
+const defaultDeviceName = "Unnamed device"
+
+// TrustedDeviceService handles trusted devices, whose long-lived device token lets
+// their user sign in without an OTP
+type TrustedDeviceService struct {
+	deviceRepo repository.TrustedDeviceRepository
+	events     *EventService
+	config     *config.Config
+}
+
+// NewTrustedDeviceService creates a new trusted device service
+func NewTrustedDeviceService(
+	deviceRepo repository.TrustedDeviceRepository,
+	events *EventService,
+	config *config.Config,
+) *TrustedDeviceService {
+	return &TrustedDeviceService{
+		deviceRepo: deviceRepo,
+		events:     events,
+		config:     config,
+	}
+}
+
+// TrustDevice trusts the device a user just verified a challenge from and returns its device token.
+// Only a hash is stored, so the token cannot be retrieved again.
+func (s *TrustedDeviceService) TrustDevice(ctx context.Context, userID uuid.UUID, name, ipAddress, userAgent string) (string, error) {
+	if !s.config.OTP.TrustedDevices.Enabled {
+		return "", fmt.Errorf("trusted devices disabled")
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating device token: %w", err)
+	}
+	if name == "" {
+		name = defaultDeviceName
+	}
+
+	now := time.Now()
+	device := &models.TrustedDevice{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: hashOpaqueToken(token),
+		Name:      name,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.GetTrustedDeviceExpiration()),
+	}
+	if err := s.deviceRepo.Create(ctx, device); err != nil {
+		return "", fmt.Errorf("error storing trusted device: %w", err)
+	}
+
+	err = s.events.Publish(ctx, models.EventDeviceTrusted, models.AggregateUser, userID.String(), map[string]interface{}{
+		"device_id":  device.ID,
+		"expires_at": device.ExpiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Authenticate finds the trusted device of a user with the given device token and records
+// its use. Unknown, expired, revoked and other users' tokens are all reported as "invalid device token".
+func (s *TrustedDeviceService) Authenticate(ctx context.Context, userID uuid.UUID, token string) (*models.TrustedDevice, error) {
+	if !s.config.OTP.TrustedDevices.Enabled || token == "" {
+		return nil, fmt.Errorf("invalid device token")
+	}
+
+	now := time.Now()
+	device, err := s.deviceRepo.FindActiveByTokenHash(ctx, hashOpaqueToken(token), now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invalid device token")
+		}
+		return nil, fmt.Errorf("error finding trusted device: %w", err)
+	}
+	if device.UserID != userID {
+		return nil, fmt.Errorf("invalid device token")
+	}
+
+	if err := s.deviceRepo.MarkUsed(ctx, device.ID, now); err != nil {
+		return nil, fmt.Errorf("error updating trusted device: %w", err)
+	}
+	device.LastUsedAt = &now
+	return device, nil
+}
+
+// ListDevices lists a user's active trusted devices, newest first
+func (s *TrustedDeviceService) ListDevices(ctx context.Context, userID uuid.UUID) ([]models.TrustedDevice, error) {
+	devices, err := s.deviceRepo.ListActiveByUser(ctx, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error listing trusted devices: %w", err)
+	}
+	return devices, nil
+}
+
+// RevokeDevice revokes one of a user's trusted devices, which then needs an OTP again
+func (s *TrustedDeviceService) RevokeDevice(ctx context.Context, userID, deviceID uuid.UUID) error {
+	revoked, err := s.deviceRepo.Revoke(ctx, userID, deviceID, time.Now())
+	if err != nil {
+		return fmt.Errorf("error revoking trusted device: %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("trusted device not found")
+	}
+
+	return s.events.Publish(ctx, models.EventDeviceRevoked, models.AggregateUser, userID.String(), map[string]interface{}{
+		"device_id": deviceID,
+	})
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+)
+
+// maxPendingIPs bounds the IPs held in memory between flushes, in case Redis is unavailable for long
+const maxPendingIPs = 100000
+
+// UniqueIPService counts the distinct client IPs requesting each endpoint per UTC day. IPs are
+// collected in memory and written to the repository in batches, so requests never wait on Redis.
+type UniqueIPService struct {
+	uniqueIPRepo repository.UniqueIPRepository
+	uniqueIPs    *metrics.GaugeVec
+	logger       *slog.Logger
+
+	mu           sync.Mutex
+	pending      map[time.Time]map[string]map[string]struct{} // day -> endpoint -> IPs not yet written
+	pendingCount int
+	reported     map[string]bool // endpoints with a gauge series
+}
+
+// NewUniqueIPService creates a new unique IP service
+func NewUniqueIPService(uniqueIPRepo repository.UniqueIPRepository, registry *metrics.Registry, logger *slog.Logger) *UniqueIPService {
+	return &UniqueIPService{
+		uniqueIPRepo: uniqueIPRepo,
+		uniqueIPs: registry.GaugeVec("unique_ips_today",
+			"Estimated number of distinct client IPs that requested an endpoint during the current UTC day.", "endpoint"),
+		logger:   logger,
+		pending:  make(map[time.Time]map[string]map[string]struct{}),
+		reported: make(map[string]bool),
+	}
+}
+
+// RecordIP notes that ip requested endpoint
+func (s *UniqueIPService) RecordIP(endpoint, ip string) {
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addPending(day, endpoint, ip)
+}
+
+// addPending adds an IP to the pending IPs unless they are full; s.mu must be held
+func (s *UniqueIPService) addPending(day time.Time, endpoint, ip string) {
+	if s.pendingCount >= maxPendingIPs {
+		return
+	}
+	if s.pending[day] == nil {
+		s.pending[day] = make(map[string]map[string]struct{})
+	}
+	if s.pending[day][endpoint] == nil {
+		s.pending[day][endpoint] = make(map[string]struct{})
+	}
+	if _, ok := s.pending[day][endpoint][ip]; !ok {
+		s.pending[day][endpoint][ip] = struct{}{}
+		s.pendingCount++
+	}
+}
+
+// Run writes the collected IPs every interval until ctx is cancelled, writing the last ones on the way out
+func (s *UniqueIPService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the final write gets a context of its own
+			flushCtx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := s.Flush(flushCtx); err != nil {
+				s.logger.Error("Error recording unique IPs", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Flush(ctx); err != nil {
+			s.logger.Error("Error recording unique IPs", "error", err)
+		}
+		if err := s.updateMetrics(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("Error counting unique IPs", "error", err)
+		}
+	}
+}
+
+// Flush writes the IPs collected since the last flush to the repository.
+// IPs of a day that could not be written are kept for the next flush.
+func (s *UniqueIPService) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[time.Time]map[string]map[string]struct{})
+	s.pendingCount = 0
+	s.mu.Unlock()
+
+	for day, endpoints := range pending {
+		ipsByEndpoint := make(map[string][]string, len(endpoints))
+		for endpoint, ips := range endpoints {
+			for ip := range ips {
+				ipsByEndpoint[endpoint] = append(ipsByEndpoint[endpoint], ip)
+			}
+		}
+		if err := s.uniqueIPRepo.AddIPs(ctx, day, ipsByEndpoint); err != nil {
+			s.requeue(pending)
+			return err
+		}
+		delete(pending, day)
+	}
+	return nil
+}
+
+// requeue merges IPs that could not be written back into the pending IPs
+func (s *UniqueIPService) requeue(unwritten map[time.Time]map[string]map[string]struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for day, endpoints := range unwritten {
+		for endpoint, ips := range endpoints {
+			for ip := range ips {
+				s.addPending(day, endpoint, ip)
+			}
+		}
+	}
+}
+
+// GetUniqueIPStats estimates how many distinct client IPs requested each endpoint on the UTC day of day
+func (s *UniqueIPService) GetUniqueIPStats(ctx context.Context, day time.Time) (*models.UniqueIPStats, error) {
+	counts, err := s.uniqueIPRepo.CountIPs(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	return &models.UniqueIPStats{
+		Date:      day.UTC().Format("2006-01-02"),
+		Endpoints: counts,
+	}, nil
+}
+
+// updateMetrics sets the unique IP gauges to today's counts
+func (s *UniqueIPService) updateMetrics(ctx context.Context) error {
+	counts, err := s.uniqueIPRepo.CountIPs(ctx, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	// Endpoints not requested yet today are reset after the day rolls over
+	for endpoint := range s.reported {
+		if _, ok := counts[endpoint]; !ok {
+			s.uniqueIPs.With(endpoint).Set(0)
+		}
+	}
+	for endpoint, count := range counts {
+		s.uniqueIPs.With(endpoint).Set(float64(count))
+		s.reported[endpoint] = true
+	}
+	return nil
+}
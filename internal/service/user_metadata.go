@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Limits of user metadata, which is returned with every user
+const (
+	maxMetadataKeys        = 50
+	maxMetadataValueLength = 500
+)
+
+// metadataKeyPattern restricts metadata keys to those that can be given in metadata[key] query
+// parameters to filter users by
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// validateMetadataKey rejects metadata keys not matching metadataKeyPattern
+func validateMetadataKey(key string) error {
+	if !metadataKeyPattern.MatchString(key) {
+		return &ValidationError{Message: fmt.Sprintf("metadata key %q must be 1 to 64 letters, digits, '_', '.' or '-'", key)}
+	}
+	return nil
+}
+
+// validateMetadataUpdate rejects updates with invalid keys or values too long, and updates
+// leaving a user with current metadata keys with more than maxMetadataKeys
+func validateMetadataUpdate(current map[string]string, update map[string]*string) error {
+	if len(update) == 0 {
+		return &ValidationError{Message: "metadata must set or remove at least one key"}
+	}
+	keys := len(current)
+	for key, value := range update {
+		if err := validateMetadataKey(key); err != nil {
+			return err
+		}
+		_, exists := current[key]
+		switch {
+		case value == nil && exists:
+			keys--
+		case value != nil && !exists:
+			keys++
+		}
+		if value != nil && utf8.RuneCountInString(*value) > maxMetadataValueLength {
+			return &ValidationError{Message: fmt.Sprintf("metadata value of %q must be at most %d characters", key, maxMetadataValueLength)}
+		}
+	}
+	if keys > maxMetadataKeys {
+		return &ValidationError{Message: fmt.Sprintf("users can have at most %d metadata keys", maxMetadataKeys)}
+	}
+	return nil
+}
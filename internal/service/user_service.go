@@ -2,21 +2,44 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
 	"github.com/lilokie/otp-auth/internal/models"
 	"github.com/lilokie/otp-auth/internal/repository"
 )
 
+// ValidationError is returned when request parameters are outside the allowed limits
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
 // UserService handles user-related business logic
 type UserService struct {
-	userRepo repository.UserRepository
+	userRepo    repository.UserRepository
+	logins      repository.LoginHistoryRepository
+	activeUsers *ActiveUserService
+	config      *config.Config
 }
 
 // NewUserService creates a new user service
-func NewUserService(userRepo repository.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+func NewUserService(userRepo repository.UserRepository, logins repository.LoginHistoryRepository, activeUsers *ActiveUserService, config *config.Config) *UserService {
+	return &UserService{
+		userRepo:    userRepo,
+		logins:      logins,
+		activeUsers: activeUsers,
+		config:      config,
+	}
 }
 
 // GetUserByID gets a user by ID
@@ -39,6 +62,14 @@ func (s *UserService) GetUserByPhoneNumber(ctx context.Context, phoneNumber stri
 
 // ListUsers lists users with pagination and search
 func (s *UserService) ListUsers(ctx context.Context, params models.PaginationParams) ([]models.User, int64, error) {
+	if err := s.validatePagination(params); err != nil {
+		return nil, 0, err
+	}
+	if err := validateUserFilters(params); err != nil {
+		return nil, 0, err
+	}
+
+	params.IncludeTotal = models.IncludeTotalTrue
 	users, totalCount, err := s.userRepo.List(ctx, params)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error listing users: %w", err)
@@ -46,6 +77,81 @@ func (s *UserService) ListUsers(ctx context.Context, params models.PaginationPar
 	return users, totalCount, nil
 }
 
+// ListUsersUncounted lists a page of users like ListUsers without counting the users matching
+// exactly, which scans them all, and reports whether more pages follow instead. With
+// params.IncludeTotal set to estimate, it also returns an estimate of the number of users.
+func (s *UserService) ListUsersUncounted(ctx context.Context, params models.PaginationParams) ([]models.User, int64, bool, error) {
+	if err := s.validatePagination(params); err != nil {
+		return nil, 0, false, err
+	}
+	if err := validateUserFilters(params); err != nil {
+		return nil, 0, false, err
+	}
+	if params.Counted() {
+		params.IncludeTotal = models.IncludeTotalFalse
+	}
+
+	users, estimate, err := s.userRepo.List(ctx, params)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("error listing users: %w", err)
+	}
+	if len(users) <= params.PageSize {
+		return users, estimate, false, nil
+	}
+	return users[:params.PageSize], estimate, true, nil
+}
+
+// ListUsersAfter lists up to params.Limit users after params.Cursor, newest first, and the
+// cursor of the next page, empty if there is none. Unlike pages, cursors keep their place when
+// users are created while paging.
+func (s *UserService) ListUsersAfter(ctx context.Context, params models.PaginationParams) ([]models.User, string, error) {
+	if params.Limit <= 0 {
+		params.Limit = 10
+	}
+	if maxPageSize := s.config.GetMaxPageSize(); params.Limit > maxPageSize {
+		return nil, "", &ValidationError{Message: fmt.Sprintf("limit must be at most %d", maxPageSize)}
+	}
+	if err := s.validatePagination(params); err != nil {
+		return nil, "", err
+	}
+	if err := validateUserFilters(params); err != nil {
+		return nil, "", err
+	}
+	// Cursors hold a position by creation time
+	if params.SortBy != "" && params.SortBy != models.UserSortCreatedAt {
+		return nil, "", &ValidationError{Message: fmt.Sprintf("sort_by must be %s with cursor or limit", models.UserSortCreatedAt)}
+	}
+
+	// One more user than asked for tells whether there is a next page
+	limit := params.Limit
+	params.Limit++
+	users, _, err := s.userRepo.List(ctx, params)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return nil, "", &ValidationError{Message: "invalid cursor"}
+		}
+		return nil, "", fmt.Errorf("error listing users: %w", err)
+	}
+	if len(users) <= limit {
+		return users, "", nil
+	}
+	users = users[:limit]
+	return users, repository.UserCursor(&users[limit-1]), nil
+}
+
+// ListLoginHistory lists a user's successful and failed logins, newest first
+func (s *UserService) ListLoginHistory(ctx context.Context, userID uuid.UUID, params models.PaginationParams) ([]models.LoginAttempt, int64, error) {
+	if err := s.validatePagination(params); err != nil {
+		return nil, 0, err
+	}
+
+	logins, totalCount, err := s.logins.ListByUser(ctx, userID, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing login history: %w", err)
+	}
+	return logins, totalCount, nil
+}
+
 // UpdateUser updates a user
 func (s *UserService) UpdateUser(ctx context.Context, user *models.User) error {
 	err := s.userRepo.Update(ctx, user)
@@ -55,6 +161,41 @@ func (s *UserService) UpdateUser(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+// UpdateProfile updates the profile fields of a user given in update, leaving the others
+// unchanged. Values are trimmed; emails and avatar URLs are checked unless cleared.
+func (s *UserService) UpdateProfile(ctx context.Context, id uuid.UUID, update models.UpdateProfileRequest) (*models.User, error) {
+	for _, field := range []*string{update.FirstName, update.LastName, update.Email, update.AvatarURL} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	if update.Email != nil && *update.Email != "" {
+		if address, err := mail.ParseAddress(*update.Email); err != nil || address.Address != *update.Email {
+			return nil, &ValidationError{Message: "email must be an email address"}
+		}
+	}
+	if update.AvatarURL != nil && *update.AvatarURL != "" {
+		if u, err := url.Parse(*update.AvatarURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, &ValidationError{Message: "avatar_url must be an http or https URL"}
+		}
+	}
+
+	user, err := s.userRepo.UpdateProfile(ctx, id, update)
+	if err != nil {
+		return nil, fmt.Errorf("error updating user profile: %w", err)
+	}
+	return user, nil
+}
+
+// SetAnalyticsConsent sets whether a user consents to analytics
+func (s *UserService) SetAnalyticsConsent(ctx context.Context, id uuid.UUID, consent bool) error {
+	err := s.userRepo.SetAnalyticsConsent(ctx, id, consent)
+	if err != nil {
+		return fmt.Errorf("error setting analytics consent: %w", err)
+	}
+	return nil
+}
+
 // DeleteUser deletes a user
 func (s *UserService) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	err := s.userRepo.Delete(ctx, id)
@@ -63,3 +204,61 @@ func (s *UserService) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	}
 	return nil
 }
+
+// GetUserStats counts active users by phone verification status and source
+// and estimates how many of them signed in recently
+func (s *UserService) GetUserStats(ctx context.Context) (*models.UserStats, error) {
+	stats, err := s.userRepo.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user stats: %w", err)
+	}
+
+	stats.ActiveUsers, err = s.activeUsers.GetActiveUserStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting active user stats: %w", err)
+	}
+	return stats, nil
+}
+
+// validatePagination rejects page sizes and search terms beyond the configured limits
+func (s *UserService) validatePagination(params models.PaginationParams) error {
+	if maxPageSize := s.config.GetMaxPageSize(); params.PageSize > maxPageSize {
+		return &ValidationError{Message: fmt.Sprintf("page_size must be at most %d", maxPageSize)}
+	}
+	if maxSearchLength := s.config.GetMaxSearchLength(); utf8.RuneCountInString(params.Search) > maxSearchLength {
+		return &ValidationError{Message: fmt.Sprintf("search must be at most %d characters", maxSearchLength)}
+	}
+	return nil
+}
+
+// validateUserFilters rejects unknown sort fields, orders and counts, empty creation time ranges
+// and invalid metadata keys
+func validateUserFilters(params models.PaginationParams) error {
+	switch params.SortBy {
+	case "", models.UserSortCreatedAt, models.UserSortPhoneNumber:
+	default:
+		return &ValidationError{Message: fmt.Sprintf("sort_by must be %s or %s", models.UserSortCreatedAt, models.UserSortPhoneNumber)}
+	}
+	switch params.Order {
+	case "", models.SortAsc, models.SortDesc:
+	default:
+		return &ValidationError{Message: fmt.Sprintf("order must be %s or %s", models.SortAsc, models.SortDesc)}
+	}
+	switch params.IncludeTotal {
+	case "", models.IncludeTotalTrue, models.IncludeTotalFalse, models.IncludeTotalEstimate:
+	default:
+		return &ValidationError{Message: fmt.Sprintf("include_total must be %s, %s or %s", models.IncludeTotalTrue, models.IncludeTotalFalse, models.IncludeTotalEstimate)}
+	}
+	if params.CreatedAfter != nil && params.CreatedBefore != nil && !params.CreatedAfter.Before(*params.CreatedBefore) {
+		return &ValidationError{Message: "created_after must be before created_before"}
+	}
+	if len(params.Metadata) > maxMetadataKeys {
+		return &ValidationError{Message: fmt.Sprintf("at most %d metadata filters can be given", maxMetadataKeys)}
+	}
+	for key := range params.Metadata {
+		if err := validateMetadataKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
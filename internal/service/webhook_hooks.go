@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/webhook"
+)
+
+// webhookHooksEndpoint names the hook endpoint in logs
+const webhookHooksEndpoint = "hooks"
+
+// WebhookHooks calls the configured hook endpoint from the auth service's hooks, so business
+// logic can run in another service. Requests are signed like webhook deliveries and carry the
+// hook name in X-Webhook-Event. The endpoint refuses a sign-up or sign-in with 403 Forbidden;
+// any other failure is logged, and the sign-in allowed unless hooks fail closed.
+type WebhookHooks struct {
+	client   *webhook.Client
+	endpoint config.WebhookEndpointConfig
+	config   config.HooksConfig
+	logger   *slog.Logger
+}
+
+// NewWebhookHooks creates webhook hooks calling the endpoint configured in cfg
+func NewWebhookHooks(client *webhook.Client, cfg config.HooksConfig, logger *slog.Logger) *WebhookHooks {
+	return &WebhookHooks{
+		client:   client,
+		endpoint: config.WebhookEndpointConfig{Name: webhookHooksEndpoint, URL: cfg.URL, Secret: cfg.Secret},
+		config:   cfg,
+		logger:   logger,
+	}
+}
+
+// Register registers the hooks the configuration subscribes to
+func (h *WebhookHooks) Register(hooks *Hooks) {
+	if h.subscribed(HookUserCreated) {
+		hooks.OnUserCreated(func(ctx context.Context, user *models.User) error {
+			return h.call(ctx, HookUserCreated, map[string]interface{}{"user": user})
+		})
+	}
+	if h.subscribed(HookLogin) {
+		hooks.OnLogin(func(ctx context.Context, login *Login) error {
+			return h.call(ctx, HookLogin, map[string]interface{}{
+				"user":       login.User,
+				"method":     login.Method,
+				"new_user":   login.NewUser,
+				"ip_address": login.IPAddress,
+				"user_agent": login.UserAgent,
+			})
+		})
+	}
+	if h.subscribed(HookOTPFailed) {
+		hooks.OnOTPFailed(func(ctx context.Context, failure *OTPFailure) error {
+			return h.call(ctx, HookOTPFailed, map[string]interface{}{
+				"phone_number": failure.PhoneNumber,
+				"challenge_id": failure.ChallengeID,
+				"method":       failure.Method,
+				"ip_address":   failure.IPAddress,
+				"user_agent":   failure.UserAgent,
+			})
+		})
+	}
+}
+
+// subscribed reports whether the configuration subscribes to a hook
+func (h *WebhookHooks) subscribed(name string) bool {
+	if len(h.config.Events) == 0 {
+		return true
+	}
+	for _, event := range h.config.Events {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// call posts a hook's data to the endpoint, denying the sign-in if the endpoint responds with 403
+func (h *WebhookHooks) call(ctx context.Context, name string, data map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"hook":       name,
+		"data":       data,
+		"created_at": time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding hook: %w", err)
+	}
+
+	err = h.client.Send(ctx, h.endpoint, models.WebhookDelivery{ID: uuid.New(), EventType: name, Body: body})
+	if err == nil {
+		return nil
+	}
+	var statusErr *webhook.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden {
+		return &HookDeniedError{}
+	}
+	if h.config.FailClosed || name == HookOTPFailed {
+		return err
+	}
+	h.logger.Error("Error calling hook endpoint, allowing the sign-in", "hook", name, "error", err)
+	return nil
+}
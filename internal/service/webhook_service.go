@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/webhook"
+)
+
+const (
+	// webhookEventBatchSize is how many domain events are read from the log at a time
+	webhookEventBatchSize = 500
+	// webhookDeliveryBatchSize is how many due deliveries are attempted per run
+	webhookDeliveryBatchSize = 100
+)
+
+// WebhookService notifies the configured webhook endpoints of domain events. New events are
+// read from the domain event log into a delivery queue, and failed deliveries are retried
+// with exponential backoff until they succeed or run out of attempts. Endpoints feeding analytics
+// get events about users without analytics consent anonymized or not at all.
+type WebhookService struct {
+	webhookRepo repository.WebhookRepository
+	events      *EventService
+	consent     *AnalyticsConsent
+	client      *webhook.Client
+	config      *config.Config
+	logger      *slog.Logger
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(
+	webhookRepo repository.WebhookRepository,
+	events *EventService,
+	consent *AnalyticsConsent,
+	client *webhook.Client,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+		events:      events,
+		consent:     consent,
+		client:      client,
+		config:      cfg,
+		logger:      logger,
+	}
+}
+
+// Run queues new domain events and sends due deliveries every interval until ctx is cancelled.
+// Deliveries being sent when ctx is cancelled are still sent; Run returns once they are.
+func (s *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Work isn't cut off by cancellation, so events aren't queued twice and deliveries
+	// aren't left waiting for their claim to expire
+	workCtx := context.WithoutCancel(ctx)
+	for {
+		if err := s.Sync(workCtx); err != nil {
+			s.logger.Error("Error queueing webhook deliveries", "error", err)
+		}
+		if err := s.deliverDue(workCtx, ctx.Done()); err != nil {
+			s.logger.Error("Error sending webhook deliveries", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync queues a delivery to every subscribed endpoint for each domain event recorded since the
+// last sync. Events older than the maximum event age are skipped, so endpoints are not flooded
+// with history after webhooks were disabled for a while.
+func (s *WebhookService) Sync(ctx context.Context) error {
+	lastSequence, err := s.webhookRepo.LastSequence(ctx)
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().Add(-s.config.GetWebhookMaxEventAge())
+	synced, err := s.events.Replay(ctx, lastSequence, webhookEventBatchSize, func(event models.DomainEvent) error {
+		if event.OccurredAt.Before(since) {
+			return nil
+		}
+		deliveries, err := s.deliveriesFor(ctx, event)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+		return s.webhookRepo.Enqueue(ctx, deliveries)
+	})
+	if synced > lastSequence {
+		// Keep the progress made before a failure
+		if setErr := s.webhookRepo.SetLastSequence(ctx, synced); setErr != nil && err == nil {
+			err = setErr
+		}
+	}
+	return err
+}
+
+// deliveriesFor returns a new delivery of event to every endpoint subscribed to its type.
+// Analytics endpoints get events about users without analytics consent anonymized or not at all.
+func (s *WebhookService) deliveriesFor(ctx context.Context, event models.DomainEvent) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	var body, anonymizedBody []byte
+	var consented *bool
+
+	webhookEvent := models.WebhookEvent{
+		ID:            event.ID,
+		Type:          event.Type,
+		Sequence:      event.Sequence,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		OccurredAt:    event.OccurredAt,
+		Data:          event.Payload,
+	}
+	now := time.Now()
+	for _, endpoint := range s.config.Webhooks.Endpoints {
+		if !subscribed(endpoint, event.Type) {
+			continue
+		}
+
+		// Only analytics endpoints need the consent, looked up once per event
+		anonymize := false
+		if endpoint.Analytics != "" {
+			if consented == nil {
+				ok, err := s.consent.Consented(ctx, event)
+				if err != nil {
+					return nil, err
+				}
+				consented = &ok
+			}
+			if !*consented {
+				if endpoint.Analytics == AnalyticsDrop {
+					continue
+				}
+				anonymize = true
+			}
+		}
+
+		var err error
+		switch {
+		case anonymize && anonymizedBody == nil:
+			anonymizedBody, err = s.encodeAnonymized(webhookEvent)
+		case !anonymize && body == nil:
+			body, err = json.Marshal(webhookEvent)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error encoding webhook event: %w", err)
+		}
+		endpointBody := body
+		if anonymize {
+			endpointBody = anonymizedBody
+		}
+
+		deliveries = append(deliveries, models.WebhookDelivery{
+			ID:            uuid.New(),
+			Endpoint:      endpoint.Name,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Body:          endpointBody,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	return deliveries, nil
+}
+
+// encodeAnonymized encodes event without the fields identifying the user
+func (s *WebhookService) encodeAnonymized(event models.WebhookEvent) ([]byte, error) {
+	anonymized, err := s.consent.Anonymize(event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(anonymized)
+}
+
+// subscribed reports whether an endpoint receives events of a type
+func subscribed(endpoint config.WebhookEndpointConfig, eventType string) bool {
+	if len(endpoint.Events) == 0 {
+		return true
+	}
+	for _, subscribedType := range endpoint.Events {
+		if subscribedType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliverDue attempts the deliveries that are due, rescheduling the ones that fail
+func (s *WebhookService) DeliverDue(ctx context.Context) error {
+	return s.deliverDue(ctx, nil)
+}
+
+// deliverDue attempts the deliveries that are due, starting no further attempts once stop is
+// closed; deliveries claimed but not attempted are retried once their claim expires
+func (s *WebhookService) deliverDue(ctx context.Context, stop <-chan struct{}) error {
+	now := time.Now()
+	// A claimed delivery is retried by any instance once the attempt has certainly timed out
+	leaseUntil := now.Add(2 * s.config.GetWebhookTimeout())
+	deliveries, err := s.webhookRepo.ClaimDue(ctx, now, leaseUntil, webhookDeliveryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range deliveries {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if err := s.deliver(ctx, &deliveries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver makes one attempt at a delivery and stores its outcome
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	endpoint, ok := s.endpoint(delivery.Endpoint)
+
+	var sendErr error
+	if ok {
+		sendErr = s.client.Send(ctx, endpoint, *delivery)
+	} else {
+		sendErr = fmt.Errorf("webhook endpoint no longer configured")
+	}
+	if sendErr != nil && ctx.Err() != nil {
+		// Shutting down; the delivery is retried once its claim expires
+		return ctx.Err()
+	}
+
+	delivery.Attempts++
+	now := time.Now()
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = nil
+	case !ok || delivery.Attempts >= s.config.GetWebhookMaxAttempts():
+		lastError := sendErr.Error()
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.LastError = &lastError
+		s.logger.Error("Giving up webhook delivery",
+			"endpoint", delivery.Endpoint,
+			"event_id", delivery.EventID,
+			"event_type", delivery.EventType,
+			"attempts", delivery.Attempts,
+			"error", sendErr,
+		)
+	default:
+		lastError := sendErr.Error()
+		delivery.LastError = &lastError
+		delivery.NextAttemptAt = now.Add(s.backoff(delivery.Attempts))
+		s.logger.Warn("Webhook delivery failed",
+			"endpoint", delivery.Endpoint,
+			"event_id", delivery.EventID,
+			"event_type", delivery.EventType,
+			"attempts", delivery.Attempts,
+			"next_attempt_at", delivery.NextAttemptAt,
+			"error", sendErr,
+		)
+	}
+
+	return s.webhookRepo.Update(ctx, delivery)
+}
+
+// endpoint returns the configured endpoint with the given name
+func (s *WebhookService) endpoint(name string) (config.WebhookEndpointConfig, bool) {
+	for _, endpoint := range s.config.Webhooks.Endpoints {
+		if endpoint.Name == name {
+			return endpoint, true
+		}
+	}
+	return config.WebhookEndpointConfig{}, false
+}
+
+// backoff returns the delay before the next attempt after a number of failed attempts:
+// the initial backoff, doubled for every further failure, up to the maximum backoff
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	delay := s.config.GetWebhookInitialBackoff()
+	maxDelay := s.config.GetWebhookMaxBackoff()
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
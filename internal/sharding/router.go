@@ -0,0 +1,79 @@
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Router routes keys to shards with rendezvous (highest random weight) hashing:
+// every key goes to the shard whose name hashes highest together with the key.
+// Routing depends only on the shard names, not their order, and adding or removing
+// a shard only moves the keys that go to or came from that shard.
+type Router struct {
+	names []string
+}
+
+// NewRouter creates a router for the named shards
+func NewRouter(names []string) (*Router, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no shards configured")
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("shard name cannot be empty")
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate shard name: %s", name)
+		}
+		seen[name] = true
+	}
+	return &Router{names: append([]string(nil), names...)}, nil
+}
+
+// Route returns the index of the shard key belongs to
+func (r *Router) Route(key string) int {
+	best, bestWeight := 0, uint64(0)
+	for i, name := range r.names {
+		if weight := weight(name, key); i == 0 || weight > bestWeight {
+			best, bestWeight = i, weight
+		}
+	}
+	return best
+}
+
+// Name returns the name of the shard at index
+func (r *Router) Name(index int) string {
+	return r.names[index]
+}
+
+// Index returns the index of the named shard, or -1 if there is none
+func (r *Router) Index(name string) int {
+	for i, n := range r.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Len returns the number of shards
+func (r *Router) Len() int {
+	return len(r.names)
+}
+
+// weight hashes a shard name together with a key
+func weight(name, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	// FNV's last bytes barely affect its high bits; mix them so weights compare fairly
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/sharding"
+)
+
+// phoneNumbers returns n distinct phone numbers
+func phoneNumbers(n int) []string {
+	numbers := make([]string, n)
+	for i := range numbers {
+		numbers[i] = fmt.Sprintf("+98912%07d", i)
+	}
+	return numbers
+}
+
+func newRouter(t *testing.T, names ...string) *sharding.Router {
+	t.Helper()
+
+	router, err := sharding.NewRouter(names)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	return router
+}
+
+func TestRouterSpreadsKeysEvenly(t *testing.T) {
+	router := newRouter(t, "eu-1", "eu-2", "eu-3", "eu-4")
+
+	counts := make([]int, router.Len())
+	for _, number := range phoneNumbers(10000) {
+		counts[router.Route(number)]++
+	}
+	for i, count := range counts {
+		if count < 2000 || count > 3000 {
+			t.Fatalf("shard %s got %d of 10000 keys, expected about 2500: %v", router.Name(i), count, counts)
+		}
+	}
+}
+
+func TestRouterIgnoresShardOrder(t *testing.T) {
+	router := newRouter(t, "eu-1", "eu-2", "eu-3")
+	reordered := newRouter(t, "eu-3", "eu-1", "eu-2")
+
+	for _, number := range phoneNumbers(1000) {
+		if a, b := router.Name(router.Route(number)), reordered.Name(reordered.Route(number)); a != b {
+			t.Fatalf("%s routed to %s, and to %s after reordering the shards", number, a, b)
+		}
+	}
+}
+
+func TestRouterMovesOnlyKeysOfAddedShard(t *testing.T) {
+	router := newRouter(t, "eu-1", "eu-2", "eu-3")
+	grown := newRouter(t, "eu-1", "eu-2", "eu-3", "eu-4")
+
+	moved := 0
+	for _, number := range phoneNumbers(10000) {
+		before, after := router.Name(router.Route(number)), grown.Name(grown.Route(number))
+		if before == after {
+			continue
+		}
+		if after != "eu-4" {
+			t.Fatalf("%s moved from %s to %s instead of the new shard", number, before, after)
+		}
+		moved++
+	}
+	if moved < 2000 || moved > 3000 {
+		t.Fatalf("expected about a quarter of the keys to move to the new shard, %d of 10000 did", moved)
+	}
+}
+
+func TestNewRouterRejectsInvalidNames(t *testing.T) {
+	for _, names := range [][]string{nil, {"eu-1", ""}, {"eu-1", "eu-1"}} {
+		if _, err := sharding.NewRouter(names); err == nil {
+			t.Errorf("expected error for shard names %q", names)
+		}
+	}
+
+	router := newRouter(t, "eu-1", "eu-2")
+	if router.Index("eu-2") != 1 || router.Index("us-1") != -1 {
+		t.Fatalf("unexpected shard indexes: eu-2 at %d, us-1 at %d", router.Index("eu-2"), router.Index("us-1"))
+	}
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/internal/silentauth"
+)
+
+func TestHeaderVerifier(t *testing.T) {
+	ctx := context.Background()
+	verifier := silentauth.HeaderVerifier{}
+
+	tests := []struct {
+		name   string
+		msisdn string
+		want   bool
+	}{
+		{"international without plus", "989121234567", true},
+		{"international with plus", "+989121234567", true},
+		{"national", "09121234567", true},
+		{"another number", "989127654321", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := verifier.Verify(ctx, "09121234567", silentauth.Evidence{MSISDN: tt.msisdn})
+			if err != nil || verified != tt.want {
+				t.Fatalf("Verify = %v, %v, want %v", verified, err, tt.want)
+			}
+		})
+	}
+
+	// Requests that didn't come through the enrichment proxy can't be verified
+	if _, err := verifier.Verify(ctx, "09121234567", silentauth.Evidence{}); !errors.Is(err, silentauth.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable without an MSISDN, got %v", err)
+	}
+}
+
+func TestHTTPVerifier(t *testing.T) {
+	ctx := context.Background()
+	var got struct {
+		PhoneNumber string `json:"phone_number"`
+		Token       string `json:"token"`
+	}
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		switch got.Token {
+		case "unsupported":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		default:
+			json.NewEncoder(w).Encode(map[string]bool{"verified": got.Token == "device-token"})
+		}
+	}))
+	defer server.Close()
+	verifier := silentauth.NewHTTPVerifier(server.URL, "secret", time.Second)
+
+	verified, err := verifier.Verify(ctx, "09121234567", silentauth.Evidence{Token: "device-token"})
+	if err != nil || !verified {
+		t.Fatalf("Verify = %v, %v, want verified", verified, err)
+	}
+	if got.PhoneNumber != "+989121234567" || authorization != "Bearer secret" {
+		t.Fatalf("expected the normalized phone number with the bearer token, got %q with %q", got.PhoneNumber, authorization)
+	}
+
+	verified, err = verifier.Verify(ctx, "09121234567", silentauth.Evidence{Token: "other-token"})
+	if err != nil || verified {
+		t.Fatalf("Verify = %v, %v, want not verified", verified, err)
+	}
+
+	// Without a token, or when the API can't tell, the phone number is verified by OTP
+	for _, token := range []string{"", "unsupported"} {
+		if _, err := verifier.Verify(ctx, "09121234567", silentauth.Evidence{Token: token}); !errors.Is(err, silentauth.ErrUnavailable) {
+			t.Fatalf("token %q: expected ErrUnavailable, got %v", token, err)
+		}
+	}
+}
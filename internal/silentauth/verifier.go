@@ -0,0 +1,167 @@
+// Package silentauth verifies that a client holds a phone number by asking its carrier instead
+// of sending an OTP. Carriers can tell the number of devices on their mobile data network, either
+// by header enrichment, where their proxy adds the subscriber's number to requests passing
+// through it, or through a number verification API, which checks a token the device got from the
+// carrier over mobile data. Devices on Wi-Fi or with other carriers can't be verified this way,
+// and are sent an OTP instead.
+package silentauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/requestid"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// Provider types
+const (
+	ProviderNone   = "none"
+	ProviderHeader = "header"
+	ProviderHTTP   = "http"
+)
+
+// ErrUnavailable reports that the carrier couldn't tell the number of a device, e.g. because it
+// isn't on mobile data, so the phone number has to be verified by OTP
+var ErrUnavailable = errors.New("silent verification unavailable")
+
+// Evidence is what a request carries for the carrier to verify its device's phone number by
+type Evidence struct {
+	MSISDN string // passed by the carrier's enrichment proxy, empty unless the request came through one
+	Token  string // issued to the device by the carrier's number verification flow
+}
+
+// Verifier verifies phone numbers with their carrier
+type Verifier interface {
+	// Verify reports whether the carrier confirms that the device evidence comes from has
+	// phoneNumber. It fails with ErrUnavailable if the carrier can't tell.
+	Verify(ctx context.Context, phoneNumber string, evidence Evidence) (bool, error)
+}
+
+// NewVerifier creates the configured verifier: a header verifier for the header provider, an
+// HTTP verifier for the http provider, or a verifier that is never available otherwise
+func NewVerifier(cfg config.SilentAuthConfig) Verifier {
+	switch cfg.Provider {
+	case ProviderHeader:
+		return HeaderVerifier{}
+	case ProviderHTTP:
+		return NewHTTPVerifier(cfg.URL, cfg.Token, cfg.GetTimeout())
+	}
+	return UnavailableVerifier{}
+}
+
+// UnavailableVerifier is a Verifier for deployments without carrier support; every phone number
+// is verified by OTP
+type UnavailableVerifier struct{}
+
+// Verify fails with ErrUnavailable
+func (UnavailableVerifier) Verify(ctx context.Context, phoneNumber string, evidence Evidence) (bool, error) {
+	return false, ErrUnavailable
+}
+
+// HeaderVerifier is a Verifier comparing phone numbers with the number the carrier's enrichment
+// proxy passed, see MSISDNFromContext
+type HeaderVerifier struct{}
+
+// Verify reports whether the number the enrichment proxy passed is phoneNumber, in any of the
+// accepted formats. Requests that didn't come through the proxy fail with ErrUnavailable.
+func (HeaderVerifier) Verify(ctx context.Context, phoneNumber string, evidence Evidence) (bool, error) {
+	if evidence.MSISDN == "" {
+		return false, ErrUnavailable
+	}
+	msisdn := evidence.MSISDN
+	// Proxies pass numbers in international format, often without the plus
+	if !strings.HasPrefix(msisdn, "+") && !strings.HasPrefix(msisdn, "0") {
+		msisdn = "+" + msisdn
+	}
+	return utils.NormalizePhoneNumber(msisdn) == utils.NormalizePhoneNumber(phoneNumber), nil
+}
+
+// HTTPVerifier is a Verifier asking a carrier's number verification API, posting the phone
+// number and the device's token as JSON and reading whether they match from the response
+type HTTPVerifier struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+// NewHTTPVerifier creates a verifier posting to the API at url, authenticating with token as a
+// bearer token if it isn't empty, whose requests time out after timeout
+func NewHTTPVerifier(url, token string, timeout time.Duration) *HTTPVerifier {
+	return &HTTPVerifier{httpClient: &http.Client{Timeout: timeout}, url: url, token: token}
+}
+
+// verifyRequest is the body of the requests to the API
+type verifyRequest struct {
+	PhoneNumber string `json:"phone_number"`
+	Token       string `json:"token"`
+}
+
+// verifyResponse is the body of the API's responses
+type verifyResponse struct {
+	Verified bool `json:"verified"`
+}
+
+// Verify asks the API whether the device the token was issued to has phoneNumber. Requests
+// without a token, failed requests and responses other than 200 fail with ErrUnavailable, so
+// the phone number is verified by OTP while the API is down.
+func (v *HTTPVerifier) Verify(ctx context.Context, phoneNumber string, evidence Evidence) (bool, error) {
+	if evidence.Token == "" {
+		return false, ErrUnavailable
+	}
+	body, err := json.Marshal(verifyRequest{PhoneNumber: utils.NormalizePhoneNumber(phoneNumber), Token: evidence.Token})
+	if err != nil {
+		return false, fmt.Errorf("error encoding number verification request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("error creating number verification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if v.token != "" {
+		req.Header.Set("Authorization", "Bearer "+v.token)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Drain the body so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return false, fmt.Errorf("%w: API responded with status %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var result verifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil {
+		return false, fmt.Errorf("%w: error decoding response: %v", ErrUnavailable, err)
+	}
+	return result.Verified, nil
+}
+
+// contextKey is the type of the context key MSISDNs are stored under
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the number the carrier's enrichment proxy passed
+func NewContext(ctx context.Context, msisdn string) context.Context {
+	return context.WithValue(ctx, contextKey{}, msisdn)
+}
+
+// MSISDNFromContext returns the number the carrier's enrichment proxy passed, or "" if the
+// request didn't come through one
+func MSISDNFromContext(ctx context.Context) string {
+	msisdn, _ := ctx.Value(contextKey{}).(string)
+	return msisdn
+}
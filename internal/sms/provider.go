@@ -0,0 +1,89 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+)
+
+// Provider types
+const (
+	ProviderTypeLog = "log"
+)
+
+// Provider defines the interface for SMS delivery providers
+type Provider interface {
+	// Name returns the unique name of the provider
+	Name() string
+
+	// SendOTP delivers an OTP code to a phone number from senderID, or from the provider's
+	// default sender ID if empty, returning the provider's ID for the message that its
+	// delivery receipts refer to. Providers refusing the sender ID return ErrSenderIDRejected.
+	// Providers calling external APIs forward the request ID carried by ctx
+	// (requestid.FromContext) in the requestid.Header header.
+	SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error)
+}
+
+// LogProvider is a Provider that writes OTP codes to the server logs instead of sending an SMS.
+// The codes are masked unless the logging configuration reveals sensitive values.
+type LogProvider struct {
+	name   string
+	logger *slog.Logger
+}
+
+// NewLogProvider creates a new log provider
+func NewLogProvider(name string, logger *slog.Logger) *LogProvider {
+	return &LogProvider{name: name, logger: logger}
+}
+
+// Name returns the unique name of the provider
+func (p *LogProvider) Name() string {
+	return p.name
+}
+
+// SendOTP writes the OTP code to the server logs under a new message ID
+func (p *LogProvider) SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error) {
+	messageID := uuid.New().String()
+	logging.FromContext(ctx, p.logger).InfoContext(ctx, "OTP sent",
+		"provider", p.name,
+		"message_id", messageID,
+		"phone_number", phoneNumber,
+		"sender_id", senderID,
+		"otp", code,
+	)
+	return messageID, nil
+}
+
+// NewProviders creates the configured providers in rotation order
+func NewProviders(configs []config.SMSProviderConfig, logger *slog.Logger) ([]Provider, error) {
+	providers := make([]Provider, 0, len(configs))
+	seen := make(map[string]bool, len(configs))
+
+	for _, pc := range configs {
+		if pc.Name == "" {
+			return nil, fmt.Errorf("SMS provider name cannot be empty")
+		}
+		if seen[pc.Name] {
+			return nil, fmt.Errorf("duplicate SMS provider name: %s", pc.Name)
+		}
+		seen[pc.Name] = true
+
+		switch pc.Type {
+		case ProviderTypeLog:
+			providers = append(providers, NewLogProvider(pc.Name, logger))
+		default:
+			return nil, fmt.Errorf("unknown SMS provider type %q for provider %s", pc.Type, pc.Name)
+		}
+	}
+
+	// Fall back to printing codes to the logs when no provider is configured
+	if len(providers) == 0 {
+		providers = append(providers, NewLogProvider(ProviderTypeLog, logger))
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,265 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// ErrPhoneSuppressed is returned when a phone number is on the suppression list
+var ErrPhoneSuppressed = errors.New("OTP delivery to phone number suppressed")
+
+// Sender delivers OTPs through the providers in rotation, failing over to the next provider
+// when one errors or times out. Providers whose error rate crosses the failover threshold are
+// quarantined and only tried once every healthy provider has failed.
+type Sender struct {
+	providers       []Provider
+	stateRepo       repository.ProviderStateRepository
+	suppressionRepo repository.SuppressionRepository
+	failover        config.SMSFailoverConfig
+	logger          *slog.Logger
+}
+
+// NewSender creates a new sender for the given providers in rotation order
+func NewSender(
+	providers []Provider,
+	stateRepo repository.ProviderStateRepository,
+	suppressionRepo repository.SuppressionRepository,
+	failover config.SMSFailoverConfig,
+	logger *slog.Logger,
+) *Sender {
+	return &Sender{
+		providers:       providers,
+		stateRepo:       stateRepo,
+		suppressionRepo: suppressionRepo,
+		failover:        failover,
+		logger:          logger,
+	}
+}
+
+// Receipt identifies a sent OTP message, for matching the provider's delivery receipts to it
+type Receipt struct {
+	Provider  string
+	MessageID string
+}
+
+// SendOTP delivers an OTP code using the first enabled provider that succeeds, unless the
+// phone number is on the suppression list
+func (s *Sender) SendOTP(ctx context.Context, phoneNumber, code string) (Receipt, error) {
+	if err := s.CheckPhone(ctx, phoneNumber); err != nil {
+		return Receipt{}, err
+	}
+
+	candidates, err := s.candidates(ctx)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	var lastErr error
+	for _, provider := range candidates {
+		messageID, err := s.send(ctx, provider, phoneNumber, code)
+		if err == nil {
+			return Receipt{Provider: provider.Name(), MessageID: messageID}, nil
+		}
+		lastErr = fmt.Errorf("error sending OTP via %s: %w", provider.Name(), err)
+
+		// Don't fail over once the caller has given up
+		if ctx.Err() != nil {
+			break
+		}
+		logging.FromContext(ctx, s.logger).WarnContext(ctx, "SMS provider failed, trying next provider",
+			"provider", provider.Name(),
+			"error", err,
+		)
+	}
+
+	if lastErr != nil {
+		return Receipt{}, lastErr
+	}
+	return Receipt{}, fmt.Errorf("no SMS provider available")
+}
+
+// CheckPhone returns ErrPhoneSuppressed if the phone number is on the suppression list
+func (s *Sender) CheckPhone(ctx context.Context, phoneNumber string) error {
+	suppressed, err := s.suppressionRepo.IsSuppressed(ctx, utils.NormalizePhoneNumber(phoneNumber))
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		return ErrPhoneSuppressed
+	}
+	return nil
+}
+
+// send delivers an OTP code through a single provider within the failover timeout,
+// recording the result towards the provider's error rate
+func (s *Sender) send(ctx context.Context, provider Provider, phoneNumber, code string) (string, error) {
+	sendCtx, cancel := context.WithTimeout(ctx, s.failover.GetTimeout())
+	defer cancel()
+
+	// Providers configured with sender IDs pick them by destination
+	messageID, err := provider.SendOTP(sendCtx, phoneNumber, code, "")
+	// A full send queue says nothing about the provider's health, and neither does
+	// the caller giving up
+	if errors.Is(err, ErrProviderThrottled) || (err != nil && ctx.Err() != nil) {
+		return "", err
+	}
+	s.recordResult(ctx, provider.Name(), err != nil)
+	return messageID, err
+}
+
+// recordResult counts a send towards a provider's error rate and quarantines the provider
+// once the rate crosses the failover threshold. Failures to record are logged rather than
+// failing the send.
+func (s *Sender) recordResult(ctx context.Context, name string, failed bool) {
+	logger := logging.FromContext(ctx, s.logger)
+
+	health, err := s.stateRepo.RecordProviderResult(ctx, name, failed, s.failover.GetWindow())
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to record SMS provider result", "provider", name, "error", err)
+		return
+	}
+	if !failed || health.Failed < s.failover.GetMinFailures() ||
+		float64(health.Failed)/float64(health.Sent) < s.failover.GetErrorRate() {
+		return
+	}
+
+	if err := s.stateRepo.QuarantineProvider(ctx, name, s.failover.GetQuarantine()); err != nil {
+		logger.ErrorContext(ctx, "Failed to quarantine SMS provider", "provider", name, "error", err)
+		return
+	}
+	logger.WarnContext(ctx, "SMS provider quarantined",
+		"provider", name,
+		"sent", health.Sent,
+		"failed", health.Failed,
+		"quarantine", s.failover.GetQuarantine(),
+	)
+}
+
+// candidates returns the enabled providers in the order they should be tried:
+// healthy providers in rotation order, then quarantined ones as a last resort
+func (s *Sender) candidates(ctx context.Context) ([]Provider, error) {
+	disabled, err := s.disabledSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	health, err := s.health(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var healthy, quarantined []Provider
+	for _, provider := range s.providers {
+		if disabled[provider.Name()] {
+			continue
+		}
+		if health[provider.Name()].QuarantinedUntil != nil {
+			quarantined = append(quarantined, provider)
+		} else {
+			healthy = append(healthy, provider)
+		}
+	}
+	return append(healthy, quarantined...), nil
+}
+
+// Providers returns all configured providers with their rotation state and health
+func (s *Sender) Providers(ctx context.Context) ([]models.ProviderStatus, error) {
+	disabled, err := s.disabledSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	health, err := s.health(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]models.ProviderStatus, len(s.providers))
+	for i, provider := range s.providers {
+		statuses[i] = models.ProviderStatus{
+			Name:           provider.Name(),
+			Enabled:        !disabled[provider.Name()],
+			ProviderHealth: health[provider.Name()],
+		}
+	}
+	return statuses, nil
+}
+
+// CheckAvailable returns an error unless a provider is in rotation and not quarantined
+func (s *Sender) CheckAvailable(ctx context.Context) error {
+	disabled, err := s.disabledSet(ctx)
+	if err != nil {
+		return err
+	}
+	health, err := s.health(ctx)
+	if err != nil {
+		return err
+	}
+	for _, provider := range s.providers {
+		if !disabled[provider.Name()] && health[provider.Name()].QuarantinedUntil == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no SMS provider available")
+}
+
+// SetProviderEnabled puts a provider back into or takes it out of rotation.
+// Enabling a provider also ends its quarantine and starts its error count over.
+func (s *Sender) SetProviderEnabled(ctx context.Context, name string, enabled bool) error {
+	if !s.hasProvider(name) {
+		return fmt.Errorf("provider not found")
+	}
+	if err := s.stateRepo.SetProviderEnabled(ctx, name, enabled); err != nil {
+		return fmt.Errorf("error updating provider state: %w", err)
+	}
+	if enabled {
+		if err := s.stateRepo.ResetProviderHealth(ctx, name); err != nil {
+			return fmt.Errorf("error resetting provider health: %w", err)
+		}
+	}
+	return nil
+}
+
+// hasProvider reports whether a provider with the given name is configured
+func (s *Sender) hasProvider(name string) bool {
+	for _, provider := range s.providers {
+		if provider.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// disabledSet returns the names of providers taken out of rotation
+func (s *Sender) disabledSet(ctx context.Context) (map[string]bool, error) {
+	names, err := s.stateRepo.DisabledProviders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading provider state: %w", err)
+	}
+
+	disabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		disabled[name] = true
+	}
+	return disabled, nil
+}
+
+// health returns the health of every configured provider by name
+func (s *Sender) health(ctx context.Context) (map[string]models.ProviderHealth, error) {
+	names := make([]string, len(s.providers))
+	for i, provider := range s.providers {
+		names[i] = provider.Name()
+	}
+
+	health, err := s.stateRepo.ProvidersHealth(ctx, names)
+	if err != nil {
+		return nil, fmt.Errorf("error loading provider health: %w", err)
+	}
+	return health, nil
+}
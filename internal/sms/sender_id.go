@@ -0,0 +1,104 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// ErrSenderIDRejected is returned, possibly wrapped, by providers refusing to send from a sender ID,
+// e.g. one not registered for the destination country
+var ErrSenderIDRejected = errors.New("sender ID rejected")
+
+// SenderIDs selects the sender IDs messages to a destination are sent from
+type SenderIDs struct {
+	rules []config.SMSSenderIDConfig // longest prefix first
+}
+
+// NewSenderIDs creates a selector for the configured sender IDs
+func NewSenderIDs(configs []config.SMSSenderIDConfig) *SenderIDs {
+	rules := append([]config.SMSSenderIDConfig(nil), configs...)
+	sort.SliceStable(rules, func(i, j int) bool { return len(rules[i].Prefix) > len(rules[j].Prefix) })
+	return &SenderIDs{rules: rules}
+}
+
+// For returns the sender IDs of the longest prefix phoneNumber starts with, in order of
+// preference, or nil if the provider's default sender ID is to be used
+func (s *SenderIDs) For(phoneNumber string) []string {
+	phoneNumber = utils.NormalizePhoneNumber(phoneNumber)
+	for _, rule := range s.rules {
+		if strings.HasPrefix(phoneNumber, rule.Prefix) {
+			return rule.IDs
+		}
+	}
+	return nil
+}
+
+// SenderIDProvider is a Provider sending from the sender IDs configured for each destination,
+// falling back to the next sender ID whenever the provider rejects one
+type SenderIDProvider struct {
+	Provider
+	senderIDs *SenderIDs
+	rejected  *metrics.CounterVec
+	logger    *slog.Logger
+}
+
+// NewSenderIDProvider wraps provider to send from senderIDs, exporting rejected sender IDs to registry
+func NewSenderIDProvider(provider Provider, senderIDs *SenderIDs, registry *metrics.Registry, logger *slog.Logger) *SenderIDProvider {
+	return &SenderIDProvider{
+		Provider:  provider,
+		senderIDs: senderIDs,
+		rejected: registry.CounterVec("sms_sender_id_rejected_total",
+			"Sends rejected by a provider because of their sender ID.", "provider", "sender_id"),
+		logger: logger,
+	}
+}
+
+// SendOTP delivers the OTP code from senderID if given, and otherwise from the sender IDs
+// configured for the destination, in order, until the provider accepts one. Once all are
+// rejected, it returns the last rejection.
+func (p *SenderIDProvider) SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error) {
+	senderIDs := p.senderIDs.For(phoneNumber)
+	if senderID != "" || len(senderIDs) == 0 {
+		return p.Provider.SendOTP(ctx, phoneNumber, code, senderID)
+	}
+
+	var err error
+	for i, senderID := range senderIDs {
+		var messageID string
+		messageID, err = p.Provider.SendOTP(ctx, phoneNumber, code, senderID)
+		if !errors.Is(err, ErrSenderIDRejected) {
+			return messageID, err
+		}
+		p.rejected.With(p.Name(), senderID).Inc()
+		if i < len(senderIDs)-1 {
+			logging.FromContext(ctx, p.logger).WarnContext(ctx, "SMS provider rejected sender ID, trying next sender ID",
+				"provider", p.Name(),
+				"sender_id", senderID,
+				"error", err,
+			)
+		}
+	}
+	return "", err
+}
+
+// NewSenderIDProviders wraps each provider configured with sender IDs in a SenderIDProvider
+func NewSenderIDProviders(providers []Provider, configs []config.SMSProviderConfig, registry *metrics.Registry, logger *slog.Logger) []Provider {
+	wrapped := make([]Provider, len(providers))
+	for i, provider := range providers {
+		wrapped[i] = provider
+		for _, pc := range configs {
+			if pc.Name == provider.Name() && len(pc.SenderIDs) > 0 {
+				wrapped[i] = NewSenderIDProvider(provider, NewSenderIDs(pc.SenderIDs), registry, logger)
+			}
+		}
+	}
+	return wrapped
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
+
+// senderIDProvider is a Provider rejecting the sender IDs in rejected, recording the ones it was asked to send from
+type senderIDProvider struct {
+	rejected map[string]bool
+	tried    []string
+}
+
+func (p *senderIDProvider) Name() string {
+	return "provider"
+}
+
+func (p *senderIDProvider) SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error) {
+	p.tried = append(p.tried, senderID)
+	if p.rejected[senderID] {
+		return "", fmt.Errorf("gateway refused %s: %w", senderID, sms.ErrSenderIDRejected)
+	}
+	return "message-" + senderID, nil
+}
+
+func TestSenderIDsFor(t *testing.T) {
+	senderIDs := sms.NewSenderIDs([]config.SMSSenderIDConfig{
+		{Prefix: "", IDs: []string{"OTPAuth"}},
+		{Prefix: "+98", IDs: []string{"3000123", "OTPAuth"}},
+		{Prefix: "+98912", IDs: []string{"2000456"}},
+	})
+
+	tests := []struct {
+		phoneNumber string
+		want        []string
+	}{
+		{"+989121234567", []string{"2000456"}},
+		{"09121234567", []string{"2000456"}},
+		{"+989351234567", []string{"3000123", "OTPAuth"}},
+		{"+447700900123", []string{"OTPAuth"}},
+	}
+	for _, tt := range tests {
+		if got := senderIDs.For(tt.phoneNumber); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("For(%s) = %v, want %v", tt.phoneNumber, got, tt.want)
+		}
+	}
+
+	if got := sms.NewSenderIDs([]config.SMSSenderIDConfig{{Prefix: "+44", IDs: []string{"OTPAuth"}}}).For("+989121234567"); got != nil {
+		t.Errorf("expected no sender IDs for an unmatched destination, got %v", got)
+	}
+}
+
+func TestSenderIDProviderFallsBackToNextSenderID(t *testing.T) {
+	ctx := context.Background()
+	senderIDs := sms.NewSenderIDs([]config.SMSSenderIDConfig{{Prefix: "+98", IDs: []string{"3000123", "OTPAuth"}}})
+
+	inner := &senderIDProvider{rejected: map[string]bool{"3000123": true}}
+	provider := sms.NewSenderIDProvider(inner, senderIDs, metrics.NewRegistry(), logging.Discard())
+	messageID, err := provider.SendOTP(ctx, "+989121234567", "123456", "")
+	if err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+	if messageID != "message-OTPAuth" || !reflect.DeepEqual(inner.tried, []string{"3000123", "OTPAuth"}) {
+		t.Fatalf("expected the send to fall back to OTPAuth, got %s after trying %v", messageID, inner.tried)
+	}
+
+	// Once every sender ID is rejected, the send fails so the next provider is tried
+	inner = &senderIDProvider{rejected: map[string]bool{"3000123": true, "OTPAuth": true}}
+	provider = sms.NewSenderIDProvider(inner, senderIDs, metrics.NewRegistry(), logging.Discard())
+	if _, err := provider.SendOTP(ctx, "+989121234567", "123456", ""); err == nil {
+		t.Fatal("expected an error once every sender ID is rejected")
+	}
+
+	// Destinations without sender IDs get the provider's default
+	inner = &senderIDProvider{}
+	provider = sms.NewSenderIDProvider(inner, senderIDs, metrics.NewRegistry(), logging.Discard())
+	if _, err := provider.SendOTP(ctx, "+447700900123", "123456", ""); err != nil || !reflect.DeepEqual(inner.tried, []string{""}) {
+		t.Fatalf("expected a send from the default sender ID, tried %v: %v", inner.tried, err)
+	}
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/repository"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
+
+// fakeProvider is a Provider that fails with err, or blocks until its context is done if hang is set
+type fakeProvider struct {
+	name string
+	err  error
+	hang bool
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+
+	if p.hang {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.name + "-message", nil
+}
+
+func (p *fakeProvider) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func newTestSender(providers []sms.Provider, failover config.SMSFailoverConfig) *sms.Sender {
+	return sms.NewSender(providers, repository.NewInMemoryProviderStateRepository(),
+		repository.NewInMemorySuppressionRepository(), failover, logging.Discard())
+}
+
+func TestSenderFailsOverToNextProvider(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakeProvider{name: "primary", err: errors.New("gateway error")}
+	slow := &fakeProvider{name: "slow", hang: true}
+	backup := &fakeProvider{name: "backup"}
+	sender := newTestSender([]sms.Provider{primary, slow, backup}, config.SMSFailoverConfig{Timeout: 1})
+
+	start := time.Now()
+	receipt, err := sender.SendOTP(ctx, "+989123456789", "123456")
+	if err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+	if receipt.Provider != "backup" || receipt.MessageID != "backup-message" {
+		t.Fatalf("expected a receipt from the backup provider, got %+v", receipt)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("expected the hanging provider to time out, send took %v", elapsed)
+	}
+	if primary.Calls() != 1 || slow.Calls() != 1 || backup.Calls() != 1 {
+		t.Fatalf("expected one attempt per provider, got %d, %d, %d", primary.Calls(), slow.Calls(), backup.Calls())
+	}
+
+	// Every provider failing returns the last provider's error
+	backup.err = errors.New("backup down")
+	if _, err := sender.SendOTP(ctx, "+989123456789", "123456"); err == nil || err.Error() != "error sending OTP via backup: backup down" {
+		t.Fatalf("expected the backup provider's error, got %v", err)
+	}
+}
+
+func TestSenderQuarantinesFailingProvider(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakeProvider{name: "primary", err: errors.New("gateway error")}
+	backup := &fakeProvider{name: "backup"}
+	sender := newTestSender([]sms.Provider{primary, backup}, config.SMSFailoverConfig{MinFailures: 3, ErrorRate: 0.5})
+
+	for i := 0; i < 3; i++ {
+		if _, err := sender.SendOTP(ctx, "+989123456789", "123456"); err != nil {
+			t.Fatalf("SendOTP %d: %v", i+1, err)
+		}
+	}
+
+	statuses, err := sender.Providers(ctx)
+	if err != nil {
+		t.Fatalf("Providers: %v", err)
+	}
+	if statuses[0].QuarantinedUntil == nil {
+		t.Fatalf("expected the primary provider to be quarantined after 3 failures, got %+v", statuses[0])
+	}
+	if statuses[1].QuarantinedUntil != nil || statuses[1].Sent != 3 {
+		t.Fatalf("expected the backup provider to be healthy with 3 sends, got %+v", statuses[1])
+	}
+
+	// A quarantined provider is skipped while a healthy one is available
+	if _, err := sender.SendOTP(ctx, "+989123456789", "123456"); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+	if primary.Calls() != 3 {
+		t.Fatalf("expected the quarantined provider to be skipped, got %d calls", primary.Calls())
+	}
+
+	// ...but is still tried as a last resort
+	backup.err = errors.New("backup down")
+	primary.err = nil
+	if _, err := sender.SendOTP(ctx, "+989123456789", "123456"); err != nil {
+		t.Fatalf("expected the quarantined provider to deliver as a last resort, got %v", err)
+	}
+	if primary.Calls() != 4 {
+		t.Fatalf("expected the quarantined provider to be tried last, got %d calls", primary.Calls())
+	}
+}
+
+func TestSenderEnablingProviderEndsQuarantine(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakeProvider{name: "primary", err: errors.New("gateway error")}
+	sender := newTestSender([]sms.Provider{primary}, config.SMSFailoverConfig{MinFailures: 1})
+
+	if _, err := sender.SendOTP(ctx, "+989123456789", "123456"); err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	statuses, err := sender.Providers(ctx)
+	if err != nil {
+		t.Fatalf("Providers: %v", err)
+	}
+	if statuses[0].QuarantinedUntil == nil {
+		t.Fatal("expected the provider to be quarantined")
+	}
+
+	if err := sender.SetProviderEnabled(ctx, "primary", true); err != nil {
+		t.Fatalf("SetProviderEnabled: %v", err)
+	}
+	statuses, err = sender.Providers(ctx)
+	if err != nil {
+		t.Fatalf("Providers: %v", err)
+	}
+	if statuses[0].QuarantinedUntil != nil || statuses[0].Failed != 0 {
+		t.Fatalf("expected enabling the provider to reset its health, got %+v", statuses[0])
+	}
+}
+
+func TestSenderCheckAvailable(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakeProvider{name: "primary", err: errors.New("gateway error")}
+	backup := &fakeProvider{name: "backup"}
+	sender := newTestSender([]sms.Provider{primary, backup}, config.SMSFailoverConfig{MinFailures: 1})
+
+	// A quarantined provider leaves the backup available
+	if _, err := sender.SendOTP(ctx, "+989123456789", "123456"); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+	if err := sender.CheckAvailable(ctx); err != nil {
+		t.Fatalf("expected the backup provider to be available, got %v", err)
+	}
+
+	// Taking the backup out of rotation leaves only the quarantined provider
+	if err := sender.SetProviderEnabled(ctx, "backup", false); err != nil {
+		t.Fatalf("SetProviderEnabled: %v", err)
+	}
+	if err := sender.CheckAvailable(ctx); err == nil {
+		t.Fatal("expected no provider to be available")
+	}
+}
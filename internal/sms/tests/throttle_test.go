@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/logging"
+	"github.com/lilokie/otp-auth/internal/metrics"
+	"github.com/lilokie/otp-auth/internal/sms"
+)
+
+// writeMetrics renders registry in the Prometheus text format
+func writeMetrics(t *testing.T, registry *metrics.Registry) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	return out.String()
+}
+
+func TestThrottleDelaysBeyondBurst(t *testing.T) {
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+	throttle := sms.NewThrottle("primary", 20, 2, 1, registry)
+
+	for i := 0; i < 2; i++ {
+		if delay, err := throttle.Wait(ctx); err != nil || delay != 0 {
+			t.Fatalf("send %d within burst: delay %v, err %v", i+1, delay, err)
+		}
+	}
+
+	start := time.Now()
+	delay, err := throttle.Wait(ctx)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if delay <= 0 || time.Since(start) < delay {
+		t.Fatalf("expected the third send to wait for a token, waited %v of %v", time.Since(start), delay)
+	}
+
+	if out := writeMetrics(t, registry); !strings.Contains(out, `sms_throttle_delayed_total{provider="primary"} 1`) {
+		t.Fatalf("expected one delayed send in metrics, got:\n%s", out)
+	}
+}
+
+func TestThrottleRejectsWhenQueueFull(t *testing.T) {
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+	throttle := sms.NewThrottle("primary", 10, 1, 1, registry)
+
+	if _, err := throttle.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// One send waits for the next token, filling the queue
+	waited := make(chan error, 1)
+	go func() {
+		_, err := throttle.Wait(ctx)
+		waited <- err
+	}()
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(writeMetrics(t, registry), `sms_throttle_queue_length{provider="primary"} 1`) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a send to be queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := throttle.Wait(ctx); !errors.Is(err, sms.ErrProviderThrottled) {
+		t.Fatalf("expected ErrProviderThrottled while the queue is full, got %v", err)
+	}
+	if err := <-waited; err != nil {
+		t.Fatalf("queued send: %v", err)
+	}
+	if !strings.Contains(writeMetrics(t, registry), `sms_throttle_rejected_total{provider="primary"} 1`) {
+		t.Fatal("expected the rejection to be counted")
+	}
+}
+
+func TestThrottleReturnsTokenOnCancel(t *testing.T) {
+	throttle := sms.NewThrottle("primary", 1, 1, 5, metrics.NewRegistry())
+
+	if _, err := throttle.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := throttle.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to cut the wait short, got %v", err)
+	}
+
+	// The cancelled send's reservation is handed back, so the next send waits about a second, not two
+	ctx, cancel = context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	if _, err := throttle.Wait(ctx); err != nil {
+		t.Fatalf("expected the next send to get the returned token: %v", err)
+	}
+}
+
+func TestNewThrottledProvidersWrapsRateLimitedProviders(t *testing.T) {
+	configs := []config.SMSProviderConfig{
+		{Name: "capped", Type: sms.ProviderTypeLog, RateLimit: 30},
+		{Name: "uncapped", Type: sms.ProviderTypeLog},
+	}
+	providers, err := sms.NewProviders(configs, logging.Discard())
+	if err != nil {
+		t.Fatalf("NewProviders: %v", err)
+	}
+
+	providers = sms.NewThrottledProviders(providers, configs, metrics.NewRegistry())
+	if _, ok := providers[0].(*sms.ThrottledProvider); !ok || providers[0].Name() != "capped" {
+		t.Fatalf("expected the rate limited provider to be throttled, got %T", providers[0])
+	}
+	if _, ok := providers[1].(*sms.ThrottledProvider); ok {
+		t.Fatal("expected the provider without a rate limit to be left alone")
+	}
+	if _, err := providers[0].SendOTP(context.Background(), "+989121234567", "123456", ""); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/metrics"
+)
+
+// ErrProviderThrottled is returned when a provider's send queue is full
+var ErrProviderThrottled = errors.New("SMS provider send queue full")
+
+// defaultMaxQueue is the number of sends allowed to wait for a throttled provider if unset
+const defaultMaxQueue = 100
+
+// Throttle is a token bucket that keeps the messages sent through a provider under its rate cap.
+// Sends beyond the burst wait for a token in arrival order; once maxQueue sends are waiting,
+// further sends are rejected with ErrProviderThrottled rather than queueing without bound.
+type Throttle struct {
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	waiting int
+
+	rate     float64 // tokens per second
+	burst    float64
+	maxQueue int
+
+	queueGauge   metrics.Gauge
+	delayed      metrics.Counter
+	delaySeconds metrics.Counter
+	rejected     metrics.Counter
+}
+
+// NewThrottle creates a throttle for the named provider allowing rate messages per second,
+// exporting its queue length, throttle-induced delay and rejections to registry
+func NewThrottle(provider string, rate float64, burst, maxQueue int, registry *metrics.Registry) *Throttle {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	if maxQueue <= 0 {
+		maxQueue = defaultMaxQueue
+	}
+
+	return &Throttle{
+		tokens:   float64(burst),
+		last:     time.Now(),
+		rate:     rate,
+		burst:    float64(burst),
+		maxQueue: maxQueue,
+		queueGauge: registry.GaugeVec("sms_throttle_queue_length",
+			"Sends currently waiting for a provider's rate cap.", "provider").With(provider),
+		delayed: registry.CounterVec("sms_throttle_delayed_total",
+			"Sends delayed to respect a provider's rate cap.", "provider").With(provider),
+		delaySeconds: registry.CounterVec("sms_throttle_delay_seconds_total",
+			"Total time sends waited for a provider's rate cap.", "provider").With(provider),
+		rejected: registry.CounterVec("sms_throttle_rejected_total",
+			"Sends rejected because a provider's send queue was full.", "provider").With(provider),
+	}
+}
+
+// Wait blocks until a message may be sent, returning how long it waited.
+// It returns ErrProviderThrottled without waiting if the queue is full, or ctx's error
+// if ctx is done first.
+func (t *Throttle) Wait(ctx context.Context) (time.Duration, error) {
+	t.mu.Lock()
+	now := time.Now()
+	t.tokens = math.Min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+
+	if t.tokens >= 1 {
+		t.tokens--
+		t.mu.Unlock()
+		return 0, nil
+	}
+	if t.waiting >= t.maxQueue {
+		t.mu.Unlock()
+		t.rejected.Inc()
+		return 0, ErrProviderThrottled
+	}
+
+	// Reserve the next token; the bucket goes negative by the tokens promised to waiting sends
+	delay := time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+	t.tokens--
+	t.waiting++
+	t.queueGauge.Set(float64(t.waiting))
+	t.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	t.mu.Lock()
+	t.waiting--
+	if err != nil {
+		// Hand the reserved token back to the sends behind this one
+		t.tokens++
+	}
+	t.queueGauge.Set(float64(t.waiting))
+	t.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+	t.delayed.Inc()
+	t.delaySeconds.Add(delay.Seconds())
+	return delay, nil
+}
+
+// ThrottledProvider is a Provider whose sends are kept under a rate cap by a Throttle
+type ThrottledProvider struct {
+	Provider
+	throttle *Throttle
+}
+
+// NewThrottledProvider wraps provider with throttle
+func NewThrottledProvider(provider Provider, throttle *Throttle) *ThrottledProvider {
+	return &ThrottledProvider{Provider: provider, throttle: throttle}
+}
+
+// SendOTP waits for the provider's rate cap, then delivers the OTP code
+func (p *ThrottledProvider) SendOTP(ctx context.Context, phoneNumber, code, senderID string) (string, error) {
+	if _, err := p.throttle.Wait(ctx); err != nil {
+		return "", err
+	}
+	return p.Provider.SendOTP(ctx, phoneNumber, code, senderID)
+}
+
+// NewThrottledProviders wraps each provider configured with a rate limit in a ThrottledProvider
+func NewThrottledProviders(providers []Provider, configs []config.SMSProviderConfig, registry *metrics.Registry) []Provider {
+	throttled := make([]Provider, len(providers))
+	for i, provider := range providers {
+		throttled[i] = provider
+		for _, pc := range configs {
+			if pc.Name == provider.Name() && pc.RateLimit > 0 {
+				throttle := NewThrottle(pc.Name, pc.RateLimit, pc.Burst, pc.MaxQueue, registry)
+				throttled[i] = NewThrottledProvider(provider, throttle)
+			}
+		}
+	}
+	return throttled
+}
@@ -0,0 +1,305 @@
+package sops
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/lilokie/otp-auth/internal/kms"
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/oauth2"
+)
+
+// Decrypting YAML files encrypted with SOPS (https://github.com/getsops/sops), so config files
+// holding secrets can be committed. Each value is encrypted with AES-256-GCM under a data key,
+// bound to its path in the document; the data key is in turn encrypted to age recipients or
+// with AWS or GCP KMS keys, listed in the document's sops metadata.
+//
+// The MAC SOPS computes over all values is not checked: tampering with a value fails its own
+// authentication, but values could be removed unnoticed. Shamir key groups aren't supported.
+
+// metadataKey is the top-level key of the SOPS metadata
+const metadataKey = "sops"
+
+// encryptedValue matches the values SOPS encrypted
+var encryptedValue = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.*),tag:(.*),type:(.*)\]$`)
+
+// Keys are the keys the data key of documents can be decrypted with
+type Keys struct {
+	Age         []age.Identity
+	AWSEndpoint string             // overrides the regional AWS KMS endpoint if not empty
+	GCPTokens   oauth2.TokenSource // nil if there are no GCP credentials
+	GCPEndpoint string             // overrides the Cloud KMS endpoint if not empty
+	Timeout     time.Duration
+}
+
+// KeysFromEnv returns the keys of the environment, as the sops command line tool finds them:
+// age secret keys in SOPS_AGE_KEY or the file SOPS_AGE_KEY_FILE, AWS credentials from the
+// AWS SDK's default chain, and GCP credentials from Application Default Credentials
+func KeysFromEnv(timeout time.Duration) (Keys, error) {
+	keys := Keys{Timeout: timeout}
+	if tokens, err := kms.DefaultGCPTokens(context.Background()); err == nil {
+		keys.GCPTokens = tokens
+	}
+
+	ageKeys := os.Getenv("SOPS_AGE_KEY")
+	if path := os.Getenv("SOPS_AGE_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Keys{}, fmt.Errorf("error reading age key file: %w", err)
+		}
+		ageKeys += "\n" + string(data)
+	}
+	if strings.TrimSpace(ageKeys) != "" {
+		identities, err := age.ParseIdentities(strings.NewReader(ageKeys))
+		if err != nil {
+			return Keys{}, fmt.Errorf("error parsing age keys: %w", err)
+		}
+		keys.Age = identities
+	}
+	return keys, nil
+}
+
+// metadata is the part of the SOPS metadata needed to decrypt the data key
+type metadata struct {
+	Age []struct {
+		Recipient string `yaml:"recipient"`
+		Enc       string `yaml:"enc"`
+	} `yaml:"age"`
+	KMS []struct {
+		ARN     string            `yaml:"arn"`
+		Role    string            `yaml:"role"`
+		Context map[string]string `yaml:"context"`
+		Enc     string            `yaml:"enc"`
+	} `yaml:"kms"`
+	GCPKMS []struct {
+		ResourceID string `yaml:"resource_id"`
+		Enc        string `yaml:"enc"`
+	} `yaml:"gcp_kms"`
+	KeyGroups []yaml.Node `yaml:"key_groups"`
+}
+
+// IsEncrypted returns whether document is a YAML document encrypted with SOPS
+func IsEncrypted(document []byte) bool {
+	var root yaml.Node
+	if err := yaml.Unmarshal(document, &root); err != nil {
+		return false
+	}
+	_, meta := metadataNode(&root)
+	return meta != nil && meta.Kind == yaml.MappingNode
+}
+
+// metadataNode returns the mapping of a document and its sops metadata, if any
+func metadataNode(root *yaml.Node) (*yaml.Node, *yaml.Node) {
+	if root.Kind != yaml.DocumentNode || len(root.Content) != 1 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	mapping := root.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == metadataKey {
+			return mapping, mapping.Content[i+1]
+		}
+	}
+	return mapping, nil
+}
+
+// DecryptYAML decrypts a YAML document encrypted with SOPS, returning the plaintext document
+// without its sops metadata
+func DecryptYAML(ctx context.Context, document []byte, keys Keys) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(document, &root); err != nil {
+		return nil, fmt.Errorf("error parsing SOPS document: %w", err)
+	}
+	mapping, metaNode := metadataNode(&root)
+	if metaNode == nil {
+		return nil, fmt.Errorf("error parsing SOPS document: no sops metadata")
+	}
+	var meta metadata
+	if err := metaNode.Decode(&meta); err != nil {
+		return nil, fmt.Errorf("error parsing SOPS metadata: %w", err)
+	}
+
+	dataKey, err := decryptDataKey(ctx, meta, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop the metadata, then decrypt the values in place
+	var content []*yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != metadataKey {
+			content = append(content, mapping.Content[i], mapping.Content[i+1])
+		}
+	}
+	mapping.Content = content
+	if err := decryptNode(mapping, nil, dataKey); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := yaml.Marshal(&root)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding decrypted SOPS document: %w", err)
+	}
+	return plaintext, nil
+}
+
+// decryptDataKey decrypts the data key with the first key that can: age identities first,
+// as they need no network, then AWS and GCP KMS keys
+func decryptDataKey(ctx context.Context, meta metadata, keys Keys) ([]byte, error) {
+	if len(meta.KeyGroups) > 0 {
+		return nil, fmt.Errorf("error decrypting SOPS data key: key groups are not supported")
+	}
+
+	var errs []error
+	if len(keys.Age) > 0 {
+		for _, entry := range meta.Age {
+			dataKey, err := decryptAge(entry.Enc, keys.Age)
+			if err == nil {
+				return dataKey, nil
+			}
+			errs = append(errs, fmt.Errorf("age recipient %s: %w", entry.Recipient, err))
+		}
+	}
+
+	for _, entry := range meta.KMS {
+		if entry.Role != "" {
+			errs = append(errs, fmt.Errorf("AWS KMS key %s: assuming roles is not supported", entry.ARN))
+			continue
+		}
+		dataKey, err := decryptAWS(ctx, entry.ARN, entry.Enc, entry.Context, keys)
+		if err == nil {
+			return dataKey, nil
+		}
+		errs = append(errs, fmt.Errorf("AWS KMS key %s: %w", entry.ARN, err))
+	}
+
+	for _, entry := range meta.GCPKMS {
+		dataKey, err := decryptGCP(ctx, entry.ResourceID, entry.Enc, keys)
+		if err == nil {
+			return dataKey, nil
+		}
+		errs = append(errs, fmt.Errorf("GCP KMS key %s: %w", entry.ResourceID, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("error decrypting SOPS data key: no key available for any of the document's recipients")
+	}
+	return nil, fmt.Errorf("error decrypting SOPS data key: %w", errors.Join(errs...))
+}
+
+// decryptAge decrypts an ASCII-armored age file with any of identities
+func decryptAge(enc string, identities []age.Identity) ([]byte, error) {
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(enc)), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func decryptAWS(ctx context.Context, arn, enc string, encryptionContext map[string]string, keys Keys) ([]byte, error) {
+	// arn:aws:kms:<region>:<account>:key/<id>
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 {
+		return nil, fmt.Errorf("invalid key ARN")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted data key: %w", err)
+	}
+	key, err := kms.NewAWSKey(ctx, parts[3], keys.AWSEndpoint, arn, keys.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return key.Decrypt(ctx, ciphertext, encryptionContext)
+}
+
+func decryptGCP(ctx context.Context, resourceID, enc string, keys Keys) ([]byte, error) {
+	if keys.GCPTokens == nil {
+		return nil, fmt.Errorf("no GCP credentials")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted data key: %w", err)
+	}
+	return kms.NewGCPKey(keys.GCPEndpoint, resourceID, keys.GCPTokens, keys.Timeout).Decrypt(ctx, ciphertext)
+}
+
+// decryptNode decrypts the encrypted values under node, at path in the document
+func decryptNode(node *yaml.Node, path []string, dataKey []byte) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := decryptNode(node.Content[i+1], append(path, node.Content[i].Value), dataKey); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		// Items are bound to the path of their list
+		for _, item := range node.Content {
+			if err := decryptNode(item, path, dataKey); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		return decryptScalar(node, path, dataKey)
+	}
+	return nil
+}
+
+// decryptScalar decrypts a scalar if it is encrypted, restoring its type
+func decryptScalar(node *yaml.Node, path []string, dataKey []byte) error {
+	match := encryptedValue.FindStringSubmatch(node.Value)
+	if match == nil {
+		return nil
+	}
+	key := strings.Join(path, ":")
+
+	data, err1 := base64.StdEncoding.DecodeString(match[1])
+	iv, err2 := base64.StdEncoding.DecodeString(match[2])
+	tag, err3 := base64.StdEncoding.DecodeString(match[3])
+	if err := errors.Join(err1, err2, err3); err != nil || len(iv) == 0 {
+		return fmt.Errorf("error decrypting %s: invalid encrypted value", key)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %w", key, err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %w", key, err)
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(key+":"))
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %w", key, err)
+	}
+
+	node.Value = string(plaintext)
+	node.Style = 0
+	switch match[4] {
+	case "str", "bytes":
+		node.Tag = "!!str"
+		node.Style = yaml.DoubleQuotedStyle
+	case "int":
+		node.Tag = "!!int"
+	case "float":
+		node.Tag = "!!float"
+	case "bool":
+		// SOPS encrypts booleans as True or False
+		node.Tag = "!!bool"
+		node.Value = strings.ToLower(node.Value)
+	default:
+		return fmt.Errorf("error decrypting %s: unknown value type %q", key, match[4])
+	}
+	return nil
+}
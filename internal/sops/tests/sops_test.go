@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/lilokie/otp-auth/internal/sops"
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/oauth2"
+)
+
+// encryptValue encrypts value at path as sops does
+func encryptValue(t *testing.T, dataKey []byte, path, value, valueType string) string {
+	t.Helper()
+	block, _ := aes.NewCipher(dataKey)
+	gcm, _ := cipher.NewGCMWithNonceSize(block, 32)
+	iv := make([]byte, 32)
+	rand.Read(iv)
+	sealed := gcm.Seal(nil, iv, []byte(value), []byte(path+":"))
+	data, tag := sealed[:len(sealed)-16], sealed[len(sealed)-16:]
+	encode := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", encode(data), encode(iv), encode(tag), valueType)
+}
+
+// encryptedDocument returns a config document encrypted with dataKey, whose data key is
+// "encrypted" by the KMS as is
+func encryptedDocument(t *testing.T, dataKey []byte) string {
+	enc := func(path, value, valueType string) string {
+		return encryptValue(t, dataKey, path, value, valueType)
+	}
+	wrapped := base64.StdEncoding.EncodeToString(dataKey)
+	return `service:
+    name: otp-auth-service
+jwt:
+    secret: ` + enc("jwt:secret", "s3cret: with \"quotes\"", "str") + `
+    expirationHours: ` + enc("jwt:expirationHours", "24", "int") + `
+sms:
+    failover:
+        errorRate: ` + enc("sms:failover:errorRate", "0.5", "float") + `
+    providers:
+        - name: twilio
+          authToken: ` + enc("sms:providers:authToken", "token-1", "str") + `
+captcha:
+    enabled: ` + enc("captcha:enabled", "True", "bool") + `
+sops:
+    kms:
+        - arn: arn:aws:kms:us-east-1:111122223333:key/1234abcd
+          context:
+            app: otp
+          created_at: "2026-10-16T00:00:00Z"
+          enc: ` + wrapped + `
+    gcp_kms:
+        - resource_id: projects/p/locations/global/keyRings/r/cryptoKeys/config
+          created_at: "2026-10-16T00:00:00Z"
+          enc: ` + wrapped + `
+    lastmodified: "2026-10-16T00:00:00Z"
+    mac: ` + enc("", "MAC", "str") + `
+    version: 3.9.0
+`
+}
+
+// fakeAWSKMS decrypts ciphertexts into themselves, checking the encryption context
+func fakeAWSKMS(t *testing.T, fail bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"AccessDeniedException","message":"denied"}`))
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "TrentService.Decrypt" || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			t.Errorf("unexpected request %s", r.Header.Get("X-Amz-Target"))
+		}
+		var input struct {
+			KeyId             string
+			CiphertextBlob    []byte
+			EncryptionContext map[string]string
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		if input.EncryptionContext["app"] != "otp" {
+			t.Errorf("expected the encryption context, got %v", input.EncryptionContext)
+		}
+		json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": input.CiphertextBlob})
+	}))
+}
+
+// setAWSCredentials sets AWS credentials in the environment, where the SDK finds them
+func setAWSCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+}
+
+func newDataKey() []byte {
+	dataKey := make([]byte, 32)
+	rand.Read(dataKey)
+	return dataKey
+}
+
+func TestDecryptYAML(t *testing.T) {
+	dataKey := newDataKey()
+	document := encryptedDocument(t, dataKey)
+	if !sops.IsEncrypted([]byte(document)) {
+		t.Fatal("expected the document to be encrypted")
+	}
+
+	server := fakeAWSKMS(t, false)
+	defer server.Close()
+	setAWSCredentials(t)
+	keys := sops.Keys{AWSEndpoint: server.URL, Timeout: time.Second}
+	plaintext, err := sops.DecryptYAML(context.Background(), []byte(document), keys)
+	if err != nil {
+		t.Fatalf("DecryptYAML: %v", err)
+	}
+
+	var config map[string]any
+	if err := yaml.Unmarshal(plaintext, &config); err != nil {
+		t.Fatalf("error parsing decrypted document: %v", err)
+	}
+	jwt := config["jwt"].(map[string]any)
+	sms := config["sms"].(map[string]any)
+	switch {
+	case config["sops"] != nil:
+		t.Error("expected the sops metadata to be dropped")
+	case config["service"].(map[string]any)["name"] != "otp-auth-service":
+		t.Errorf("expected plaintext values to be kept, got %v", config["service"])
+	case jwt["secret"] != "s3cret: with \"quotes\"" || jwt["expirationHours"] != 24:
+		t.Errorf("unexpected jwt section %v", jwt)
+	case sms["failover"].(map[string]any)["errorRate"] != 0.5:
+		t.Errorf("unexpected failover section %v", sms["failover"])
+	case sms["providers"].([]any)[0].(map[string]any)["authToken"] != "token-1":
+		t.Errorf("unexpected providers %v", sms["providers"])
+	case config["captcha"].(map[string]any)["enabled"] != true:
+		t.Errorf("unexpected captcha section %v", config["captcha"])
+	}
+	if sops.IsEncrypted(plaintext) {
+		t.Error("expected the decrypted document not to be encrypted")
+	}
+}
+
+func TestDecryptYAMLWithAge(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity: %v", err)
+	}
+	dataKey := newDataKey()
+	var wrapped bytes.Buffer
+	armored := armor.NewWriter(&wrapped)
+	w, err := age.Encrypt(armored, identity.Recipient())
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	w.Write(dataKey)
+	w.Close()
+	armored.Close()
+
+	// The age recipient comes first, so the KMS keys, which have no endpoint, are never called
+	enc := "            " + strings.ReplaceAll(strings.TrimSpace(wrapped.String()), "\n", "\n            ")
+	document := strings.Replace(encryptedDocument(t, dataKey), "sops:\n", "sops:\n    age:\n        - recipient: "+identity.Recipient().String()+"\n          enc: |\n"+enc+"\n", 1)
+	keys := sops.Keys{Age: []age.Identity{identity}, Timeout: time.Second}
+	if _, err := sops.DecryptYAML(context.Background(), []byte(document), keys); err != nil {
+		t.Fatalf("expected the age identity to decrypt the data key, got %v", err)
+	}
+
+	// Another identity cannot, and neither can the KMS keys
+	server := fakeAWSKMS(t, true)
+	defer server.Close()
+	setAWSCredentials(t)
+	other, _ := age.GenerateX25519Identity()
+	keys.Age = []age.Identity{other}
+	keys.AWSEndpoint = server.URL
+	if _, err := sops.DecryptYAML(context.Background(), []byte(document), keys); err == nil || !strings.Contains(err.Error(), identity.Recipient().String()) {
+		t.Fatalf("expected the age recipient's error, got %v", err)
+	}
+}
+
+func TestDecryptYAMLFallsBackToGCP(t *testing.T) {
+	dataKey := newDataKey()
+	aws := fakeAWSKMS(t, true)
+	defer aws.Close()
+	gcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/p/locations/global/keyRings/r/cryptoKeys/config:decrypt" || r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var input struct {
+			Ciphertext []byte `json:"ciphertext"`
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		json.NewEncoder(w).Encode(map[string][]byte{"plaintext": input.Ciphertext})
+	}))
+	defer gcp.Close()
+
+	setAWSCredentials(t)
+	keys := sops.Keys{
+		AWSEndpoint: aws.URL,
+		GCPTokens:   oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token-1"}),
+		GCPEndpoint: gcp.URL,
+		Timeout:     time.Second,
+	}
+	if _, err := sops.DecryptYAML(context.Background(), []byte(encryptedDocument(t, dataKey)), keys); err != nil {
+		t.Fatalf("expected the GCP key to decrypt the data key, got %v", err)
+	}
+
+	// Without GCP credentials, every key's error is reported
+	keys.GCPTokens = nil
+	_, err := sops.DecryptYAML(context.Background(), []byte(encryptedDocument(t, dataKey)), keys)
+	if err == nil || !strings.Contains(err.Error(), "AccessDeniedException") || !strings.Contains(err.Error(), "no GCP credentials") {
+		t.Fatalf("expected both keys' errors, got %v", err)
+	}
+}
+
+func TestDecryptYAMLRejectsMovedValues(t *testing.T) {
+	dataKey := newDataKey()
+	server := fakeAWSKMS(t, false)
+	defer server.Close()
+	setAWSCredentials(t)
+	keys := sops.Keys{AWSEndpoint: server.URL, Timeout: time.Second}
+
+	// The secret encrypted for jwt.secret, moved to another key
+	document := encryptedDocument(t, dataKey)
+	moved := encryptValue(t, dataKey, "jwt:secret", "attacker-secret", "str")
+	document = strings.Replace(document, "name: otp-auth-service", "name: "+moved, 1)
+	if _, err := sops.DecryptYAML(context.Background(), []byte(document), keys); err == nil || !strings.Contains(err.Error(), "service:name") {
+		t.Fatalf("expected the moved value to be rejected, got %v", err)
+	}
+
+	// A value encrypted with another data key
+	foreign := encryptValue(t, newDataKey(), "jwt:expirationHours", "1", "int")
+	document = regexp.MustCompile(`expirationHours: ENC\[.*\]`).ReplaceAllLiteralString(encryptedDocument(t, dataKey), "expirationHours: "+foreign)
+	if _, err := sops.DecryptYAML(context.Background(), []byte(document), keys); err == nil {
+		t.Fatal("expected a value of another data key to be rejected")
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+	for document, want := range map[string]bool{
+		"service:\n  name: otp\n": false,
+		"sops: enabled\n":         false,
+		"- a\n- b\n":              false,
+		"not: [yaml":              false,
+		"jwt:\n  secret: x\nsops:\n  version: 3.9\n": true,
+	} {
+		if got := sops.IsEncrypted([]byte(document)); got != want {
+			t.Errorf("IsEncrypted(%q) = %v, want %v", document, got, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package sqlbuilder
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// identifierPattern restricts table and column names to lowercase identifiers, optionally qualified
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// Order is the direction of an ORDER BY term
+type Order string
+
+// Sort orders
+const (
+	Asc  Order = "ASC"
+	Desc Order = "DESC"
+)
+
+// SelectBuilder builds PostgreSQL SELECT statements whose values are always bound as
+// parameters. Conditions are written with ? wherever a value goes, and the ?s are
+// numbered $1, $2, ... in the order conditions were added when the query is built, so
+// no caller does placeholder arithmetic or concatenates values into SQL. Every ? in a
+// condition is a placeholder; conditions cannot use the jsonb ? operators.
+type SelectBuilder struct {
+	columns []string
+	from    string
+	where   []string
+	args    []interface{}
+	orderBy []orderTerm
+	limit   int
+	offset  int
+	err     error
+}
+
+// orderTerm is a column and direction of an ORDER BY clause
+type orderTerm struct {
+	column string
+	order  Order
+}
+
+// Select starts a query selecting columns
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+// From sets the table to select from
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.from = table
+	return b
+}
+
+// Where adds a condition, joined to the others with AND, binding args to its ?s in order
+func (b *SelectBuilder) Where(condition string, args ...interface{}) *SelectBuilder {
+	if placeholders := strings.Count(condition, "?"); placeholders != len(args) {
+		b.setErr(fmt.Errorf("condition %q has %d placeholders but %d args", condition, placeholders, len(args)))
+		return b
+	}
+	b.where = append(b.where, condition)
+	b.args = append(b.args, args...)
+	return b
+}
+
+// OrderBy adds a sort term. Columns must be plain identifiers, so sort columns
+// chosen by clients have to be mapped to a column name rather than passed through.
+func (b *SelectBuilder) OrderBy(column string, order Order) *SelectBuilder {
+	if !identifierPattern.MatchString(column) {
+		b.setErr(fmt.Errorf("invalid sort column %q", column))
+		return b
+	}
+	if order != Asc && order != Desc {
+		b.setErr(fmt.Errorf("invalid sort order %q", order))
+		return b
+	}
+	b.orderBy = append(b.orderBy, orderTerm{column: column, order: order})
+	return b
+}
+
+// Limit sets the maximum number of rows returned; 0 returns every row
+func (b *SelectBuilder) Limit(limit int) *SelectBuilder {
+	b.limit = limit
+	return b
+}
+
+// Offset sets the number of rows skipped
+func (b *SelectBuilder) Offset(offset int) *SelectBuilder {
+	b.offset = offset
+	return b
+}
+
+// ToSQL returns the query and the args to run it with, or the first error in building it
+func (b *SelectBuilder) ToSQL() (string, []interface{}, error) {
+	if err := b.validate(); err != nil {
+		return "", nil, err
+	}
+
+	var sql strings.Builder
+	sql.WriteString("SELECT " + strings.Join(b.columns, ", ") + " FROM " + b.from)
+	b.writeWhere(&sql)
+
+	if len(b.orderBy) > 0 {
+		terms := make([]string, len(b.orderBy))
+		for i, term := range b.orderBy {
+			terms[i] = term.column + " " + string(term.order)
+		}
+		sql.WriteString(" ORDER BY " + strings.Join(terms, ", "))
+	}
+
+	args := append([]interface{}{}, b.args...)
+	if b.limit > 0 {
+		args = append(args, b.limit)
+		sql.WriteString(" LIMIT $" + strconv.Itoa(len(args)))
+	}
+	if b.offset > 0 {
+		args = append(args, b.offset)
+		sql.WriteString(" OFFSET $" + strconv.Itoa(len(args)))
+	}
+
+	return sql.String(), args, nil
+}
+
+// CountSQL returns a query counting the rows the query matches, ignoring its
+// columns, order, limit and offset, and the args to run it with
+func (b *SelectBuilder) CountSQL() (string, []interface{}, error) {
+	if err := b.validate(); err != nil {
+		return "", nil, err
+	}
+
+	var sql strings.Builder
+	sql.WriteString("SELECT COUNT(*) FROM " + b.from)
+	b.writeWhere(&sql)
+
+	return sql.String(), append([]interface{}{}, b.args...), nil
+}
+
+// validate returns the first error in building the query
+func (b *SelectBuilder) validate() error {
+	switch {
+	case b.err != nil:
+		return b.err
+	case len(b.columns) == 0:
+		return fmt.Errorf("no columns selected")
+	case !identifierPattern.MatchString(b.from):
+		return fmt.Errorf("invalid table %q", b.from)
+	case b.limit < 0 || b.offset < 0:
+		return fmt.Errorf("negative limit or offset")
+	}
+	return nil
+}
+
+// writeWhere writes the WHERE clause, numbering the conditions' placeholders from $1
+func (b *SelectBuilder) writeWhere(sql *strings.Builder) {
+	if len(b.where) == 0 {
+		return
+	}
+
+	sql.WriteString(" WHERE ")
+	n := 0
+	for i, condition := range b.where {
+		if i > 0 {
+			sql.WriteString(" AND ")
+		}
+		sql.WriteString("(")
+		for _, ch := range condition {
+			if ch == '?' {
+				n++
+				sql.WriteString("$" + strconv.Itoa(n))
+				continue
+			}
+			sql.WriteRune(ch)
+		}
+		sql.WriteString(")")
+	}
+}
+
+// setErr records the first error in building the query
+func (b *SelectBuilder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Contains returns a LIKE pattern matching values that contain s, with the
+// LIKE wildcards in s escaped so they match literally
+func Contains(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(s) + "%"
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/sqlbuilder"
+)
+
+// users starts a user list query like the user repository's
+func users() *sqlbuilder.SelectBuilder {
+	return sqlbuilder.Select("id", "phone_number").From("users").Where("deleted_at IS NULL")
+}
+
+func TestSelectCombinations(t *testing.T) {
+	tests := []struct {
+		name      string
+		builder   *sqlbuilder.SelectBuilder
+		wantSQL   string
+		wantArgs  []interface{}
+		wantCount string
+		countArgs int // the leading args the count binds too
+	}{
+		{
+			name:      "no conditions",
+			builder:   sqlbuilder.Select("id").From("users"),
+			wantSQL:   "SELECT id FROM users",
+			wantArgs:  []interface{}{},
+			wantCount: "SELECT COUNT(*) FROM users",
+		},
+		{
+			name:      "page only",
+			builder:   users().OrderBy("created_at", sqlbuilder.Desc).Limit(10).Offset(20),
+			wantSQL:   "SELECT id, phone_number FROM users WHERE (deleted_at IS NULL) ORDER BY created_at DESC LIMIT $1 OFFSET $2",
+			wantArgs:  []interface{}{10, 20},
+			wantCount: "SELECT COUNT(*) FROM users WHERE (deleted_at IS NULL)",
+		},
+		{
+			name:      "search",
+			builder:   users().Where("phone_number LIKE ?", sqlbuilder.Contains("912")).OrderBy("created_at", sqlbuilder.Desc).Limit(10),
+			wantSQL:   "SELECT id, phone_number FROM users WHERE (deleted_at IS NULL) AND (phone_number LIKE $1) ORDER BY created_at DESC LIMIT $2",
+			wantArgs:  []interface{}{"%912%", 10},
+			wantCount: "SELECT COUNT(*) FROM users WHERE (deleted_at IS NULL) AND (phone_number LIKE $1)",
+			countArgs: 1,
+		},
+		{
+			name: "search, filters and sort",
+			builder: users().
+				Where("phone_number LIKE ?", sqlbuilder.Contains("912")).
+				Where("phone_verified = ?", true).
+				Where("created_at >= ? AND created_at < ?", "2026-01-01", "2026-02-01").
+				OrderBy("phone_number", sqlbuilder.Asc).
+				OrderBy("id", sqlbuilder.Asc).
+				Limit(50).
+				Offset(100),
+			wantSQL: "SELECT id, phone_number FROM users WHERE (deleted_at IS NULL) AND (phone_number LIKE $1) AND (phone_verified = $2)" +
+				" AND (created_at >= $3 AND created_at < $4) ORDER BY phone_number ASC, id ASC LIMIT $5 OFFSET $6",
+			wantArgs: []interface{}{"%912%", true, "2026-01-01", "2026-02-01", 50, 100},
+			wantCount: "SELECT COUNT(*) FROM users WHERE (deleted_at IS NULL) AND (phone_number LIKE $1) AND (phone_verified = $2)" +
+				" AND (created_at >= $3 AND created_at < $4)",
+			countArgs: 4,
+		},
+		{
+			name:      "filters without search, first page",
+			builder:   users().Where("role = ?", "operator").OrderBy("u.created_at", sqlbuilder.Asc).Limit(10).Offset(0),
+			wantSQL:   "SELECT id, phone_number FROM users WHERE (deleted_at IS NULL) AND (role = $1) ORDER BY u.created_at ASC LIMIT $2",
+			wantArgs:  []interface{}{"operator", 10},
+			wantCount: "SELECT COUNT(*) FROM users WHERE (deleted_at IS NULL) AND (role = $1)",
+			countArgs: 1,
+		},
+	}
+	for _, tt := range tests {
+		sql, args, err := tt.builder.ToSQL()
+		if err != nil {
+			t.Errorf("%s: ToSQL: %v", tt.name, err)
+			continue
+		}
+		if sql != tt.wantSQL || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: got %q %v, want %q %v", tt.name, sql, args, tt.wantSQL, tt.wantArgs)
+		}
+
+		// The count binds the same conditions without the page
+		countSQL, countArgs, err := tt.builder.CountSQL()
+		if err != nil {
+			t.Errorf("%s: CountSQL: %v", tt.name, err)
+			continue
+		}
+		wantCountArgs := tt.wantArgs[:tt.countArgs]
+		if countSQL != tt.wantCount || !reflect.DeepEqual(countArgs, wantCountArgs) {
+			t.Errorf("%s: got count %q %v, want %q %v", tt.name, countSQL, countArgs, tt.wantCount, wantCountArgs)
+		}
+	}
+}
+
+func TestSelectRejectsUnsafeInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *sqlbuilder.SelectBuilder
+	}{
+		{"injected sort column", users().OrderBy("created_at; DROP TABLE users", sqlbuilder.Asc)},
+		{"quoted sort column", users().OrderBy(`"created_at"`, sqlbuilder.Asc)},
+		{"invalid order", users().OrderBy("created_at", sqlbuilder.Order("DESC; --"))},
+		{"too few args", users().Where("phone_number = ? OR phone_number = ?", "+989121234567")},
+		{"too many args", users().Where("phone_verified", true)},
+		{"invalid table", sqlbuilder.Select("id").From("users u")},
+		{"no columns", sqlbuilder.Select().From("users")},
+		{"negative offset", users().Offset(-10)},
+	}
+	for _, tt := range tests {
+		if _, _, err := tt.builder.ToSQL(); err == nil {
+			t.Errorf("%s: expected ToSQL to fail", tt.name)
+		}
+	}
+}
+
+func TestContainsEscapesWildcards(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"912", "%912%"},
+		{"%", `%\%%`},
+		{"9_2", `%9\_2%`},
+		{`\`, `%\\%`},
+		{"' OR 1=1 --", "%' OR 1=1 --%"}, // bound as a parameter, so quotes need no escaping
+	}
+	for _, tt := range tests {
+		if got := sqlbuilder.Contains(tt.search); got != tt.want {
+			t.Errorf("Contains(%q) = %q, want %q", tt.search, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package tenant carries the tenant a request is made for, as passed by the proxies in front
+// of the service, so deployments serving several products can configure policies per tenant
+package tenant
+
+import (
+	"context"
+	"strings"
+)
+
+// maxLength is the longest tenant accepted
+const maxLength = 64
+
+// contextKey is the type of the context key tenants are stored under
+type contextKey struct{}
+
+// Normalize returns a tenant passed by a proxy in lower case, as configuration keys are read,
+// or "" if it isn't made of at most 64 letters, digits, dots, dashes and underscores
+func Normalize(tenant string) string {
+	tenant = strings.ToLower(strings.TrimSpace(tenant))
+	if len(tenant) > maxLength {
+		return ""
+	}
+	for i := 0; i < len(tenant); i++ {
+		c := tenant[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '.' && c != '-' && c != '_' {
+			return ""
+		}
+	}
+	return tenant
+}
+
+// NewContext returns a copy of ctx carrying the tenant of a request
+func NewContext(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant carried by ctx, or "" if there is none
+func FromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(contextKey{}).(string)
+	return tenant
+}
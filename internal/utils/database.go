@@ -18,6 +18,7 @@ func SetupDatabase(config *config.Config) (*sqlx.DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
+	configurePool(db, config)
 
 	// Test connection
 	if err := db.Ping(); err != nil {
@@ -26,3 +27,21 @@ func SetupDatabase(config *config.Config) (*sqlx.DB, error) {
 
 	return db, nil
 }
+
+// OpenDatabase sets up the database connection pool without connecting;
+// connections are dialed when first needed
+func OpenDatabase(config *config.Config) (*sqlx.DB, error) {
+	db, err := sqlx.Open("postgres", config.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	configurePool(db, config)
+	return db, nil
+}
+
+// configurePool sizes the connection pool of db as configured
+func configurePool(db *sqlx.DB, config *config.Config) {
+	db.SetMaxOpenConns(config.Postgres.MaxOpenConns)
+	db.SetMaxIdleConns(config.Postgres.MaxIdleConns)
+	db.SetConnMaxLifetime(config.GetConnMaxLifetime())
+}
@@ -0,0 +1,54 @@
+package utils
+
+import "strings"
+
+// IsValidPhoneNumber reports whether phoneNumber is an Iranian mobile number
+// in one of the accepted formats: +989XXXXXXXXX, 989XXXXXXXXX or 09XXXXXXXXX
+func IsValidPhoneNumber(phoneNumber string) bool {
+	national, ok := nationalNumber(phoneNumber)
+	return ok && national[0] == '9'
+}
+
+// IsValidLandline reports whether phoneNumber is an Iranian landline number, an area code
+// followed by the subscriber number, in the formats of mobile numbers: +98XXXXXXXXXX,
+// 98XXXXXXXXXX or 0XXXXXXXXXX, e.g. 02112345678 in Tehran
+func IsValidLandline(phoneNumber string) bool {
+	national, ok := nationalNumber(phoneNumber)
+	return ok && national[0] >= '1' && national[0] <= '8'
+}
+
+// NormalizePhoneNumber converts an Iranian mobile or landline number in any accepted format to
+// +98XXXXXXXXXX, so the same number written differently is recognized. Other values are
+// returned unchanged.
+func NormalizePhoneNumber(phoneNumber string) string {
+	if !IsValidPhoneNumber(phoneNumber) && !IsValidLandline(phoneNumber) {
+		return phoneNumber
+	}
+	national, _ := nationalNumber(phoneNumber)
+	return "+98" + national
+}
+
+// nationalNumber returns the ten digits of an Iranian number following the country code or the
+// trunk prefix 0, and whether phoneNumber is written in one of the accepted formats
+func nationalNumber(phoneNumber string) (string, bool) {
+	var national string
+	switch {
+	case strings.HasPrefix(phoneNumber, "+98"):
+		national = phoneNumber[3:]
+	case strings.HasPrefix(phoneNumber, "98"):
+		national = phoneNumber[2:]
+	case strings.HasPrefix(phoneNumber, "0"):
+		national = phoneNumber[1:]
+	default:
+		return "", false
+	}
+	if len(national) != 10 {
+		return "", false
+	}
+	for _, r := range national {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return national, true
+}
@@ -2,7 +2,10 @@ package utils
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/lilokie/otp-auth/config"
@@ -10,19 +13,106 @@ import (
 
 // SetupRedis sets up the Redis connection
 func SetupRedis(config *config.Config) (*redis.Client, error) {
-	// Create Redis client
-	client := redis.NewClient(&redis.Options{
-		Addr:     config.GetRedisAddr(),
-		Password: config.Redis.Password,
-		DB:       config.Redis.DB,
-	})
+	client, err := NewRedisClient(config)
+	if err != nil {
+		return nil, err
+	}
 
 	// Test connection
 	ctx := context.Background()
-	_, err := client.Ping(ctx).Result()
+	_, err = client.Ping(ctx).Result()
 	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("error connecting to Redis: %w", err)
 	}
 
 	return client, nil
 }
+
+// NewRedisClient creates the Redis client without connecting; connections are dialed when first needed
+func NewRedisClient(config *config.Config) (*redis.Client, error) {
+	tlsConfig, err := redisTLSConfig(config.Redis.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring Redis TLS: %w", err)
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:      config.GetRedisAddr(),
+		Username:  config.Redis.Username,
+		Password:  config.Redis.Password,
+		DB:        config.Redis.DB,
+		TLSConfig: tlsConfig,
+	}), nil
+}
+
+// SetupRedisShards sets up a connection to each configured Redis shard, in configuration order
+func SetupRedisShards(config *config.Config) ([]*redis.Client, error) {
+	return setupRedisInstances(config.Redis.Shards, "shard")
+}
+
+// SetupRedisRegions sets up a connection to the Redis instance of each other region OTPs are
+// replicated to, in configuration order
+func SetupRedisRegions(config *config.Config) ([]*redis.Client, error) {
+	return setupRedisInstances(config.Redis.Regions, "region")
+}
+
+// setupRedisInstances sets up a connection to each of instances, closing them all if one fails
+func setupRedisInstances(instances []config.RedisShardConfig, kind string) ([]*redis.Client, error) {
+	clients := make([]*redis.Client, 0, len(instances))
+	closeAll := func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}
+	for _, instance := range instances {
+		tlsConfig, err := redisTLSConfig(instance.TLS)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("error configuring TLS of Redis %s %s: %w", kind, instance.Name, err)
+		}
+		client := redis.NewClient(&redis.Options{
+			Addr:      instance.GetAddr(),
+			Username:  instance.Username,
+			Password:  instance.Password,
+			DB:        instance.DB,
+			TLSConfig: tlsConfig,
+		})
+
+		if _, err := client.Ping(context.Background()).Result(); err != nil {
+			client.Close()
+			closeAll()
+			return nil, fmt.Errorf("error connecting to Redis %s %s: %w", kind, instance.Name, err)
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// redisTLSConfig returns the TLS configuration of a Redis connection, or nil if TLS is disabled
+func redisTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
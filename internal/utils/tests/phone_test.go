@@ -0,0 +1,35 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lilokie/otp-auth/internal/phonetest"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	for _, number := range append(append([]phonetest.Number{}, phonetest.Mobiles...), phonetest.Landlines...) {
+		normalized := utils.NormalizePhoneNumber(number.Value)
+		if !strings.HasPrefix(normalized, "+98") || len(normalized) != 13 {
+			t.Errorf("%s: NormalizePhoneNumber(%q) = %q, want +98 and ten digits", number.Note, number.Value, normalized)
+		}
+		if utils.IsValidPhoneNumber(normalized) != utils.IsValidPhoneNumber(number.Value) {
+			t.Errorf("%s: normalizing %q to %q changed whether it is a mobile number", number.Note, number.Value, normalized)
+		}
+		if again := utils.NormalizePhoneNumber(normalized); again != normalized {
+			t.Errorf("%s: NormalizePhoneNumber(%q) = %q, want it unchanged", number.Note, normalized, again)
+		}
+	}
+	for _, number := range phonetest.Malformed {
+		if normalized := utils.NormalizePhoneNumber(number.Value); normalized != number.Value {
+			t.Errorf("%s: NormalizePhoneNumber(%q) = %q, want it unchanged", number.Note, number.Value, normalized)
+		}
+	}
+
+	for _, format := range []string{"09121234567", "989121234567", "+989121234567"} {
+		if normalized := utils.NormalizePhoneNumber(format); normalized != "+989121234567" {
+			t.Errorf("NormalizePhoneNumber(%q) = %q, want +989121234567", format, normalized)
+		}
+	}
+}
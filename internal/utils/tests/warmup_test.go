@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// warmUpDriver is a database driver recording the connections opened and the statements
+// prepared on each of them
+type warmUpDriver struct {
+	mu       sync.Mutex
+	conns    []*warmUpConn
+	queryErr error
+}
+
+func (d *warmUpDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	conn := &warmUpConn{driver: d, prepared: map[string]int{}}
+	d.conns = append(d.conns, conn)
+	return conn, nil
+}
+
+// opened returns how many connections were opened
+func (d *warmUpDriver) opened() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.conns)
+}
+
+// prepared returns how many times query was prepared on each connection opened
+func (d *warmUpDriver) prepared(query string) []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := make([]int, len(d.conns))
+	for i, conn := range d.conns {
+		counts[i] = conn.prepared[query]
+	}
+	return counts
+}
+
+type warmUpConn struct {
+	driver   *warmUpDriver
+	prepared map[string]int
+}
+
+func (c *warmUpConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.prepared[query]++
+	return warmUpStmt{}, nil
+}
+
+func (c *warmUpConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.driver.queryErr != nil {
+		return nil, c.driver.queryErr
+	}
+	return &warmUpRows{}, nil
+}
+
+func (c *warmUpConn) Close() error              { return nil }
+func (c *warmUpConn) Begin() (driver.Tx, error) { return warmUpTx{}, nil }
+
+type warmUpTx struct{}
+
+func (warmUpTx) Commit() error   { return nil }
+func (warmUpTx) Rollback() error { return nil }
+
+type warmUpStmt struct{}
+
+func (warmUpStmt) Close() error  { return nil }
+func (warmUpStmt) NumInput() int { return -1 }
+func (warmUpStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (warmUpStmt) Query(args []driver.Value) (driver.Rows, error) { return &warmUpRows{}, nil }
+
+// warmUpRows is a single row with a single column holding 1
+type warmUpRows struct {
+	done bool
+}
+
+func (r *warmUpRows) Columns() []string { return []string{"one"} }
+func (r *warmUpRows) Close() error      { return nil }
+func (r *warmUpRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+var warmUpDrivers atomic.Int64
+
+// openWarmUpDB opens a database on a new warmUpDriver with the given pool limits
+func openWarmUpDB(t *testing.T, maxOpen, maxIdle int) (*sqlx.DB, *warmUpDriver) {
+	t.Helper()
+
+	d := &warmUpDriver{}
+	name := fmt.Sprintf("warmup-%d", warmUpDrivers.Add(1))
+	sql.Register(name, d)
+	db, err := sqlx.Open(name, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	return db, d
+}
+
+func TestWarmUpDatabaseKeepsPoolLimits(t *testing.T) {
+	db, d := openWarmUpDB(t, 0, 2)
+
+	if err := utils.WarmUpDatabase(context.Background(), db, 5, nil); err != nil {
+		t.Fatalf("WarmUpDatabase: %v", err)
+	}
+	if opened := d.opened(); opened != 5 {
+		t.Fatalf("opened %d connections, want 5", opened)
+	}
+	// Only as many connections as configured are kept idle
+	if idle := db.Stats().Idle; idle != 2 {
+		t.Fatalf("%d idle connections, want the configured 2", idle)
+	}
+}
+
+func TestWarmUpDatabaseOpensAtMostMaxOpenConns(t *testing.T) {
+	db, d := openWarmUpDB(t, 3, 3)
+
+	// Asking for more connections than the pool may open must not wait for the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := utils.WarmUpDatabase(ctx, db, 5, nil); err != nil {
+		t.Fatalf("WarmUpDatabase: %v", err)
+	}
+	if opened := d.opened(); opened != 3 {
+		t.Fatalf("opened %d connections, want 3", opened)
+	}
+}
+
+func TestWarmUpDatabasePreparesStatements(t *testing.T) {
+	db, d := openWarmUpDB(t, 0, 3)
+	const query = "SELECT * FROM users WHERE id = $1"
+
+	statement, err := db.Prepare(query)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if err := utils.WarmUpDatabase(context.Background(), db, 3, []*sql.Stmt{statement}); err != nil {
+		t.Fatalf("WarmUpDatabase: %v", err)
+	}
+	counts := d.prepared(query)
+	if len(counts) != 3 {
+		t.Fatalf("opened %d connections, want 3", len(counts))
+	}
+	for i, count := range counts {
+		if count != 1 {
+			t.Fatalf("statement prepared %d times on connection %d, want once: %v", count, i, counts)
+		}
+	}
+
+	// Using the statement afterwards reuses the prepared statements
+	for i := 0; i < 3; i++ {
+		if _, err := statement.Exec("id"); err != nil {
+			t.Fatalf("Exec: %v", err)
+		}
+	}
+	for i, count := range d.prepared(query) {
+		if count != 1 {
+			t.Fatalf("statement prepared again on connection %d after warm-up", i)
+		}
+	}
+}
+
+func TestWarmUpDatabaseFails(t *testing.T) {
+	db, d := openWarmUpDB(t, 0, 2)
+	d.queryErr = errors.New("relation \"users\" does not exist")
+
+	err := utils.WarmUpDatabase(context.Background(), db, 2, nil)
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected the warm-up query's error, got %v", err)
+	}
+}
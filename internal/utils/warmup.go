@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+// databaseWarmupQuery touches the hot table so each backend loads its catalog cache
+const databaseWarmupQuery = `SELECT 1 FROM users LIMIT 1`
+
+// WarmUpDatabase opens n database connections at once, primes each of them and prepares
+// statements on each, so the first requests find warm connections with the statements ready.
+// It leaves the pool limits as configured: at most the pool's maximum open connections are
+// opened, and those beyond its maximum idle connections are closed once warmed up.
+func WarmUpDatabase(ctx context.Context, db *sqlx.DB, n int, statements []*sql.Stmt) error {
+	if maxOpen := db.Stats().MaxOpenConnections; maxOpen > 0 && n > maxOpen {
+		n = maxOpen
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	conns := make([]*sql.Conn, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			conns[i] = conn
+			errs[i] = warmUpConn(ctx, conn, statements)
+		}(i)
+	}
+	wg.Wait()
+
+	// Return the connections to the pool only once all of them are open,
+	// otherwise later iterations would just reuse earlier connections
+	for _, conn := range conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("error warming up database connections: %w", err)
+		}
+	}
+	return nil
+}
+
+// warmUpConn primes conn with a query and prepares statements on it. A statement is prepared
+// on a connection when used in a transaction on it, and stays prepared on the connection for
+// later uses of the statement after the transaction ends.
+func warmUpConn(ctx context.Context, conn *sql.Conn, statements []*sql.Stmt) error {
+	var one int
+	if err := conn.QueryRowContext(ctx, databaseWarmupQuery).Scan(&one); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		if err := tx.StmtContext(ctx, statement).Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WarmUpRedis opens n Redis connections at once and pings each of them,
+// leaving them idle in the pool for the first requests
+func WarmUpRedis(ctx context.Context, client *redis.Client, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	conns := make([]*redis.Conn, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			conns[i] = client.Conn(ctx)
+			errs[i] = conns[i].Ping(ctx).Err()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("error warming up Redis connections: %w", err)
+		}
+	}
+	return nil
+}
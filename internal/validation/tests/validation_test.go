@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+	"github.com/lilokie/otp-auth/internal/phonetest"
+	"github.com/lilokie/otp-auth/internal/validation"
+)
+
+func TestValidators(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.OTP.Length = 6
+	if err := validation.Register(cfg); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	type phones struct {
+		Mobile        string `binding:"omitempty,iranianMobile"`
+		International string `binding:"omitempty,e164"`
+	}
+	tests := []struct {
+		name  string
+		value phones
+		field string // field expected to fail, empty if valid
+		tag   string
+	}{
+		{"mobile with +98", phones{Mobile: "+989123456789"}, "", ""},
+		{"mobile with 98", phones{Mobile: "989123456789"}, "", ""},
+		{"mobile with 09", phones{Mobile: "09123456789"}, "", ""},
+		{"short mobile", phones{Mobile: "0912345678"}, "Mobile", validation.TagIranianMobile},
+		{"foreign mobile", phones{Mobile: "+14155550123"}, "Mobile", validation.TagIranianMobile},
+		{"e164", phones{International: "+14155550123"}, "", ""},
+		{"e164 without plus", phones{International: "14155550123"}, "International", validation.TagE164},
+		{"e164 with leading zero", phones{International: "+04155550123"}, "International", validation.TagE164},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := binding.Validator.ValidateStruct(tt.value)
+			tag, failed := validation.FailedTag(err, tt.field)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if !failed || tag != tt.tag {
+				t.Fatalf("expected %s to fail on %s, got %v", tt.field, tt.tag, err)
+			}
+		})
+	}
+}
+
+func TestPhoneNumberFixtures(t *testing.T) {
+	cfg := &config.Config{}
+	if err := validation.Register(cfg); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	type mobile struct {
+		Number string `binding:"iranianMobile"`
+	}
+	type voice struct {
+		Number string `binding:"iranianVoice"`
+	}
+	tests := []struct {
+		kind           string
+		numbers        []phonetest.Number
+		mobile         bool
+		voice          bool // with otp.channels.voiceLandlines off
+		voiceLandlines bool // with otp.channels.voiceLandlines on
+	}{
+		{"mobile", phonetest.Mobiles, true, true, true},
+		{"landline", phonetest.Landlines, false, false, true},
+		{"malformed", phonetest.Malformed, false, false, false},
+	}
+	for _, tt := range tests {
+		for _, number := range tt.numbers {
+			t.Run(tt.kind+" "+number.Note, func(t *testing.T) {
+				cfg.OTP.Channels.VoiceLandlines = false
+				if err := binding.Validator.ValidateStruct(mobile{number.Value}); (err == nil) != tt.mobile {
+					t.Errorf("iranianMobile(%q): valid = %v, want %v", number.Value, err == nil, tt.mobile)
+				}
+				if err := binding.Validator.ValidateStruct(voice{number.Value}); (err == nil) != tt.voice {
+					t.Errorf("iranianVoice(%q): valid = %v, want %v", number.Value, err == nil, tt.voice)
+				}
+				cfg.OTP.Channels.VoiceLandlines = true
+				if err := binding.Validator.ValidateStruct(voice{number.Value}); (err == nil) != tt.voiceLandlines {
+					t.Errorf("iranianVoice(%q) with landlines: valid = %v, want %v", number.Value, err == nil, tt.voiceLandlines)
+				}
+			})
+		}
+	}
+}
+
+func TestOTPCodeFollowsConfiguredLength(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.OTP.Length = 6
+	if err := validation.Register(cfg); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	valid := models.VerifyOTPRequest{ChallengeID: "c", OTP: "123456"}
+	if err := binding.Validator.ValidateStruct(valid); err != nil {
+		t.Fatalf("expected a 6 digit OTP to be valid, got %v", err)
+	}
+	for _, otp := range []string{"12345", "12345a", "1234567"} {
+		err := binding.Validator.ValidateStruct(models.VerifyOTPRequest{ChallengeID: "c", OTP: otp})
+		if tag, _ := validation.FailedTag(err, "OTP"); tag != validation.TagOTPCode {
+			t.Fatalf("expected OTP %q to fail on otpcode, got %v", otp, err)
+		}
+	}
+
+	// Backup codes are given instead of an OTP
+	if err := binding.Validator.ValidateStruct(models.VerifyOTPRequest{ChallengeID: "c", BackupCode: "abcd-efgh"}); err != nil {
+		t.Fatalf("expected a backup code without OTP to be valid, got %v", err)
+	}
+
+	cfg.OTP.Length = 8
+	if err := binding.Validator.ValidateStruct(models.VerifyOTPRequest{ChallengeID: "c", OTP: "12345678"}); err != nil {
+		t.Fatalf("expected an 8 digit OTP to be valid after the length changed, got %v", err)
+	}
+}
+
+func TestRequestOTPRequestPhoneNumber(t *testing.T) {
+	if err := validation.Register(&config.Config{}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	err := binding.Validator.ValidateStruct(models.RequestOTPRequest{})
+	if tag, _ := validation.FailedTag(err, "PhoneNumber"); tag != "required" {
+		t.Fatalf("expected a missing phone number to fail on required, got %v", err)
+	}
+	err = binding.Validator.ValidateStruct(models.RequestOTPRequest{PhoneNumber: "12345"})
+	if tag, _ := validation.FailedTag(err, "PhoneNumber"); tag != validation.TagIranianMobile {
+		t.Fatalf("expected an invalid phone number to fail on iranianMobile, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package validation registers the service's custom validators with Gin's binding engine, so
+// request formats are declared in binding tags rather than checked in every handler.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/utils"
+)
+
+// Custom binding tags
+const (
+	TagIranianMobile = "iranianMobile" // an Iranian mobile number: +989XXXXXXXXX, 989XXXXXXXXX or 09XXXXXXXXX
+	TagE164          = "e164"          // an international number in E.164 format, e.g. +14155550123
+	TagOTPCode       = "otpcode"       // an OTP: otp.length digits
+	TagIranianVoice  = "iranianVoice"  // a number to call: an Iranian mobile number, or landline with otp.channels.voiceLandlines
+)
+
+var e164Regex = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// Register registers the custom validators with Gin's binding engine. The length of OTPs and
+// whether landlines are called are read from cfg on each validation, so they follow
+// configuration reloads.
+func Register(cfg config.Provider) error {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return fmt.Errorf("unsupported binding validator %T", binding.Validator.Engine())
+	}
+
+	validators := map[string]validator.Func{
+		TagIranianMobile: func(fl validator.FieldLevel) bool {
+			return utils.IsValidPhoneNumber(fl.Field().String())
+		},
+		TagE164: func(fl validator.FieldLevel) bool {
+			return e164Regex.MatchString(fl.Field().String())
+		},
+		TagOTPCode: func(fl validator.FieldLevel) bool {
+			return isOTPCode(fl.Field().String(), cfg.Current().OTP.Length)
+		},
+		TagIranianVoice: func(fl validator.FieldLevel) bool {
+			phoneNumber := fl.Field().String()
+			return utils.IsValidPhoneNumber(phoneNumber) ||
+				(cfg.Current().OTP.Channels.VoiceLandlines && utils.IsValidLandline(phoneNumber))
+		},
+	}
+	for tag, fn := range validators {
+		if err := validate.RegisterValidation(tag, fn); err != nil {
+			return fmt.Errorf("error registering %s validator: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// isOTPCode reports whether code consists of exactly length digits
+func isOTPCode(code string, length int) bool {
+	if len(code) != length {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FailedTag returns the tag field failed validation on in err, a binding error, and whether it
+// failed at all. field is the struct field's name, e.g. PhoneNumber.
+func FailedTag(err error, field string) (string, bool) {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return "", false
+	}
+	for _, fieldErr := range validationErrs {
+		if fieldErr.Field() == field {
+			return fieldErr.Tag(), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lilokie/otp-auth/config"
+	"github.com/lilokie/otp-auth/internal/models"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderDeliveryID = "X-Webhook-ID" // the same on every attempt of a delivery, for deduplication
+	HeaderEvent      = "X-Webhook-Event"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderSignature  = "X-Webhook-Signature"
+)
+
+// Signature returns the value of the signature header for a body sent at timestamp (Unix seconds):
+// "sha256=" followed by the hex HMAC-SHA256, keyed with the endpoint's secret, of the timestamp,
+// a dot and the body. Covering the timestamp lets receivers reject replayed deliveries.
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateEndpoints checks that every configured endpoint has a unique name, a URL and a secret
+func ValidateEndpoints(endpoints []config.WebhookEndpointConfig) error {
+	seen := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.Name == "" {
+			return fmt.Errorf("webhook endpoint name cannot be empty")
+		}
+		if seen[endpoint.Name] {
+			return fmt.Errorf("duplicate webhook endpoint name: %s", endpoint.Name)
+		}
+		seen[endpoint.Name] = true
+
+		if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL for webhook endpoint %s", endpoint.Name)
+		}
+		if endpoint.Secret == "" {
+			return fmt.Errorf("webhook endpoint %s has no secret", endpoint.Name)
+		}
+	}
+	return nil
+}
+
+// StatusError is returned by Send when an endpoint responds with a status other than 2xx
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook endpoint responded with status %d", e.StatusCode)
+}
+
+// Client delivers signed webhook requests
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates a new webhook client whose requests time out after timeout
+func NewClient(timeout time.Duration) *Client {
+	return &Client{httpClient: &http.Client{Timeout: timeout}}
+}
+
+// Send posts a delivery's body to an endpoint. Any response other than 2xx is an error.
+func (c *Client) Send(ctx context.Context, endpoint config.WebhookEndpointConfig, delivery models.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDeliveryID, delivery.ID.String())
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Signature(endpoint.Secret, timestamp, delivery.Body))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS verified_source VARCHAR(50) NULL;
+
+-- Users so far were only created after verifying their phone number by OTP
+UPDATE users
+SET
+    phone_verified = TRUE,
+    verified_source = 'otp'
+WHERE
+    phone_verified = FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_users_phone_verified ON users (phone_verified, verified_source);
@@ -0,0 +1,68 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Append-only: rows are never updated or deleted, sequence gives the replay order
+CREATE TABLE
+    IF NOT EXISTS domain_events (
+        sequence BIGSERIAL PRIMARY KEY,
+        id UUID NOT NULL UNIQUE,
+        type VARCHAR(64) NOT NULL,
+        aggregate_type VARCHAR(32) NOT NULL,
+        aggregate_id VARCHAR(64) NOT NULL,
+        payload JSONB NOT NULL DEFAULT '{}',
+        occurred_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW ()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_domain_events_aggregate ON domain_events (aggregate_type, aggregate_id, sequence);
+
+CREATE INDEX IF NOT EXISTS idx_domain_events_type ON domain_events (type);
+
+-- Users created before the event log existed start it off, so replays see every user
+INSERT INTO
+    domain_events (id, type, aggregate_type, aggregate_id, payload, occurred_at)
+SELECT
+    uuid_generate_v4 (),
+    'user.created',
+    'user',
+    id::TEXT,
+    jsonb_build_object (
+        'id', id,
+        'phone_number', phone_number,
+        'role', role,
+        'phone_verified', phone_verified,
+        'verified_source', verified_source,
+        'created_at', created_at,
+        'updated_at', updated_at
+    ),
+    created_at
+FROM
+    users
+WHERE
+    NOT EXISTS (
+        SELECT 1
+        FROM domain_events
+    )
+ORDER BY
+    created_at;
+
+INSERT INTO
+    domain_events (id, type, aggregate_type, aggregate_id, payload, occurred_at)
+SELECT
+    uuid_generate_v4 (),
+    'user.deleted',
+    'user',
+    id::TEXT,
+    '{}',
+    deleted_at
+FROM
+    users
+WHERE
+    deleted_at IS NOT NULL
+    AND NOT EXISTS (
+        SELECT 1
+        FROM domain_events
+        WHERE type = 'user.deleted'
+    )
+ORDER BY
+    deleted_at;
@@ -0,0 +1,23 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Phone numbers with a pending or confirmed report get no OTPs
+CREATE TABLE
+    IF NOT EXISTS abuse_reports (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+        phone_number VARCHAR(20) NOT NULL,
+        reporter_type VARCHAR(16) NOT NULL,
+        details TEXT NULL,
+        ip_address VARCHAR(45) NOT NULL,
+        status VARCHAR(16) NOT NULL DEFAULT 'pending',
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW (),
+            reviewed_at TIMESTAMP
+        WITH
+            TIME ZONE NULL,
+            reviewed_by UUID NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_abuse_reports_phone_status ON abuse_reports (phone_number, status);
+
+CREATE INDEX IF NOT EXISTS idx_abuse_reports_status_created ON abuse_reports (status, created_at);
@@ -0,0 +1,43 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- One row per domain event and endpoint, so instances queueing the same event deliver it once
+CREATE TABLE
+    IF NOT EXISTS webhook_deliveries (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+        endpoint VARCHAR(64) NOT NULL,
+        event_id UUID NOT NULL,
+        event_type VARCHAR(64) NOT NULL,
+        body JSONB NOT NULL,
+        status VARCHAR(16) NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW (),
+            last_error TEXT NULL,
+            created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW (),
+            delivered_at TIMESTAMP
+        WITH
+            TIME ZONE NULL,
+            UNIQUE (endpoint, event_id)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at)
+WHERE
+    status = 'pending';
+
+-- Sequence number of the last domain event queued for webhooks
+CREATE TABLE
+    IF NOT EXISTS webhook_cursor (
+        id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+        last_sequence BIGINT NOT NULL
+    );
+
+-- Start after the events recorded so far instead of delivering the whole history
+INSERT INTO
+    webhook_cursor (last_sequence)
+SELECT
+    COALESCE(MAX(sequence), 0)
+FROM
+    domain_events ON CONFLICT DO NOTHING;
@@ -0,0 +1,28 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- No SMS are sent to phone numbers on the suppression list, whatever the reason
+CREATE TABLE
+    IF NOT EXISTS suppressions (
+        phone_number VARCHAR(20) NOT NULL,
+        reason VARCHAR(32) NOT NULL,
+        source VARCHAR(64) NOT NULL,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW (),
+            PRIMARY KEY (phone_number, reason)
+    );
+
+-- Abuse reports suppressed OTPs directly before the suppression list existed
+INSERT INTO
+    suppressions (phone_number, reason, source, created_at)
+SELECT
+    phone_number,
+    'abuse_report',
+    'abuse_report',
+    MIN(created_at)
+FROM
+    abuse_reports
+WHERE
+    status IN ('pending', 'confirmed')
+GROUP BY
+    phone_number ON CONFLICT DO NOTHING;
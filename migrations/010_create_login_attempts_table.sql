@@ -0,0 +1,19 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Every OTP or backup code verification, successful or not, for the users' login history
+CREATE TABLE
+    IF NOT EXISTS login_attempts (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+        user_id UUID NULL REFERENCES users (id) ON DELETE CASCADE,
+        phone_number VARCHAR(20) NOT NULL,
+        method VARCHAR(16) NOT NULL,
+        success BOOLEAN NOT NULL,
+        failure_reason VARCHAR(32) NULL,
+        ip_address VARCHAR(45) NOT NULL,
+        user_agent TEXT NOT NULL,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW ()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user_created ON login_attempts (user_id, created_at DESC);
@@ -0,0 +1,28 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Devices whose token lets their user sign in without an OTP
+CREATE TABLE
+    IF NOT EXISTS trusted_devices (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+        user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        token_hash VARCHAR(64) NOT NULL,
+        name VARCHAR(100) NOT NULL,
+        user_agent TEXT NOT NULL,
+        ip_address VARCHAR(45) NOT NULL,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW (),
+            last_used_at TIMESTAMP
+        WITH
+            TIME ZONE NULL,
+            expires_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            revoked_at TIMESTAMP
+        WITH
+            TIME ZONE NULL
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trusted_devices_token_hash ON trusted_devices (token_hash);
+
+CREATE INDEX IF NOT EXISTS idx_trusted_devices_user ON trusted_devices (user_id, created_at DESC);
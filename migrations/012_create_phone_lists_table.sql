@@ -0,0 +1,14 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Phone numbers and prefixes OTPs are never sent to (block) or, in allowlist-only mode, the only ones they are sent to (allow)
+CREATE TABLE
+    IF NOT EXISTS phone_lists (
+        list VARCHAR(16) NOT NULL,
+        prefix VARCHAR(20) NOT NULL,
+        reason VARCHAR(255) NOT NULL DEFAULT '',
+        created_by UUID NULL,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW (),
+            PRIMARY KEY (list, prefix)
+    );
@@ -0,0 +1,5 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Whether events about the user may reach analytics webhook endpoints unchanged
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS analytics_consent BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Lets user listing seek to a cursor, newest first, instead of skipping rows
+CREATE INDEX IF NOT EXISTS idx_users_created_id ON users (created_at DESC, id DESC)
+WHERE
+    deleted_at IS NULL;
@@ -0,0 +1,36 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- OTP challenges and the resend cooldowns and failed verifications of phone numbers, for
+-- deployments keeping OTPs in Postgres (otp.store: postgres) rather than Redis. Expired rows
+-- are ignored by reads and deleted by the cleanup job.
+CREATE TABLE
+    IF NOT EXISTS otp_challenges (
+        id VARCHAR(64) PRIMARY KEY,
+        phone_number VARCHAR(20) NOT NULL,
+        data JSONB NOT NULL,
+        issued_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW (),
+            expires_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_otp_challenges_phone_number ON otp_challenges (phone_number, issued_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_otp_challenges_expires_at ON otp_challenges (expires_at);
+
+CREATE TABLE
+    IF NOT EXISTS otp_rate_limits (
+        phone_number VARCHAR(20) PRIMARY KEY,
+        cooldown_until TIMESTAMP
+        WITH
+            TIME ZONE NULL,
+            failures INTEGER NOT NULL DEFAULT 0,
+            window_ends_at TIMESTAMP
+        WITH
+            TIME ZONE NULL,
+            locked_until TIMESTAMP
+        WITH
+            TIME ZONE NULL
+    );
@@ -0,0 +1,28 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Keys services authenticate with to call the API on their own behalf, with the scopes they
+-- were granted. Only a hash of each key is stored.
+CREATE TABLE
+    IF NOT EXISTS api_keys (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+        name VARCHAR(100) NOT NULL,
+        key_hash VARCHAR(64) NOT NULL,
+        key_prefix VARCHAR(16) NOT NULL,
+        scopes JSONB NOT NULL DEFAULT '[]',
+        created_by UUID NULL,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT NOW (),
+            last_used_at TIMESTAMP
+        WITH
+            TIME ZONE NULL,
+            revoked_at TIMESTAMP
+        WITH
+            TIME ZONE NULL
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys (key_hash);
+
+-- Whether the actor of an audit log entry is a user or an API key
+ALTER TABLE audit_logs
+    ADD COLUMN IF NOT EXISTS actor_type VARCHAR(16) NOT NULL DEFAULT 'user';